@@ -0,0 +1,62 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// addDuplicateMarker is the line which follows the index in a marshalled
+// AddResponse for a leaf which had already been sequenced.
+const addDuplicateMarker = "duplicate"
+
+// AddResponse is the body of a successful response from a log's add endpoint.
+type AddResponse struct {
+	// Index is the sequence number assigned to the leaf.
+	Index uint64
+	// Duplicate is true if the leaf had previously been sequenced, in which
+	// case Index is the sequence number of the original entry, and the leaf
+	// was not sequenced again.
+	Duplicate bool
+}
+
+// MarshalText implements encoding/TextMarshaler and writes out an AddResponse
+// instance in the following format:
+//
+// <index in decimal>\n
+// [duplicate\n]
+func (r AddResponse) MarshalText() ([]byte, error) {
+	s := fmt.Sprintf("%d\n", r.Index)
+	if r.Duplicate {
+		s += addDuplicateMarker + "\n"
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText implements encoding/TextUnmarshaler and reads AddResponses
+// which were written by the MarshalText method. Surrounding whitespace, and
+// any lines after the duplicate marker, are ignored.
+func (r *AddResponse) UnmarshalText(raw []byte) error {
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	idx, err := strconv.ParseUint(strings.TrimSpace(lines[0]), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid index: %w", err)
+	}
+	r.Index = idx
+	r.Duplicate = len(lines) > 1 && strings.TrimSpace(lines[1]) == addDuplicateMarker
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"testing"
+
+	"github.com/transparency-dev/serverless-log/api"
+)
+
+func TestAddResponseRoundtrip(t *testing.T) {
+	for _, want := range []api.AddResponse{
+		{Index: 42},
+		{Index: 7, Duplicate: true},
+	} {
+		raw, err := want.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText() = %v", err)
+		}
+		var got api.AddResponse
+		if err := got.UnmarshalText(raw); err != nil {
+			t.Fatalf("UnmarshalText(%q) = %v", raw, err)
+		}
+		if got != want {
+			t.Errorf("UnmarshalText(%q) = %+v, want %+v", raw, got, want)
+		}
+	}
+}
+
+func TestUnmarshalAddResponse(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    api.AddResponse
+		wantErr bool
+	}{
+		{
+			desc: "no trailing newline",
+			raw:  "3",
+			want: api.AddResponse{Index: 3},
+		}, {
+			desc: "whitespace",
+			raw:  " 3 \r\n duplicate \n\n",
+			want: api.AddResponse{Index: 3, Duplicate: true},
+		}, {
+			desc: "unknown second line",
+			raw:  "3\nnew\n",
+			want: api.AddResponse{Index: 3},
+		}, {
+			desc:    "empty",
+			raw:     "",
+			wantErr: true,
+		}, {
+			desc:    "not a number",
+			raw:     "OK\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var got api.AddResponse
+			err := got.UnmarshalText([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("UnmarshalText(%q) = %v, wantErr %t", test.raw, err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("UnmarshalText(%q) = %+v, want %+v", test.raw, got, test.want)
+			}
+		})
+	}
+}
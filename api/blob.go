@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// blobRefHeader is the first line of a marshalled BlobRef.
+const blobRefHeader = "serverless-log blob"
+
+// BlobRef is a reference to a blob, i.e. a large leaf payload which is stored
+// in the log's content-addressed blobs/ area rather than in its leaf bundles.
+//
+// The log commits to the marshalled BlobRef as the leaf, which in turn commits
+// to the contents of the blob by its SHA-256 hash, so leaf bundles and leaf
+// hashes stay small however large the payloads are.
+type BlobRef struct {
+	// Hash is the SHA-256 hash of the blob.
+	Hash []byte
+	// Size is the length of the blob in bytes.
+	Size uint64
+}
+
+// NewBlobRef returns a reference to the blob with the given contents.
+func NewBlobRef(blob []byte) BlobRef {
+	h := sha256.Sum256(blob)
+	return BlobRef{Hash: h[:], Size: uint64(len(blob))}
+}
+
+// Verify checks that blob has the contents referenced by r.
+func (r BlobRef) Verify(blob []byte) error {
+	if got := uint64(len(blob)); got != r.Size {
+		return fmt.Errorf("blob has size %d, want %d", got, r.Size)
+	}
+	if h := sha256.Sum256(blob); !bytes.Equal(h[:], r.Hash) {
+		return fmt.Errorf("blob has hash %x, want %x", h, r.Hash)
+	}
+	return nil
+}
+
+// MarshalText implements encoding/TextMarshaller and writes out a BlobRef
+// instance in the following format:
+//
+// serverless-log blob\n
+// <size in decimal>\n
+// <SHA-256 hash hex encoded>\n
+func (r BlobRef) MarshalText() ([]byte, error) {
+	if len(r.Hash) != sha256.Size {
+		return nil, fmt.Errorf("invalid blob hash length %d", len(r.Hash))
+	}
+	return []byte(fmt.Sprintf("%s\n%d\n%s\n", blobRefHeader, r.Size, hex.EncodeToString(r.Hash))), nil
+}
+
+// UnmarshalText implements encoding/TextUnmarshaler and reads BlobRefs which
+// were written by the MarshalText method.
+func (r *BlobRef) UnmarshalText(raw []byte) error {
+	lines := strings.Split(string(raw), "\n")
+	if len(lines) != 4 || lines[0] != blobRefHeader || lines[3] != "" {
+		return fmt.Errorf("not a blob reference")
+	}
+	size, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid blob size: %w", err)
+	}
+	h, err := hex.DecodeString(lines[2])
+	if err != nil || len(h) != sha256.Size {
+		return fmt.Errorf("invalid blob hash %q", lines[2])
+	}
+	r.Hash, r.Size = h, size
+	return nil
+}
+
+// IsBlobRef returns true if leaf holds a marshalled BlobRef.
+func IsBlobRef(leaf []byte) bool {
+	return bytes.HasPrefix(leaf, []byte(blobRefHeader+"\n")) && (&BlobRef{}).UnmarshalText(leaf) == nil
+}
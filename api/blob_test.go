@@ -0,0 +1,92 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/serverless-log/api"
+)
+
+func TestBlobRefRoundtrip(t *testing.T) {
+	blob := []byte("a large artifact")
+	ref := api.NewBlobRef(blob)
+	raw, err := ref.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText() = %v", err)
+	}
+	if !api.IsBlobRef(raw) {
+		t.Errorf("IsBlobRef(%q) = false", raw)
+	}
+	var got api.BlobRef
+	if err := got.UnmarshalText(raw); err != nil {
+		t.Fatalf("UnmarshalText() = %v", err)
+	}
+	if diff := cmp.Diff(ref, got); diff != "" {
+		t.Errorf("Got diff: %s", diff)
+	}
+	if err := got.Verify(blob); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+}
+
+func TestBlobRefVerify(t *testing.T) {
+	ref := api.NewBlobRef([]byte("blob"))
+	for _, test := range []struct {
+		desc    string
+		blob    string
+		wantErr bool
+	}{
+		{
+			desc: "match",
+			blob: "blob",
+		}, {
+			desc:    "wrong size",
+			blob:    "blobs",
+			wantErr: true,
+		}, {
+			desc:    "wrong hash",
+			blob:    "bolb",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			err := ref.Verify([]byte(test.blob))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("Verify(%q) = %v, wantErr %t", test.blob, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnmarshalBlobRefInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"a leaf",
+		"serverless-log blob\n4\n",
+		"serverless-log blob\n4\n3d0d5a1e5a0d0f4e2d4ac1f8a0b0f0b8b7c0b1d3f6c0e4b0a9d8b7a6e5c4d3b2\nextra",
+		"serverless-log blob\nfour\n3d0d5a1e5a0d0f4e2d4ac1f8a0b0f0b8b7c0b1d3f6c0e4b0a9d8b7a6e5c4d3b2\n",
+		"serverless-log blob\n4\n3d0d\n",
+	} {
+		var r api.BlobRef
+		if err := r.UnmarshalText([]byte(raw)); err == nil {
+			t.Errorf("UnmarshalText(%q): got no error", raw)
+		}
+		if api.IsBlobRef([]byte(raw)) {
+			t.Errorf("IsBlobRef(%q) = true", raw)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+)
+
+// LeafBundle represents a bundle of consecutive leaves, as stored by logs whose
+// bundle size is greater than one.
+type LeafBundle struct {
+	// Entries holds the raw leaf data of each entry in the bundle.
+	Entries [][]byte
+}
+
+// MarshalText implements encoding/TextMarshaller and writes out a LeafBundle
+// instance in the following format:
+//
+// <Entries[0] base64 encoded>\n
+// ...
+// <Entries[n] base64 encoded>\n
+func (b LeafBundle) MarshalText() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	for _, e := range b.Entries {
+		if _, err := fmt.Fprintf(buf, "%s\n", base64.StdEncoding.EncodeToString(e)); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalText implements encoding/TextUnmarshaler and reads LeafBundles
+// which were written by the MarshalText method.
+func (b *LeafBundle) UnmarshalText(raw []byte) error {
+	if len(raw) > 0 && raw[len(raw)-1] != '\n' {
+		return fmt.Errorf("leaf bundle is truncated")
+	}
+	lines := bytes.Split(raw, []byte("\n"))
+	entries := make([][]byte, 0, len(lines)-1)
+	for i, l := range lines[:len(lines)-1] {
+		e, err := base64.StdEncoding.DecodeString(string(l))
+		if err != nil {
+			return fmt.Errorf("failed to decode entry %d: %w", i, err)
+		}
+		entries = append(entries, e)
+	}
+	b.Entries = entries
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/serverless-log/api"
+)
+
+func TestMarshalLeafBundleRoundtrip(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		entries [][]byte
+	}{
+		{
+			desc:    "empty",
+			entries: [][]byte{},
+		}, {
+			desc:    "entries",
+			entries: [][]byte{[]byte("one"), {}, []byte("three\nwith newline")},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			raw, err := api.LeafBundle{Entries: test.entries}.MarshalText()
+			if err != nil {
+				t.Fatalf("MarshalText() = %v", err)
+			}
+			var b api.LeafBundle
+			if err := b.UnmarshalText(raw); err != nil {
+				t.Fatalf("UnmarshalText() = %v", err)
+			}
+			if diff := cmp.Diff(test.entries, b.Entries); diff != "" {
+				t.Errorf("Got diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshalLeafBundleInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"b25l\ndHdv",
+		"b25l\n!!!\n",
+	} {
+		var b api.LeafBundle
+		if err := b.UnmarshalText([]byte(raw)); err == nil {
+			t.Errorf("UnmarshalText(%q): got no error", raw)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// envelopeHeader is the first line of a marshalled Envelope.
+	envelopeHeader = "serverless-log encrypted"
+	// DataKeySize is the length in bytes of the AES-256 data keys used to
+	// encrypt resources in Envelopes.
+	DataKeySize = 32
+)
+
+// Envelope is a resource, e.g. a leaf bundle, which is encrypted at rest with
+// envelope encryption: the resource is encrypted with a data key using
+// AES-256-GCM, and the data key is itself encrypted, or wrapped, with a key
+// encryption key which is typically held in a KMS.
+//
+// Leaf hashes, and so the log's tree, are computed over the plaintext
+// resources, so only clients which can unwrap the data key are able to verify
+// the inclusion of leaves.
+//
+// Envelopes don't hide whether a log contains a given leaf: tiles and the
+// leafhash index aren't encrypted, so anyone who can guess a leaf's plaintext
+// can hash it and confirm that it was logged. Leaves with guessable contents
+// should include enough random data, e.g. a salt, to prevent this.
+type Envelope struct {
+	// KeyID identifies the key encryption key which wrapped the data key.
+	KeyID string
+	// WrappedKey is the wrapped data key.
+	WrappedKey []byte
+	// Ciphertext is the GCM nonce followed by the encrypted resource. The
+	// marshalled header, up to and including the wrapped key, is authenticated
+	// as additional data.
+	Ciphertext []byte
+}
+
+// SealEnvelope returns an Envelope holding plaintext encrypted with the data
+// key dek, whose wrapped form is wrappedKey. A random nonce is used, so a data
+// key should not be used to seal more than 2^32 resources.
+func SealEnvelope(keyID string, wrappedKey, dek, plaintext []byte) (Envelope, error) {
+	e := Envelope{KeyID: keyID, WrappedKey: wrappedKey}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return Envelope{}, err
+	}
+	hdr, err := e.header()
+	if err != nil {
+		return Envelope{}, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return Envelope{}, err
+	}
+	e.Ciphertext = aead.Seal(nonce, nonce, plaintext, hdr)
+	return e, nil
+}
+
+// Open returns the plaintext resource held by e, given its unwrapped data key.
+func (e Envelope) Open(dek []byte) ([]byte, error) {
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	hdr, err := e.header()
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	n := aead.NonceSize()
+	p, err := aead.Open(nil, e.Ciphertext[:n], e.Ciphertext[n:], hdr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %v", err)
+	}
+	return p, nil
+}
+
+// MarshalBinary implements encoding/BinaryMarshaler and writes out an Envelope
+// instance in the following format:
+//
+// serverless-log encrypted\n
+// <key ID>\n
+// <wrapped key base64 encoded>\n
+// <ciphertext>
+func (e Envelope) MarshalBinary() ([]byte, error) {
+	hdr, err := e.header()
+	if err != nil {
+		return nil, err
+	}
+	return append(hdr, e.Ciphertext...), nil
+}
+
+// UnmarshalBinary implements encoding/BinaryUnmarshaler and reads Envelopes
+// which were written by the MarshalBinary method.
+func (e *Envelope) UnmarshalBinary(raw []byte) error {
+	lines := bytes.SplitN(raw, []byte("\n"), 4)
+	if len(lines) != 4 || string(lines[0]) != envelopeHeader {
+		return errors.New("not an encrypted resource")
+	}
+	wk, err := base64.StdEncoding.DecodeString(string(lines[2]))
+	if err != nil {
+		return fmt.Errorf("invalid wrapped key: %v", err)
+	}
+	e.KeyID, e.WrappedKey, e.Ciphertext = string(lines[1]), wk, lines[3]
+	return nil
+}
+
+// IsEnvelope returns true if raw holds a marshalled Envelope.
+func IsEnvelope(raw []byte) bool {
+	return bytes.HasPrefix(raw, []byte(envelopeHeader+"\n"))
+}
+
+// header returns the marshalled form of e, up to its ciphertext.
+func (e Envelope) header() ([]byte, error) {
+	if e.KeyID == "" || strings.ContainsAny(e.KeyID, "\n") {
+		return nil, fmt.Errorf("invalid key ID %q", e.KeyID)
+	}
+	if len(e.WrappedKey) == 0 {
+		return nil, errors.New("missing wrapped key")
+	}
+	return []byte(fmt.Sprintf("%s\n%s\n%s\n", envelopeHeader, e.KeyID, base64.StdEncoding.EncodeToString(e.WrappedKey))), nil
+}
+
+// newAEAD returns an AES-256-GCM AEAD using the data key dek.
+func newAEAD(dek []byte) (cipher.AEAD, error) {
+	if len(dek) != DataKeySize {
+		return nil, fmt.Errorf("invalid data key length %d", len(dek))
+	}
+	b, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(b)
+}
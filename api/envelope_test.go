@@ -0,0 +1,154 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/serverless-log/api"
+)
+
+func TestEnvelopeRoundtrip(t *testing.T) {
+	dek := bytes.Repeat([]byte{0x42}, api.DataKeySize)
+	leaf := []byte("a private leaf\nwith two lines")
+	e, err := api.SealEnvelope("kek-1", []byte("wrapped"), dek, leaf)
+	if err != nil {
+		t.Fatalf("SealEnvelope() = %v", err)
+	}
+	raw, err := e.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() = %v", err)
+	}
+	if !api.IsEnvelope(raw) {
+		t.Errorf("IsEnvelope(%q) = false", raw)
+	}
+	if bytes.Contains(raw, leaf) {
+		t.Errorf("MarshalBinary() = %q, contains plaintext", raw)
+	}
+	var got api.Envelope
+	if err := got.UnmarshalBinary(raw); err != nil {
+		t.Fatalf("UnmarshalBinary() = %v", err)
+	}
+	if diff := cmp.Diff(e, got); diff != "" {
+		t.Errorf("Got diff: %s", diff)
+	}
+	p, err := got.Open(dek)
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	if !bytes.Equal(p, leaf) {
+		t.Errorf("Open() = %q, want %q", p, leaf)
+	}
+}
+
+func TestEnvelopeOpen(t *testing.T) {
+	dek := bytes.Repeat([]byte{0x42}, api.DataKeySize)
+	e, err := api.SealEnvelope("kek-1", []byte("wrapped"), dek, []byte("leaf"))
+	if err != nil {
+		t.Fatalf("SealEnvelope() = %v", err)
+	}
+	for _, test := range []struct {
+		desc    string
+		modify  func(e *api.Envelope)
+		dek     []byte
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			dek:  dek,
+		}, {
+			desc:    "wrong key",
+			dek:     bytes.Repeat([]byte{0x43}, api.DataKeySize),
+			wantErr: true,
+		}, {
+			desc:    "short key",
+			dek:     dek[1:],
+			wantErr: true,
+		}, {
+			desc:    "modified key ID",
+			modify:  func(e *api.Envelope) { e.KeyID = "kek-2" },
+			dek:     dek,
+			wantErr: true,
+		}, {
+			desc:    "modified wrapped key",
+			modify:  func(e *api.Envelope) { e.WrappedKey = []byte("Wrapped") },
+			dek:     dek,
+			wantErr: true,
+		}, {
+			desc: "modified ciphertext",
+			modify: func(e *api.Envelope) {
+				e.Ciphertext = bytes.Clone(e.Ciphertext)
+				e.Ciphertext[len(e.Ciphertext)-1] ^= 1
+			},
+			dek:     dek,
+			wantErr: true,
+		}, {
+			desc:    "truncated ciphertext",
+			modify:  func(e *api.Envelope) { e.Ciphertext = e.Ciphertext[:4] },
+			dek:     dek,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			e := e
+			if test.modify != nil {
+				test.modify(&e)
+			}
+			_, err := e.Open(test.dek)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Open() = %v, want err %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnvelopeUnmarshal(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  "serverless-log encrypted\nkek\nd3JhcHBlZA==\nciphertext",
+		}, {
+			desc:    "wrong header",
+			raw:     "serverless-log blob\nkek\nd3JhcHBlZA==\nciphertext",
+			wantErr: true,
+		}, {
+			desc:    "invalid wrapped key",
+			raw:     "serverless-log encrypted\nkek\nnot base64!\nciphertext",
+			wantErr: true,
+		}, {
+			desc:    "missing ciphertext",
+			raw:     "serverless-log encrypted\nkek\nd3JhcHBlZA==",
+			wantErr: true,
+		}, {
+			desc:    "plaintext leaf",
+			raw:     "a leaf",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var e api.Envelope
+			err := e.UnmarshalBinary([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("UnmarshalBinary() = %v, want err %t", err, test.wantErr)
+			}
+		})
+	}
+}
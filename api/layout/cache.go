@@ -0,0 +1,32 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+// Cache-Control header values recommended for serving a log's resources via
+// HTTP, e.g. when the log is stored in an object store which is fronted by a
+// CDN.
+const (
+	// CheckpointCacheControl is recommended for the log's checkpoint, which
+	// is replaced each time the log grows, so must only be cached briefly for
+	// clients to see new checkpoints promptly.
+	CheckpointCacheControl = "public, max-age=10"
+
+	// ImmutableCacheControl is recommended for all other resources, i.e.
+	// tiles, leaf bundles, leafhash index files, blobs and archived
+	// checkpoints. These are never changed once written, and partial tiles
+	// and bundles are stored at different paths to full ones, so they may be
+	// cached indefinitely.
+	ImmutableCacheControl = "public, max-age=31536000, immutable"
+)
@@ -29,13 +29,37 @@ import (
 const (
 	// CheckpointPath is the location of the file containing the log checkpoint.
 	CheckpointPath = "checkpoint"
+
+	// BundleSizePath is the location of the file containing the log's bundle
+	// size, i.e. the number of leaves stored in each file under seq/. Logs
+	// without this file have a bundle size of 1.
+	BundleSizePath = "bundle_size"
+
+	// PrunedPath is the location of the file containing the size of the
+	// log's pruned prefix, i.e. the number of leaves at the start of the log
+	// whose data has been removed. Logs without this file have not been
+	// pruned.
+	PrunedPath = "pruned"
+
+	// ShardIndexPath is the location of the file listing the shards of a
+	// temporally sharded log, see api.ShardIndex, relative to the root of the
+	// sharded log. Each shard's log is stored under the root in a directory
+	// named after the shard.
+	ShardIndexPath = "shards"
 )
 
 // SeqPath builds the directory path and relative filename for the entry at the given
 // sequence number.
 func SeqPath(root string, seq uint64) (string, string) {
-	frag := []string{
-		root,
+	frag := append([]string{root}, seqPathFrags(seq)...)
+	d := filepath.Join(frag[:6]...)
+	return d, frag[6]
+}
+
+// seqPathFrags returns the elements of the path, relative to the log's root,
+// of the entry at the given sequence number.
+func seqPathFrags(seq uint64) []string {
+	return []string{
 		"seq",
 		fmt.Sprintf("%02x", (seq >> 32)),
 		fmt.Sprintf("%02x", (seq>>24)&0xff),
@@ -43,8 +67,18 @@ func SeqPath(root string, seq uint64) (string, string) {
 		fmt.Sprintf("%02x", (seq>>8)&0xff),
 		fmt.Sprintf("%02x", seq&0xff),
 	}
-	d := filepath.Join(frag[:6]...)
-	return d, frag[6]
+}
+
+// BundlePath builds the directory path and relative filename for the leaf bundle
+// with the given index, in a log whose bundle size is greater than 1.
+// partialSize is the number of leaves in the bundle if it is partial, i.e. at
+// the right-hand edge of the log, or 0 if it is full.
+func BundlePath(root string, index, partialSize uint64) (string, string) {
+	d, f := SeqPath(root, index)
+	if partialSize > 0 {
+		f = fmt.Sprintf("%s.%d", f, partialSize)
+	}
+	return d, f
 }
 
 // SeqFromPath recovers a sequence number from the specified path.
@@ -80,18 +114,45 @@ func LeafPath(root string, leafhash []byte) (string, string) {
 	return d, frag[5]
 }
 
+// BlobPath builds the directory path and relative filename for the blob with
+// the given SHA-256 hash, see api.BlobRef.
+func BlobPath(root string, hash []byte) (string, string) {
+	frag := []string{
+		root,
+		"blobs",
+		fmt.Sprintf("%02x", hash[0]),
+		fmt.Sprintf("%02x", hash[1]),
+		fmt.Sprintf("%0x", hash[2:]),
+	}
+	d := filepath.Join(frag[:4]...)
+	return d, frag[4]
+}
+
+// CheckpointArchivePath builds the directory path and relative filename for the
+// archived copy of the log checkpoint with the given tree size.
+func CheckpointArchivePath(root string, size uint64) (string, string) {
+	return filepath.Join(root, "checkpoints"), strconv.FormatUint(size, 10)
+}
+
 // TilePath builds the directory path and relative filename for the subtree tile with the
 // given level and index.
 // partialTileSize should be set to a non-zero number if the path to a partial tile
 // is required.
 func TilePath(root string, level, index, partialTileSize uint64) (string, string) {
+	frag := append([]string{root}, tilePathFrags(level, index, partialTileSize)...)
+	d := filepath.Join(frag[:6]...)
+	return d, frag[6]
+}
+
+// tilePathFrags returns the elements of the path, relative to the log's root,
+// of the subtree tile with the given level and index.
+func tilePathFrags(level, index, partialTileSize uint64) []string {
 	suffix := ""
 	if partialTileSize > 0 {
 		suffix = fmt.Sprintf(".%02x", partialTileSize)
 	}
 
-	frag := []string{
-		root,
+	return []string{
 		"tile",
 		fmt.Sprintf("%02x", level),
 		fmt.Sprintf("%04x", (index >> 24)),
@@ -99,6 +160,4 @@ func TilePath(root string, level, index, partialTileSize uint64) (string, string
 		fmt.Sprintf("%02x", (index>>8)&0xff),
 		fmt.Sprintf("%02x%s", index&0xff, suffix),
 	}
-	d := filepath.Join(frag[:6]...)
-	return d, frag[6]
 }
@@ -61,6 +61,37 @@ func TestSeqPath(t *testing.T) {
 	}
 }
 
+func TestBundlePath(t *testing.T) {
+	for _, test := range []struct {
+		index       uint64
+		partialSize uint64
+		wantDir     string
+		wantFile    string
+	}{
+		{
+			index:    0,
+			wantDir:  "/root/seq/00/00/00/00",
+			wantFile: "00",
+		}, {
+			index:       0x1234,
+			partialSize: 12,
+			wantDir:     "/root/seq/00/00/00/12",
+			wantFile:    "34.12",
+		},
+	} {
+		desc := fmt.Sprintf("index %d partial %d", test.index, test.partialSize)
+		t.Run(desc, func(t *testing.T) {
+			gotDir, gotFile := BundlePath("/root", test.index, test.partialSize)
+			if gotDir != test.wantDir {
+				t.Errorf("Got dir %q want %q", gotDir, test.wantDir)
+			}
+			if gotFile != test.wantFile {
+				t.Errorf("got file %q want %q", gotFile, test.wantFile)
+			}
+		})
+	}
+}
+
 func TestSeqFromPath(t *testing.T) {
 	for _, test := range []struct {
 		desc    string
@@ -150,6 +181,75 @@ func TestLeafPath(t *testing.T) {
 	}
 }
 
+func TestBlobPath(t *testing.T) {
+	for _, test := range []struct {
+		root     string
+		hash     []byte
+		wantDir  string
+		wantFile string
+	}{
+		{
+			root:     "/root/path",
+			hash:     []byte{0x11, 0x22, 0x33, 0x44, 0x55},
+			wantDir:  "/root/path/blobs/11/22",
+			wantFile: "334455",
+		}, {
+			root:     "",
+			hash:     []byte{0x88, 0x99, 0xaa, 0xbb},
+			wantDir:  "blobs/88/99",
+			wantFile: "aabb",
+		},
+	} {
+		desc := fmt.Sprintf("root %q hash %x", test.root, test.hash)
+		t.Run(desc, func(t *testing.T) {
+			gotDir, gotFile := BlobPath(test.root, test.hash)
+			if gotDir != test.wantDir {
+				t.Errorf("Got dir %q want %q", gotDir, test.wantDir)
+			}
+			if gotFile != test.wantFile {
+				t.Errorf("got file %q want %q", gotFile, test.wantFile)
+			}
+		})
+	}
+}
+
+func TestCheckpointArchivePath(t *testing.T) {
+	for _, test := range []struct {
+		root     string
+		size     uint64
+		wantDir  string
+		wantFile string
+	}{
+		{
+			root:     "/root/path",
+			size:     0,
+			wantDir:  "/root/path/checkpoints",
+			wantFile: "0",
+		}, {
+			root:     "/root/path",
+			size:     1234567,
+			wantDir:  "/root/path/checkpoints",
+			wantFile: "1234567",
+		}, {
+			root:     "",
+			size:     42,
+			wantDir:  "checkpoints",
+			wantFile: "42",
+		},
+	} {
+		desc := fmt.Sprintf("root %q size %d", test.root, test.size)
+		t.Run(desc, func(t *testing.T) {
+			gotDir, gotFile := CheckpointArchivePath(test.root, test.size)
+			if gotDir != test.wantDir {
+				t.Errorf("Got dir %q want %q", gotDir, test.wantDir)
+			}
+			if gotFile != test.wantFile {
+				t.Errorf("got file %q want %q", gotFile, test.wantFile)
+			}
+		})
+	}
+}
+
 func TestTilePath(t *testing.T) {
 	for _, test := range []struct {
 		root     string
@@ -0,0 +1,246 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ResourceKind identifies the kind of a resource stored by a log.
+type ResourceKind int
+
+const (
+	// UnknownResource is the zero ResourceKind.
+	UnknownResource ResourceKind = iota
+	// CheckpointResource is the log's checkpoint.
+	CheckpointResource
+	// TileResource is a tile of Merkle tree node hashes.
+	TileResource
+	// EntriesResource holds leaf data, either a bundle of entries or, for the
+	// serverless layout, a single leaf.
+	EntriesResource
+	// LeafIndexResource maps a leaf hash to its index in the log, and is only
+	// stored by the serverless layout.
+	LeafIndexResource
+	// ArchivedCheckpointResource is an archived copy of a previous checkpoint,
+	// and is only stored by the serverless layout.
+	ArchivedCheckpointResource
+)
+
+// Resource identifies a single resource stored by a log.
+type Resource struct {
+	Kind ResourceKind
+	// Level is the level of a TileResource.
+	Level uint64
+	// Index is the index of a TileResource or EntriesResource within its level.
+	// For the serverless layout, whose entries hold a single leaf, this is the
+	// index of the leaf. For an ArchivedCheckpointResource, this is the size of
+	// the tree it commits to.
+	Index uint64
+	// PartialWidth is the number of hashes or entries in a partial tile or
+	// bundle, or 0 if the resource is full.
+	PartialWidth uint64
+	// LeafHash is the leaf hash of a LeafIndexResource.
+	LeafHash []byte
+}
+
+// Scheme maps the resources of a log to the paths, relative to the root of the
+// log, at which they are stored, and back. This allows tools which deal with a
+// log's storage directly, e.g. CDN warmers or storage auditors, to work with
+// any of the supported layouts without hard-coding their path formats.
+//
+// Paths use forward slashes as separators, regardless of platform.
+type Scheme interface {
+	// TilePath returns the path of the tile at the given level and index in a
+	// log of the given size, which is partial if not full at that size.
+	TilePath(level, index, logSize uint64) string
+	// EntriesPath returns the path of the entries resource with the given
+	// index in a log of the given size.
+	EntriesPath(index, logSize uint64) string
+	// ParsePath returns the resource stored at path p.
+	ParsePath(p string) (Resource, error)
+}
+
+var (
+	_ Scheme = ServerlessScheme{}
+	_ Scheme = TlogTilesScheme{}
+	_ Scheme = StaticCTScheme{}
+)
+
+// ServerlessScheme is the Scheme of logs written by this repo, see README.md.
+type ServerlessScheme struct{}
+
+// TilePath implements Scheme.
+func (ServerlessScheme) TilePath(level, index, logSize uint64) string {
+	return path.Join(tilePathFrags(level, index, PartialTileSize(level, index, logSize))...)
+}
+
+// EntriesPath implements Scheme, index is the index of a leaf.
+func (ServerlessScheme) EntriesPath(index, _ uint64) string {
+	return path.Join(seqPathFrags(index)...)
+}
+
+// ParsePath implements Scheme.
+func (ServerlessScheme) ParsePath(p string) (Resource, error) {
+	if p == CheckpointPath {
+		return Resource{Kind: CheckpointResource}, nil
+	}
+	e := strings.Split(p, "/")
+	switch {
+	case len(e) == 6 && e[0] == "tile":
+		r := Resource{Kind: TileResource}
+		last, partial, isPartial := strings.Cut(e[5], ".")
+		if isPartial {
+			w, err := parseHex(partial, 2)
+			if err != nil || w == 0 {
+				return Resource{}, fmt.Errorf("invalid partial tile size in %q", p)
+			}
+			r.PartialWidth = w
+		}
+		var err error
+		if r.Level, err = parseHex(e[1], 2); err != nil {
+			return Resource{}, fmt.Errorf("invalid tile level in %q", p)
+		}
+		if r.Index, err = parseHex(e[2]+e[3]+e[4]+last, 10); err != nil || len(e[2]) != 4 || len(e[3]) != 2 || len(e[4]) != 2 || len(last) != 2 {
+			return Resource{}, fmt.Errorf("invalid tile index in %q", p)
+		}
+		return r, nil
+	case len(e) == 6 && e[0] == "seq":
+		for _, s := range e[2:] {
+			if len(s) != 2 {
+				return Resource{}, fmt.Errorf("invalid sequence number in %q", p)
+			}
+		}
+		seq, err := parseHex(strings.Join(e[1:], ""), 16)
+		if err != nil || len(e[1]) < 2 {
+			return Resource{}, fmt.Errorf("invalid sequence number in %q", p)
+		}
+		return Resource{Kind: EntriesResource, Index: seq}, nil
+	case len(e) == 5 && e[0] == "leaves":
+		if len(e[1]) != 2 || len(e[2]) != 2 || len(e[3]) != 2 {
+			return Resource{}, fmt.Errorf("invalid leaf hash in %q", p)
+		}
+		h, err := hex.DecodeString(strings.Join(e[1:], ""))
+		if err != nil {
+			return Resource{}, fmt.Errorf("invalid leaf hash in %q", p)
+		}
+		return Resource{Kind: LeafIndexResource, LeafHash: h}, nil
+	case len(e) == 2 && e[0] == "checkpoints":
+		size, err := strconv.ParseUint(e[1], 10, 64)
+		if err != nil || strconv.FormatUint(size, 10) != e[1] {
+			return Resource{}, fmt.Errorf("invalid checkpoint size in %q", p)
+		}
+		return Resource{Kind: ArchivedCheckpointResource, Index: size}, nil
+	}
+	return Resource{}, fmt.Errorf("unrecognised path %q", p)
+}
+
+// TlogTilesScheme is the Scheme described by the C2SP tlog-tiles spec.
+//
+// See https://c2sp.org/tlog-tiles.
+type TlogTilesScheme struct{}
+
+// TilePath implements Scheme.
+func (TlogTilesScheme) TilePath(level, index, logSize uint64) string {
+	return TlogTilePath(level, index, PartialTileSize(level, index, logSize))
+}
+
+// EntriesPath implements Scheme.
+func (TlogTilesScheme) EntriesPath(index, logSize uint64) string {
+	return TlogEntriesPath(index, PartialTileSize(0, index, logSize))
+}
+
+// ParsePath implements Scheme.
+func (TlogTilesScheme) ParsePath(p string) (Resource, error) {
+	return parseTlogPath(p, "entries")
+}
+
+// StaticCTScheme is the Scheme described by the C2SP static-ct-api spec, whose
+// entries are stored in data tiles.
+//
+// See https://c2sp.org/static-ct-api.
+type StaticCTScheme struct{}
+
+// TilePath implements Scheme.
+func (StaticCTScheme) TilePath(level, index, logSize uint64) string {
+	return TlogTilePath(level, index, PartialTileSize(level, index, logSize))
+}
+
+// EntriesPath implements Scheme.
+func (StaticCTScheme) EntriesPath(index, logSize uint64) string {
+	return StaticCTDataPath(index, PartialTileSize(0, index, logSize))
+}
+
+// ParsePath implements Scheme.
+func (StaticCTScheme) ParsePath(p string) (Resource, error) {
+	return parseTlogPath(p, "data")
+}
+
+// parseTlogPath parses a path in the tlog-tiles style, where entries is the
+// name of the directory holding entry bundles.
+func parseTlogPath(p, entries string) (Resource, error) {
+	if p == CheckpointPath {
+		return Resource{Kind: CheckpointResource}, nil
+	}
+	e := strings.Split(p, "/")
+	if len(e) < 3 || e[0] != "tile" {
+		return Resource{}, fmt.Errorf("unrecognised path %q", p)
+	}
+	r := Resource{Kind: TileResource}
+	if e[1] == entries {
+		r.Kind = EntriesResource
+	} else {
+		l, err := strconv.ParseUint(e[1], 10, 8)
+		if err != nil || strconv.FormatUint(l, 10) != e[1] {
+			return Resource{}, fmt.Errorf("invalid tile level in %q", p)
+		}
+		r.Level = l
+	}
+	e = e[2:]
+	if n := len(e); n >= 2 && strings.HasSuffix(e[n-2], ".p") {
+		w, err := strconv.ParseUint(e[n-1], 10, 64)
+		if err != nil || w == 0 || w >= TlogTileWidth || strconv.FormatUint(w, 10) != e[n-1] {
+			return Resource{}, fmt.Errorf("invalid partial width in %q", p)
+		}
+		r.PartialWidth = w
+		e = append(e[:n-2], strings.TrimSuffix(e[n-2], ".p"))
+	}
+	for i, s := range e {
+		if i < len(e)-1 {
+			if !strings.HasPrefix(s, "x") {
+				return Resource{}, fmt.Errorf("invalid tile index in %q", p)
+			}
+			s = s[1:]
+		}
+		d, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || len(s) != 3 {
+			return Resource{}, fmt.Errorf("invalid tile index in %q", p)
+		}
+		r.Index = r.Index*1000 + d
+	}
+	return r, nil
+}
+
+// parseHex parses s as a hex number of at most maxLen digits.
+func parseHex(s string, maxLen int) (uint64, error) {
+	if len(s) == 0 || len(s) > maxLen {
+		return 0, fmt.Errorf("invalid length %d", len(s))
+	}
+	return strconv.ParseUint(s, 16, 64)
+}
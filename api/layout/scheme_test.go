@@ -0,0 +1,200 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSchemePaths(t *testing.T) {
+	for _, test := range []struct {
+		desc                  string
+		s                     Scheme
+		level, index, logSize uint64
+		wantTile, wantEntries string
+	}{
+		{
+			desc:        "serverless full",
+			s:           ServerlessScheme{},
+			level:       0,
+			index:       1,
+			logSize:     1024,
+			wantTile:    "tile/00/0000/00/00/01",
+			wantEntries: "seq/00/00/00/00/01",
+		}, {
+			desc:        "serverless partial",
+			s:           ServerlessScheme{},
+			level:       1,
+			index:       0,
+			logSize:     1024,
+			wantTile:    "tile/01/0000/00/00/00.04",
+			wantEntries: "seq/00/00/00/00/00",
+		}, {
+			desc:        "tlog-tiles",
+			s:           TlogTilesScheme{},
+			level:       0,
+			index:       3,
+			logSize:     1000,
+			wantTile:    "tile/0/003.p/232",
+			wantEntries: "tile/entries/003.p/232",
+		}, {
+			desc:        "static-ct",
+			s:           StaticCTScheme{},
+			level:       0,
+			index:       1234067,
+			logSize:     1 << 40,
+			wantTile:    "tile/0/x001/x234/067",
+			wantEntries: "tile/data/x001/x234/067",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := test.s.TilePath(test.level, test.index, test.logSize); got != test.wantTile {
+				t.Errorf("TilePath: got %q want %q", got, test.wantTile)
+			}
+			if got := test.s.EntriesPath(test.index, test.logSize); got != test.wantEntries {
+				t.Errorf("EntriesPath: got %q want %q", got, test.wantEntries)
+			}
+		})
+	}
+}
+
+func TestSchemeParsePathRoundTrip(t *testing.T) {
+	for _, s := range []Scheme{ServerlessScheme{}, TlogTilesScheme{}, StaticCTScheme{}} {
+		for _, level := range []uint64{0, 1, 2} {
+			for _, index := range []uint64{0, 1, 255, 999, 1000, 1234067, 1<<32 + 7} {
+				for _, logSize := range []uint64{1 << 63, index<<(8*(level+1)) + 3<<(8*level)} {
+					t.Run(fmt.Sprintf("%T/%d/%d/%d", s, level, index, logSize), func(t *testing.T) {
+						p := s.TilePath(level, index, logSize)
+						got, err := s.ParsePath(p)
+						if err != nil {
+							t.Fatalf("ParsePath(%q): %v", p, err)
+						}
+						want := Resource{Kind: TileResource, Level: level, Index: index, PartialWidth: PartialTileSize(level, index, logSize)}
+						if !reflect.DeepEqual(got, want) {
+							t.Errorf("ParsePath(%q): got %+v want %+v", p, got, want)
+						}
+
+						p = s.EntriesPath(index, logSize)
+						got, err = s.ParsePath(p)
+						if err != nil {
+							t.Fatalf("ParsePath(%q): %v", p, err)
+						}
+						want = Resource{Kind: EntriesResource, Index: index}
+						if _, ok := s.(ServerlessScheme); !ok {
+							want.PartialWidth = PartialTileSize(0, index, logSize)
+						}
+						if !reflect.DeepEqual(got, want) {
+							t.Errorf("ParsePath(%q): got %+v want %+v", p, got, want)
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestSchemeParsePath(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		s       Scheme
+		p       string
+		want    Resource
+		wantErr bool
+	}{
+		{
+			desc: "serverless checkpoint",
+			s:    ServerlessScheme{},
+			p:    "checkpoint",
+			want: Resource{Kind: CheckpointResource},
+		}, {
+			desc: "serverless leaf index",
+			s:    ServerlessScheme{},
+			p:    "leaves/01/02/03/0405",
+			want: Resource{Kind: LeafIndexResource, LeafHash: []byte{1, 2, 3, 4, 5}},
+		}, {
+			desc: "serverless archived checkpoint",
+			s:    ServerlessScheme{},
+			p:    "checkpoints/1234",
+			want: Resource{Kind: ArchivedCheckpointResource, Index: 1234},
+		}, {
+			desc:    "serverless bad archived checkpoint",
+			s:       ServerlessScheme{},
+			p:       "checkpoints/01234",
+			wantErr: true,
+		}, {
+			desc: "tlog-tiles checkpoint",
+			s:    TlogTilesScheme{},
+			p:    "checkpoint",
+			want: Resource{Kind: CheckpointResource},
+		}, {
+			desc:    "serverless bad tile index",
+			s:       ServerlessScheme{},
+			p:       "tile/00/000/00/00/01",
+			wantErr: true,
+		}, {
+			desc:    "serverless zero partial",
+			s:       ServerlessScheme{},
+			p:       "tile/00/0000/00/00/01.00",
+			wantErr: true,
+		}, {
+			desc:    "serverless unknown",
+			s:       ServerlessScheme{},
+			p:       "banana",
+			wantErr: true,
+		}, {
+			desc:    "tlog-tiles data directory",
+			s:       TlogTilesScheme{},
+			p:       "tile/data/000",
+			wantErr: true,
+		}, {
+			desc:    "tlog-tiles padded level",
+			s:       TlogTilesScheme{},
+			p:       "tile/01/000",
+			wantErr: true,
+		}, {
+			desc:    "tlog-tiles short index",
+			s:       TlogTilesScheme{},
+			p:       "tile/0/01",
+			wantErr: true,
+		}, {
+			desc:    "tlog-tiles missing x prefix",
+			s:       TlogTilesScheme{},
+			p:       "tile/0/001/000",
+			wantErr: true,
+		}, {
+			desc:    "tlog-tiles full width partial",
+			s:       TlogTilesScheme{},
+			p:       "tile/0/000.p/256",
+			wantErr: true,
+		}, {
+			desc:    "static-ct entries directory",
+			s:       StaticCTScheme{},
+			p:       "tile/entries/000",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := test.s.ParsePath(test.p)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParsePath(%q): got err %v, wantErr %t", test.p, err, test.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParsePath(%q): got %+v want %+v", test.p, got, test.want)
+			}
+		})
+	}
+}
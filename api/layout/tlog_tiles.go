@@ -0,0 +1,66 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"fmt"
+)
+
+// TlogTileWidth is the maximum number of hashes or entries in a C2SP tlog-tiles
+// tile or entry bundle.
+const TlogTileWidth = 256
+
+// TlogTilePath returns the path, relative to the root of the log, of the
+// C2SP tlog-tiles hash tile with the given level and index.
+// partialWidth should be set to a non-zero number if the path to a partial tile
+// is required.
+//
+// See https://c2sp.org/tlog-tiles.
+func TlogTilePath(level, index, partialWidth uint64) string {
+	return fmt.Sprintf("tile/%d/%s", level, tlogIndexPath(index, partialWidth))
+}
+
+// TlogEntriesPath returns the path, relative to the root of the log, of the
+// C2SP tlog-tiles entry bundle with the given index.
+// partialWidth should be set to a non-zero number if the path to a partial
+// bundle is required.
+func TlogEntriesPath(index, partialWidth uint64) string {
+	return "tile/entries/" + tlogIndexPath(index, partialWidth)
+}
+
+// tlogIndexPath encodes a tile index as a path per tlog-tiles: the index is
+// split into 3 digit zero-padded decimal elements, all but the last of which
+// are prefixed with "x".
+func tlogIndexPath(index, partialWidth uint64) string {
+	s := fmt.Sprintf("%03d", index%1000)
+	for index >= 1000 {
+		index /= 1000
+		s = fmt.Sprintf("x%03d/%s", index%1000, s)
+	}
+	if partialWidth > 0 {
+		s = fmt.Sprintf("%s.p/%d", s, partialWidth)
+	}
+	return s
+}
+
+// StaticCTDataPath returns the path, relative to the root of the log, of the
+// C2SP static-ct-api data tile with the given index.
+// partialWidth should be set to a non-zero number if the path to a partial
+// data tile is required.
+//
+// See https://c2sp.org/static-ct-api.
+func StaticCTDataPath(index, partialWidth uint64) string {
+	return "tile/data/" + tlogIndexPath(index, partialWidth)
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTlogTilePath(t *testing.T) {
+	for _, test := range []struct {
+		level, index, width uint64
+		want                string
+	}{
+		{level: 0, index: 0, want: "tile/0/000"},
+		{level: 0, index: 0, width: 14, want: "tile/0/000.p/14"},
+		{level: 1, index: 999, want: "tile/1/999"},
+		{level: 2, index: 1000, want: "tile/2/x001/000"},
+		{level: 0, index: 1234067, width: 255, want: "tile/0/x001/x234/067.p/255"},
+	} {
+		t.Run(fmt.Sprintf("%d/%d/%d", test.level, test.index, test.width), func(t *testing.T) {
+			if got := TlogTilePath(test.level, test.index, test.width); got != test.want {
+				t.Errorf("got %q want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTlogEntriesPath(t *testing.T) {
+	for _, test := range []struct {
+		index, width uint64
+		want         string
+	}{
+		{index: 0, want: "tile/entries/000"},
+		{index: 5, width: 1, want: "tile/entries/005.p/1"},
+		{index: 1234067, want: "tile/entries/x001/x234/067"},
+	} {
+		t.Run(fmt.Sprintf("%d/%d", test.index, test.width), func(t *testing.T) {
+			if got := TlogEntriesPath(test.index, test.width); got != test.want {
+				t.Errorf("got %q want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStaticCTDataPath(t *testing.T) {
+	for _, test := range []struct {
+		index, width uint64
+		want         string
+	}{
+		{index: 0, want: "tile/data/000"},
+		{index: 7, width: 200, want: "tile/data/007.p/200"},
+		{index: 1234067, want: "tile/data/x001/x234/067"},
+	} {
+		t.Run(fmt.Sprintf("%d/%d", test.index, test.width), func(t *testing.T) {
+			if got := StaticCTDataPath(test.index, test.width); got != test.want {
+				t.Errorf("got %q want %q", got, test.want)
+			}
+		})
+	}
+}
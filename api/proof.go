@@ -0,0 +1,187 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// InclusionProofHeader is the first line of a marshalled InclusionProof.
+	InclusionProofHeader = "c2sp.org/tlog-proof@v1"
+	// ConsistencyProofHeader is the first line of a marshalled
+	// ConsistencyProof.
+	ConsistencyProofHeader = "github.com/transparency-dev/serverless-log/consistency-proof@v1"
+)
+
+// InclusionProof is a self-contained proof that the leaf at Index is included
+// in the tree committed to by a signed checkpoint.
+//
+// It's marshalled in the c2sp.org/tlog-proof@v1 format, see
+// https://c2sp.org/tlog-proof, so may be verified by other implementations.
+type InclusionProof struct {
+	// Extra is optional opaque data carried with the proof.
+	Extra []byte
+	// Index is the index of the leaf in the log.
+	Index uint64
+	// Hashes is the inclusion proof from the leaf to the checkpoint's root.
+	Hashes [][]byte
+	// Checkpoint is the signed checkpoint note.
+	Checkpoint []byte
+}
+
+// MarshalText implements encoding/TextMarshaler and writes out an
+// InclusionProof instance in the following format:
+//
+// c2sp.org/tlog-proof@v1\n
+// [extra <base64 extra data>\n]
+// index <leaf index in decimal>\n
+// <base64 proof hash>\n
+// ...
+// \n
+// <signed checkpoint note>
+func (p InclusionProof) MarshalText() ([]byte, error) {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n", InclusionProofHeader)
+	if p.Extra != nil {
+		fmt.Fprintf(b, "extra %s\n", base64.StdEncoding.EncodeToString(p.Extra))
+	}
+	fmt.Fprintf(b, "index %d\n", p.Index)
+	return marshalProof(b, p.Hashes, p.Checkpoint)
+}
+
+// UnmarshalText implements encoding/TextUnmarshaler and reads InclusionProofs
+// which were written by the MarshalText method, or any other implementation of
+// the c2sp.org/tlog-proof@v1 format.
+func (p *InclusionProof) UnmarshalText(raw []byte) error {
+	lines, cp, err := splitProof(raw, InclusionProofHeader)
+	if err != nil {
+		return err
+	}
+	var extra []byte
+	if v, ok := strings.CutPrefix(lines[0], "extra "); ok {
+		if extra, err = base64.StdEncoding.DecodeString(v); err != nil {
+			return fmt.Errorf("invalid extra data: %v", err)
+		}
+		lines = lines[1:]
+	}
+	idx, hashes, err := parseProof(lines, "index")
+	if err != nil {
+		return err
+	}
+	p.Extra, p.Index, p.Hashes, p.Checkpoint = extra, idx, hashes, cp
+	return nil
+}
+
+// ConsistencyProof is a self-contained proof that the tree of size OldSize is
+// a prefix of the tree committed to by a signed checkpoint.
+type ConsistencyProof struct {
+	// OldSize is the size of the smaller tree.
+	OldSize uint64
+	// Hashes is the consistency proof from OldSize to the checkpoint's size.
+	Hashes [][]byte
+	// Checkpoint is the signed checkpoint note for the larger tree.
+	Checkpoint []byte
+}
+
+// MarshalText implements encoding/TextMarshaler and writes out a
+// ConsistencyProof instance in the following format, modelled on the
+// c2sp.org/tlog-proof@v1 format:
+//
+// github.com/transparency-dev/serverless-log/consistency-proof@v1\n
+// old <smaller tree size in decimal>\n
+// <base64 proof hash>\n
+// ...
+// \n
+// <signed checkpoint note>
+func (p ConsistencyProof) MarshalText() ([]byte, error) {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\nold %d\n", ConsistencyProofHeader, p.OldSize)
+	return marshalProof(b, p.Hashes, p.Checkpoint)
+}
+
+// UnmarshalText implements encoding/TextUnmarshaler and reads
+// ConsistencyProofs which were written by the MarshalText method.
+func (p *ConsistencyProof) UnmarshalText(raw []byte) error {
+	lines, cp, err := splitProof(raw, ConsistencyProofHeader)
+	if err != nil {
+		return err
+	}
+	size, hashes, err := parseProof(lines, "old")
+	if err != nil {
+		return err
+	}
+	p.OldSize, p.Hashes, p.Checkpoint = size, hashes, cp
+	return nil
+}
+
+// marshalProof appends the proof hashes, an empty line, and the checkpoint to
+// b, and returns its contents.
+func marshalProof(b *bytes.Buffer, hashes [][]byte, cp []byte) ([]byte, error) {
+	if len(cp) == 0 {
+		return nil, errors.New("no checkpoint")
+	}
+	for _, h := range hashes {
+		fmt.Fprintf(b, "%s\n", base64.StdEncoding.EncodeToString(h))
+	}
+	b.WriteString("\n")
+	b.Write(cp)
+	return b.Bytes(), nil
+}
+
+// splitProof checks that raw starts with the header line, and returns the
+// lines which follow it, up to the first empty line, and the checkpoint which
+// follows the empty line.
+func splitProof(raw []byte, header string) ([]string, []byte, error) {
+	rest, ok := bytes.CutPrefix(raw, []byte(header+"\n"))
+	if !ok {
+		return nil, nil, fmt.Errorf("missing %q header", header)
+	}
+	proof, cp, ok := bytes.Cut(rest, []byte("\n\n"))
+	if !ok || len(cp) == 0 {
+		return nil, nil, errors.New("missing checkpoint")
+	}
+	return strings.Split(string(proof), "\n"), cp, nil
+}
+
+// parseProof parses the proof lines, the first of which holds the named
+// decimal value, and the rest the base64 encoded proof hashes.
+func parseProof(lines []string, name string) (uint64, [][]byte, error) {
+	if len(lines) == 0 {
+		return 0, nil, fmt.Errorf("missing %s line", name)
+	}
+	v, ok := strings.CutPrefix(lines[0], name+" ")
+	if !ok {
+		return 0, nil, fmt.Errorf("missing %s line", name)
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	hashes := make([][]byte, 0, len(lines)-1)
+	for _, l := range lines[1:] {
+		h, err := base64.StdEncoding.DecodeString(l)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid proof hash %q: %v", l, err)
+		}
+		hashes = append(hashes, h)
+	}
+	return n, hashes, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/serverless-log/api"
+)
+
+const testCheckpoint = "example.com/log\n3\nJ9FRnvEsWAoKrdG/4ZsUtb4xGEo8YmptTkU1KJT5D0k=\n\n— example.com/log Az3grlgMsknDXHBwZLN9jqRzAYU5WT1jYb5IJbV+2W0o61HZRPxUtbZDJmdV8p58yKsVY+BZmO0hnPHFhaRwr98f8A8=\n"
+
+func TestInclusionProofRoundtrip(t *testing.T) {
+	for _, want := range []api.InclusionProof{
+		{Index: 2, Hashes: [][]byte{{1, 2, 3}, {4, 5, 6}}, Checkpoint: []byte(testCheckpoint)},
+		{Index: 0, Hashes: [][]byte{}, Checkpoint: []byte(testCheckpoint)},
+		{Extra: []byte("banana"), Index: 7, Hashes: [][]byte{{1}}, Checkpoint: []byte(testCheckpoint)},
+	} {
+		raw, err := want.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText() = %v", err)
+		}
+		var got api.InclusionProof
+		if err := got.UnmarshalText(raw); err != nil {
+			t.Fatalf("UnmarshalText(%q) = %v", raw, err)
+		}
+		if d := cmp.Diff(want, got); d != "" {
+			t.Errorf("UnmarshalText(%q) diff (-want +got):\n%s", raw, d)
+		}
+	}
+}
+
+func TestConsistencyProofRoundtrip(t *testing.T) {
+	for _, want := range []api.ConsistencyProof{
+		{OldSize: 1, Hashes: [][]byte{{1, 2, 3}, {4, 5, 6}}, Checkpoint: []byte(testCheckpoint)},
+		{OldSize: 3, Hashes: [][]byte{}, Checkpoint: []byte(testCheckpoint)},
+	} {
+		raw, err := want.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText() = %v", err)
+		}
+		var got api.ConsistencyProof
+		if err := got.UnmarshalText(raw); err != nil {
+			t.Fatalf("UnmarshalText(%q) = %v", raw, err)
+		}
+		if d := cmp.Diff(want, got); d != "" {
+			t.Errorf("UnmarshalText(%q) diff (-want +got):\n%s", raw, d)
+		}
+	}
+}
+
+func TestUnmarshalInclusionProof(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    api.InclusionProof
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  "c2sp.org/tlog-proof@v1\nextra AQI=\nindex 2\nAQID\n\n" + testCheckpoint,
+			want: api.InclusionProof{Extra: []byte{1, 2}, Index: 2, Hashes: [][]byte{{1, 2, 3}}, Checkpoint: []byte(testCheckpoint)},
+		}, {
+			desc:    "wrong header",
+			raw:     "c2sp.org/tlog-proof@v2\nindex 2\nAQID\n\n" + testCheckpoint,
+			wantErr: true,
+		}, {
+			desc:    "consistency proof",
+			raw:     api.ConsistencyProofHeader + "\nold 2\nAQID\n\n" + testCheckpoint,
+			wantErr: true,
+		}, {
+			desc:    "no index",
+			raw:     "c2sp.org/tlog-proof@v1\nextra AQI=\n\n" + testCheckpoint,
+			wantErr: true,
+		}, {
+			desc:    "bad index",
+			raw:     "c2sp.org/tlog-proof@v1\nindex -2\nAQID\n\n" + testCheckpoint,
+			wantErr: true,
+		}, {
+			desc:    "bad hash",
+			raw:     "c2sp.org/tlog-proof@v1\nindex 2\nnot base64!\n\n" + testCheckpoint,
+			wantErr: true,
+		}, {
+			desc:    "no checkpoint",
+			raw:     "c2sp.org/tlog-proof@v1\nindex 2\nAQID\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var got api.InclusionProof
+			err := got.UnmarshalText([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("UnmarshalText(%q) = %v, wantErr %t", test.raw, err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if d := cmp.Diff(test.want, got); d != "" {
+				t.Errorf("UnmarshalText(%q) diff (-want +got):\n%s", test.raw, d)
+			}
+		})
+	}
+}
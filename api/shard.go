@@ -0,0 +1,213 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ShardPeriod is the interval of time covered by each shard of a temporally
+// sharded log, i.e. a sequence of logs each of which only accepts entries
+// associated with a bounded period of time, e.g. certificates expiring in that
+// period. This bounds the size of each tree, and allows shards to be retired
+// once their period has passed.
+type ShardPeriod string
+
+const (
+	// ShardYearly shards cover a calendar year.
+	ShardYearly ShardPeriod = "year"
+	// ShardQuarterly shards cover a quarter of a calendar year.
+	ShardQuarterly ShardPeriod = "quarter"
+)
+
+// ParseShardPeriod returns the ShardPeriod with the given name.
+func ParseShardPeriod(s string) (ShardPeriod, error) {
+	switch p := ShardPeriod(s); p {
+	case ShardYearly, ShardQuarterly:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown shard period %q, want %q or %q", s, ShardYearly, ShardQuarterly)
+}
+
+// Bounds returns the start and end of the period containing t, in UTC. The
+// start is inclusive and the end exclusive.
+func (p ShardPeriod) Bounds(t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	if p == ShardQuarterly {
+		start := time.Date(t.Year(), t.Month()-(t.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 3, 0)
+	}
+	start := time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(1, 0, 0)
+}
+
+// Shard returns the shard covering the period containing t, for a log whose
+// shards' origins are formed from the given base origin, e.g. the shard for
+// 2025-05-01 of the quarterly sharded log example.com/log is named 2025q2 and
+// has the origin example.com/log/2025q2.
+func (p ShardPeriod) Shard(base string, t time.Time) Shard {
+	start, end := p.Bounds(t)
+	name := fmt.Sprintf("%d", start.Year())
+	if p == ShardQuarterly {
+		name = fmt.Sprintf("%dq%d", start.Year(), (start.Month()-1)/3+1)
+	}
+	return Shard{
+		Name:   name,
+		Origin: strings.TrimSuffix(base, "/") + "/" + name,
+		Start:  start,
+		End:    end,
+	}
+}
+
+// Shard describes one shard of a temporally sharded log.
+type Shard struct {
+	// Name identifies the shard, and is also the path of the shard's log
+	// relative to the root of the sharded log.
+	Name string
+	// Origin is the origin of the shard's log.
+	Origin string
+	// Start is the start of the period covered by the shard, inclusive.
+	Start time.Time
+	// End is the end of the period covered by the shard, exclusive.
+	End time.Time
+}
+
+// Contains returns true if t is in the period covered by the shard.
+func (s Shard) Contains(t time.Time) bool {
+	return !t.Before(s.Start) && t.Before(s.End)
+}
+
+// ShardIndex lists the shards of a temporally sharded log, in order of the
+// periods they cover, which must not overlap.
+type ShardIndex struct {
+	Shards []Shard
+}
+
+// Find returns the shard covering t, if there is one.
+func (i ShardIndex) Find(t time.Time) (Shard, bool) {
+	for _, s := range i.Shards {
+		if s.Contains(t) {
+			return s, true
+		}
+	}
+	return Shard{}, false
+}
+
+// Next returns the shard following the one with the given name, if there is
+// one.
+func (i ShardIndex) Next(name string) (Shard, bool) {
+	for j, s := range i.Shards[:max(len(i.Shards)-1, 0)] {
+		if s.Name == name {
+			return i.Shards[j+1], true
+		}
+	}
+	return Shard{}, false
+}
+
+// Add returns a copy of the index with the shard s added, or an error if s
+// overlaps with, or has the same name or origin as, an existing shard.
+func (i ShardIndex) Add(s Shard) (ShardIndex, error) {
+	shards := make([]Shard, 0, len(i.Shards)+1)
+	added := false
+	for _, e := range i.Shards {
+		if !added && !e.Start.Before(s.Start) {
+			shards, added = append(shards, s), true
+		}
+		shards = append(shards, e)
+	}
+	if !added {
+		shards = append(shards, s)
+	}
+	ret := ShardIndex{Shards: shards}
+	return ret, ret.validate()
+}
+
+// validate checks that the shards are well formed, and in order of the
+// non-overlapping periods they cover.
+func (i ShardIndex) validate() error {
+	names := make(map[string]bool)
+	origins := make(map[string]bool)
+	for j, s := range i.Shards {
+		switch {
+		case s.Name == "" || s.Name == "." || s.Name == ".." || strings.ContainsAny(s.Name, "/\\ \t\n"):
+			return fmt.Errorf("shard %d: invalid name %q", j, s.Name)
+		case s.Origin == "" || strings.Contains(s.Origin, "\n"):
+			return fmt.Errorf("shard %q: invalid origin %q", s.Name, s.Origin)
+		case !s.Start.Before(s.End):
+			return fmt.Errorf("shard %q: start %v is not before end %v", s.Name, s.Start, s.End)
+		case names[s.Name]:
+			return fmt.Errorf("shard %q: duplicate name", s.Name)
+		case origins[s.Origin]:
+			return fmt.Errorf("shard %q: duplicate origin %q", s.Name, s.Origin)
+		case j > 0 && s.Start.Before(i.Shards[j-1].End):
+			return fmt.Errorf("shard %q overlaps with shard %q", s.Name, i.Shards[j-1].Name)
+		}
+		names[s.Name], origins[s.Origin] = true, true
+	}
+	return nil
+}
+
+// MarshalText implements encoding/TextMarshaller and writes out a ShardIndex
+// instance in the following format, with one line per shard:
+//
+// <Name> <Start in RFC 3339 format> <End in RFC 3339 format> <Origin>\n
+//
+// The origin is last, since it may contain spaces.
+func (i ShardIndex) MarshalText() ([]byte, error) {
+	if err := i.validate(); err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	for _, s := range i.Shards {
+		if _, err := fmt.Fprintf(buf, "%s %s %s %s\n", s.Name, s.Start.UTC().Format(time.RFC3339), s.End.UTC().Format(time.RFC3339), s.Origin); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalText implements encoding/TextUnmarshaler and reads ShardIndexes
+// which were written by the MarshalText method.
+func (i *ShardIndex) UnmarshalText(raw []byte) error {
+	if len(raw) > 0 && raw[len(raw)-1] != '\n' {
+		return fmt.Errorf("shard index is truncated")
+	}
+	lines := bytes.Split(raw, []byte("\n"))
+	shards := make([]Shard, 0, len(lines)-1)
+	for j, l := range lines[:len(lines)-1] {
+		f := strings.SplitN(string(l), " ", 4)
+		if len(f) != 4 {
+			return fmt.Errorf("line %d: want 4 fields, got %d", j+1, len(f))
+		}
+		start, err := time.Parse(time.RFC3339, f[1])
+		if err != nil {
+			return fmt.Errorf("line %d: invalid start: %v", j+1, err)
+		}
+		end, err := time.Parse(time.RFC3339, f[2])
+		if err != nil {
+			return fmt.Errorf("line %d: invalid end: %v", j+1, err)
+		}
+		shards = append(shards, Shard{Name: f[0], Origin: f[3], Start: start.UTC(), End: end.UTC()})
+	}
+	ret := ShardIndex{Shards: shards}
+	if err := ret.validate(); err != nil {
+		return err
+	}
+	*i = ret
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/serverless-log/api"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestShardPeriod(t *testing.T) {
+	for _, test := range []struct {
+		desc   string
+		period api.ShardPeriod
+		t      time.Time
+		want   api.Shard
+	}{
+		{
+			desc:   "yearly",
+			period: api.ShardYearly,
+			t:      time.Date(2025, time.May, 17, 12, 0, 0, 0, time.UTC),
+			want:   api.Shard{Name: "2025", Origin: "example.com/log/2025", Start: date(2025, time.January, 1), End: date(2026, time.January, 1)},
+		}, {
+			desc:   "quarterly",
+			period: api.ShardQuarterly,
+			t:      time.Date(2025, time.May, 17, 12, 0, 0, 0, time.UTC),
+			want:   api.Shard{Name: "2025q2", Origin: "example.com/log/2025q2", Start: date(2025, time.April, 1), End: date(2025, time.July, 1)},
+		}, {
+			desc:   "quarterly end of year",
+			period: api.ShardQuarterly,
+			t:      date(2025, time.December, 31),
+			want:   api.Shard{Name: "2025q4", Origin: "example.com/log/2025q4", Start: date(2025, time.October, 1), End: date(2026, time.January, 1)},
+		}, {
+			desc:   "other time zone",
+			period: api.ShardYearly,
+			t:      time.Date(2025, time.December, 31, 23, 0, 0, 0, time.FixedZone("UTC-2", -2*60*60)),
+			want:   api.Shard{Name: "2026", Origin: "example.com/log/2026", Start: date(2026, time.January, 1), End: date(2027, time.January, 1)},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got := test.period.Shard("example.com/log/", test.t)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Shard() diff: %s", diff)
+			}
+			if !got.Contains(test.t) {
+				t.Errorf("Shard().Contains(%v) = false", test.t)
+			}
+		})
+	}
+}
+
+func TestShardIndex(t *testing.T) {
+	var idx api.ShardIndex
+	var err error
+	for _, q := range []time.Time{date(2025, time.July, 1), date(2025, time.January, 1), date(2025, time.April, 1)} {
+		if idx, err = idx.Add(api.ShardQuarterly.Shard("example.com/log", q)); err != nil {
+			t.Fatalf("Add() = %v", err)
+		}
+	}
+	for _, s := range []api.Shard{
+		api.ShardQuarterly.Shard("example.com/other", date(2025, time.April, 1)),
+		api.ShardYearly.Shard("example.com/log", date(2025, time.April, 1)),
+		{Name: "../2024", Origin: "example.com/log/2024", Start: date(2024, time.January, 1), End: date(2025, time.January, 1)},
+		{Name: "2026", Origin: "example.com/log/2026", Start: date(2026, time.January, 1), End: date(2026, time.January, 1)},
+	} {
+		if _, err := idx.Add(s); err == nil {
+			t.Errorf("Add(%v): got no error", s)
+		}
+	}
+
+	// Origins may contain spaces.
+	if idx, err = idx.Add(api.ShardQuarterly.Shard("My Log", date(2025, time.October, 1))); err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+	raw, err := idx.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText() = %v", err)
+	}
+	want := "2025q1 2025-01-01T00:00:00Z 2025-04-01T00:00:00Z example.com/log/2025q1\n" +
+		"2025q2 2025-04-01T00:00:00Z 2025-07-01T00:00:00Z example.com/log/2025q2\n" +
+		"2025q3 2025-07-01T00:00:00Z 2025-10-01T00:00:00Z example.com/log/2025q3\n" +
+		"2025q4 2025-10-01T00:00:00Z 2026-01-01T00:00:00Z My Log/2025q4\n"
+	if string(raw) != want {
+		t.Errorf("MarshalText() = %q, want %q", raw, want)
+	}
+	var got api.ShardIndex
+	if err := got.UnmarshalText(raw); err != nil {
+		t.Fatalf("UnmarshalText() = %v", err)
+	}
+	if diff := cmp.Diff(idx, got); diff != "" {
+		t.Errorf("UnmarshalText() diff: %s", diff)
+	}
+
+	if s, ok := idx.Find(date(2025, time.May, 1)); !ok || s.Name != "2025q2" {
+		t.Errorf("Find(2025-05-01) = %v, %t, want 2025q2", s.Name, ok)
+	}
+	if _, ok := idx.Find(date(2026, time.February, 1)); ok {
+		t.Error("Find(2026-02-01): got shard, want none")
+	}
+	if s, ok := idx.Next("2025q2"); !ok || s.Name != "2025q3" {
+		t.Errorf("Next(2025q2) = %v, %t, want 2025q3", s.Name, ok)
+	}
+	if _, ok := idx.Next("2025q4"); ok {
+		t.Error("Next(2025q4): got shard, want none")
+	}
+}
+
+func TestUnmarshalShardIndexInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"2025 2025-01-01T00:00:00Z 2026-01-01T00:00:00Z example.com/log/2025",
+		"2025 2025-01-01T00:00:00Z example.com/log/2025\n",
+		"2025 2025-01-01 2026-01-01 example.com/log/2025\n",
+		"2025 2025-01-01T00:00:00Z 2026-01-01T00:00:00Z example.com/log/2025\n2025q4 2025-10-01T00:00:00Z 2026-01-01T00:00:00Z example.com/log/2025q4\n",
+	} {
+		var i api.ShardIndex
+		if err := i.UnmarshalText([]byte(raw)); err == nil {
+			t.Errorf("UnmarshalText(%q): got no error", raw)
+		}
+	}
+}
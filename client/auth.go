@@ -0,0 +1,186 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthFunc adds credentials to an HTTP request before it is sent, e.g. to a log
+// or distributor fronted by an authenticating proxy.
+type AuthFunc func(*http.Request) error
+
+// BearerTokenAuth returns an AuthFunc which authenticates requests with the
+// given bearer token.
+func BearerTokenAuth(token string) AuthFunc {
+	return func(r *http.Request) error {
+		r.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
+
+// BearerTokenFileAuth returns an AuthFunc which authenticates requests with the
+// bearer token held in the file at path. The file is read for every request,
+// so that tokens which are periodically refreshed, e.g. Kubernetes projected
+// service account tokens, are picked up.
+func BearerTokenFileAuth(path string) AuthFunc {
+	return func(r *http.Request) error {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read bearer token: %v", err)
+		}
+		r.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(b)))
+		return nil
+	}
+}
+
+// HeaderAuth returns an AuthFunc which sets the named header to value, e.g. an
+// API key expected by a gateway.
+func HeaderAuth(name, value string) AuthFunc {
+	return func(r *http.Request) error {
+		r.Header.Set(name, value)
+		return nil
+	}
+}
+
+// metadataIDTokenRefresh is how long before an ID token's expiry a new one is
+// fetched from the metadata server.
+const metadataIDTokenRefresh = 5 * time.Minute
+
+// MetadataIDTokenAuth returns an AuthFunc which authenticates requests with an
+// OIDC ID token for the given audience, fetched from the Google Cloud metadata
+// server for the default service account. This is the token expected by e.g.
+// Cloud Run services which require authentication, whose URL is the audience.
+//
+// Tokens are cached until shortly before they expire. The metadata server's
+// host may be overridden with the GCE_METADATA_HOST environment variable.
+func MetadataIDTokenAuth(audience string) AuthFunc {
+	m := &metadataIDToken{audience: audience}
+	return func(r *http.Request) error {
+		t, err := m.token(r.Context())
+		if err != nil {
+			return err
+		}
+		r.Header.Set("Authorization", "Bearer "+t)
+		return nil
+	}
+}
+
+// metadataIDToken caches an ID token fetched from the metadata server.
+type metadataIDToken struct {
+	audience string
+
+	mu     sync.Mutex
+	tok    string
+	expiry time.Time
+}
+
+func (m *metadataIDToken) token(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tok != "" && time.Until(m.expiry) > metadataIDTokenRefresh {
+		return m.tok, nil
+	}
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = "metadata.google.internal"
+	}
+	u := fmt.Sprintf("http://%s/computeMetadata/v1/instance/service-accounts/default/identity?audience=%s", host, url.QueryEscape(m.audience))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch ID token: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch ID token: %w", HTTPStatusError{StatusCode: resp.StatusCode})
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read ID token: %v", err)
+	}
+	tok := strings.TrimSpace(string(b))
+	expiry, err := jwtExpiry(tok)
+	if err != nil {
+		return "", fmt.Errorf("invalid ID token: %v", err)
+	}
+	m.tok, m.expiry = tok, expiry
+	return tok, nil
+}
+
+// jwtExpiry returns the expiry time of the JWT, without verifying it.
+func jwtExpiry(tok string) (time.Time, error) {
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("got %d JWT segments, want 3", len(parts))
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode claims: %v", err)
+	}
+	var claims struct {
+		Expiry int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse claims: %v", err)
+	}
+	return time.Unix(claims.Expiry, 0), nil
+}
+
+// AuthTransport returns an http.RoundTripper which applies each of the auth
+// functions, in order, to a copy of every request before passing it to rt, or
+// http.DefaultTransport if rt is nil.
+//
+// Use it to create an http.Client for HTTPFetcher which authenticates every
+// request made to a log.
+func AuthTransport(rt http.RoundTripper, auth ...AuthFunc) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return authTransport{rt: rt, auth: auth}
+}
+
+type authTransport struct {
+	rt   http.RoundTripper
+	auth []AuthFunc
+}
+
+func (t authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request they're given.
+	r = r.Clone(r.Context())
+	for _, a := range t.auth {
+		if err := a(r); err != nil {
+			if r.Body != nil {
+				_ = r.Body.Close()
+			}
+			return nil, err
+		}
+	}
+	return t.rt.RoundTrip(r)
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthTransport(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("banana\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc       string
+		auth       []AuthFunc
+		wantHeader http.Header
+		wantErr    bool
+	}{
+		{
+			desc:       "bearer token",
+			auth:       []AuthFunc{BearerTokenAuth("apple")},
+			wantHeader: http.Header{"Authorization": {"Bearer apple"}},
+		}, {
+			desc:       "bearer token file",
+			auth:       []AuthFunc{BearerTokenFileAuth(tokenFile)},
+			wantHeader: http.Header{"Authorization": {"Bearer banana"}},
+		}, {
+			desc:    "missing bearer token file",
+			auth:    []AuthFunc{BearerTokenFileAuth(filepath.Join(t.TempDir(), "missing"))},
+			wantErr: true,
+		}, {
+			desc:       "headers",
+			auth:       []AuthFunc{BearerTokenAuth("apple"), HeaderAuth("X-Api-Key", "cherry")},
+			wantHeader: http.Header{"Authorization": {"Bearer apple"}, "X-Api-Key": {"cherry"}},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var got http.Header
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header
+				_, _ = w.Write([]byte("ok"))
+			}))
+			defer s.Close()
+			root, err := url.Parse(s.URL + "/")
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			f := HTTPFetcher(root, &http.Client{Transport: AuthTransport(nil, test.auth...)})
+			_, err = f(context.Background(), "checkpoint")
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("got err %v, wantErr %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			for k := range test.wantHeader {
+				if g, w := got.Get(k), test.wantHeader.Get(k); g != w {
+					t.Errorf("got header %s %q, want %q", k, g, w)
+				}
+			}
+		})
+	}
+}
+
+func TestMetadataIDTokenAuth(t *testing.T) {
+	fetches := 0
+	// expiry is the lifetime of the tokens served by the metadata server.
+	expiry := time.Hour
+	md := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fetches++
+		claims := fmt.Sprintf(`{"aud":%q,"exp":%d}`, r.URL.Query().Get("audience"), time.Now().Add(expiry).Unix())
+		fmt.Fprintf(w, "header.%s.sig%d", base64.RawURLEncoding.EncodeToString([]byte(claims)), fetches)
+	}))
+	defer md.Close()
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(md.URL, "http://"))
+
+	auth := MetadataIDTokenAuth("https://log.example.com")
+	get := func() string {
+		t.Helper()
+		r, err := http.NewRequest(http.MethodGet, "https://log.example.com/checkpoint", nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		if err := auth(r); err != nil {
+			t.Fatalf("auth: %v", err)
+		}
+		return r.Header.Get("Authorization")
+	}
+
+	first := get()
+	if !strings.HasPrefix(first, "Bearer header.") {
+		t.Fatalf("got Authorization %q, want bearer ID token", first)
+	}
+	if got := get(); got != first || fetches != 1 {
+		t.Errorf("got Authorization %q after %d fetches, want cached token %q", got, fetches, first)
+	}
+
+	// Tokens close to expiry are replaced.
+	expiry = time.Minute
+	auth = MetadataIDTokenAuth("https://log.example.com")
+	get()
+	get()
+	if fetches != 3 {
+		t.Errorf("got %d fetches, want 3", fetches)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// AwaitInclusion waits for the leaf with the given leaf hash to be integrated
+// into the log tracked by lst, and returns its index along with an inclusion
+// proof which has been verified against lst's LatestConsistent checkpoint.
+//
+// The log is polled for the leaf's index and for new checkpoints, backing off
+// between polls according to the InitialBackoff, MaxBackoff, Multiplier and
+// Jitter fields of DefaultRetryOpts. lst is updated as the log grows, so must
+// not be used concurrently with this call.
+//
+// AwaitInclusion waits until the leaf is integrated or ctx is done, so callers
+// should use a context with a deadline to bound the wait. Errors other than the
+// leaf not yet being present, e.g. an inconsistent checkpoint, are returned
+// immediately.
+//
+// Locating the leaf requires the log to publish a leaf hash to index mapping,
+// so only logs using the serverless layout are supported.
+func AwaitInclusion(ctx context.Context, lst *LogStateTracker, leafHash []byte) (uint64, [][]byte, error) {
+	if _, ok := layoutOrDefault(lst.Layout).(ServerlessLayout); !ok {
+		return 0, nil, errors.New("AwaitInclusion is only supported for logs using the serverless layout")
+	}
+	o := DefaultRetryOpts
+	backoff := o.InitialBackoff
+	var idx uint64
+	var idxKnown bool
+	for {
+		if !idxKnown {
+			var err error
+			idx, err = LookupIndex(ctx, lst.Fetcher, leafHash)
+			switch {
+			case err == nil:
+				idxKnown = true
+			case !errors.Is(err, os.ErrNotExist):
+				return 0, nil, fmt.Errorf("failed to look up index of leaf %x: %w", leafHash, err)
+			}
+		}
+		if idxKnown && idx >= lst.State().Checkpoint.Size {
+			if _, _, _, err := lst.Update(ctx); err != nil {
+				return 0, nil, fmt.Errorf("failed to update log state: %w", err)
+			}
+		}
+		if idxKnown && idx < lst.State().Checkpoint.Size {
+			break
+		}
+
+		d := o.jitter(backoff)
+		klog.V(2).Infof("Leaf %x not yet integrated (index known: %t), checking again in %v", leafHash, idxKnown, d)
+		select {
+		case <-ctx.Done():
+			return 0, nil, fmt.Errorf("gave up waiting for inclusion of leaf %x: %w", leafHash, ctx.Err())
+		case <-time.After(d):
+		}
+		backoff = time.Duration(float64(backoff) * o.Multiplier)
+		if backoff > o.MaxBackoff {
+			backoff = o.MaxBackoff
+		}
+	}
+
+	p, err := verifiedInclusionProof(ctx, lst, lst.State(), idx, leafHash)
+	if err != nil {
+		return 0, nil, err
+	}
+	return idx, p, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestAwaitInclusion(t *testing.T) {
+	h := rfc6962.DefaultHasher
+	for _, test := range []struct {
+		desc     string
+		cpRaws   [][]byte
+		index    uint64
+		leafHash []byte
+		wantErr  error
+	}{
+		{
+			desc:   "already included",
+			cpRaws: [][]byte{testRawCheckpoints[5]},
+			index:  1,
+		}, {
+			desc:   "included after log grows",
+			cpRaws: [][]byte{testRawCheckpoints[2], testRawCheckpoints[5], testRawCheckpoints[9]},
+			index:  7,
+		}, {
+			desc:     "never sequenced",
+			cpRaws:   [][]byte{testRawCheckpoints[2]},
+			leafHash: []byte("banana"),
+			wantErr:  context.DeadlineExceeded,
+		}, {
+			desc:    "never integrated",
+			cpRaws:  [][]byte{testRawCheckpoints[2]},
+			index:   7,
+			wantErr: context.DeadlineExceeded,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			// Serve each checkpoint in turn, sticking on the last one.
+			shim := fetchCheckpointShim{Checkpoints: test.cpRaws}
+			f := func(ctx context.Context, p string) ([]byte, error) {
+				r, err := shim.Fetcher(testLogFetcher)(ctx, p)
+				if strings.HasSuffix(p, "checkpoint") && len(shim.Checkpoints) > 1 {
+					shim.Advance()
+				}
+				return r, err
+			}
+			lst, err := NewLogStateTracker(ctx, f, h, nil, testLogVerifier, testOrigin, UnilateralConsensus(f))
+			if err != nil {
+				t.Fatalf("NewLogStateTracker: %v", err)
+			}
+
+			lh := test.leafHash
+			if lh == nil {
+				leaf, err := GetLeaf(ctx, testLogFetcher, test.index)
+				if err != nil {
+					t.Fatalf("GetLeaf: %v", err)
+				}
+				lh = h.HashLeaf(leaf)
+			}
+			idx, p, err := AwaitInclusion(ctx, &lst, lh)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("AwaitInclusion: got err %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if idx != test.index {
+				t.Errorf("got index %d, want %d", idx, test.index)
+			}
+			if len(p) == 0 {
+				t.Error("got empty inclusion proof")
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+)
+
+// FetchBlob fetches the blob referenced by ref from the log's blobs/ area,
+// and verifies that it has the referenced contents.
+//
+// Logs which store blobs compressed must be accessed via a
+// DecompressingFetcher, and blobs larger than MaxDecompressedSize can then
+// not be fetched.
+func FetchBlob(ctx context.Context, f Fetcher, ref api.BlobRef) ([]byte, error) {
+	dir, file := layout.BlobPath("", ref.Hash)
+	blob, err := fetch(ctx, f, path.Join(dir, file))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("blob %x not found: %w", ref.Hash, err)
+		}
+		return nil, fmt.Errorf("failed to fetch blob %x: %w", ref.Hash, err)
+	}
+	if err := ref.Verify(blob); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProofMismatch, err)
+	}
+	return blob, nil
+}
+
+// ResolveLeaf returns the payload of a leaf fetched from the log: if the leaf
+// is a marshalled api.BlobRef, the referenced blob is fetched and verified
+// with FetchBlob, otherwise the leaf itself is returned.
+//
+// Note that the log commits to the leaf, so proofs of inclusion must be
+// verified against the leaf rather than the payload returned here.
+func ResolveLeaf(ctx context.Context, f Fetcher, leaf []byte) ([]byte, error) {
+	if !api.IsBlobRef(leaf) {
+		return leaf, nil
+	}
+	var ref api.BlobRef
+	if err := ref.UnmarshalText(leaf); err != nil {
+		return nil, fmt.Errorf("invalid blob reference: %v", err)
+	}
+	return FetchBlob(ctx, f, ref)
+}
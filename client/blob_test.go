@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+)
+
+func TestResolveLeaf(t *testing.T) {
+	ctx := context.Background()
+	blob := bytes.Repeat([]byte("blob"), 1024)
+	ref := api.NewBlobRef(blob)
+	refRaw, err := ref.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText: %v", err)
+	}
+	dir, file := layout.BlobPath("", ref.Hash)
+	blobPath := filepath.Join(dir, file)
+
+	for _, test := range []struct {
+		desc    string
+		leaf    []byte
+		stored  map[string][]byte
+		want    []byte
+		wantErr error
+	}{
+		{
+			desc: "plain leaf",
+			leaf: []byte("a leaf"),
+			want: []byte("a leaf"),
+		}, {
+			desc:   "blob",
+			leaf:   refRaw,
+			stored: map[string][]byte{blobPath: blob},
+			want:   blob,
+		}, {
+			desc:    "missing blob",
+			leaf:    refRaw,
+			wantErr: os.ErrNotExist,
+		}, {
+			desc:    "modified blob",
+			leaf:    refRaw,
+			stored:  map[string][]byte{blobPath: append([]byte("x"), blob[1:]...)},
+			wantErr: ErrProofMismatch,
+		}, {
+			desc:    "truncated blob",
+			leaf:    refRaw,
+			stored:  map[string][]byte{blobPath: blob[1:]},
+			wantErr: ErrProofMismatch,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			f := func(_ context.Context, p string) ([]byte, error) {
+				if b, ok := test.stored[p]; ok {
+					return b, nil
+				}
+				return nil, fmt.Errorf("%q: %w", p, os.ErrNotExist)
+			}
+			got, err := ResolveLeaf(ctx, f, test.leaf)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("ResolveLeaf: %v, want error %v", err, test.wantErr)
+			}
+			if !bytes.Equal(got, test.want) {
+				t.Errorf("ResolveLeaf: got %d bytes, want %d", len(got), len(test.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+)
+
+// SizeBounds describes sanity limits on the checkpoints a LogStateTracker will
+// accept, so that a compromised or buggy log which presents absurd checkpoints
+// causes a clean failure rather than e.g. an attempt to fetch an enormous
+// number of tiles.
+//
+// Zero valued fields impose no limit.
+type SizeBounds struct {
+	// MaxSize is the largest tree size which will be accepted.
+	MaxSize uint64
+	// MaxGrowth is the largest number of leaves by which the tree may grow
+	// in a single update.
+	MaxGrowth uint64
+	// RejectRollback causes checkpoints smaller than the tracker's current
+	// checkpoint to be rejected, rather than silently ignored.
+	RejectRollback bool
+}
+
+// ErrSizeLimit is returned when a log presents a checkpoint larger than
+// permitted by SizeBounds.MaxSize.
+type ErrSizeLimit struct {
+	Size  uint64
+	Limit uint64
+}
+
+func (e ErrSizeLimit) Error() string {
+	return fmt.Sprintf("checkpoint size %d exceeds maximum of %d", e.Size, e.Limit)
+}
+
+// ErrGrowthLimit is returned when a log presents a checkpoint which has grown
+// by more than permitted by SizeBounds.MaxGrowth.
+type ErrGrowthLimit struct {
+	From  uint64
+	To    uint64
+	Limit uint64
+}
+
+func (e ErrGrowthLimit) Error() string {
+	return fmt.Sprintf("log grew by %d leaves from size %d to %d, maximum growth is %d", e.To-e.From, e.From, e.To, e.Limit)
+}
+
+// ErrSizeRollback is returned when a log presents a checkpoint which is smaller
+// than a previously verified one, and SizeBounds.RejectRollback is set.
+type ErrSizeRollback struct {
+	From uint64
+	To   uint64
+}
+
+func (e ErrSizeRollback) Error() string {
+	return fmt.Sprintf("log size went backwards from %d to %d", e.From, e.To)
+}
+
+// Check returns an error if a tracker which has verified a checkpoint of size
+// from should not accept a checkpoint of size to.
+//
+// The growth limit is not applied when from is zero, i.e. when nothing about
+// the log is yet known.
+func (b SizeBounds) Check(from, to uint64) error {
+	switch {
+	case b.MaxSize > 0 && to > b.MaxSize:
+		return ErrSizeLimit{Size: to, Limit: b.MaxSize}
+	case b.RejectRollback && to < from:
+		return ErrSizeRollback{From: from, To: to}
+	case b.MaxGrowth > 0 && from > 0 && to > from && to-from > b.MaxGrowth:
+		return ErrGrowthLimit{From: from, To: to, Limit: b.MaxGrowth}
+	}
+	return nil
+}
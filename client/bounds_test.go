@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestSizeBoundsCheck(t *testing.T) {
+	b := SizeBounds{MaxSize: 100, MaxGrowth: 10, RejectRollback: true}
+	for _, test := range []struct {
+		desc     string
+		from, to uint64
+		wantErr  error
+	}{
+		{desc: "within bounds", from: 5, to: 15},
+		{desc: "unchanged", from: 5, to: 5},
+		{desc: "first checkpoint ignores growth", from: 0, to: 90},
+		{desc: "too large", from: 95, to: 101, wantErr: ErrSizeLimit{Size: 101, Limit: 100}},
+		{desc: "grew too much", from: 5, to: 16, wantErr: ErrGrowthLimit{From: 5, To: 16, Limit: 10}},
+		{desc: "rollback", from: 5, to: 4, wantErr: ErrSizeRollback{From: 5, To: 4}},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if err := b.Check(test.from, test.to); err != test.wantErr {
+				t.Errorf("Check(%d, %d): got err %v, want %v", test.from, test.to, err, test.wantErr)
+			}
+		})
+	}
+	if err := (SizeBounds{}).Check(100, 1); err != nil {
+		t.Errorf("zero SizeBounds: got err %v", err)
+	}
+}
+
+func TestTrackerBounds(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	for _, test := range []struct {
+		desc    string
+		bounds  SizeBounds
+		cpRaws  [][]byte
+		wantErr error
+	}{
+		{
+			desc:   "within bounds",
+			bounds: SizeBounds{MaxSize: 10, MaxGrowth: 5, RejectRollback: true},
+			cpRaws: [][]byte{testRawCheckpoints[3], testRawCheckpoints[8]},
+		}, {
+			desc:    "too large",
+			bounds:  SizeBounds{MaxSize: 10},
+			cpRaws:  [][]byte{testRawCheckpoints[3], testRawCheckpoints[11]},
+			wantErr: ErrSizeLimit{},
+		}, {
+			desc:    "grew too much",
+			bounds:  SizeBounds{MaxGrowth: 4},
+			cpRaws:  [][]byte{testRawCheckpoints[3], testRawCheckpoints[8]},
+			wantErr: ErrGrowthLimit{},
+		}, {
+			desc:    "rollback",
+			bounds:  SizeBounds{RejectRollback: true},
+			cpRaws:  [][]byte{testRawCheckpoints[8], testRawCheckpoints[3]},
+			wantErr: ErrSizeRollback{},
+		}, {
+			desc:   "rollback ignored",
+			cpRaws: [][]byte{testRawCheckpoints[8], testRawCheckpoints[3]},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			shim := fetchCheckpointShim{Checkpoints: test.cpRaws}
+			f := shim.Fetcher(testLogFetcher)
+			lst, err := NewLogStateTracker(ctx, f, h, nil, testLogVerifier, testOrigin, UnilateralConsensus(f))
+			if err != nil {
+				t.Fatalf("NewLogStateTracker: %v", err)
+			}
+			lst.Bounds = &test.bounds
+			shim.Advance()
+			_, _, _, err = lst.Update(ctx)
+			switch want := test.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("Update: %v", err)
+				}
+			case ErrSizeLimit:
+				if !errors.As(err, &want) {
+					t.Fatalf("Update: got err %v, want %T", err, want)
+				}
+			case ErrGrowthLimit:
+				if !errors.As(err, &want) {
+					t.Fatalf("Update: got err %v, want %T", err, want)
+				}
+			case ErrSizeRollback:
+				if !errors.As(err, &want) {
+					t.Fatalf("Update: got err %v, want %T", err, want)
+				}
+			}
+		})
+	}
+}
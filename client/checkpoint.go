@@ -0,0 +1,69 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/transparency-dev/formats/log"
+)
+
+// CheckpointBody is the structured form of the body of a checkpoint note.
+type CheckpointBody struct {
+	log.Checkpoint
+	// Extensions holds any lines following the root hash, in order, without
+	// their trailing newlines. Their meaning is specific to each log deployment.
+	Extensions []string
+}
+
+// ParseCheckpointBody parses the body of a checkpoint, returning its origin,
+// size, root hash and any extension lines.
+//
+// b may be either the note text alone, or a complete signed note, in which case
+// the signatures are ignored. No signatures are verified, so callers must only
+// trust the returned values if b has been verified by other means.
+func ParseCheckpointBody(b []byte) (*CheckpointBody, error) {
+	text, _, _ := strings.Cut(string(b), "\n\n")
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	ret := &CheckpointBody{}
+	rest, err := ret.Checkpoint.Unmarshal([]byte(text))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedCheckpoint, err)
+	}
+	if len(rest) == 0 {
+		return ret, nil
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(string(rest), "\n"), "\n") {
+		if l == "" {
+			return nil, fmt.Errorf("%w: empty extension line", ErrMalformedCheckpoint)
+		}
+		ret.Extensions = append(ret.Extensions, l)
+	}
+	return ret, nil
+}
+
+// Extension returns the remainder of the first extension line which starts
+// with prefix, and whether such a line was found.
+func (b CheckpointBody) Extension(prefix string) (string, bool) {
+	for _, l := range b.Extensions {
+		if v, ok := strings.CutPrefix(l, prefix); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
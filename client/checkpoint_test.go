@@ -0,0 +1,91 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestParseCheckpointBody(t *testing.T) {
+	hash := []byte("0123456789abcdef0123456789abcdef")
+	body := fmt.Sprintf("example.com/log\n42\n%s\n", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	logS, _ := genKeyPair(t, "log")
+	signed, err := note.Sign(&note.Note{Text: body + "timestamp 1700000000\nshard 2024h1\n"}, logS)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc    string
+		b       []byte
+		wantExt []string
+		wantErr bool
+	}{
+		{
+			desc: "no extensions",
+			b:    []byte(body),
+		}, {
+			desc:    "extensions",
+			b:       []byte(body + "timestamp 1700000000\nshard 2024h1\n"),
+			wantExt: []string{"timestamp 1700000000", "shard 2024h1"},
+		}, {
+			desc:    "signed note",
+			b:       signed,
+			wantExt: []string{"timestamp 1700000000", "shard 2024h1"},
+		}, {
+			desc:    "bad size",
+			b:       []byte("example.com/log\nbanana\nMDEy\n"),
+			wantErr: true,
+		}, {
+			desc:    "missing hash",
+			b:       []byte("example.com/log\n42\n"),
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := ParseCheckpointBody(test.b)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseCheckpointBody: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrMalformedCheckpoint) {
+					t.Errorf("got err %v, want %v", err, ErrMalformedCheckpoint)
+				}
+				return
+			}
+			if got.Origin != "example.com/log" || got.Size != 42 || !bytes.Equal(got.Hash, hash) {
+				t.Errorf("got checkpoint %+v", got.Checkpoint)
+			}
+			if fmt.Sprint(got.Extensions) != fmt.Sprint(test.wantExt) {
+				t.Errorf("got extensions %q, want %q", got.Extensions, test.wantExt)
+			}
+		})
+	}
+}
+
+func TestCheckpointBodyExtension(t *testing.T) {
+	b := CheckpointBody{Extensions: []string{"shard 2024h1", "timestamp 1", "timestamp 2"}}
+	if v, ok := b.Extension("timestamp "); !ok || v != "1" {
+		t.Errorf("Extension(timestamp): got %q, %t, want \"1\", true", v, ok)
+	}
+	if _, ok := b.Extension("banana"); ok {
+		t.Error("Extension(banana): got ok")
+	}
+}
@@ -16,6 +16,9 @@
 // log.
 //
 // See the /cmd/client package in this repo for an example of using this.
+//
+// The package also builds for js/wasm, so logs may be verified from within web
+// browsers, e.g. using HTTPFetcher to read from static log hosting.
 package client
 
 import (
@@ -24,9 +27,11 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
+	"path"
 	"sort"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/transparency-dev/formats/log"
 	"github.com/transparency-dev/merkle"
@@ -35,6 +40,7 @@ import (
 	"github.com/transparency-dev/serverless-log/api"
 	"github.com/transparency-dev/serverless-log/api/layout"
 	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/sync/errgroup"
 )
 
 // Fetcher is the signature of a function which can retrieve arbitrary files from
@@ -62,13 +68,36 @@ func UnilateralConsensus(f Fetcher) ConsensusCheckpointFunc {
 // FetchCheckpoint retrieves and opens a checkpoint from the log.
 // Returns both the parsed structure and the raw serialised checkpoint.
 func FetchCheckpoint(ctx context.Context, f Fetcher, v note.Verifier, origin string) (*log.Checkpoint, []byte, *note.Note, error) {
-	cpRaw, err := f(ctx, layout.CheckpointPath)
+	cpRaw, err := fetch(ctx, f, layout.CheckpointPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cp, _, n, err := parseCheckpoint(layout.CheckpointPath, cpRaw, origin, v)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse Checkpoint: %w", err)
+	}
+	return cp, cpRaw, n, nil
+}
+
+// FetchArchivedCheckpoint retrieves and opens the checkpoint for a tree of the
+// given size from the log's checkpoint archive, allowing historical
+// checkpoints to be checked for consistency with later ones.
+// Returns both the parsed structure and the raw serialised checkpoint.
+//
+// Only logs using the serverless layout archive their checkpoints, and
+// not every tree size will have been published in a checkpoint.
+func FetchArchivedCheckpoint(ctx context.Context, f Fetcher, v note.Verifier, origin string, size uint64) (*log.Checkpoint, []byte, *note.Note, error) {
+	p := path.Join(layout.CheckpointArchivePath("", size))
+	cpRaw, err := fetch(ctx, f, p)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	cp, _, n, err := log.ParseCheckpoint(cpRaw, origin, v)
+	cp, _, n, err := parseCheckpoint(p, cpRaw, origin, v)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to parse Checkpoint: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to parse Checkpoint: %w", err)
+	}
+	if cp.Size != size {
+		return nil, nil, nil, fmt.Errorf("%s: %w: got size %d", p, ErrMalformedCheckpoint, cp.Size)
 	}
 	return cp, cpRaw, n, nil
 }
@@ -76,21 +105,83 @@ func FetchCheckpoint(ctx context.Context, f Fetcher, v note.Verifier, origin str
 // ProofBuilder knows how to build inclusion and consistency proofs from tiles.
 // Since the tiles commit only to immutable nodes, the job of building proofs is slightly
 // more complex as proofs can touch "ephemeral" nodes, so these need to be synthesized.
+//
+// A ProofBuilder is safe for concurrent use, though proofs are built one at a time.
 type ProofBuilder struct {
-	cp        log.Checkpoint
-	nodeCache nodeCache
-	h         compact.HashFn
+	cp log.Checkpoint
+	// mu guards nodeCache, which is not itself safe for concurrent use.
+	mu          sync.Mutex
+	nodeCache   nodeCache
+	h           compact.HashFn
+	rf          *compact.RangeFactory
+	metrics     Metrics
+	rateLimiter RateLimiter
+	layout      Layout
+	tileCache   *TileCache
+	concurrency int
+	maxTiles    int
+	timeout     time.Duration
+}
+
+// DefaultProofFetchConcurrency is the maximum number of tiles which will be
+// fetched in parallel while building a single proof, unless overridden with
+// WithFetchConcurrency.
+const DefaultProofFetchConcurrency = 8
+
+// ProofBuilderOption is used to configure optional behaviour of a ProofBuilder.
+type ProofBuilderOption func(*ProofBuilder)
+
+// WithMetrics causes the ProofBuilder to report fetches and proof construction to m.
+func WithMetrics(m Metrics) ProofBuilderOption {
+	return func(pb *ProofBuilder) {
+		pb.metrics = m
+	}
+}
+
+// WithLayout causes the ProofBuilder to read tiles from a log stored using l,
+// rather than the default serverless layout.
+func WithLayout(l Layout) ProofBuilderOption {
+	return func(pb *ProofBuilder) {
+		pb.layout = l
+	}
+}
+
+// WithFetchConcurrency sets the maximum number of tiles the ProofBuilder will
+// fetch in parallel while building a single proof.
+// Values <= 0 select DefaultProofFetchConcurrency.
+func WithFetchConcurrency(n int) ProofBuilderOption {
+	return func(pb *ProofBuilder) {
+		pb.concurrency = n
+	}
+}
+
+// WithMaxCachedTiles limits the number of tiles the ProofBuilder retains between
+// proofs to n, evicting the oldest tiles once the limit is reached.
+// By default, all tiles fetched by the ProofBuilder are retained for its lifetime.
+func WithMaxCachedTiles(n int) ProofBuilderOption {
+	return func(pb *ProofBuilder) {
+		pb.maxTiles = n
+	}
 }
 
 // NewProofBuilder creates a new ProofBuilder object for a given tree size.
-// The returned ProofBuilder can be re-used for proofs related to a given tree size, but
-// it is not thread-safe and should not be accessed concurrently.
-func NewProofBuilder(ctx context.Context, cp log.Checkpoint, h compact.HashFn, f Fetcher) (*ProofBuilder, error) {
-	tf := newTileFetcher(f, cp.Size)
+// The returned ProofBuilder can be re-used for proofs related to a given tree size.
+func NewProofBuilder(ctx context.Context, cp log.Checkpoint, h compact.HashFn, f Fetcher, opts ...ProofBuilderOption) (*ProofBuilder, error) {
 	pb := &ProofBuilder{
-		cp:        cp,
-		nodeCache: newNodeCache(tf, cp.Size),
-		h:         h,
+		cp: cp,
+		h:  h,
+		rf: &compact.RangeFactory{Hash: h},
+	}
+	for _, o := range opts {
+		o(pb)
+	}
+	tf := layoutOrDefault(pb.layout).TileFetcher(MetricsFetcher(RateLimitedFetcher(TimeoutFetcher(f, pb.timeout), pb.rateLimiter), pb.metrics), h, cp.Size)
+	tf = pb.tileCache.wrap(tf, cp.Size)
+	pb.nodeCache = newNodeCache(tf, cp.Size)
+	pb.nodeCache.maxTiles = pb.maxTiles
+	pb.metrics = metricsOrNop(pb.metrics)
+	if pb.concurrency <= 0 {
+		pb.concurrency = DefaultProofFetchConcurrency
 	}
 	// Can't re-create the root of a zero size checkpoint other than by convention,
 	// so return early here in that case.
@@ -98,12 +189,12 @@ func NewProofBuilder(ctx context.Context, cp log.Checkpoint, h compact.HashFn, f
 		return pb, nil
 	}
 
-	hashes, err := FetchRangeNodes(ctx, cp.Size, tf)
+	hashes, err := fetchRangeNodes(ctx, cp.Size, tf, pb.concurrency)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch range nodes: %w", err)
 	}
 	// Create a compact range which represents the state of the log.
-	r, err := (&compact.RangeFactory{Hash: h}).NewRange(0, cp.Size, hashes)
+	r, err := pb.rf.NewRange(0, cp.Size, hashes)
 	if err != nil {
 		return nil, err
 	}
@@ -117,7 +208,7 @@ func NewProofBuilder(ctx context.Context, cp log.Checkpoint, h compact.HashFn, f
 		return nil, err
 	}
 	if !bytes.Equal(cp.Hash, sr) {
-		return nil, fmt.Errorf("invalid checkpoint hash %x, expected %x", cp.Hash, sr)
+		return nil, fmt.Errorf("%w: invalid checkpoint hash %x, expected %x", ErrProofMismatch, cp.Hash, sr)
 	}
 	return pb, nil
 }
@@ -126,7 +217,8 @@ func NewProofBuilder(ctx context.Context, cp log.Checkpoint, h compact.HashFn, f
 // the given size.
 // This function uses the passed-in function to retrieve tiles containing any log tree
 // nodes necessary to build the proof.
-func (pb *ProofBuilder) InclusionProof(ctx context.Context, index uint64) ([][]byte, error) {
+func (pb *ProofBuilder) InclusionProof(ctx context.Context, index uint64) (p [][]byte, err error) {
+	defer func(start time.Time) { pb.metrics.ProofBuilt(InclusionProof, time.Since(start), err) }(time.Now())
 	nodes, err := proof.Inclusion(index, pb.cp.Size)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate inclusion proof node list: %w", err)
@@ -134,10 +226,48 @@ func (pb *ProofBuilder) InclusionProof(ctx context.Context, index uint64) ([][]b
 	return pb.fetchNodes(ctx, nodes)
 }
 
+// InclusionProofs constructs inclusion proofs for the leaves at each of the
+// given indices in the tree, returned in the same order as indices.
+//
+// The tiles needed by all of the proofs are fetched up front, each only once,
+// so proving many leaves from the same region of the tree requires far fewer
+// fetches than calling InclusionProof for each leaf. If WithMaxCachedTiles is
+// used, the limit should allow for all of the tiles needed by a batch, or some
+// tiles may be fetched more than once.
+func (pb *ProofBuilder) InclusionProofs(ctx context.Context, indices []uint64) (ps [][][]byte, err error) {
+	defer func(start time.Time) { pb.metrics.ProofBuilt(InclusionProof, time.Since(start), err) }(time.Now())
+	nodes := make([]proof.Nodes, len(indices))
+	var ids []compact.NodeID
+	for i, index := range indices {
+		n, err := proof.Inclusion(index, pb.cp.Size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate inclusion proof node list for leaf %d: %w", index, err)
+		}
+		nodes[i] = n
+		ids = append(ids, n.IDs...)
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if err := pb.nodeCache.prefetch(ctx, ids, pb.concurrency); err != nil {
+		return nil, err
+	}
+	ps = make([][][]byte, len(indices))
+	for i, n := range nodes {
+		p, err := pb.getNodes(ctx, n)
+		if err != nil {
+			return nil, fmt.Errorf("leaf %d: %w", indices[i], err)
+		}
+		ps[i] = p
+	}
+	return ps, nil
+}
+
 // ConsistencyProof constructs a consistency proof between the two passed in tree sizes.
 // This function uses the passed-in function to retrieve tiles containing any log tree
 // nodes necessary to build the proof.
-func (pb *ProofBuilder) ConsistencyProof(ctx context.Context, smaller, larger uint64) ([][]byte, error) {
+func (pb *ProofBuilder) ConsistencyProof(ctx context.Context, smaller, larger uint64) (p [][]byte, err error) {
+	defer func(start time.Time) { pb.metrics.ProofBuilt(ConsistencyProof, time.Since(start), err) }(time.Now())
 	nodes, err := proof.Consistency(smaller, larger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate consistency proof node list: %w", err)
@@ -147,8 +277,20 @@ func (pb *ProofBuilder) ConsistencyProof(ctx context.Context, smaller, larger ui
 
 // fetchNodes retrieves the specified proof nodes via pb's nodeCache.
 func (pb *ProofBuilder) fetchNodes(ctx context.Context, nodes proof.Nodes) ([][]byte, error) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	// The tiles holding the nodes are independent of one another, so fetch them
+	// in parallel up front, leaving the nodeCache to serve them from memory below.
+	if err := pb.nodeCache.prefetch(ctx, nodes.IDs, pb.concurrency); err != nil {
+		return nil, err
+	}
+	return pb.getNodes(ctx, nodes)
+}
+
+// getNodes retrieves the specified proof nodes from pb's nodeCache, fetching
+// any tiles which are not already cached. pb.mu must be held.
+func (pb *ProofBuilder) getNodes(ctx context.Context, nodes proof.Nodes) ([][]byte, error) {
 	hashes := make([][]byte, 0)
-	// TODO(al) parallelise this.
 	for _, id := range nodes.IDs {
 		h, err := pb.nodeCache.GetNode(ctx, id)
 		if err != nil {
@@ -166,17 +308,12 @@ func (pb *ProofBuilder) fetchNodes(ctx context.Context, nodes proof.Nodes) ([][]
 // FetchRangeNodes returns the set of nodes representing the compact range covering
 // a log of size s.
 func FetchRangeNodes(ctx context.Context, s uint64, gt GetTileFunc) ([][]byte, error) {
-	nc := newNodeCache(gt, s)
-	nIDs := compact.RangeNodes(0, s, nil)
-	ret := make([][]byte, len(nIDs))
-	for i, n := range nIDs {
-		h, err := nc.GetNode(ctx, n)
-		if err != nil {
-			return nil, err
-		}
-		ret[i] = h
-	}
-	return ret, nil
+	return fetchRangeNodes(ctx, s, gt, DefaultProofFetchConcurrency)
+}
+
+// fetchRangeNodes implements FetchRangeNodes, fetching up to concurrency tiles in parallel.
+func fetchRangeNodes(ctx context.Context, s uint64, gt GetTileFunc, concurrency int) ([][]byte, error) {
+	return NewNodeFetcher(gt, s, concurrency).RangeNodes(ctx, 0, s)
 }
 
 // FetchLeafHashes fetches N consecutive leaf hashes starting with the leaf at index first.
@@ -203,6 +340,11 @@ type nodeCache struct {
 	ephemeral map[compact.NodeID][]byte
 	tiles     map[tileKey]api.Tile
 	getTile   GetTileFunc
+	// maxTiles, if > 0, limits the number of tiles held in tiles.
+	maxTiles int
+	// order holds the keys of tiles in the order they were added, and is only
+	// maintained if maxTiles is set.
+	order []tileKey
 }
 
 // GetTileFunc is the signature of a function which knows how to fetch a
@@ -230,6 +372,65 @@ func (n *nodeCache) SetEphemeralNode(id compact.NodeID, h []byte) {
 	n.ephemeral[id] = h
 }
 
+// prefetch fetches, in parallel, any tiles containing the specified nodes which
+// aren't already cached, making at most concurrency requests at a time.
+func (n *nodeCache) prefetch(ctx context.Context, ids []compact.NodeID, concurrency int) error {
+	keys := make([]tileKey, 0, len(ids))
+	seen := make(map[tileKey]bool)
+	for _, id := range ids {
+		if e := n.ephemeral[id]; len(e) != 0 {
+			continue
+		}
+		tileLevel, tileIndex, _, _ := layout.NodeCoordsToTileAddress(uint64(id.Level), uint64(id.Index))
+		k := tileKey{tileLevel, tileIndex}
+		if _, ok := n.tiles[k]; ok || seen[k] {
+			continue
+		}
+		seen[k] = true
+		keys = append(keys, k)
+	}
+	if len(keys) < 2 {
+		// Nothing to be gained, GetNode will fetch any missing tile.
+		return nil
+	}
+
+	tiles := make([]*api.Tile, len(keys))
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(concurrency)
+	for i, k := range keys {
+		i, k := i, k
+		eg.Go(func() error {
+			t, err := n.getTile(ctx, k.tileLevel, k.tileIndex)
+			if err != nil {
+				return fmt.Errorf("failed to fetch tile: %w", err)
+			}
+			tiles[i] = t
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	for i, k := range keys {
+		n.putTile(k, *tiles[i])
+	}
+	return nil
+}
+
+// putTile adds the tile t to the cache, evicting the oldest tiles if the cache
+// would otherwise hold more than maxTiles tiles.
+func (n *nodeCache) putTile(k tileKey, t api.Tile) {
+	n.tiles[k] = t
+	if n.maxTiles <= 0 {
+		return
+	}
+	n.order = append(n.order, k)
+	for len(n.order) > n.maxTiles {
+		delete(n.tiles, n.order[0])
+		n.order = n.order[1:]
+	}
+}
+
 // GetNode returns the internal log tree node hash for the specified node ID.
 // A previously set ephemeral node will be returned if id matches, otherwise
 // the tile containing the requested node will be fetched and cached, and the
@@ -249,7 +450,7 @@ func (n *nodeCache) GetNode(ctx context.Context, id compact.NodeID) ([]byte, err
 			return nil, fmt.Errorf("failed to fetch tile: %w", err)
 		}
 		t = *tile
-		n.tiles[tKey] = *tile
+		n.putTile(tKey, t)
 	}
 	nodeKey := int(api.TileNodeKey(nodeLevel, nodeIndex))
 	if l := len(t.Nodes); nodeKey >= l {
@@ -266,18 +467,18 @@ func (n *nodeCache) GetNode(ctx context.Context, id compact.NodeID) ([]byte, err
 func newTileFetcher(f Fetcher, logSize uint64) GetTileFunc {
 	return func(ctx context.Context, level, index uint64) (*api.Tile, error) {
 		tileSize := layout.PartialTileSize(level, index, logSize)
-		p := filepath.Join(layout.TilePath("", level, index, tileSize))
-		t, err := f(ctx, p)
+		p := path.Join(layout.TilePath("", level, index, tileSize))
+		t, err := fetch(ctx, f, p)
 		if err != nil {
 			if !errors.Is(err, os.ErrNotExist) {
-				return nil, fmt.Errorf("failed to read tile at %q: %w", p, err)
+				return nil, fmt.Errorf("failed to read tile: %w", err)
 			}
 			return nil, err
 		}
 
 		var tile api.Tile
 		if err := tile.UnmarshalText(t); err != nil {
-			return nil, fmt.Errorf("failed to parse tile: %w", err)
+			return nil, fmt.Errorf("failed to parse tile at %q: %w", p, err)
 		}
 		return &tile, nil
 	}
@@ -285,23 +486,40 @@ func newTileFetcher(f Fetcher, logSize uint64) GetTileFunc {
 
 // LookupIndex fetches the leafhash->seq mapping file from the log, and returns
 // its parsed contents.
+//
+// An error wrapping os.ErrNotExist is returned if the leaf hash is unknown to
+// the log. Note that the mapping may be published before the leaf has been
+// integrated, see LookupVerifiedIndex.
 func LookupIndex(ctx context.Context, f Fetcher, lh []byte) (uint64, error) {
-	p := filepath.Join(layout.LeafPath("", lh))
-	sRaw, err := f(ctx, p)
+	if len(lh) < 4 {
+		return 0, fmt.Errorf("invalid leafhash %x: too short", lh)
+	}
+	p := path.Join(layout.LeafPath("", lh))
+	sRaw, err := fetch(ctx, f, p)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return 0, fmt.Errorf("leafhash unknown: %w", err)
 		}
 		return 0, fmt.Errorf("failed to fetch leafhash->seq file: %w", err)
 	}
-	return strconv.ParseUint(string(sRaw), 16, 64)
+	idx, err := strconv.ParseUint(string(sRaw), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid leafhash->seq file %q: %w", p, err)
+	}
+	return idx, nil
 }
 
 // GetLeaf fetches the raw contents committed to at a given leaf index.
+//
+// If the leaf's data has been pruned from the log, an error wrapping
+// ErrLeafPruned is returned.
 func GetLeaf(ctx context.Context, f Fetcher, i uint64) ([]byte, error) {
-	p := filepath.Join(layout.SeqPath("", i))
-	sRaw, err := f(ctx, p)
+	p := path.Join(layout.SeqPath("", i))
+	sRaw, err := fetch(ctx, f, p)
 	if err != nil {
+		if err := checkPruned(ctx, f, i, err); errors.Is(err, ErrLeafPruned) {
+			return nil, err
+		}
 		if errors.Is(err, os.ErrNotExist) {
 			return nil, fmt.Errorf("leaf index %d not found: %w", i, err)
 		}
@@ -313,6 +531,12 @@ func GetLeaf(ctx context.Context, f Fetcher, i uint64) ([]byte, error) {
 // LogStateTracker represents a client-side view of a target log's state.
 // This tracker handles verification that updates to the tracked log state are
 // consistent with previously seen states.
+//
+// Trackers created by the NewLogStateTracker family of functions may be updated
+// and read concurrently, provided that readers use State rather than accessing
+// the LatestConsistent fields directly; concurrent calls to Update are
+// serialised. The configuration fields must not be changed once the tracker is
+// in use.
 type LogStateTracker struct {
 	Hasher  merkle.LogHasher
 	Fetcher Fetcher
@@ -331,12 +555,147 @@ type LogStateTracker struct {
 	ProofBuilder *ProofBuilder
 
 	CpSigVerifier note.Verifier
+	// LogVerifiers, if set, is used in place of CpSigVerifier to verify
+	// checkpoints from a log whose signing key may be rotated.
+	LogVerifiers *LogVerifiers
+
+	// Metrics, if set, will be informed of the fetches and proofs made by the
+	// tracker. Each call to ConsensusCheckpoint is reported as a single fetch
+	// of the checkpoint. Use WithTrackerMetrics to have the fetches made by the
+	// tracker's constructor reported too.
+	Metrics Metrics
+	// RateLimiter, if set, throttles the fetches made by the tracker when building proofs.
+	RateLimiter RateLimiter
+	// Layout, if set, describes how the log's tiles and leaves are stored.
+	// The serverless layout is used if unset.
+	Layout Layout
+	// TileCache, if set, is shared by all proof builders created by the tracker.
+	TileCache *TileCache
+	// MaxCachedTiles, if > 0, limits the number of tiles retained by the
+	// tracker's ProofBuilder between proofs, bounding the tracker's memory use.
+	MaxCachedTiles int
+	// FetchTimeout, if > 0, bounds each request made when building proofs, so
+	// that a single hung request cannot stall an update indefinitely.
+	// Checkpoints are fetched by ConsensusCheckpoint, whose Fetcher may be
+	// wrapped with TimeoutMiddleware for the same effect.
+	FetchTimeout time.Duration
+
+	// CheckpointStore, if set, is used to persist the LatestConsistentRaw
+	// checkpoint whenever the tracker moves to a new checkpoint.
+	CheckpointStore CheckpointStore
+
+	// Hooks are invoked, in order, at the end of every call to Update.
+	Hooks []UpdateHooks
+
+	// History, if set, is used to retain every checkpoint verified by the
+	// tracker. Update will return an ErrEquivocation if the log presents a
+	// checkpoint whose root hash differs from that of a previously verified
+	// checkpoint of the same size, or an ErrRollback if it presents a
+	// checkpoint smaller than the tracker's current checkpoint.
+	History CheckpointHistory
+
+	// Freshness, if set, causes Update to reject checkpoints which are older
+	// than permitted by the policy with an error wrapping ErrStaleCheckpoint.
+	Freshness *FreshnessPolicy
+
+	// Bounds, if set, causes Update to reject checkpoints whose size, or growth
+	// since the last verified checkpoint, is outside of the configured limits.
+	Bounds *SizeBounds
+
+	// mu is shared by copies of the tracker, so that a tracker returned by
+	// value from a constructor is protected wherever it ends up.
+	mu *trackerLocks
+}
+
+// trackerLocks holds the locks used to make a LogStateTracker safe for
+// concurrent use.
+type trackerLocks struct {
+	// update serialises calls to Update.
+	update sync.Mutex
+	// state guards the LatestConsistent fields, along with CheckpointNote and
+	// ProofBuilder, which are only written while update is held.
+	state sync.RWMutex
+}
+
+// locks returns the tracker's locks, or an unshared set if the tracker was not
+// created by a constructor, in which case it is not safe for concurrent use.
+func (lst *LogStateTracker) locks() *trackerLocks {
+	if lst.mu == nil {
+		return &trackerLocks{}
+	}
+	return lst.mu
+}
+
+// TrackerState is an immutable snapshot of the latest proven-consistent
+// checkpoint held by a LogStateTracker.
+type TrackerState struct {
+	// Raw holds the raw bytes of the checkpoint.
+	Raw []byte
+	// Checkpoint is the deserialised form of Raw.
+	Checkpoint log.Checkpoint
+	// Note holds the signatures and other metadata about the checkpoint, and
+	// must not be modified.
+	Note *note.Note
+	// ProofBuilder builds proofs at Checkpoint, and may be nil if the tracker
+	// has not yet seen a checkpoint.
+	ProofBuilder *ProofBuilder
+}
+
+// State returns a snapshot of the tracker's latest proven-consistent
+// checkpoint. It is safe to call concurrently with Update, and the returned
+// value is unaffected by subsequent updates.
+func (lst *LogStateTracker) State() TrackerState {
+	mu := lst.locks()
+	mu.state.RLock()
+	defer mu.state.RUnlock()
+	cp := lst.LatestConsistent
+	cp.Hash = bytes.Clone(cp.Hash)
+	return TrackerState{
+		Raw:          bytes.Clone(lst.LatestConsistentRaw),
+		Checkpoint:   cp,
+		Note:         lst.CheckpointNote,
+		ProofBuilder: lst.ProofBuilder,
+	}
+}
+
+// UpdateHooks holds optional callbacks which are invoked by LogStateTracker.Update.
+type UpdateHooks struct {
+	// OnSuccess is called after every successful update with the previous and
+	// current raw checkpoints, along with the consistency proof between them.
+	// oldRaw and newRaw will be identical if the log has not grown.
+	OnSuccess func(oldRaw []byte, newRaw []byte, proof [][]byte)
+	// OnFailure is called with the error returned by a failed update.
+	OnFailure func(err error)
+}
+
+// TrackerOption is used to configure optional behaviour of a LogStateTracker
+// created by the NewLogStateTracker family of functions, before the tracker
+// makes any requests to the log.
+type TrackerOption func(*LogStateTracker)
+
+// WithTrackerMetrics causes the tracker to report the fetches it makes,
+// including those of checkpoints, and the proofs it builds and verifies to m.
+func WithTrackerMetrics(m Metrics) TrackerOption {
+	return func(lst *LogStateTracker) {
+		lst.Metrics = m
+	}
 }
 
 // NewLogStateTracker creates a newly initialised tracker.
 // If a serialised LogState representation is provided then this is used as the
 // initial tracked state, otherwise a log state is fetched from the target log.
-func NewLogStateTracker(ctx context.Context, f Fetcher, h merkle.LogHasher, checkpointRaw []byte, nV note.Verifier, origin string, cc ConsensusCheckpointFunc) (LogStateTracker, error) {
+func NewLogStateTracker(ctx context.Context, f Fetcher, h merkle.LogHasher, checkpointRaw []byte, nV note.Verifier, origin string, cc ConsensusCheckpointFunc, opts ...TrackerOption) (LogStateTracker, error) {
+	return newLogStateTracker(ctx, f, h, checkpointRaw, nV, origin, cc, nil, opts)
+}
+
+// NewLogStateTrackerWithLayout creates a newly initialised tracker for a log
+// whose tiles and leaves are stored using the given layout, e.g. a log which
+// follows the C2SP tlog-tiles spec.
+func NewLogStateTrackerWithLayout(ctx context.Context, f Fetcher, h merkle.LogHasher, checkpointRaw []byte, nV note.Verifier, origin string, cc ConsensusCheckpointFunc, l Layout, opts ...TrackerOption) (LogStateTracker, error) {
+	return newLogStateTracker(ctx, f, h, checkpointRaw, nV, origin, cc, l, opts)
+}
+
+func newLogStateTracker(ctx context.Context, f Fetcher, h merkle.LogHasher, checkpointRaw []byte, nV note.Verifier, origin string, cc ConsensusCheckpointFunc, l Layout, opts []TrackerOption) (LogStateTracker, error) {
 	ret := LogStateTracker{
 		ConsensusCheckpoint: cc,
 		Fetcher:             f,
@@ -345,6 +704,11 @@ func NewLogStateTracker(ctx context.Context, f Fetcher, h merkle.LogHasher, chec
 		CheckpointNote:      nil,
 		CpSigVerifier:       nV,
 		Origin:              origin,
+		Layout:              l,
+		mu:                  &trackerLocks{},
+	}
+	for _, o := range opts {
+		o(&ret)
 	}
 	if len(checkpointRaw) > 0 {
 		ret.LatestConsistentRaw = checkpointRaw
@@ -353,7 +717,62 @@ func NewLogStateTracker(ctx context.Context, f Fetcher, h merkle.LogHasher, chec
 			return ret, err
 		}
 		ret.LatestConsistent = *cp
-		ret.ProofBuilder, err = NewProofBuilder(ctx, ret.LatestConsistent, ret.Hasher.HashChildren, ret.Fetcher)
+		ret.ProofBuilder, err = NewProofBuilder(ctx, ret.LatestConsistent, ret.Hasher.HashChildren, ret.Fetcher, ret.proofBuilderOpts()...)
+		if err != nil {
+			return ret, fmt.Errorf("NewProofBuilder: %v", err)
+		}
+		return ret, nil
+	}
+	_, _, _, err := ret.Update(ctx)
+	return ret, err
+}
+
+// NewLogStateTrackerWithVerifiers creates a newly initialised tracker for a log
+// whose checkpoints may be signed by any of a set of keys, e.g. because the log
+// is part way through rotating its signing key.
+//
+// The ConsensusCheckpointFunc is tried with each of the configured verifiers in
+// turn until one succeeds, so the log's current key should be listed first.
+// Checkpoints returned by the consensus function are additionally checked
+// against lv, to ensure they carry all Required signatures.
+func NewLogStateTrackerWithVerifiers(ctx context.Context, f Fetcher, h merkle.LogHasher, checkpointRaw []byte, lv LogVerifiers, origin string, cc ConsensusCheckpointFunc, opts ...TrackerOption) (LogStateTracker, error) {
+	return newLogStateTrackerWithVerifiers(ctx, f, h, checkpointRaw, lv, origin, cc, nil, opts)
+}
+
+// NewLogStateTrackerWithVerifiersAndLayout is like NewLogStateTrackerWithVerifiers,
+// for a log whose tiles and leaves are stored using the given layout.
+func NewLogStateTrackerWithVerifiersAndLayout(ctx context.Context, f Fetcher, h merkle.LogHasher, checkpointRaw []byte, lv LogVerifiers, origin string, cc ConsensusCheckpointFunc, l Layout, opts ...TrackerOption) (LogStateTracker, error) {
+	return newLogStateTrackerWithVerifiers(ctx, f, h, checkpointRaw, lv, origin, cc, l, opts)
+}
+
+func newLogStateTrackerWithVerifiers(ctx context.Context, f Fetcher, h merkle.LogHasher, checkpointRaw []byte, lv LogVerifiers, origin string, cc ConsensusCheckpointFunc, l Layout, opts []TrackerOption) (LogStateTracker, error) {
+	all := lv.All()
+	if len(all) == 0 {
+		return LogStateTracker{}, errors.New("no log verifiers configured")
+	}
+	ret := LogStateTracker{
+		ConsensusCheckpoint: cc,
+		Fetcher:             f,
+		Hasher:              h,
+		LatestConsistent:    log.Checkpoint{},
+		CheckpointNote:      nil,
+		CpSigVerifier:       all[0],
+		LogVerifiers:        &lv,
+		Origin:              origin,
+		Layout:              l,
+		mu:                  &trackerLocks{},
+	}
+	for _, o := range opts {
+		o(&ret)
+	}
+	if len(checkpointRaw) > 0 {
+		ret.LatestConsistentRaw = checkpointRaw
+		cp, _, _, err := lv.ParseCheckpoint(checkpointRaw, origin)
+		if err != nil {
+			return ret, err
+		}
+		ret.LatestConsistent = *cp
+		ret.ProofBuilder, err = NewProofBuilder(ctx, ret.LatestConsistent, ret.Hasher.HashChildren, ret.Fetcher, ret.proofBuilderOpts()...)
 		if err != nil {
 			return ret, fmt.Errorf("NewProofBuilder: %v", err)
 		}
@@ -380,6 +799,11 @@ func (e ErrInconsistency) Unwrap() error {
 	return e.Wrapped
 }
 
+// Is allows errors.Is(err, ErrProofMismatch) to succeed for ErrInconsistency errors.
+func (e ErrInconsistency) Is(target error) bool {
+	return target == ErrProofMismatch
+}
+
 func (e ErrInconsistency) Error() string {
 	return fmt.Sprintf("log consistency check failed: %s", e.Wrapped)
 }
@@ -391,12 +815,79 @@ func (e ErrInconsistency) Error() string {
 // Returns the old checkpoint, consistency proof, and newer checkpoint used to update.
 // If the LatestConsistent checkpoint is 0 sized, no consistency proof will be returned
 // since it would be meaningless to do so.
+//
+// Any registered Hooks are invoked with the outcome before this method returns.
 func (lst *LogStateTracker) Update(ctx context.Context) ([]byte, [][]byte, []byte, error) {
-	c, cRaw, cn, err := lst.ConsensusCheckpoint(ctx, lst.CpSigVerifier, lst.Origin)
+	mu := lst.locks()
+	mu.update.Lock()
+	oldRaw, p, newRaw, err := lst.update(ctx, mu)
+	mu.update.Unlock()
+	for _, h := range lst.Hooks {
+		if err != nil {
+			if h.OnFailure != nil {
+				h.OnFailure(err)
+			}
+			continue
+		}
+		if h.OnSuccess != nil {
+			h.OnSuccess(oldRaw, newRaw, p)
+		}
+	}
+	return oldRaw, p, newRaw, err
+}
+
+// proofBuilderOpts returns the options used for the ProofBuilders created by the tracker.
+func (lst *LogStateTracker) proofBuilderOpts() []ProofBuilderOption {
+	return []ProofBuilderOption{
+		WithMetrics(lst.Metrics),
+		WithRateLimiter(lst.RateLimiter),
+		WithLayout(lst.Layout),
+		WithTileCache(lst.TileCache),
+		WithMaxCachedTiles(lst.MaxCachedTiles),
+		WithFetchTimeout(lst.FetchTimeout),
+	}
+}
+
+// update implements Update, without invoking hooks.
+//
+// mu.update must be held, so the tracker's state may be read without holding
+// mu.state since no other goroutine may change it.
+func (lst *LogStateTracker) update(ctx context.Context, mu *trackerLocks) ([]byte, [][]byte, []byte, error) {
+	c, cRaw, cn, err := lst.consensusCheckpoint(ctx)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	builder, err := NewProofBuilder(ctx, *c, lst.Hasher.HashChildren, lst.Fetcher)
+	if lst.Freshness != nil {
+		if err := lst.Freshness.Check(cRaw); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if lst.Bounds != nil {
+		if err := lst.Bounds.Check(lst.LatestConsistent.Size, c.Size); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if lst.History != nil {
+		// Ensure the checkpoint we're currently trusting is part of the history,
+		// it may have been provided when the tracker was created.
+		if len(lst.LatestConsistentRaw) > 0 {
+			if err := recordCheckpoint(ctx, lst.History, lst.LatestConsistent.Size, lst.LatestConsistentRaw); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		if err := checkEquivocation(ctx, lst.History, *c, cRaw); err != nil {
+			return nil, nil, nil, err
+		}
+		if c.Size < lst.LatestConsistent.Size {
+			return nil, nil, nil, ErrRollback{
+				KnownRaw:     lst.LatestConsistentRaw,
+				KnownSize:    lst.LatestConsistent.Size,
+				ObservedRaw:  cRaw,
+				ObservedSize: c.Size,
+			}
+		}
+	}
+	builder, err := NewProofBuilder(ctx, *c, lst.Hasher.HashChildren, lst.Fetcher, lst.proofBuilderOpts()...)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to create proof builder: %w", err)
 	}
@@ -409,7 +900,9 @@ func (lst *LogStateTracker) Update(ctx context.Context) ([]byte, [][]byte, []byt
 		if err != nil {
 			return nil, nil, nil, err
 		}
-		if err := proof.VerifyConsistency(lst.Hasher, lst.LatestConsistent.Size, c.Size, p, lst.LatestConsistent.Hash, c.Hash); err != nil {
+		err := proof.VerifyConsistency(lst.Hasher, lst.LatestConsistent.Size, c.Size, p, lst.LatestConsistent.Hash, c.Hash)
+		metricsOrNop(lst.Metrics).ProofVerified(ConsistencyProof, err)
+		if err != nil {
 			return nil, nil, nil, ErrInconsistency{
 				SmallerRaw: lst.LatestConsistentRaw,
 				LargerRaw:  cRaw,
@@ -421,9 +914,55 @@ func (lst *LogStateTracker) Update(ctx context.Context) ([]byte, [][]byte, []byt
 
 	}
 	oldRaw := lst.LatestConsistentRaw
+	// The new checkpoint is persisted before the tracker moves to it, so that
+	// the tracker's state never gets ahead of the stored state.
+	if lst.History != nil {
+		if err := recordCheckpoint(ctx, lst.History, c.Size, cRaw); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if lst.CheckpointStore != nil && !bytes.Equal(oldRaw, cRaw) {
+		if err := lst.CheckpointStore.Store(ctx, cRaw); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to persist checkpoint: %w", err)
+		}
+	}
+	mu.state.Lock()
 	lst.LatestConsistentRaw, lst.LatestConsistent, lst.CheckpointNote = cRaw, *c, cn
 	lst.ProofBuilder = builder
-	return oldRaw, p, lst.LatestConsistentRaw, nil
+	mu.state.Unlock()
+	return oldRaw, p, cRaw, nil
+}
+
+// consensusCheckpoint retrieves the latest consensus checkpoint, verifying its
+// signatures using LogVerifiers if set, or CpSigVerifier otherwise.
+func (lst *LogStateTracker) consensusCheckpoint(ctx context.Context) (*log.Checkpoint, []byte, *note.Note, error) {
+	m := metricsOrNop(lst.Metrics)
+	m.FetchStarted(layout.CheckpointPath)
+	start := time.Now()
+	c, cRaw, cn, err := lst.verifiedConsensusCheckpoint(ctx)
+	m.FetchFinished(layout.CheckpointPath, len(cRaw), time.Since(start), err)
+	return c, cRaw, cn, err
+}
+
+// verifiedConsensusCheckpoint implements consensusCheckpoint, without
+// reporting metrics.
+func (lst *LogStateTracker) verifiedConsensusCheckpoint(ctx context.Context) (*log.Checkpoint, []byte, *note.Note, error) {
+	if lst.LogVerifiers == nil {
+		return lst.ConsensusCheckpoint(ctx, lst.CpSigVerifier, lst.Origin)
+	}
+	var errs []error
+	for _, v := range lst.LogVerifiers.All() {
+		c, cRaw, cn, err := lst.ConsensusCheckpoint(ctx, v, lst.Origin)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, _, _, err := lst.LogVerifiers.ParseCheckpoint(cRaw, lst.Origin); err != nil {
+			return nil, nil, nil, err
+		}
+		return c, cRaw, cn, nil
+	}
+	return nil, nil, nil, fmt.Errorf("no consensus checkpoint verifiable by log keys: %w", errors.Join(errs...))
 }
 
 // CheckConsistency is a wapper function which simplifies verifying consistency between two or more checkpoints.
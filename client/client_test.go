@@ -22,10 +22,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/transparency-dev/formats/log"
 	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/merkle/proof"
 	"github.com/transparency-dev/merkle/rfc6962"
 	"github.com/transparency-dev/serverless-log/api"
 	"golang.org/x/mod/sumdb/note"
@@ -34,6 +37,7 @@ import (
 var (
 	testOrigin      = "example.com/testdata"
 	testLogVerifier = mustMakeVerifier("astra+cad5a3d2+AZJqeuyE/GnknsCNh1eCtDtwdAwKBddOlS8M2eI1Jt4b")
+	testLogSigner   = mustMakeSigner("PRIVATE+KEY+astra+cad5a3d2+ASgwwenlc0uuYcdy7kI44pQvuz1fw8cS5NqS8RkZBXoy")
 	// Built using serverless/testdata/build_log.sh
 	testRawCheckpoints, testCheckpoints = mustLoadTestCheckpoints()
 )
@@ -46,6 +50,25 @@ func mustMakeVerifier(vs string) note.Verifier {
 	return v
 }
 
+func mustMakeSigner(ss string) note.Signer {
+	s, err := note.NewSigner(ss)
+	if err != nil {
+		panic(fmt.Errorf("NewSigner: %v", err))
+	}
+	return s
+}
+
+// mustSignCheckpoint returns a checkpoint with the provided contents, signed by the test log key.
+func mustSignCheckpoint(t *testing.T, origin string, size uint64, hash []byte) []byte {
+	t.Helper()
+	cp := log.Checkpoint{Origin: origin, Size: size, Hash: hash}
+	r, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, testLogSigner)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return r
+}
+
 func mustLoadTestCheckpoints() ([][]byte, []log.Checkpoint) {
 	raws, cps := make([][]byte, 0), make([]log.Checkpoint, 0)
 	for i := 0; ; i++ {
@@ -348,3 +371,198 @@ func TestHandleZeroRoot(t *testing.T) {
 		t.Fatalf("NewProofBuilder: %v", err)
 	}
 }
+
+func TestProofBuilderFetchConcurrency(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	const size = 70000
+	l := newTlogTilesLog(t, h, size)
+	cp := log.Checkpoint{Origin: testOrigin, Size: size, Hash: l.root}
+
+	for _, limit := range []int{1, 3} {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			var mu sync.Mutex
+			inFlight, maxInFlight := 0, 0
+			f := func(ctx context.Context, p string) ([]byte, error) {
+				mu.Lock()
+				inFlight++
+				maxInFlight = max(maxInFlight, inFlight)
+				mu.Unlock()
+				defer func() {
+					mu.Lock()
+					inFlight--
+					mu.Unlock()
+				}()
+				time.Sleep(10 * time.Millisecond)
+				return l.Fetcher(ctx, p)
+			}
+			pb, err := NewProofBuilder(ctx, cp, h.HashChildren, f, WithLayout(TlogTilesLayout{}), WithFetchConcurrency(limit))
+			if err != nil {
+				t.Fatalf("NewProofBuilder: %v", err)
+			}
+			smaller := newTlogTilesLog(t, h, 1000)
+			p, err := pb.ConsistencyProof(ctx, 1000, size)
+			if err != nil {
+				t.Fatalf("ConsistencyProof: %v", err)
+			}
+			if err := proof.VerifyConsistency(h, 1000, size, p, smaller.root, l.root); err != nil {
+				t.Fatalf("VerifyConsistency: %v", err)
+			}
+			if maxInFlight != limit {
+				t.Errorf("got max %d concurrent fetches, want %d", maxInFlight, limit)
+			}
+		})
+	}
+}
+
+func TestProofBuilderMaxCachedTiles(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	const size = 70000
+	l := newTlogTilesLog(t, h, size)
+	cp := log.Checkpoint{Origin: testOrigin, Size: size, Hash: l.root}
+
+	for _, test := range []struct {
+		desc     string
+		maxTiles int
+		wantMax  int
+	}{
+		{desc: "unlimited", wantMax: -1},
+		{desc: "limited", maxTiles: 2, wantMax: 2},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			pb, err := NewProofBuilder(ctx, cp, h.HashChildren, l.Fetcher, WithLayout(TlogTilesLayout{}), WithMaxCachedTiles(test.maxTiles))
+			if err != nil {
+				t.Fatalf("NewProofBuilder: %v", err)
+			}
+			for _, i := range []uint64{0, 300, 20000, 45000, 69999} {
+				p, err := pb.InclusionProof(ctx, i)
+				if err != nil {
+					t.Fatalf("InclusionProof(%d): %v", i, err)
+				}
+				if err := proof.VerifyInclusion(h, i, size, h.HashLeaf(l.leaves[i]), p, l.root); err != nil {
+					t.Fatalf("VerifyInclusion(%d): %v", i, err)
+				}
+			}
+			got := len(pb.nodeCache.tiles)
+			if test.wantMax >= 0 && got > test.wantMax {
+				t.Errorf("proof builder holds %d tiles, want at most %d", got, test.wantMax)
+			}
+			if test.wantMax < 0 && got <= 2 {
+				t.Errorf("proof builder holds %d tiles, expected more without a limit", got)
+			}
+		})
+	}
+}
+
+func TestProofBuilderInclusionProofs(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	const size = 70000
+	l := newTlogTilesLog(t, h, size)
+	cp := log.Checkpoint{Origin: testOrigin, Size: size, Hash: l.root}
+
+	var mu sync.Mutex
+	fetches := make(map[string]int)
+	f := func(ctx context.Context, p string) ([]byte, error) {
+		mu.Lock()
+		fetches[p]++
+		mu.Unlock()
+		return l.Fetcher(ctx, p)
+	}
+	pb, err := NewProofBuilder(ctx, cp, h.HashChildren, f, WithLayout(TlogTilesLayout{}))
+	if err != nil {
+		t.Fatalf("NewProofBuilder: %v", err)
+	}
+	clear(fetches)
+	indices := []uint64{69999}
+	for i := uint64(20000); i < 21000; i++ {
+		indices = append(indices, i)
+	}
+	ps, err := pb.InclusionProofs(ctx, indices)
+	if err != nil {
+		t.Fatalf("InclusionProofs: %v", err)
+	}
+	if len(ps) != len(indices) {
+		t.Fatalf("got %d proofs, want %d", len(ps), len(indices))
+	}
+	for i, idx := range indices {
+		if err := proof.VerifyInclusion(h, idx, size, h.HashLeaf(l.leaves[idx]), ps[i], l.root); err != nil {
+			t.Errorf("VerifyInclusion(%d): %v", idx, err)
+		}
+	}
+	for p, n := range fetches {
+		if n > 1 {
+			t.Errorf("fetched %q %d times, want once", p, n)
+		}
+	}
+	// Leaves [20000, 21000) span 5 level 0 tiles, plus the tile holding leaf
+	// 69999, the 2 level 1 tiles, and the level 2 tile.
+	if got, want := len(fetches), 9; got != want {
+		t.Errorf("got %d fetches, want %d", got, want)
+	}
+
+	if _, err := pb.InclusionProofs(ctx, []uint64{1, size}); err == nil {
+		t.Error("InclusionProofs beyond log size: got no error, want error")
+	}
+}
+
+func TestLogStateTrackerConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+
+	// Serve a growing log, advancing to the next checkpoint on every fetch.
+	var mu sync.Mutex
+	next := 1
+	f := func(ctx context.Context, p string) ([]byte, error) {
+		if p == "checkpoint" {
+			mu.Lock()
+			defer mu.Unlock()
+			cp := testRawCheckpoints[next]
+			next = min(next+1, len(testRawCheckpoints)-1)
+			return cp, nil
+		}
+		return testLogFetcher(ctx, p)
+	}
+	lst, err := NewLogStateTracker(ctx, f, h, nil, testLogVerifier, testOrigin, UnilateralConsensus(f))
+	if err != nil {
+		t.Fatalf("NewLogStateTracker: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if _, _, _, err := lst.Update(ctx); err != nil {
+					t.Errorf("Update: %v", err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				st := lst.State()
+				if st.Checkpoint.Size == 0 {
+					continue
+				}
+				if _, _, err := GetVerifiedLeaf(ctx, &lst, st.Checkpoint.Size-1); err != nil {
+					t.Errorf("GetVerifiedLeaf: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	st := lst.State()
+	if got, want := st.Checkpoint.Size, uint64(len(testRawCheckpoints)-1); got != want {
+		t.Errorf("got size %d, want %d", got, want)
+	}
+	// Snapshots must not share memory with the tracker.
+	st.Raw[0] ^= 1
+	st.Checkpoint.Hash[0] ^= 1
+	if now := lst.State(); bytes.Equal(now.Raw, st.Raw) || bytes.Equal(now.Checkpoint.Hash, st.Checkpoint.Hash) {
+		t.Error("modifying State result changed the tracker's state")
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CoalescingFetcher returns a Fetcher which merges concurrent requests for the
+// same path into a single call to f, whose result is returned to all of the
+// callers. This is useful when many workers share a Fetcher, since they tend to
+// want the same tiles and bundles at the same time.
+//
+// Callers receive the same slice, so they must not modify it.
+//
+// A request is made with the context of the first caller, so if that is
+// cancelled, the other callers whose contexts are still live make their own
+// requests rather than failing.
+//
+// CoalescingFetcher may be used as a Middleware.
+func CoalescingFetcher(f Fetcher) Fetcher {
+	var g singleflight.Group
+	return func(ctx context.Context, path string) ([]byte, error) {
+		return coalesce(ctx, &g, path, func() ([]byte, error) {
+			return f(ctx, path)
+		})
+	}
+}
+
+// coalesce calls fn via g, with concurrent calls sharing the same key merged.
+// If the shared call failed only because the context of the caller which made
+// it was done, fn is called again for this caller.
+func coalesce[T any](ctx context.Context, g *singleflight.Group, key string, fn func() (T, error)) (T, error) {
+	var called bool
+	v, err, _ := g.Do(key, func() (interface{}, error) {
+		called = true
+		return fn()
+	})
+	if err != nil && !called && ctx.Err() == nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return fn()
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v.(T), nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// gatedFetcher returns a Fetcher which counts its calls, and blocks each one
+// until release is closed or its context is done.
+func gatedFetcher(f Fetcher, calls *atomic.Int32, release <-chan struct{}) Fetcher {
+	return func(ctx context.Context, p string) ([]byte, error) {
+		calls.Add(1)
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return f(ctx, p)
+	}
+}
+
+func TestCoalescingFetcher(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	f := CoalescingFetcher(gatedFetcher(testLogFetcher, &calls, release))
+
+	const n = 20
+	var wg sync.WaitGroup
+	var started sync.WaitGroup
+	started.Add(n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			if _, err := f(ctx, "checkpoint"); err != nil {
+				t.Errorf("fetch: %v", err)
+			}
+		}()
+	}
+	started.Wait()
+	// Give the goroutines a chance to join the in-flight request.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+
+	// Subsequent requests aren't served from a stale result.
+	if _, err := f(ctx, "checkpoint"); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+}
+
+func TestCoalescingFetcherCancelledLeader(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	f := CoalescingFetcher(gatedFetcher(testLogFetcher, &calls, release))
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan error)
+	go func() {
+		_, err := f(leaderCtx, "checkpoint")
+		leaderDone <- err
+	}()
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	followerDone := make(chan error)
+	go func() {
+		_, err := f(context.Background(), "checkpoint")
+		followerDone <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-leaderDone; err == nil {
+		t.Error("leader: got no error, want cancellation")
+	}
+	close(release)
+	if err := <-followerDone; err != nil {
+		t.Errorf("follower: got err %v, want none", err)
+	}
+}
+
+func TestTileCacheCoalescesFetches(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	f := gatedFetcher(testLogFetcher, &calls, release)
+	c := NewTileCache(100)
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := NewProofBuilder(ctx, testCheckpoints[11], rfc6962.DefaultHasher.HashChildren, f, WithTileCache(c)); err != nil {
+				t.Errorf("NewProofBuilder: %v", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("got %d tile requests, want 1", got)
+	}
+	if s := c.Stats(); s.Coalesced != n-1 {
+		t.Errorf("got %d coalesced requests, want %d", s.Coalesced, n-1)
+	}
+}
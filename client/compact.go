@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/transparency-dev/merkle/compact"
+)
+
+// CompactRange returns a compact range covering leaves [begin, end) of the
+// tree committed to by pb's checkpoint, populated with node hashes from the
+// log's tiles.
+//
+// Compact ranges can be extended and merged with other adjacent ranges, which
+// allows callers to verify large contiguous sections of the tree far more
+// cheaply than by checking an inclusion proof for every leaf.
+// Ranges returned by the same ProofBuilder may be merged with one another.
+func (pb *ProofBuilder) CompactRange(ctx context.Context, begin, end uint64) (*compact.Range, error) {
+	if begin > end || end > pb.cp.Size {
+		return nil, fmt.Errorf("invalid range [%d, %d) for log size %d", begin, end, pb.cp.Size)
+	}
+	ids := compact.RangeNodes(begin, end, nil)
+	hashes := make([][]byte, len(ids))
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	for i, id := range ids {
+		h, err := pb.nodeCache.GetNode(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get node (%v): %w", id, err)
+		}
+		hashes[i] = h
+	}
+	return pb.rf.NewRange(begin, end, hashes)
+}
+
+// VerifyLeafHashes checks that the passed in consecutive leaf hashes, the first
+// of which is at index begin, are committed to by pb's checkpoint.
+//
+// This is done by building the compact ranges to the left and right of the
+// leaves from the log's tiles, merging them with a compact range built over the
+// leaf hashes, and comparing the resulting root hash with the checkpoint.
+func (pb *ProofBuilder) VerifyLeafHashes(ctx context.Context, begin uint64, leafHashes [][]byte) error {
+	end := begin + uint64(len(leafHashes))
+	if len(leafHashes) == 0 || end > pb.cp.Size {
+		return fmt.Errorf("invalid leaf range [%d, %d) for log size %d", begin, end, pb.cp.Size)
+	}
+	r, err := pb.CompactRange(ctx, 0, begin)
+	if err != nil {
+		return fmt.Errorf("failed to build left compact range: %w", err)
+	}
+	for _, h := range leafHashes {
+		if err := r.Append(h, nil); err != nil {
+			return fmt.Errorf("failed to append leaf hash: %w", err)
+		}
+	}
+	right, err := pb.CompactRange(ctx, end, pb.cp.Size)
+	if err != nil {
+		return fmt.Errorf("failed to build right compact range: %w", err)
+	}
+	if err := r.AppendRange(right, nil); err != nil {
+		return fmt.Errorf("failed to merge compact ranges: %w", err)
+	}
+	root, err := r.GetRootHash(nil)
+	if err != nil {
+		return fmt.Errorf("failed to calculate root hash: %w", err)
+	}
+	if !bytes.Equal(root, pb.cp.Hash) {
+		return fmt.Errorf("%w: leaves [%d, %d) produce root hash %x, expected %x", ErrProofMismatch, begin, end, root, pb.cp.Hash)
+	}
+	return nil
+}
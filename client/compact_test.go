@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestCompactRange(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	cp := testCheckpoints[14]
+	pb, err := NewProofBuilder(ctx, cp, h.HashChildren, testLogFetcher)
+	if err != nil {
+		t.Fatalf("NewProofBuilder: %v", err)
+	}
+
+	r, err := pb.CompactRange(ctx, 0, cp.Size)
+	if err != nil {
+		t.Fatalf("CompactRange: %v", err)
+	}
+	root, err := r.GetRootHash(nil)
+	if err != nil {
+		t.Fatalf("GetRootHash: %v", err)
+	}
+	if !bytes.Equal(root, cp.Hash) {
+		t.Errorf("got root %x, want %x", root, cp.Hash)
+	}
+
+	if _, err := pb.CompactRange(ctx, 3, cp.Size+1); err == nil {
+		t.Error("CompactRange beyond log size: got no error, want error")
+	}
+}
+
+func TestVerifyLeafHashes(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	cp := testCheckpoints[14]
+	pb, err := NewProofBuilder(ctx, cp, h.HashChildren, testLogFetcher)
+	if err != nil {
+		t.Fatalf("NewProofBuilder: %v", err)
+	}
+	leafHashes := make([][]byte, cp.Size)
+	for i := range leafHashes {
+		l, err := GetLeaf(ctx, testLogFetcher, uint64(i))
+		if err != nil {
+			t.Fatalf("GetLeaf(%d): %v", i, err)
+		}
+		leafHashes[i] = h.HashLeaf(l)
+	}
+
+	for _, test := range []struct {
+		desc       string
+		begin      uint64
+		leafHashes [][]byte
+		wantErr    bool
+	}{
+		{
+			desc:       "whole log",
+			leafHashes: leafHashes,
+		}, {
+			desc:       "middle of log",
+			begin:      3,
+			leafHashes: leafHashes[3:9],
+		}, {
+			desc:       "single leaf",
+			begin:      13,
+			leafHashes: leafHashes[13:14],
+		}, {
+			desc:       "wrong offset",
+			begin:      4,
+			leafHashes: leafHashes[3:9],
+			wantErr:    true,
+		}, {
+			desc:       "tampered leaf",
+			begin:      2,
+			leafHashes: [][]byte{leafHashes[2], h.HashLeaf([]byte("banana")), leafHashes[4]},
+			wantErr:    true,
+		}, {
+			desc:       "beyond log size",
+			begin:      10,
+			leafHashes: leafHashes[5:10],
+			wantErr:    true,
+		}, {
+			desc:    "no leaves",
+			begin:   3,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			err := pb.VerifyLeafHashes(ctx, test.begin, test.leafHashes)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("VerifyLeafHashes: got err %v, wantErr %t", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// WitnessPolicy describes the witness cosignatures which a checkpoint must carry
+// before it will be accepted.
+type WitnessPolicy struct {
+	// Quorum is the minimum number of distinct witnesses which must have
+	// cosigned the checkpoint.
+	Quorum int
+}
+
+// Check returns an error if n does not carry valid signatures from at least
+// p.Quorum distinct witnesses from the provided list.
+//
+// n must have been opened with the witness verifiers, e.g. via log.ParseCheckpoint.
+func (p WitnessPolicy) Check(n *note.Note, witnesses ...note.Verifier) error {
+	if got := countWitnessSigs(n, witnesses); got < p.Quorum {
+		return fmt.Errorf("checkpoint has valid signatures from %d witnesses, need %d", got, p.Quorum)
+	}
+	return nil
+}
+
+// WitnessConsensus returns a ConsensusCheckpointFunc which fetches the log's
+// checkpoint via f, and only returns it if it carries valid cosignatures from
+// at least policy.Quorum of the provided witnesses.
+//
+// Unlike UnilateralConsensus, this protects clients from being shown a split
+// view of the log, so long as fewer than policy.Quorum witnesses collude with
+// the log.
+func WitnessConsensus(f Fetcher, policy WitnessPolicy, witnesses ...note.Verifier) (ConsensusCheckpointFunc, error) {
+	if nw := len(witnesses); policy.Quorum > nw {
+		return nil, fmt.Errorf("requested quorum of %d witnesses, but only %d witnesses configured - consensus would always fail", policy.Quorum, nw)
+	}
+	return func(ctx context.Context, logSigV note.Verifier, origin string) (*log.Checkpoint, []byte, *note.Note, error) {
+		cpRaw, err := fetch(ctx, f, layout.CheckpointPath)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		cp, _, n, err := parseCheckpoint(layout.CheckpointPath, cpRaw, origin, logSigV, witnesses...)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to parse Checkpoint: %w", err)
+		}
+		if err := policy.Check(n, witnesses...); err != nil {
+			return nil, nil, nil, err
+		}
+		return cp, cpRaw, n, nil
+	}, nil
+}
+
+// countWitnessSigs returns the number of distinct witnesses from the provided
+// list which have a verified signature on n.
+func countWitnessSigs(n *note.Note, witnesses []note.Verifier) int {
+	type witKey struct {
+		name string
+		hash uint32
+	}
+	seen := make(map[witKey]bool)
+	for _, s := range n.Sigs {
+		for _, w := range witnesses {
+			if w.Name() == s.Name && w.KeyHash() == s.Hash {
+				seen[witKey{s.Name, s.Hash}] = true
+			}
+		}
+	}
+	return len(seen)
+}
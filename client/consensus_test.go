@@ -0,0 +1,141 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestWitnessConsensus(t *testing.T) {
+	ctx := context.Background()
+	logS, logV := genKeyPair(t, "log")
+	wit1S, wit1V := genKeyPair(t, "w1")
+	wit2S, wit2V := genKeyPair(t, "w2")
+	wit3S, wit3V := genKeyPair(t, "w3")
+	otherS, _ := genKeyPair(t, "other")
+
+	for _, test := range []struct {
+		desc         string
+		cp           []byte
+		witnesses    []note.Verifier
+		quorum       int
+		wantInitErr  bool
+		wantFetchErr bool
+	}{
+		{
+			desc:      "quorum met",
+			cp:        signTestCP(t, 10, logS, wit1S, wit2S),
+			witnesses: []note.Verifier{wit1V, wit2V, wit3V},
+			quorum:    2,
+		}, {
+			desc:      "all witnesses",
+			cp:        signTestCP(t, 10, logS, wit1S, wit2S, wit3S),
+			witnesses: []note.Verifier{wit1V, wit2V, wit3V},
+			quorum:    3,
+		}, {
+			desc:      "zero quorum",
+			cp:        signTestCP(t, 10, logS),
+			witnesses: []note.Verifier{wit1V},
+			quorum:    0,
+		}, {
+			desc:         "quorum not met",
+			cp:           signTestCP(t, 10, logS, wit1S),
+			witnesses:    []note.Verifier{wit1V, wit2V, wit3V},
+			quorum:       2,
+			wantFetchErr: true,
+		}, {
+			desc:         "unknown witness doesn't count",
+			cp:           signTestCP(t, 10, logS, wit1S, otherS),
+			witnesses:    []note.Verifier{wit1V, wit2V, wit3V},
+			quorum:       2,
+			wantFetchErr: true,
+		}, {
+			desc:         "missing log signature",
+			cp:           signTestCP(t, 10, wit1S, wit2S),
+			witnesses:    []note.Verifier{wit1V, wit2V},
+			quorum:       1,
+			wantFetchErr: true,
+		}, {
+			desc:        "impossible quorum",
+			witnesses:   []note.Verifier{wit1V, wit2V},
+			quorum:      3,
+			wantInitErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			f := func(_ context.Context, p string) ([]byte, error) {
+				if p != layout.CheckpointPath {
+					return nil, os.ErrNotExist
+				}
+				return test.cp, nil
+			}
+			cc, err := WitnessConsensus(f, WitnessPolicy{Quorum: test.quorum}, test.witnesses...)
+			if gotErr := err != nil; gotErr != test.wantInitErr {
+				t.Fatalf("WitnessConsensus: got err %v, wantErr %t", err, test.wantInitErr)
+			}
+			if err != nil {
+				return
+			}
+			_, cpRaw, _, err := cc(ctx, logV, testOrigin)
+			if gotErr := err != nil; gotErr != test.wantFetchErr {
+				t.Fatalf("ConsensusCheckpointFunc: got err %v, wantErr %t", err, test.wantFetchErr)
+			}
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(cpRaw, test.cp) {
+				t.Errorf("got checkpoint:\n%s\nwant:\n%s", cpRaw, test.cp)
+			}
+		})
+	}
+}
+
+func signTestCP(t *testing.T, size uint64, sigs ...note.Signer) []byte {
+	t.Helper()
+	cp := log.Checkpoint{
+		Origin: testOrigin,
+		Size:   size,
+		Hash:   []byte("banana"),
+	}
+	ret, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, sigs...)
+	if err != nil {
+		t.Fatalf("Failed to sign note: %v", err)
+	}
+	return ret
+}
+
+func genKeyPair(t *testing.T, name string) (note.Signer, note.Verifier) {
+	t.Helper()
+	sKey, vKey, err := note.GenerateKey(nil, name)
+	if err != nil {
+		t.Fatalf("Failed to generate key %q: %v", name, err)
+	}
+	s, err := note.NewSigner(sKey)
+	if err != nil {
+		t.Fatalf("Failed to create signer %q: %v", name, err)
+	}
+	v, err := note.NewVerifier(vKey)
+	if err != nil {
+		t.Fatalf("Failed to create verifier %q: %v", name, err)
+	}
+	return s, v
+}
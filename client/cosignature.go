@@ -0,0 +1,175 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/transparency-dev/formats/log"
+	"golang.org/x/mod/sumdb/note"
+)
+
+const (
+	// algCosignatureV1 is the note key algorithm identifier for cosignature/v1 keys.
+	algCosignatureV1 = 0x04
+	// cosignatureV1Header is the first line of the message signed by a cosignature/v1 key.
+	cosignatureV1Header = "cosignature/v1"
+	// timestampSize is the number of bytes used to encode the cosignature timestamp.
+	timestampSize = 8
+)
+
+// Cosignature describes a verified cosignature/v1 witness signature on a checkpoint.
+type Cosignature struct {
+	// Name is the name of the witness key which produced the cosignature.
+	Name string
+	// KeyHash is the note key hash of the witness key.
+	KeyHash uint32
+	// Timestamp is the time at which the witness asserts it verified the checkpoint.
+	Timestamp time.Time
+}
+
+// NewCosignatureV1Verifier returns a note.Verifier for cosignature/v1 witness
+// signatures made by the key described by vkey.
+//
+// vkey is in the usual note verifier key format, <name>+<hash>+<keydata>, where
+// keydata is the base64 encoding of the algorithm byte 0x04 followed by the
+// Ed25519 public key.
+//
+// The returned verifier may be passed to note.Open or log.ParseCheckpoint
+// alongside the log's own verifier.
+func NewCosignatureV1Verifier(vkey string) (note.Verifier, error) {
+	name, rest, _ := strings.Cut(vkey, "+")
+	hash16, key64, _ := strings.Cut(rest, "+")
+	hash, err1 := strconv.ParseUint(hash16, 16, 32)
+	key, err2 := base64.StdEncoding.DecodeString(key64)
+	if len(hash16) != 8 || err1 != nil || err2 != nil || name == "" || strings.ContainsAny(name, " \t\n") || len(key) == 0 {
+		return nil, errors.New("malformed verifier id")
+	}
+	if uint32(hash) != cosigKeyHash(name, key) {
+		return nil, errors.New("invalid verifier hash")
+	}
+	if key[0] != algCosignatureV1 || len(key) != 1+ed25519.PublicKeySize {
+		return nil, errors.New("not a cosignature/v1 key")
+	}
+	return &cosigV1Verifier{
+		name: name,
+		hash: uint32(hash),
+		key:  ed25519.PublicKey(key[1:]),
+	}, nil
+}
+
+// cosigV1Verifier is a note.Verifier for cosignature/v1 signatures.
+type cosigV1Verifier struct {
+	name string
+	hash uint32
+	key  ed25519.PublicKey
+}
+
+// Name returns the name of the witness key.
+func (v *cosigV1Verifier) Name() string { return v.name }
+
+// KeyHash returns the note key hash of the witness key.
+func (v *cosigV1Verifier) KeyHash() uint32 { return v.hash }
+
+// Verify checks that sig is a valid cosignature/v1 signature over msg.
+func (v *cosigV1Verifier) Verify(msg, sig []byte) bool {
+	if len(sig) != timestampSize+ed25519.SignatureSize {
+		return false
+	}
+	ts := binary.BigEndian.Uint64(sig[:timestampSize])
+	return ed25519.Verify(v.key, cosigV1Message(ts, msg), sig[timestampSize:])
+}
+
+// cosigV1Message returns the message which is signed by a witness when cosigning
+// the checkpoint body msg at time ts.
+func cosigV1Message(ts uint64, msg []byte) []byte {
+	return []byte(fmt.Sprintf("%s\ntime %d\n%s", cosignatureV1Header, ts, msg))
+}
+
+// cosigKeyHash returns the note key hash for the given key name and encoded key.
+func cosigKeyHash(name string, key []byte) uint32 {
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte("\n"))
+	h.Write(key)
+	return binary.BigEndian.Uint32(h.Sum(nil))
+}
+
+// ParseCosignedCheckpoint parses and verifies the log signature on the raw
+// checkpoint, and returns it along with the valid cosignatures it carries from
+// the provided cosignature/v1 witness verifiers.
+//
+// Signatures from unknown keys are ignored, and an empty list of cosignatures
+// is not an error; callers should apply their own quorum and freshness policies
+// to the returned cosignatures.
+func ParseCosignedCheckpoint(cpRaw []byte, logSigV note.Verifier, origin string, witnesses ...note.Verifier) (*log.Checkpoint, []Cosignature, error) {
+	cp, _, n, err := log.ParseCheckpoint(cpRaw, origin, logSigV, witnesses...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse checkpoint: %v", err)
+	}
+	cosigs, err := Cosignatures(n, witnesses...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cp, cosigs, nil
+}
+
+// Cosignatures returns the cosignature/v1 signatures on the opened note n which
+// were made by the provided witnesses.
+//
+// Only signatures which have already been verified by note.Open, i.e. those in
+// n.Sigs, are considered.
+func Cosignatures(n *note.Note, witnesses ...note.Verifier) ([]Cosignature, error) {
+	ret := make([]Cosignature, 0, len(witnesses))
+	for _, s := range n.Sigs {
+		if !isCosigV1Witness(s, witnesses) {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(s.Base64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature encoding from %q: %v", s.Name, err)
+		}
+		// Skip the 4 byte key hash prefix.
+		if len(sig) < 4+timestampSize {
+			return nil, fmt.Errorf("signature from %q too short", s.Name)
+		}
+		ts := binary.BigEndian.Uint64(sig[4 : 4+timestampSize])
+		ret = append(ret, Cosignature{
+			Name:      s.Name,
+			KeyHash:   s.Hash,
+			Timestamp: time.Unix(int64(ts), 0),
+		})
+	}
+	return ret, nil
+}
+
+// isCosigV1Witness returns true if s was made by one of the cosignature/v1
+// verifiers in witnesses.
+func isCosigV1Witness(s note.Signature, witnesses []note.Verifier) bool {
+	for _, w := range witnesses {
+		if _, ok := w.(*cosigV1Verifier); ok && w.Name() == s.Name && w.KeyHash() == s.Hash {
+			return true
+		}
+	}
+	return false
+}
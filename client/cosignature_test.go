@@ -0,0 +1,182 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/formats/log"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// testCosigner is a cosignature/v1 note.Signer for use in tests.
+type testCosigner struct {
+	name string
+	hash uint32
+	key  ed25519.PrivateKey
+	ts   time.Time
+}
+
+func (s *testCosigner) Name() string    { return s.name }
+func (s *testCosigner) KeyHash() uint32 { return s.hash }
+func (s *testCosigner) Sign(msg []byte) ([]byte, error) {
+	ts := uint64(s.ts.Unix())
+	sig := binary.BigEndian.AppendUint64(nil, ts)
+	return append(sig, ed25519.Sign(s.key, cosigV1Message(ts, msg))...), nil
+}
+
+// genCosigKeyPair returns a cosignature/v1 signer which signs with timestamp ts,
+// along with the corresponding verifier key string.
+func genCosigKeyPair(t *testing.T, name string, ts time.Time) (note.Signer, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	key := append([]byte{algCosignatureV1}, pub...)
+	hash := cosigKeyHash(name, key)
+	vkey := fmt.Sprintf("%s+%08x+%s", name, hash, base64.StdEncoding.EncodeToString(key))
+	return &testCosigner{name: name, hash: hash, key: priv, ts: ts}, vkey
+}
+
+func TestNewCosignatureV1Verifier(t *testing.T) {
+	_, vkey := genCosigKeyPair(t, "witness", time.Now())
+	for _, test := range []struct {
+		desc    string
+		vkey    string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			vkey: vkey,
+		}, {
+			desc:    "ed25519 key",
+			vkey:    "astra+cad5a3d2+AZJqeuyE/GnknsCNh1eCtDtwdAwKBddOlS8M2eI1Jt4b",
+			wantErr: true,
+		}, {
+			desc:    "bad hash",
+			vkey:    "witness+00000000" + vkey[len("witness+00000000"):],
+			wantErr: true,
+		}, {
+			desc:    "garbage",
+			vkey:    "banana",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewCosignatureV1Verifier(test.vkey)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("NewCosignatureV1Verifier: got err %v, wantErr %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCosignedCheckpoint(t *testing.T) {
+	logS, logV := genKeyPair(t, "log")
+	ts1, ts2 := time.Unix(1700000000, 0), time.Unix(1700000100, 0)
+	wit1S, wit1VKey := genCosigKeyPair(t, "w1", ts1)
+	wit2S, wit2VKey := genCosigKeyPair(t, "w2", ts2)
+	wit3S, _ := genCosigKeyPair(t, "w3", ts2)
+	wit1V, err := NewCosignatureV1Verifier(wit1VKey)
+	if err != nil {
+		t.Fatalf("NewCosignatureV1Verifier: %v", err)
+	}
+	wit2V, err := NewCosignatureV1Verifier(wit2VKey)
+	if err != nil {
+		t.Fatalf("NewCosignatureV1Verifier: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc       string
+		cp         []byte
+		wantCosigs []Cosignature
+		wantErr    bool
+	}{
+		{
+			desc: "two cosignatures",
+			cp:   signTestCP(t, 10, logS, wit1S, wit2S),
+			wantCosigs: []Cosignature{
+				{Name: "w1", KeyHash: wit1V.KeyHash(), Timestamp: ts1},
+				{Name: "w2", KeyHash: wit2V.KeyHash(), Timestamp: ts2},
+			},
+		}, {
+			desc: "unknown witness ignored",
+			cp:   signTestCP(t, 10, logS, wit1S, wit3S),
+			wantCosigs: []Cosignature{
+				{Name: "w1", KeyHash: wit1V.KeyHash(), Timestamp: ts1},
+			},
+		}, {
+			desc:       "no cosignatures",
+			cp:         signTestCP(t, 10, logS),
+			wantCosigs: []Cosignature{},
+		}, {
+			desc:    "no log signature",
+			cp:      signTestCP(t, 10, wit1S, wit2S),
+			wantErr: true,
+		}, {
+			desc:    "tampered checkpoint",
+			cp:      append([]byte("x"), signTestCP(t, 10, logS, wit1S)...),
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			cp, cosigs, err := ParseCosignedCheckpoint(test.cp, logV, testOrigin, wit1V, wit2V)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseCosignedCheckpoint: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if cp.Size != 10 {
+				t.Errorf("got checkpoint size %d, want 10", cp.Size)
+			}
+			if got, want := len(cosigs), len(test.wantCosigs); got != want {
+				t.Fatalf("got %d cosignatures, want %d: %+v", got, want, cosigs)
+			}
+			for i := range cosigs {
+				got, want := cosigs[i], test.wantCosigs[i]
+				if got.Name != want.Name || got.KeyHash != want.KeyHash || !got.Timestamp.Equal(want.Timestamp) {
+					t.Errorf("cosignature %d: got %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCosignatureV1CountsTowardsQuorum(t *testing.T) {
+	logS, logV := genKeyPair(t, "log")
+	witS, witVKey := genCosigKeyPair(t, "w1", time.Now())
+	witV, err := NewCosignatureV1Verifier(witVKey)
+	if err != nil {
+		t.Fatalf("NewCosignatureV1Verifier: %v", err)
+	}
+	cp, _, n, err := log.ParseCheckpoint(signTestCP(t, 3, logS, witS), testOrigin, logV, witV)
+	if err != nil {
+		t.Fatalf("ParseCheckpoint: %v", err)
+	}
+	if cp.Size != 3 {
+		t.Errorf("got size %d, want 3", cp.Size)
+	}
+	if got := countWitnessSigs(n, []note.Verifier{witV}); got != 1 {
+		t.Errorf("got %d witness signatures, want 1", got)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// MaxDecompressedSize is the largest resource, after decompression, which
+// DecompressingFetcher will return. This guards against maliciously crafted
+// compressed resources which expand to exhaust the client's memory.
+const MaxDecompressedSize = 64 << 20
+
+var (
+	// gzipMagic is the header which starts every gzip stream.
+	gzipMagic = []byte{0x1f, 0x8b}
+	// zstdMagic is the header which starts every zstd frame.
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	// zstdDecoder is shared by all DecompressingFetchers, its DecodeAll method
+	// is safe for concurrent use.
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(MaxDecompressedSize))
+	})
+)
+
+// DecompressingFetcher returns a Fetcher which transparently decompresses any
+// gzip or zstd compressed resources returned by f, for use with logs whose
+// tiles and leaf bundles are stored compressed at rest.
+//
+// Compressed resources are recognised by their magic header bytes, and all
+// hashing and verification is performed over the decompressed contents.
+// Resources which don't start with a known header are returned unmodified.
+//
+// Since raw leaf data may happen to begin with one of these headers, this
+// should only be used with logs which are known to compress their contents.
+func DecompressingFetcher(f Fetcher) Fetcher {
+	return func(ctx context.Context, path string) ([]byte, error) {
+		r, err := f(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		d, err := decompress(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %q: %v", path, err)
+		}
+		return d, nil
+	}
+}
+
+// decompress returns the decompressed contents of b if it's gzip or zstd
+// compressed, or b otherwise.
+func decompress(b []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(b, gzipMagic):
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		d, err := io.ReadAll(io.LimitReader(zr, MaxDecompressedSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(d) > MaxDecompressedSize {
+			return nil, fmt.Errorf("decompressed size exceeds %d bytes", MaxDecompressedSize)
+		}
+		return d, nil
+	case bytes.HasPrefix(b, zstdMagic):
+		zd, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return zd.DecodeAll(b, nil)
+	}
+	return b, nil
+}
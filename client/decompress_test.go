@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func gzipCompress(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func zstdCompress(t *testing.T, b []byte) []byte {
+	t.Helper()
+	w, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	defer w.Close()
+	return w.EncodeAll(b, nil)
+}
+
+func TestDecompressingFetcher(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		desc     string
+		compress func(*testing.T, []byte) []byte
+		wantErr  bool
+	}{
+		{
+			desc:     "uncompressed",
+			compress: func(_ *testing.T, b []byte) []byte { return b },
+		}, {
+			desc:     "gzip",
+			compress: gzipCompress,
+		}, {
+			desc:     "zstd",
+			compress: zstdCompress,
+		}, {
+			desc: "corrupt gzip",
+			compress: func(t *testing.T, b []byte) []byte {
+				c := gzipCompress(t, b)
+				return c[:len(c)/2]
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			// Compress everything other than the checkpoints, which are always stored uncompressed.
+			f := func(ctx context.Context, p string) ([]byte, error) {
+				r, err := testLogFetcher(ctx, p)
+				if err != nil || strings.HasPrefix(p, "checkpoint") {
+					return r, err
+				}
+				return test.compress(t, r), nil
+			}
+			df := DecompressingFetcher(f)
+			lst, err := NewLogStateTracker(ctx, df, rfc6962.DefaultHasher, testRawCheckpoints[10], testLogVerifier, testOrigin, UnilateralConsensus(df))
+			if gotErr := err != nil; gotErr && !test.wantErr {
+				t.Fatalf("NewLogStateTracker: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			leaf, _, err := GetVerifiedLeaf(ctx, &lst, 4)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("GetVerifiedLeaf: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want, err := GetLeaf(ctx, testLogFetcher, 4)
+			if err != nil {
+				t.Fatalf("GetLeaf: %v", err)
+			}
+			if !bytes.Equal(leaf, want) {
+				t.Errorf("got leaf %q, want %q", leaf, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/transparency-dev/serverless-log/api"
+)
+
+// KeyUnwrapper unwraps the data keys of resources which are encrypted at rest,
+// see api.Envelope.
+type KeyUnwrapper interface {
+	// UnwrapKey returns the data key wrapped by the key encryption key with
+	// the given ID.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Decrypter decrypts resources which are encrypted at rest. Unwrapped data
+// keys are cached, since they're typically shared by many resources and
+// unwrapping them may require a request to a KMS.
+//
+// It is safe for concurrent use.
+type Decrypter struct {
+	u KeyUnwrapper
+
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+// NewDecrypter returns a Decrypter which unwraps data keys with u.
+func NewDecrypter(u KeyUnwrapper) *Decrypter {
+	return &Decrypter{u: u, keys: make(map[string][]byte)}
+}
+
+// Decrypt returns the plaintext contents of raw if it's an encrypted
+// resource, see api.IsEnvelope, or raw otherwise.
+func (d *Decrypter) Decrypt(ctx context.Context, raw []byte) ([]byte, error) {
+	if !api.IsEnvelope(raw) {
+		return raw, nil
+	}
+	var e api.Envelope
+	if err := e.UnmarshalBinary(raw); err != nil {
+		return nil, err
+	}
+	cacheKey := e.KeyID + "\n" + string(e.WrappedKey)
+	d.mu.Lock()
+	dek, ok := d.keys[cacheKey]
+	d.mu.Unlock()
+	if !ok {
+		var err error
+		if dek, err = d.u.UnwrapKey(ctx, e.KeyID, e.WrappedKey); err != nil {
+			return nil, fmt.Errorf("failed to unwrap data key with key %q: %v", e.KeyID, err)
+		}
+		d.mu.Lock()
+		d.keys[cacheKey] = dek
+		d.mu.Unlock()
+	}
+	return e.Open(dek)
+}
+
+// DecryptingFetcher returns a Fetcher which transparently decrypts any
+// encrypted resources returned by f, for use with private logs whose leaf
+// bundles are encrypted at rest. Data keys are unwrapped with u.
+//
+// Encrypted resources are recognised by their header, see api.IsEnvelope, and
+// other resources, e.g. tiles and checkpoints, are returned unmodified. Logs
+// which are also compressed are encrypted after compression, so this should be
+// wrapped by DecompressingFetcher rather than the other way around.
+func DecryptingFetcher(f Fetcher, u KeyUnwrapper) Fetcher {
+	d := NewDecrypter(u)
+	return func(ctx context.Context, path string) ([]byte, error) {
+		r, err := f(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		p, err := d.Decrypt(ctx, r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %q: %v", path, err)
+		}
+		return p, nil
+	}
+}
+
+// DecryptingMiddleware returns a Middleware which decrypts resources, see
+// DecryptingFetcher.
+func DecryptingMiddleware(u KeyUnwrapper) Middleware {
+	return func(f Fetcher) Fetcher {
+		return DecryptingFetcher(f, u)
+	}
+}
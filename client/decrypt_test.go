@@ -0,0 +1,149 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api"
+)
+
+// fakeUnwrapper "wraps" data keys by reversing them, and counts the number
+// of keys it unwraps.
+type fakeUnwrapper struct {
+	keyID    string
+	unwraps  int
+	failWith error
+}
+
+func (u *fakeUnwrapper) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	u.unwraps++
+	if u.failWith != nil {
+		return nil, u.failWith
+	}
+	if keyID != u.keyID {
+		return nil, errors.New("unknown key")
+	}
+	dek := bytes.Clone(wrapped)
+	for i, j := 0, len(dek)-1; i < j; i, j = i+1, j-1 {
+		dek[i], dek[j] = dek[j], dek[i]
+	}
+	return dek, nil
+}
+
+func encrypt(t *testing.T, keyID string, dek, b []byte) []byte {
+	t.Helper()
+	wrapped := bytes.Clone(dek)
+	for i, j := 0, len(wrapped)-1; i < j; i, j = i+1, j-1 {
+		wrapped[i], wrapped[j] = wrapped[j], wrapped[i]
+	}
+	e, err := api.SealEnvelope(keyID, wrapped, dek, b)
+	if err != nil {
+		t.Fatalf("SealEnvelope: %v", err)
+	}
+	raw, err := e.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	return raw
+}
+
+func TestDecryptingFetcher(t *testing.T) {
+	ctx := context.Background()
+	dek := make([]byte, api.DataKeySize)
+	for i := range dek {
+		dek[i] = byte(i)
+	}
+	for _, test := range []struct {
+		desc      string
+		encrypt   func(*testing.T, string, []byte) []byte
+		unwrapper *fakeUnwrapper
+		wantErr   bool
+	}{
+		{
+			desc:      "unencrypted",
+			encrypt:   func(_ *testing.T, _ string, b []byte) []byte { return b },
+			unwrapper: &fakeUnwrapper{keyID: "kek"},
+		}, {
+			desc: "encrypted leaves",
+			encrypt: func(t *testing.T, p string, b []byte) []byte {
+				if !strings.HasPrefix(p, "seq/") {
+					return b
+				}
+				return encrypt(t, "kek", dek, b)
+			},
+			unwrapper: &fakeUnwrapper{keyID: "kek"},
+		}, {
+			desc: "unknown key",
+			encrypt: func(t *testing.T, p string, b []byte) []byte {
+				if !strings.HasPrefix(p, "seq/") {
+					return b
+				}
+				return encrypt(t, "other", dek, b)
+			},
+			unwrapper: &fakeUnwrapper{keyID: "kek"},
+			wantErr:   true,
+		}, {
+			desc: "unwrap fails",
+			encrypt: func(t *testing.T, p string, b []byte) []byte {
+				if !strings.HasPrefix(p, "seq/") {
+					return b
+				}
+				return encrypt(t, "kek", dek, b)
+			},
+			unwrapper: &fakeUnwrapper{keyID: "kek", failWith: errors.New("permission denied")},
+			wantErr:   true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			f := func(ctx context.Context, p string) ([]byte, error) {
+				r, err := testLogFetcher(ctx, p)
+				if err != nil {
+					return r, err
+				}
+				return test.encrypt(t, p, r), nil
+			}
+			df := DecryptingFetcher(f, test.unwrapper)
+			lst, err := NewLogStateTracker(ctx, df, rfc6962.DefaultHasher, testRawCheckpoints[10], testLogVerifier, testOrigin, UnilateralConsensus(df))
+			if err != nil {
+				t.Fatalf("NewLogStateTracker: %v", err)
+			}
+			for _, i := range []uint64{4, 5} {
+				leaf, _, err := GetVerifiedLeaf(ctx, &lst, i)
+				if gotErr := err != nil; gotErr != test.wantErr {
+					t.Fatalf("GetVerifiedLeaf: got err %v, wantErr %t", err, test.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				want, err := GetLeaf(ctx, testLogFetcher, i)
+				if err != nil {
+					t.Fatalf("GetLeaf: %v", err)
+				}
+				if !bytes.Equal(leaf, want) {
+					t.Errorf("got leaf %q, want %q", leaf, want)
+				}
+			}
+			if test.unwrapper.unwraps > 1 {
+				t.Errorf("data key unwrapped %d times, want at most once", test.unwrapper.unwraps)
+			}
+		})
+	}
+}
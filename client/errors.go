@@ -0,0 +1,181 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/transparency-dev/formats/log"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// Errors returned by this package may wrap one of the following values to
+// indicate the kind of failure, callers should use errors.Is to check for them.
+var (
+	// ErrResourceNotFound indicates that a file was not present in the log's
+	// storage. For compatibility with Fetcher implementations, errors wrapping
+	// this value also satisfy errors.Is(err, os.ErrNotExist).
+	ErrResourceNotFound error = notFoundError{}
+	// ErrBadSignature indicates that a checkpoint did not carry a valid
+	// signature from the expected key(s).
+	ErrBadSignature = errors.New("bad signature")
+	// ErrMalformedCheckpoint indicates that a validly signed checkpoint could
+	// not be parsed, or was for an unexpected origin.
+	ErrMalformedCheckpoint = errors.New("malformed checkpoint")
+	// ErrProofMismatch indicates that data fetched from the log did not verify
+	// against the expected root hash.
+	ErrProofMismatch = errors.New("proof mismatch")
+	// ErrStaleCheckpoint indicates that a checkpoint could not be shown to be
+	// fresh enough to satisfy the configured FreshnessPolicy.
+	ErrStaleCheckpoint = errors.New("stale checkpoint")
+	// ErrFetchTimeout indicates that a single request to the log's storage took
+	// longer than the per-request timeout set with TimeoutFetcher. Unlike the
+	// expiry of the caller's context, such failures are worth retrying.
+	ErrFetchTimeout = errors.New("fetch timed out")
+	// ErrLeafPruned indicates that the data of a leaf has been removed from
+	// the log after its retention period, see DiscoverPrunedSize. The leaf's
+	// hash, and proofs of its inclusion, remain available.
+	ErrLeafPruned = errors.New("leaf data pruned")
+)
+
+// notFoundError is the type of ErrResourceNotFound.
+type notFoundError struct{}
+
+func (notFoundError) Error() string { return "resource not found" }
+
+// Is allows errors.Is(ErrResourceNotFound, os.ErrNotExist) to succeed.
+func (notFoundError) Is(target error) bool { return target == os.ErrNotExist }
+
+// FetchError is returned when a resource could not be fetched from a log's
+// storage, and records the path of the resource.
+type FetchError struct {
+	// Path is the path of the resource which could not be fetched.
+	Path string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable returns true if the fetch failed due to a transient problem, and
+// may succeed if attempted again.
+func (e *FetchError) Retryable() bool {
+	return IsRetryable(e.Err)
+}
+
+// HTTPStatusError may be returned by HTTP based Fetcher implementations when
+// the server responds with an unexpected status, allowing the failure to be
+// classified by IsRetryable.
+//
+// Errors with status 404 satisfy errors.Is(err, os.ErrNotExist).
+type HTTPStatusError struct {
+	// StatusCode is the HTTP status code returned by the server.
+	StatusCode int
+}
+
+func (e HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected http status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is allows errors.Is(err, os.ErrNotExist) to succeed for 404 responses.
+func (e HTTPStatusError) Is(target error) bool {
+	return target == os.ErrNotExist && e.StatusCode == http.StatusNotFound
+}
+
+// Retryable returns true if the status indicates a transient server problem.
+func (e HTTPStatusError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return e.StatusCode >= 500
+}
+
+// IsRetryable returns true if err represents a failure which may not recur if
+// the operation is attempted again, e.g. a network error or server overload.
+//
+// Missing resources, cancelled operations, and failures to verify data from
+// the log are never retryable. Otherwise, the Retryable method of the first
+// error in err's chain to provide one is used, and errors with no
+// classification are assumed to be retryable.
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, os.ErrNotExist),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrBadSignature),
+		errors.Is(err, ErrMalformedCheckpoint),
+		errors.Is(err, ErrProofMismatch),
+		errors.Is(err, ErrStaleCheckpoint),
+		errors.Is(err, ErrLeafPruned):
+		return false
+	}
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+	return true
+}
+
+// fetch retrieves the resource at path p via f, wrapping any error in a
+// FetchError, and with ErrResourceNotFound if appropriate.
+func fetch(ctx context.Context, f Fetcher, p string) ([]byte, error) {
+	r, err := f(ctx, p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &FetchError{Path: p, Err: fmt.Errorf("%w: %w", ErrResourceNotFound, err)}
+		}
+		return nil, &FetchError{Path: p, Err: err}
+	}
+	return r, nil
+}
+
+// parseCheckpoint is a wrapper around log.ParseCheckpoint which classifies any
+// failure as either ErrBadSignature or ErrMalformedCheckpoint.
+// p is the path the checkpoint was read from, and is used to annotate errors.
+func parseCheckpoint(p string, cpRaw []byte, origin string, logSigV note.Verifier, otherVerifiers ...note.Verifier) (*log.Checkpoint, []byte, *note.Note, error) {
+	cp, otherData, n, err := log.ParseCheckpoint(cpRaw, origin, logSigV, otherVerifiers...)
+	if err != nil {
+		// ParseCheckpoint only returns a note if the log's signature was found,
+		// or if some other signature was valid.
+		if n != nil && hasSig(n, logSigV) {
+			return nil, nil, n, fmt.Errorf("%s: %w: %v", p, ErrMalformedCheckpoint, err)
+		}
+		if _, openErr := note.Open(cpRaw, note.VerifierList(logSigV)); openErr != nil && !isSigError(openErr) {
+			return nil, nil, n, fmt.Errorf("%s: %w: %v", p, ErrMalformedCheckpoint, err)
+		}
+		return nil, nil, n, fmt.Errorf("%s: %w: %v", p, ErrBadSignature, err)
+	}
+	return cp, otherData, n, nil
+}
+
+// isSigError returns true if err was returned by note.Open due to missing or
+// invalid signatures, rather than the note being malformed.
+func isSigError(err error) bool {
+	var uErr *note.UnverifiedNoteError
+	var iErr *note.InvalidSignatureError
+	return errors.As(err, &uErr) || errors.As(err, &iErr)
+}
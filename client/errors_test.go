@@ -0,0 +1,212 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api/layout"
+)
+
+func TestFetchCheckpointErrors(t *testing.T) {
+	ctx := context.Background()
+	otherS, _ := genKeyPair(t, "other")
+
+	for _, test := range []struct {
+		desc    string
+		cp      []byte
+		origin  string
+		wantErr error
+	}{
+		{
+			desc:    "not found",
+			wantErr: ErrResourceNotFound,
+		}, {
+			desc:    "bad signature",
+			cp:      []byte(strings.Replace(string(testRawCheckpoints[3]), "\n3\n", "\n4\n", 1)),
+			wantErr: ErrBadSignature,
+		}, {
+			desc:    "unknown signer",
+			cp:      signTestCP(t, 3, otherS),
+			wantErr: ErrBadSignature,
+		}, {
+			desc:    "wrong origin",
+			cp:      testRawCheckpoints[3],
+			origin:  "banana",
+			wantErr: ErrMalformedCheckpoint,
+		}, {
+			desc:    "garbage",
+			cp:      []byte("banana"),
+			wantErr: ErrMalformedCheckpoint,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			f := func(_ context.Context, p string) ([]byte, error) {
+				if len(test.cp) == 0 {
+					return nil, os.ErrNotExist
+				}
+				return test.cp, nil
+			}
+			origin := testOrigin
+			if test.origin != "" {
+				origin = test.origin
+			}
+			_, _, _, err := FetchCheckpoint(ctx, f, testLogVerifier, origin)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("FetchCheckpoint: got err %v, want %v", err, test.wantErr)
+			}
+			if !strings.Contains(err.Error(), layout.CheckpointPath) {
+				t.Errorf("error %q does not mention resource path", err)
+			}
+		})
+	}
+}
+
+func TestResourceNotFoundIsNotExist(t *testing.T) {
+	ctx := context.Background()
+	_, err := GetLeaf(ctx, testLogFetcher, 1000)
+	if !errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("GetLeaf: got err %v, want ErrResourceNotFound", err)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("GetLeaf: got err %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestResourceNotFoundWrapsCause(t *testing.T) {
+	ctx := context.Background()
+	_, err := GetLeaf(ctx, testLogFetcher, 1000)
+	var pErr *fs.PathError
+	if !errors.As(err, &pErr) {
+		t.Errorf("GetLeaf: got err %v, want *fs.PathError", err)
+	}
+
+	f := func(_ context.Context, _ string) ([]byte, error) {
+		return nil, HTTPStatusError{StatusCode: 404}
+	}
+	_, _, _, err = FetchCheckpoint(ctx, f, testLogVerifier, testOrigin)
+	var hErr HTTPStatusError
+	if !errors.As(err, &hErr) || hErr.StatusCode != 404 {
+		t.Errorf("FetchCheckpoint: got err %v, want HTTPStatusError 404", err)
+	}
+	if !errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("FetchCheckpoint: got err %v, want ErrResourceNotFound", err)
+	}
+}
+
+func TestProofMismatch(t *testing.T) {
+	ctx := context.Background()
+	cp := testCheckpoints[5]
+	cp.Hash = []byte("banana")
+	if _, err := NewProofBuilder(ctx, cp, rfc6962.DefaultHasher.HashChildren, testLogFetcher); !errors.Is(err, ErrProofMismatch) {
+		t.Errorf("NewProofBuilder: got err %v, want ErrProofMismatch", err)
+	}
+	forkedCP := mustSignCheckpoint(t, testOrigin, 5, []byte("banana"))
+	if _, err := CheckRawConsistency(ctx, rfc6962.DefaultHasher, testLogFetcher, testLogVerifier, testOrigin, forkedCP, testRawCheckpoints[9]); !errors.Is(err, ErrProofMismatch) {
+		t.Errorf("CheckRawConsistency: got err %v, want ErrProofMismatch", err)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		err  error
+		want bool
+	}{
+		{desc: "unclassified", err: errors.New("connection reset"), want: true},
+		{desc: "not found", err: os.ErrNotExist},
+		{desc: "http not found", err: HTTPStatusError{StatusCode: 404}},
+		{desc: "http forbidden", err: HTTPStatusError{StatusCode: 403}},
+		{desc: "http too many requests", err: HTTPStatusError{StatusCode: 429}, want: true},
+		{desc: "http unavailable", err: HTTPStatusError{StatusCode: 503}, want: true},
+		{desc: "cancelled", err: fmt.Errorf("gave up: %w", context.Canceled)},
+		{desc: "bad signature", err: ErrBadSignature},
+		{desc: "proof mismatch", err: ErrInconsistency{}},
+		{desc: "wrapped fetch error", err: fmt.Errorf("failed: %w", &FetchError{Path: "checkpoint", Err: HTTPStatusError{StatusCode: 500}}), want: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := IsRetryable(test.err); got != test.want {
+				t.Errorf("IsRetryable(%v): got %t, want %t", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFetchErrorPath(t *testing.T) {
+	ctx := context.Background()
+	f := func(_ context.Context, _ string) ([]byte, error) {
+		return nil, HTTPStatusError{StatusCode: 502}
+	}
+	_, _, _, err := FetchCheckpoint(ctx, f, testLogVerifier, testOrigin)
+	var fErr *FetchError
+	if !errors.As(err, &fErr) {
+		t.Fatalf("FetchCheckpoint: got err %v, want FetchError", err)
+	}
+	if fErr.Path != layout.CheckpointPath {
+		t.Errorf("got path %q, want %q", fErr.Path, layout.CheckpointPath)
+	}
+	if !fErr.Retryable() {
+		t.Error("got non-retryable error for 502 response")
+	}
+}
+
+func TestFetchArchivedCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		desc    string
+		size    uint64
+		archive map[string][]byte
+		wantErr error
+	}{
+		{
+			desc:    "found",
+			size:    3,
+			archive: map[string][]byte{"checkpoints/3": testRawCheckpoints[3]},
+		}, {
+			desc:    "not found",
+			size:    4,
+			archive: map[string][]byte{"checkpoints/3": testRawCheckpoints[3]},
+			wantErr: ErrResourceNotFound,
+		}, {
+			desc:    "wrong size",
+			size:    4,
+			archive: map[string][]byte{"checkpoints/4": testRawCheckpoints[3]},
+			wantErr: ErrMalformedCheckpoint,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			f := func(_ context.Context, p string) ([]byte, error) {
+				if r, ok := test.archive[p]; ok {
+					return r, nil
+				}
+				return nil, os.ErrNotExist
+			}
+			cp, _, _, err := FetchArchivedCheckpoint(ctx, f, testLogVerifier, testOrigin, test.size)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("FetchArchivedCheckpoint: got err %v, want %v", err, test.wantErr)
+			}
+			if err == nil && cp.Size != test.size {
+				t.Errorf("got size %d, want %d", cp.Size, test.size)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+// TimestampExtensionPrefix starts the optional checkpoint extension line which
+// holds the time, in decimal seconds since the Unix epoch, at which the log
+// signed the checkpoint, e.g. "timestamp 1712345678".
+const TimestampExtensionPrefix = "timestamp "
+
+// FreshnessPolicy describes how recently a checkpoint must have been vouched
+// for in order to be trusted, protecting clients from being served a stale, but
+// otherwise valid, view of a log indefinitely.
+//
+// A checkpoint's age is determined by the most recent of the timestamps in its
+// cosignature/v1 signatures from Witnesses, and in its timestamp extension line.
+type FreshnessPolicy struct {
+	// MaxAge is the maximum permitted age of a checkpoint.
+	MaxAge time.Duration
+	// Witnesses are the cosignature/v1 witnesses whose timestamps are trusted.
+	Witnesses []note.Verifier
+	// Now, if set, is used in place of time.Now.
+	Now func() time.Time
+}
+
+// Timestamp returns the most recent trusted time at which the checkpoint
+// cpRaw was known to be current.
+//
+// The log's signature on cpRaw is not verified, so this must only be used with
+// checkpoints which have already been verified.
+func (p FreshnessPolicy) Timestamp(cpRaw []byte) (time.Time, error) {
+	var latest time.Time
+	if len(p.Witnesses) > 0 {
+		n, err := note.Open(cpRaw, note.VerifierList(p.Witnesses...))
+		var uErr *note.UnverifiedNoteError
+		switch {
+		case errors.As(err, &uErr):
+			// No witness has cosigned the checkpoint.
+		case err != nil:
+			return time.Time{}, fmt.Errorf("failed to verify cosignatures: %v", err)
+		default:
+			cosigs, err := Cosignatures(n, p.Witnesses...)
+			if err != nil {
+				return time.Time{}, err
+			}
+			for _, c := range cosigs {
+				if c.Timestamp.After(latest) {
+					latest = c.Timestamp
+				}
+			}
+		}
+	}
+	ts, ok, err := timestampExtension(cpRaw)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ok && ts.After(latest) {
+		latest = ts
+	}
+	if latest.IsZero() {
+		return time.Time{}, fmt.Errorf("%w: checkpoint carries no trusted timestamp", ErrStaleCheckpoint)
+	}
+	return latest, nil
+}
+
+// Check returns an error wrapping ErrStaleCheckpoint if the checkpoint cpRaw
+// is older than p.MaxAge.
+func (p FreshnessPolicy) Check(cpRaw []byte) error {
+	ts, err := p.Timestamp(cpRaw)
+	if err != nil {
+		return err
+	}
+	now := time.Now
+	if p.Now != nil {
+		now = p.Now
+	}
+	if age := now().Sub(ts); age > p.MaxAge {
+		return fmt.Errorf("%w: checkpoint is %v old, maximum permitted age is %v", ErrStaleCheckpoint, age.Round(time.Second), p.MaxAge)
+	}
+	return nil
+}
+
+// timestampExtension returns the time held in the timestamp extension line of
+// the checkpoint cpRaw, if present.
+func timestampExtension(cpRaw []byte) (time.Time, bool, error) {
+	b, err := ParseCheckpointBody(cpRaw)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	v, ok := b.Extension(TimestampExtensionPrefix)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	s, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%w: invalid timestamp extension %q", ErrMalformedCheckpoint, v)
+	}
+	return time.Unix(s, 0), true, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestFreshnessPolicy(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	logS, _ := genKeyPair(t, "log")
+	freshWitS, freshWitVKey := genCosigKeyPair(t, "fresh", now.Add(-time.Minute))
+	staleWitS, staleWitVKey := genCosigKeyPair(t, "stale", now.Add(-time.Hour))
+	unknownWitS, _ := genCosigKeyPair(t, "unknown", now)
+	var witnesses []note.Verifier
+	for _, k := range []string{freshWitVKey, staleWitVKey} {
+		v, err := NewCosignatureV1Verifier(k)
+		if err != nil {
+			t.Fatalf("NewCosignatureV1Verifier: %v", err)
+		}
+		witnesses = append(witnesses, v)
+	}
+	p := FreshnessPolicy{
+		MaxAge:    10 * time.Minute,
+		Witnesses: witnesses,
+		Now:       func() time.Time { return now },
+	}
+
+	cp := func(ext string, sigs ...note.Signer) []byte {
+		t.Helper()
+		text := string(log.Checkpoint{Origin: testOrigin, Size: 10, Hash: []byte("banana")}.Marshal()) + ext
+		r, err := note.Sign(&note.Note{Text: text}, sigs...)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		return r
+	}
+
+	for _, test := range []struct {
+		desc    string
+		cp      []byte
+		wantErr error
+	}{
+		{
+			desc: "fresh cosignature",
+			cp:   cp("", logS, staleWitS, freshWitS),
+		}, {
+			desc:    "stale cosignature",
+			cp:      cp("", logS, staleWitS),
+			wantErr: ErrStaleCheckpoint,
+		}, {
+			desc:    "unknown witness ignored",
+			cp:      cp("", logS, unknownWitS),
+			wantErr: ErrStaleCheckpoint,
+		}, {
+			desc: "fresh extension",
+			cp:   cp(fmt.Sprintf("timestamp %d\n", now.Add(-time.Second).Unix()), logS),
+		}, {
+			desc: "stale extension with fresh cosignature",
+			cp:   cp(fmt.Sprintf("timestamp %d\n", now.Add(-time.Hour).Unix()), logS, freshWitS),
+		}, {
+			desc:    "stale extension",
+			cp:      cp(fmt.Sprintf("other\ntimestamp %d\n", now.Add(-time.Hour).Unix()), logS),
+			wantErr: ErrStaleCheckpoint,
+		}, {
+			desc:    "no timestamp",
+			cp:      cp("", logS),
+			wantErr: ErrStaleCheckpoint,
+		}, {
+			desc:    "malformed extension",
+			cp:      cp("timestamp banana\n", logS),
+			wantErr: ErrMalformedCheckpoint,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			err := p.Check(test.cp)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Check: got err %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestTrackerFreshness(t *testing.T) {
+	ctx := context.Background()
+	f := testLogFetcher
+	lst, err := NewLogStateTracker(ctx, f, rfc6962.DefaultHasher, testRawCheckpoints[3], testLogVerifier, testOrigin, UnilateralConsensus(f))
+	if err != nil {
+		t.Fatalf("NewLogStateTracker: %v", err)
+	}
+	lst.Freshness = &FreshnessPolicy{MaxAge: time.Hour}
+	if _, _, _, err := lst.Update(ctx); !errors.Is(err, ErrStaleCheckpoint) {
+		t.Fatalf("Update: got err %v, want %v", err, ErrStaleCheckpoint)
+	}
+	if got := lst.LatestConsistent.Size; got != 3 {
+		t.Errorf("tracker moved to size %d after stale checkpoint", got)
+	}
+}
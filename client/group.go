@@ -0,0 +1,240 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/mod/sumdb/note"
+	"gopkg.in/yaml.v3"
+)
+
+// LogConfig describes a log to be tracked by a LogGroup.
+type LogConfig struct {
+	// Origin is the expected first line of checkpoints from the log, and
+	// identifies the log within the group.
+	Origin string `yaml:"origin"`
+	// URL is the root of the log's storage, and is passed to the FetcherFactory.
+	URL string `yaml:"url"`
+	// PublicKey is the log's note verifier key, or for static-ct logs the PEM
+	// encoded public key.
+	PublicKey string `yaml:"public_key"`
+	// Hash optionally names the log's hash function, see NewHasher.
+	Hash string `yaml:"hash,omitempty"`
+	// Layout optionally names the log's storage layout, see NewLayout.
+	Layout string `yaml:"layout,omitempty"`
+}
+
+// LogGroupConfig describes a set of logs to be tracked by a LogGroup.
+type LogGroupConfig struct {
+	Logs []LogConfig `yaml:"logs"`
+}
+
+// ParseLogGroupConfig parses and validates a YAML encoded LogGroupConfig, e.g.:
+//
+//	logs:
+//	  - origin: example.com/log
+//	    url: https://example.com/log/
+//	    public_key: example.com/log+12345678+AaBbCc...
+//	  - origin: ct.example.com/2024
+//	    url: https://ct.example.com/2024/
+//	    layout: static-ct
+//	    public_key: |
+//	      -----BEGIN PUBLIC KEY-----
+//	      ...
+func ParseLogGroupConfig(b []byte) (LogGroupConfig, error) {
+	var c LogGroupConfig
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("failed to parse log group config: %v", err)
+	}
+	seen := make(map[string]bool)
+	for i, l := range c.Logs {
+		switch {
+		case l.Origin == "":
+			return c, fmt.Errorf("log %d: missing origin", i)
+		case l.URL == "":
+			return c, fmt.Errorf("log %q: missing url", l.Origin)
+		case l.PublicKey == "":
+			return c, fmt.Errorf("log %q: missing public_key", l.Origin)
+		case seen[l.Origin]:
+			return c, fmt.Errorf("log %q: duplicate origin", l.Origin)
+		}
+		seen[l.Origin] = true
+	}
+	return c, nil
+}
+
+// FetcherFactory returns a Fetcher for the log whose storage is rooted at the given URL.
+type FetcherFactory func(logURL string) (Fetcher, error)
+
+// LogGroup tracks the state of a set of logs, e.g. for monitors which watch a
+// whole ecosystem of logs.
+//
+// A LogGroup is not safe for concurrent use, and the trackers it returns must
+// not be used concurrently with Update.
+type LogGroup struct {
+	origins []string
+	logs    map[string]*groupLog
+}
+
+// groupLog holds the state of a single log in a LogGroup.
+type groupLog struct {
+	config   LogConfig
+	fetcher  Fetcher
+	verifier note.Verifier
+	tracker  LogStateTracker
+}
+
+// NewLogGroup creates a LogGroup for the configured logs, fetching an initial
+// checkpoint from each.
+//
+// newFetcher is called once per log to create the Fetcher used to read it.
+func NewLogGroup(ctx context.Context, c LogGroupConfig, newFetcher FetcherFactory) (*LogGroup, error) {
+	g := &LogGroup{logs: make(map[string]*groupLog)}
+	for _, lc := range c.Logs {
+		if _, ok := g.logs[lc.Origin]; ok {
+			return nil, fmt.Errorf("log %q: duplicate origin", lc.Origin)
+		}
+		l, err := newGroupLog(ctx, lc, newFetcher)
+		if err != nil {
+			return nil, fmt.Errorf("log %q: %w", lc.Origin, err)
+		}
+		g.origins = append(g.origins, lc.Origin)
+		g.logs[lc.Origin] = l
+	}
+	return g, nil
+}
+
+// newGroupLog creates the verifier, fetcher and tracker for the log described by c.
+func newGroupLog(ctx context.Context, c LogConfig, newFetcher FetcherFactory) (*groupLog, error) {
+	h, err := NewHasher(c.Hash)
+	if err != nil {
+		return nil, err
+	}
+	l, err := NewLayout(c.Layout)
+	if err != nil {
+		return nil, err
+	}
+	v, err := newLogVerifier(c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public_key: %v", err)
+	}
+	f, err := newFetcher(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fetcher: %v", err)
+	}
+	t, err := NewLogStateTrackerWithLayout(ctx, f, h, nil, v, c.Origin, UnilateralConsensus(f), l)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracker: %w", err)
+	}
+	return &groupLog{config: c, fetcher: f, verifier: v, tracker: t}, nil
+}
+
+// newLogVerifier returns the checkpoint verifier for the log described by c.
+func newLogVerifier(c LogConfig) (note.Verifier, error) {
+	if c.Layout != LayoutStaticCT {
+		return note.NewVerifier(c.PublicKey)
+	}
+	b, _ := pem.Decode([]byte(c.PublicKey))
+	if b == nil {
+		return nil, errors.New("static-ct logs require a PEM encoded public key")
+	}
+	k, err := x509.ParsePKIXPublicKey(b.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return NewStaticCTVerifier(c.Origin, k)
+}
+
+// Origins returns the origins of the logs in the group, in configuration order.
+func (g *LogGroup) Origins() []string {
+	return append([]string{}, g.origins...)
+}
+
+// Tracker returns the tracker for the log with the given origin.
+func (g *LogGroup) Tracker(origin string) (*LogStateTracker, bool) {
+	l, ok := g.logs[origin]
+	if !ok {
+		return nil, false
+	}
+	return &l.tracker, true
+}
+
+// Fetcher returns the Fetcher for the log with the given origin.
+func (g *LogGroup) Fetcher(origin string) (Fetcher, bool) {
+	l, ok := g.logs[origin]
+	if !ok {
+		return nil, false
+	}
+	return l.fetcher, true
+}
+
+// Verifier returns the checkpoint verifier for the log with the given origin.
+func (g *LogGroup) Verifier(origin string) (note.Verifier, bool) {
+	l, ok := g.logs[origin]
+	if !ok {
+		return nil, false
+	}
+	return l.verifier, true
+}
+
+// Config returns the configuration of the log with the given origin.
+func (g *LogGroup) Config(origin string) (LogConfig, bool) {
+	l, ok := g.logs[origin]
+	if !ok {
+		return LogConfig{}, false
+	}
+	return l.config, true
+}
+
+// Update updates the trackers for all logs in the group in parallel.
+//
+// A failure to update one log does not prevent the others from being updated.
+// The returned error, if any, joins the errors from all failed logs, each of
+// which is wrapped in a LogGroupError identifying the log.
+func (g *LogGroup) Update(ctx context.Context) error {
+	errs := make([]error, len(g.origins))
+	var wg sync.WaitGroup
+	for i, o := range g.origins {
+		wg.Add(1)
+		go func(i int, l *groupLog) {
+			defer wg.Done()
+			if _, _, _, err := l.tracker.Update(ctx); err != nil {
+				errs[i] = LogGroupError{Origin: l.config.Origin, Err: err}
+			}
+		}(i, g.logs[o])
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// LogGroupError is returned by LogGroup.Update to identify the log which failed to update.
+type LogGroupError struct {
+	Origin string
+	Err    error
+}
+
+func (e LogGroupError) Error() string {
+	return fmt.Sprintf("log %q: %v", e.Origin, e.Err)
+}
+
+func (e LogGroupError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api/layout"
+)
+
+const testLogVKey = "astra+cad5a3d2+AZJqeuyE/GnknsCNh1eCtDtwdAwKBddOlS8M2eI1Jt4b"
+
+func TestParseLogGroupConfig(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		config   string
+		wantLogs int
+		wantErr  bool
+	}{
+		{
+			desc: "valid",
+			config: `
+logs:
+  - origin: a
+    url: https://a.example.com/
+    public_key: ` + testLogVKey + `
+  - origin: b
+    url: https://b.example.com/
+    public_key: ` + testLogVKey + `
+    hash: sha512_256
+    layout: tlog-tiles
+`,
+			wantLogs: 2,
+		}, {
+			desc:   "empty",
+			config: "logs: []",
+		}, {
+			desc:    "not yaml",
+			config:  "logs: [",
+			wantErr: true,
+		}, {
+			desc: "missing url",
+			config: `
+logs:
+  - origin: a
+    public_key: ` + testLogVKey,
+			wantErr: true,
+		}, {
+			desc: "duplicate origin",
+			config: `
+logs:
+  - origin: a
+    url: https://a.example.com/
+    public_key: ` + testLogVKey + `
+  - origin: a
+    url: https://b.example.com/
+    public_key: ` + testLogVKey,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			c, err := ParseLogGroupConfig([]byte(test.config))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseLogGroupConfig: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if got := len(c.Logs); err == nil && got != test.wantLogs {
+				t.Errorf("got %d logs, want %d", got, test.wantLogs)
+			}
+		})
+	}
+}
+
+func TestLogGroup(t *testing.T) {
+	ctx := context.Background()
+	const tlogOrigin = "example.com/tlog"
+	tl := newTlogTilesLog(t, rfc6962.DefaultHasher, 300)
+	tl.files[layout.CheckpointPath] = mustSignCheckpoint(t, tlogOrigin, 300, tl.root)
+
+	shim := fetchCheckpointShim{Checkpoints: [][]byte{testRawCheckpoints[3], testRawCheckpoints[8]}}
+	var tlogErr error
+	fetchers := map[string]Fetcher{
+		"https://serverless.example.com/": shim.Fetcher(testLogFetcher),
+		"https://tlog.example.com/": func(ctx context.Context, p string) ([]byte, error) {
+			if tlogErr != nil {
+				return nil, tlogErr
+			}
+			return tl.Fetcher(ctx, p)
+		},
+	}
+	newFetcher := func(u string) (Fetcher, error) {
+		f, ok := fetchers[u]
+		if !ok {
+			return nil, fmt.Errorf("unknown url %q", u)
+		}
+		return f, nil
+	}
+
+	c, err := ParseLogGroupConfig([]byte(`
+logs:
+  - origin: ` + testOrigin + `
+    url: https://serverless.example.com/
+    public_key: ` + testLogVKey + `
+  - origin: ` + tlogOrigin + `
+    url: https://tlog.example.com/
+    public_key: ` + testLogVKey + `
+    layout: tlog-tiles
+`))
+	if err != nil {
+		t.Fatalf("ParseLogGroupConfig: %v", err)
+	}
+	g, err := NewLogGroup(ctx, c, newFetcher)
+	if err != nil {
+		t.Fatalf("NewLogGroup: %v", err)
+	}
+	if got, want := g.Origins(), []string{testOrigin, tlogOrigin}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got origins %q, want %q", got, want)
+	}
+
+	checkSize := func(origin string, want uint64) {
+		t.Helper()
+		lst, ok := g.Tracker(origin)
+		if !ok {
+			t.Fatalf("no tracker for %q", origin)
+		}
+		if got := lst.LatestConsistent.Size; got != want {
+			t.Errorf("%q: got size %d, want %d", origin, got, want)
+		}
+	}
+	checkSize(testOrigin, 3)
+	checkSize(tlogOrigin, 300)
+
+	shim.Advance()
+	tlogErr = errors.New("tlog unavailable")
+	err = g.Update(ctx)
+	var lge LogGroupError
+	if !errors.As(err, &lge) || lge.Origin != tlogOrigin {
+		t.Fatalf("Update: got err %v, want LogGroupError for %q", err, tlogOrigin)
+	}
+	// The healthy log must still have been updated.
+	checkSize(testOrigin, 8)
+
+	if _, ok := g.Tracker("banana"); ok {
+		t.Error("got tracker for unknown origin")
+	}
+
+	if _, err := NewLogGroup(ctx, LogGroupConfig{Logs: []LogConfig{{Origin: "x", URL: "nowhere", PublicKey: testLogVKey}}}, newFetcher); err == nil {
+		t.Error("NewLogGroup with unknown URL: got no error")
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto"
+	_ "crypto/sha256" // Register SHA-256 for use with rfc6962.New.
+	_ "crypto/sha512" // Register SHA-512/256 for use with rfc6962.New.
+	"fmt"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// Names of the hash functions understood by NewHasher.
+const (
+	HashSHA256     = "sha256"
+	HashSHA512_256 = "sha512_256"
+)
+
+// hashFuncs maps hash function names to their implementations.
+var hashFuncs = map[string]crypto.Hash{
+	HashSHA256:     crypto.SHA256,
+	HashSHA512_256: crypto.SHA512_256,
+}
+
+// NewHasher returns an RFC 6962 style LogHasher which uses the named hash function
+// for both leaf and interior node hashes.
+//
+// An empty name selects SHA-256, which is the default for serverless logs.
+func NewHasher(name string) (merkle.LogHasher, error) {
+	if name == "" {
+		return rfc6962.DefaultHasher, nil
+	}
+	h, ok := hashFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash function %q", name)
+	}
+	return rfc6962.New(h), nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestNewHasher(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: ""},
+		{name: HashSHA256},
+		{name: HashSHA512_256},
+		{name: "md5", wantErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			h, err := NewHasher(test.name)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("NewHasher(%q): got err %v, wantErr %t", test.name, err, test.wantErr)
+			}
+			if err == nil && h.Size() != 32 {
+				t.Errorf("got hash size %d, want 32", h.Size())
+			}
+		})
+	}
+	sha256H, _ := NewHasher(HashSHA256)
+	if !bytes.Equal(sha256H.HashLeaf([]byte("leaf")), rfc6962.DefaultHasher.HashLeaf([]byte("leaf"))) {
+		t.Error("sha256 hasher differs from rfc6962.DefaultHasher")
+	}
+	sha512H, _ := NewHasher(HashSHA512_256)
+	if bytes.Equal(sha512H.HashLeaf([]byte("leaf")), sha256H.HashLeaf([]byte("leaf"))) {
+		t.Error("sha512_256 hasher produces same leaf hash as sha256")
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/transparency-dev/formats/log"
+)
+
+// CheckpointHistory retains the checkpoints which a LogStateTracker has verified,
+// indexed by tree size.
+type CheckpointHistory interface {
+	// Get returns the raw checkpoint previously recorded for the given tree size.
+	// Implementations MUST return (either directly or wrapped) an os.ErrNotExist
+	// if no checkpoint has been recorded for that size.
+	Get(ctx context.Context, size uint64) ([]byte, error)
+	// Put records the raw checkpoint for the given tree size.
+	Put(ctx context.Context, size uint64, cpRaw []byte) error
+}
+
+// ErrEquivocation is returned when a log has been seen to produce two validly
+// signed checkpoints for the same tree size, but with different root hashes.
+// Both checkpoints are included, and constitute evidence of the log's misbehaviour.
+type ErrEquivocation struct {
+	Size uint64
+	// KnownRaw is the checkpoint previously verified by the tracker.
+	KnownRaw []byte
+	// ObservedRaw is the newly observed, conflicting, checkpoint.
+	ObservedRaw []byte
+}
+
+func (e ErrEquivocation) Error() string {
+	return fmt.Sprintf("log equivocation detected: two different checkpoints for tree size %d", e.Size)
+}
+
+// ErrRollback is returned when a log presents a checkpoint which is smaller than
+// one previously verified by a tracker which keeps a CheckpointHistory. Both
+// checkpoints are included, and constitute evidence that the client is being
+// shown an older view of the log than it has already seen.
+type ErrRollback struct {
+	// KnownRaw is the larger checkpoint previously verified by the tracker.
+	KnownRaw  []byte
+	KnownSize uint64
+	// ObservedRaw is the newly observed, smaller, checkpoint.
+	ObservedRaw  []byte
+	ObservedSize uint64
+}
+
+func (e ErrRollback) Error() string {
+	return fmt.Sprintf("log rollback detected: checkpoint for tree size %d presented after tree size %d", e.ObservedSize, e.KnownSize)
+}
+
+// checkEquivocation returns an ErrEquivocation if h holds a checkpoint of the
+// same size as cp but with a different root hash.
+func checkEquivocation(ctx context.Context, h CheckpointHistory, cp log.Checkpoint, cpRaw []byte) error {
+	knownRaw, err := h.Get(ctx, cp.Size)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read checkpoint history: %w", err)
+	}
+	// Checkpoints in the history have already been verified, so there's no
+	// need to check the signatures again.
+	var known log.Checkpoint
+	if _, err := known.Unmarshal(knownRaw); err != nil {
+		return fmt.Errorf("invalid checkpoint in history for size %d: %v", cp.Size, err)
+	}
+	if !bytes.Equal(known.Hash, cp.Hash) {
+		return ErrEquivocation{
+			Size:        cp.Size,
+			KnownRaw:    knownRaw,
+			ObservedRaw: cpRaw,
+		}
+	}
+	return nil
+}
+
+// recordCheckpoint adds cpRaw to h, unless a checkpoint of the same size is
+// already present.
+func recordCheckpoint(ctx context.Context, h CheckpointHistory, size uint64, cpRaw []byte) error {
+	if _, err := h.Get(ctx, size); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read checkpoint history: %w", err)
+	}
+	if err := h.Put(ctx, size, cpRaw); err != nil {
+		return fmt.Errorf("failed to record checkpoint for size %d: %w", size, err)
+	}
+	return nil
+}
+
+// MemoryCheckpointHistory is an in-memory CheckpointHistory.
+// It is safe for concurrent use.
+type MemoryCheckpointHistory struct {
+	mu  sync.RWMutex
+	cps map[uint64][]byte
+}
+
+// NewMemoryCheckpointHistory creates a new, empty, MemoryCheckpointHistory.
+func NewMemoryCheckpointHistory() *MemoryCheckpointHistory {
+	return &MemoryCheckpointHistory{cps: make(map[uint64][]byte)}
+}
+
+// Get returns the checkpoint recorded for size.
+func (m *MemoryCheckpointHistory) Get(_ context.Context, size uint64) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cp, ok := m.cps[size]
+	if !ok {
+		return nil, fmt.Errorf("no checkpoint for size %d: %w", size, os.ErrNotExist)
+	}
+	return cp, nil
+}
+
+// Put records cpRaw as the checkpoint for size.
+func (m *MemoryCheckpointHistory) Put(_ context.Context, size uint64, cpRaw []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cps[size] = cpRaw
+	return nil
+}
+
+// DirCheckpointHistory is a CheckpointHistory which stores each checkpoint in
+// its own file, named by tree size, in a directory on the local filesystem.
+type DirCheckpointHistory struct {
+	// Dir is the directory in which checkpoints are stored.
+	Dir string
+}
+
+// Get returns the checkpoint recorded for size.
+func (d DirCheckpointHistory) Get(_ context.Context, size uint64) ([]byte, error) {
+	return os.ReadFile(d.path(size))
+}
+
+// Put records cpRaw as the checkpoint for size.
+func (d DirCheckpointHistory) Put(ctx context.Context, size uint64, cpRaw []byte) error {
+	return FileCheckpointStore{Path: d.path(size)}.Store(ctx, cpRaw)
+}
+
+func (d DirCheckpointHistory) path(size uint64) string {
+	return filepath.Join(d.Dir, "checkpoint."+strconv.FormatUint(size, 10))
+}
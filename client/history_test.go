@@ -0,0 +1,112 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestHistoryDetectsEquivocation(t *testing.T) {
+	ctx := context.Background()
+	forkedCP := mustSignCheckpoint(t, testOrigin, 5, []byte("This is a banana, not a root hash"))
+
+	for _, test := range []struct {
+		desc    string
+		history CheckpointHistory
+	}{
+		{
+			desc:    "memory",
+			history: NewMemoryCheckpointHistory(),
+		}, {
+			desc:    "dir",
+			history: DirCheckpointHistory{Dir: t.TempDir()},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			shim := fetchCheckpointShim{Checkpoints: [][]byte{
+				testRawCheckpoints[5],
+				testRawCheckpoints[9],
+				forkedCP,
+			}}
+			f := shim.Fetcher(testLogFetcher)
+			lst, err := NewLogStateTracker(ctx, f, rfc6962.DefaultHasher, testRawCheckpoints[3], testLogVerifier, testOrigin, UnilateralConsensus(f))
+			if err != nil {
+				t.Fatalf("NewLogStateTracker: %v", err)
+			}
+			lst.History = test.history
+
+			// The first 2 checkpoints are consistent with one another.
+			for i := 0; i < 2; i++ {
+				if _, _, _, err := lst.Update(ctx); err != nil {
+					t.Fatalf("Update %d: %v", i, err)
+				}
+				shim.Advance()
+			}
+			for _, size := range []uint64{3, 5, 9} {
+				if _, err := test.history.Get(ctx, size); err != nil {
+					t.Errorf("History missing checkpoint for size %d: %v", size, err)
+				}
+			}
+
+			// The forked checkpoint is smaller than the tracker's current state,
+			// but it's the same size as a checkpoint we saw previously.
+			_, _, _, err = lst.Update(ctx)
+			var eErr ErrEquivocation
+			if !errors.As(err, &eErr) {
+				t.Fatalf("Update with forked checkpoint: got err %v, want ErrEquivocation", err)
+			}
+			if eErr.Size != 5 || !bytes.Equal(eErr.KnownRaw, testRawCheckpoints[5]) || !bytes.Equal(eErr.ObservedRaw, forkedCP) {
+				t.Errorf("got evidence %+v, want checkpoints 5 and forked", eErr)
+			}
+		})
+	}
+}
+
+func TestHistoryDetectsRollback(t *testing.T) {
+	ctx := context.Background()
+	shim := fetchCheckpointShim{Checkpoints: [][]byte{
+		testRawCheckpoints[9],
+		testRawCheckpoints[5],
+	}}
+	f := shim.Fetcher(testLogFetcher)
+	lst, err := NewLogStateTracker(ctx, f, rfc6962.DefaultHasher, testRawCheckpoints[3], testLogVerifier, testOrigin, UnilateralConsensus(f))
+	if err != nil {
+		t.Fatalf("NewLogStateTracker: %v", err)
+	}
+	lst.History = NewMemoryCheckpointHistory()
+	if _, _, _, err := lst.Update(ctx); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	shim.Advance()
+
+	// The smaller checkpoint is consistent with the larger one, but no client
+	// which has seen the larger one should accept it.
+	_, _, _, err = lst.Update(ctx)
+	var rErr ErrRollback
+	if !errors.As(err, &rErr) {
+		t.Fatalf("Update with smaller checkpoint: got err %v, want ErrRollback", err)
+	}
+	if rErr.KnownSize != 9 || !bytes.Equal(rErr.KnownRaw, testRawCheckpoints[9]) || rErr.ObservedSize != 5 || !bytes.Equal(rErr.ObservedRaw, testRawCheckpoints[5]) {
+		t.Errorf("got evidence %+v, want checkpoints 9 and 5", rErr)
+	}
+	if got := lst.State().Checkpoint.Size; got != 9 {
+		t.Errorf("after rollback, tracker at size %d, want 9", got)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestUpdateHooks(t *testing.T) {
+	ctx := context.Background()
+	shim := fetchCheckpointShim{Checkpoints: [][]byte{
+		testRawCheckpoints[6],
+		testRawCheckpoints[6],
+		[]byte("not a checkpoint"),
+	}}
+	f := shim.Fetcher(testLogFetcher)
+	lst, err := NewLogStateTracker(ctx, f, rfc6962.DefaultHasher, testRawCheckpoints[2], testLogVerifier, testOrigin, UnilateralConsensus(f))
+	if err != nil {
+		t.Fatalf("NewLogStateTracker: %v", err)
+	}
+
+	type update struct {
+		oldRaw, newRaw []byte
+		proofLen       int
+	}
+	var updates []update
+	var failures []error
+	lst.Hooks = append(lst.Hooks, UpdateHooks{
+		OnSuccess: func(oldRaw, newRaw []byte, proof [][]byte) {
+			updates = append(updates, update{oldRaw, newRaw, len(proof)})
+		},
+		OnFailure: func(err error) {
+			failures = append(failures, err)
+		},
+	}, UpdateHooks{})
+
+	for range shim.Checkpoints {
+		_, _, _, _ = lst.Update(ctx)
+		shim.Advance()
+	}
+
+	if got, want := len(updates), 2; got != want {
+		t.Fatalf("got %d successful updates, want %d", got, want)
+	}
+	if !bytes.Equal(updates[0].oldRaw, testRawCheckpoints[2]) || !bytes.Equal(updates[0].newRaw, testRawCheckpoints[6]) || updates[0].proofLen == 0 {
+		t.Errorf("first update: got %+v, want move from checkpoint 2 to 6 with proof", updates[0])
+	}
+	if !bytes.Equal(updates[1].oldRaw, testRawCheckpoints[6]) || !bytes.Equal(updates[1].newRaw, testRawCheckpoints[6]) {
+		t.Errorf("second update: got %+v, want no-op at checkpoint 6", updates[1])
+	}
+	if got, want := len(failures), 1; got != want {
+		t.Errorf("got %d failures, want %d", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// HTTPFetcher returns a Fetcher which reads resources over HTTP(S), relative to
+// the log's root URL, using c, or http.DefaultClient if c is nil.
+//
+// A 404 response results in an error satisfying errors.Is(err, os.ErrNotExist),
+// and any other non-200 response in an HTTPStatusError.
+//
+// When built for js/wasm, net/http uses the browser's Fetch API, so this may
+// be used to verify logs from within web pages.
+func HTTPFetcher(root *url.URL, c *http.Client) Fetcher {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	return func(ctx context.Context, p string) ([]byte, error) {
+		u, err := root.Parse(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %q: %v", p, err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %q: %w", u, HTTPStatusError{StatusCode: resp.StatusCode})
+		}
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body of %q: %v", u, err)
+		}
+		return b, nil
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestHTTPFetcher(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(http.StripPrefix("/log/", http.FileServer(http.Dir("../testdata/log"))))
+	defer s.Close()
+	root, err := url.Parse(s.URL + "/log/")
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+	f := HTTPFetcher(root, s.Client())
+
+	lst, err := NewLogStateTracker(ctx, f, rfc6962.DefaultHasher, nil, testLogVerifier, testOrigin, UnilateralConsensus(f))
+	if err != nil {
+		t.Fatalf("NewLogStateTracker: %v", err)
+	}
+	if _, _, err := GetVerifiedLeaf(ctx, &lst, 3); err != nil {
+		t.Errorf("GetVerifiedLeaf: %v", err)
+	}
+
+	if _, err := f(ctx, "banana"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("fetch of missing resource: got err %v, want os.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+)
+
+// Names of the log layouts understood by NewLayout.
+const (
+	LayoutServerless = "serverless"
+	LayoutTlogTiles  = "tlog-tiles"
+	LayoutStaticCT   = "static-ct"
+)
+
+// Layout describes how the tiles and leaves of a log are arranged in its storage.
+type Layout interface {
+	// TileFetcher returns a GetTileFunc which reads the tiles of a log of the
+	// given size via f.
+	// h is used to recreate any tile nodes which are not stored by the log.
+	TileFetcher(f Fetcher, h compact.HashFn, logSize uint64) GetTileFunc
+
+	// GetLeaf fetches the raw contents committed to at leaf index i of a log
+	// of the given size via f.
+	GetLeaf(ctx context.Context, f Fetcher, i, logSize uint64) ([]byte, error)
+
+	// LeafBundleSize returns the number of leaves stored together in each of
+	// the log's leaf bundles, which is 1 for logs which store leaves
+	// individually.
+	LeafBundleSize() uint64
+
+	// GetLeafBundle fetches the raw contents of the leaves in the leaf bundle
+	// with the given index of a log of the given size via f, with a single
+	// request. Only the bundle holding the end of the log may be partial.
+	GetLeafBundle(ctx context.Context, f Fetcher, index, logSize uint64) ([][]byte, error)
+}
+
+// NewLayout returns the named Layout.
+//
+// An empty name selects the serverless layout.
+func NewLayout(name string) (Layout, error) {
+	switch name {
+	case "", LayoutServerless:
+		return ServerlessLayout{}, nil
+	case LayoutTlogTiles:
+		return TlogTilesLayout{}, nil
+	case LayoutStaticCT:
+		return StaticCTLayout{}, nil
+	}
+	return nil, fmt.Errorf("unknown log layout %q", name)
+}
+
+// layoutOrDefault returns l, or the serverless layout if l is nil.
+func layoutOrDefault(l Layout) Layout {
+	if l == nil {
+		return ServerlessLayout{}
+	}
+	return l
+}
+
+// ServerlessLayout is the Layout used by logs written by this repo, see the
+// api/layout package for details.
+type ServerlessLayout struct {
+	// BundleSize is the number of leaves in each of the log's leaf bundles, see
+	// DiscoverBundleSize. Both 0 and 1 mean that leaves are stored individually.
+	BundleSize uint64
+}
+
+// TileFetcher implements Layout.
+func (ServerlessLayout) TileFetcher(f Fetcher, _ compact.HashFn, logSize uint64) GetTileFunc {
+	return newTileFetcher(f, logSize)
+}
+
+// GetLeaf implements Layout.
+func (l ServerlessLayout) GetLeaf(ctx context.Context, f Fetcher, i, logSize uint64) ([]byte, error) {
+	if l.BundleSize <= 1 {
+		return GetLeaf(ctx, f, i)
+	}
+	if i >= logSize {
+		return nil, fmt.Errorf("leaf index %d is outside of log size %d: %w", i, logSize, os.ErrNotExist)
+	}
+	entries, err := l.GetLeafBundle(ctx, f, i/l.BundleSize, logSize)
+	if err != nil {
+		return nil, err
+	}
+	return entries[i%l.BundleSize], nil
+}
+
+// LeafBundleSize implements Layout.
+func (l ServerlessLayout) LeafBundleSize() uint64 {
+	return max(l.BundleSize, 1)
+}
+
+// GetLeafBundle implements Layout. Logs whose BundleSize is 0 or 1 store leaves
+// individually, so each of their bundles is a single leaf.
+//
+// If the bundle's data has been pruned from the log, an error wrapping
+// ErrLeafPruned is returned.
+func (l ServerlessLayout) GetLeafBundle(ctx context.Context, f Fetcher, index, logSize uint64) ([][]byte, error) {
+	if l.BundleSize <= 1 {
+		if index >= logSize {
+			return nil, fmt.Errorf("leaf index %d is outside of log size %d: %w", index, logSize, os.ErrNotExist)
+		}
+		leaf, err := GetLeaf(ctx, f, index)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{leaf}, nil
+	}
+	want := l.BundleSize
+	partial := uint64(0)
+	if index == logSize/l.BundleSize {
+		partial = logSize % l.BundleSize
+		want = partial
+	}
+	if index > logSize/l.BundleSize || want == 0 {
+		return nil, fmt.Errorf("leaf bundle %d is outside of log size %d: %w", index, logSize, os.ErrNotExist)
+	}
+	p := path.Join(layout.BundlePath("", index, partial))
+	raw, err := fetch(ctx, f, p)
+	if err != nil {
+		return nil, checkPruned(ctx, f, index*l.BundleSize, fmt.Errorf("failed to fetch leaf bundle %d: %w", index, err))
+	}
+	var b api.LeafBundle
+	if err := b.UnmarshalText(raw); err != nil {
+		return nil, fmt.Errorf("failed to parse leaf bundle at %q: %w", p, err)
+	}
+	if got := uint64(len(b.Entries)); got != want {
+		return nil, fmt.Errorf("leaf bundle at %q has %d entries, want %d", p, got, want)
+	}
+	return b.Entries, nil
+}
+
+// DiscoverBundleSize returns the number of leaves in each of the leaf bundles
+// of the serverless log read via f, as recorded by the log. Logs which don't
+// record their bundle size have a bundle size of 1.
+func DiscoverBundleSize(ctx context.Context, f Fetcher) (uint64, error) {
+	raw, err := fetch(ctx, f, layout.BundleSizePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return 1, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to fetch bundle size: %w", err)
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid bundle size %q", raw)
+	}
+	return n, nil
+}
+
+// DiscoverPrunedSize returns the size of the pruned prefix of the serverless
+// log read via f, i.e. the number of leaves at the start of the log whose data
+// has been removed, or 0 if the log has not been pruned. Attempts to fetch
+// pruned leaves fail with ErrLeafPruned.
+func DiscoverPrunedSize(ctx context.Context, f Fetcher) (uint64, error) {
+	raw, err := fetch(ctx, f, layout.PrunedPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to fetch pruned size: %w", err)
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pruned size %q", raw)
+	}
+	return n, nil
+}
+
+// checkPruned is called with the error from fetching the data of leaf index i
+// from the serverless log read via f. If the leaf was not found because it has
+// been pruned, an error wrapping ErrLeafPruned is returned, otherwise err is.
+func checkPruned(ctx context.Context, f Fetcher, i uint64, err error) error {
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if n, pErr := DiscoverPrunedSize(ctx, f); pErr == nil && i < n {
+		return fmt.Errorf("leaf index %d: %w", i, ErrLeafPruned)
+	}
+	return err
+}
+
+// tlogHashSize is the size of the hashes stored in tlog-tiles tiles.
+const tlogHashSize = 32
+
+// TlogTilesLayout is the Layout described by the C2SP tlog-tiles spec, in which
+// tiles hold only the 256 hashes at the bottom of each tile, and leaves are stored
+// in bundles of up to 256 entries.
+//
+// See https://c2sp.org/tlog-tiles.
+type TlogTilesLayout struct{}
+
+// TileFetcher implements Layout.
+func (TlogTilesLayout) TileFetcher(f Fetcher, h compact.HashFn, logSize uint64) GetTileFunc {
+	rf := &compact.RangeFactory{Hash: h}
+	return func(ctx context.Context, level, index uint64) (*api.Tile, error) {
+		p := layout.TlogTilePath(level, index, layout.PartialTileSize(level, index, logSize))
+		t, err := fetch(ctx, f, p)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("failed to read tile: %w", err)
+			}
+			return nil, err
+		}
+		if len(t) == 0 || len(t)%tlogHashSize != 0 || len(t)/tlogHashSize > layout.TlogTileWidth {
+			return nil, fmt.Errorf("tile at %q has invalid length %d", p, len(t))
+		}
+
+		// The tile only holds its bottom row of hashes, so rebuild the
+		// rest of the tile's nodes from them.
+		tile := &api.Tile{
+			NumLeaves: uint(len(t) / tlogHashSize),
+			Nodes:     make([][]byte, 0, layout.TlogTileWidth*2),
+		}
+		visit := func(id compact.NodeID, hash []byte) {
+			// The root of a full tile belongs to the tile above.
+			if id.Level >= 8 {
+				return
+			}
+			idx := api.TileNodeKey(id.Level, id.Index)
+			if l := uint(len(tile.Nodes)); idx >= l {
+				tile.Nodes = append(tile.Nodes, make([][]byte, idx-l+1)...)
+			}
+			tile.Nodes[idx] = hash
+		}
+		r := rf.NewEmptyRange(0)
+		for i := 0; i < len(t); i += tlogHashSize {
+			if err := r.Append(t[i:i+tlogHashSize], visit); err != nil {
+				return nil, fmt.Errorf("failed to build tile at %q: %w", p, err)
+			}
+		}
+		return tile, nil
+	}
+}
+
+// GetLeaf implements Layout.
+func (TlogTilesLayout) GetLeaf(ctx context.Context, f Fetcher, i, logSize uint64) ([]byte, error) {
+	if i >= logSize {
+		return nil, fmt.Errorf("leaf index %d not found in log of size %d: %w", i, logSize, os.ErrNotExist)
+	}
+	bundleIndex := i / layout.TlogTileWidth
+	entries, err := TlogTilesLayout{}.GetEntryBundle(ctx, f, bundleIndex, logSize)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("leaf index %d not found: %w", i, err)
+		}
+		return nil, fmt.Errorf("failed to fetch leaf index %d: %w", i, err)
+	}
+	want := i % layout.TlogTileWidth
+	if want >= uint64(len(entries)) {
+		return nil, fmt.Errorf("leaf index %d not found in entry bundle %d: %w", i, bundleIndex, os.ErrNotExist)
+	}
+	return entries[want], nil
+}
+
+// LeafBundleSize implements Layout.
+func (TlogTilesLayout) LeafBundleSize() uint64 {
+	return layout.TlogTileWidth
+}
+
+// GetLeafBundle implements Layout.
+func (TlogTilesLayout) GetLeafBundle(ctx context.Context, f Fetcher, index, logSize uint64) ([][]byte, error) {
+	if index >= (logSize+layout.TlogTileWidth-1)/layout.TlogTileWidth {
+		return nil, fmt.Errorf("entry bundle %d is outside of log size %d: %w", index, logSize, os.ErrNotExist)
+	}
+	entries, err := TlogTilesLayout{}.GetEntryBundle(ctx, f, index, logSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch entry bundle %d: %w", index, err)
+	}
+	want := layout.PartialTileSize(0, index, logSize)
+	if want == 0 {
+		want = layout.TlogTileWidth
+	}
+	if got := uint64(len(entries)); got != want {
+		return nil, fmt.Errorf("entry bundle %d has %d entries, want %d", index, got, want)
+	}
+	return entries, nil
+}
+
+// GetEntryBundle fetches the entry bundle with the given index from a log of
+// the given size via f, and returns the entries it contains, in order.
+//
+// The entries are not verified, see NodeFetcher.VerifyLeaves.
+func (TlogTilesLayout) GetEntryBundle(ctx context.Context, f Fetcher, index, logSize uint64) ([][]byte, error) {
+	p := layout.TlogEntriesPath(index, layout.PartialTileSize(0, index, logSize))
+	b, err := fetch(ctx, f, p)
+	if err != nil {
+		return nil, err
+	}
+	// Entry bundles are a sequence of big-endian uint16 length-prefixed entries.
+	var entries [][]byte
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, fmt.Errorf("entry bundle at %q is truncated", p)
+		}
+		l := int(binary.BigEndian.Uint16(b))
+		b = b[2:]
+		if len(b) < l {
+			return nil, fmt.Errorf("entry bundle at %q is truncated", p)
+		}
+		entries = append(entries, b[:l])
+		b = b[l:]
+	}
+	return entries, nil
+}
@@ -0,0 +1,260 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+)
+
+// tlogTilesLog is an in-memory log stored using the C2SP tlog-tiles layout.
+type tlogTilesLog struct {
+	files  map[string][]byte
+	leaves [][]byte
+	root   []byte
+}
+
+// newTlogTilesLog builds a tlog-tiles log containing n leaves.
+func newTlogTilesLog(t *testing.T, h merkle.LogHasher, n int) *tlogTilesLog {
+	t.Helper()
+	leaves := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		leaves = append(leaves, []byte(fmt.Sprintf("leaf %d", i)))
+	}
+	l := newTlogTilesTree(t, h, leaves)
+	for i := 0; i < n; i += layout.TlogTileWidth {
+		end := min(i+layout.TlogTileWidth, n)
+		var b []byte
+		for _, leaf := range l.leaves[i:end] {
+			b = binary.BigEndian.AppendUint16(b, uint16(len(leaf)))
+			b = append(b, leaf...)
+		}
+		l.files[layout.TlogEntriesPath(uint64(i/layout.TlogTileWidth), uint64(end-i)%layout.TlogTileWidth)] = b
+	}
+	return l
+}
+
+// newTlogTilesTree builds the hash tiles of a tlog-tiles log containing the
+// provided leaves. No entry bundles are created.
+func newTlogTilesTree(t *testing.T, h merkle.LogHasher, leaves [][]byte) *tlogTilesLog {
+	t.Helper()
+	l := &tlogTilesLog{files: make(map[string][]byte), leaves: leaves}
+	rf := &compact.RangeFactory{Hash: h.HashChildren}
+	r := rf.NewEmptyRange(0)
+	// levels holds the hashes stored in the bottom row of the tiles at each tile level.
+	levels := [][][]byte{}
+	visit := func(id compact.NodeID, hash []byte) {
+		if id.Level%8 != 0 {
+			return
+		}
+		tl := int(id.Level / 8)
+		if tl == len(levels) {
+			levels = append(levels, nil)
+		}
+		levels[tl] = append(levels[tl], hash)
+	}
+	for _, leaf := range leaves {
+		if err := r.Append(h.HashLeaf(leaf), visit); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	root, err := r.GetRootHash(nil)
+	if err != nil {
+		t.Fatalf("GetRootHash: %v", err)
+	}
+	l.root = root
+
+	for tl, hashes := range levels {
+		for i := 0; i < len(hashes); i += layout.TlogTileWidth {
+			end := min(i+layout.TlogTileWidth, len(hashes))
+			p := layout.TlogTilePath(uint64(tl), uint64(i/layout.TlogTileWidth), uint64(end-i)%layout.TlogTileWidth)
+			l.files[p] = bytes.Join(hashes[i:end], nil)
+		}
+	}
+	return l
+}
+
+func (l *tlogTilesLog) Fetcher(_ context.Context, p string) ([]byte, error) {
+	if b, ok := l.files[p]; ok {
+		return b, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func TestNewLayout(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		want    Layout
+		wantErr bool
+	}{
+		{name: "", want: ServerlessLayout{}},
+		{name: LayoutServerless, want: ServerlessLayout{}},
+		{name: LayoutTlogTiles, want: TlogTilesLayout{}},
+		{name: LayoutStaticCT, want: StaticCTLayout{}},
+		{name: "banana", wantErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewLayout(test.name)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("NewLayout: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %T, want %T", got, test.want)
+			}
+		})
+	}
+}
+
+// newBundledLog builds the leaf bundles of a serverless log containing size
+// leaves, stored in bundles of bundleSize leaves. No tiles are created.
+func newBundledLog(t *testing.T, size, bundleSize uint64) *tlogTilesLog {
+	t.Helper()
+	l := &tlogTilesLog{files: map[string][]byte{}, leaves: make([][]byte, size)}
+	for i := range l.leaves {
+		l.leaves[i] = []byte(fmt.Sprintf("leaf %d", i))
+	}
+	for i := uint64(0); i < size; i += bundleSize {
+		end := min(i+bundleSize, size)
+		raw, err := api.LeafBundle{Entries: l.leaves[i:end]}.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText: %v", err)
+		}
+		l.files[path.Join(layout.BundlePath("", i/bundleSize, (end-i)%bundleSize))] = raw
+	}
+	return l
+}
+
+func TestServerlessLayoutBundles(t *testing.T) {
+	ctx := context.Background()
+	const size, bundleSize = 10, 4
+	l := newBundledLog(t, size, bundleSize)
+	leaves := l.leaves
+
+	if got, err := DiscoverBundleSize(ctx, l.Fetcher); err != nil || got != 1 {
+		t.Errorf("DiscoverBundleSize without bundle_size: got %d, %v, want 1", got, err)
+	}
+	l.files[layout.BundleSizePath] = []byte("4\n")
+	got, err := DiscoverBundleSize(ctx, l.Fetcher)
+	if err != nil || got != bundleSize {
+		t.Fatalf("DiscoverBundleSize: got %d, %v, want %d", got, err, bundleSize)
+	}
+
+	sl := ServerlessLayout{BundleSize: got}
+	for i := range leaves {
+		leaf, err := sl.GetLeaf(ctx, l.Fetcher, uint64(i), size)
+		if err != nil {
+			t.Fatalf("GetLeaf(%d): %v", i, err)
+		}
+		if !bytes.Equal(leaf, leaves[i]) {
+			t.Errorf("GetLeaf(%d): got %q, want %q", i, leaf, leaves[i])
+		}
+	}
+	if _, err := sl.GetLeaf(ctx, l.Fetcher, size, size); err == nil {
+		t.Error("GetLeaf beyond log size: got no error")
+	}
+	// The partial bundle for a smaller log doesn't exist.
+	if _, err := sl.GetLeaf(ctx, l.Fetcher, 8, 9); err == nil {
+		t.Error("GetLeaf from missing partial bundle: got no error")
+	}
+	l.files[layout.BundleSizePath] = []byte("0")
+	if _, err := DiscoverBundleSize(ctx, l.Fetcher); err == nil {
+		t.Error("DiscoverBundleSize with invalid size: got no error")
+	}
+
+	// Prune the first bundle.
+	if got, err := DiscoverPrunedSize(ctx, l.Fetcher); err != nil || got != 0 {
+		t.Errorf("DiscoverPrunedSize without pruned: got %d, %v, want 0", got, err)
+	}
+	delete(l.files, path.Join(layout.BundlePath("", 0, 0)))
+	l.files[layout.PrunedPath] = []byte("4")
+	if got, err := DiscoverPrunedSize(ctx, l.Fetcher); err != nil || got != 4 {
+		t.Errorf("DiscoverPrunedSize: got %d, %v, want 4", got, err)
+	}
+	if _, err := sl.GetLeaf(ctx, l.Fetcher, 3, size); !errors.Is(err, ErrLeafPruned) || IsRetryable(err) {
+		t.Errorf("GetLeaf of pruned leaf: got %v, want %v", err, ErrLeafPruned)
+	}
+	if _, err := sl.GetLeaf(ctx, l.Fetcher, 8, 9); errors.Is(err, ErrLeafPruned) {
+		t.Errorf("GetLeaf from missing partial bundle: got %v", err)
+	}
+	l.files[layout.PrunedPath] = []byte("four")
+	if _, err := DiscoverPrunedSize(ctx, l.Fetcher); err == nil {
+		t.Error("DiscoverPrunedSize with invalid size: got no error")
+	}
+}
+
+func TestTlogTilesLayout(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	const size = 700
+	l := newTlogTilesLog(t, h, size)
+	cpRaw := mustSignCheckpoint(t, testOrigin, size, l.root)
+
+	lst, err := NewLogStateTrackerWithLayout(ctx, l.Fetcher, h, cpRaw, testLogVerifier, testOrigin, UnilateralConsensus(l.Fetcher), TlogTilesLayout{})
+	if err != nil {
+		t.Fatalf("NewLogStateTrackerWithLayout: %v", err)
+	}
+	for _, i := range []uint64{0, 255, 256, 511, 512, size - 1} {
+		leaf, _, err := GetVerifiedLeaf(ctx, &lst, i)
+		if err != nil {
+			t.Fatalf("GetVerifiedLeaf(%d): %v", i, err)
+		}
+		if !bytes.Equal(leaf, l.leaves[i]) {
+			t.Errorf("GetVerifiedLeaf(%d): got %q, want %q", i, leaf, l.leaves[i])
+		}
+	}
+
+	for _, from := range []uint64{1, 200, 256, 513} {
+		smaller := newTlogTilesLog(t, h, int(from))
+		p, err := lst.ProofBuilder.ConsistencyProof(ctx, from, size)
+		if err != nil {
+			t.Fatalf("ConsistencyProof(%d, %d): %v", from, size, err)
+		}
+		if err := proof.VerifyConsistency(h, from, size, p, smaller.root, l.root); err != nil {
+			t.Errorf("VerifyConsistency(%d, %d): %v", from, size, err)
+		}
+	}
+}
+
+func TestTlogTilesLayoutErrors(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	l := newTlogTilesLog(t, h, 10)
+	tl := TlogTilesLayout{}
+
+	if _, err := tl.GetLeaf(ctx, l.Fetcher, 10, 10); err == nil {
+		t.Error("GetLeaf beyond log size: got no error")
+	}
+	l.files[layout.TlogEntriesPath(0, 10)] = []byte{0x00, 0x10, 'a'}
+	if _, err := tl.GetLeaf(ctx, l.Fetcher, 0, 10); err == nil {
+		t.Error("GetLeaf from truncated bundle: got no error")
+	}
+	l.files[layout.TlogTilePath(0, 0, 10)] = []byte("not a whole number of hashes")
+	if _, err := tl.TileFetcher(l.Fetcher, h.HashChildren, 10)(ctx, 0, 0); err == nil {
+		t.Error("TileFetcher with bad tile: got no error")
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultLeafFetchConcurrency is the number of parallel requests GetLeaves will
+// make if no other value is specified.
+const DefaultLeafFetchConcurrency = 10
+
+// GetLeaves fetches the raw contents of the N consecutive leaves starting with
+// the leaf at index first, from a log of the given size which uses layout l, or
+// the serverless layout if l is nil.
+//
+// Each leaf bundle holding the leaves is fetched once, with up to concurrency
+// requests made in parallel. If concurrency is <= 0 then
+// DefaultLeafFetchConcurrency is used.
+// The returned slice contains the leaves in index order.
+func GetLeaves(ctx context.Context, f Fetcher, l Layout, first, N, logSize uint64, concurrency int) ([][]byte, error) {
+	if concurrency <= 0 {
+		concurrency = DefaultLeafFetchConcurrency
+	}
+	if N == 0 {
+		return [][]byte{}, nil
+	}
+	end := first + N
+	if end < first || end > logSize {
+		return nil, fmt.Errorf("leaves [%d, %d) are outside of log size %d: %w", first, end, logSize, os.ErrNotExist)
+	}
+	l = layoutOrDefault(l)
+	bs := l.LeafBundleSize()
+	ret := make([][]byte, N)
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(concurrency)
+	for b := first / bs; b*bs < end; b++ {
+		b := b
+		eg.Go(func() error {
+			leaves, err := l.GetLeafBundle(ctx, f, b, logSize)
+			if err != nil {
+				return err
+			}
+			copyBundle(ret, first, leaves, b*bs)
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, fmt.Errorf("failed to fetch leaves [%d, %d): %w", first, end, err)
+	}
+	return ret, nil
+}
+
+// copyBundle copies the leaves of a bundle starting at index bundleFirst into
+// dst, which holds the leaves starting at index dstFirst, ignoring any which
+// fall outside of dst.
+func copyBundle(dst [][]byte, dstFirst uint64, bundle [][]byte, bundleFirst uint64) {
+	for i, leaf := range bundle {
+		idx := bundleFirst + uint64(i)
+		if idx >= dstFirst && idx-dstFirst < uint64(len(dst)) {
+			dst[idx-dstFirst] = leaf
+		}
+	}
+}
+
+// StreamBufferSize is the maximum number of leaves StreamLeaves will fetch
+// ahead of the consumer.
+const StreamBufferSize = 64
+
+// LeafOrErr holds either a leaf returned by StreamLeaves, or the error which
+// terminated the stream.
+type LeafOrErr struct {
+	// Index is the position of the leaf in the log.
+	Index uint64
+	// Leaf is the raw leaf data.
+	Leaf []byte
+	// Err is set if the leaf could not be fetched, in which case it will be the
+	// last value sent on the stream.
+	Err error
+}
+
+// StreamLeaves returns a channel which yields the leaves in the range [from, to)
+// of a log of the given size which uses layout l, or the serverless layout if l
+// is nil, in index order.
+//
+// Leaf bundles are prefetched in parallel, with at most StreamBufferSize leaves,
+// or a single bundle if bundles are larger, held in memory ahead of the
+// consumer, so arbitrarily large ranges may be streamed. Each bundle is fetched
+// once. The channel is closed once all leaves have been sent, an error has been
+// sent, or ctx is done. Callers which stop reading before the channel is closed
+// must cancel ctx in order to release the resources used by the stream.
+func StreamLeaves(ctx context.Context, f Fetcher, l Layout, from, to, logSize uint64) <-chan LeafOrErr {
+	ctx, cancel := context.WithCancel(ctx)
+	out := make(chan LeafOrErr)
+	l = layoutOrDefault(l)
+	bs := l.LeafBundleSize()
+	// bundleResult holds the leaves of the bundle starting at index first.
+	type bundleResult struct {
+		first  uint64
+		leaves [][]byte
+		err    error
+	}
+	// pending holds a channel per in-flight bundle fetch, in index order. Its
+	// capacity bounds the number of leaves fetched ahead of the consumer.
+	pending := make(chan chan bundleResult, max(StreamBufferSize/bs, 1))
+
+	go func() {
+		defer close(pending)
+		for b := from / bs; b*bs < to; b++ {
+			r := make(chan bundleResult, 1)
+			select {
+			case <-ctx.Done():
+				return
+			case pending <- r:
+			}
+			go func(b uint64) {
+				res := bundleResult{first: b * bs}
+				res.leaves, res.err = l.GetLeafBundle(ctx, f, b, logSize)
+				r <- res
+			}(b)
+		}
+	}()
+
+	go func() {
+		// Ensure the producer above is stopped if we bail early.
+		defer cancel()
+		defer close(out)
+		for r := range pending {
+			var res bundleResult
+			select {
+			case <-ctx.Done():
+				return
+			case res = <-r:
+			}
+			var ls []LeafOrErr
+			for i, leaf := range res.leaves {
+				if idx := res.first + uint64(i); idx >= from && idx < to {
+					ls = append(ls, LeafOrErr{Index: idx, Leaf: leaf})
+				}
+			}
+			// The bundle at the end of the log is partial, and may not hold
+			// all of the requested leaves.
+			next := max(res.first+uint64(len(res.leaves)), from)
+			if res.err == nil && next < min(res.first+bs, to) {
+				res.err = fmt.Errorf("leaf index %d is outside of log size %d: %w", next, logSize, os.ErrNotExist)
+			}
+			if res.err != nil {
+				ls = append(ls, LeafOrErr{Index: next, Err: res.err})
+			}
+			for _, l := range ls {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- l:
+				}
+				if l.Err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,235 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestGetLeaves(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		desc        string
+		first, N    uint64
+		concurrency int
+		wantErr     error
+	}{
+		{
+			desc: "all leaves",
+			N:    15,
+		}, {
+			desc:        "middle of log",
+			first:       3,
+			N:           7,
+			concurrency: 2,
+		}, {
+			desc: "empty range",
+			N:    0,
+		}, {
+			desc:    "beyond end of log",
+			first:   10,
+			N:       10,
+			wantErr: os.ErrNotExist,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := GetLeaves(ctx, testLogFetcher, nil, test.first, test.N, 15, test.concurrency)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("GetLeaves: got err %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if l := uint64(len(got)); l != test.N {
+				t.Fatalf("got %d leaves, want %d", l, test.N)
+			}
+			for i, l := range got {
+				want, err := GetLeaf(ctx, testLogFetcher, test.first+uint64(i))
+				if err != nil {
+					t.Fatalf("GetLeaf(%d): %v", test.first+uint64(i), err)
+				}
+				if !bytes.Equal(l, want) {
+					t.Errorf("leaf %d: got %q, want %q", test.first+uint64(i), l, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamLeaves(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		desc     string
+		from, to uint64
+		wantErr  bool
+	}{
+		{
+			desc: "all leaves",
+			to:   15,
+		}, {
+			desc: "middle of log",
+			from: 4,
+			to:   9,
+		}, {
+			desc:    "beyond end of log",
+			from:    12,
+			to:      20,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			next := test.from
+			var err error
+			for l := range StreamLeaves(ctx, testLogFetcher, nil, test.from, test.to, 15) {
+				if l.Err != nil {
+					err = l.Err
+					continue
+				}
+				if l.Index != next {
+					t.Fatalf("got leaf %d, want %d", l.Index, next)
+				}
+				want, err := GetLeaf(ctx, testLogFetcher, l.Index)
+				if err != nil {
+					t.Fatalf("GetLeaf(%d): %v", l.Index, err)
+				}
+				if !bytes.Equal(l.Leaf, want) {
+					t.Errorf("leaf %d: got %q, want %q", l.Index, l.Leaf, want)
+				}
+				next++
+			}
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("got err %v, wantErr %t", err, test.wantErr)
+			}
+			if !test.wantErr && next != test.to {
+				t.Errorf("stream ended at %d, want %d", next, test.to)
+			}
+		})
+	}
+}
+
+func TestLeavesWithLayout(t *testing.T) {
+	ctx := context.Background()
+	bundled := newBundledLog(t, 10, 4)
+	tiles := newTlogTilesLog(t, rfc6962.DefaultHasher, 600)
+
+	for _, test := range []struct {
+		desc     string
+		f        Fetcher
+		l        Layout
+		leaves   [][]byte
+		from, to uint64
+		// wantFetches is the number of requests expected to fetch the range.
+		wantFetches int
+	}{
+		{
+			desc:        "bundled, all leaves",
+			f:           bundled.Fetcher,
+			l:           ServerlessLayout{BundleSize: 4},
+			leaves:      bundled.leaves,
+			to:          10,
+			wantFetches: 3,
+		}, {
+			desc:        "bundled, within bundle",
+			f:           bundled.Fetcher,
+			l:           ServerlessLayout{BundleSize: 4},
+			leaves:      bundled.leaves,
+			from:        5,
+			to:          7,
+			wantFetches: 1,
+		}, {
+			desc:        "bundled, partial bundles",
+			f:           bundled.Fetcher,
+			l:           ServerlessLayout{BundleSize: 4},
+			leaves:      bundled.leaves,
+			from:        3,
+			to:          9,
+			wantFetches: 3,
+		}, {
+			desc:        "tlog-tiles",
+			f:           tiles.Fetcher,
+			l:           TlogTilesLayout{},
+			leaves:      tiles.leaves,
+			from:        200,
+			to:          600,
+			wantFetches: 3,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			size := uint64(len(test.leaves))
+			want := test.leaves[test.from:test.to]
+
+			cf := newCountingFetcher(test.f)
+			got, err := GetLeaves(ctx, cf.Fetch, test.l, test.from, test.to-test.from, size, 2)
+			if err != nil {
+				t.Fatalf("GetLeaves: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("GetLeaves: got %q, want %q", got, want)
+			}
+			checkFetches(t, cf, test.wantFetches)
+
+			cf = newCountingFetcher(test.f)
+			got = nil
+			for l := range StreamLeaves(ctx, cf.Fetch, test.l, test.from, test.to, size) {
+				if l.Err != nil {
+					t.Fatalf("StreamLeaves: %v", l.Err)
+				}
+				got = append(got, l.Leaf)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("StreamLeaves: got %q, want %q", got, want)
+			}
+			checkFetches(t, cf, test.wantFetches)
+
+			// Ranges extending beyond the log fail once the leaves in the
+			// log have been returned.
+			if _, err := GetLeaves(ctx, test.f, test.l, test.from, size-test.from+1, size, 2); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("GetLeaves beyond log size: got err %v, want os.ErrNotExist", err)
+			}
+			next := test.from
+			err = nil
+			for l := range StreamLeaves(ctx, test.f, test.l, test.from, size+1, size) {
+				if l.Err != nil {
+					err = l.Err
+					break
+				}
+				next++
+			}
+			if !errors.Is(err, os.ErrNotExist) || next != size {
+				t.Errorf("StreamLeaves beyond log size: got err %v at %d, want os.ErrNotExist at %d", err, next, size)
+			}
+		})
+	}
+}
+
+// checkFetches checks that cf has made n fetches, none of them repeated.
+func checkFetches(t *testing.T, cf *countingFetcher, n int) {
+	t.Helper()
+	if len(cf.count) != n {
+		t.Errorf("got fetches %v, want %d", cf.count, n)
+	}
+	for p, c := range cf.count {
+		if c != 1 {
+			t.Errorf("got %d fetches of %q, want 1", c, p)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// LeafIndexFunc resolves a leaf hash to the index at which the leaf was
+// sequenced into a log.
+//
+// Implementations should return an error wrapping os.ErrNotExist if the leaf
+// hash is not known to the log.
+type LeafIndexFunc func(ctx context.Context, leafHash []byte) (uint64, error)
+
+// ServerlessLeafIndex returns a LeafIndexFunc which resolves leaf hashes using
+// the leaf hash to index mapping files published by serverless logs.
+func ServerlessLeafIndex(f Fetcher) LeafIndexFunc {
+	return func(ctx context.Context, leafHash []byte) (uint64, error) {
+		return LookupIndex(ctx, f, leafHash)
+	}
+}
+
+// LookupVerifiedIndex resolves the leaf hash to its index in the log tracked by
+// lst using lookup, and returns the index along with an inclusion proof which has
+// been verified against the tracker's LatestConsistent checkpoint.
+//
+// This answers the question "is my entry in the log?" without needing to scan the
+// log's contents.
+//
+// An error wrapping os.ErrNotExist is returned if the leaf hash is unknown to the
+// log, or has not yet been integrated into the tracked checkpoint; callers which
+// expect the leaf to appear may wish to use AwaitInclusion instead.
+func LookupVerifiedIndex(ctx context.Context, lst *LogStateTracker, lookup LeafIndexFunc, leafHash []byte) (uint64, [][]byte, error) {
+	idx, err := lookup(ctx, leafHash)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to look up index of leaf %x: %w", leafHash, err)
+	}
+	st := lst.State()
+	if size := st.Checkpoint.Size; idx >= size {
+		return 0, nil, fmt.Errorf("leaf %x at index %d is not covered by tracked log size %d: %w", leafHash, idx, size, os.ErrNotExist)
+	}
+	p, err := verifiedInclusionProof(ctx, lst, st, idx, leafHash)
+	if err != nil {
+		return 0, nil, err
+	}
+	return idx, p, nil
+}
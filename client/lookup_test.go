@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestLookupIndex(t *testing.T) {
+	ctx := context.Background()
+	l, err := GetLeaf(ctx, testLogFetcher, 5)
+	if err != nil {
+		t.Fatalf("GetLeaf: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc      string
+		leafHash  []byte
+		wantIndex uint64
+		wantErr   bool
+	}{
+		{
+			desc:      "found",
+			leafHash:  rfc6962.DefaultHasher.HashLeaf(l),
+			wantIndex: 5,
+		}, {
+			desc:     "unknown leaf",
+			leafHash: []byte("banana"),
+			wantErr:  true,
+		}, {
+			desc:     "short leaf hash",
+			leafHash: []byte{0x01, 0x02},
+			wantErr:  true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			idx, err := LookupIndex(ctx, testLogFetcher, test.leafHash)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("LookupIndex: %v, want error %t", err, test.wantErr)
+			}
+			if idx != test.wantIndex {
+				t.Errorf("LookupIndex: got index %d, want %d", idx, test.wantIndex)
+			}
+		})
+	}
+}
+
+func TestLookupVerifiedIndex(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	leafHash := func(i uint64) []byte {
+		l, err := GetLeaf(ctx, testLogFetcher, i)
+		if err != nil {
+			t.Fatalf("GetLeaf(%d): %v", i, err)
+		}
+		return h.HashLeaf(l)
+	}
+
+	for _, test := range []struct {
+		desc      string
+		lookup    LeafIndexFunc
+		leafHash  []byte
+		wantIndex uint64
+		wantErr   error
+	}{
+		{
+			desc:      "found",
+			lookup:    ServerlessLeafIndex(testLogFetcher),
+			leafHash:  leafHash(3),
+			wantIndex: 3,
+		}, {
+			desc:     "unknown leaf",
+			lookup:   ServerlessLeafIndex(testLogFetcher),
+			leafHash: []byte("banana"),
+			wantErr:  os.ErrNotExist,
+		}, {
+			desc:     "not yet integrated",
+			lookup:   ServerlessLeafIndex(testLogFetcher),
+			leafHash: leafHash(7),
+			wantErr:  os.ErrNotExist,
+		}, {
+			desc: "wrong index",
+			lookup: func(context.Context, []byte) (uint64, error) {
+				return 2, nil
+			},
+			leafHash: leafHash(3),
+			wantErr:  ErrProofMismatch,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			lst, err := NewLogStateTracker(ctx, testLogFetcher, h, testRawCheckpoints[5], testLogVerifier, testOrigin, UnilateralConsensus(testLogFetcher))
+			if err != nil {
+				t.Fatalf("NewLogStateTracker: %v", err)
+			}
+			idx, p, err := LookupVerifiedIndex(ctx, &lst, test.lookup, test.leafHash)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("LookupVerifiedIndex: got err %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if idx != test.wantIndex {
+				t.Errorf("got index %d, want %d", idx, test.wantIndex)
+			}
+			if len(p) == 0 {
+				t.Error("got empty inclusion proof")
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// ProofKind identifies the type of a proof reported via the Metrics interface.
+type ProofKind string
+
+const (
+	// InclusionProof identifies Merkle inclusion proofs.
+	InclusionProof ProofKind = "inclusion"
+	// ConsistencyProof identifies Merkle consistency proofs.
+	ConsistencyProof ProofKind = "consistency"
+)
+
+// Metrics is an optional hook which may be provided to LogStateTracker and
+// ProofBuilder in order to observe the work they do, e.g. to export it to
+// a monitoring system.
+//
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// FetchStarted is called before a resource is requested from the log.
+	FetchStarted(path string)
+	// FetchFinished is called once a request for a resource has completed.
+	// size is the number of bytes returned, and err is the error, if any.
+	FetchFinished(path string, size int, d time.Duration, err error)
+	// ProofBuilt is called once a proof has been constructed, or has failed
+	// to be constructed.
+	ProofBuilt(kind ProofKind, d time.Duration, err error)
+	// ProofVerified is called with the outcome of verifying a proof.
+	ProofVerified(kind ProofKind, err error)
+}
+
+// MetricsFetcher returns a Fetcher which reports all requests made via f to m.
+func MetricsFetcher(f Fetcher, m Metrics) Fetcher {
+	if m == nil {
+		return f
+	}
+	return func(ctx context.Context, path string) ([]byte, error) {
+		m.FetchStarted(path)
+		start := time.Now()
+		r, err := f(ctx, path)
+		m.FetchFinished(path, len(r), time.Since(start), err)
+		return r, err
+	}
+}
+
+// metricsOrNop returns m, or a no-op implementation if m is nil.
+func metricsOrNop(m Metrics) Metrics {
+	if m == nil {
+		return nopMetrics{}
+	}
+	return m
+}
+
+// nopMetrics is a Metrics implementation which does nothing.
+type nopMetrics struct{}
+
+func (nopMetrics) FetchStarted(string)                             {}
+func (nopMetrics) FetchFinished(string, int, time.Duration, error) {}
+func (nopMetrics) ProofBuilt(ProofKind, time.Duration, error)      {}
+func (nopMetrics) ProofVerified(ProofKind, error)                  {}
@@ -0,0 +1,139 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// recordingMetrics is a Metrics implementation which counts the calls made to it.
+type recordingMetrics struct {
+	sync.Mutex
+	started, finished int
+	bytes             int
+	paths             map[string]int
+	built, verified   map[ProofKind]int
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{
+		paths:    make(map[string]int),
+		built:    make(map[ProofKind]int),
+		verified: make(map[ProofKind]int),
+	}
+}
+
+func (m *recordingMetrics) FetchStarted(p string) {
+	m.Lock()
+	defer m.Unlock()
+	m.started++
+	m.paths[p]++
+}
+
+func (m *recordingMetrics) FetchFinished(_ string, size int, _ time.Duration, _ error) {
+	m.Lock()
+	defer m.Unlock()
+	m.finished++
+	m.bytes += size
+}
+
+func (m *recordingMetrics) ProofBuilt(k ProofKind, _ time.Duration, _ error) {
+	m.Lock()
+	defer m.Unlock()
+	m.built[k]++
+}
+
+func (m *recordingMetrics) ProofVerified(k ProofKind, _ error) {
+	m.Lock()
+	defer m.Unlock()
+	m.verified[k]++
+}
+
+func TestProofBuilderMetrics(t *testing.T) {
+	ctx := context.Background()
+	m := newRecordingMetrics()
+	pb, err := NewProofBuilder(ctx, testCheckpoints[10], rfc6962.DefaultHasher.HashChildren, testLogFetcher, WithMetrics(m))
+	if err != nil {
+		t.Fatalf("NewProofBuilder: %v", err)
+	}
+	if _, err := pb.InclusionProof(ctx, 3); err != nil {
+		t.Fatalf("InclusionProof: %v", err)
+	}
+	if _, err := pb.ConsistencyProof(ctx, 3, testCheckpoints[10].Size); err != nil {
+		t.Fatalf("ConsistencyProof: %v", err)
+	}
+
+	if m.started == 0 || m.started != m.finished {
+		t.Errorf("got %d fetches started and %d finished, want equal non-zero counts", m.started, m.finished)
+	}
+	if m.bytes == 0 {
+		t.Error("got 0 bytes fetched, want > 0")
+	}
+	for _, k := range []ProofKind{InclusionProof, ConsistencyProof} {
+		if got, want := m.built[k], 1; got != want {
+			t.Errorf("got %d %s proofs built, want %d", got, k, want)
+		}
+	}
+}
+
+func TestLogStateTrackerMetrics(t *testing.T) {
+	ctx := context.Background()
+	shim := fetchCheckpointShim{Checkpoints: [][]byte{testRawCheckpoints[10]}}
+	f := shim.Fetcher(testLogFetcher)
+	lst, err := NewLogStateTracker(ctx, f, rfc6962.DefaultHasher, testRawCheckpoints[3], testLogVerifier, testOrigin, UnilateralConsensus(f))
+	if err != nil {
+		t.Fatalf("NewLogStateTracker: %v", err)
+	}
+	m := newRecordingMetrics()
+	lst.Metrics = m
+	if _, _, _, err := lst.Update(ctx); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, want := m.built[ConsistencyProof], 1; got != want {
+		t.Errorf("got %d consistency proofs built, want %d", got, want)
+	}
+	if got, want := m.verified[ConsistencyProof], 1; got != want {
+		t.Errorf("got %d consistency proofs verified, want %d", got, want)
+	}
+}
+
+func TestLogStateTrackerCheckpointMetrics(t *testing.T) {
+	ctx := context.Background()
+	shim := fetchCheckpointShim{Checkpoints: [][]byte{testRawCheckpoints[3], testRawCheckpoints[10]}}
+	f := shim.Fetcher(testLogFetcher)
+	m := newRecordingMetrics()
+	lst, err := NewLogStateTracker(ctx, f, rfc6962.DefaultHasher, nil, testLogVerifier, testOrigin, UnilateralConsensus(f), WithTrackerMetrics(m))
+	if err != nil {
+		t.Fatalf("NewLogStateTracker: %v", err)
+	}
+	if got, want := m.paths["checkpoint"], 1; got != want {
+		t.Errorf("got %d checkpoint fetches from constructor, want %d", got, want)
+	}
+	shim.Advance()
+	if _, _, _, err := lst.Update(ctx); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, want := m.paths["checkpoint"], 2; got != want {
+		t.Errorf("got %d checkpoint fetches after Update, want %d", got, want)
+	}
+	if m.started != m.finished {
+		t.Errorf("got %d fetches started and %d finished, want equal counts", m.started, m.finished)
+	}
+}
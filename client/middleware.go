@@ -0,0 +1,81 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+)
+
+// Middleware wraps a Fetcher in another which adds some behaviour, e.g.
+// retries, metrics, or decompression.
+//
+// DecompressingFetcher is itself a Middleware, and the other Fetcher wrappers in
+// this package have Middleware forms below.
+type Middleware func(Fetcher) Fetcher
+
+// Chain returns a Fetcher which passes requests through each of mws in turn
+// before reaching f, i.e. Chain(f, a, b) is equivalent to a(b(f)).
+//
+// This means the first middleware sees each request first, and each response
+// last, so e.g. a metrics middleware placed before a retry middleware observes
+// a single request regardless of the number of attempts made.
+func Chain(f Fetcher, mws ...Middleware) Fetcher {
+	for i := len(mws) - 1; i >= 0; i-- {
+		f = mws[i](f)
+	}
+	return f
+}
+
+// RetryMiddleware returns a Middleware which retries failed requests, see
+// RetryFetcher.
+func RetryMiddleware(opts RetryOpts) Middleware {
+	return func(f Fetcher) Fetcher {
+		return RetryFetcher(f, opts)
+	}
+}
+
+// MetricsMiddleware returns a Middleware which reports requests to m, see
+// MetricsFetcher.
+func MetricsMiddleware(m Metrics) Middleware {
+	return func(f Fetcher) Fetcher {
+		return MetricsFetcher(f, m)
+	}
+}
+
+// RateLimitMiddleware returns a Middleware which waits for permission from l
+// before each request, see RateLimitedFetcher.
+func RateLimitMiddleware(l RateLimiter) Middleware {
+	return func(f Fetcher) Fetcher {
+		return RateLimitedFetcher(f, l)
+	}
+}
+
+// ChaosMiddleware returns a Middleware which fails the given fraction of
+// requests, chosen at random, with a retryable HTTPStatusError without passing
+// them on. This is useful for checking that clients, e.g. the hammer, cope with
+// an unreliable log.
+func ChaosMiddleware(failRate float64) Middleware {
+	return func(f Fetcher) Fetcher {
+		return func(ctx context.Context, path string) ([]byte, error) {
+			if rand.Float64() < failRate {
+				return nil, fmt.Errorf("injected failure fetching %q: %w", path, HTTPStatusError{StatusCode: http.StatusServiceUnavailable})
+			}
+			return f(ctx, path)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	tag := func(name string) Middleware {
+		return func(f Fetcher) Fetcher {
+			return func(ctx context.Context, p string) ([]byte, error) {
+				calls = append(calls, name)
+				b, err := f(ctx, p)
+				return append(b, name...), err
+			}
+		}
+	}
+	base := func(_ context.Context, p string) ([]byte, error) {
+		calls = append(calls, "base")
+		return []byte(p + ":"), nil
+	}
+
+	b, err := Chain(base, tag("a"), tag("b"))(context.Background(), "x")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if got, want := string(b), "x:ba"; got != want {
+		t.Errorf("got response %q, want %q", got, want)
+	}
+	if got, want := calls, []string{"a", "b", "base"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("got calls %q, want %q", got, want)
+	}
+	if _, err := Chain(base)(context.Background(), "x"); err != nil {
+		t.Errorf("Chain with no middleware: %v", err)
+	}
+}
+
+func TestChaosMiddlewareRetried(t *testing.T) {
+	ctx := context.Background()
+	f := Chain(testLogFetcher,
+		RetryMiddleware(RetryOpts{MaxAttempts: 100, InitialBackoff: time.Microsecond, MaxBackoff: time.Microsecond}),
+		ChaosMiddleware(0.5))
+	for i := 0; i < 20; i++ {
+		if _, err := f(ctx, "checkpoint"); err != nil {
+			t.Fatalf("fetch %d: %v", i, err)
+		}
+	}
+
+	if _, err := ChaosMiddleware(1)(testLogFetcher)(ctx, "checkpoint"); !IsRetryable(err) {
+		t.Errorf("got err %v, want retryable error", err)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// mirrorMaxCachedTiles bounds the number of tiles held in memory while a log is
+// being verified by Mirror.
+const mirrorMaxCachedTiles = 64
+
+// WriteStorage is the destination for the resources of a log copied by Mirror.
+type WriteStorage interface {
+	// Write stores data at the given path, relative to the root of the log,
+	// replacing anything previously stored there.
+	Write(ctx context.Context, path string, data []byte) error
+}
+
+// DirWriteStorage is a WriteStorage which stores resources as files in a
+// directory on the local filesystem, e.g. to be served by a static web server.
+type DirWriteStorage struct {
+	// Root is the directory corresponding to the root of the log.
+	Root string
+}
+
+// Write atomically replaces the contents of the file at path.
+func (s DirWriteStorage) Write(ctx context.Context, path string, data []byte) error {
+	return FileCheckpointStore{Path: filepath.Join(s.Root, filepath.FromSlash(path))}.Store(ctx, data)
+}
+
+// mirrorOpts holds the optional configuration of a call to Mirror.
+type mirrorOpts struct {
+	h merkle.LogHasher
+	l Layout
+}
+
+// MirrorOption is used to configure optional behaviour of Mirror.
+type MirrorOption func(*mirrorOpts)
+
+// WithMirrorHasher sets the hasher used to verify the log, by default the
+// RFC 6962 SHA-256 hasher is used.
+func WithMirrorHasher(h merkle.LogHasher) MirrorOption {
+	return func(o *mirrorOpts) {
+		o.h = h
+	}
+}
+
+// WithMirrorLayout sets the layout of the log, by default the serverless
+// layout is assumed.
+func WithMirrorLayout(l Layout) MirrorOption {
+	return func(o *mirrorOpts) {
+		o.l = l
+	}
+}
+
+// Mirror copies the checkpoint, tiles, and leaves of the log read via src to
+// dst, verifying every copied resource.
+//
+// The log's checkpoint must be for the log identified by origin, and signed by
+// v. The whole tree is recomputed from the log's leaves, and every node stored
+// in its tiles is checked against the recomputed tree, before the resulting
+// root hash is checked against the checkpoint. Only then are the resources
+// written to dst, each being fetched again and checked to be unchanged since
+// it was verified, so that memory use does not depend on the size of the log.
+// The checkpoint is written last, so dst never advertises a tree it does not
+// hold.
+//
+// Only the resources used by the log's Layout to serve leaves and tiles are
+// copied, e.g. the serverless layout's leaf hash index is not.
+//
+// Returns the checkpoint which was mirrored.
+func Mirror(ctx context.Context, src Fetcher, dst WriteStorage, v note.Verifier, origin string, opts ...MirrorOption) (*log.Checkpoint, error) {
+	o := mirrorOpts{
+		h: rfc6962.DefaultHasher,
+		l: ServerlessLayout{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cp, cpRaw, _, err := FetchCheckpoint(ctx, src, v, origin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch checkpoint: %w", err)
+	}
+
+	rec := &mirrorRecorder{f: src, digests: make(map[string][sha256.Size]byte)}
+	if err := verifyMirror(ctx, o, rec, cp); err != nil {
+		return nil, err
+	}
+
+	for _, p := range rec.paths {
+		b, err := fetch(ctx, src, p)
+		if err != nil {
+			return nil, err
+		}
+		if sha256.Sum256(b) != rec.digests[p] {
+			return nil, fmt.Errorf("%w: %q changed after it was verified", ErrProofMismatch, p)
+		}
+		if err := dst.Write(ctx, p, b); err != nil {
+			return nil, fmt.Errorf("failed to write %q: %w", p, err)
+		}
+	}
+	if err := dst.Write(ctx, layout.CheckpointPath, cpRaw); err != nil {
+		return nil, fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+// verifyMirror recomputes the tree committed to by cp from the log's leaves,
+// checking it against the log's tiles and cp's root hash, and recording the
+// digest of every resource read along the way with rec.
+func verifyMirror(ctx context.Context, o mirrorOpts, rec *mirrorRecorder, cp *log.Checkpoint) error {
+	if cp.Size == 0 {
+		if !bytes.Equal(cp.Hash, o.h.EmptyRoot()) {
+			return fmt.Errorf("%w: empty log has root hash %x, want %x", ErrProofMismatch, cp.Hash, o.h.EmptyRoot())
+		}
+		return nil
+	}
+
+	nf := NewNodeFetcher(o.l.TileFetcher(rec.fetch, o.h.HashChildren, cp.Size), cp.Size, 1)
+	nf.nc.maxTiles = mirrorMaxCachedTiles
+	// Leaves are read one at a time, but may be stored in bundles, so keep hold
+	// of the most recently read resource to avoid fetching bundles repeatedly.
+	var lastPath string
+	var last []byte
+	leafFetch := func(ctx context.Context, p string) ([]byte, error) {
+		if p != lastPath || last == nil {
+			b, err := rec.fetch(ctx, p)
+			if err != nil {
+				return nil, err
+			}
+			lastPath, last = p, b
+		}
+		return last, nil
+	}
+
+	var visitErr error
+	visit := func(id compact.NodeID, hash []byte) {
+		if visitErr != nil {
+			return
+		}
+		got, err := nf.Node(ctx, id)
+		if err != nil {
+			visitErr = fmt.Errorf("failed to fetch node %v: %w", id, err)
+			return
+		}
+		if !bytes.Equal(got, hash) {
+			visitErr = fmt.Errorf("%w: tile node %v has hash %x, want %x", ErrProofMismatch, id, got, hash)
+		}
+	}
+	rf := &compact.RangeFactory{Hash: o.h.HashChildren}
+	r := rf.NewEmptyRange(0)
+	for i := uint64(0); i < cp.Size; i++ {
+		leaf, err := o.l.GetLeaf(ctx, leafFetch, i, cp.Size)
+		if err != nil {
+			return fmt.Errorf("failed to fetch leaf %d: %w", i, err)
+		}
+		if err := r.Append(o.h.HashLeaf(leaf), visit); err != nil {
+			return fmt.Errorf("failed to append leaf %d: %w", i, err)
+		}
+		if visitErr != nil {
+			return visitErr
+		}
+	}
+	root, err := r.GetRootHash(nil)
+	if err != nil {
+		return fmt.Errorf("failed to calculate root hash: %w", err)
+	}
+	if !bytes.Equal(root, cp.Hash) {
+		return fmt.Errorf("%w: log of size %d has root hash %x, checkpoint has %x", ErrProofMismatch, cp.Size, root, cp.Hash)
+	}
+	return nil
+}
+
+// mirrorRecorder is a Fetcher which records the path and digest of each
+// resource it reads, in the order they were first read.
+type mirrorRecorder struct {
+	f       Fetcher
+	paths   []string
+	digests map[string][sha256.Size]byte
+}
+
+func (m *mirrorRecorder) fetch(ctx context.Context, p string) ([]byte, error) {
+	b, err := m.f(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	d := sha256.Sum256(b)
+	if prev, ok := m.digests[p]; !ok {
+		m.paths = append(m.paths, p)
+		m.digests[p] = d
+	} else if prev != d {
+		return nil, fmt.Errorf("%w: %q changed while being verified", ErrProofMismatch, p)
+	}
+	return b, nil
+}
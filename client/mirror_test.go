@@ -0,0 +1,146 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api/layout"
+)
+
+// memWriteStorage is a WriteStorage which keeps resources in memory.
+type memWriteStorage map[string][]byte
+
+func (m memWriteStorage) Write(_ context.Context, p string, data []byte) error {
+	m[p] = data
+	return nil
+}
+
+func TestMirrorServerless(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	root := t.TempDir()
+
+	cp, err := Mirror(ctx, testLogFetcher, DirWriteStorage{Root: root}, testLogVerifier, testOrigin)
+	if err != nil {
+		t.Fatalf("Mirror: %v", err)
+	}
+
+	mirror := func(_ context.Context, p string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(root, p))
+	}
+	lst, err := NewLogStateTracker(ctx, mirror, h, nil, testLogVerifier, testOrigin, UnilateralConsensus(mirror))
+	if err != nil {
+		t.Fatalf("NewLogStateTracker: %v", err)
+	}
+	if got := lst.LatestConsistent.Size; got != cp.Size {
+		t.Fatalf("mirror has size %d, want %d", got, cp.Size)
+	}
+	for i := uint64(0); i < cp.Size; i++ {
+		if _, _, err := GetVerifiedLeaf(ctx, &lst, i); err != nil {
+			t.Errorf("GetVerifiedLeaf(%d): %v", i, err)
+		}
+	}
+}
+
+func TestMirrorTlogTiles(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	const size = 1000
+	l := newTlogTilesLog(t, h, size)
+	l.files[layout.CheckpointPath] = mustSignCheckpoint(t, testOrigin, size, l.root)
+
+	dst := memWriteStorage{}
+	if _, err := Mirror(ctx, l.Fetcher, dst, testLogVerifier, testOrigin, WithMirrorLayout(TlogTilesLayout{})); err != nil {
+		t.Fatalf("Mirror: %v", err)
+	}
+	if got, want := len(dst), len(l.files); got != want {
+		t.Errorf("mirrored %d resources, want %d", got, want)
+	}
+	for p, b := range l.files {
+		if !bytes.Equal(dst[p], b) {
+			t.Errorf("mirrored %q differs from source", p)
+		}
+	}
+}
+
+func TestMirrorTampered(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	const size = 300
+	l := newTlogTilesLog(t, h, size)
+	l.files[layout.CheckpointPath] = mustSignCheckpoint(t, testOrigin, size, l.root)
+
+	for _, test := range []struct {
+		desc   string
+		tamper func(p string, b []byte) []byte
+	}{
+		{
+			desc: "leaf",
+			tamper: func(p string, b []byte) []byte {
+				if strings.HasPrefix(p, "tile/entries/001") {
+					return bytes.Replace(b, []byte("leaf 299"), []byte("leaf 999"), 1)
+				}
+				return b
+			},
+		}, {
+			desc: "tile",
+			tamper: func(p string, b []byte) []byte {
+				if p == layout.TlogTilePath(0, 1, 44) {
+					b = bytes.Clone(b)
+					b[0] ^= 1
+				}
+				return b
+			},
+		}, {
+			desc: "leaf and tile",
+			tamper: func(p string, b []byte) []byte {
+				if strings.HasPrefix(p, "tile/entries/001") {
+					return bytes.Replace(b, []byte("leaf 299"), []byte("leaf 999"), 1)
+				}
+				if p == layout.TlogTilePath(0, 1, 44) {
+					b = bytes.Clone(b)
+					copy(b[len(b)-32:], h.HashLeaf([]byte("leaf 999")))
+				}
+				return b
+			},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			f := func(ctx context.Context, p string) ([]byte, error) {
+				b, err := l.Fetcher(ctx, p)
+				if err != nil {
+					return nil, err
+				}
+				return test.tamper(p, b), nil
+			}
+			dst := memWriteStorage{}
+			_, err := Mirror(ctx, f, dst, testLogVerifier, testOrigin, WithMirrorLayout(TlogTilesLayout{}))
+			if !errors.Is(err, ErrProofMismatch) {
+				t.Fatalf("Mirror: got err %v, want %v", err, ErrProofMismatch)
+			}
+			if len(dst) > 0 {
+				t.Errorf("Mirror wrote %d resources, want none", len(dst))
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/transparency-dev/merkle/compact"
+)
+
+// DefaultMonitorBatchSize is the number of leaves a Monitor fetches and verifies
+// at a time, unless overridden with WithMonitorBatchSize.
+const DefaultMonitorBatchSize = 256
+
+// PositionStore durably persists the index of the next leaf to be processed by
+// a Monitor, so that a restarted monitor resumes from where it left off.
+type PositionStore interface {
+	// Load returns the most recently stored position.
+	// Implementations MUST return (either directly or wrapped) an
+	// os.ErrNotExist if no position has been stored.
+	Load(ctx context.Context) (uint64, error)
+	// Store persists the provided position, replacing any previously stored one.
+	Store(ctx context.Context, next uint64) error
+}
+
+// FilePositionStore is a PositionStore which keeps the position in a file on the
+// local filesystem.
+type FilePositionStore struct {
+	// Path is the location of the file used to store the position.
+	Path string
+}
+
+// Load returns the position held in the file.
+func (s FilePositionStore) Load(_ context.Context) (uint64, error) {
+	b, err := os.ReadFile(s.Path)
+	if err != nil {
+		return 0, err
+	}
+	next, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid position in %q: %v", s.Path, err)
+	}
+	return next, nil
+}
+
+// Store atomically replaces the contents of the file with next.
+func (s FilePositionStore) Store(ctx context.Context, next uint64) error {
+	return FileCheckpointStore{Path: s.Path}.Store(ctx, []byte(strconv.FormatUint(next, 10)+"\n"))
+}
+
+// LeafFunc is called by a Monitor with the index and contents of each leaf in
+// the log, once it has been verified to be committed to by a checkpoint.
+//
+// Returning an error stops the monitor; the leaf will be passed to the function
+// again when the monitor is next stepped.
+type LeafFunc func(ctx context.Context, index uint64, leaf []byte) error
+
+// Monitor follows a log, fetching every leaf added to it and passing each, in
+// order, to a LeafFunc once it has been verified.
+//
+// Leaves are verified in batches by checking that the compact range covering
+// all previously processed leaves, extended with the batch's leaf hashes and the
+// compact range to the right of the batch, produces the root hash of the
+// tracker's checkpoint. This means each leaf is fetched only once, and no
+// inclusion proofs are needed.
+type Monitor struct {
+	lst       *LogStateTracker
+	fn        LeafFunc
+	store     PositionStore
+	batchSize uint64
+
+	rf *compact.RangeFactory
+	// next is the index of the next leaf to be passed to fn.
+	next uint64
+	// verified is the compact range covering leaves [0, next), or nil if it
+	// needs to be rebuilt from the log's tiles.
+	verified *compact.Range
+}
+
+// MonitorOption is used to configure optional behaviour of a Monitor.
+type MonitorOption func(*Monitor)
+
+// WithPositionStore causes the Monitor to start from the position held in s,
+// and to persist its position to s as leaves are processed.
+//
+// Since the position is persisted after the LeafFunc has been called, a leaf
+// may be passed to the LeafFunc again if the process stops in between.
+func WithPositionStore(s PositionStore) MonitorOption {
+	return func(m *Monitor) {
+		m.store = s
+	}
+}
+
+// WithMonitorBatchSize sets the number of leaves the Monitor fetches and
+// verifies at a time.
+func WithMonitorBatchSize(n int) MonitorOption {
+	return func(m *Monitor) {
+		m.batchSize = uint64(n)
+	}
+}
+
+// WithStartIndex causes the Monitor to start from the leaf at index next, rather
+// than the first leaf in the log, unless a position has already been persisted
+// to a PositionStore provided with WithPositionStore.
+func WithStartIndex(next uint64) MonitorOption {
+	return func(m *Monitor) {
+		m.next = next
+	}
+}
+
+// NewMonitor creates a Monitor which follows the log tracked by lst, passing
+// each leaf to fn.
+//
+// The monitor starts from the first leaf in the log, or the leaf given with
+// WithStartIndex, unless a position has been persisted to a PositionStore
+// provided with WithPositionStore.
+func NewMonitor(ctx context.Context, lst *LogStateTracker, fn LeafFunc, opts ...MonitorOption) (*Monitor, error) {
+	m := &Monitor{
+		lst: lst,
+		fn:  fn,
+		rf:  &compact.RangeFactory{Hash: lst.Hasher.HashChildren},
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	if m.batchSize == 0 {
+		m.batchSize = DefaultMonitorBatchSize
+	}
+	if m.store != nil {
+		next, err := m.store.Load(ctx)
+		switch {
+		case err == nil:
+			m.next = next
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("failed to load position: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// Next returns the index of the next leaf which will be passed to the LeafFunc.
+func (m *Monitor) Next() uint64 {
+	return m.next
+}
+
+// Step updates the tracker to the log's latest checkpoint, and then processes
+// all leaves committed to by it which have not yet been processed.
+func (m *Monitor) Step(ctx context.Context) error {
+	if _, _, _, err := m.lst.Update(ctx); err != nil {
+		return fmt.Errorf("failed to update checkpoint: %w", err)
+	}
+	return m.catchUp(ctx)
+}
+
+// Run calls Step every interval until ctx is done, or an error occurs.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := m.Step(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// catchUp processes all unprocessed leaves committed to by the tracker's
+// current checkpoint.
+func (m *Monitor) catchUp(ctx context.Context) error {
+	st := m.lst.State()
+	pb := st.ProofBuilder
+	size := st.Checkpoint.Size
+	if m.next > size {
+		return fmt.Errorf("monitor position %d is beyond log size %d", m.next, size)
+	}
+	if m.verified == nil {
+		r, err := pb.CompactRange(ctx, 0, m.next)
+		if err != nil {
+			return fmt.Errorf("failed to build compact range for processed leaves: %w", err)
+		}
+		if m.verified, err = m.rf.NewRange(r.Begin(), r.End(), r.Hashes()); err != nil {
+			return err
+		}
+	}
+	for m.next < size {
+		end := min(m.next+m.batchSize, size)
+		leaves, hashes, err := m.fetchBatch(ctx, m.next, end, size)
+		if err != nil {
+			return err
+		}
+		if err := m.verifyBatch(ctx, pb, hashes); err != nil {
+			return err
+		}
+		for i, l := range leaves {
+			if err := m.fn(ctx, m.next, l); err != nil {
+				return errors.Join(fmt.Errorf("leaf %d: %w", m.next, err), m.storePosition(ctx))
+			}
+			if err := m.verified.Append(hashes[i], nil); err != nil {
+				return err
+			}
+			m.next++
+		}
+		if err := m.storePosition(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchBatch fetches the leaves [begin, end) of a log of the given size, along
+// with their leaf hashes.
+func (m *Monitor) fetchBatch(ctx context.Context, begin, end, size uint64) ([][]byte, [][]byte, error) {
+	leaves, err := GetLeaves(ctx, m.lst.Fetcher, m.lst.Layout, begin, end-begin, size, DefaultLeafFetchConcurrency)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		hashes[i] = m.lst.Hasher.HashLeaf(leaf)
+	}
+	return leaves, hashes, nil
+}
+
+// verifyBatch checks that the leaf hashes, which immediately follow the
+// processed leaves, are committed to by pb's checkpoint.
+func (m *Monitor) verifyBatch(ctx context.Context, pb *ProofBuilder, hashes [][]byte) error {
+	begin, end := m.next, m.next+uint64(len(hashes))
+	r, err := m.rf.NewRange(0, begin, append([][]byte{}, m.verified.Hashes()...))
+	if err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		if err := r.Append(h, nil); err != nil {
+			return fmt.Errorf("failed to append leaf hash: %w", err)
+		}
+	}
+	right, err := pb.CompactRange(ctx, end, pb.cp.Size)
+	if err != nil {
+		return fmt.Errorf("failed to build right compact range: %w", err)
+	}
+	right, err = m.rf.NewRange(right.Begin(), right.End(), right.Hashes())
+	if err != nil {
+		return err
+	}
+	if err := r.AppendRange(right, nil); err != nil {
+		return fmt.Errorf("failed to merge compact ranges: %w", err)
+	}
+	root, err := r.GetRootHash(nil)
+	if err != nil {
+		return fmt.Errorf("failed to calculate root hash: %w", err)
+	}
+	if !bytes.Equal(root, pb.cp.Hash) {
+		// The processed range may have been built from bad tiles, so rebuild it next time.
+		m.verified = nil
+		return fmt.Errorf("%w: leaves [%d, %d) produce root hash %x, expected %x", ErrProofMismatch, begin, end, root, pb.cp.Hash)
+	}
+	return nil
+}
+
+// storePosition persists the monitor's position, if a PositionStore is configured.
+func (m *Monitor) storePosition(ctx context.Context) error {
+	if m.store == nil {
+		return nil
+	}
+	if err := m.store.Store(ctx, m.next); err != nil {
+		return fmt.Errorf("failed to store position: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api/layout"
+)
+
+func TestMonitor(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	badLeafPath := filepath.Join(layout.SeqPath("", 6))
+	failAt := uint64(4)
+
+	for _, test := range []struct {
+		desc      string
+		cpRaws    [][]byte
+		start     uint64
+		from      uint64
+		batchSize int
+		badLeaf   bool
+		failOnce  bool
+		wantErr   error
+	}{
+		{
+			desc:      "follow log",
+			cpRaws:    [][]byte{testRawCheckpoints[3], testRawCheckpoints[8], testRawCheckpoints[15]},
+			batchSize: 2,
+		}, {
+			desc:   "resume from stored position",
+			cpRaws: [][]byte{testRawCheckpoints[8], testRawCheckpoints[15]},
+			start:  5,
+		}, {
+			desc:   "start from index",
+			cpRaws: [][]byte{testRawCheckpoints[8], testRawCheckpoints[15]},
+			from:   6,
+		}, {
+			desc:   "stored position overrides start index",
+			cpRaws: [][]byte{testRawCheckpoints[8], testRawCheckpoints[15]},
+			start:  5,
+			from:   2,
+		}, {
+			desc:      "callback fails",
+			cpRaws:    [][]byte{testRawCheckpoints[8], testRawCheckpoints[15]},
+			batchSize: 3,
+			failOnce:  true,
+		}, {
+			desc:    "bad leaf",
+			cpRaws:  [][]byte{testRawCheckpoints[8]},
+			badLeaf: true,
+			wantErr: ErrProofMismatch,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			shim := fetchCheckpointShim{Checkpoints: test.cpRaws}
+			f := shim.Fetcher(func(ctx context.Context, p string) ([]byte, error) {
+				r, err := testLogFetcher(ctx, p)
+				if test.badLeaf && p == badLeafPath {
+					r = append(r, 'x')
+				}
+				return r, err
+			})
+			lst, err := NewLogStateTracker(ctx, f, h, nil, testLogVerifier, testOrigin, UnilateralConsensus(f))
+			if err != nil {
+				t.Fatalf("NewLogStateTracker: %v", err)
+			}
+			ps := FilePositionStore{Path: filepath.Join(t.TempDir(), "position")}
+			if test.start > 0 {
+				if err := ps.Store(ctx, test.start); err != nil {
+					t.Fatalf("Store: %v", err)
+				}
+			}
+
+			seen := make(map[uint64]int)
+			failed := false
+			fn := func(ctx context.Context, i uint64, leaf []byte) error {
+				if test.failOnce && !failed && i == failAt {
+					failed = true
+					return errors.New("banana")
+				}
+				want, err := GetLeaf(ctx, testLogFetcher, i)
+				if err != nil {
+					t.Fatalf("GetLeaf(%d): %v", i, err)
+				}
+				if !bytes.Equal(leaf, want) {
+					t.Errorf("leaf %d: got %q, want %q", i, leaf, want)
+				}
+				seen[i]++
+				return nil
+			}
+			opts := []MonitorOption{WithPositionStore(ps)}
+			if test.batchSize > 0 {
+				opts = append(opts, WithMonitorBatchSize(test.batchSize))
+			}
+			if test.from > 0 {
+				opts = append(opts, WithStartIndex(test.from))
+			}
+			m, err := NewMonitor(ctx, &lst, fn, opts...)
+			if err != nil {
+				t.Fatalf("NewMonitor: %v", err)
+			}
+			start := test.start
+			if start == 0 {
+				start = test.from
+			}
+			if got := m.Next(); got != start {
+				t.Fatalf("got initial position %d, want %d", got, start)
+			}
+
+			for len(shim.Checkpoints) > 0 {
+				err := m.Step(ctx)
+				if test.failOnce && failed && m.Next() == failAt {
+					if err == nil {
+						t.Fatal("Step: got no error from failing callback")
+					}
+					continue
+				}
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("Step: got err %v, want %v", err, test.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				shim.Advance()
+			}
+
+			size := lst.LatestConsistent.Size
+			for i := uint64(0); i < size; i++ {
+				want := 1
+				if i < start {
+					want = 0
+				}
+				if got := seen[i]; got != want {
+					t.Errorf("leaf %d seen %d times, want %d", i, got, want)
+				}
+			}
+			if got := m.Next(); got != size {
+				t.Errorf("got position %d, want %d", got, size)
+			}
+			if got, err := ps.Load(ctx); err != nil || got != size {
+				t.Errorf("got stored position %d (err %v), want %d", got, err, size)
+			}
+		})
+	}
+}
+
+func TestFilePositionStore(t *testing.T) {
+	ctx := context.Background()
+	ps := FilePositionStore{Path: filepath.Join(t.TempDir(), "position")}
+	if _, err := ps.Load(ctx); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Load: got err %v, want %v", err, os.ErrNotExist)
+	}
+	if err := ps.Store(ctx, 42); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if got, err := ps.Load(ctx); err != nil || got != 42 {
+		t.Errorf("Load: got %d, %v, want 42", got, err)
+	}
+	if err := os.WriteFile(ps.Path, []byte("banana"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := ps.Load(ctx); err == nil {
+		t.Error("Load: got no error for corrupt position")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/compact"
+)
+
+// NodeFetcher provides access to the hashes of arbitrary nodes in a log's
+// Merkle tree, read from the log's tiles, e.g. for auditors building their own
+// compact ranges.
+//
+// Only the roots of perfect subtrees which are fully contained within the tree
+// of the given size are stored in tiles, so only those nodes can be fetched.
+//
+// Tiles are cached for the lifetime of the NodeFetcher. It is not safe for
+// concurrent use.
+type NodeFetcher struct {
+	nc          nodeCache
+	logSize     uint64
+	concurrency int
+}
+
+// NewNodeFetcher creates a NodeFetcher for a tree of the given size, whose
+// tiles are fetched with gt, e.g. as returned by Layout.TileFetcher.
+//
+// Up to concurrency tiles will be fetched in parallel, if concurrency is <= 0
+// then DefaultProofFetchConcurrency is used.
+func NewNodeFetcher(gt GetTileFunc, logSize uint64, concurrency int) *NodeFetcher {
+	if concurrency <= 0 {
+		concurrency = DefaultProofFetchConcurrency
+	}
+	return &NodeFetcher{
+		nc:          newNodeCache(gt, logSize),
+		logSize:     logSize,
+		concurrency: concurrency,
+	}
+}
+
+// Node returns the hash of the node with the given ID.
+func (n *NodeFetcher) Node(ctx context.Context, id compact.NodeID) ([]byte, error) {
+	if err := n.checkNode(id); err != nil {
+		return nil, err
+	}
+	return n.nc.GetNode(ctx, id)
+}
+
+// Nodes returns the hashes of the nodes with the given IDs, in the same order.
+// Any tiles which need to be fetched are fetched in parallel.
+func (n *NodeFetcher) Nodes(ctx context.Context, ids []compact.NodeID) ([][]byte, error) {
+	for _, id := range ids {
+		if err := n.checkNode(id); err != nil {
+			return nil, err
+		}
+	}
+	if err := n.nc.prefetch(ctx, ids, n.concurrency); err != nil {
+		return nil, err
+	}
+	ret := make([][]byte, len(ids))
+	for i, id := range ids {
+		h, err := n.nc.GetNode(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = h
+	}
+	return ret, nil
+}
+
+// RangeNodes returns the hashes of the nodes which make up the compact range
+// covering leaves [begin, end), ordered left to right.
+//
+// The result may be passed to compact.RangeFactory.NewRange.
+func (n *NodeFetcher) RangeNodes(ctx context.Context, begin, end uint64) ([][]byte, error) {
+	if begin > end || end > n.logSize {
+		return nil, fmt.Errorf("invalid range [%d, %d) for log size %d", begin, end, n.logSize)
+	}
+	return n.Nodes(ctx, compact.RangeNodes(begin, end, nil))
+}
+
+// VerifyLeaves checks that the consecutive leaves, the first of which is at
+// index first, hash to the leaf hashes stored in the log's tiles, returning an
+// error wrapping ErrProofMismatch if any do not.
+//
+// This detects corrupted or modified leaf bundles without the cost of building
+// inclusion proofs. Note that it only checks the leaves against the tiles, so
+// callers must separately establish that the tiles are committed to by a
+// trusted checkpoint, e.g. with ProofBuilder.VerifyLeafHashes or by verifying
+// the tree with a NodeFetcher for a checkpoint's size.
+func (n *NodeFetcher) VerifyLeaves(ctx context.Context, h merkle.LogHasher, first uint64, leaves [][]byte) error {
+	ids := make([]compact.NodeID, len(leaves))
+	for i := range leaves {
+		ids[i] = compact.NewNodeID(0, first+uint64(i))
+	}
+	hashes, err := n.Nodes(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i, l := range leaves {
+		if got := h.HashLeaf(l); !bytes.Equal(got, hashes[i]) {
+			return fmt.Errorf("%w: leaf %d has hash %x, tile has %x", ErrProofMismatch, first+uint64(i), got, hashes[i])
+		}
+	}
+	return nil
+}
+
+// checkNode returns an error if the node with the given ID is not the root of a
+// perfect subtree within the tree.
+func (n *NodeFetcher) checkNode(id compact.NodeID) error {
+	if id.Level >= 64 || id.Index >= n.logSize>>id.Level {
+		return fmt.Errorf("node %v is not within a perfect subtree of log size %d", id, n.logSize)
+	}
+	return nil
+}
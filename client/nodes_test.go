@@ -0,0 +1,166 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestNodeFetcher(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	const size = 700
+	tl := newTlogTilesLog(t, h, size)
+	rf := &compact.RangeFactory{Hash: h.HashChildren}
+
+	// Build the expected compact ranges directly from the leaf hashes.
+	want := func(begin, end uint64) *compact.Range {
+		r := rf.NewEmptyRange(begin)
+		for _, l := range tl.leaves[begin:end] {
+			if err := r.Append(h.HashLeaf(l), nil); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+		}
+		return r
+	}
+
+	nf := NewNodeFetcher(TlogTilesLayout{}.TileFetcher(tl.Fetcher, h.HashChildren, size), size, 0)
+	for _, test := range []struct {
+		begin, end uint64
+		wantErr    bool
+	}{
+		{begin: 0, end: size},
+		{begin: 3, end: 517},
+		{begin: 256, end: 512},
+		{begin: 10, end: 10},
+		{begin: 10, end: size + 1, wantErr: true},
+		{begin: 11, end: 10, wantErr: true},
+	} {
+		got, err := nf.RangeNodes(ctx, test.begin, test.end)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Fatalf("RangeNodes(%d, %d): got err %v, wantErr %t", test.begin, test.end, err, test.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		w := want(test.begin, test.end).Hashes()
+		if len(got) != len(w) {
+			t.Fatalf("RangeNodes(%d, %d): got %d hashes, want %d", test.begin, test.end, len(got), len(w))
+		}
+		for i := range w {
+			if !bytes.Equal(got[i], w[i]) {
+				t.Errorf("RangeNodes(%d, %d): hash %d = %x, want %x", test.begin, test.end, i, got[i], w[i])
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		id      compact.NodeID
+		wantErr bool
+	}{
+		{id: compact.NewNodeID(0, 699)},
+		{id: compact.NewNodeID(9, 0)},
+		{id: compact.NewNodeID(2, 174)},
+		{id: compact.NewNodeID(0, 700), wantErr: true},
+		{id: compact.NewNodeID(2, 175), wantErr: true},
+		{id: compact.NewNodeID(10, 0), wantErr: true},
+	} {
+		got, err := nf.Node(ctx, test.id)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Fatalf("Node(%v): got err %v, wantErr %t", test.id, err, test.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		begin, end := test.id.Coverage()
+		r, err := rf.NewRange(begin, end, [][]byte{got})
+		if err != nil {
+			t.Fatalf("NewRange: %v", err)
+		}
+		if !r.Equal(want(begin, end)) {
+			t.Errorf("Node(%v): got %x, want %x", test.id, got, want(begin, end).Hashes())
+		}
+	}
+}
+
+func TestNodeFetcherVerifyLeaves(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	const size = 300
+	tl := newTlogTilesLog(t, h, size)
+	nf := NewNodeFetcher(TlogTilesLayout{}.TileFetcher(tl.Fetcher, h.HashChildren, size), size, 0)
+
+	// Entry bundle 1 is a partial bundle holding leaves [256, 300).
+	bundle, err := TlogTilesLayout{}.GetEntryBundle(ctx, tl.Fetcher, 1, size)
+	if err != nil {
+		t.Fatalf("GetEntryBundle: %v", err)
+	}
+	if got, want := len(bundle), size-256; got != want {
+		t.Fatalf("got %d entries, want %d", got, want)
+	}
+	tampered := append([][]byte{}, bundle...)
+	tampered[10] = []byte("banana")
+
+	for _, test := range []struct {
+		desc         string
+		first        uint64
+		leaves       [][]byte
+		wantMismatch bool
+		wantErr      bool
+	}{
+		{
+			desc:   "bundle",
+			first:  256,
+			leaves: bundle,
+		}, {
+			desc:   "first bundle",
+			first:  0,
+			leaves: tl.leaves[:256],
+		}, {
+			desc:         "tampered",
+			first:        256,
+			leaves:       tampered,
+			wantErr:      true,
+			wantMismatch: true,
+		}, {
+			desc:         "wrong position",
+			first:        255,
+			leaves:       bundle,
+			wantErr:      true,
+			wantMismatch: true,
+		}, {
+			desc:    "beyond log",
+			first:   257,
+			leaves:  bundle,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			err := nf.VerifyLeaves(ctx, h, test.first, test.leaves)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("VerifyLeaves: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if got := errors.Is(err, ErrProofMismatch); got != test.wantMismatch {
+				t.Errorf("got ErrProofMismatch %t, want %t (err: %v)", got, test.wantMismatch, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"golang.org/x/mod/sumdb/note"
+	"gopkg.in/yaml.v3"
+)
+
+// WitnessConfig holds the set of trusted witnesses, and the policy which
+// checkpoints must satisfy with their cosignatures.
+type WitnessConfig struct {
+	// Policy is the quorum rule which checkpoints must satisfy.
+	Policy WitnessPolicy
+	// Witnesses are the verifiers for the trusted witness keys.
+	Witnesses []note.Verifier
+}
+
+// witnessConfigYAML is the YAML encoding of a WitnessConfig.
+type witnessConfigYAML struct {
+	Quorum    int              `yaml:"quorum"`
+	Witnesses []witnessKeyYAML `yaml:"witnesses"`
+}
+
+// witnessKeyYAML is the YAML encoding of a witness key, either as a string or,
+// as in the integrate tool's witness configuration, as a mapping with a key
+// field. Any other fields of the mapping are ignored.
+type witnessKeyYAML string
+
+func (k *witnessKeyYAML) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.MappingNode {
+		var m struct {
+			Key string `yaml:"key"`
+		}
+		if err := n.Decode(&m); err != nil {
+			return err
+		}
+		*k = witnessKeyYAML(m.Key)
+		return nil
+	}
+	var s string
+	if err := n.Decode(&s); err != nil {
+		return err
+	}
+	*k = witnessKeyYAML(s)
+	return nil
+}
+
+// NewWitnessConfig creates a WitnessConfig which requires cosignatures from
+// at least quorum of the witnesses described by the provided verifier keys.
+//
+// See NewWitnessVerifier for the supported key formats.
+func NewWitnessConfig(quorum int, vkeys ...string) (*WitnessConfig, error) {
+	if quorum < 0 {
+		return nil, fmt.Errorf("invalid quorum %d", quorum)
+	}
+	if quorum > len(vkeys) {
+		return nil, fmt.Errorf("quorum of %d witnesses requested, but only %d witnesses configured", quorum, len(vkeys))
+	}
+	c := &WitnessConfig{
+		Policy:    WitnessPolicy{Quorum: quorum},
+		Witnesses: make([]note.Verifier, 0, len(vkeys)),
+	}
+	seen := make(map[string]bool)
+	for _, k := range vkeys {
+		v, err := NewWitnessVerifier(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid witness key %q: %v", k, err)
+		}
+		id := fmt.Sprintf("%s+%08x", v.Name(), v.KeyHash())
+		if seen[id] {
+			return nil, fmt.Errorf("duplicate witness key %q", id)
+		}
+		seen[id] = true
+		c.Witnesses = append(c.Witnesses, v)
+	}
+	return c, nil
+}
+
+// ParseWitnessConfig parses and validates a YAML encoded witness policy, e.g.:
+//
+//	quorum: 2
+//	witnesses:
+//	  - witness1.example.com+01234567+AaBbCc...
+//	  - witness2.example.com+89abcdef+AaBbCc...
+//	  - witness3.example.com+fedcba98+AaBbCc...
+//
+// Witnesses may also be given as mappings with a key field, so that the
+// integrate tool's witness configuration can be used as a policy:
+//
+//	quorum: 1
+//	witnesses:
+//	  - url: https://witness1.example.com/
+//	    key: witness1.example.com+01234567+AaBbCc...
+func ParseWitnessConfig(b []byte) (*WitnessConfig, error) {
+	var y witnessConfigYAML
+	if err := yaml.Unmarshal(b, &y); err != nil {
+		return nil, fmt.Errorf("failed to parse witness policy: %v", err)
+	}
+	vkeys := make([]string, 0, len(y.Witnesses))
+	for _, w := range y.Witnesses {
+		vkeys = append(vkeys, string(w))
+	}
+	return NewWitnessConfig(y.Quorum, vkeys...)
+}
+
+// NewWitnessVerifier returns a note.Verifier for the witness key described by
+// vkey, which may be either a cosignature/v1 key or a plain Ed25519 note key.
+func NewWitnessVerifier(vkey string) (note.Verifier, error) {
+	if v, err := NewCosignatureV1Verifier(vkey); err == nil {
+		return v, nil
+	}
+	return note.NewVerifier(vkey)
+}
+
+// Consensus returns a ConsensusCheckpointFunc which fetches the log's
+// checkpoint via f, and only returns it if it satisfies the policy.
+func (c *WitnessConfig) Consensus(f Fetcher) (ConsensusCheckpointFunc, error) {
+	if c.Policy.Quorum == 0 {
+		return UnilateralConsensus(f), nil
+	}
+	return WitnessConsensus(f, c.Policy, c.Witnesses...)
+}
+
+// VerifyCheckpoint parses cpRaw, which must be signed by logSigV and commit to
+// the given origin, and returns an error if it does not satisfy the policy.
+func (c *WitnessConfig) VerifyCheckpoint(cpRaw []byte, origin string, logSigV note.Verifier) (*log.Checkpoint, *note.Note, error) {
+	cp, _, n, err := parseCheckpoint(layout.CheckpointPath, cpRaw, origin, logSigV, c.Witnesses...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.Policy.Check(n, c.Witnesses...); err != nil {
+		return nil, nil, err
+	}
+	return cp, n, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestParseWitnessConfig(t *testing.T) {
+	_, wit1VKey := genCosigKeyPair(t, "w1", time.Now())
+	_, wit2VKey := genCosigKeyPair(t, "w2", time.Now())
+	_, wit3VKey, err := note.GenerateKey(nil, "w3")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc          string
+		config        string
+		wantQuorum    int
+		wantWitnesses int
+		wantErr       bool
+	}{
+		{
+			desc:          "valid",
+			config:        fmt.Sprintf("quorum: 2\nwitnesses:\n  - %s\n  - %s\n  - %s\n", wit1VKey, wit2VKey, wit3VKey),
+			wantQuorum:    2,
+			wantWitnesses: 3,
+		}, {
+			desc:          "witness mappings",
+			config:        fmt.Sprintf("quorum: 1\nwitnesses:\n  - url: https://w1.example.com/\n    key: %s\n  - key: %s\n", wit1VKey, wit3VKey),
+			wantQuorum:    1,
+			wantWitnesses: 2,
+		}, {
+			desc:          "no witnesses",
+			config:        "quorum: 0",
+			wantQuorum:    0,
+			wantWitnesses: 0,
+		}, {
+			desc:    "quorum too large",
+			config:  fmt.Sprintf("quorum: 2\nwitnesses:\n  - %s\n", wit1VKey),
+			wantErr: true,
+		}, {
+			desc:    "negative quorum",
+			config:  fmt.Sprintf("quorum: -1\nwitnesses:\n  - %s\n", wit1VKey),
+			wantErr: true,
+		}, {
+			desc:    "duplicate witness",
+			config:  fmt.Sprintf("quorum: 1\nwitnesses:\n  - %s\n  - %s\n", wit1VKey, wit1VKey),
+			wantErr: true,
+		}, {
+			desc:    "bad key",
+			config:  "quorum: 1\nwitnesses:\n  - banana\n",
+			wantErr: true,
+		}, {
+			desc:    "witness mapping without key",
+			config:  "quorum: 1\nwitnesses:\n  - url: https://w1.example.com/\n",
+			wantErr: true,
+		}, {
+			desc:    "not yaml",
+			config:  "quorum: [",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			c, err := ParseWitnessConfig([]byte(test.config))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseWitnessConfig: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := c.Policy.Quorum; got != test.wantQuorum {
+				t.Errorf("got quorum %d, want %d", got, test.wantQuorum)
+			}
+			if got := len(c.Witnesses); got != test.wantWitnesses {
+				t.Errorf("got %d witnesses, want %d", got, test.wantWitnesses)
+			}
+		})
+	}
+}
+
+func TestWitnessConfigVerify(t *testing.T) {
+	ctx := context.Background()
+	logS, logV := genKeyPair(t, "log")
+	wit1S, wit1VKey := genCosigKeyPair(t, "w1", time.Now())
+	wit2S, wit2VKey := genCosigKeyPair(t, "w2", time.Now())
+	c, err := NewWitnessConfig(2, wit1VKey, wit2VKey)
+	if err != nil {
+		t.Fatalf("NewWitnessConfig: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc    string
+		cp      []byte
+		wantErr bool
+	}{
+		{
+			desc: "quorum met",
+			cp:   signTestCP(t, 10, logS, wit1S, wit2S),
+		}, {
+			desc:    "quorum not met",
+			cp:      signTestCP(t, 10, logS, wit1S),
+			wantErr: true,
+		}, {
+			desc:    "no log signature",
+			cp:      signTestCP(t, 10, wit1S, wit2S),
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, _, err := c.VerifyCheckpoint(test.cp, testOrigin, logV)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("VerifyCheckpoint: got err %v, wantErr %t", err, test.wantErr)
+			}
+
+			cons, err := c.Consensus(func(_ context.Context, p string) ([]byte, error) {
+				if p != layout.CheckpointPath {
+					t.Fatalf("unexpected fetch of %q", p)
+				}
+				return test.cp, nil
+			})
+			if err != nil {
+				t.Fatalf("Consensus: %v", err)
+			}
+			_, _, _, err = cons(ctx, logV, testOrigin)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("consensus: got err %v, wantErr %t", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// LeafPrefetcher reads leaves from a log, speculatively fetching the leaves
+// following the one most recently requested so that callers reading the log
+// sequentially (e.g. monitors tailing it) don't pay the storage latency for
+// each leaf.
+//
+// If the caller requests a leaf other than the one following the previous
+// request, outstanding prefetches are cancelled and lookahead restarts from
+// the newly requested leaf.
+//
+// LeafPrefetcher is safe for concurrent use, although interleaved sequential
+// readers will defeat the lookahead.
+type LeafPrefetcher struct {
+	f         Fetcher
+	lookahead uint64
+
+	mu sync.Mutex
+	// next is the index of the leaf we expect to be asked for next.
+	next uint64
+	// window holds the in-flight or completed fetches for leaves >= next-1.
+	window map[uint64]*prefetchedLeaf
+	// ctx is used for all fetches in window. Prefetches must outlive the
+	// request which triggered them, so this is only cancelled when the
+	// window is reset.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// prefetchedLeaf represents a possibly in-flight leaf fetch.
+type prefetchedLeaf struct {
+	// done is closed once the fetch has completed.
+	done chan struct{}
+	leaf []byte
+	err  error
+}
+
+// NewLeafPrefetcher creates a LeafPrefetcher which will keep up to lookahead
+// leaves in flight ahead of the most recently requested one.
+func NewLeafPrefetcher(f Fetcher, lookahead uint) *LeafPrefetcher {
+	p := &LeafPrefetcher{
+		f:         f,
+		lookahead: uint64(lookahead),
+		cancel:    func() {},
+	}
+	p.resetLocked()
+	return p
+}
+
+// GetLeaf returns the raw contents of the leaf at index i.
+//
+// logSize is the size of the log the caller is working with, and bounds the
+// leaves which will be prefetched.
+func (p *LeafPrefetcher) GetLeaf(ctx context.Context, i, logSize uint64) ([]byte, error) {
+	p.mu.Lock()
+	if _, ok := p.window[i]; i != p.next || !ok {
+		// Access pattern has changed, throw away any speculative work.
+		p.resetLocked()
+	}
+	for j := i; j <= i+p.lookahead && j < logSize; j++ {
+		p.fetchLocked(j)
+	}
+	pf := p.window[i]
+	if pf == nil {
+		// i is beyond logSize, so wasn't prefetched above; fetch it anyway and
+		// let the log decide whether it exists.
+		pf = p.fetchLocked(i)
+	}
+	for k := range p.window {
+		if k < i {
+			delete(p.window, k)
+		}
+	}
+	p.next = i + 1
+	p.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-pf.done:
+		return pf.leaf, pf.err
+	}
+}
+
+// Close cancels any outstanding prefetches.
+func (p *LeafPrefetcher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resetLocked()
+}
+
+// resetLocked cancels and forgets all prefetched leaves.
+// Must be called with p.mu held.
+func (p *LeafPrefetcher) resetLocked() {
+	p.cancel()
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.window = make(map[uint64]*prefetchedLeaf)
+}
+
+// fetchLocked starts a fetch for leaf i, if one isn't already in the window.
+// Must be called with p.mu held.
+func (p *LeafPrefetcher) fetchLocked(i uint64) *prefetchedLeaf {
+	if pf, ok := p.window[i]; ok {
+		return pf
+	}
+	pf := &prefetchedLeaf{done: make(chan struct{})}
+	p.window[i] = pf
+	ctx := p.ctx
+	go func() {
+		defer close(pf.done)
+		pf.leaf, pf.err = GetLeaf(ctx, p.f, i)
+	}()
+	return pf
+}
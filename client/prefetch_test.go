@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+)
+
+// countingFetcher wraps a Fetcher and records how many times each path was requested.
+type countingFetcher struct {
+	sync.Mutex
+	f     Fetcher
+	count map[string]int
+}
+
+func newCountingFetcher(f Fetcher) *countingFetcher {
+	return &countingFetcher{f: f, count: make(map[string]int)}
+}
+
+func (c *countingFetcher) Fetch(ctx context.Context, p string) ([]byte, error) {
+	c.Lock()
+	c.count[p]++
+	c.Unlock()
+	return c.f(ctx, p)
+}
+
+func (c *countingFetcher) total() int {
+	c.Lock()
+	defer c.Unlock()
+	t := 0
+	for _, n := range c.count {
+		t += n
+	}
+	return t
+}
+
+func TestLeafPrefetcher(t *testing.T) {
+	ctx := context.Background()
+	const logSize = 15
+	cf := newCountingFetcher(testLogFetcher)
+	p := NewLeafPrefetcher(cf.Fetch, 4)
+	defer p.Close()
+
+	check := func(i uint64) {
+		t.Helper()
+		got, err := p.GetLeaf(ctx, i, logSize)
+		if err != nil {
+			t.Fatalf("GetLeaf(%d): %v", i, err)
+		}
+		want, err := GetLeaf(ctx, testLogFetcher, i)
+		if err != nil {
+			t.Fatalf("GetLeaf(%d): %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("GetLeaf(%d) = %q, want %q", i, got, want)
+		}
+	}
+
+	// A sequential pass should fetch each leaf exactly once.
+	for i := uint64(0); i < logSize; i++ {
+		check(i)
+	}
+	if got, want := cf.total(), logSize; got != want {
+		t.Errorf("got %d fetches, want %d", got, want)
+	}
+
+	// Jumping around should still return the right leaves.
+	for _, i := range []uint64{2, 3, 4, 10, 1, 14} {
+		check(i)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// PublishMetrics is an optional hook which may be provided to a Publisher in
+// order to observe the outcome of each publication.
+//
+// Implementations must be safe for concurrent use.
+type PublishMetrics interface {
+	// CheckpointPublished is called once publication of a checkpoint to the
+	// distributor has finished. attempts is the number of requests which were
+	// made, and err is the final error, if any.
+	CheckpointPublished(distributor string, attempts int, d time.Duration, err error)
+}
+
+// Publisher pushes a log's checkpoints to distributors, so that they can be
+// discovered by monitors and clients without polling the log itself.
+//
+// Checkpoints are sent as the body of a POST request to
+// <distributor>/logs/<logID>/checkpoint, alongside the checkpoint.N files
+// which distributors serve to clients, see witness.DistributorConsensus.
+// Distributors are expected to respond with a 2xx status once the checkpoint
+// has been accepted.
+//
+// A Publisher is safe for concurrent use.
+type Publisher struct {
+	distributors []*url.URL
+	hc           *http.Client
+	retry        RetryOpts
+	metrics      PublishMetrics
+}
+
+// PublisherOption is used to configure optional behaviour of a Publisher.
+type PublisherOption func(*Publisher)
+
+// WithPublisherHTTPClient causes the Publisher to make requests using hc
+// rather than http.DefaultClient.
+func WithPublisherHTTPClient(hc *http.Client) PublisherOption {
+	return func(p *Publisher) {
+		p.hc = hc
+	}
+}
+
+// WithPublishRetry configures how the Publisher retries failed requests. If
+// ShouldRetry is unset, errors are classified with IsRetryable.
+func WithPublishRetry(opts RetryOpts) PublisherOption {
+	return func(p *Publisher) {
+		p.retry = opts
+	}
+}
+
+// WithPublishMetrics causes the Publisher to report the outcome of each
+// publication to m.
+func WithPublishMetrics(m PublishMetrics) PublisherOption {
+	return func(p *Publisher) {
+		p.metrics = m
+	}
+}
+
+// NewPublisher creates a Publisher which pushes checkpoints to the
+// distributors with the given root URLs.
+func NewPublisher(distributors []*url.URL, opts ...PublisherOption) *Publisher {
+	p := &Publisher{
+		distributors: distributors,
+		hc:           http.DefaultClient,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	p.retry = p.retry.withDefaults()
+	return p
+}
+
+// Publish sends the checkpoint cpRaw for the log with the given distributor
+// log ID, see log.ID, to each of the distributors in parallel, retrying failed
+// requests with exponential backoff.
+//
+// An error describing each distributor which did not accept the checkpoint is
+// returned.
+func (p *Publisher) Publish(ctx context.Context, logID string, cpRaw []byte) error {
+	errs := make([]error, len(p.distributors))
+	var wg sync.WaitGroup
+	for i, d := range p.distributors {
+		wg.Add(1)
+		go func(i int, d *url.URL) {
+			defer wg.Done()
+			start := time.Now()
+			attempts, err := p.publishWithRetry(ctx, d.JoinPath("logs", logID, "checkpoint"), cpRaw)
+			if p.metrics != nil {
+				p.metrics.CheckpointPublished(d.String(), attempts, time.Since(start), err)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("distributor %q: %w", d, err)
+			}
+		}(i, d)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// publishWithRetry sends cpRaw to u until it's accepted, or the retry policy
+// is exhausted, and returns the number of attempts made.
+func (p *Publisher) publishWithRetry(ctx context.Context, u *url.URL, cpRaw []byte) (int, error) {
+	o := p.retry
+	backoff := o.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := p.publish(ctx, u, cpRaw)
+		if err == nil {
+			return attempt, nil
+		}
+		if attempt >= o.MaxAttempts || !o.ShouldRetry(err) {
+			return attempt, err
+		}
+		d := o.jitter(backoff)
+		klog.V(2).Infof("Publishing to %q failed (attempt %d/%d), retrying in %v: %v", u, attempt, o.MaxAttempts, d, err)
+		select {
+		case <-ctx.Done():
+			return attempt, fmt.Errorf("gave up retrying publication: %w (last error: %v)", ctx.Err(), err)
+		case <-time.After(d):
+		}
+		backoff = time.Duration(float64(backoff) * o.Multiplier)
+		if backoff > o.MaxBackoff {
+			backoff = o.MaxBackoff
+		}
+	}
+}
+
+// publish makes a single attempt to send cpRaw to u.
+func (p *Publisher) publish(ctx context.Context, u *url.URL, cpRaw []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(cpRaw))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to publish checkpoint: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return HTTPStatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
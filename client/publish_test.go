@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// publishRecorder is a PublishMetrics which records the attempts reported for
+// each distributor.
+type publishRecorder struct {
+	mu       sync.Mutex
+	attempts map[string]int
+	failed   map[string]bool
+}
+
+func (r *publishRecorder) CheckpointPublished(d string, attempts int, _ time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts[d] = attempts
+	r.failed[d] = err != nil
+}
+
+func TestPublish(t *testing.T) {
+	for _, test := range []struct {
+		desc         string
+		statuses     []int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			desc:         "accepted",
+			statuses:     []int{http.StatusOK},
+			wantAttempts: 1,
+		}, {
+			desc:         "retries transient failures",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent},
+			wantAttempts: 3,
+		}, {
+			desc:         "gives up after max attempts",
+			statuses:     []int{http.StatusServiceUnavailable},
+			wantAttempts: 3,
+			wantErr:      true,
+		}, {
+			desc:         "does not retry bad request",
+			statuses:     []int{http.StatusBadRequest},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var attempts atomic.Int32
+			failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(attempts.Add(1)) - 1
+				if r.Method != http.MethodPost {
+					t.Errorf("got method %s, want POST", r.Method)
+				}
+				if got, want := r.URL.Path, "/d/logs/logid/checkpoint"; got != want {
+					t.Errorf("got path %q, want %q", got, want)
+				}
+				if b, _ := io.ReadAll(r.Body); string(b) != "checkpoint" {
+					t.Errorf("got body %q, want %q", b, "checkpoint")
+				}
+				w.WriteHeader(test.statuses[min(n, len(test.statuses)-1)])
+			}))
+			defer failing.Close()
+			ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer ok.Close()
+			failingURL, _ := url.Parse(failing.URL + "/d/")
+			okURL, _ := url.Parse(ok.URL)
+
+			m := &publishRecorder{attempts: make(map[string]int), failed: make(map[string]bool)}
+			p := NewPublisher([]*url.URL{failingURL, okURL}, WithPublishRetry(fastRetry), WithPublishMetrics(m))
+			err := p.Publish(context.Background(), "logid", []byte("checkpoint"))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Publish: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if got := m.attempts[failingURL.String()]; got != test.wantAttempts {
+				t.Errorf("reported %d attempts, want %d", got, test.wantAttempts)
+			}
+			if got := m.failed[failingURL.String()]; got != test.wantErr {
+				t.Errorf("reported failure %t, want %t", got, test.wantErr)
+			}
+			if m.attempts[okURL.String()] != 1 || m.failed[okURL.String()] {
+				t.Errorf("got %d attempts, failure %t for working distributor, want 1, false", m.attempts[okURL.String()], m.failed[okURL.String()])
+			}
+		})
+	}
+}
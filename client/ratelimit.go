@@ -0,0 +1,59 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimiter is implemented by types which can throttle operations.
+// *rate.Limiter from golang.org/x/time/rate satisfies this interface.
+type RateLimiter interface {
+	// Wait blocks until an operation may proceed, or ctx is done.
+	Wait(ctx context.Context) error
+}
+
+// NewRateLimiter returns a RateLimiter which allows qps operations per second
+// on average, with bursts of up to burst operations.
+func NewRateLimiter(qps float64, burst int) RateLimiter {
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}
+
+// RateLimitedFetcher returns a Fetcher which waits for permission from l before
+// each call to f.
+//
+// The same RateLimiter may be shared across several Fetchers in order to bound
+// the total load placed on a log by an application.
+func RateLimitedFetcher(f Fetcher, l RateLimiter) Fetcher {
+	if l == nil {
+		return f
+	}
+	return func(ctx context.Context, path string) ([]byte, error) {
+		if err := l.Wait(ctx); err != nil {
+			return nil, err
+		}
+		return f(ctx, path)
+	}
+}
+
+// WithRateLimiter causes the ProofBuilder to wait for permission from l before
+// each fetch it makes.
+func WithRateLimiter(l RateLimiter) ProofBuilderOption {
+	return func(pb *ProofBuilder) {
+		pb.rateLimiter = l
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// countingLimiter is a RateLimiter which never blocks, but counts the number of
+// times it's been consulted.
+type countingLimiter struct {
+	waits atomic.Int64
+	err   error
+}
+
+func (l *countingLimiter) Wait(_ context.Context) error {
+	l.waits.Add(1)
+	return l.err
+}
+
+func TestRateLimitedFetcher(t *testing.T) {
+	ctx := context.Background()
+	l := &countingLimiter{}
+	cf := newCountingFetcher(testLogFetcher)
+	f := RateLimitedFetcher(cf.Fetch, l)
+	for i := uint64(0); i < 5; i++ {
+		if _, err := GetLeaf(ctx, f, i); err != nil {
+			t.Fatalf("GetLeaf(%d): %v", i, err)
+		}
+	}
+	if got, want := l.waits.Load(), int64(5); got != want {
+		t.Errorf("limiter consulted %d times, want %d", got, want)
+	}
+
+	l.err = errors.New("slow down")
+	if _, err := GetLeaf(ctx, f, 0); !errors.Is(err, l.err) {
+		t.Errorf("GetLeaf with failing limiter: got err %v, want %v", err, l.err)
+	}
+	if got, want := cf.total(), 5; got != want {
+		t.Errorf("got %d fetches, want %d", got, want)
+	}
+}
+
+func TestProofBuilderRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := &countingLimiter{}
+	pb, err := NewProofBuilder(ctx, testCheckpoints[11], rfc6962.DefaultHasher.HashChildren, testLogFetcher, WithRateLimiter(l))
+	if err != nil {
+		t.Fatalf("NewProofBuilder: %v", err)
+	}
+	if _, err := pb.InclusionProof(ctx, 3); err != nil {
+		t.Fatalf("InclusionProof: %v", err)
+	}
+	if l.waits.Load() == 0 {
+		t.Error("limiter was never consulted")
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	l := NewRateLimiter(1, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := l.Wait(ctx); err != nil {
+		t.Fatalf("first Wait: %v", err)
+	}
+	cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Error("Wait with cancelled context and no tokens: got no error, want error")
+	}
+}
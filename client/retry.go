@@ -0,0 +1,191 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// RetryOpts configures the behaviour of a Fetcher returned by RetryFetcher.
+//
+// Zero valued fields are replaced with the corresponding value from
+// DefaultRetryOpts.
+type RetryOpts struct {
+	// MaxAttempts is the total number of attempts which will be made to fetch
+	// a single resource, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the time to wait before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the time to wait between any two attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the backoff grows after each retry.
+	Multiplier float64
+	// Jitter is the fraction, in the range [0, 1], of each backoff which is
+	// randomised in order to avoid many clients retrying in lockstep. Set it
+	// to NoJitter to wait for exactly the backoff.
+	Jitter float64
+	// ShouldRetry is called with each error returned by the wrapped Fetcher,
+	// and returns true if the fetch should be attempted again.
+	ShouldRetry func(error) bool
+	// Budget, if set, limits the retries made across every fetch which uses
+	// it, so that a client fetching many resources from an unhealthy log
+	// doesn't make up to MaxAttempts requests for each of them. If unset,
+	// only the attempts made to fetch each resource are limited.
+	Budget *RetryBudget
+}
+
+// RetryBudget is a token bucket which limits the number of retries made by the
+// fetches which share it. Each retry spends a token, and each successful fetch
+// returns a fraction of one, so retries are permitted while most fetches
+// succeed but stop once the log becomes unhealthy.
+// It is safe for concurrent use.
+type RetryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	max    float64
+	refill float64
+}
+
+// NewRetryBudget returns a RetryBudget which allows up to retries retries, and
+// regains refill retries for each successful fetch, up to retries.
+func NewRetryBudget(retries int, refill float64) *RetryBudget {
+	return &RetryBudget{tokens: float64(retries), max: float64(retries), refill: refill}
+}
+
+// spend takes a token from the budget, and returns false if there are none.
+func (b *RetryBudget) spend() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// succeeded returns part of a token to the budget after a successful fetch.
+func (b *RetryBudget) succeeded() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.refill, b.max)
+}
+
+// NoJitter may be used as RetryOpts.Jitter to disable jitter, since a zero
+// value is replaced with the default.
+const NoJitter = -1
+
+// DefaultRetryOpts holds the retry configuration used for any fields left unset
+// in the RetryOpts passed to RetryFetcher.
+var DefaultRetryOpts = RetryOpts{
+	MaxAttempts:    5,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+	ShouldRetry:    DefaultShouldRetry,
+}
+
+// DefaultShouldRetry is the error classification used by RetryFetcher when no
+// ShouldRetry func is configured.
+//
+// It retries errors classified as retryable by IsRetryable.
+func DefaultShouldRetry(err error) bool {
+	return IsRetryable(err)
+}
+
+// RetryFetcher returns a Fetcher which delegates to f, retrying failed fetches
+// with exponential backoff according to the provided options.
+//
+// The same RetryBudget may be shared across several Fetchers in order to bound
+// the total number of retries made by an application.
+//
+// The returned error, if any, is the error returned by the final attempt.
+func RetryFetcher(f Fetcher, opts RetryOpts) Fetcher {
+	o := opts.withDefaults()
+	return func(ctx context.Context, path string) ([]byte, error) {
+		backoff := o.InitialBackoff
+		for attempt := 1; ; attempt++ {
+			r, err := f(ctx, path)
+			if err == nil {
+				o.Budget.succeeded()
+				return r, nil
+			}
+			if attempt >= o.MaxAttempts || !o.ShouldRetry(err) {
+				return nil, err
+			}
+			if !o.Budget.spend() {
+				klog.V(2).Infof("Fetch %q failed (attempt %d/%d), retry budget exhausted: %v", path, attempt, o.MaxAttempts, err)
+				return nil, err
+			}
+			d := o.jitter(backoff)
+			klog.V(2).Infof("Fetch %q failed (attempt %d/%d), retrying in %v: %v", path, attempt, o.MaxAttempts, d, err)
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("gave up retrying fetch of %q: %w (last error: %v)", path, ctx.Err(), err)
+			case <-time.After(d):
+			}
+			backoff = time.Duration(float64(backoff) * o.Multiplier)
+			if backoff > o.MaxBackoff {
+				backoff = o.MaxBackoff
+			}
+		}
+	}
+}
+
+// withDefaults returns a copy of o with any unset fields populated from
+// DefaultRetryOpts.
+func (o RetryOpts) withDefaults() RetryOpts {
+	d := DefaultRetryOpts
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = d.MaxAttempts
+	}
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = d.InitialBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = d.MaxBackoff
+	}
+	if o.Multiplier < 1 {
+		o.Multiplier = d.Multiplier
+	}
+	if o.Jitter == 0 || o.Jitter > 1 {
+		o.Jitter = d.Jitter
+	}
+	if o.ShouldRetry == nil {
+		o.ShouldRetry = d.ShouldRetry
+	}
+	return o
+}
+
+// jitter returns d randomly adjusted by up to +/- o.Jitter of its value.
+func (o RetryOpts) jitter(d time.Duration) time.Duration {
+	if o.Jitter < 0 {
+		return d
+	}
+	delta := o.Jitter * float64(d)
+	return time.Duration(float64(d) - delta + rand.Float64()*2*delta)
+}
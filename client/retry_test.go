@@ -0,0 +1,209 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryFetcher(t *testing.T) {
+	errTransient := errors.New("transient")
+	for _, test := range []struct {
+		desc         string
+		failures     int
+		failWith     error
+		opts         RetryOpts
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			desc:         "no failures",
+			wantAttempts: 1,
+		}, {
+			desc:         "recovers",
+			failures:     2,
+			failWith:     errTransient,
+			wantAttempts: 3,
+		}, {
+			desc:         "exhausts attempts",
+			failures:     10,
+			failWith:     errTransient,
+			opts:         RetryOpts{MaxAttempts: 3},
+			wantAttempts: 3,
+			wantErr:      true,
+		}, {
+			desc:         "not found is not retried",
+			failures:     10,
+			failWith:     fmt.Errorf("wrapped: %w", os.ErrNotExist),
+			wantAttempts: 1,
+			wantErr:      true,
+		}, {
+			desc:         "server error is retried",
+			failures:     2,
+			failWith:     HTTPStatusError{StatusCode: 503},
+			wantAttempts: 3,
+		}, {
+			desc:         "client error is not retried",
+			failures:     10,
+			failWith:     HTTPStatusError{StatusCode: 403},
+			wantAttempts: 1,
+			wantErr:      true,
+		}, {
+			desc:         "exhausts budget",
+			failures:     10,
+			failWith:     errTransient,
+			opts:         RetryOpts{Budget: NewRetryBudget(2, 0)},
+			wantAttempts: 3,
+			wantErr:      true,
+		}, {
+			desc:     "custom classification",
+			failures: 10,
+			failWith: errTransient,
+			opts: RetryOpts{
+				ShouldRetry: func(err error) bool { return !errors.Is(err, errTransient) },
+			},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			attempts := 0
+			f := func(_ context.Context, _ string) ([]byte, error) {
+				attempts++
+				if attempts <= test.failures {
+					return nil, test.failWith
+				}
+				return []byte("ok"), nil
+			}
+			test.opts.InitialBackoff = time.Millisecond
+			_, err := RetryFetcher(f, test.opts)(context.Background(), "checkpoint")
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("got err %v, wantErr %t", err, test.wantErr)
+			}
+			if attempts != test.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryFetcherSharedBudget(t *testing.T) {
+	const fetches, retries = 20, 5
+	var attempts atomic.Int64
+	f := func(_ context.Context, _ string) ([]byte, error) {
+		attempts.Add(1)
+		return nil, errors.New("unhealthy")
+	}
+	b := NewRetryBudget(retries, 0)
+	rf := RetryFetcher(f, RetryOpts{InitialBackoff: time.Millisecond, Budget: b})
+
+	var wg sync.WaitGroup
+	for i := 0; i < fetches; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := rf(context.Background(), "checkpoint"); err == nil {
+				t.Error("fetch succeeded, want error")
+			}
+		}()
+	}
+	wg.Wait()
+	// Each fetch is attempted once, and only the budgeted number of retries
+	// are made between them.
+	if got, want := attempts.Load(), int64(fetches+retries); got != want {
+		t.Errorf("got %d attempts, want %d", got, want)
+	}
+}
+
+func TestRetryBudgetRefill(t *testing.T) {
+	b := NewRetryBudget(2, 0.5)
+	for i := 0; i < 2; i++ {
+		if !b.spend() {
+			t.Fatalf("spend %d: budget exhausted, want token", i)
+		}
+	}
+	if b.spend() {
+		t.Fatal("spend succeeded with empty budget")
+	}
+	// Two successes return a whole token, and the budget never exceeds its
+	// initial size.
+	for i := 0; i < 10; i++ {
+		b.succeeded()
+		if i == 0 && b.spend() {
+			t.Fatal("spend succeeded with half a token")
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if !b.spend() {
+			t.Fatalf("spend %d after refill: budget exhausted, want token", i)
+		}
+	}
+	if b.spend() {
+		t.Fatal("spend succeeded beyond budget's size")
+	}
+}
+
+func TestRetryOptsJitter(t *testing.T) {
+	const backoff = time.Second
+	for _, test := range []struct {
+		desc     string
+		jitter   float64
+		min, max time.Duration
+	}{
+		{
+			desc: "default",
+			min:  800 * time.Millisecond,
+			max:  1200 * time.Millisecond,
+		}, {
+			desc:   "custom",
+			jitter: 0.5,
+			min:    500 * time.Millisecond,
+			max:    1500 * time.Millisecond,
+		}, {
+			desc:   "disabled",
+			jitter: NoJitter,
+			min:    backoff,
+			max:    backoff,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			o := RetryOpts{Jitter: test.jitter}.withDefaults()
+			for i := 0; i < 100; i++ {
+				if d := o.jitter(backoff); d < test.min || d > test.max {
+					t.Fatalf("jitter(%v) = %v, want in [%v, %v]", backoff, d, test.min, test.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryFetcherHonoursContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	f := func(_ context.Context, _ string) ([]byte, error) {
+		cancel()
+		return nil, errors.New("boom")
+	}
+	_, err := RetryFetcher(f, RetryOpts{InitialBackoff: time.Hour})(ctx, "checkpoint")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+)
+
+// FetchShardIndex fetches the shard index of the temporally sharded log whose
+// root is read via f, see api.ShardIndex.
+func FetchShardIndex(ctx context.Context, f Fetcher) (api.ShardIndex, error) {
+	var idx api.ShardIndex
+	raw, err := fetch(ctx, f, layout.ShardIndexPath)
+	if err != nil {
+		return idx, fmt.Errorf("failed to fetch shard index: %w", err)
+	}
+	if err := idx.UnmarshalText(raw); err != nil {
+		return idx, fmt.Errorf("invalid shard index: %v", err)
+	}
+	return idx, nil
+}
+
+// ShardFetcher returns a Fetcher for the log of the shard s, given a Fetcher
+// for the root of the temporally sharded log.
+func ShardFetcher(f Fetcher, s api.Shard) Fetcher {
+	return func(ctx context.Context, p string) ([]byte, error) {
+		return f(ctx, path.Join(s.Name, p))
+	}
+}
+
+// ShardTrackerFactory returns a tracker for the log of a shard, whose
+// checkpoints have the given origin, read via f.
+type ShardTrackerFactory func(ctx context.Context, f Fetcher, origin string) (LogStateTracker, error)
+
+// ShardTracker tracks the state of the current shard of a temporally sharded
+// log, rolling over to the next shard once the current shard's period has
+// passed.
+//
+// A ShardTracker is not safe for concurrent use, and the tracker returned by
+// Tracker must not be used concurrently with Update.
+type ShardTracker struct {
+	// RolloverDelay is how long after the end of the current shard's period
+	// the tracker waits before moving to the next shard, so that entries
+	// submitted before the end of the period have been integrated.
+	RolloverDelay time.Duration
+	// OnRollover, if set, is called when the tracker moves from the shard
+	// old to the shard next, with the last checkpoint verified for old.
+	OnRollover func(old api.Shard, lastRaw []byte, next api.Shard)
+	// Now, if set, is used in place of time.Now.
+	Now func() time.Time
+
+	fetcher    Fetcher
+	newTracker ShardTrackerFactory
+	shard      api.Shard
+	tracker    LogStateTracker
+}
+
+// NewShardTracker returns a ShardTracker for the temporally sharded log whose
+// root is read via f, starting with the shard covering the time at.
+//
+// newTracker is called to create the tracker for each shard in turn.
+func NewShardTracker(ctx context.Context, f Fetcher, at time.Time, newTracker ShardTrackerFactory) (*ShardTracker, error) {
+	idx, err := FetchShardIndex(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := idx.Find(at)
+	if !ok {
+		return nil, fmt.Errorf("no shard covers %v", at)
+	}
+	t, err := newTracker(ctx, ShardFetcher(f, s), s.Origin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracker for shard %q: %w", s.Name, err)
+	}
+	return &ShardTracker{fetcher: f, newTracker: newTracker, shard: s, tracker: t}, nil
+}
+
+// Shard returns the shard currently being tracked.
+func (st *ShardTracker) Shard() api.Shard {
+	return st.shard
+}
+
+// Tracker returns the tracker for the shard currently being tracked.
+func (st *ShardTracker) Tracker() *LogStateTracker {
+	return &st.tracker
+}
+
+// Update updates the tracker for the current shard. If the shard's period,
+// plus RolloverDelay, has passed, and the next shard has been added to the
+// shard index, the tracker then moves to the next shard and returns true.
+//
+// The current shard is always updated before moving on, so that its final
+// checkpoint is verified to be consistent with those seen previously.
+func (st *ShardTracker) Update(ctx context.Context) (bool, error) {
+	if _, _, _, err := st.tracker.Update(ctx); err != nil {
+		return false, fmt.Errorf("failed to update shard %q: %w", st.shard.Name, err)
+	}
+	now := time.Now
+	if st.Now != nil {
+		now = st.Now
+	}
+	if now().Before(st.shard.End.Add(st.RolloverDelay)) {
+		return false, nil
+	}
+	idx, err := FetchShardIndex(ctx, st.fetcher)
+	if err != nil {
+		return false, err
+	}
+	next, ok := idx.Next(st.shard.Name)
+	if !ok {
+		return false, nil
+	}
+	t, err := st.newTracker(ctx, ShardFetcher(st.fetcher, next), next.Origin)
+	if err != nil {
+		return false, fmt.Errorf("failed to create tracker for shard %q: %w", next.Name, err)
+	}
+	if st.OnRollover != nil {
+		st.OnRollover(st.shard, st.tracker.State().Raw, next)
+	}
+	st.shard, st.tracker = next, t
+	return true, nil
+}
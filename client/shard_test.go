@@ -0,0 +1,145 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+)
+
+func TestShardTracker(t *testing.T) {
+	ctx := context.Background()
+	q1 := api.ShardQuarterly.Shard("example.com/log", time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC))
+	q2 := api.ShardQuarterly.Shard("example.com/log", time.Date(2025, time.May, 1, 0, 0, 0, 0, time.UTC))
+	shards := map[string]*tlogTilesLog{}
+	for s, size := range map[api.Shard]int{q1: 300, q2: 20} {
+		l := newTlogTilesLog(t, rfc6962.DefaultHasher, size)
+		l.files[layout.CheckpointPath] = mustSignCheckpoint(t, s.Origin, uint64(size), l.root)
+		shards[s.Name] = l
+	}
+	idx := api.ShardIndex{Shards: []api.Shard{q1}}
+	f := func(ctx context.Context, p string) ([]byte, error) {
+		if p == layout.ShardIndexPath {
+			return idx.MarshalText()
+		}
+		name, rest, _ := strings.Cut(p, "/")
+		l, ok := shards[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return l.Fetcher(ctx, rest)
+	}
+	newTracker := func(ctx context.Context, f Fetcher, origin string) (LogStateTracker, error) {
+		return NewLogStateTrackerWithLayout(ctx, f, rfc6962.DefaultHasher, nil, testLogVerifier, origin, UnilateralConsensus(f), TlogTilesLayout{})
+	}
+
+	if _, err := NewShardTracker(ctx, f, q2.Start, newTracker); err == nil {
+		t.Error("NewShardTracker() for time not covered by a shard: got no error")
+	}
+	st, err := NewShardTracker(ctx, f, q1.Start, newTracker)
+	if err != nil {
+		t.Fatalf("NewShardTracker() = %v", err)
+	}
+	var rolledOver []string
+	st.OnRollover = func(old api.Shard, lastRaw []byte, next api.Shard) {
+		rolledOver = append(rolledOver, old.Name, string(lastRaw), next.Name)
+	}
+	now := q1.End.Add(-time.Hour)
+	st.Now = func() time.Time { return now }
+	st.RolloverDelay = time.Hour
+
+	check := func(desc string, wantRollover bool, wantShard api.Shard, wantSize uint64) {
+		t.Helper()
+		got, err := st.Update(ctx)
+		if err != nil {
+			t.Fatalf("%s: Update() = %v", desc, err)
+		}
+		if got != wantRollover {
+			t.Errorf("%s: Update() = %t, want %t", desc, got, wantRollover)
+		}
+		if got := st.Shard(); got != wantShard {
+			t.Errorf("%s: Shard() = %q, want %q", desc, got.Name, wantShard.Name)
+		}
+		if got := st.Tracker().State().Checkpoint.Size; got != wantSize {
+			t.Errorf("%s: tracked size %d, want %d", desc, got, wantSize)
+		}
+	}
+	check("before end of shard", false, q1, 300)
+	now = q1.End
+	check("before rollover delay", false, q1, 300)
+	now = q1.End.Add(time.Hour)
+	check("next shard not in index", false, q1, 300)
+	if len(rolledOver) != 0 {
+		t.Errorf("OnRollover called before rollover: %q", rolledOver)
+	}
+	idx.Shards = append(idx.Shards, q2)
+	check("next shard in index", true, q2, 20)
+	if len(rolledOver) != 3 || rolledOver[0] != q1.Name || rolledOver[1] != string(shards[q1.Name].files[layout.CheckpointPath]) || rolledOver[2] != q2.Name {
+		t.Errorf("OnRollover called with %q", rolledOver)
+	}
+	check("next shard current", false, q2, 20)
+}
+
+func TestFetchShardIndex(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		desc         string
+		files        map[string]string
+		want         int
+		wantErr      bool
+		wantNotFound bool
+	}{
+		{
+			desc:  "valid",
+			files: map[string]string{"shards": "2025 2025-01-01T00:00:00Z 2026-01-01T00:00:00Z example.com/log/2025\n"},
+			want:  1,
+		}, {
+			desc:         "missing",
+			wantErr:      true,
+			wantNotFound: true,
+		}, {
+			desc:    "invalid",
+			files:   map[string]string{"shards": "2025 example.com/log/2025\n"},
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			f := func(_ context.Context, p string) ([]byte, error) {
+				if r, ok := test.files[p]; ok {
+					return []byte(r), nil
+				}
+				return nil, os.ErrNotExist
+			}
+			idx, err := FetchShardIndex(ctx, f)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("FetchShardIndex() = %v, wantErr %t", err, test.wantErr)
+			}
+			if got := errors.Is(err, ErrResourceNotFound); got != test.wantNotFound {
+				t.Errorf("FetchShardIndex() = %v, want ErrResourceNotFound %t", err, test.wantNotFound)
+			}
+			if got := len(idx.Shards); got != test.want {
+				t.Errorf("FetchShardIndex() returned %d shards, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// CheckpointStore durably persists the latest verified checkpoint seen by a
+// LogStateTracker, so that a restarted client can resume from where it left
+// off rather than trusting whatever the log presents on first use.
+type CheckpointStore interface {
+	// Load returns the most recently stored raw checkpoint.
+	// Implementations MUST return (either directly or wrapped) an
+	// os.ErrNotExist if no checkpoint has been stored.
+	Load(ctx context.Context) ([]byte, error)
+	// Store persists the provided raw checkpoint, replacing any previously
+	// stored one.
+	Store(ctx context.Context, cpRaw []byte) error
+}
+
+// FileCheckpointStore is a CheckpointStore which keeps the checkpoint in a file
+// on the local filesystem.
+type FileCheckpointStore struct {
+	// Path is the location of the file used to store the checkpoint.
+	Path string
+}
+
+// Load returns the contents of the checkpoint file.
+func (s FileCheckpointStore) Load(_ context.Context) ([]byte, error) {
+	return os.ReadFile(s.Path)
+}
+
+// Store atomically replaces the contents of the checkpoint file with cpRaw,
+// creating any missing parent directories.
+func (s FileCheckpointStore) Store(_ context.Context, cpRaw []byte) error {
+	dir := filepath.Dir(s.Path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory %q: %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.Path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		// Clean up if we didn't make it as far as the rename.
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(cpRaw); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.Path); err != nil {
+		return fmt.Errorf("failed to rename checkpoint file: %w", err)
+	}
+	return nil
+}
+
+// EnvCheckpointStore is a CheckpointStore which keeps the checkpoint in an
+// environment variable.
+//
+// Since changes to the environment are only visible to the current process and
+// any children it subsequently starts, this is mostly useful for seeding a
+// tracker with a known-good checkpoint provided by the process' caller.
+type EnvCheckpointStore struct {
+	// Name is the name of the environment variable holding the checkpoint.
+	Name string
+}
+
+// Load returns the contents of the environment variable.
+func (s EnvCheckpointStore) Load(_ context.Context) ([]byte, error) {
+	v, ok := os.LookupEnv(s.Name)
+	if !ok || len(v) == 0 {
+		return nil, fmt.Errorf("environment variable %q not set: %w", s.Name, os.ErrNotExist)
+	}
+	return []byte(v), nil
+}
+
+// Store sets the environment variable to cpRaw.
+func (s EnvCheckpointStore) Store(_ context.Context, cpRaw []byte) error {
+	return os.Setenv(s.Name, string(cpRaw))
+}
+
+// NewPersistentLogStateTracker creates a tracker whose state is loaded from,
+// and kept up to date in, the provided CheckpointStore.
+//
+// If the store does not yet hold a checkpoint, one is fetched from the log as
+// with NewLogStateTracker, and persisted.
+func NewPersistentLogStateTracker(ctx context.Context, f Fetcher, h merkle.LogHasher, s CheckpointStore, nV note.Verifier, origin string, cc ConsensusCheckpointFunc, opts ...TrackerOption) (LogStateTracker, error) {
+	cpRaw, err := s.Load(ctx)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return LogStateTracker{}, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	lst, err := NewLogStateTracker(ctx, f, h, cpRaw, nV, origin, cc, opts...)
+	if err != nil {
+		return lst, err
+	}
+	lst.CheckpointStore = s
+	if len(cpRaw) == 0 {
+		if err := s.Store(ctx, lst.State().Raw); err != nil {
+			return lst, fmt.Errorf("failed to store checkpoint: %w", err)
+		}
+	}
+	return lst, nil
+}
+
+// StateDir is a directory holding, for each of a number of logs, the latest
+// checkpoint verified by a client and every checkpoint verified before it, so
+// that a client which is run repeatedly, e.g. from the command line, can't be
+// rolled back to an older view of a log, or shown one which is inconsistent
+// with a view it was shown before.
+//
+// Each log's state is kept in a subdirectory named by the log's escaped origin.
+type StateDir struct {
+	// Dir is the directory in which state is kept.
+	Dir string
+}
+
+// Stores returns the store holding the latest verified checkpoint of the log
+// with the given origin, and the history holding every checkpoint verified
+// before it.
+func (d StateDir) Stores(origin string) (FileCheckpointStore, DirCheckpointHistory, error) {
+	if len(origin) == 0 {
+		return FileCheckpointStore{}, DirCheckpointHistory{}, errors.New("origin must be set to keep state for a log")
+	}
+	dir := filepath.Join(d.Dir, url.PathEscape(origin))
+	return FileCheckpointStore{Path: filepath.Join(dir, "checkpoint")}, DirCheckpointHistory{Dir: filepath.Join(dir, "checkpoints")}, nil
+}
+
+// Load returns the latest verified checkpoint stored for the log with the given
+// origin, or an error wrapping os.ErrNotExist if there is none.
+func (d StateDir) Load(ctx context.Context, origin string) ([]byte, error) {
+	store, _, err := d.Stores(origin)
+	if err != nil {
+		return nil, err
+	}
+	return store.Load(ctx)
+}
+
+// Track causes lst, a tracker for the log with the given origin which was
+// created from the checkpoint returned by Load, to keep its state in d. Every
+// checkpoint it verifies is then stored, and checkpoints which are smaller
+// than, or inconsistent with, those already stored are rejected.
+//
+// If d holds no checkpoint for the log, lst's current checkpoint is trusted on
+// first use, and stored.
+func (d StateDir) Track(ctx context.Context, lst *LogStateTracker, origin string) error {
+	store, history, err := d.Stores(origin)
+	if err != nil {
+		return err
+	}
+	lst.CheckpointStore, lst.History = store, history
+	b := SizeBounds{}
+	if lst.Bounds != nil {
+		b = *lst.Bounds
+	}
+	b.RejectRollback = true
+	lst.Bounds = &b
+	if _, err := store.Load(ctx); errors.Is(err, os.ErrNotExist) {
+		if err := store.Store(ctx, lst.State().Raw); err != nil {
+			return fmt.Errorf("failed to store checkpoint: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to load stored checkpoint: %w", err)
+	}
+	return nil
+}
+
+// CheckCheckpoint returns an ErrEquivocation if d holds a checkpoint for the
+// log with the same origin and size as cp, a verified checkpoint obtained other
+// than by a tracker, e.g. from a proof, but with a different root hash.
+func (d StateDir) CheckCheckpoint(ctx context.Context, cp log.Checkpoint, cpRaw []byte) error {
+	_, history, err := d.Stores(cp.Origin)
+	if err != nil {
+		return err
+	}
+	return checkEquivocation(ctx, history, cp, cpRaw)
+}
@@ -0,0 +1,268 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestCheckpointStores(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TEST_CHECKPOINT", "")
+	for _, test := range []struct {
+		desc  string
+		store CheckpointStore
+	}{
+		{
+			desc:  "file",
+			store: FileCheckpointStore{Path: filepath.Join(t.TempDir(), "state", "checkpoint")},
+		}, {
+			desc:  "env",
+			store: EnvCheckpointStore{Name: "TEST_CHECKPOINT"},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if _, err := test.store.Load(ctx); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("Load on empty store: got err %v, want %v", err, os.ErrNotExist)
+			}
+			for _, cp := range [][]byte{testRawCheckpoints[3], testRawCheckpoints[7]} {
+				if err := test.store.Store(ctx, cp); err != nil {
+					t.Fatalf("Store: %v", err)
+				}
+				got, err := test.store.Load(ctx)
+				if err != nil {
+					t.Fatalf("Load: %v", err)
+				}
+				if !bytes.Equal(got, cp) {
+					t.Errorf("Load got:\n%s\nwant:\n%s", got, cp)
+				}
+			}
+		})
+	}
+}
+
+func TestPersistentLogStateTracker(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	store := FileCheckpointStore{Path: filepath.Join(t.TempDir(), "checkpoint")}
+	shim := fetchCheckpointShim{Checkpoints: [][]byte{testRawCheckpoints[5], testRawCheckpoints[9]}}
+	f := shim.Fetcher(testLogFetcher)
+
+	lst, err := NewPersistentLogStateTracker(ctx, f, h, store, testLogVerifier, testOrigin, UnilateralConsensus(f))
+	if err != nil {
+		t.Fatalf("NewPersistentLogStateTracker: %v", err)
+	}
+	if got, err := store.Load(ctx); err != nil || !bytes.Equal(got, testRawCheckpoints[5]) {
+		t.Fatalf("after init, store holds %q (err %v), want checkpoint 5", got, err)
+	}
+
+	shim.Advance()
+	if _, _, _, err := lst.Update(ctx); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, err := store.Load(ctx); err != nil || !bytes.Equal(got, testRawCheckpoints[9]) {
+		t.Fatalf("after update, store holds %q (err %v), want checkpoint 9", got, err)
+	}
+
+	// A restarted tracker should resume from the stored state, rather than
+	// fetching from the log.
+	shim.Advance()
+	lst, err = NewPersistentLogStateTracker(ctx, f, h, store, testLogVerifier, testOrigin, UnilateralConsensus(f))
+	if err != nil {
+		t.Fatalf("NewPersistentLogStateTracker (restart): %v", err)
+	}
+	if !bytes.Equal(lst.LatestConsistentRaw, testRawCheckpoints[9]) {
+		t.Errorf("restarted tracker at:\n%s\nwant:\n%s", lst.LatestConsistentRaw, testRawCheckpoints[9])
+	}
+}
+
+// failingStore is a CheckpointStore whose Store method fails once failing is set.
+type failingStore struct {
+	CheckpointStore
+	failing bool
+}
+
+func (s *failingStore) Store(ctx context.Context, cpRaw []byte) error {
+	if s.failing {
+		return errors.New("store failed")
+	}
+	return s.CheckpointStore.Store(ctx, cpRaw)
+}
+
+func TestPersistentLogStateTrackerStoreFailure(t *testing.T) {
+	ctx := context.Background()
+	store := &failingStore{CheckpointStore: FileCheckpointStore{Path: filepath.Join(t.TempDir(), "checkpoint")}}
+	shim := fetchCheckpointShim{Checkpoints: [][]byte{testRawCheckpoints[5], testRawCheckpoints[9]}}
+	f := shim.Fetcher(testLogFetcher)
+
+	lst, err := NewPersistentLogStateTracker(ctx, f, rfc6962.DefaultHasher, store, testLogVerifier, testOrigin, UnilateralConsensus(f))
+	if err != nil {
+		t.Fatalf("NewPersistentLogStateTracker: %v", err)
+	}
+	store.failing = true
+	shim.Advance()
+	if _, _, _, err := lst.Update(ctx); err == nil {
+		t.Fatal("Update succeeded, want error from failing store")
+	}
+	// The tracker must not move past the stored checkpoint.
+	if got := lst.State(); !bytes.Equal(got.Raw, testRawCheckpoints[5]) || got.Checkpoint.Size != 5 {
+		t.Errorf("after failed update, tracker at:\n%s\nwant checkpoint 5", got.Raw)
+	}
+
+	// Once the store recovers, the update succeeds.
+	store.failing = false
+	if _, _, _, err := lst.Update(ctx); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, err := store.Load(ctx); err != nil || !bytes.Equal(got, testRawCheckpoints[9]) {
+		t.Errorf("after update, store holds %q (err %v), want checkpoint 9", got, err)
+	}
+	if got := lst.State().Checkpoint.Size; got != 9 {
+		t.Errorf("after update, tracker at size %d, want 9", got)
+	}
+}
+
+func TestStateDir(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	forkedRaw := mustSignCheckpoint(t, testOrigin, 10, h.HashLeaf([]byte("banana")))
+	forked := log.Checkpoint{Origin: testOrigin, Size: 10, Hash: h.HashLeaf([]byte("banana"))}
+
+	// run starts a client run, whose tracker is created from the checkpoint
+	// stored in sd, and fetches checkpoints from shim.
+	run := func(t *testing.T, sd StateDir, shim *fetchCheckpointShim) *LogStateTracker {
+		t.Helper()
+		cpRaw, err := sd.Load(ctx, testOrigin)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Load: %v", err)
+		}
+		f := shim.Fetcher(testLogFetcher)
+		lst, err := NewLogStateTracker(ctx, f, h, cpRaw, testLogVerifier, testOrigin, UnilateralConsensus(f))
+		if err != nil {
+			t.Fatalf("NewLogStateTracker: %v", err)
+		}
+		if err := sd.Track(ctx, &lst, testOrigin); err != nil {
+			t.Fatalf("Track: %v", err)
+		}
+		return &lst
+	}
+	wantStored := func(t *testing.T, sd StateDir, origin string, want []byte) {
+		t.Helper()
+		got, err := sd.Load(ctx, origin)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Load(%q) = %q, %v, want:\n%s", origin, got, err, want)
+		}
+	}
+
+	t.Run("per origin", func(t *testing.T) {
+		sd := StateDir{Dir: t.TempDir()}
+		if _, err := sd.Load(ctx, testOrigin); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Load on empty dir: got err %v, want %v", err, os.ErrNotExist)
+		}
+		// The log's checkpoint is trusted on first use.
+		run(t, sd, &fetchCheckpointShim{Checkpoints: [][]byte{testRawCheckpoints[5]}})
+		wantStored(t, sd, testOrigin, testRawCheckpoints[5])
+
+		const other = "example.com/other"
+		if _, err := sd.Load(ctx, other); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Load(%q): got err %v, want %v", other, err, os.ErrNotExist)
+		}
+		store, _, err := sd.Stores(other)
+		if err != nil {
+			t.Fatalf("Stores: %v", err)
+		}
+		if got, want := filepath.Dir(store.Path), filepath.Join(sd.Dir, "example.com%2Fother"); got != want {
+			t.Errorf("Stores(%q) kept in %q, want %q", other, got, want)
+		}
+		if err := store.Store(ctx, testRawCheckpoints[9]); err != nil {
+			t.Fatalf("Store: %v", err)
+		}
+		wantStored(t, sd, other, testRawCheckpoints[9])
+		wantStored(t, sd, testOrigin, testRawCheckpoints[5])
+
+		if _, _, err := sd.Stores(""); err == nil {
+			t.Error("Stores with empty origin: got no error")
+		}
+	})
+
+	t.Run("rollback rejected", func(t *testing.T) {
+		sd := StateDir{Dir: t.TempDir()}
+		shim := &fetchCheckpointShim{Checkpoints: [][]byte{testRawCheckpoints[10], testRawCheckpoints[5]}}
+		run(t, sd, shim)
+		shim.Advance()
+		lst := run(t, sd, shim)
+		if _, _, _, err := lst.Update(ctx); !errors.As(err, &ErrSizeRollback{}) {
+			t.Fatalf("Update: got err %v, want ErrSizeRollback", err)
+		}
+		wantStored(t, sd, testOrigin, testRawCheckpoints[10])
+	})
+
+	t.Run("stored checkpoint is checked for consistency", func(t *testing.T) {
+		sd := StateDir{Dir: t.TempDir()}
+		shim := &fetchCheckpointShim{Checkpoints: [][]byte{testRawCheckpoints[5], forkedRaw, testRawCheckpoints[10]}}
+		run(t, sd, shim)
+		shim.Advance()
+		lst := run(t, sd, shim)
+		if _, _, _, err := lst.Update(ctx); !errors.Is(err, ErrProofMismatch) {
+			t.Fatalf("Update to forked checkpoint: got err %v, want %v", err, ErrProofMismatch)
+		}
+		wantStored(t, sd, testOrigin, testRawCheckpoints[5])
+
+		shim.Advance()
+		if _, _, _, err := lst.Update(ctx); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		wantStored(t, sd, testOrigin, testRawCheckpoints[10])
+	})
+
+	t.Run("equivocation detected", func(t *testing.T) {
+		sd := StateDir{Dir: t.TempDir()}
+		shim := &fetchCheckpointShim{Checkpoints: [][]byte{testRawCheckpoints[5], testRawCheckpoints[10]}}
+		lst := run(t, sd, shim)
+		shim.Advance()
+		if _, _, _, err := lst.Update(ctx); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if err := sd.CheckCheckpoint(ctx, forked, forkedRaw); !errors.As(err, &ErrEquivocation{}) {
+			t.Errorf("CheckCheckpoint(forked): got err %v, want ErrEquivocation", err)
+		}
+		for _, i := range []int{5, 10, 7} {
+			if err := sd.CheckCheckpoint(ctx, testCheckpoints[i], testRawCheckpoints[i]); err != nil {
+				t.Errorf("CheckCheckpoint(%d): %v", i, err)
+			}
+		}
+	})
+}
+
+func TestPersistentLogStateTrackerOptions(t *testing.T) {
+	ctx := context.Background()
+	store := FileCheckpointStore{Path: filepath.Join(t.TempDir(), "checkpoint")}
+	f := testLogFetcher
+	m := newRecordingMetrics()
+	if _, err := NewPersistentLogStateTracker(ctx, f, rfc6962.DefaultHasher, store, testLogVerifier, testOrigin, UnilateralConsensus(f), WithTrackerMetrics(m)); err != nil {
+		t.Fatalf("NewPersistentLogStateTracker: %v", err)
+	}
+	if got, want := m.paths["checkpoint"], 1; got != want {
+		t.Errorf("got %d checkpoint fetches from constructor, want %d", got, want)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"golang.org/x/mod/sumdb/note"
+)
+
+const (
+	// algRFC6962STH is the note key algorithm identifier for RFC 6962 signed tree heads.
+	algRFC6962STH = 0x05
+
+	// Values of the RFC 6962 LogEntryType enum.
+	ctX509Entry    = 0
+	ctPrecertEntry = 1
+)
+
+// StaticCTLayout is the Layout described by the C2SP static-ct-api spec, as
+// used by Certificate Transparency logs which publish their contents as static
+// assets.
+//
+// Hash tiles are identical to those of the tlog-tiles layout, and leaves are
+// read from data tiles. GetLeaf returns the RFC 6962 MerkleTreeLeaf structure
+// for an entry, i.e. the value which is hashed to form the entry's leaf hash.
+//
+// Checkpoints from such logs are signed with RFC 6962 signed tree heads, and
+// can be verified using the verifier returned by NewStaticCTVerifier.
+//
+// See https://c2sp.org/static-ct-api.
+type StaticCTLayout struct{}
+
+// TileFetcher implements Layout.
+func (StaticCTLayout) TileFetcher(f Fetcher, h compact.HashFn, logSize uint64) GetTileFunc {
+	return TlogTilesLayout{}.TileFetcher(f, h, logSize)
+}
+
+// GetLeaf implements Layout.
+func (l StaticCTLayout) GetLeaf(ctx context.Context, f Fetcher, i, logSize uint64) ([]byte, error) {
+	if i >= logSize {
+		return nil, fmt.Errorf("leaf index %d not found in log of size %d: %w", i, logSize, os.ErrNotExist)
+	}
+	entries, err := l.GetLeafBundle(ctx, f, i/layout.TlogTileWidth, logSize)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("leaf index %d not found: %w", i, err)
+		}
+		return nil, fmt.Errorf("failed to fetch leaf index %d: %w", i, err)
+	}
+	return entries[i%layout.TlogTileWidth], nil
+}
+
+// LeafBundleSize implements Layout.
+func (StaticCTLayout) LeafBundleSize() uint64 {
+	return layout.TlogTileWidth
+}
+
+// GetLeafBundle implements Layout. Each leaf is a MerkleTreeLeaf built from
+// the TimestampedEntry stored in the data tile with the given index.
+func (StaticCTLayout) GetLeafBundle(ctx context.Context, f Fetcher, index, logSize uint64) ([][]byte, error) {
+	if index >= (logSize+layout.TlogTileWidth-1)/layout.TlogTileWidth {
+		return nil, fmt.Errorf("data tile %d is outside of log size %d: %w", index, logSize, os.ErrNotExist)
+	}
+	want := layout.PartialTileSize(0, index, logSize)
+	p := layout.StaticCTDataPath(index, want)
+	if want == 0 {
+		want = layout.TlogTileWidth
+	}
+	b, err := fetch(ctx, f, p)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([][]byte, 0, want)
+	for len(b) > 0 {
+		var entry []byte
+		entry, b, err = readStaticCTTileLeaf(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data tile at %q: %v", p, err)
+		}
+		// MerkleTreeLeaf is a v1 (0) timestamped_entry (0) leaf containing the TimestampedEntry.
+		entries = append(entries, append([]byte{0, 0}, entry...))
+	}
+	if got := uint64(len(entries)); got != want {
+		return nil, fmt.Errorf("data tile at %q has %d entries, want %d", p, got, want)
+	}
+	return entries, nil
+}
+
+// readStaticCTTileLeaf reads the first TileLeaf structure from b, returning
+// the TimestampedEntry it contains and the remainder of b.
+func readStaticCTTileLeaf(b []byte) ([]byte, []byte, error) {
+	s := &tlsReader{b: b}
+	s.skip(8) // timestamp
+	entryType := s.uint(2)
+	switch entryType {
+	case ctX509Entry:
+		s.vector(3) // certificate
+	case ctPrecertEntry:
+		s.skip(32)  // issuer_key_hash
+		s.vector(3) // tbs_certificate
+	default:
+		return nil, nil, fmt.Errorf("unknown entry type %d", entryType)
+	}
+	s.vector(2) // extensions
+	if s.err != nil {
+		return nil, nil, s.err
+	}
+	entry := b[:len(b)-len(s.b)]
+	if entryType == ctPrecertEntry {
+		s.vector(3) // pre_certificate
+	}
+	s.vector(2) // certificate_chain
+	if s.err != nil {
+		return nil, nil, s.err
+	}
+	return entry, s.b, nil
+}
+
+// tlsReader reads TLS presentation language encoded values from b, recording
+// the first error encountered.
+type tlsReader struct {
+	b   []byte
+	err error
+}
+
+// skip consumes n bytes.
+func (s *tlsReader) skip(n int) []byte {
+	if s.err != nil {
+		return nil
+	}
+	if len(s.b) < n {
+		s.err = errors.New("truncated entry")
+		return nil
+	}
+	r := s.b[:n]
+	s.b = s.b[n:]
+	return r
+}
+
+// uint consumes an n byte big-endian unsigned integer.
+func (s *tlsReader) uint(n int) uint64 {
+	var v uint64
+	for _, c := range s.skip(n) {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// vector consumes a variable length vector with an n byte length prefix.
+func (s *tlsReader) vector(n int) []byte {
+	return s.skip(int(s.uint(n)))
+}
+
+// NewStaticCTVerifier returns a note.Verifier for the RFC 6962 signed tree head
+// signatures found on the checkpoints of static-ct-api logs.
+//
+// name is the log's key name, which is conventionally the same as its origin,
+// and key is the log's ECDSA P-256 public key.
+func NewStaticCTVerifier(name string, key crypto.PublicKey) (note.Verifier, error) {
+	if name == "" || strings.ContainsAny(name, " \t\n+") {
+		return nil, fmt.Errorf("invalid key name %q", name)
+	}
+	pk, ok := key.(*ecdsa.PublicKey)
+	if !ok || pk.Curve != elliptic.P256() {
+		return nil, errors.New("static-ct-api log keys must be ECDSA P-256")
+	}
+	der, err := x509.MarshalPKIXPublicKey(pk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %v", err)
+	}
+	logID := sha256.Sum256(der)
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte{'\n', algRFC6962STH})
+	h.Write(logID[:])
+	return &rfc6962STHVerifier{
+		name: name,
+		hash: binary.BigEndian.Uint32(h.Sum(nil)),
+		key:  pk,
+	}, nil
+}
+
+// rfc6962STHVerifier is a note.Verifier for RFC 6962 signed tree head signatures.
+type rfc6962STHVerifier struct {
+	name string
+	hash uint32
+	key  *ecdsa.PublicKey
+}
+
+// Name returns the name of the log key.
+func (v *rfc6962STHVerifier) Name() string { return v.name }
+
+// KeyHash returns the note key hash of the log key.
+func (v *rfc6962STHVerifier) KeyHash() uint32 { return v.hash }
+
+// Verify checks that sig is a valid RFC 6962 tree head signature over the
+// checkpoint msg.
+//
+// sig is the STH timestamp, followed by a TLS DigitallySigned structure.
+func (v *rfc6962STHVerifier) Verify(msg, sig []byte) bool {
+	var cp log.Checkpoint
+	if _, err := cp.Unmarshal(msg); err != nil || len(cp.Hash) != sha256.Size {
+		return false
+	}
+	s := &tlsReader{b: sig}
+	ts := s.skip(timestampSize)
+	hashAlg, sigAlg := s.uint(1), s.uint(1)
+	sigBytes := s.vector(2)
+	// Only SHA-256 (4) with ECDSA (3) is permitted.
+	if s.err != nil || len(s.b) != 0 || hashAlg != 4 || sigAlg != 3 {
+		return false
+	}
+	// TreeHeadSignature is a v1 (0) tree_hash (1) signature over the STH.
+	sth := make([]byte, 0, 2+timestampSize+8+sha256.Size)
+	sth = append(sth, 0, 1)
+	sth = append(sth, ts...)
+	sth = binary.BigEndian.AppendUint64(sth, cp.Size)
+	sth = append(sth, cp.Hash...)
+	d := sha256.Sum256(sth)
+	return ecdsa.VerifyASN1(v.key, d[:], sigBytes)
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// testSTHSigner signs checkpoints with RFC 6962 tree head signatures.
+type testSTHSigner struct {
+	v   *rfc6962STHVerifier
+	key *ecdsa.PrivateKey
+}
+
+func newTestSTHSigner(t *testing.T, name string) (*testSTHSigner, note.Verifier) {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	v, err := NewStaticCTVerifier(name, k.Public())
+	if err != nil {
+		t.Fatalf("NewStaticCTVerifier: %v", err)
+	}
+	return &testSTHSigner{v: v.(*rfc6962STHVerifier), key: k}, v
+}
+
+func (s *testSTHSigner) Name() string    { return s.v.name }
+func (s *testSTHSigner) KeyHash() uint32 { return s.v.hash }
+
+func (s *testSTHSigner) Sign(msg []byte) ([]byte, error) {
+	var cp log.Checkpoint
+	if _, err := cp.Unmarshal(msg); err != nil {
+		return nil, err
+	}
+	const ts = 1712345678000
+	sth := []byte{0, 1}
+	sth = binary.BigEndian.AppendUint64(sth, ts)
+	sth = binary.BigEndian.AppendUint64(sth, cp.Size)
+	sth = append(sth, cp.Hash...)
+	d := sha256.Sum256(sth)
+	sig, err := ecdsa.SignASN1(rand.Reader, s.key, d[:])
+	if err != nil {
+		return nil, err
+	}
+	r := binary.BigEndian.AppendUint64(nil, ts)
+	r = append(r, 4, 3)
+	r = binary.BigEndian.AppendUint16(r, uint16(len(sig)))
+	return append(r, sig...), nil
+}
+
+// staticCTTileLeaf returns the TileLeaf and MerkleTreeLeaf encodings of a fake entry.
+func staticCTTileLeaf(i int) ([]byte, []byte) {
+	cert := []byte(fmt.Sprintf("certificate %d", i))
+	var e []byte
+	e = binary.BigEndian.AppendUint64(e, uint64(i))
+	if i%2 == 0 {
+		e = binary.BigEndian.AppendUint16(e, ctX509Entry)
+	} else {
+		e = binary.BigEndian.AppendUint16(e, ctPrecertEntry)
+		e = append(e, bytes.Repeat([]byte{0x42}, 32)...)
+	}
+	e = append(e, 0, byte(len(cert)>>8), byte(len(cert)))
+	e = append(e, cert...)
+	e = binary.BigEndian.AppendUint16(e, 0)
+
+	tl := append([]byte{}, e...)
+	if i%2 != 0 {
+		tl = append(tl, 0, 0, 3, 'p', 'r', 'e')
+	}
+	tl = binary.BigEndian.AppendUint16(tl, 64)
+	tl = append(tl, bytes.Repeat([]byte{0x01}, 64)...)
+	return tl, append([]byte{0, 0}, e...)
+}
+
+func TestStaticCTLayout(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	const size = 300
+	origin := "static-ct.example.com/log"
+
+	tileLeaves, leaves := [][]byte{}, [][]byte{}
+	for i := 0; i < size; i++ {
+		tl, leaf := staticCTTileLeaf(i)
+		tileLeaves, leaves = append(tileLeaves, tl), append(leaves, leaf)
+	}
+	l := newTlogTilesTree(t, h, leaves)
+	for i := 0; i < size; i += layout.TlogTileWidth {
+		end := min(i+layout.TlogTileWidth, size)
+		l.files[layout.StaticCTDataPath(uint64(i/layout.TlogTileWidth), uint64(end-i)%layout.TlogTileWidth)] = bytes.Join(tileLeaves[i:end], nil)
+	}
+	s, v := newTestSTHSigner(t, origin)
+	cp := log.Checkpoint{Origin: origin, Size: size, Hash: l.root}
+	cpRaw, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, s)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	l.files[layout.CheckpointPath] = cpRaw
+
+	lst, err := NewLogStateTrackerWithLayout(ctx, l.Fetcher, h, nil, v, origin, UnilateralConsensus(l.Fetcher), StaticCTLayout{})
+	if err != nil {
+		t.Fatalf("NewLogStateTrackerWithLayout: %v", err)
+	}
+	if got := lst.LatestConsistent.Size; got != size {
+		t.Fatalf("got tracker size %d, want %d", got, size)
+	}
+	for _, i := range []uint64{0, 1, 255, 256, size - 1} {
+		leaf, _, err := GetVerifiedLeaf(ctx, &lst, i)
+		if err != nil {
+			t.Fatalf("GetVerifiedLeaf(%d): %v", i, err)
+		}
+		if !bytes.Equal(leaf, leaves[i]) {
+			t.Errorf("GetVerifiedLeaf(%d): got %x, want %x", i, leaf, leaves[i])
+		}
+	}
+}
+
+func TestStaticCTVerifier(t *testing.T) {
+	origin := "static-ct.example.com/log"
+	s, v := newTestSTHSigner(t, origin)
+	_, other := newTestSTHSigner(t, origin)
+	cp := log.Checkpoint{Origin: origin, Size: 10, Hash: bytes.Repeat([]byte{0x10}, 32)}
+	cpRaw, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, s)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	if _, _, _, err := log.ParseCheckpoint(cpRaw, origin, v); err != nil {
+		t.Errorf("ParseCheckpoint with signing key: %v", err)
+	}
+	if _, _, _, err := log.ParseCheckpoint(cpRaw, origin, other); err == nil {
+		t.Error("ParseCheckpoint with other key: got no error")
+	}
+	if v.KeyHash() == other.KeyHash() {
+		t.Error("different keys have the same key hash")
+	}
+
+	edKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := NewStaticCTVerifier(origin, edKey); err == nil {
+		t.Error("NewStaticCTVerifier with Ed25519 key: got no error")
+	}
+}
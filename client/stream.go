@@ -0,0 +1,59 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// FetcherStream is the signature of a function which can retrieve arbitrary
+// files from a log's data storage as a stream, allowing large resources such as
+// leaf bundles to be processed without first reading them fully into memory.
+//
+// As with Fetcher, implementations MUST return (either directly or wrapped)
+// an os.ErrNotExist error if the requested file does not exist.
+//
+// Callers must Close the returned reader once they have finished with it.
+type FetcherStream func(ctx context.Context, path string) (io.ReadCloser, error)
+
+// StreamFromFetcher returns a FetcherStream which serves resources fetched in
+// their entirety by f.
+//
+// This allows code written against FetcherStream to be used with any Fetcher,
+// although without the memory savings of a native streaming implementation.
+func StreamFromFetcher(f Fetcher) FetcherStream {
+	return func(ctx context.Context, path string) (io.ReadCloser, error) {
+		b, err := f(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+}
+
+// FetcherFromStream returns a Fetcher which reads the entirety of each resource
+// streamed by fs.
+func FetcherFromStream(fs FetcherStream) Fetcher {
+	return func(ctx context.Context, path string) ([]byte, error) {
+		r, err := fs(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+}
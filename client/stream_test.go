@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestFetcherStreamAdapters(t *testing.T) {
+	ctx := context.Background()
+	f := FetcherFromStream(StreamFromFetcher(testLogFetcher))
+
+	for _, test := range []struct {
+		desc    string
+		path    string
+		wantErr error
+	}{
+		{
+			desc: "checkpoint",
+			path: "checkpoint",
+		}, {
+			desc: "tile",
+			path: "tile/00/0000/00/00/00.0f",
+		}, {
+			desc:    "missing",
+			path:    "banana",
+			wantErr: os.ErrNotExist,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := f(ctx, test.path)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got err %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want, err := testLogFetcher(ctx, test.path)
+			if err != nil {
+				t.Fatalf("testLogFetcher: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestStreamFromFetcher(t *testing.T) {
+	ctx := context.Background()
+	r, err := StreamFromFetcher(testLogFetcher)(ctx, "checkpoint")
+	if err != nil {
+		t.Fatalf("FetcherStream: %v", err)
+	}
+	defer r.Close()
+	// Read in small chunks, as a consumer of a large resource would.
+	var got []byte
+	buf := make([]byte, 7)
+	for {
+		n, err := r.Read(buf)
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+	}
+	if want := testRawCheckpoints[len(testRawCheckpoints)-1]; !bytes.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/transparency-dev/serverless-log/api"
+	"k8s.io/klog/v2"
+)
+
+// errMalformedResponse is returned when the log accepts a submission but its
+// response cannot be understood. Such submissions are not retried.
+var errMalformedResponse = errors.New("malformed add response")
+
+// SubmitResult describes the outcome of adding a leaf to a log.
+type SubmitResult struct {
+	// Index is the position at which the leaf was sequenced.
+	Index uint64
+	// Duplicate is true if the log reported that the leaf had previously been
+	// sequenced, in which case Index is the position of the original entry.
+	Duplicate bool
+}
+
+// SubmitError is returned by Submitter when the log rejects a submission.
+type SubmitError struct {
+	// StatusCode is the HTTP status code returned by the log.
+	StatusCode int
+	// Body is the body of the log's response.
+	Body []byte
+	// RetryAfter is the delay requested by the log via the Retry-After header,
+	// if any.
+	RetryAfter time.Duration
+}
+
+func (e SubmitError) Error() string {
+	return fmt.Sprintf("add returned status %d: %q", e.StatusCode, e.Body)
+}
+
+// Submitter adds leaves to a log via its HTTP add endpoint.
+//
+// The endpoint is expected to accept the raw leaf as the body of a POST request,
+// and to respond with a marshalled api.AddResponse: the decimal index assigned
+// to the leaf on the first line of the body, optionally followed by a line
+// reading "duplicate" if the leaf had already been sequenced.
+//
+// A Submitter is safe for concurrent use.
+type Submitter struct {
+	u     *url.URL
+	hc    *http.Client
+	auth  func(*http.Request) error
+	retry RetryOpts
+}
+
+// SubmitterOption is used to configure optional behaviour of a Submitter.
+type SubmitterOption func(*Submitter)
+
+// WithHTTPClient causes the Submitter to make requests using hc rather than
+// http.DefaultClient.
+func WithHTTPClient(hc *http.Client) SubmitterOption {
+	return func(s *Submitter) {
+		s.hc = hc
+	}
+}
+
+// WithAuth causes the Submitter to call auth on every request before it is sent,
+// e.g. to add credentials.
+func WithAuth(auth func(*http.Request) error) SubmitterOption {
+	return func(s *Submitter) {
+		s.auth = auth
+	}
+}
+
+// WithBearerToken causes the Submitter to authenticate every request with the
+// given bearer token.
+func WithBearerToken(token string) SubmitterOption {
+	return WithAuth(BearerTokenAuth(token))
+}
+
+// WithSubmitRetry configures how the Submitter retries failed submissions.
+// If ShouldRetry is unset, transport errors, 5xx responses and 429 responses
+// are retried.
+func WithSubmitRetry(opts RetryOpts) SubmitterOption {
+	return func(s *Submitter) {
+		s.retry = opts
+	}
+}
+
+// NewSubmitter creates a Submitter which adds leaves via the add endpoint at addURL.
+func NewSubmitter(addURL *url.URL, opts ...SubmitterOption) *Submitter {
+	s := &Submitter{
+		u:  addURL,
+		hc: http.DefaultClient,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.retry.ShouldRetry == nil {
+		s.retry.ShouldRetry = shouldRetrySubmit
+	}
+	s.retry = s.retry.withDefaults()
+	return s
+}
+
+// Submit adds the leaf to the log, retrying failed attempts with exponential
+// backoff, and returns the index assigned to it.
+//
+// Submitting a leaf again after a failure is safe: logs which deduplicate their
+// entries will report the original index, with SubmitResult.Duplicate set.
+func (s *Submitter) Submit(ctx context.Context, leaf []byte) (SubmitResult, error) {
+	o := s.retry
+	backoff := o.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		r, err := s.submit(ctx, leaf)
+		if err == nil {
+			return r, nil
+		}
+		if attempt >= o.MaxAttempts || !o.ShouldRetry(err) {
+			return SubmitResult{}, err
+		}
+		d := o.jitter(backoff)
+		var sErr SubmitError
+		if errors.As(err, &sErr) && sErr.RetryAfter > d {
+			d = sErr.RetryAfter
+		}
+		klog.V(2).Infof("Submission failed (attempt %d/%d), retrying in %v: %v", attempt, o.MaxAttempts, d, err)
+		select {
+		case <-ctx.Done():
+			return SubmitResult{}, fmt.Errorf("gave up retrying submission: %w (last error: %v)", ctx.Err(), err)
+		case <-time.After(d):
+		}
+		backoff = time.Duration(float64(backoff) * o.Multiplier)
+		if backoff > o.MaxBackoff {
+			backoff = o.MaxBackoff
+		}
+	}
+}
+
+// SubmitAndAwait adds the leaf to the log, and then waits for it to be
+// integrated into the log tracked by lst. The returned inclusion proof has been
+// verified against lst's LatestConsistent checkpoint.
+//
+// lst is updated as the log grows. Callers should use a context with a deadline
+// to bound the wait.
+func (s *Submitter) SubmitAndAwait(ctx context.Context, lst *LogStateTracker, leaf []byte) (SubmitResult, [][]byte, error) {
+	r, err := s.Submit(ctx, leaf)
+	if err != nil {
+		return r, nil, err
+	}
+	o := DefaultRetryOpts
+	backoff := o.InitialBackoff
+	for r.Index >= lst.State().Checkpoint.Size {
+		d := o.jitter(backoff)
+		klog.V(2).Infof("Leaf %d not yet integrated, checking again in %v", r.Index, d)
+		select {
+		case <-ctx.Done():
+			return r, nil, fmt.Errorf("gave up waiting for integration of leaf %d: %w", r.Index, ctx.Err())
+		case <-time.After(d):
+		}
+		if _, _, _, err := lst.Update(ctx); err != nil {
+			return r, nil, fmt.Errorf("failed to update log state: %w", err)
+		}
+		backoff = time.Duration(float64(backoff) * o.Multiplier)
+		if backoff > o.MaxBackoff {
+			backoff = o.MaxBackoff
+		}
+	}
+	p, err := verifiedInclusionProof(ctx, lst, lst.State(), r.Index, lst.Hasher.HashLeaf(leaf))
+	if err != nil {
+		return r, nil, err
+	}
+	return r, p, nil
+}
+
+// submit makes a single attempt to add the leaf to the log.
+func (s *Submitter) submit(ctx context.Context, leaf []byte) (SubmitResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.u.String(), bytes.NewReader(leaf))
+	if err != nil {
+		return SubmitResult{}, fmt.Errorf("failed to create request: %v", err)
+	}
+	if s.auth != nil {
+		if err := s.auth(req); err != nil {
+			return SubmitResult{}, fmt.Errorf("failed to authorize request: %v", err)
+		}
+	}
+	resp, err := s.hc.Do(req)
+	if err != nil {
+		return SubmitResult{}, fmt.Errorf("failed to submit leaf: %w", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return SubmitResult{}, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return SubmitResult{}, SubmitError{
+			StatusCode: resp.StatusCode,
+			Body:       body,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	if resp.Request.Method != http.MethodPost {
+		return SubmitResult{}, fmt.Errorf("submission was redirected to %s", resp.Request.URL)
+	}
+	return parseSubmitResponse(body)
+}
+
+// parseSubmitResponse parses the body of a successful add response, see
+// api.AddResponse.
+func parseSubmitResponse(body []byte) (SubmitResult, error) {
+	var r api.AddResponse
+	if err := r.UnmarshalText(body); err != nil {
+		return SubmitResult{}, fmt.Errorf("%w %q: %v", errMalformedResponse, body, err)
+	}
+	return SubmitResult(r), nil
+}
+
+// parseRetryAfter returns the delay described by the value of a Retry-After
+// header, or zero if it's absent or invalid.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// shouldRetrySubmit is the error classification used by Submitter when no
+// ShouldRetry func is configured.
+//
+// Rejections by the log are only retried if they indicate a transient problem,
+// and responses which can't be parsed are never retried. Other errors are
+// classified as by DefaultShouldRetry.
+func shouldRetrySubmit(err error) bool {
+	var sErr SubmitError
+	switch {
+	case errors.As(err, &sErr):
+		return sErr.StatusCode == http.StatusTooManyRequests || sErr.StatusCode >= 500
+	case errors.Is(err, errMalformedResponse):
+		return false
+	}
+	return DefaultShouldRetry(err)
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// fastRetry keeps retrying tests quick.
+var fastRetry = RetryOpts{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+func TestSubmit(t *testing.T) {
+	for _, test := range []struct {
+		desc         string
+		responses    []func(w http.ResponseWriter)
+		want         SubmitResult
+		wantAttempts int32
+		wantStatus   int
+	}{
+		{
+			desc: "sequenced",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { fmt.Fprintln(w, "42") },
+			},
+			want:         SubmitResult{Index: 42},
+			wantAttempts: 1,
+		}, {
+			desc: "duplicate",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { fmt.Fprint(w, "7\nduplicate\n") },
+			},
+			want:         SubmitResult{Index: 7, Duplicate: true},
+			wantAttempts: 1,
+		}, {
+			desc: "retries transient failures",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { http.Error(w, "busy", http.StatusServiceUnavailable) },
+				func(w http.ResponseWriter) {
+					w.Header().Set("Retry-After", "0")
+					http.Error(w, "slow down", http.StatusTooManyRequests)
+				},
+				func(w http.ResponseWriter) { fmt.Fprintln(w, "3") },
+			},
+			want:         SubmitResult{Index: 3},
+			wantAttempts: 3,
+		}, {
+			desc: "gives up after max attempts",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { http.Error(w, "busy", http.StatusServiceUnavailable) },
+			},
+			wantAttempts: 3,
+			wantStatus:   http.StatusServiceUnavailable,
+		}, {
+			desc: "does not retry bad request",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { http.Error(w, "nope", http.StatusBadRequest) },
+			},
+			wantAttempts: 1,
+			wantStatus:   http.StatusBadRequest,
+		}, {
+			desc: "malformed response",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { fmt.Fprintln(w, "banana") },
+			},
+			wantAttempts: 1,
+			wantStatus:   -1,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(attempts.Add(1)) - 1
+				if r.Method != http.MethodPost {
+					t.Errorf("got method %s, want POST", r.Method)
+				}
+				if got, want := r.Header.Get("Authorization"), "Bearer sekrit"; got != want {
+					t.Errorf("got Authorization %q, want %q", got, want)
+				}
+				if b, _ := io.ReadAll(r.Body); string(b) != "leaf" {
+					t.Errorf("got body %q, want %q", b, "leaf")
+				}
+				test.responses[min(n, len(test.responses)-1)](w)
+			}))
+			defer srv.Close()
+			u, _ := url.Parse(srv.URL + "/add")
+
+			s := NewSubmitter(u, WithHTTPClient(srv.Client()), WithBearerToken("sekrit"), WithSubmitRetry(fastRetry))
+			got, err := s.Submit(context.Background(), []byte("leaf"))
+			if got, want := attempts.Load(), test.wantAttempts; got != want {
+				t.Errorf("made %d attempts, want %d", got, want)
+			}
+			var sErr SubmitError
+			switch {
+			case test.wantStatus == 0 && err != nil:
+				t.Fatalf("Submit: %v", err)
+			case test.wantStatus > 0 && (!errors.As(err, &sErr) || sErr.StatusCode != test.wantStatus):
+				t.Fatalf("Submit: got err %v, want status %d", err, test.wantStatus)
+			case test.wantStatus < 0 && err == nil:
+				t.Fatal("Submit: got no error")
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSubmitAndAwait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	h := rfc6962.DefaultHasher
+	const index = 7
+
+	shim := fetchCheckpointShim{Checkpoints: [][]byte{testRawCheckpoints[5], testRawCheckpoints[6], testRawCheckpoints[9]}}
+	f := func(ctx context.Context, p string) ([]byte, error) {
+		r, err := shim.Fetcher(testLogFetcher)(ctx, p)
+		if strings.HasSuffix(p, "checkpoint") && len(shim.Checkpoints) > 1 {
+			shim.Advance()
+		}
+		return r, err
+	}
+	lst, err := NewLogStateTracker(ctx, f, h, nil, testLogVerifier, testOrigin, UnilateralConsensus(f))
+	if err != nil {
+		t.Fatalf("NewLogStateTracker: %v", err)
+	}
+	leaf, err := GetLeaf(ctx, testLogFetcher, index)
+	if err != nil {
+		t.Fatalf("GetLeaf: %v", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, index)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/add")
+
+	s := NewSubmitter(u, WithHTTPClient(srv.Client()))
+	r, p, err := s.SubmitAndAwait(ctx, &lst, leaf)
+	if err != nil {
+		t.Fatalf("SubmitAndAwait: %v", err)
+	}
+	if r.Index != index {
+		t.Errorf("got index %d, want %d", r.Index, index)
+	}
+	if len(p) == 0 {
+		t.Error("got empty inclusion proof")
+	}
+	if got := lst.LatestConsistent.Size; got != 9 {
+		t.Errorf("got tracker size %d, want 9", got)
+	}
+
+	// A leaf which doesn't match the one at the returned index must not verify.
+	if _, _, err := s.SubmitAndAwait(ctx, &lst, []byte("banana")); err == nil {
+		t.Error("SubmitAndAwait: got no error for mismatched leaf")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for _, test := range []struct {
+		v    string
+		want time.Duration
+	}{
+		{v: "", want: 0},
+		{v: "3", want: 3 * time.Second},
+		{v: "banana", want: 0},
+	} {
+		if got := parseRetryAfter(test.v); got != test.want {
+			t.Errorf("parseRetryAfter(%q): got %v, want %v", test.v, got, test.want)
+		}
+	}
+	if got := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); got <= 0 || got > time.Hour {
+		t.Errorf("parseRetryAfter(date): got %v, want (0, 1h]", got)
+	}
+}
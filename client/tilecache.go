@@ -0,0 +1,174 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"golang.org/x/sync/singleflight"
+)
+
+// TileCache is a size limited cache of log tiles which can be shared between
+// ProofBuilders, so that proofs for nearby leaves, or for successive checkpoints
+// of the same log, don't repeatedly fetch the same tiles.
+//
+// Concurrent requests for a tile which isn't cached are merged into a single
+// fetch, whose result is shared by all of the requesters.
+//
+// A TileCache must only be used with a single log. It is safe for concurrent use.
+type TileCache struct {
+	maxTiles int
+	inflight singleflight.Group
+
+	mu    sync.Mutex
+	lru   *list.List
+	tiles map[tileCacheKey]*list.Element
+	stats TileCacheStats
+}
+
+// tileCacheKey identifies a tile.
+// Partial tiles are keyed by their width, since a partial tile's contents are
+// only fixed for a given number of leaves.
+type tileCacheKey struct {
+	level, index, width uint64
+}
+
+// tileCacheEntry is the value stored in the TileCache LRU list.
+type tileCacheEntry struct {
+	key  tileCacheKey
+	tile *api.Tile
+}
+
+// TileCacheStats holds counters describing the effectiveness of a TileCache.
+type TileCacheStats struct {
+	// Hits is the number of tile requests served from the cache.
+	Hits uint64
+	// Misses is the number of tile requests which had to be fetched.
+	Misses uint64
+	// Evictions is the number of tiles dropped from the cache to make space for others.
+	Evictions uint64
+	// Coalesced is the number of Misses which were served by waiting for
+	// another requester's fetch of the same tile, rather than fetching it.
+	Coalesced uint64
+}
+
+// HitRate returns the fraction of tile requests which were served from the cache.
+func (s TileCacheStats) HitRate() float64 {
+	if t := s.Hits + s.Misses; t > 0 {
+		return float64(s.Hits) / float64(t)
+	}
+	return 0
+}
+
+// NewTileCache creates a TileCache which holds up to maxTiles tiles, evicting
+// the least recently used tiles once full.
+func NewTileCache(maxTiles int) *TileCache {
+	return &TileCache{
+		maxTiles: maxTiles,
+		lru:      list.New(),
+		tiles:    make(map[tileCacheKey]*list.Element),
+	}
+}
+
+// WithTileCache causes the ProofBuilder to look for tiles in c before fetching them,
+// and to add tiles it fetches to c.
+func WithTileCache(c *TileCache) ProofBuilderOption {
+	return func(pb *ProofBuilder) {
+		pb.tileCache = c
+	}
+}
+
+// Stats returns a snapshot of the cache's counters.
+func (c *TileCache) Stats() TileCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Len returns the number of tiles currently held in the cache.
+func (c *TileCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// wrap returns a GetTileFunc which serves tiles for a log of the given size from
+// the cache, delegating to f on a miss.
+//
+// A nil TileCache returns f unchanged.
+func (c *TileCache) wrap(f GetTileFunc, logSize uint64) GetTileFunc {
+	if c == nil {
+		return f
+	}
+	return func(ctx context.Context, level, index uint64) (*api.Tile, error) {
+		k := tileCacheKey{level: level, index: index, width: layout.PartialTileSize(level, index, logSize)}
+		if t := c.get(k); t != nil {
+			return t, nil
+		}
+		var fetched bool
+		t, err := coalesce(ctx, &c.inflight, fmt.Sprintf("%d/%d/%d", k.level, k.index, k.width), func() (*api.Tile, error) {
+			fetched = true
+			t, err := f(ctx, level, index)
+			if err != nil {
+				return nil, err
+			}
+			c.put(k, t)
+			return t, nil
+		})
+		if !fetched {
+			c.mu.Lock()
+			c.stats.Coalesced++
+			c.mu.Unlock()
+		}
+		return t, err
+	}
+}
+
+// get returns the cached tile for k, or nil if it isn't present.
+func (c *TileCache) get(k tileCacheKey) *api.Tile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.tiles[k]
+	if !ok {
+		c.stats.Misses++
+		return nil
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(e)
+	return e.Value.(*tileCacheEntry).tile
+}
+
+// put adds the tile t to the cache, evicting old tiles if necessary.
+func (c *TileCache) put(k tileCacheKey, t *api.Tile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.tiles[k]; ok {
+		// Another caller fetched the same tile concurrently.
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.tiles[k] = c.lru.PushFront(&tileCacheEntry{key: k, tile: t})
+	for c.lru.Len() > c.maxTiles {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.tiles, e.Value.(*tileCacheEntry).key)
+		c.stats.Evictions++
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api"
+)
+
+func TestTileCacheSharedBetweenProofBuilders(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	cf := newCountingFetcher(testLogFetcher)
+	c := NewTileCache(10)
+
+	newPB := func(size int) *ProofBuilder {
+		t.Helper()
+		pb, err := NewProofBuilder(ctx, testCheckpoints[size], h.HashChildren, cf.Fetch, WithTileCache(c))
+		if err != nil {
+			t.Fatalf("NewProofBuilder: %v", err)
+		}
+		if _, err := pb.InclusionProof(ctx, 3); err != nil {
+			t.Fatalf("InclusionProof: %v", err)
+		}
+		return pb
+	}
+
+	newPB(10)
+	fetches := cf.total()
+	if fetches == 0 {
+		t.Fatal("first proof builder made no fetches")
+	}
+	newPB(10)
+	if got := cf.total(); got != fetches {
+		t.Errorf("second proof builder for same size made %d fetches, want 0", got-fetches)
+	}
+	s := c.Stats()
+	if s.Hits == 0 || s.Misses == 0 {
+		t.Errorf("got stats %+v, want both hits and misses", s)
+	}
+	if r := s.HitRate(); r <= 0 || r >= 1 {
+		t.Errorf("got hit rate %f, want in (0, 1)", r)
+	}
+
+	// The partial tiles for a different log size must not be served from the cache.
+	newPB(14)
+	if got := cf.total(); got == fetches {
+		t.Error("proof builder for larger log made no fetches")
+	}
+}
+
+func TestTileCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	fetches := 0
+	f := func(_ context.Context, level, index uint64) (*api.Tile, error) {
+		fetches++
+		return &api.Tile{NumLeaves: uint(index)}, nil
+	}
+	c := NewTileCache(2)
+	gt := c.wrap(f, 256*10)
+
+	for _, i := range []uint64{0, 1, 0, 2, 1, 0} {
+		tile, err := gt(ctx, 0, i)
+		if err != nil {
+			t.Fatalf("GetTile(%d): %v", i, err)
+		}
+		if tile.NumLeaves != uint(i) {
+			t.Fatalf("GetTile(%d) returned tile %d", i, tile.NumLeaves)
+		}
+	}
+	// 0 and 1 are fetched, 0 hits, 2 evicts 1, 1 evicts 0, 0 evicts 2.
+	if want := 5; fetches != want {
+		t.Errorf("got %d fetches, want %d", fetches, want)
+	}
+	if got, want := c.Stats(), (TileCacheStats{Hits: 1, Misses: 5, Evictions: 3}); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+	if got := c.Len(); got != 2 {
+		t.Errorf("got %d cached tiles, want 2", got)
+	}
+}
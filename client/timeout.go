@@ -0,0 +1,81 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TimeoutFetcher returns a Fetcher which bounds each call to f to at most d,
+// independently of any deadline on the caller's context or timeout configured
+// in the underlying transport.
+//
+// If a request takes longer than d an error wrapping ErrFetchTimeout is
+// returned, which is retryable, so a RetryFetcher wrapping the returned Fetcher
+// will make a fresh attempt. The context passed to f is cancelled at that
+// point, but since f may not honour it, the result of an abandoned call is
+// simply discarded once it completes.
+//
+// If d is <= 0, f is returned unmodified.
+func TimeoutFetcher(f Fetcher, d time.Duration) Fetcher {
+	if d <= 0 {
+		return f
+	}
+	return func(ctx context.Context, path string) ([]byte, error) {
+		rctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+
+		type result struct {
+			b   []byte
+			err error
+		}
+		c := make(chan result, 1)
+		go func() {
+			b, err := f(rctx, path)
+			c <- result{b, err}
+		}()
+		select {
+		case r := <-c:
+			if r.err != nil && ctx.Err() == nil && rctx.Err() != nil {
+				return nil, fmt.Errorf("%w: request for %q took longer than %v: %v", ErrFetchTimeout, path, d, r.err)
+			}
+			return r.b, r.err
+		case <-rctx.Done():
+			if err := ctx.Err(); err != nil {
+				// The caller has given up, rather than the request timing out.
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: request for %q took longer than %v", ErrFetchTimeout, path, d)
+		}
+	}
+}
+
+// TimeoutMiddleware returns a Middleware which bounds each request to at most
+// d, see TimeoutFetcher.
+func TimeoutMiddleware(d time.Duration) Middleware {
+	return func(f Fetcher) Fetcher {
+		return TimeoutFetcher(f, d)
+	}
+}
+
+// WithFetchTimeout bounds each request the ProofBuilder makes to at most d, see
+// TimeoutFetcher.
+func WithFetchTimeout(d time.Duration) ProofBuilderOption {
+	return func(pb *ProofBuilder) {
+		pb.timeout = d
+	}
+}
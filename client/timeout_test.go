@@ -0,0 +1,119 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// hangingFetcher returns a Fetcher which never returns for paths with the given
+// prefix, even if its context is cancelled, and otherwise delegates to f.
+func hangingFetcher(f Fetcher, prefix string, calls *atomic.Int32) Fetcher {
+	block := make(chan struct{})
+	return func(ctx context.Context, p string) ([]byte, error) {
+		if strings.HasPrefix(p, prefix) && calls.Add(1) == 1 {
+			<-block
+		}
+		return f(ctx, p)
+	}
+}
+
+func TestTimeoutFetcher(t *testing.T) {
+	slow := func(ctx context.Context, p string) ([]byte, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+			return testLogFetcher(ctx, p)
+		}
+	}
+	for _, test := range []struct {
+		desc    string
+		f       Fetcher
+		d       time.Duration
+		ctxD    time.Duration
+		wantErr error
+	}{
+		{
+			desc: "fast enough",
+			f:    testLogFetcher,
+			d:    time.Second,
+		}, {
+			desc: "disabled",
+			f:    testLogFetcher,
+		}, {
+			desc:    "honours context",
+			f:       slow,
+			d:       10 * time.Millisecond,
+			wantErr: ErrFetchTimeout,
+		}, {
+			desc:    "ignores context",
+			f:       hangingFetcher(testLogFetcher, "", &atomic.Int32{}),
+			d:       10 * time.Millisecond,
+			wantErr: ErrFetchTimeout,
+		}, {
+			desc:    "caller gives up first",
+			f:       slow,
+			d:       time.Minute,
+			ctxD:    10 * time.Millisecond,
+			wantErr: context.DeadlineExceeded,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			ctx := context.Background()
+			if test.ctxD > 0 {
+				var cancel func()
+				ctx, cancel = context.WithTimeout(ctx, test.ctxD)
+				defer cancel()
+			}
+			_, err := TimeoutFetcher(test.f, test.d)(ctx, "checkpoint")
+			if test.wantErr == nil {
+				if err != nil {
+					t.Fatalf("fetch: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("fetch: got err %v, want %v", err, test.wantErr)
+			}
+			if got, want := IsRetryable(err), test.wantErr == ErrFetchTimeout; got != want {
+				t.Errorf("IsRetryable(%v): got %t, want %t", err, got, want)
+			}
+		})
+	}
+}
+
+func TestProofBuilderFetchTimeout(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	f := hangingFetcher(testLogFetcher, "tile/", &calls)
+
+	_, err := NewProofBuilder(ctx, testCheckpoints[11], rfc6962.DefaultHasher.HashChildren, f, WithFetchTimeout(10*time.Millisecond))
+	if !errors.Is(err, ErrFetchTimeout) {
+		t.Fatalf("NewProofBuilder: got err %v, want %v", err, ErrFetchTimeout)
+	}
+	// Only the first request hangs, so retrying succeeds.
+	f = RetryFetcher(TimeoutFetcher(f, 10*time.Millisecond), RetryOpts{InitialBackoff: time.Millisecond})
+	if _, err := NewProofBuilder(ctx, testCheckpoints[11], rfc6962.DefaultHasher.HashChildren, f); err != nil {
+		t.Fatalf("NewProofBuilder with retries: %v", err)
+	}
+}
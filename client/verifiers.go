@@ -0,0 +1,193 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/transparency-dev/formats/log"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// LogVerifiers describes the set of keys which may sign a log's checkpoints.
+//
+// This allows checkpoints to remain verifiable across rotations of the log's
+// signing key: during a dual-signing transition period both the old and new
+// keys can be configured as Optional, and once the rotation is complete the
+// new key can be made Required.
+type LogVerifiers struct {
+	// Required holds verifiers for keys which must all have signed a checkpoint
+	// for it to be accepted.
+	Required []note.Verifier
+	// Optional holds verifiers for additional keys which are trusted to sign
+	// checkpoints. If Required is empty, a checkpoint must be signed by at least
+	// one of these keys.
+	Optional []note.Verifier
+}
+
+// ParseLogVerifiers parses a list of log verifier keys in the format used by
+// NewLogVerifier, one per line, as found in the public key files used by the
+// tools in this repo.
+//
+// Keys are Required unless their line is prefixed with "optional ", so a file
+// holding a single key requires checkpoints to be signed by that key. Blank
+// lines and lines starting with "#" are ignored.
+func ParseLogVerifiers(keys []byte) (LogVerifiers, error) {
+	var lv LogVerifiers
+	for i, l := range strings.Split(string(keys), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		k, optional := strings.CutPrefix(l, "optional ")
+		v, err := NewLogVerifier(strings.TrimSpace(k))
+		if err != nil {
+			return LogVerifiers{}, fmt.Errorf("invalid key on line %d: %v", i+1, err)
+		}
+		if optional {
+			lv.Optional = append(lv.Optional, v)
+		} else {
+			lv.Required = append(lv.Required, v)
+		}
+	}
+	if len(lv.All()) == 0 {
+		return LogVerifiers{}, errors.New("no log verifier keys found")
+	}
+	return lv, nil
+}
+
+// algECDSA is the note key algorithm identifier for ECDSA P-256 keys.
+const algECDSA = 0x02
+
+// NewLogVerifier returns a verifier for the note verifier key vkey.
+//
+// In addition to the Ed25519 keys supported by note.NewVerifier, ECDSA P-256
+// keys are supported, as used by logs whose signing keys are held in a cloud
+// KMS. These keys use algorithm identifier 0x02 followed by the PKIX, ASN.1
+// DER encoded public key, and their signatures are ASN.1 encoded signatures
+// over the SHA-256 digest of the note text.
+func NewLogVerifier(vkey string) (note.Verifier, error) {
+	name, rest, _ := strings.Cut(vkey, "+")
+	hash, key64, _ := strings.Cut(rest, "+")
+	key, err := base64.StdEncoding.DecodeString(key64)
+	if err != nil || len(key) == 0 || key[0] != algECDSA {
+		return note.NewVerifier(vkey)
+	}
+	h, err := strconv.ParseUint(hash, 16, 32)
+	if err != nil || len(hash) != 8 || name == "" || strings.ContainsAny(name, " \t\n+") {
+		return nil, errors.New("malformed verifier id")
+	}
+	k, err := x509.ParsePKIXPublicKey(key[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ECDSA public key: %v", err)
+	}
+	pk, ok := k.(*ecdsa.PublicKey)
+	if !ok || pk.Curve != elliptic.P256() {
+		return nil, errors.New("ECDSA keys must be P-256")
+	}
+	kh := sha256.New()
+	kh.Write([]byte(name))
+	kh.Write([]byte{'\n'})
+	kh.Write(key)
+	if binary.BigEndian.Uint32(kh.Sum(nil)) != uint32(h) {
+		return nil, errors.New("invalid verifier hash")
+	}
+	return &ecdsaVerifier{name: name, hash: uint32(h), key: pk}, nil
+}
+
+// ecdsaVerifier is a note.Verifier for ECDSA P-256 note signatures.
+type ecdsaVerifier struct {
+	name string
+	hash uint32
+	key  *ecdsa.PublicKey
+}
+
+// Name returns the name of the key.
+func (v *ecdsaVerifier) Name() string { return v.name }
+
+// KeyHash returns the note key hash of the key.
+func (v *ecdsaVerifier) KeyHash() uint32 { return v.hash }
+
+// Verify checks that sig is a valid signature over msg.
+func (v *ecdsaVerifier) Verify(msg, sig []byte) bool {
+	d := sha256.Sum256(msg)
+	return ecdsa.VerifyASN1(v.key, d[:], sig)
+}
+
+// All returns all of the configured verifiers, Required ones first.
+func (lv LogVerifiers) All() []note.Verifier {
+	return append(append(make([]note.Verifier, 0, len(lv.Required)+len(lv.Optional)), lv.Required...), lv.Optional...)
+}
+
+// ParseCheckpoint parses the raw checkpoint, checking that it carries signatures
+// from all of the Required keys, and at least one of the configured keys.
+// Any otherVerifiers (e.g. witnesses) are also used to verify signatures on the
+// returned note, but are not considered when checking the log's signatures.
+func (lv LogVerifiers) ParseCheckpoint(cpRaw []byte, origin string, otherVerifiers ...note.Verifier) (*log.Checkpoint, []byte, *note.Note, error) {
+	all := lv.All()
+	if len(all) == 0 {
+		return nil, nil, nil, errors.New("no log verifiers configured")
+	}
+	n, err := note.Open(cpRaw, note.VerifierList(append(all, otherVerifiers...)...))
+	if err != nil {
+		if isSigError(err) {
+			return nil, nil, nil, fmt.Errorf("%w: failed to verify signatures on checkpoint: %v", ErrBadSignature, err)
+		}
+		return nil, nil, nil, fmt.Errorf("%w: failed to open checkpoint: %v", ErrMalformedCheckpoint, err)
+	}
+	for _, v := range lv.Required {
+		if !hasSig(n, v) {
+			return nil, nil, n, fmt.Errorf("%w: checkpoint missing required signature from %q (%08x)", ErrBadSignature, v.Name(), v.KeyHash())
+		}
+	}
+	signed := false
+	for _, v := range all {
+		if hasSig(n, v) {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return nil, nil, n, fmt.Errorf("%w: no log signature found on note", ErrBadSignature)
+	}
+	cp := &log.Checkpoint{}
+	otherData, err := cp.Unmarshal([]byte(n.Text))
+	if err != nil {
+		return nil, nil, n, fmt.Errorf("%w: failed to unmarshal checkpoint: %v", ErrMalformedCheckpoint, err)
+	}
+	if cp.Origin != origin {
+		return nil, nil, n, fmt.Errorf("%w: got Origin %q but expected %q", ErrMalformedCheckpoint, cp.Origin, origin)
+	}
+	return cp, otherData, n, nil
+}
+
+// hasSig returns true if n has a verified signature from v.
+func hasSig(n *note.Note, v note.Verifier) bool {
+	for _, s := range n.Sigs {
+		if s.Name == v.Name() && s.Hash == v.KeyHash() {
+			return true
+		}
+	}
+	return false
+}
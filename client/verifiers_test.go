@@ -0,0 +1,182 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// resignCheckpoint returns cp signed by the provided signers.
+func resignCheckpoint(t *testing.T, cp log.Checkpoint, sigs ...note.Signer) []byte {
+	t.Helper()
+	r, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, sigs...)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return r
+}
+
+func TestLogVerifiersParseCheckpoint(t *testing.T) {
+	oldS, oldV := genKeyPair(t, "log")
+	newS, newV := genKeyPair(t, "log")
+	otherS, _ := genKeyPair(t, "other")
+	cp := testCheckpoints[4]
+
+	for _, test := range []struct {
+		desc    string
+		lv      LogVerifiers
+		cp      []byte
+		wantErr bool
+	}{
+		{
+			desc: "optional old key",
+			lv:   LogVerifiers{Optional: []note.Verifier{oldV, newV}},
+			cp:   resignCheckpoint(t, cp, oldS),
+		}, {
+			desc: "optional new key",
+			lv:   LogVerifiers{Optional: []note.Verifier{oldV, newV}},
+			cp:   resignCheckpoint(t, cp, newS),
+		}, {
+			desc: "required present",
+			lv:   LogVerifiers{Required: []note.Verifier{newV}, Optional: []note.Verifier{oldV}},
+			cp:   resignCheckpoint(t, cp, oldS, newS),
+		}, {
+			desc:    "required missing",
+			lv:      LogVerifiers{Required: []note.Verifier{newV}, Optional: []note.Verifier{oldV}},
+			cp:      resignCheckpoint(t, cp, oldS),
+			wantErr: true,
+		}, {
+			desc:    "unknown key",
+			lv:      LogVerifiers{Optional: []note.Verifier{oldV, newV}},
+			cp:      resignCheckpoint(t, cp, otherS),
+			wantErr: true,
+		}, {
+			desc:    "no verifiers",
+			cp:      resignCheckpoint(t, cp, oldS),
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, _, _, err := test.lv.ParseCheckpoint(test.cp, testOrigin)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseCheckpoint: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if err == nil && (got.Size != cp.Size || !bytes.Equal(got.Hash, cp.Hash)) {
+				t.Errorf("got checkpoint %+v, want %+v", got, cp)
+			}
+		})
+	}
+}
+
+func TestTrackerKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	oldS, oldV := genKeyPair(t, "log")
+	newS, newV := genKeyPair(t, "log")
+
+	shim := fetchCheckpointShim{Checkpoints: [][]byte{
+		// Dual-signing transition period.
+		resignCheckpoint(t, testCheckpoints[6], oldS, newS),
+		// Rotation complete.
+		resignCheckpoint(t, testCheckpoints[9], newS),
+	}}
+	f := shim.Fetcher(testLogFetcher)
+	lv := LogVerifiers{Optional: []note.Verifier{oldV, newV}}
+	lst, err := NewLogStateTrackerWithVerifiers(ctx, f, rfc6962.DefaultHasher, resignCheckpoint(t, testCheckpoints[3], oldS), lv, testOrigin, UnilateralConsensus(f))
+	if err != nil {
+		t.Fatalf("NewLogStateTrackerWithVerifiers: %v", err)
+	}
+	for _, want := range []uint64{6, 9} {
+		if _, _, _, err := lst.Update(ctx); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if got := lst.LatestConsistent.Size; got != want {
+			t.Errorf("tracker at size %d, want %d", got, want)
+		}
+		shim.Advance()
+	}
+
+	// Once the new key is required, checkpoints signed only by the old key must be rejected.
+	shim = fetchCheckpointShim{Checkpoints: [][]byte{resignCheckpoint(t, testCheckpoints[10], oldS)}}
+	f = shim.Fetcher(testLogFetcher)
+	lv = LogVerifiers{Required: []note.Verifier{newV}, Optional: []note.Verifier{oldV}}
+	lst, err = NewLogStateTrackerWithVerifiers(ctx, f, rfc6962.DefaultHasher, resignCheckpoint(t, testCheckpoints[3], newS), lv, testOrigin, UnilateralConsensus(f))
+	if err != nil {
+		t.Fatalf("NewLogStateTrackerWithVerifiers: %v", err)
+	}
+	if _, _, _, err := lst.Update(ctx); err == nil {
+		t.Error("Update with checkpoint missing required signature: got no error, want error")
+	}
+}
+
+func TestParseLogVerifiers(t *testing.T) {
+	_, oldKey, err := note.GenerateKey(nil, "log")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	_, newKey, err := note.GenerateKey(nil, "log")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc         string
+		keys         string
+		wantRequired int
+		wantOptional int
+		wantErr      bool
+	}{
+		{
+			desc:         "single key",
+			keys:         oldKey + "\n",
+			wantRequired: 1,
+		}, {
+			desc:         "rotation",
+			keys:         "# Old key\n" + oldKey + "\n\noptional " + newKey + "\n",
+			wantRequired: 1,
+			wantOptional: 1,
+		}, {
+			desc:         "all optional",
+			keys:         "optional " + oldKey + "\noptional " + newKey,
+			wantOptional: 2,
+		}, {
+			desc:    "bad key",
+			keys:    oldKey + "\nbanana\n",
+			wantErr: true,
+		}, {
+			desc:    "no keys",
+			keys:    "# Nothing here\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			lv, err := ParseLogVerifiers([]byte(test.keys))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseLogVerifiers: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if got := len(lv.Required); got != test.wantRequired {
+				t.Errorf("got %d required verifiers, want %d", got, test.wantRequired)
+			}
+			if got := len(lv.Optional); got != test.wantOptional {
+				t.Errorf("got %d optional verifiers, want %d", got, test.wantOptional)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/proof"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// GetVerifiedLeaf fetches the leaf at the given index, and verifies that it is
+// committed to by the tracker's LatestConsistent checkpoint.
+//
+// Returns the raw leaf data, along with the verified inclusion proof.
+func GetVerifiedLeaf(ctx context.Context, lst *LogStateTracker, index uint64) ([]byte, [][]byte, error) {
+	st := lst.State()
+	cp := st.Checkpoint
+	if index >= cp.Size {
+		return nil, nil, fmt.Errorf("leaf index %d is outside of tracked log size %d", index, cp.Size)
+	}
+	leaf, err := layoutOrDefault(lst.Layout).GetLeaf(ctx, lst.Fetcher, index, cp.Size)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := verifiedInclusionProof(ctx, lst, st, index, lst.Hasher.HashLeaf(leaf))
+	if err != nil {
+		return nil, nil, err
+	}
+	return leaf, p, nil
+}
+
+// GetVerifiedLeaves fetches the leaves at each of the given indices, and
+// verifies that they are committed to by the tracker's LatestConsistent
+// checkpoint.
+//
+// The tiles needed to verify all of the leaves are fetched only once, see
+// ProofBuilder.InclusionProofs, which makes this much cheaper than calling
+// GetVerifiedLeaf for each of a large number of nearby leaves.
+//
+// Returns the raw leaf data, along with the verified inclusion proofs, in the
+// same order as indices.
+func GetVerifiedLeaves(ctx context.Context, lst *LogStateTracker, indices []uint64) ([][]byte, [][][]byte, error) {
+	st := lst.State()
+	cp := st.Checkpoint
+	l := layoutOrDefault(lst.Layout)
+	leaves := make([][]byte, len(indices))
+	for i, index := range indices {
+		if index >= cp.Size {
+			return nil, nil, fmt.Errorf("leaf index %d is outside of tracked log size %d", index, cp.Size)
+		}
+		leaf, err := l.GetLeaf(ctx, lst.Fetcher, index, cp.Size)
+		if err != nil {
+			return nil, nil, err
+		}
+		leaves[i] = leaf
+	}
+
+	pb := st.ProofBuilder
+	if pb == nil || pb.cp.Size != cp.Size {
+		var err error
+		pb, err = NewProofBuilder(ctx, cp, lst.Hasher.HashChildren, lst.Fetcher, lst.proofBuilderOpts()...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create proof builder: %w", err)
+		}
+	}
+	ps, err := pb.InclusionProofs(ctx, indices)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build inclusion proofs: %w", err)
+	}
+	m := metricsOrNop(lst.Metrics)
+	for i, index := range indices {
+		err := proof.VerifyInclusion(lst.Hasher, index, cp.Size, lst.Hasher.HashLeaf(leaves[i]), ps[i], cp.Hash)
+		m.ProofVerified(InclusionProof, err)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to verify inclusion of leaf %d in log of size %d: %v", ErrProofMismatch, index, cp.Size, err)
+		}
+	}
+	return leaves, ps, nil
+}
+
+// verifiedInclusionProof builds an inclusion proof for the leaf hash at index,
+// and verifies it against the checkpoint in st, a snapshot of lst's state.
+func verifiedInclusionProof(ctx context.Context, lst *LogStateTracker, st TrackerState, index uint64, leafHash []byte) ([][]byte, error) {
+	cp := st.Checkpoint
+	pb := st.ProofBuilder
+	if pb == nil || pb.cp.Size != cp.Size {
+		var err error
+		pb, err = NewProofBuilder(ctx, cp, lst.Hasher.HashChildren, lst.Fetcher, lst.proofBuilderOpts()...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create proof builder: %w", err)
+		}
+	}
+	p, err := pb.InclusionProof(ctx, index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build inclusion proof for leaf %d: %w", index, err)
+	}
+	err = proof.VerifyInclusion(lst.Hasher, index, cp.Size, leafHash, p, cp.Hash)
+	metricsOrNop(lst.Metrics).ProofVerified(InclusionProof, err)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to verify inclusion of leaf %d in log of size %d: %v", ErrProofMismatch, index, cp.Size, err)
+	}
+	return p, nil
+}
+
+// CheckRawConsistency verifies that two signed checkpoints, in any order, are
+// consistent with one another, fetching the required proof from the log via f.
+//
+// This is useful for auditing pairs of checkpoints collected from sources other
+// than the log itself, e.g. witnesses or gossip. Both checkpoints must be for
+// the log identified by origin, and signed by v.
+//
+// Returns the consistency proof from the smaller to the larger checkpoint, or
+// an ErrInconsistency if the checkpoints are not consistent.
+func CheckRawConsistency(ctx context.Context, h merkle.LogHasher, f Fetcher, v note.Verifier, origin string, aRaw, bRaw []byte) ([][]byte, error) {
+	a, aRaw, b, bRaw, err := parseRawPair(v, origin, aRaw, bRaw)
+	if err != nil {
+		return nil, err
+	}
+	if a.Size == b.Size || a.Size == 0 {
+		// Checkpoints are trivially consistent.
+		return [][]byte{}, nil
+	}
+
+	pb, err := NewProofBuilder(ctx, *b, h.HashChildren, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create proof builder: %w", err)
+	}
+	p, err := pb.ConsistencyProof(ctx, a.Size, b.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build consistency proof between sizes %d, %d: %w", a.Size, b.Size, err)
+	}
+	if err := proof.VerifyConsistency(h, a.Size, b.Size, p, a.Hash, b.Hash); err != nil {
+		return nil, ErrInconsistency{
+			SmallerRaw: aRaw,
+			LargerRaw:  bRaw,
+			Proof:      p,
+			Wrapped:    err,
+		}
+	}
+	return p, nil
+}
+
+// VerifyInclusionAgainst verifies that the leaf hash at index is committed to
+// by the signed checkpoint cpRaw, using the inclusion proof p.
+//
+// Unlike GetVerifiedLeaf, nothing is fetched from the log, so this is suitable
+// for callers who receive the checkpoint and proof out-of-band, e.g. by email,
+// gossip, or from a witness. The checkpoint must be for the log identified by
+// origin, and signed by v.
+//
+// Returns the verified checkpoint. An error wrapping ErrProofMismatch is
+// returned if the proof does not verify.
+func VerifyInclusionAgainst(h merkle.LogHasher, v note.Verifier, origin string, cpRaw []byte, index uint64, leafHash []byte, p [][]byte) (*log.Checkpoint, error) {
+	cp, _, _, err := parseCheckpoint("checkpoint", cpRaw, origin, v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	if err := proof.VerifyInclusion(h, index, cp.Size, leafHash, p, cp.Hash); err != nil {
+		return nil, fmt.Errorf("%w: failed to verify inclusion of leaf %d in log of size %d: %v", ErrProofMismatch, index, cp.Size, err)
+	}
+	return cp, nil
+}
+
+// InclusionBundle is a self-contained claim that a leaf is included in a log,
+// e.g. as exported by the client tool's --output_bundle flag, which can be
+// verified offline with Verify.
+type InclusionBundle struct {
+	// Checkpoint is the signed checkpoint note.
+	Checkpoint []byte
+	// Index is the index of the leaf in the log.
+	Index uint64
+	// Leaf is the leaf's data, if known.
+	Leaf []byte
+	// LeafHash is the leaf's hash. It may be omitted if Leaf is set, and
+	// otherwise must be the hash of Leaf.
+	LeafHash []byte
+	// Proof is the inclusion proof from the leaf to the checkpoint's root.
+	Proof [][]byte
+}
+
+// Verify checks, using only the log's keys, that the bundle's leaf is committed
+// to by its checkpoint. The checkpoint must be for the log identified by
+// origin, signed as required by lv, and if witnesses is non-nil, carry enough
+// witness cosignatures to satisfy its policy.
+//
+// Returns the verified checkpoint and leaf hash. An error wrapping
+// ErrProofMismatch is returned if the proof does not verify.
+func (b InclusionBundle) Verify(h merkle.LogHasher, lv LogVerifiers, origin string, witnesses *WitnessConfig) (*log.Checkpoint, []byte, error) {
+	var wvs []note.Verifier
+	if witnesses != nil {
+		wvs = witnesses.Witnesses
+	}
+	cp, _, n, err := lv.ParseCheckpoint(b.Checkpoint, origin, wvs...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to verify checkpoint: %w", err)
+	}
+	if witnesses != nil {
+		if err := witnesses.Policy.Check(n, wvs...); err != nil {
+			return nil, nil, fmt.Errorf("checkpoint does not satisfy witness policy: %w", err)
+		}
+	}
+	lh := b.LeafHash
+	if b.Leaf != nil {
+		lh = h.HashLeaf(b.Leaf)
+		if b.LeafHash != nil && !bytes.Equal(lh, b.LeafHash) {
+			return nil, nil, fmt.Errorf("leaf has hash %x, but bundle has leaf hash %x", lh, b.LeafHash)
+		}
+	}
+	if len(lh) == 0 {
+		return nil, nil, errors.New("bundle has no leaf or leaf hash")
+	}
+	if err := proof.VerifyInclusion(h, b.Index, cp.Size, lh, b.Proof, cp.Hash); err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to verify inclusion of leaf %d in log of size %d: %v", ErrProofMismatch, b.Index, cp.Size, err)
+	}
+	return cp, lh, nil
+}
+
+// VerifyConsistencyAgainst verifies that two signed checkpoints, in any order,
+// are consistent with one another using the consistency proof p, which must be
+// from the smaller to the larger checkpoint.
+//
+// This is the offline counterpart of CheckRawConsistency, for callers who
+// already hold the proof. Both checkpoints must be for the log identified by
+// origin, and signed by v.
+//
+// Returns an ErrInconsistency if the checkpoints are not consistent.
+func VerifyConsistencyAgainst(h merkle.LogHasher, v note.Verifier, origin string, aRaw, bRaw []byte, p [][]byte) error {
+	a, aRaw, b, bRaw, err := parseRawPair(v, origin, aRaw, bRaw)
+	if err != nil {
+		return err
+	}
+	if a.Size == b.Size || a.Size == 0 {
+		if len(p) > 0 {
+			return fmt.Errorf("%w: got %d proof hashes between sizes %d and %d, want none", ErrProofMismatch, len(p), a.Size, b.Size)
+		}
+		return nil
+	}
+	if err := proof.VerifyConsistency(h, a.Size, b.Size, p, a.Hash, b.Hash); err != nil {
+		return ErrInconsistency{
+			SmallerRaw: aRaw,
+			LargerRaw:  bRaw,
+			Proof:      p,
+			Wrapped:    err,
+		}
+	}
+	return nil
+}
+
+// parseRawPair parses and verifies the two signed checkpoints, returning them
+// ordered by size, smallest first.
+//
+// An ErrInconsistency is returned if the checkpoints have the same size but
+// different root hashes.
+func parseRawPair(v note.Verifier, origin string, aRaw, bRaw []byte) (*log.Checkpoint, []byte, *log.Checkpoint, []byte, error) {
+	a, _, _, err := parseCheckpoint("first checkpoint", aRaw, origin, v)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	b, _, _, err := parseCheckpoint("second checkpoint", bRaw, origin, v)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	if a.Size > b.Size {
+		a, b = b, a
+		aRaw, bRaw = bRaw, aRaw
+	}
+	if a.Size == b.Size && !bytes.Equal(a.Hash, b.Hash) {
+		return nil, nil, nil, nil, ErrInconsistency{
+			SmallerRaw: aRaw,
+			LargerRaw:  bRaw,
+			Wrapped:    fmt.Errorf("two checkpoints with same size (%d) but different hashes (%x vs %x)", a.Size, a.Hash, b.Hash),
+		}
+	}
+	return a, aRaw, b, bRaw, nil
+}
@@ -0,0 +1,438 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestGetVerifiedLeaf(t *testing.T) {
+	ctx := context.Background()
+	cpRaw := testRawCheckpoints[10]
+
+	for _, test := range []struct {
+		desc    string
+		f       Fetcher
+		index   uint64
+		wantErr bool
+	}{
+		{
+			desc:  "first leaf",
+			f:     testLogFetcher,
+			index: 0,
+		}, {
+			desc:  "last leaf",
+			f:     testLogFetcher,
+			index: 9,
+		}, {
+			desc:    "beyond checkpoint",
+			f:       testLogFetcher,
+			index:   10,
+			wantErr: true,
+		}, {
+			desc: "tampered leaf",
+			f: func(ctx context.Context, p string) ([]byte, error) {
+				if strings.HasPrefix(p, "seq/") {
+					return []byte("banana"), nil
+				}
+				return testLogFetcher(ctx, p)
+			},
+			index:   4,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			lst, err := NewLogStateTracker(ctx, test.f, rfc6962.DefaultHasher, cpRaw, testLogVerifier, testOrigin, UnilateralConsensus(test.f))
+			if err != nil {
+				t.Fatalf("NewLogStateTracker: %v", err)
+			}
+			leaf, p, err := GetVerifiedLeaf(ctx, &lst, test.index)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("GetVerifiedLeaf: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(leaf) == 0 || len(p) == 0 {
+				t.Errorf("got leaf %q with proof %x, want non-empty", leaf, p)
+			}
+		})
+	}
+}
+
+func TestGetVerifiedLeaves(t *testing.T) {
+	ctx := context.Background()
+	cpRaw := testRawCheckpoints[10]
+
+	for _, test := range []struct {
+		desc    string
+		f       Fetcher
+		indices []uint64
+		wantErr bool
+	}{
+		{
+			desc:    "all leaves",
+			f:       testLogFetcher,
+			indices: []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		}, {
+			desc:    "unordered",
+			f:       testLogFetcher,
+			indices: []uint64{7, 2, 7},
+		}, {
+			desc: "empty",
+			f:    testLogFetcher,
+		}, {
+			desc:    "beyond checkpoint",
+			f:       testLogFetcher,
+			indices: []uint64{3, 10},
+			wantErr: true,
+		}, {
+			desc: "tampered leaf",
+			f: func(ctx context.Context, p string) ([]byte, error) {
+				if strings.HasPrefix(p, "seq/") {
+					return []byte("banana"), nil
+				}
+				return testLogFetcher(ctx, p)
+			},
+			indices: []uint64{4, 5},
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			lst, err := NewLogStateTracker(ctx, test.f, rfc6962.DefaultHasher, cpRaw, testLogVerifier, testOrigin, UnilateralConsensus(test.f))
+			if err != nil {
+				t.Fatalf("NewLogStateTracker: %v", err)
+			}
+			leaves, ps, err := GetVerifiedLeaves(ctx, &lst, test.indices)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("GetVerifiedLeaves: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(leaves) != len(test.indices) || len(ps) != len(test.indices) {
+				t.Fatalf("got %d leaves and %d proofs, want %d", len(leaves), len(ps), len(test.indices))
+			}
+			for i, idx := range test.indices {
+				want, err := GetLeaf(ctx, testLogFetcher, idx)
+				if err != nil {
+					t.Fatalf("GetLeaf(%d): %v", idx, err)
+				}
+				if string(leaves[i]) != string(want) {
+					t.Errorf("leaf %d: got %q, want %q", idx, leaves[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckRawConsistency(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	// A validly signed checkpoint for size 5 which is not consistent with the test log.
+	forkedCP := mustSignCheckpoint(t, testOrigin, 5, []byte("This is a banana, not a root hash"))
+
+	for _, test := range []struct {
+		desc             string
+		a, b             []byte
+		wantErr          bool
+		wantInconsistent bool
+	}{
+		{
+			desc: "in order",
+			a:    testRawCheckpoints[3],
+			b:    testRawCheckpoints[9],
+		}, {
+			desc: "out of order",
+			a:    testRawCheckpoints[14],
+			b:    testRawCheckpoints[2],
+		}, {
+			desc: "same checkpoint",
+			a:    testRawCheckpoints[5],
+			b:    testRawCheckpoints[5],
+		}, {
+			desc: "from empty",
+			a:    testRawCheckpoints[0],
+			b:    testRawCheckpoints[5],
+		}, {
+			desc:    "bad signature",
+			a:       testRawCheckpoints[3],
+			b:       []byte(strings.Replace(string(testRawCheckpoints[9]), "astra", "bad", 1)),
+			wantErr: true,
+		}, {
+			desc:             "fork",
+			a:                forkedCP,
+			b:                testRawCheckpoints[9],
+			wantErr:          true,
+			wantInconsistent: true,
+		}, {
+			desc:             "same size, different hash",
+			a:                forkedCP,
+			b:                testRawCheckpoints[5],
+			wantErr:          true,
+			wantInconsistent: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := CheckRawConsistency(ctx, h, testLogFetcher, testLogVerifier, testOrigin, test.a, test.b)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("CheckRawConsistency: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if got := errors.As(err, &ErrInconsistency{}); got != test.wantInconsistent {
+				t.Errorf("got ErrInconsistency %t, want %t (err: %v)", got, test.wantInconsistent, err)
+			}
+		})
+	}
+}
+
+func TestVerifyInclusionAgainst(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	cpRaw := testRawCheckpoints[10]
+	lst, err := NewLogStateTracker(ctx, testLogFetcher, h, cpRaw, testLogVerifier, testOrigin, UnilateralConsensus(testLogFetcher))
+	if err != nil {
+		t.Fatalf("NewLogStateTracker: %v", err)
+	}
+	leaf, p, err := GetVerifiedLeaf(ctx, &lst, 4)
+	if err != nil {
+		t.Fatalf("GetVerifiedLeaf: %v", err)
+	}
+	leafHash := h.HashLeaf(leaf)
+
+	for _, test := range []struct {
+		desc     string
+		cpRaw    []byte
+		index    uint64
+		leafHash []byte
+		wantErr  error
+	}{
+		{
+			desc:     "valid",
+			cpRaw:    cpRaw,
+			index:    4,
+			leafHash: leafHash,
+		}, {
+			desc:     "wrong index",
+			cpRaw:    cpRaw,
+			index:    5,
+			leafHash: leafHash,
+			wantErr:  ErrProofMismatch,
+		}, {
+			desc:     "wrong leaf",
+			cpRaw:    cpRaw,
+			index:    4,
+			leafHash: h.HashLeaf([]byte("banana")),
+			wantErr:  ErrProofMismatch,
+		}, {
+			desc:     "wrong checkpoint",
+			cpRaw:    testRawCheckpoints[11],
+			index:    4,
+			leafHash: leafHash,
+			wantErr:  ErrProofMismatch,
+		}, {
+			desc:     "bad signature",
+			cpRaw:    []byte(strings.Replace(string(cpRaw), "astra", "bad", 1)),
+			index:    4,
+			leafHash: leafHash,
+			wantErr:  ErrBadSignature,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			cp, err := VerifyInclusionAgainst(h, testLogVerifier, testOrigin, test.cpRaw, test.index, test.leafHash, p)
+			if !errors.Is(err, test.wantErr) || (err != nil) != (test.wantErr != nil) {
+				t.Fatalf("VerifyInclusionAgainst: got err %v, want %v", err, test.wantErr)
+			}
+			if err == nil && cp.Size != 10 {
+				t.Errorf("got checkpoint size %d, want 10", cp.Size)
+			}
+		})
+	}
+}
+
+func TestInclusionBundleVerify(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	cpRaw := testRawCheckpoints[10]
+	lst, err := NewLogStateTracker(ctx, testLogFetcher, h, cpRaw, testLogVerifier, testOrigin, UnilateralConsensus(testLogFetcher))
+	if err != nil {
+		t.Fatalf("NewLogStateTracker: %v", err)
+	}
+	leaf, p, err := GetVerifiedLeaf(ctx, &lst, 4)
+	if err != nil {
+		t.Fatalf("GetVerifiedLeaf: %v", err)
+	}
+	leafHash := h.HashLeaf(leaf)
+	tampered := make([][]byte, len(p))
+	for i := range p {
+		tampered[i] = append([]byte{}, p[i]...)
+	}
+	tampered[0][0] ^= 1
+	// A checkpoint with the log's name and contents, but signed by another key.
+	otherSigner, _ := genKeyPair(t, testLogVerifier.Name())
+	n, err := note.Open(cpRaw, note.VerifierList(testLogVerifier))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	forgedRaw, err := note.Sign(&note.Note{Text: n.Text}, otherSigner)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	_, witV := genKeyPair(t, "witness")
+	lv := LogVerifiers{Required: []note.Verifier{testLogVerifier}}
+
+	for _, test := range []struct {
+		desc      string
+		b         InclusionBundle
+		witnesses *WitnessConfig
+		wantErr   bool
+		wantErrIs error
+	}{
+		{
+			desc: "valid",
+			b:    InclusionBundle{Checkpoint: cpRaw, Index: 4, Leaf: leaf, LeafHash: leafHash, Proof: p},
+		}, {
+			desc: "valid leaf hash only",
+			b:    InclusionBundle{Checkpoint: cpRaw, Index: 4, LeafHash: leafHash, Proof: p},
+		}, {
+			desc: "valid leaf only",
+			b:    InclusionBundle{Checkpoint: cpRaw, Index: 4, Leaf: leaf, Proof: p},
+		}, {
+			desc:      "tampered proof",
+			b:         InclusionBundle{Checkpoint: cpRaw, Index: 4, Leaf: leaf, Proof: tampered},
+			wantErrIs: ErrProofMismatch,
+		}, {
+			desc:      "wrong checkpoint signature",
+			b:         InclusionBundle{Checkpoint: forgedRaw, Index: 4, Leaf: leaf, Proof: p},
+			wantErrIs: ErrBadSignature,
+		}, {
+			desc:      "wrong leaf index",
+			b:         InclusionBundle{Checkpoint: cpRaw, Index: 5, Leaf: leaf, Proof: p},
+			wantErrIs: ErrProofMismatch,
+		}, {
+			desc:      "wrong leaf",
+			b:         InclusionBundle{Checkpoint: cpRaw, Index: 4, Leaf: []byte("banana"), Proof: p},
+			wantErrIs: ErrProofMismatch,
+		}, {
+			desc:    "leaf doesn't match leaf hash",
+			b:       InclusionBundle{Checkpoint: cpRaw, Index: 4, Leaf: []byte("banana"), LeafHash: leafHash, Proof: p},
+			wantErr: true,
+		}, {
+			desc:    "no leaf",
+			b:       InclusionBundle{Checkpoint: cpRaw, Index: 4, Proof: p},
+			wantErr: true,
+		}, {
+			desc:      "witness policy not satisfied",
+			b:         InclusionBundle{Checkpoint: cpRaw, Index: 4, Leaf: leaf, Proof: p},
+			witnesses: &WitnessConfig{Policy: WitnessPolicy{Quorum: 1}, Witnesses: []note.Verifier{witV}},
+			wantErr:   true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			cp, lh, err := test.b.Verify(h, lv, testOrigin, test.witnesses)
+			wantErr := test.wantErr || test.wantErrIs != nil
+			if gotErr := err != nil; gotErr != wantErr {
+				t.Fatalf("Verify: got err %v, want err %t", err, wantErr)
+			}
+			if test.wantErrIs != nil && !errors.Is(err, test.wantErrIs) {
+				t.Fatalf("Verify: got err %v, want %v", err, test.wantErrIs)
+			}
+			if err != nil {
+				return
+			}
+			if cp.Size != 10 {
+				t.Errorf("got checkpoint size %d, want 10", cp.Size)
+			}
+			if !bytes.Equal(lh, leafHash) {
+				t.Errorf("got leaf hash %x, want %x", lh, leafHash)
+			}
+		})
+	}
+}
+
+func TestVerifyConsistencyAgainst(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	p, err := CheckRawConsistency(ctx, h, testLogFetcher, testLogVerifier, testOrigin, testRawCheckpoints[3], testRawCheckpoints[9])
+	if err != nil {
+		t.Fatalf("CheckRawConsistency: %v", err)
+	}
+	forkedCP := mustSignCheckpoint(t, testOrigin, 5, []byte("This is a banana, not a root hash"))
+
+	for _, test := range []struct {
+		desc             string
+		a, b             []byte
+		p                [][]byte
+		wantErr          bool
+		wantInconsistent bool
+	}{
+		{
+			desc: "in order",
+			a:    testRawCheckpoints[3],
+			b:    testRawCheckpoints[9],
+			p:    p,
+		}, {
+			desc: "out of order",
+			a:    testRawCheckpoints[9],
+			b:    testRawCheckpoints[3],
+			p:    p,
+		}, {
+			desc: "same checkpoint",
+			a:    testRawCheckpoints[5],
+			b:    testRawCheckpoints[5],
+		}, {
+			desc:    "unexpected proof",
+			a:       testRawCheckpoints[5],
+			b:       testRawCheckpoints[5],
+			p:       p,
+			wantErr: true,
+		}, {
+			desc:             "wrong proof",
+			a:                testRawCheckpoints[4],
+			b:                testRawCheckpoints[9],
+			p:                p,
+			wantErr:          true,
+			wantInconsistent: true,
+		}, {
+			desc:             "same size, different hash",
+			a:                forkedCP,
+			b:                testRawCheckpoints[5],
+			wantErr:          true,
+			wantInconsistent: true,
+		}, {
+			desc:    "bad signature",
+			a:       testRawCheckpoints[3],
+			b:       []byte(strings.Replace(string(testRawCheckpoints[9]), "astra", "bad", 1)),
+			p:       p,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			err := VerifyConsistencyAgainst(h, testLogVerifier, testOrigin, test.a, test.b, test.p)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("VerifyConsistencyAgainst: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if got := errors.As(err, &ErrInconsistency{}); got != test.wantInconsistent {
+				t.Errorf("got ErrInconsistency %t, want %t (err: %v)", got, test.wantInconsistent, err)
+			}
+		})
+	}
+}
@@ -94,7 +94,7 @@ func getCheckpointN(ctx context.Context, f client.Fetcher, logID string, N int,
 	p := path.Join("logs", logID, fmt.Sprintf("checkpoint.%d", N))
 	cpRaw, err := f(ctx, p)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to fetch from distributor: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to fetch from distributor: %w", err)
 	}
 	cp, _, n, err := fmt_log.ParseCheckpoint(cpRaw, origin, logSigV, witSigVs...)
 	if err != nil {
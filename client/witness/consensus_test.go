@@ -15,7 +15,9 @@
 package witness
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
@@ -165,7 +167,7 @@ type mapFetcher map[string][]byte
 func (f mapFetcher) Fetch(_ context.Context, p string) ([]byte, error) {
 	v, ok := f[p]
 	if !ok {
-		return nil, fmt.Errorf("%q: %v", p, os.ErrNotExist)
+		return nil, fmt.Errorf("%q: %w", p, os.ErrNotExist)
 	}
 	return v, nil
 }
@@ -200,3 +202,136 @@ func genKeyPair(t *testing.T, name string) (note.Signer, note.Verifier) {
 	}
 	return s, v
 }
+
+func TestDistributorConsensus(t *testing.T) {
+	logS, logV := genKeyPair(t, "log")
+	wit1S, wit1V := genKeyPair(t, "w1")
+	wit2S, wit2V := genKeyPair(t, "w2")
+	wit3S, wit3V := genKeyPair(t, "w3")
+	otherS, _ := genKeyPair(t, "other")
+	logID := "test-log"
+	checkpointPath := func(i int) string { return fmt.Sprintf("logs/%s/checkpoint.%d", logID, i) }
+
+	for _, test := range []struct {
+		desc         string
+		distributors []client.Fetcher
+		witnesses    []note.Verifier
+		quorum       int
+		wantErr      bool
+		wantCP       []byte
+	}{
+		{
+			desc:   "single distributor",
+			quorum: 2,
+			distributors: []client.Fetcher{
+				fetcher(map[string][]byte{
+					checkpointPath(2): newCP(t, 11, logS, wit1S, wit2S),
+				}),
+			},
+			witnesses: []note.Verifier{wit1V, wit2V, wit3V},
+			wantCP:    newCP(t, 11, logS, wit1S, wit2S),
+		}, {
+			desc:   "freshest across distributors",
+			quorum: 2,
+			distributors: []client.Fetcher{
+				fetcher(map[string][]byte{
+					checkpointPath(2): newCP(t, 11, logS, wit1S, wit2S),
+				}),
+				fetcher(map[string][]byte{
+					checkpointPath(2): newCP(t, 15, logS, wit2S, wit3S),
+					checkpointPath(3): newCP(t, 12, logS, wit1S, wit2S, wit3S),
+				}),
+			},
+			witnesses: []note.Verifier{wit1V, wit2V, wit3V},
+			wantCP:    newCP(t, 15, logS, wit2S, wit3S),
+		}, {
+			desc:   "untrusted witnesses don't count",
+			quorum: 2,
+			distributors: []client.Fetcher{
+				fetcher(map[string][]byte{
+					checkpointPath(2): newCP(t, 15, logS, wit1S, otherS),
+					checkpointPath(3): newCP(t, 12, logS, wit1S, wit2S, otherS),
+				}),
+			},
+			witnesses: []note.Verifier{wit1V, wit2V, wit3V},
+			wantCP:    newCP(t, 12, logS, wit1S, wit2S, otherS),
+		}, {
+			desc:   "no checkpoint satisfies policy",
+			quorum: 2,
+			distributors: []client.Fetcher{
+				fetcher(map[string][]byte{
+					checkpointPath(2): newCP(t, 15, logS, wit1S, otherS),
+				}),
+			},
+			witnesses: []note.Verifier{wit1V, wit2V, wit3V},
+			wantErr:   true,
+		}, {
+			desc:      "impossible quorum",
+			quorum:    4,
+			witnesses: []note.Verifier{wit1V, wit2V, wit3V},
+			wantErr:   true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			cc, err := DistributorConsensus(logID, test.distributors, client.WitnessPolicy{Quorum: test.quorum}, test.witnesses...)
+			if err == nil {
+				var cpRaw []byte
+				_, cpRaw, _, err = cc(context.Background(), logV, testOrigin)
+				if err == nil && !bytes.Equal(cpRaw, test.wantCP) {
+					t.Errorf("got checkpoint:\n%s\nwant:\n%s", cpRaw, test.wantCP)
+				}
+			}
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("got err %v, wantErr %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestFetchWitnessedCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	logS, logV := genKeyPair(t, "log")
+	wit1S, wit1V := genKeyPair(t, "w1")
+	wit2S, wit2V := genKeyPair(t, "w2")
+	otherS, _ := genKeyPair(t, "other")
+	logID := "test-log"
+	checkpointPath := func(i int) string { return fmt.Sprintf("logs/%s/checkpoint.%d", logID, i) }
+
+	cp11 := newCP(t, 11, logS, wit1S, wit2S)
+	cp12 := newCP(t, 12, logS, wit1S, otherS)
+	distributors := []client.Fetcher{
+		fetcher(map[string][]byte{
+			checkpointPath(1): cp11,
+			checkpointPath(2): cp11,
+		}),
+		fetcher(map[string][]byte{
+			checkpointPath(1): cp12,
+			checkpointPath(2): []byte("banana"),
+		}),
+	}
+
+	got, err := FetchWitnessedCheckpoints(ctx, logID, distributors, logV, testOrigin, wit1V, wit2V)
+	if err != nil {
+		t.Fatalf("FetchWitnessedCheckpoints: %v", err)
+	}
+	type summary struct {
+		distributor, n int
+		size           uint64
+		witnesses      string
+	}
+	var gotSummary []summary
+	for _, wc := range got {
+		gotSummary = append(gotSummary, summary{wc.Distributor, wc.N, wc.Checkpoint.Size, fmt.Sprint(wc.Witnesses)})
+	}
+	wantSummary := []summary{
+		{0, 1, 11, "[w1 w2]"},
+		{1, 1, 12, "[w1]"},
+	}
+	if fmt.Sprint(gotSummary) != fmt.Sprint(wantSummary) {
+		t.Errorf("got checkpoints %+v, want %+v", gotSummary, wantSummary)
+	}
+
+	if _, err := FetchWitnessedCheckpoints(ctx, logID, []client.Fetcher{fetcher(nil)}, logV, testOrigin, wit1V); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("FetchWitnessedCheckpoints with no checkpoints: got err %v, want os.ErrNotExist", err)
+	}
+}
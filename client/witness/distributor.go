@@ -0,0 +1,213 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package witness
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/transparency-dev/serverless-log/client"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/sync/errgroup"
+
+	fmt_log "github.com/transparency-dev/formats/log"
+)
+
+// DistributorConsensus returns a ConsensusCheckpointFunc which fetches witnessed
+// checkpoints for the log from the provided distributors, rather than from the
+// log itself, and selects the freshest one which satisfies the witness policy.
+//
+// Distributors serve checkpoint.N files containing the latest checkpoint they
+// know of with at least N witness cosignatures. Since the witnesses which signed
+// a given checkpoint.N need not be ones we trust, all checkpoint.N files for N
+// between policy.Quorum and the number of configured witnesses are considered.
+//
+// The freshest checkpoint is the largest one; ties are broken in favour of the
+// checkpoint with the most recent cosignature/v1 timestamp.
+func DistributorConsensus(logID string, distributors []client.Fetcher, policy client.WitnessPolicy, witnesses ...note.Verifier) (client.ConsensusCheckpointFunc, error) {
+	if nw := len(witnesses); policy.Quorum > nw {
+		return nil, fmt.Errorf("requested quorum of %d witnesses, but only %d witnesses configured - consensus would always fail", policy.Quorum, nw)
+	}
+	minN := policy.Quorum
+	if minN < 1 {
+		minN = 1
+	}
+	return func(ctx context.Context, logSigV note.Verifier, origin string) (*fmt_log.Checkpoint, []byte, *note.Note, error) {
+		wcs, errs := fetchWitnessedCheckpoints(ctx, logID, distributors, minN, logSigV, origin, witnesses)
+		var best *WitnessedCheckpoint
+		var bestLatest time.Time
+		for i := range wcs {
+			wc := &wcs[i]
+			if err := policy.Check(wc.Note, witnesses...); err != nil {
+				errs = append(errs, fmt.Errorf("distributor %d checkpoint.%d: %v", wc.Distributor, wc.N, err))
+				continue
+			}
+			latest := wc.LatestCosignature()
+			if best == nil || wc.Checkpoint.Size > best.Checkpoint.Size || (wc.Checkpoint.Size == best.Checkpoint.Size && latest.After(bestLatest)) {
+				best, bestLatest = wc, latest
+			}
+		}
+		if best == nil {
+			if len(errs) == 0 {
+				return nil, nil, nil, fmt.Errorf("unable to identify suitable checkpoint: no distributor has a checkpoint for log %q", logID)
+			}
+			return nil, nil, nil, fmt.Errorf("unable to identify suitable checkpoint: %w", errors.Join(errs...))
+		}
+		return best.Checkpoint, best.Raw, best.Note, nil
+	}, nil
+}
+
+// WitnessedCheckpoint is a checkpoint retrieved from a distributor, along with
+// the identities of the trusted witnesses which have signed it.
+type WitnessedCheckpoint struct {
+	// Checkpoint is the parsed checkpoint.
+	Checkpoint *fmt_log.Checkpoint
+	// Raw holds the checkpoint as served by the distributor.
+	Raw []byte
+	// Note is the opened note, holding only the verified signatures.
+	Note *note.Note
+	// Distributor is the index of the distributor which served the checkpoint.
+	Distributor int
+	// N identifies the checkpoint.N file which held the checkpoint.
+	N int
+	// Witnesses holds the names of the trusted witnesses whose signatures on
+	// the checkpoint verified, in the order they appear in the note.
+	Witnesses []string
+	// Cosignatures describes those signatures which were cosignature/v1
+	// signatures, including the time at which each witness made them.
+	Cosignatures []client.Cosignature
+}
+
+// LatestCosignature returns the most recent cosignature/v1 timestamp on the
+// checkpoint, or the zero time if it has none.
+func (wc WitnessedCheckpoint) LatestCosignature() time.Time {
+	var latest time.Time
+	for _, c := range wc.Cosignatures {
+		if c.Timestamp.After(latest) {
+			latest = c.Timestamp
+		}
+	}
+	return latest
+}
+
+// FetchWitnessedCheckpoints retrieves the checkpoints for the log known to each
+// of the distributors, i.e. the contents of each of their checkpoint.N files
+// for N between 0 and the number of witnesses, for use by audit tooling or
+// custom consensus functions.
+//
+// Each checkpoint must be for the log identified by origin and signed by
+// logSigV. Signatures from witnesses other than those provided are ignored.
+// Checkpoints served under several checkpoint.N files by the same distributor
+// are returned once, for the smallest N.
+//
+// Missing files are skipped, and an error is only returned if no checkpoints
+// could be retrieved at all. The returned checkpoints are ordered by
+// distributor, and then by N.
+func FetchWitnessedCheckpoints(ctx context.Context, logID string, distributors []client.Fetcher, logSigV note.Verifier, origin string, witnesses ...note.Verifier) ([]WitnessedCheckpoint, error) {
+	wcs, errs := fetchWitnessedCheckpoints(ctx, logID, distributors, 0, logSigV, origin, witnesses)
+	if len(wcs) == 0 {
+		if len(errs) == 0 {
+			return nil, fmt.Errorf("no distributor has a checkpoint for log %q: %w", logID, os.ErrNotExist)
+		}
+		return nil, fmt.Errorf("failed to fetch checkpoints for log %q: %w", logID, errors.Join(errs...))
+	}
+	return wcs, nil
+}
+
+// fetchWitnessedCheckpoints implements FetchWitnessedCheckpoints, starting from
+// checkpoint.minN, and returning the errors encountered alongside any
+// checkpoints which were successfully retrieved.
+func fetchWitnessedCheckpoints(ctx context.Context, logID string, distributors []client.Fetcher, minN int, logSigV note.Verifier, origin string, witnesses []note.Verifier) ([]WitnessedCheckpoint, []error) {
+	numN := len(witnesses) - minN + 1
+	if numN < 0 {
+		numN = 0
+	}
+	results := make([]*WitnessedCheckpoint, len(distributors)*numN)
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	eg := errgroup.Group{}
+	for d, f := range distributors {
+		for N := minN; N <= len(witnesses); N++ {
+			d, f, N := d, f, N
+			eg.Go(func() error {
+				cp, n, raw, err := getCheckpointN(ctx, f, logID, N, logSigV, origin, witnesses)
+				var cosigs []client.Cosignature
+				if err == nil {
+					cosigs, err = client.Cosignatures(n, witnesses...)
+				}
+				if err != nil {
+					if !errors.Is(err, os.ErrNotExist) {
+						mu.Lock()
+						errs = append(errs, fmt.Errorf("distributor %d checkpoint.%d: %v", d, N, err))
+						mu.Unlock()
+					}
+					return nil
+				}
+				results[d*numN+N-minN] = &WitnessedCheckpoint{
+					Checkpoint:   cp,
+					Raw:          raw,
+					Note:         n,
+					Distributor:  d,
+					N:            N,
+					Witnesses:    witnessNames(n, witnesses),
+					Cosignatures: cosigs,
+				}
+				return nil
+			})
+		}
+	}
+	_ = eg.Wait()
+
+	var ret []WitnessedCheckpoint
+	for i, r := range results {
+		if r == nil {
+			continue
+		}
+		// Skip checkpoints already seen from this distributor under a smaller N.
+		dup := false
+		for _, prev := range results[i-(r.N-minN) : i] {
+			if prev != nil && bytes.Equal(prev.Raw, r.Raw) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			ret = append(ret, *r)
+		}
+	}
+	return ret, errs
+}
+
+// witnessNames returns the names of the witnesses whose signatures on n were
+// verified.
+func witnessNames(n *note.Note, witnesses []note.Verifier) []string {
+	var ret []string
+	for _, s := range n.Sigs {
+		for _, w := range witnesses {
+			if w.Name() == s.Name && w.KeyHash() == s.Hash {
+				ret = append(ret, s.Name)
+				break
+			}
+		}
+	}
+	return ret
+}
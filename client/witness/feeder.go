@@ -0,0 +1,232 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package witness
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/transparency-dev/serverless-log/client"
+	"golang.org/x/mod/sumdb/note"
+	"gopkg.in/yaml.v3"
+)
+
+// maxResponseSize is the largest response body read from a witness.
+const maxResponseSize = 64 << 10
+
+// Witness is a witness to which checkpoints can be submitted for cosigning.
+type Witness struct {
+	// URL is the witness's tlog-witness API prefix, add-checkpoint requests
+	// are made to URL/add-checkpoint.
+	URL *url.URL
+	// Verifier verifies the witness's cosignatures.
+	Verifier note.Verifier
+}
+
+// FeedConfig holds the set of witnesses to which a log submits its
+// checkpoints, and the number of cosignatures each checkpoint needs.
+type FeedConfig struct {
+	// Quorum is the number of witness cosignatures which a checkpoint must
+	// collect before it's published.
+	Quorum int
+	// Witnesses are the witnesses to submit checkpoints to.
+	Witnesses []Witness
+}
+
+// feedConfigYAML is the YAML encoding of a FeedConfig.
+type feedConfigYAML struct {
+	Quorum    int `yaml:"quorum"`
+	Witnesses []struct {
+		URL string `yaml:"url"`
+		Key string `yaml:"key"`
+	} `yaml:"witnesses"`
+}
+
+// ParseFeedConfig parses and validates a YAML encoded witness feeding
+// configuration, e.g.:
+//
+//	quorum: 1
+//	witnesses:
+//	  - url: https://witness1.example.com/
+//	    key: witness1.example.com+01234567+AaBbCc...
+//	  - url: https://witness2.example.com/
+//	    key: witness2.example.com+89abcdef+AaBbCc...
+//
+// See client.NewWitnessVerifier for the supported key formats.
+func ParseFeedConfig(b []byte) (*FeedConfig, error) {
+	var y feedConfigYAML
+	if err := yaml.Unmarshal(b, &y); err != nil {
+		return nil, fmt.Errorf("failed to parse witness config: %v", err)
+	}
+	if y.Quorum < 0 || y.Quorum > len(y.Witnesses) {
+		return nil, fmt.Errorf("invalid quorum %d for %d witnesses", y.Quorum, len(y.Witnesses))
+	}
+	c := &FeedConfig{Quorum: y.Quorum}
+	for _, w := range y.Witnesses {
+		u, err := url.Parse(w.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid witness URL %q", w.URL)
+		}
+		v, err := client.NewWitnessVerifier(w.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid witness key %q: %v", w.Key, err)
+		}
+		c.Witnesses = append(c.Witnesses, Witness{URL: u, Verifier: v})
+	}
+	return c, nil
+}
+
+// ConsistencyProofFunc returns a consistency proof between the two tree sizes.
+type ConsistencyProofFunc func(ctx context.Context, from, to uint64) ([][]byte, error)
+
+// Feed submits the signed checkpoint cpRaw, of the given size, to each of the
+// witnesses in c in parallel, and returns cpRaw with the cosignatures which
+// were collected appended to it.
+//
+// oldSize is the size of the checkpoint which the witnesses are expected to
+// have seen last, typically the log's previous checkpoint. Witnesses which
+// have seen a different checkpoint say so, and are sent another request with
+// a proof from the size they've seen. proof is used to build the consistency
+// proofs which are sent with the checkpoint.
+//
+// An error is returned if fewer than c.Quorum cosignatures were collected,
+// otherwise failures from individual witnesses are ignored.
+func (c *FeedConfig) Feed(ctx context.Context, hc *http.Client, cpRaw []byte, oldSize, size uint64, proof ConsistencyProofFunc) ([]byte, error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	sigs := make([][]byte, len(c.Witnesses))
+	errs := make([]error, len(c.Witnesses))
+	var wg sync.WaitGroup
+	for i, w := range c.Witnesses {
+		wg.Add(1)
+		go func(i int, w Witness) {
+			defer wg.Done()
+			sigs[i], errs[i] = w.cosign(ctx, hc, cpRaw, oldSize, size, proof)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("witness %q: %w", w.Verifier.Name(), errs[i])
+			}
+		}(i, w)
+	}
+	wg.Wait()
+
+	ret := bytes.Clone(cpRaw)
+	n := 0
+	for _, s := range sigs {
+		if s != nil {
+			ret = append(ret, s...)
+			n++
+		}
+	}
+	if n < c.Quorum {
+		return nil, fmt.Errorf("got %d cosignatures, need %d: %w", n, c.Quorum, errors.Join(errs...))
+	}
+	return ret, nil
+}
+
+// cosign submits cpRaw to the witness, and returns its verified cosignature
+// line.
+func (w Witness) cosign(ctx context.Context, hc *http.Client, cpRaw []byte, oldSize, size uint64, proof ConsistencyProofFunc) ([]byte, error) {
+	// Retry once if the witness has seen a different checkpoint to the one we
+	// expected.
+	for attempt := 0; ; attempt++ {
+		var p [][]byte
+		if oldSize > 0 && oldSize < size {
+			var err error
+			if p, err = proof(ctx, oldSize, size); err != nil {
+				return nil, fmt.Errorf("failed to build consistency proof from %d to %d: %v", oldSize, size, err)
+			}
+		}
+		sig, witnessSize, err := w.addCheckpoint(ctx, hc, cpRaw, oldSize, p)
+		if err == nil {
+			return w.verify(cpRaw, sig)
+		}
+		if witnessSize == nil || attempt > 0 {
+			return nil, err
+		}
+		if *witnessSize > size {
+			return nil, fmt.Errorf("witness has seen a checkpoint of size %d, larger than ours", *witnessSize)
+		}
+		oldSize = *witnessSize
+	}
+}
+
+// addCheckpoint makes an add-checkpoint request to the witness. If the witness
+// has seen a checkpoint other than oldSize the size it's seen is returned
+// along with the error.
+func (w Witness) addCheckpoint(ctx context.Context, hc *http.Client, cpRaw []byte, oldSize uint64, proof [][]byte) ([]byte, *uint64, error) {
+	body := &bytes.Buffer{}
+	fmt.Fprintf(body, "old %d\n", oldSize)
+	for _, h := range proof {
+		fmt.Fprintf(body, "%s\n", base64.StdEncoding.EncodeToString(h))
+	}
+	body.WriteString("\n")
+	body.Write(cpRaw)
+
+	u := w.URL.JoinPath("add-checkpoint")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+	if err != nil {
+		return nil, nil, err
+	}
+	rsp, err := hc.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rsp.Body.Close()
+	r, err := io.ReadAll(io.LimitReader(rsp.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	switch rsp.StatusCode {
+	case http.StatusOK:
+		return r, nil, nil
+	case http.StatusConflict:
+		s, err := strconv.ParseUint(strings.TrimSpace(string(r)), 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid conflict response %q", r)
+		}
+		return nil, &s, fmt.Errorf("witness has seen a checkpoint of size %d, not %d", s, oldSize)
+	default:
+		return nil, nil, fmt.Errorf("%s: %s", rsp.Status, bytes.TrimSpace(r))
+	}
+}
+
+// verify checks that sigs holds a valid cosignature from the witness on
+// cpRaw, and returns that signature line.
+func (w Witness) verify(cpRaw, sigs []byte) ([]byte, error) {
+	for _, l := range bytes.SplitAfter(sigs, []byte("\n")) {
+		if len(bytes.TrimSpace(l)) == 0 {
+			continue
+		}
+		if !bytes.HasSuffix(l, []byte("\n")) {
+			l = append(l, '\n')
+		}
+		// Signatures from other keys are ignored by Open, so this only
+		// succeeds if l holds a valid signature from the witness.
+		if _, err := note.Open(append(bytes.Clone(cpRaw), l...), note.VerifierList(w.Verifier)); err == nil {
+			return l, nil
+		}
+	}
+	return nil, errors.New("response holds no valid cosignature")
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package witness
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+// fakeWitness is a tlog-witness which has seen a checkpoint of size latest,
+// and which cosigns any checkpoint submitted with the correct old size using
+// signer.
+type fakeWitness struct {
+	t      *testing.T
+	signer note.Signer
+	latest uint64
+}
+
+func (w *fakeWitness) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/add-checkpoint" {
+		http.NotFound(rw, r)
+		return
+	}
+	br := bufio.NewReader(r.Body)
+	var old uint64
+	if _, err := fmt.Fscanf(br, "old %d\n", &old); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Skip the proof, which is checked by real witnesses.
+	for {
+		l, err := br.ReadString('\n')
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if l == "\n" {
+			break
+		}
+	}
+	if old != w.latest {
+		rw.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(rw, "%d\n", w.latest)
+		return
+	}
+	cpRaw, _ := io.ReadAll(br)
+	text, _, _ := strings.Cut(string(cpRaw), "\n\n")
+	signed, err := note.Sign(&note.Note{Text: text + "\n"}, w.signer)
+	if err != nil {
+		w.t.Errorf("Sign: %v", err)
+	}
+	_, sig, _ := bytes.Cut(signed, []byte("\n\n"))
+	_, _ = rw.Write(sig)
+}
+
+func TestFeed(t *testing.T) {
+	ctx := context.Background()
+	logS, logV := genKeyPair(t, "log")
+	cpRaw := newCP(t, 10, logS)
+	proof := func(_ context.Context, from, to uint64) ([][]byte, error) {
+		return [][]byte{[]byte(fmt.Sprintf("%d-%d", from, to))}, nil
+	}
+
+	for _, test := range []struct {
+		desc      string
+		latest    []uint64
+		badSigner []bool
+		quorum    int
+		wantSigs  int
+		wantErr   bool
+	}{
+		{
+			desc:     "all up to date",
+			latest:   []uint64{5, 5},
+			quorum:   2,
+			wantSigs: 2,
+		}, {
+			desc:     "witness behind",
+			latest:   []uint64{5, 3},
+			quorum:   2,
+			wantSigs: 2,
+		}, {
+			desc:     "new witness",
+			latest:   []uint64{0},
+			quorum:   1,
+			wantSigs: 1,
+		}, {
+			desc:    "witness ahead",
+			latest:  []uint64{5, 11},
+			quorum:  2,
+			wantErr: true,
+		}, {
+			desc:     "witness ahead below quorum",
+			latest:   []uint64{5, 11},
+			quorum:   1,
+			wantSigs: 1,
+		}, {
+			desc:      "bad cosignature",
+			latest:    []uint64{5, 5},
+			badSigner: []bool{false, true},
+			quorum:    2,
+			wantErr:   true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			c := &FeedConfig{Quorum: test.quorum}
+			var vs []note.Verifier
+			for i, l := range test.latest {
+				name := fmt.Sprintf("witness%d", i)
+				s, v := genKeyPair(t, name)
+				if test.badSigner != nil && test.badSigner[i] {
+					s, _ = genKeyPair(t, name)
+				}
+				srv := httptest.NewServer(&fakeWitness{t: t, signer: s, latest: l})
+				t.Cleanup(srv.Close)
+				u, err := url.Parse(srv.URL)
+				if err != nil {
+					t.Fatalf("Parse: %v", err)
+				}
+				c.Witnesses = append(c.Witnesses, Witness{URL: u, Verifier: v})
+				vs = append(vs, v)
+			}
+
+			got, err := c.Feed(ctx, nil, cpRaw, 5, 10, proof)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Feed: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			n, err := note.Open(got, note.VerifierList(append(vs, logV)...))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if gotSigs := len(n.Sigs) - 1; gotSigs != test.wantSigs {
+				t.Errorf("got %d cosignatures, want %d", gotSigs, test.wantSigs)
+			}
+		})
+	}
+}
+
+func TestParseFeedConfig(t *testing.T) {
+	_, vkey, err := note.GenerateKey(nil, "witness")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc    string
+		config  string
+		wantErr bool
+	}{
+		{
+			desc:   "valid",
+			config: fmt.Sprintf("quorum: 1\nwitnesses:\n  - url: https://w.example.com/\n    key: %s\n", vkey),
+		}, {
+			desc:    "quorum too large",
+			config:  fmt.Sprintf("quorum: 2\nwitnesses:\n  - url: https://w.example.com/\n    key: %s\n", vkey),
+			wantErr: true,
+		}, {
+			desc:    "bad url",
+			config:  fmt.Sprintf("quorum: 1\nwitnesses:\n  - url: w.example.com\n    key: %s\n", vkey),
+			wantErr: true,
+		}, {
+			desc:    "bad key",
+			config:  "quorum: 1\nwitnesses:\n  - url: https://w.example.com/\n    key: banana\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := ParseFeedConfig([]byte(test.config))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseFeedConfig: got err %v, wantErr %t", err, test.wantErr)
+			}
+		})
+	}
+}
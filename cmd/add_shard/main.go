@@ -0,0 +1,74 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for adding a shard to a
+// temporally sharded serverless log, i.e. a sequence of logs each of which
+// only accepts entries associated with a bounded period of time.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+	"k8s.io/klog/v2"
+)
+
+var (
+	rootDir = flag.String("root_dir", "", "Root directory of the sharded log, holding its shard index and a directory for each shard's log.")
+	origin  = flag.String("origin", "", "Base origin of the sharded log. Each shard's origin is formed by appending a slash and the shard's name, e.g. example.com/log/2025q1.")
+	period  = flag.String("period", string(api.ShardYearly), "Period covered by each shard, one of year or quarter.")
+	at      = flag.String("time", "", "Time, in RFC 3339 format, within the period to be covered by the new shard. If unset, the shard following the latest shard in the index is added, or the shard covering the current time if the index is empty.")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	if len(*rootDir) == 0 {
+		klog.Exit("Please set --root_dir flag.")
+	}
+	if len(*origin) == 0 {
+		klog.Exit("Please set --origin flag.")
+	}
+	p, err := api.ParseShardPeriod(*period)
+	if err != nil {
+		klog.Exitf("Invalid --period: %v", err)
+	}
+	t := time.Now()
+	if *at != "" {
+		if t, err = time.Parse(time.RFC3339, *at); err != nil {
+			klog.Exitf("Invalid --time: %v", err)
+		}
+	} else {
+		idx, err := fs.ReadShardIndex(*rootDir)
+		if err != nil {
+			klog.Exitf("Failed to read shard index: %q", err)
+		}
+		if n := len(idx.Shards); n > 0 {
+			t = idx.Shards[n-1].End
+		}
+	}
+
+	s := p.Shard(*origin, t)
+	dir, err := fs.AddShard(*rootDir, s)
+	if err != nil {
+		klog.Exitf("Failed to add shard: %q", err)
+	}
+	klog.Infof("Added shard %q covering %s to %s", s.Name, s.Start.Format(time.RFC3339), s.End.Format(time.RFC3339))
+	// The shard's log is created as usual, with integrate --initialise.
+	fmt.Printf("storage_dir: %s\norigin: %s\n", dir, s.Origin)
+}
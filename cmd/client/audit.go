@@ -0,0 +1,172 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/serverless-log/client"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// auditBatchSize is the number of leaves the audit command fetches before
+	// recording its progress.
+	auditBatchSize = 1024
+	// auditReportInterval is how often the audit command logs its progress.
+	auditReportInterval = 10 * time.Second
+)
+
+// auditProgress is the state of an audit, persisted to --progress_file so that
+// an interrupted audit can be resumed.
+type auditProgress struct {
+	// Next is the index of the next leaf to be fetched.
+	Next uint64 `json:"next"`
+	// Hashes are the hashes of the compact range covering leaves [0, Next).
+	Hashes [][]byte `json:"hashes"`
+}
+
+// auditResult is the output of the audit command.
+type auditResult struct {
+	Checkpoint *jsonCheckpoint `json:"checkpoint"`
+	// Fetched is the number of leaves fetched by this run, which is less than
+	// the size of the log if a previous run's progress was resumed.
+	Fetched uint64 `json:"fetched"`
+	// Seconds is the time taken by this run.
+	Seconds float64 `json:"seconds"`
+}
+
+// audit fetches every leaf in the log, and checks that together they produce
+// the root hash of the log's latest checkpoint.
+func (l *logClientTool) audit(ctx context.Context, args []string) error {
+	if l := len(args); l != 0 {
+		return fmt.Errorf("usage: audit")
+	}
+	if _, _, _, err := l.Tracker.Update(ctx); err != nil {
+		return fmt.Errorf("failed to update checkpoint: %w", err)
+	}
+	st := l.Tracker.State()
+	cp, cpRaw := st.Checkpoint, st.Raw
+
+	rf := &compact.RangeFactory{Hash: l.Hasher.HashChildren}
+	p, err := loadAuditProgress(*progressFile)
+	if err != nil {
+		return err
+	}
+	if p.Next > cp.Size {
+		return fmt.Errorf("audit progress %d is beyond log size %d", p.Next, cp.Size)
+	}
+	r, err := rf.NewRange(0, p.Next, p.Hashes)
+	if err != nil {
+		return fmt.Errorf("invalid audit progress: %v", err)
+	}
+	if p.Next > 0 {
+		klog.Infof("Resuming audit from index %d", p.Next)
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	start, lastReport := time.Now(), time.Now()
+	from := p.Next
+	for r.End() < cp.Size {
+		begin, end := r.End(), min(r.End()+auditBatchSize, cp.Size)
+		_, hashes, err := l.fetchLeaves(ctx, begin, end, cp.Size)
+		if err != nil {
+			return err
+		}
+		for _, h := range hashes {
+			if err := r.Append(h, nil); err != nil {
+				return fmt.Errorf("failed to append leaf hash: %v", err)
+			}
+		}
+		if err := storeAuditProgress(ctx, *progressFile, auditProgress{Next: r.End(), Hashes: r.Hashes()}); err != nil {
+			return err
+		}
+		if time.Since(lastReport) >= auditReportInterval {
+			lastReport = time.Now()
+			n := r.End() - from
+			klog.Infof("Audited %d/%d leaves (%.1f%%), %.0f leaves/s", r.End(), cp.Size, 100*float64(r.End())/float64(cp.Size), float64(n)/time.Since(start).Seconds())
+		}
+	}
+
+	root := l.Hasher.EmptyRoot()
+	if cp.Size > 0 {
+		if root, err = r.GetRootHash(nil); err != nil {
+			return fmt.Errorf("failed to calculate root hash: %v", err)
+		}
+	}
+	if !bytes.Equal(root, cp.Hash) {
+		return fmt.Errorf("%w: log's leaves produce root hash %x, checkpoint has root hash %x", client.ErrProofMismatch, root, cp.Hash)
+	}
+	d := time.Since(start)
+	klog.Infof("Audited all %d leaves against checkpoint in %v, fetching %d leaves:\n%s", cp.Size, d.Round(time.Millisecond), cp.Size-from, cpRaw)
+	return printJSON(auditResult{Checkpoint: newJSONCheckpoint(cp, cpRaw), Fetched: cp.Size - from, Seconds: d.Seconds()})
+}
+
+// fetchLeaves fetches leaves [begin, end) from a log of the given size, in
+// parallel, and returns them along with their leaf hashes.
+func (l *logClientTool) fetchLeaves(ctx context.Context, begin, end, size uint64) ([][]byte, [][]byte, error) {
+	leaves, err := client.GetLeaves(ctx, l.Fetcher, l.Layout, begin, end-begin, size, *fetchConcurrency)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		hashes[i] = l.Hasher.HashLeaf(leaf)
+	}
+	return leaves, hashes, nil
+}
+
+func loadAuditProgress(path string) (auditProgress, error) {
+	var p auditProgress
+	if len(path) == 0 {
+		return p, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	} else if err != nil {
+		return p, fmt.Errorf("failed to read audit progress: %v", err)
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return p, fmt.Errorf("invalid audit progress in %q: %v", path, err)
+	}
+	return p, nil
+}
+
+// storeAuditProgress atomically replaces the audit progress held in the file at
+// path, if it's set.
+func storeAuditProgress(ctx context.Context, path string, p auditProgress) error {
+	if len(path) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := (client.FileCheckpointStore{Path: path}).Store(ctx, b); err != nil {
+		return fmt.Errorf("failed to store audit progress: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/transparency-dev/serverless-log/client"
+)
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		desc         string
+		args         []string
+		progress     string
+		replaceLeaf  bool
+		wantErr      bool
+		wantMismatch bool
+		wantFetched  uint64
+	}{
+		{
+			desc:        "all leaves",
+			wantFetched: 10,
+		}, {
+			desc:    "extra args",
+			args:    []string{"10"},
+			wantErr: true,
+		}, {
+			desc:         "replaced leaf",
+			replaceLeaf:  true,
+			wantErr:      true,
+			wantMismatch: true,
+		}, {
+			desc:     "progress beyond log size",
+			progress: `{"next":11,"hashes":[]}`,
+			wantErr:  true,
+		}, {
+			desc:     "invalid progress hashes",
+			progress: `{"next":4,"hashes":[]}`,
+			wantErr:  true,
+		}, {
+			desc:     "corrupt progress",
+			progress: `{"next":`,
+			wantErr:  true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			setFlag(t, "format", formatJSON)
+			tl := newTestLog(t, 10)
+			if test.replaceLeaf {
+				tl.replaceLeaf(5, []byte("not leaf 5"))
+			}
+			pf := filepath.Join(t.TempDir(), "progress")
+			if len(test.progress) > 0 {
+				if err := os.WriteFile(pf, []byte(test.progress), 0644); err != nil {
+					t.Fatalf("WriteFile: %v", err)
+				}
+			}
+			setFlag(t, "progress_file", pf)
+			lc := tl.tool(t)
+			out := captureStdout(t)
+
+			err := lc.audit(ctx, test.args)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("audit: got err %v, want err %t", err, test.wantErr)
+			}
+			if got := errors.Is(err, client.ErrProofMismatch); got != test.wantMismatch {
+				t.Errorf("audit: got err %v, want ErrProofMismatch %t", err, test.wantMismatch)
+			}
+			if err != nil {
+				return
+			}
+			var res auditResult
+			if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+				t.Fatalf("Unmarshal(%q): %v", out, err)
+			}
+			if res.Fetched != test.wantFetched || res.Checkpoint.Size != tl.size {
+				t.Errorf("got %d leaves fetched for size %d, want %d for size %d", res.Fetched, res.Checkpoint.Size, test.wantFetched, tl.size)
+			}
+		})
+	}
+}
+
+func TestAuditResume(t *testing.T) {
+	ctx := context.Background()
+	setFlag(t, "format", formatJSON)
+	setFlag(t, "progress_file", filepath.Join(t.TempDir(), "progress"))
+	tl := newTestLog(t, 10)
+
+	for _, test := range []struct {
+		desc        string
+		grow        int
+		wantFetched uint64
+	}{
+		{desc: "first run", wantFetched: 10},
+		{desc: "unchanged", wantFetched: 0},
+		{desc: "grown", grow: 7, wantFetched: 7},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if test.grow > 0 {
+				tl.grow(t, test.grow)
+			}
+			out := captureStdout(t)
+			if err := tl.tool(t).audit(ctx, nil); err != nil {
+				t.Fatalf("audit: %v", err)
+			}
+			var res auditResult
+			if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+				t.Fatalf("Unmarshal(%q): %v", out, err)
+			}
+			if res.Fetched != test.wantFetched {
+				t.Errorf("got %d leaves fetched, want %d", res.Fetched, test.wantFetched)
+			}
+			p, err := loadAuditProgress(*progressFile)
+			if err != nil {
+				t.Fatalf("loadAuditProgress: %v", err)
+			}
+			if p.Next != tl.size {
+				t.Errorf("got progress %d, want %d", p.Next, tl.size)
+			}
+		})
+	}
+}
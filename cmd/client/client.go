@@ -17,23 +17,29 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
 	"github.com/transparency-dev/merkle/proof"
-	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api"
 	"github.com/transparency-dev/serverless-log/client"
 	"github.com/transparency-dev/serverless-log/client/witness"
+	"github.com/transparency-dev/serverless-log/internal/encrypt"
 	"golang.org/x/mod/sumdb/note"
 	"k8s.io/klog/v2"
 )
@@ -67,18 +73,37 @@ func flagStringList(name, usage string) *aString {
 }
 
 var (
-	cacheDir            = flag.String("cache_dir", defaultCacheLocation(), "Where to cache client state for logs, if empty don't store anything locally")
+	cacheDir            = flag.String("cache_dir", defaultCacheLocation(), "Where to cache client state for logs, if empty don't store anything locally. Ignored if --state_dir is set")
+	stateDir            = flag.String("state_dir", "", "If set, the latest verified checkpoint of each log, and every checkpoint verified before it, is kept in this directory by origin. Every command then first updates to the log's latest checkpoint, rejecting it if it's smaller than, or inconsistent with, the stored checkpoint")
 	distributorURLs     = flagStringList("distributor_url", "URL identifying the root of a distributor (can specify this flag repeatedly)")
 	logURL              = flag.String("log_url", "", "Log storage root URL, e.g. file:///path/to/log or https://log.server/and/path")
-	logPubKeyFile       = flag.String("log_public_key", "", "Location of log public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable")
+	logPubKeyFile       = flag.String("log_public_key", "", "Location of log public key file, which may hold several keys, see client.ParseLogVerifiers. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable")
 	logID               = flag.String("log_id", "", "LogID used by distributors. Will be derived from log public key if unset")
 	origin              = flag.String("origin", "", "Expected first line of checkpoints from log")
 	witnessPubKeyFiles  = flagStringList("witness_public_key", "File containing witness public key (can specify this flag repeatedly)")
 	witnessSigsRequired = flag.Int("witness_sigs_required", 0, "Minimum number of witness signatures required for consensus")
+	witnessPolicy       = flag.String("witness_policy", "", "File holding a YAML witness policy, see client.ParseWitnessConfig. If set, checkpoints must carry cosignatures from the policy's quorum of witnesses before they're trusted. Can't be used with --witness_public_key")
 	outputCheckpoint    = flag.String("output_checkpoint", "", "If set, the update command will write the latest verified consistent checkpoint to this file")
-	outputConsistency   = flag.String("output_consistency_proof", "", "If set, the update and consistency commands will write the verified consistency proof used to update the checkpoint to this file")
-	outputInclusion     = flag.String("output_inclusion_proof", "", "If set, the inclusion command will write the verified inclusion proof to this file")
+	outputConsistency   = flag.String("output_consistency_proof", "", "If set, the update, consistency, and checkpoint commands will write the consistency proof to this file, in the format described by api.ConsistencyProof")
+	outputInclusion     = flag.String("output_inclusion_proof", "", "If set, the inclusion and lookup commands will write the verified inclusion proof to this file, in the c2sp.org/tlog-proof@v1 format")
+	outputBundle        = flag.String("output_bundle", "", "If set, the inclusion and lookup commands will write a proof bundle, holding the checkpoint, inclusion proof, and leaf, to this file, which can be checked offline with the verify-bundle command")
 	inclusionHash       = flag.Bool("inclusion_hash", false, "If set to true, the inclusion command will take a base64 encoded leaf hash instead of a file name")
+	inclusionBlob       = flag.Bool("blob", false, "If set to true, the inclusion command will verify inclusion of a reference to the file stored as a blob, see api.BlobRef, and check that the log serves the blob")
+	hashFunc            = flag.String("hash", client.HashSHA256, "Hash function used by the log's Merkle tree, one of sha256 or sha512_256")
+	decompress          = flag.Bool("decompress", false, "If set, gzip or zstd compressed log resources are transparently decompressed. Use with logs which compress their contents at rest")
+	encryptionKey       = flag.String("encryption_key", "", "If set, encrypted leaf data is transparently decrypted using this key encryption key: either the path of a file holding local keys, or gcpkms:// followed by the name of a Cloud KMS key. Use with private logs which encrypt their leaf data at rest")
+	logLayout           = flag.String("layout", client.LayoutServerless, "Storage layout used by the log, one of serverless, tlog-tiles or static-ct. For static-ct logs, --log_public_key must hold the PEM encoded log key")
+	shardTime           = flag.String("shard_time", "", "If set, --log_url is the root of a temporally sharded log, and the shard covering this time, in RFC 3339 format or \"now\", is used. --origin defaults to the shard's origin")
+	bearerToken         = flag.String("bearer_token", "", "If set, requests to an http(s) --log_url are authenticated with this bearer token. For GCP this is the result of `gcloud auth print-identity-token`")
+	bearerTokenFile     = flag.String("bearer_token_file", "", "If set, requests to an http(s) --log_url are authenticated with the bearer token held in this file, which is re-read for every request")
+	oidcAudience        = flag.String("oidc_audience", "", "If set, requests to an http(s) --log_url are authenticated with an OIDC ID token for this audience, e.g. the URL of an authenticated Cloud Run service, fetched from the GCP metadata server")
+	headers             = flagStringList("header", "Header, in the form \"Name: value\", to set on requests to an http(s) --log_url, e.g. an API key (can specify this flag repeatedly)")
+	fetchTimeout        = flag.Duration("fetch_timeout", 30*time.Second, "Maximum time to wait for each request to the log's storage before retrying it, 0 to wait indefinitely")
+	tailInterval        = flag.Duration("tail_interval", 10*time.Second, "How often the tail command checks for a new checkpoint")
+	outputFormat        = flag.String("format", formatText, "Output format, one of text, which logs human readable results, or json, which prints each command's result to stdout as a JSON object, with binary data base64 encoded")
+	progressFile        = flag.String("progress_file", "", "If set, the audit command records its progress in this file, and resumes from it when restarted")
+	fetchConcurrency    = flag.Int("fetch_concurrency", client.DefaultLeafFetchConcurrency, "Maximum number of leaves the audit, fetch-range, and lookup commands fetch in parallel")
+	positionFile        = flag.String("position_file", "", "If set, the tail command stores the index of the next leaf to print in this file, and resumes from it when restarted")
 )
 
 func usage() {
@@ -86,6 +111,13 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  consistency <from-size> <to-size>\n - build consistency proof between two log sizes\n")
 	fmt.Fprintf(os.Stderr, "  inclusion <file or leaf hash> [index-in-log]\n - verify inclusion of a file in the log\n")
 	fmt.Fprintf(os.Stderr, "  update - force the client to update its latest checkpoint\n")
+	fmt.Fprintf(os.Stderr, "  checkpoint <size>\n - fetch the log's archived checkpoint for a tree size and verify it's consistent with the latest checkpoint\n")
+	fmt.Fprintf(os.Stderr, "  audit\n - fetch every leaf in the log and verify that they produce the root hash of the latest checkpoint\n")
+	fmt.Fprintf(os.Stderr, "  fetch-range [--from=<index>] [--to=<index>] --out_dir=<dir>\n - download a range of leaves, verified against the latest checkpoint, into files named by their index\n")
+	fmt.Fprintf(os.Stderr, "  lookup --leaf_hash=<base64 leaf hash> [--max_scan=<leaves>]\n - find the index of a leaf hash in the log and log a verified inclusion proof for it\n")
+	fmt.Fprintf(os.Stderr, "  verify-bundle <bundle> [file]\n - verify a proof bundle written with --output_bundle offline, optionally checking that its leaf is the given file\n")
+	fmt.Fprintf(os.Stderr, "  verify-proof <proof> [file or leaf hash | old-checkpoint]\n - verify a proof written with --output_inclusion_proof or --output_consistency_proof offline, against the given file or leaf hash, or the checkpoint for the proof's old size\n")
+	fmt.Fprintf(os.Stderr, "  tail [start-index]\n - follow the log, printing each new leaf once it's verified to be committed to by a checkpoint\n")
 	os.Exit(-1)
 }
 
@@ -94,15 +126,29 @@ func main() {
 	flag.Parse()
 	ctx := context.Background()
 
-	logSigV, _, err := logSigVerifier(*logPubKeyFile)
+	if err := checkFormat(); err != nil {
+		klog.Exitf("Invalid --format: %v", err)
+	}
+
+	logVerifiers, err := logSigVerifiers(*logPubKeyFile)
 	if err != nil {
 		klog.Exitf("failed to read log public key: %v", err)
 	}
-	logID := *logID
-	if logID == "" {
-		logID = log.ID(*origin)
+	witnesses, err := witnessConfig(*witnessPolicy, *witnessPubKeyFiles, *witnessSigsRequired)
+	if err != nil {
+		klog.Exitf("Failed to configure witnesses: %v", err)
+	}
+	// Proof bundles and proofs are verified offline, so no client is needed.
+	if args := flag.Args(); len(args) > 0 && (args[0] == "verify-bundle" || args[0] == "verify-proof") {
+		verify := verifyBundle
+		if args[0] == "verify-proof" {
+			verify = verifyProof
+		}
+		if err := verify(ctx, logVerifiers, witnesses, args[1:]); err != nil {
+			klog.Exitf("Command %q failed: %q", args[0], err)
+		}
+		return
 	}
-
 	u := *logURL
 	if len(u) == 0 {
 		klog.Exitf("--log_url must be provided")
@@ -117,22 +163,39 @@ func main() {
 		klog.Exitf("Invalid log URL: %v", err)
 	}
 
-	witnesses, err := witnessSigVerifiers(*witnessPubKeyFiles)
+	distribs, err := distributors()
 	if err != nil {
-		klog.Exitf("Failed to read witness pub keys: %v", err)
+		klog.Exitf("Failed to create distributors list: %v", err)
 	}
 
-	if want, got := *witnessSigsRequired, len(witnesses); want > got {
-		klog.Exitf("--witness_sigs_required=%d but only %d witnesses configured", want, got)
+	var mws []client.Middleware
+	if *decompress {
+		mws = append(mws, client.DecompressingFetcher)
 	}
-
-	distribs, err := distributors()
+	if len(*encryptionKey) > 0 {
+		w, err := encrypt.NewKeyWrapper(ctx, *encryptionKey)
+		if err != nil {
+			klog.Exitf("Invalid --encryption_key: %v", err)
+		}
+		mws = append(mws, client.DecryptingMiddleware(w))
+	}
+	mws = append(mws, client.RetryMiddleware(client.RetryOpts{}), client.TimeoutMiddleware(*fetchTimeout))
+	auth, err := authFuncs()
 	if err != nil {
-		klog.Exitf("Failed to create distributors list: %v", err)
+		klog.Exitf("Failed to configure authentication: %v", err)
 	}
-
-	f := newFetcher(rootURL)
-	lc, err := newLogClientTool(ctx, logID, f, logSigV, witnesses, distribs)
+	hc := &http.Client{Transport: client.AuthTransport(nil, auth...)}
+	f := client.Chain(newFetcher(rootURL, hc), mws...)
+	if *shardTime != "" {
+		if f, err = shardFetcher(ctx, f, *shardTime); err != nil {
+			klog.Exitf("Failed to find shard: %v", err)
+		}
+	}
+	logID := *logID
+	if logID == "" {
+		logID = log.ID(*origin)
+	}
+	lc, err := newLogClientTool(ctx, logID, f, logVerifiers, witnesses, distribs)
 	if err != nil {
 		klog.Exitf("Failed to create new client: %v", err)
 	}
@@ -141,6 +204,14 @@ func main() {
 	if len(args) == 0 {
 		usage()
 	}
+	// With --state_dir, commands work from the log's latest checkpoint, once
+	// it's been checked against the stored one. The update command does this
+	// itself.
+	if len(*stateDir) > 0 && args[0] != "update" {
+		if _, _, _, err := lc.Tracker.Update(ctx); err != nil {
+			klog.Exitf("Failed to update checkpoint: %v", err)
+		}
+	}
 	switch args[0] {
 	case "consistency":
 		err = lc.consistencyProof(ctx, args[1:])
@@ -148,6 +219,16 @@ func main() {
 		err = lc.inclusionProof(ctx, args[1:])
 	case "update":
 		err = lc.updateCheckpoint(ctx, args[1:])
+	case "checkpoint":
+		err = lc.archivedCheckpoint(ctx, args[1:])
+	case "audit":
+		err = lc.audit(ctx, args[1:])
+	case "fetch-range":
+		err = lc.fetchRange(ctx, args[1:])
+	case "lookup":
+		err = lc.lookup(ctx, args[1:])
+	case "tail":
+		err = lc.tail(ctx, args[1:])
 	default:
 		usage()
 	}
@@ -155,57 +236,128 @@ func main() {
 		klog.Exitf("Command %q failed: %q", args[0], err)
 	}
 
-	// Persist new view of log state, if required.
-	if len(*cacheDir) > 0 {
-		if err := storeLocalCheckpoint(logID, lc.Tracker.LatestConsistentRaw); err != nil {
+	// Persist new view of log state, if required. Trackers using --state_dir
+	// persist their state as it's updated.
+	if len(*stateDir) == 0 && len(*cacheDir) > 0 {
+		if err := storeLocalCheckpoint(logID, lc.Tracker.State().Raw); err != nil {
 			klog.Exitf("Failed to persist local log state: %q", err)
 		}
 	}
 }
 
+// shardFetcher returns a Fetcher for the shard covering the time at of the
+// temporally sharded log whose root is read via f, and sets --origin to the
+// shard's origin if it's unset.
+func shardFetcher(ctx context.Context, f client.Fetcher, at string) (client.Fetcher, error) {
+	t := time.Now()
+	if at != "now" {
+		var err error
+		if t, err = time.Parse(time.RFC3339, at); err != nil {
+			return nil, fmt.Errorf("invalid --shard_time: %v", err)
+		}
+	}
+	idx, err := client.FetchShardIndex(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := idx.Find(t)
+	if !ok {
+		return nil, fmt.Errorf("no shard covers %v", t)
+	}
+	switch *origin {
+	case "":
+		*origin = s.Origin
+	case s.Origin:
+	default:
+		return nil, fmt.Errorf("--origin %q does not match origin %q of shard %q", *origin, s.Origin, s.Name)
+	}
+	klog.V(1).Infof("Using shard %q with origin %q", s.Name, s.Origin)
+	return client.ShardFetcher(f, s), nil
+}
+
 // logClientTool encapsulates the "application level" interaction with the log.
 // It relies heavily on the components provided by the `internal/client` package
 // to accomplish this.
 type logClientTool struct {
 	Fetcher client.Fetcher
-	Hasher  *rfc6962.Hasher
+	Hasher  merkle.LogHasher
+	Layout  client.Layout
 	Tracker client.LogStateTracker
 }
 
-func newLogClientTool(ctx context.Context, logID string, logFetcher client.Fetcher, logSigV note.Verifier, witnesses []note.Verifier, distributors []client.Fetcher) (*logClientTool, error) {
+func newLogClientTool(ctx context.Context, logID string, logFetcher client.Fetcher, logVerifiers client.LogVerifiers, witnesses *client.WitnessConfig, distributors []client.Fetcher) (*logClientTool, error) {
 	var cpRaw []byte
 	var err error
-	if len(*cacheDir) > 0 {
+	switch {
+	case len(*stateDir) > 0:
+		if len(*origin) == 0 {
+			return nil, errors.New("--origin must be set to use --state_dir")
+		}
+		cpRaw, err = client.StateDir{Dir: *stateDir}.Load(ctx, *origin)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to load stored checkpoint: %q", err)
+		}
+	case len(*cacheDir) > 0:
 		cpRaw, err = loadLocalCheckpoint(logID)
 		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			return nil, fmt.Errorf("failed to load cached checkpoint: %q", err)
 		}
-	} else {
+	default:
 		klog.Info("Local log state cache disabled")
 	}
 
-	hasher := rfc6962.DefaultHasher
+	hasher, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := client.NewLayout(*logLayout)
+	if err != nil {
+		return nil, err
+	}
+	if sl, ok := layout.(client.ServerlessLayout); ok {
+		if sl.BundleSize, err = client.DiscoverBundleSize(ctx, logFetcher); err != nil {
+			return nil, err
+		}
+		layout = sl
+	}
 	var cons client.ConsensusCheckpointFunc
-	if *witnessSigsRequired == 0 {
+	switch {
+	case witnesses.Policy.Quorum == 0:
 		klog.V(1).Infof("witness_sigs_required is 0, using unilateral consensus")
 		cons = client.UnilateralConsensus(logFetcher)
-	} else {
+	case len(distributors) > 0:
 		klog.V(1).Infof("witness_sigs_required > 0, using checkpoint.N consensus")
-		cons, err = witness.CheckpointNConsensus(logID, distributors, witnesses, *witnessSigsRequired)
+		cons, err = witness.CheckpointNConsensus(logID, distributors, witnesses.Witnesses, witnesses.Policy.Quorum)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create consensus func: %v", err)
 		}
+	default:
+		// Without distributors, the log's own checkpoint must carry the
+		// cosignatures, see the integrate tool's --witness_config flag.
+		klog.V(1).Infof("witness_sigs_required > 0, requiring cosignatures on the log's checkpoint")
+		if cons, err = witnesses.Consensus(logFetcher); err != nil {
+			return nil, fmt.Errorf("failed to create consensus func: %v", err)
+		}
 	}
-	tracker, err := client.NewLogStateTracker(ctx, logFetcher, hasher, cpRaw, logSigV, *origin, cons)
+	tracker, err := client.NewLogStateTrackerWithVerifiersAndLayout(ctx, logFetcher, hasher, cpRaw, logVerifiers, *origin, cons, layout)
 
 	if err != nil {
 		klog.Warningf("%s", string(cpRaw))
 		return nil, fmt.Errorf("failed to create LogStateTracker: %q", err)
 	}
+	if len(*stateDir) > 0 {
+		if len(cpRaw) == 0 {
+			klog.Infof("No stored checkpoint for %q, trusting the log's latest checkpoint of size %d", *origin, tracker.State().Checkpoint.Size)
+		}
+		if err := (client.StateDir{Dir: *stateDir}).Track(ctx, &tracker, *origin); err != nil {
+			return nil, err
+		}
+	}
 
 	return &logClientTool{
 		Fetcher: logFetcher,
 		Hasher:  hasher,
+		Layout:  layout,
 		Tracker: tracker,
 	}, nil
 }
@@ -227,7 +379,8 @@ func (l *logClientTool) consistencyProof(ctx context.Context, args []string) err
 		return errors.New("from-size must be less than to-size")
 	}
 
-	builder, err := client.NewProofBuilder(ctx, l.Tracker.LatestConsistent, l.Hasher.HashChildren, l.Fetcher)
+	st := l.Tracker.State()
+	builder, err := client.NewProofBuilder(ctx, st.Checkpoint, l.Hasher.HashChildren, l.Fetcher, client.WithLayout(l.Layout))
 	if err != nil {
 		return fmt.Errorf("failed to create proof builder: %w", err)
 	}
@@ -240,11 +393,18 @@ func (l *logClientTool) consistencyProof(ctx context.Context, args []string) err
 	klog.V(1).Infof("Built consistency proof: %#x", p)
 
 	if o := *outputConsistency; len(o) > 0 {
-		if err := os.WriteFile(o, []byte(merkleProof(p).Marshal()), 0644); err != nil {
-			return fmt.Errorf("failed to write inclusion proof to %q: %v", o, err)
+		// The proof is written along with a checkpoint for to-size.
+		cpRaw := st.Raw
+		if to != st.Checkpoint.Size {
+			if _, cpRaw, err = l.fetchArchivedCheckpoint(ctx, to); err != nil {
+				return fmt.Errorf("failed to find checkpoint for to-size: %w", err)
+			}
+		}
+		if err := writeConsistencyProof(o, from, p, cpRaw); err != nil {
+			return fmt.Errorf("failed to write consistency proof to %q: %v", o, err)
 		}
 	}
-	return nil
+	return printJSON(consistencyResult{From: from, To: to, Proof: p})
 }
 
 // For the inclusion subcommand, parse the command-line options and arguments to get the entry's
@@ -253,64 +413,80 @@ func (l *logClientTool) consistencyProof(ctx context.Context, args []string) err
 // When the --inclusion_hash option is not provided, the first argument is taken to be the name
 // of a file that will be hashed to look up the entry. The file will be read and the leaf hash
 // will be computed. When the --inclusion_hash option is provided, the first argument will instead
-// be the base64-encoded leaf hash of the node.
+// be the base64-encoded leaf hash of the node. When the --blob option is provided, the leaf
+// is taken to be a reference to the file's contents stored as a blob, and the blob is fetched
+// from the log and verified.
 //
 // The entry's index may optionally be provided as an additional argument. If the index is
 // provided, we'll use that index. The entry at that index must match the provided contents
 // or leaf hash. If the index is not provided, we'll do a tree lookup to find the entry's index.
 //
-// Returns the entry's leaf hash and index, or an error.
-func (l *logClientTool) inclusionProofArgs(ctx context.Context, args []string) ([]byte, uint64, error) {
-	var lh []byte
+// Returns the entry's leaf data, unless only its hash was provided, leaf hash, and index, or an
+// error.
+func (l *logClientTool) inclusionProofArgs(ctx context.Context, args []string) ([]byte, []byte, uint64, error) {
+	var leaf, lh []byte
 	var err error
 
 	if l := len(args); l < 1 || l > 2 {
-		return nil, 0, fmt.Errorf("usage: inclusion <file or leaf hash> [index-in-log]")
+		return nil, nil, 0, fmt.Errorf("usage: inclusion <file or leaf hash> [index-in-log]")
 	}
 
 	if *inclusionHash {
 		// We have a base-64 encoded leaf hash instead of the name of a file to hash.
 		lh, err = base64.StdEncoding.DecodeString(args[0])
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to base64 decode leaf hash: %w", err)
+			return nil, nil, 0, fmt.Errorf("failed to base64 decode leaf hash: %w", err)
 		}
 
 	} else {
 		// We have the name of a file to hash.
 		entry, err := os.ReadFile(args[0])
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to read entry from %q: %w", args[0], err)
+			return nil, nil, 0, fmt.Errorf("failed to read entry from %q: %w", args[0], err)
 		}
-		lh = l.Hasher.HashLeaf(entry)
+		if *inclusionBlob {
+			ref := api.NewBlobRef(entry)
+			if _, err := client.FetchBlob(ctx, l.Fetcher, ref); err != nil {
+				return nil, nil, 0, fmt.Errorf("failed to fetch blob: %w", err)
+			}
+			if entry, err = ref.MarshalText(); err != nil {
+				return nil, nil, 0, fmt.Errorf("failed to marshal blob reference: %w", err)
+			}
+		}
+		leaf, lh = entry, l.Hasher.HashLeaf(entry)
 	}
 
 	var idx uint64
 	if len(args) == 2 {
 		idx, err = strconv.ParseUint(args[1], 0, 64)
 		if err != nil {
-			return nil, 0, fmt.Errorf("invalid index-in-log %q: %w", args[1], err)
+			return nil, nil, 0, fmt.Errorf("invalid index-in-log %q: %w", args[1], err)
 		}
 	} else {
+		if _, ok := l.Layout.(client.ServerlessLayout); !ok {
+			return nil, nil, 0, fmt.Errorf("index-in-log must be provided for %s logs", *logLayout)
+		}
 		idx, err = client.LookupIndex(ctx, l.Fetcher, lh)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to lookup leaf index: %w", err)
+			return nil, nil, 0, fmt.Errorf("failed to lookup leaf index: %w", err)
 		}
 		klog.Infof("Leaf %q found at index %d", args[0], idx)
 	}
 
-	return lh, idx, nil
+	return leaf, lh, idx, nil
 }
 
 func (l *logClientTool) inclusionProof(ctx context.Context, args []string) error {
-	lh, idx, err := l.inclusionProofArgs(ctx, args)
+	leaf, lh, idx, err := l.inclusionProofArgs(ctx, args)
 	if err != nil {
 		return fmt.Errorf("failed to decode arguments: %w", err)
 	}
 
 	// TODO(al): wait for growth if necessary
 
-	cp := l.Tracker.LatestConsistent
-	builder, err := client.NewProofBuilder(ctx, cp, l.Hasher.HashChildren, l.Fetcher)
+	st := l.Tracker.State()
+	cp := st.Checkpoint
+	builder, err := client.NewProofBuilder(ctx, cp, l.Hasher.HashChildren, l.Fetcher, client.WithLayout(l.Layout))
 	if err != nil {
 		return fmt.Errorf("failed to create proof builder: %w", err)
 	}
@@ -327,14 +503,18 @@ func (l *logClientTool) inclusionProof(ctx context.Context, args []string) error
 	}
 
 	if o := *outputInclusion; len(o) > 0 {
-		ps := []byte(merkleProof(p).Marshal())
-		if err := os.WriteFile(o, ps, 0644); err != nil {
+		if err := writeInclusionProof(o, idx, p, st.Raw); err != nil {
 			klog.Warningf("Failed to write inclusion proof to %q: %v", o, err)
 		}
 	}
 
+	res := inclusionResult{Index: idx, Leaf: leaf, LeafHash: lh, Proof: p, Checkpoint: newJSONCheckpoint(cp, st.Raw)}
+	if err := writeBundle(res); err != nil {
+		klog.Warningf("Failed to write proof bundle: %v", err)
+	}
+
 	klog.Infof("Inclusion verified under checkpoint:\n%s", cp.Marshal())
-	return nil
+	return printJSON(res)
 }
 
 func (l *logClientTool) updateCheckpoint(ctx context.Context, args []string) error {
@@ -342,8 +522,9 @@ func (l *logClientTool) updateCheckpoint(ctx context.Context, args []string) err
 		return fmt.Errorf("usage: update")
 	}
 
-	klog.V(1).Infof("Original checkpoint:\n%s", l.Tracker.LatestConsistentRaw)
-	cp := l.Tracker.LatestConsistent
+	old := l.Tracker.State()
+	klog.V(1).Infof("Original checkpoint:\n%s", old.Raw)
+	cp := old.Checkpoint
 
 	_, p, newCPRaw, err := l.Tracker.Update(ctx)
 	if err != nil {
@@ -356,70 +537,180 @@ func (l *logClientTool) updateCheckpoint(ctx context.Context, args []string) err
 		}
 	}
 
-	if lcp := l.Tracker.LatestConsistent; lcp.Size == cp.Size {
+	st := l.Tracker.State()
+	res := updateResult{PreviousSize: cp.Size, Checkpoint: newJSONCheckpoint(st.Checkpoint, st.Raw)}
+	if st.Checkpoint.Size == cp.Size {
 		klog.Info("Log hasn't grown, nothing to update.")
-		return nil
+		return printJSON(res)
 	}
 
 	if o := *outputConsistency; len(o) > 0 {
-		if err := os.WriteFile(o, []byte(merkleProof(p).Marshal()), 0644); err != nil {
+		if err := writeConsistencyProof(o, cp.Size, p, st.Raw); err != nil {
 			klog.Warningf("Failed to write consistency proof to %q: %v", o, err)
 		}
 	}
 
-	klog.Infof("Updated checkpoint:\n%s", l.Tracker.LatestConsistentRaw)
+	klog.Infof("Updated checkpoint:\n%s", st.Raw)
 
-	return nil
+	res.Proof = p
+	return printJSON(res)
+}
+
+func (l *logClientTool) archivedCheckpoint(ctx context.Context, args []string) error {
+	if l := len(args); l != 1 {
+		return fmt.Errorf("usage: checkpoint <size>")
+	}
+	size, err := strconv.ParseUint(args[0], 0, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size %q: %w", args[0], err)
+	}
+	cp, cpRaw, err := l.fetchArchivedCheckpoint(ctx, size)
+	if err != nil {
+		return err
+	}
+	st := l.Tracker.State()
+	latest := st.Checkpoint
+	if cp.Size > latest.Size {
+		return fmt.Errorf("archived checkpoint size %d is larger than latest checkpoint size %d", cp.Size, latest.Size)
+	}
+	builder, err := client.NewProofBuilder(ctx, latest, l.Hasher.HashChildren, l.Fetcher, client.WithLayout(l.Layout))
+	if err != nil {
+		return fmt.Errorf("failed to create proof builder: %w", err)
+	}
+	p, err := builder.ConsistencyProof(ctx, cp.Size, latest.Size)
+	if err != nil {
+		return fmt.Errorf("failed to build consistency proof: %w", err)
+	}
+	if err := proof.VerifyConsistency(l.Hasher, cp.Size, latest.Size, p, cp.Hash, latest.Hash); err != nil {
+		return fmt.Errorf("archived checkpoint is inconsistent with latest checkpoint: %w", err)
+	}
+
+	if o := *outputCheckpoint; len(o) > 0 {
+		if err := os.WriteFile(o, cpRaw, 0644); err != nil {
+			klog.Warningf("Failed to write archived checkpoint to %q: %v", o, err)
+		}
+	}
+	if o := *outputConsistency; len(o) > 0 {
+		if err := writeConsistencyProof(o, cp.Size, p, st.Raw); err != nil {
+			klog.Warningf("Failed to write consistency proof to %q: %v", o, err)
+		}
+	}
+
+	klog.Infof("Archived checkpoint consistent with latest checkpoint of size %d:\n%s", latest.Size, cpRaw)
+	return printJSON(archivedCheckpointResult{
+		Checkpoint: newJSONCheckpoint(*cp, cpRaw),
+		Latest:     newJSONCheckpoint(latest, st.Raw),
+		Proof:      p,
+	})
 }
 
-// newFetcher creates a Fetcher for the log at the given root location.
-func newFetcher(root *url.URL) client.Fetcher {
-	get := getByScheme[root.Scheme]
-	if get == nil {
-		panic(fmt.Errorf("unsupported URL scheme %s", root.Scheme))
+// tail prints each leaf added to the log, starting from the given index or, by
+// default, the log's current size, until interrupted.
+func (l *logClientTool) tail(ctx context.Context, args []string) error {
+	if l := len(args); l > 1 {
+		return fmt.Errorf("usage: tail [start-index]")
+	}
+	var start uint64
+	if len(args) == 1 {
+		var err error
+		if start, err = strconv.ParseUint(args[0], 0, 64); err != nil {
+			return fmt.Errorf("invalid start-index %q: %w", args[0], err)
+		}
+	} else {
+		if _, _, _, err := l.Tracker.Update(ctx); err != nil {
+			return fmt.Errorf("failed to update checkpoint: %w", err)
+		}
+		start = l.Tracker.State().Checkpoint.Size
+	}
+	opts := []client.MonitorOption{client.WithStartIndex(start)}
+	if len(*positionFile) > 0 {
+		opts = append(opts, client.WithPositionStore(client.FilePositionStore{Path: *positionFile}))
+	}
+	print := func(_ context.Context, i uint64, leaf []byte) error {
+		if *outputFormat == formatJSON {
+			return printJSON(leafResult{Index: i, Data: leaf})
+		}
+		_, err := fmt.Fprintf(stdout, "%d %s\n", i, base64.StdEncoding.EncodeToString(leaf))
+		return err
+	}
+	m, err := client.NewMonitor(ctx, &l.Tracker, print, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create monitor: %w", err)
+	}
+	klog.V(1).Infof("Following log from index %d", m.Next())
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if err := m.Run(ctx, *tailInterval); err != nil && !errors.Is(err, context.Canceled) {
+		return err
 	}
+	klog.Infof("Stopped at index %d, log size %d", m.Next(), l.Tracker.State().Checkpoint.Size)
+	return nil
+}
 
-	return func(ctx context.Context, p string) ([]byte, error) {
-		u, err := root.Parse(p)
-		if err != nil {
-			return nil, err
+// fetchArchivedCheckpoint fetches the log's archived checkpoint for the given
+// tree size.
+func (l *logClientTool) fetchArchivedCheckpoint(ctx context.Context, size uint64) (*log.Checkpoint, []byte, error) {
+	if _, ok := l.Layout.(client.ServerlessLayout); !ok {
+		return nil, nil, fmt.Errorf("%s logs do not archive checkpoints", *logLayout)
+	}
+	// Checkpoints archived before a key rotation may be signed by any of the
+	// log's keys.
+	var cp *log.Checkpoint
+	var cpRaw []byte
+	var err error
+	for _, v := range l.Tracker.LogVerifiers.All() {
+		if cp, cpRaw, _, err = client.FetchArchivedCheckpoint(ctx, l.Fetcher, v, *origin, size); err == nil {
+			return cp, cpRaw, nil
 		}
-		return get(ctx, u)
 	}
+	return nil, nil, fmt.Errorf("failed to fetch archived checkpoint: %w", err)
 }
 
-var getByScheme = map[string]func(context.Context, *url.URL) ([]byte, error){
-	"http":  readHTTP,
-	"https": readHTTP,
-	"file": func(_ context.Context, u *url.URL) ([]byte, error) {
-		return os.ReadFile(u.Path)
-	},
+// newFetcher creates a Fetcher for the log at the given root location, which
+// uses hc for http(s) requests.
+func newFetcher(root *url.URL, hc *http.Client) client.Fetcher {
+	switch root.Scheme {
+	case "http", "https":
+		return client.HTTPFetcher(root, hc)
+	case "file":
+		return func(_ context.Context, p string) ([]byte, error) {
+			u, err := root.Parse(p)
+			if err != nil {
+				return nil, err
+			}
+			return os.ReadFile(u.Path)
+		}
+	}
+	panic(fmt.Errorf("unsupported URL scheme %s", root.Scheme))
 }
 
-func readHTTP(ctx context.Context, u *url.URL) ([]byte, error) {
-	req, err := http.NewRequest("GET", u.String(), nil)
-	if err != nil {
-		return nil, err
+// authFuncs returns the functions used to authenticate requests to the log, as
+// configured by the --bearer_token, --bearer_token_file, --oidc_audience, and
+// --header flags.
+func authFuncs() ([]client.AuthFunc, error) {
+	var auth []client.AuthFunc
+	n := 0
+	if len(*bearerToken) > 0 {
+		auth, n = append(auth, client.BearerTokenAuth(*bearerToken)), n+1
 	}
-	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
-	if err != nil {
-		return nil, err
+	if len(*bearerTokenFile) > 0 {
+		auth, n = append(auth, client.BearerTokenFileAuth(*bearerTokenFile)), n+1
 	}
-	switch resp.StatusCode {
-	case 404:
-		klog.Infof("Not found: %q", u.String())
-		return nil, os.ErrNotExist
-	case 200:
-		break
-	default:
-		return nil, fmt.Errorf("unexpected http status %q", resp.Status)
+	if len(*oidcAudience) > 0 {
+		auth, n = append(auth, client.MetadataIDTokenAuth(*oidcAudience)), n+1
+	}
+	if n > 1 {
+		return nil, errors.New("only one of --bearer_token, --bearer_token_file, and --oidc_audience may be set")
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			klog.Errorf("resp.Body.Close(): %v", err)
+	for _, h := range *headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || len(strings.TrimSpace(name)) == 0 {
+			return nil, fmt.Errorf("invalid --header %q, must be of the form \"Name: value\"", h)
 		}
-	}()
-	return io.ReadAll(resp.Body)
+		auth = append(auth, client.HeaderAuth(strings.TrimSpace(name), strings.TrimSpace(value)))
+	}
+	return auth, nil
 }
 
 // loadLocalCheckpoint reads the serialised checkpoint for the given logID from the
@@ -444,52 +735,85 @@ func storeLocalCheckpoint(logID string, cpRaw []byte) error {
 	return os.Rename(cpPathTmp, cpPath)
 }
 
-// Returns a log signature verifier and the public key bytes it uses.
+// Returns the log's signature verifiers.
 // Attempts to read key material from f, or uses the SERVERLESS_LOG_PUBLIC_KEY
-// env var if f is unset.
-func logSigVerifier(f string) (note.Verifier, []byte, error) {
+// env var if f is unset. Except for static-ct logs, the key material may hold
+// several keys, see client.ParseLogVerifiers.
+func logSigVerifiers(f string) (client.LogVerifiers, error) {
 	var pubKey []byte
 	var err error
 	if len(f) > 0 {
 		pubKey, err = os.ReadFile(f)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to read public key from file %q: %v", f, err)
+			return client.LogVerifiers{}, fmt.Errorf("failed to read public key from file %q: %v", f, err)
 		}
 	} else {
 		pubKey = []byte(os.Getenv("SERVERLESS_LOG_PUBLIC_KEY"))
 		if len(pubKey) == 0 {
-			return nil, nil, fmt.Errorf("supply public key file path using --log_public_key or set SERVERLESS_LOG_PUBLIC_KEY environment variable")
+			return client.LogVerifiers{}, fmt.Errorf("supply public key file path using --log_public_key or set SERVERLESS_LOG_PUBLIC_KEY environment variable")
 		}
 	}
 
-	v, err := note.NewVerifier(string(pubKey))
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create verifier: %v", err)
+	if *logLayout == client.LayoutStaticCT {
+		// static-ct-api logs publish their key as a PEM encoded public key.
+		b, _ := pem.Decode(pubKey)
+		if b == nil {
+			return client.LogVerifiers{}, errors.New("failed to decode PEM public key for static-ct log")
+		}
+		k, err := x509.ParsePKIXPublicKey(b.Bytes)
+		if err != nil {
+			return client.LogVerifiers{}, fmt.Errorf("failed to parse public key: %v", err)
+		}
+		v, err := client.NewStaticCTVerifier(*origin, k)
+		if err != nil {
+			return client.LogVerifiers{}, fmt.Errorf("failed to create verifier: %v", err)
+		}
+		return client.LogVerifiers{Required: []note.Verifier{v}}, nil
 	}
 
-	return v, pubKey, nil
+	lv, err := client.ParseLogVerifiers(pubKey)
+	if err != nil {
+		return client.LogVerifiers{}, fmt.Errorf("failed to create verifiers: %v", err)
+	}
+	return lv, nil
 }
 
-func witnessSigVerifiers(fs []string) ([]note.Verifier, error) {
-	vs := make([]note.Verifier, 0, len(fs))
-	for _, f := range fs {
-		v, err := sigVerifierFromFile(f)
+// witnessConfig returns the witness policy held in the policy file if it's set,
+// or otherwise a policy requiring quorum cosignatures from the witnesses whose
+// public keys are stored in the given files.
+func witnessConfig(policy string, fs []string, quorum int) (*client.WitnessConfig, error) {
+	if len(policy) > 0 {
+		if len(fs) > 0 {
+			return nil, errors.New("--witness_policy can't be used with --witness_public_key")
+		}
+		b, err := os.ReadFile(policy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read witness policy: %v", err)
+		}
+		c, err := client.ParseWitnessConfig(b)
 		if err != nil {
 			return nil, err
 		}
-		klog.V(1).Infof("Found witness %q", v.Name())
-		vs = append(vs, v)
+		klog.V(1).Infof("Requiring cosignatures from %d of %d witnesses", c.Policy.Quorum, len(c.Witnesses))
+		return c, nil
 	}
-	klog.V(1).Infof("Found %d witnesses", len(vs))
-	return vs, nil
-}
-
-func sigVerifierFromFile(f string) (note.Verifier, error) {
-	k, err := os.ReadFile(f)
+	vkeys := make([]string, 0, len(fs))
+	for _, f := range fs {
+		k, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key from file %q: %v", f, err)
+		}
+		vkeys = append(vkeys, strings.TrimSpace(string(k)))
+	}
+	c, err := client.NewWitnessConfig(quorum, vkeys...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read public key from file %q: %v", f, err)
+		return nil, err
+	}
+	for _, w := range c.Witnesses {
+		klog.V(1).Infof("Found witness %q", w.Name())
 	}
-	return note.NewVerifier(string(k))
+	klog.V(1).Infof("Found %d witnesses", len(c.Witnesses))
+	return c, nil
 }
 
 func distributors() ([]client.Fetcher, error) {
@@ -499,20 +823,7 @@ func distributors() ([]client.Fetcher, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid distributor URL %q: %v", d, err)
 		}
-		distribs = append(distribs, newFetcher(u))
+		distribs = append(distribs, newFetcher(u, nil))
 	}
 	return distribs, nil
 }
-
-// merkleProof represents Merkle proofs.
-type merkleProof [][]byte
-
-// Marshal returns a simple string-based representation of the proof.
-func (p merkleProof) Marshal() string {
-	b := strings.Builder{}
-	for _, l := range p {
-		b.WriteString(base64.StdEncoding.EncodeToString(l))
-		b.WriteRune('\n')
-	}
-	return b.String()
-}
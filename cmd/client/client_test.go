@@ -0,0 +1,184 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"github.com/transparency-dev/serverless-log/testonly"
+	"golang.org/x/mod/sumdb/note"
+)
+
+const testOrigin = "example.com/log/test"
+
+// testLog is a log held in a MemStorage and served over HTTP.
+type testLog struct {
+	st     *testonly.MemStorage
+	signer note.Signer
+	lv     client.LogVerifiers
+	srv    *httptest.Server
+	size   uint64
+
+	mu sync.Mutex
+	// overrides replaces the log's resources at the given paths, or hides
+	// them if nil.
+	overrides map[string][]byte
+}
+
+// newTestLog returns a log holding n leaves, "leaf 0" to "leaf n-1".
+func newTestLog(t *testing.T, n int) *testLog {
+	t.Helper()
+	skey, vkey, err := note.GenerateKey(rand.Reader, "test")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	tl := &testLog{
+		st:        testonly.NewMemStorage(),
+		signer:    s,
+		lv:        client.LogVerifiers{Required: []note.Verifier{v}},
+		overrides: make(map[string][]byte),
+	}
+	f := tl.st.Fetcher()
+	tl.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, "/")
+		tl.mu.Lock()
+		b, ok := tl.overrides[p]
+		tl.mu.Unlock()
+		if ok && b == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if !ok {
+			if b, err = f(r.Context(), p); errors.Is(err, os.ErrNotExist) {
+				http.NotFound(w, r)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(tl.srv.Close)
+	tl.grow(t, n)
+	return tl
+}
+
+// grow adds n leaves to the log and publishes a new checkpoint.
+func (tl *testLog) grow(t *testing.T, n int) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		l := tl.leaf(tl.size + uint64(i))
+		if _, err := tl.st.Sequence(ctx, rfc6962.DefaultHasher.HashLeaf(l), l); err != nil {
+			t.Fatalf("Sequence: %v", err)
+		}
+	}
+	cp, err := log.Integrate(ctx, tl.size, tl.st, rfc6962.DefaultHasher)
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	cp.Origin = testOrigin
+	cpRaw, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, tl.signer)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := tl.st.WriteCheckpoint(ctx, cpRaw); err != nil {
+		t.Fatalf("WriteCheckpoint: %v", err)
+	}
+	if err := tl.st.DeleteJournal(ctx); err != nil {
+		t.Fatalf("DeleteJournal: %v", err)
+	}
+	tl.size = cp.Size
+}
+
+// leaf returns the contents of the leaf at index i.
+func (tl *testLog) leaf(i uint64) []byte {
+	return []byte(fmt.Sprintf("leaf %d", i))
+}
+
+// replaceLeaf makes the log serve data in place of the leaf at index i.
+func (tl *testLog) replaceLeaf(i uint64, data []byte) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	d, k := layout.SeqPath("", i)
+	tl.overrides[filepath.Join(d, k)] = data
+}
+
+// removeLeafIndex makes the log stop serving the index of the leaf at index i.
+func (tl *testLog) removeLeafIndex(i uint64) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	d, k := layout.LeafPath("", rfc6962.DefaultHasher.HashLeaf(tl.leaf(i)))
+	tl.overrides[filepath.Join(d, k)] = nil
+}
+
+// tool returns a logClientTool for the log, which starts from its latest
+// checkpoint.
+func (tl *testLog) tool(t *testing.T) *logClientTool {
+	t.Helper()
+	setFlag(t, "origin", testOrigin)
+	setFlag(t, "cache_dir", "")
+	setFlag(t, "state_dir", "")
+	root, err := url.Parse(tl.srv.URL + "/")
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+	f := newFetcher(root, tl.srv.Client())
+	lc, err := newLogClientTool(context.Background(), fmtlog.ID(testOrigin), f, tl.lv, &client.WitnessConfig{}, nil)
+	if err != nil {
+		t.Fatalf("newLogClientTool: %v", err)
+	}
+	return lc
+}
+
+// setFlag sets the named flag for the duration of the test.
+func setFlag(t *testing.T, name, value string) {
+	t.Helper()
+	old := flag.Lookup(name).Value.String()
+	if err := flag.Set(name, value); err != nil {
+		t.Fatalf("flag.Set(%q, %q): %v", name, value, err)
+	}
+	t.Cleanup(func() {
+		if err := flag.Set(name, old); err != nil {
+			t.Errorf("flag.Set(%q, %q): %v", name, old, err)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/transparency-dev/serverless-log/client"
+)
+
+func TestFetchRange(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		desc         string
+		args         []string
+		noOutDir     bool
+		replaceLeaf  bool
+		wantErr      bool
+		wantMismatch bool
+		wantFrom     uint64
+		wantTo       uint64
+	}{
+		{
+			desc:   "whole log",
+			args:   []string{},
+			wantTo: 10,
+		}, {
+			desc:     "range",
+			args:     []string{"--from=3", "--to=7"},
+			wantFrom: 3,
+			wantTo:   7,
+		}, {
+			desc:     "from to end",
+			args:     []string{"--from=9"},
+			wantFrom: 9,
+			wantTo:   10,
+		}, {
+			desc:     "missing out_dir",
+			args:     []string{"--from=3"},
+			noOutDir: true,
+			wantErr:  true,
+		}, {
+			desc:    "extra args",
+			args:    []string{"3"},
+			wantErr: true,
+		}, {
+			desc:    "unknown flag",
+			args:    []string{"--start=3"},
+			wantErr: true,
+		}, {
+			desc:    "invalid index",
+			args:    []string{"--from=-1"},
+			wantErr: true,
+		}, {
+			desc:    "empty range",
+			args:    []string{"--from=5", "--to=5"},
+			wantErr: true,
+		}, {
+			desc:    "reversed range",
+			args:    []string{"--from=6", "--to=5"},
+			wantErr: true,
+		}, {
+			desc:    "from beyond log size",
+			args:    []string{"--from=10"},
+			wantErr: true,
+		}, {
+			desc:    "to beyond log size",
+			args:    []string{"--to=11"},
+			wantErr: true,
+		}, {
+			desc:         "replaced leaf",
+			args:         []string{"--from=3", "--to=7"},
+			replaceLeaf:  true,
+			wantErr:      true,
+			wantMismatch: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			tl := newTestLog(t, 10)
+			if test.replaceLeaf {
+				tl.replaceLeaf(5, []byte("not leaf 5"))
+			}
+			dir := filepath.Join(t.TempDir(), "leaves")
+			args := test.args
+			if !test.noOutDir {
+				args = append([]string{"--out_dir=" + dir}, args...)
+			}
+
+			err := tl.tool(t).fetchRange(ctx, args)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("fetchRange: got err %v, want err %t", err, test.wantErr)
+			}
+			if got := errors.Is(err, client.ErrProofMismatch); got != test.wantMismatch {
+				t.Errorf("fetchRange: got err %v, want ErrProofMismatch %t", err, test.wantMismatch)
+			}
+			if err != nil {
+				return
+			}
+			es, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("ReadDir: %v", err)
+			}
+			if got, want := len(es), int(test.wantTo-test.wantFrom); got != want {
+				t.Errorf("got %d files, want %d", got, want)
+			}
+			for i := test.wantFrom; i < test.wantTo; i++ {
+				b, err := os.ReadFile(filepath.Join(dir, strconv.FormatUint(i, 10)))
+				if err != nil {
+					t.Fatalf("ReadFile: %v", err)
+				}
+				if !bytes.Equal(b, tl.leaf(i)) {
+					t.Errorf("got leaf %d %q, want %q", i, b, tl.leaf(i))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/transparency-dev/serverless-log/client"
+	"k8s.io/klog/v2"
+)
+
+// lookup finds the index of a leaf hash in the log, and logs a verified
+// inclusion proof for it.
+func (l *logClientTool) lookup(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("lookup", flag.ContinueOnError)
+	leafHash := fs.String("leaf_hash", "", "Base64 encoded leaf hash to look up")
+	maxScan := fs.Uint64("max_scan", 0, "If the leaf hash can't be found in the log's leaf hash to index mapping, or the log doesn't publish one, scan up to this many of the log's most recent leaves for it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || len(*leafHash) == 0 {
+		return errors.New("usage: lookup --leaf_hash=<base64 leaf hash> [--max_scan=<leaves>]")
+	}
+	lh, err := base64.StdEncoding.DecodeString(*leafHash)
+	if err != nil {
+		return fmt.Errorf("failed to base64 decode leaf hash: %w", err)
+	}
+
+	st := l.Tracker.State()
+	cp, cpRaw := st.Checkpoint, st.Raw
+	scan := l.scanLeafIndex(cp.Size, *maxScan)
+	lookup := scan
+	if _, ok := l.Layout.(client.ServerlessLayout); ok {
+		index := client.ServerlessLeafIndex(l.Fetcher)
+		lookup = func(ctx context.Context, lh []byte) (uint64, error) {
+			idx, err := index(ctx, lh)
+			if errors.Is(err, os.ErrNotExist) && *maxScan > 0 {
+				klog.V(1).Infof("Leaf hash not found in index, scanning: %v", err)
+				return scan(ctx, lh)
+			}
+			return idx, err
+		}
+	}
+	idx, p, err := client.LookupVerifiedIndex(ctx, &l.Tracker, lookup, lh)
+	if err != nil {
+		return err
+	}
+
+	if o := *outputInclusion; len(o) > 0 {
+		if err := writeInclusionProof(o, idx, p, cpRaw); err != nil {
+			klog.Warningf("Failed to write inclusion proof to %q: %v", o, err)
+		}
+	}
+	res := inclusionResult{Index: idx, LeafHash: lh, Proof: p, Checkpoint: newJSONCheckpoint(cp, cpRaw)}
+	if err := writeBundle(res); err != nil {
+		klog.Warningf("Failed to write proof bundle: %v", err)
+	}
+	klog.Infof("Leaf %s found at index %d, inclusion proof %#x verified under checkpoint:\n%s", *leafHash, idx, p, cpRaw)
+	return printJSON(res)
+}
+
+// scanLeafIndex returns a LeafIndexFunc which finds a leaf hash by fetching up
+// to n of the most recent leaves in a log of the given size.
+func (l *logClientTool) scanLeafIndex(size, n uint64) client.LeafIndexFunc {
+	return func(ctx context.Context, lh []byte) (uint64, error) {
+		begin := size - min(n, size)
+		for b := begin; b < size; b += auditBatchSize {
+			_, hashes, err := l.fetchLeaves(ctx, b, min(b+auditBatchSize, size), size)
+			if err != nil {
+				return 0, err
+			}
+			for i, h := range hashes {
+				if bytes.Equal(h, lh) {
+					return b + uint64(i), nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("leaf hash not found in leaves [%d, %d): %w", begin, size, os.ErrNotExist)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestLookup(t *testing.T) {
+	ctx := context.Background()
+	leafHash := func(leaf string) string {
+		return "--leaf_hash=" + base64.StdEncoding.EncodeToString(rfc6962.DefaultHasher.HashLeaf([]byte(leaf)))
+	}
+
+	for _, test := range []struct {
+		desc string
+		args []string
+		// unindexed is set if the log doesn't serve the leaf hash to
+		// index mapping of leaf 8.
+		unindexed    bool
+		wantErr      bool
+		wantNotExist bool
+		wantIndex    uint64
+	}{
+		{
+			desc:      "indexed",
+			args:      []string{leafHash("leaf 3")},
+			wantIndex: 3,
+		}, {
+			desc:    "missing leaf_hash",
+			args:    []string{"--max_scan=10"},
+			wantErr: true,
+		}, {
+			desc:    "invalid leaf_hash",
+			args:    []string{"--leaf_hash=not base64!"},
+			wantErr: true,
+		}, {
+			desc:    "extra args",
+			args:    []string{leafHash("leaf 3"), "3"},
+			wantErr: true,
+		}, {
+			desc:    "invalid max_scan",
+			args:    []string{leafHash("leaf 3"), "--max_scan=-1"},
+			wantErr: true,
+		}, {
+			desc:         "unknown",
+			args:         []string{leafHash("leaf 10")},
+			wantErr:      true,
+			wantNotExist: true,
+		}, {
+			desc:         "unknown, scanned",
+			args:         []string{leafHash("leaf 10"), "--max_scan=10"},
+			wantErr:      true,
+			wantNotExist: true,
+		}, {
+			desc:         "unindexed",
+			args:         []string{leafHash("leaf 8")},
+			unindexed:    true,
+			wantErr:      true,
+			wantNotExist: true,
+		}, {
+			desc:      "unindexed, scanned",
+			args:      []string{leafHash("leaf 8"), "--max_scan=2"},
+			unindexed: true,
+			wantIndex: 8,
+		}, {
+			desc:         "unindexed, beyond max_scan",
+			args:         []string{leafHash("leaf 8"), "--max_scan=1"},
+			unindexed:    true,
+			wantErr:      true,
+			wantNotExist: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			setFlag(t, "format", formatJSON)
+			tl := newTestLog(t, 10)
+			if test.unindexed {
+				tl.removeLeafIndex(8)
+			}
+			lc := tl.tool(t)
+			out := captureStdout(t)
+
+			err := lc.lookup(ctx, test.args)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("lookup: got err %v, want err %t", err, test.wantErr)
+			}
+			if got := errors.Is(err, os.ErrNotExist); got != test.wantNotExist {
+				t.Errorf("lookup: got err %v, want os.ErrNotExist %t", err, test.wantNotExist)
+			}
+			if err != nil {
+				return
+			}
+			var res inclusionResult
+			if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+				t.Fatalf("Unmarshal(%q): %v", out, err)
+			}
+			if want := rfc6962.DefaultHasher.HashLeaf(tl.leaf(test.wantIndex)); res.Index != test.wantIndex || !bytes.Equal(res.LeafHash, want) {
+				t.Errorf("got index %d, leaf hash %x, want %d, %x", res.Index, res.LeafHash, test.wantIndex, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/transparency-dev/formats/log"
+)
+
+const (
+	// formatText prints human readable results to the log.
+	formatText = "text"
+	// formatJSON prints results to stdout as JSON objects.
+	formatJSON = "json"
+)
+
+// jsonCheckpoint is the JSON representation of a checkpoint. Byte slices are
+// encoded as base64 strings.
+type jsonCheckpoint struct {
+	Origin string `json:"origin"`
+	Size   uint64 `json:"size"`
+	Hash   []byte `json:"hash"`
+	// Note is the signed checkpoint note, as served by the log.
+	Note string `json:"note"`
+}
+
+func newJSONCheckpoint(cp log.Checkpoint, cpRaw []byte) *jsonCheckpoint {
+	return &jsonCheckpoint{Origin: cp.Origin, Size: cp.Size, Hash: cp.Hash, Note: string(cpRaw)}
+}
+
+// consistencyResult is the output of the consistency command.
+type consistencyResult struct {
+	From  uint64   `json:"from"`
+	To    uint64   `json:"to"`
+	Proof [][]byte `json:"proof"`
+}
+
+// inclusionResult is the output of the inclusion and lookup commands, and is
+// also the format of the proof bundles they write. Leaf is omitted if only the
+// leaf hash is known.
+type inclusionResult struct {
+	Index      uint64          `json:"index"`
+	Leaf       []byte          `json:"leaf,omitempty"`
+	LeafHash   []byte          `json:"leaf_hash"`
+	Proof      [][]byte        `json:"proof"`
+	Checkpoint *jsonCheckpoint `json:"checkpoint"`
+}
+
+// updateResult is the output of the update command. Proof is omitted if the
+// log hasn't grown.
+type updateResult struct {
+	PreviousSize uint64          `json:"previous_size"`
+	Checkpoint   *jsonCheckpoint `json:"checkpoint"`
+	Proof        [][]byte        `json:"consistency_proof,omitempty"`
+}
+
+// archivedCheckpointResult is the output of the checkpoint command.
+type archivedCheckpointResult struct {
+	Checkpoint *jsonCheckpoint `json:"checkpoint"`
+	Latest     *jsonCheckpoint `json:"latest"`
+	Proof      [][]byte        `json:"consistency_proof"`
+}
+
+// leafResult is the output of the tail command for each leaf.
+type leafResult struct {
+	Index uint64 `json:"index"`
+	Data  []byte `json:"data"`
+}
+
+// stdout is where commands print their results.
+var stdout io.Writer = os.Stdout
+
+// checkFormat returns an error if --format is not a supported output format.
+func checkFormat() error {
+	switch *outputFormat {
+	case formatText, formatJSON:
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, must be one of %s or %s", *outputFormat, formatText, formatJSON)
+}
+
+// printJSON writes v to stdout as a single line of JSON, if --format=json.
+func printJSON(v any) error {
+	if *outputFormat != formatJSON {
+		return nil
+	}
+	return json.NewEncoder(stdout).Encode(v)
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// captureStdout returns a buffer holding what's printed to stdout for the
+// duration of the test.
+func captureStdout(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	b := &bytes.Buffer{}
+	old := stdout
+	stdout = b
+	t.Cleanup(func() { stdout = old })
+	return b
+}
+
+func TestCheckFormat(t *testing.T) {
+	for _, test := range []struct {
+		format  string
+		wantErr bool
+	}{
+		{format: formatText},
+		{format: formatJSON},
+		{format: "yaml", wantErr: true},
+		{format: "", wantErr: true},
+	} {
+		t.Run(test.format, func(t *testing.T) {
+			setFlag(t, "format", test.format)
+			if err := checkFormat(); (err != nil) != test.wantErr {
+				t.Fatalf("checkFormat: got err %v, want err %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrintJSON(t *testing.T) {
+	for _, test := range []struct {
+		desc   string
+		format string
+		v      any
+		want   string
+	}{
+		{
+			desc:   "text",
+			format: formatText,
+			v:      leafResult{Index: 1, Data: []byte("leaf")},
+			want:   "",
+		}, {
+			desc:   "json",
+			format: formatJSON,
+			v:      leafResult{Index: 1, Data: []byte("leaf")},
+			want:   `{"index":1,"data":"bGVhZg=="}` + "\n",
+		}, {
+			desc:   "json omits empty leaf",
+			format: formatJSON,
+			v:      inclusionResult{Index: 2, LeafHash: []byte{1}, Proof: [][]byte{{2}}},
+			want:   `{"index":2,"leaf_hash":"AQ==","proof":["Ag=="],"checkpoint":null}` + "\n",
+		}, {
+			desc:   "json omits empty proof",
+			format: formatJSON,
+			v:      updateResult{PreviousSize: 3, Checkpoint: &jsonCheckpoint{Origin: "o", Size: 3, Hash: []byte{3}, Note: "n"}},
+			want:   `{"previous_size":3,"checkpoint":{"origin":"o","size":3,"hash":"Aw==","note":"n"}}` + "\n",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			setFlag(t, "format", test.format)
+			out := captureStdout(t)
+			if err := printJSON(test.v); err != nil {
+				t.Fatalf("printJSON: %v", err)
+			}
+			if got := out.String(); got != test.want {
+				t.Errorf("printJSON: got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCommandOutput(t *testing.T) {
+	ctx := context.Background()
+	tl := newTestLog(t, 10)
+	lh := rfc6962.DefaultHasher.HashLeaf(tl.leaf(3))
+
+	for _, format := range []string{formatText, formatJSON} {
+		t.Run(format, func(t *testing.T) {
+			setFlag(t, "format", format)
+			setFlag(t, "inclusion_hash", "true")
+			lc := tl.tool(t)
+			out := captureStdout(t)
+			if err := lc.inclusionProof(ctx, []string{base64.StdEncoding.EncodeToString(lh), "3"}); err != nil {
+				t.Fatalf("inclusionProof: %v", err)
+			}
+			if format == formatText {
+				if out.Len() != 0 {
+					t.Errorf("inclusionProof printed %q, want nothing", out)
+				}
+				return
+			}
+			var res inclusionResult
+			if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+				t.Fatalf("Unmarshal(%q): %v", out, err)
+			}
+			st := lc.Tracker.State()
+			if res.Index != 3 || !bytes.Equal(res.LeafHash, lh) || res.Leaf != nil {
+				t.Errorf("got index %d, leaf hash %x, leaf %q, want index 3, leaf hash %x, no leaf", res.Index, res.LeafHash, res.Leaf, lh)
+			}
+			if len(res.Proof) == 0 {
+				t.Error("got empty proof")
+			}
+			if cp := res.Checkpoint; cp == nil || cp.Size != st.Checkpoint.Size || !bytes.Equal(cp.Hash, st.Checkpoint.Hash) || cp.Note != string(st.Raw) {
+				t.Errorf("got checkpoint %+v, want %+v", cp, newJSONCheckpoint(st.Checkpoint, st.Raw))
+			}
+		})
+	}
+}
+
+func TestUpdateOutput(t *testing.T) {
+	ctx := context.Background()
+	setFlag(t, "format", formatJSON)
+	tl := newTestLog(t, 10)
+	lc := tl.tool(t)
+
+	for _, test := range []struct {
+		desc      string
+		grow      int
+		wantPrev  uint64
+		wantSize  uint64
+		wantProof bool
+	}{
+		{desc: "unchanged", wantPrev: 10, wantSize: 10},
+		{desc: "grown", grow: 5, wantPrev: 10, wantSize: 15, wantProof: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if test.grow > 0 {
+				tl.grow(t, test.grow)
+			}
+			out := captureStdout(t)
+			if err := lc.updateCheckpoint(ctx, nil); err != nil {
+				t.Fatalf("updateCheckpoint: %v", err)
+			}
+			var res updateResult
+			if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+				t.Fatalf("Unmarshal(%q): %v", out, err)
+			}
+			if res.PreviousSize != test.wantPrev || res.Checkpoint.Size != test.wantSize {
+				t.Errorf("got previous size %d, size %d, want %d, %d", res.PreviousSize, res.Checkpoint.Size, test.wantPrev, test.wantSize)
+			}
+			if got := len(res.Proof) > 0; got != test.wantProof {
+				t.Errorf("got proof %x, want proof %t", res.Proof, test.wantProof)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/serverless-log/client"
+	"k8s.io/klog/v2"
+)
+
+// writeBundle writes the proof bundle to --output_bundle, if it's set.
+func writeBundle(b inclusionResult) error {
+	if len(*outputBundle) == 0 {
+		return nil
+	}
+	raw, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*outputBundle, append(raw, '\n'), 0644)
+}
+
+// verifyBundle checks, using only the log's public key, that the leaf in a
+// proof bundle is included in the log under the bundle's checkpoint. If a file
+// is given, the bundle's leaf must also be the file's contents.
+//
+// Only the bundle's signed checkpoint note is trusted; its other checkpoint
+// fields are ignored. The checkpoint must satisfy the witness policy, and with
+// --state_dir, must match any stored checkpoint of the same size.
+func verifyBundle(ctx context.Context, lv client.LogVerifiers, witnesses *client.WitnessConfig, args []string) error {
+	if l := len(args); l < 1 || l > 2 {
+		return errors.New("usage: verify-bundle <bundle> [file]")
+	}
+	raw, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read bundle: %v", err)
+	}
+	var b inclusionResult
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return fmt.Errorf("invalid bundle: %v", err)
+	}
+	if b.Checkpoint == nil {
+		return errors.New("invalid bundle: no checkpoint")
+	}
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		return err
+	}
+	bundle := client.InclusionBundle{Checkpoint: []byte(b.Checkpoint.Note), Index: b.Index, Leaf: b.Leaf, LeafHash: b.LeafHash, Proof: b.Proof}
+	if len(args) == 2 {
+		if bundle.Leaf, err = os.ReadFile(args[1]); err != nil {
+			return fmt.Errorf("failed to read file: %v", err)
+		}
+	}
+	cp, lh, err := bundle.Verify(h, lv, *origin, witnesses)
+	if err != nil {
+		return err
+	}
+	if err := checkStoredCheckpoint(ctx, lv, *cp, bundle.Checkpoint); err != nil {
+		return err
+	}
+
+	klog.Infof("Inclusion of leaf %x at index %d verified under checkpoint:\n%s", lh, b.Index, b.Checkpoint.Note)
+	return printJSON(inclusionResult{Index: b.Index, LeafHash: lh, Proof: b.Proof, Checkpoint: newJSONCheckpoint(*cp, []byte(b.Checkpoint.Note))})
+}
+
+// verifyCheckpoint checks that cpRaw is a checkpoint signed by the log which
+// satisfies the witness policy, and with --state_dir, that it matches any
+// stored checkpoint of the same size.
+func verifyCheckpoint(ctx context.Context, lv client.LogVerifiers, witnesses *client.WitnessConfig, cpRaw []byte) (*log.Checkpoint, error) {
+	cp, _, n, err := lv.ParseCheckpoint(cpRaw, *origin, witnesses.Witnesses...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify checkpoint: %w", err)
+	}
+	if err := witnesses.Policy.Check(n, witnesses.Witnesses...); err != nil {
+		return nil, fmt.Errorf("checkpoint does not satisfy witness policy: %w", err)
+	}
+	if err := checkStoredCheckpoint(ctx, lv, *cp, cpRaw); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// checkStoredCheckpoint returns an ErrEquivocation if --state_dir is set, and
+// a checkpoint of the same size as cp, but with a different root hash, is
+// stored under it.
+func checkStoredCheckpoint(ctx context.Context, lv client.LogVerifiers, cp log.Checkpoint, cpRaw []byte) error {
+	if len(*stateDir) == 0 {
+		return nil
+	}
+	sd := client.StateDir{Dir: *stateDir}
+	if err := sd.CheckCheckpoint(ctx, cp, cpRaw); err != nil {
+		return err
+	}
+	if latest, err := sd.Load(ctx, cp.Origin); err == nil {
+		if l, _, _, err := lv.ParseCheckpoint(latest, cp.Origin); err == nil && l.Size < cp.Size {
+			klog.Warningf("Checkpoint of size %d is newer than the stored checkpoint of size %d, run the update command to check their consistency", cp.Size, l.Size)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/client"
+	"k8s.io/klog/v2"
+)
+
+// writeInclusionProof writes the inclusion proof for the leaf at idx, along
+// with the checkpoint it was verified under, to path in the
+// c2sp.org/tlog-proof@v1 format.
+func writeInclusionProof(path string, idx uint64, hashes [][]byte, cpRaw []byte) error {
+	raw, err := api.InclusionProof{Index: idx, Hashes: hashes, Checkpoint: cpRaw}.MarshalText()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0644)
+}
+
+// writeConsistencyProof writes the consistency proof from oldSize to the size
+// of the given checkpoint, along with the checkpoint, to path in the format
+// described by api.ConsistencyProof.
+func writeConsistencyProof(path string, oldSize uint64, hashes [][]byte, cpRaw []byte) error {
+	raw, err := api.ConsistencyProof{OldSize: oldSize, Hashes: hashes, Checkpoint: cpRaw}.MarshalText()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0644)
+}
+
+// verifyProof checks, using only the log's public key, a proof written with
+// --output_inclusion_proof or --output_consistency_proof.
+//
+// For inclusion proofs, the second argument is the file whose inclusion is to
+// be verified, or its base64 leaf hash with --inclusion_hash. For consistency
+// proofs, it's a file holding the checkpoint for the proof's old size, which
+// may be omitted if that checkpoint is stored under --state_dir.
+func verifyProof(ctx context.Context, lv client.LogVerifiers, witnesses *client.WitnessConfig, args []string) error {
+	if l := len(args); l < 1 || l > 2 {
+		return errors.New("usage: verify-proof <proof> [file or leaf hash | old-checkpoint]")
+	}
+	raw, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read proof: %v", err)
+	}
+	switch {
+	case bytes.HasPrefix(raw, []byte(api.InclusionProofHeader+"\n")):
+		var p api.InclusionProof
+		if err := p.UnmarshalText(raw); err != nil {
+			return fmt.Errorf("invalid inclusion proof: %v", err)
+		}
+		return verifyInclusionProof(ctx, lv, witnesses, p, args[1:])
+	case bytes.HasPrefix(raw, []byte(api.ConsistencyProofHeader+"\n")):
+		var p api.ConsistencyProof
+		if err := p.UnmarshalText(raw); err != nil {
+			return fmt.Errorf("invalid consistency proof: %v", err)
+		}
+		return verifyConsistencyProof(ctx, lv, witnesses, p, args[1:])
+	default:
+		return errors.New("unknown proof format")
+	}
+}
+
+func verifyInclusionProof(ctx context.Context, lv client.LogVerifiers, witnesses *client.WitnessConfig, p api.InclusionProof, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: verify-proof <inclusion proof> <file or leaf hash>")
+	}
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		return err
+	}
+	var lh []byte
+	if *inclusionHash {
+		if lh, err = base64.StdEncoding.DecodeString(args[0]); err != nil {
+			return fmt.Errorf("failed to base64 decode leaf hash: %w", err)
+		}
+	} else {
+		leaf, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read file: %v", err)
+		}
+		lh = h.HashLeaf(leaf)
+	}
+	cp, _, err := client.InclusionBundle{Checkpoint: p.Checkpoint, Index: p.Index, LeafHash: lh, Proof: p.Hashes}.Verify(h, lv, *origin, witnesses)
+	if err != nil {
+		return err
+	}
+	if err := checkStoredCheckpoint(ctx, lv, *cp, p.Checkpoint); err != nil {
+		return err
+	}
+
+	klog.Infof("Inclusion of leaf %x at index %d verified under checkpoint:\n%s", lh, p.Index, p.Checkpoint)
+	return printJSON(inclusionResult{Index: p.Index, LeafHash: lh, Proof: p.Hashes, Checkpoint: newJSONCheckpoint(*cp, p.Checkpoint)})
+}
+
+func verifyConsistencyProof(ctx context.Context, lv client.LogVerifiers, witnesses *client.WitnessConfig, p api.ConsistencyProof, args []string) error {
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		return err
+	}
+	var oldRaw []byte
+	switch {
+	case len(args) == 1:
+		if oldRaw, err = os.ReadFile(args[0]); err != nil {
+			return fmt.Errorf("failed to read old checkpoint: %v", err)
+		}
+	case len(*stateDir) > 0:
+		_, history, err := client.StateDir{Dir: *stateDir}.Stores(*origin)
+		if err != nil {
+			return err
+		}
+		if oldRaw, err = history.Get(ctx, p.OldSize); err != nil {
+			return fmt.Errorf("failed to read stored checkpoint of size %d: %v", p.OldSize, err)
+		}
+	default:
+		return errors.New("usage: verify-proof <consistency proof> <old-checkpoint>")
+	}
+	old, _, _, err := lv.ParseCheckpoint(oldRaw, *origin)
+	if err != nil {
+		return fmt.Errorf("failed to verify old checkpoint: %w", err)
+	}
+	if old.Size != p.OldSize {
+		return fmt.Errorf("old checkpoint has size %d, but proof is from size %d", old.Size, p.OldSize)
+	}
+	cp, err := verifyCheckpoint(ctx, lv, witnesses, p.Checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := proof.VerifyConsistency(h, old.Size, cp.Size, p.Hashes, old.Hash, cp.Hash); err != nil {
+		return fmt.Errorf("failed to verify consistency proof: %w", err)
+	}
+
+	klog.Infof("Consistency between sizes %d and %d verified, checkpoint:\n%s", old.Size, cp.Size, p.Checkpoint)
+	return printJSON(consistencyResult{From: old.Size, To: cp.Size, Proof: p.Hashes})
+}
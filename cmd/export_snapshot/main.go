@@ -0,0 +1,143 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for exporting a verified snapshot
+// of a serverless log to a single tar archive, e.g. for cold backups or for
+// distribution to air-gapped environments.
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/snapshot"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+	"k8s.io/klog/v2"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+var (
+	storageDir  = flag.String("storage_dir", "", "Root directory of the log to export.")
+	output      = flag.String("output", "", "Path of the archive to write, or - to write it to stdout. The archive is gzip compressed if the path ends in .gz.")
+	pubKeyFile  = flag.String("public_key", "", "Location of public key file, which may hold several keys, see client.ParseLogVerifiers. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin      = flag.String("origin", "", "Log origin string to check for in checkpoints.")
+	hashFunc    = flag.String("hash", client.HashSHA256, "Hash function used for the log's Merkle tree, one of sha256 or sha512_256.")
+	compression = flag.String("compression", "none", "Compression used for the log's leaf data and tiles, one of none, gzip, or zstd.")
+	lock        = flag.Bool("lock", true, "Set to hold the log's sequence and integrate locks while it's exported, so that the snapshot is consistent.")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+	ctx := context.Background()
+
+	if len(*storageDir) == 0 {
+		klog.Exit("Please set --storage_dir flag.")
+	}
+	if len(*output) == 0 {
+		klog.Exit("Please set --output flag.")
+	}
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		klog.Exitf("Invalid --hash: %v", err)
+	}
+	comp, err := compress.Parse(*compression)
+	if err != nil {
+		klog.Exitf("Invalid --compression: %v", err)
+	}
+
+	// Read log public key from file or environment variable
+	var pubKey string
+	if len(*pubKeyFile) > 0 {
+		k, err := os.ReadFile(*pubKeyFile)
+		if err != nil {
+			klog.Exitf("failed to read public_key file: %q", err)
+		}
+		pubKey = string(k)
+	} else {
+		pubKey = os.Getenv("SERVERLESS_LOG_PUBLIC_KEY")
+		if len(pubKey) == 0 {
+			klog.Exit("supply public key file path using --public_key or set SERVERLESS_LOG_PUBLIC_KEY environment variable")
+		}
+	}
+	lv, err := client.ParseLogVerifiers([]byte(pubKey))
+	if err != nil {
+		klog.Exitf("Failed to instantiate Verifiers: %q", err)
+	}
+
+	m, err := export(ctx, lv, h, comp)
+	if err != nil {
+		klog.Exitf("Failed to export log: %q", err)
+	}
+	fmt.Fprintf(os.Stderr, "Exported log %q of size %d with root hash %x: %d files\n", m.Origin, m.Size, m.RootHash, len(m.Files))
+}
+
+// export writes the snapshot to --output, holding the log's locks if --lock
+// is set.
+func export(ctx context.Context, lv client.LogVerifiers, h merkle.LogHasher, comp compress.Algorithm) (m *snapshot.Manifest, err error) {
+	if *lock {
+		for _, l := range []fs.Lock{fs.SequenceLock, fs.IntegrateLock} {
+			unlock, err := fs.AcquireLock(*storageDir, l)
+			if err != nil {
+				return nil, err
+			}
+			defer func() {
+				if err := unlock(); err != nil {
+					klog.Errorf("Failed to unlock log: %q", err)
+				}
+			}()
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if cErr := f.Close(); err == nil {
+				err = cErr
+			}
+			if err != nil {
+				// Don't leave a partial archive behind.
+				_ = os.Remove(*output)
+			}
+		}()
+		w = f
+		if strings.HasSuffix(*output, ".gz") {
+			zw := gzip.NewWriter(f)
+			defer func() {
+				if cErr := zw.Close(); err == nil {
+					err = cErr
+				}
+			}()
+			w = zw
+		}
+	}
+	open := func(cpRaw []byte) (*fmtlog.Checkpoint, error) {
+		cp, _, _, err := lv.ParseCheckpoint(cpRaw, *origin)
+		return cp, err
+	}
+	return snapshot.Export(ctx, *storageDir, w, open, h, comp)
+}
@@ -16,20 +16,54 @@
 package main
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/transparency-dev/serverless-log/internal/encrypt"
+	"github.com/transparency-dev/serverless-log/internal/signer"
+	"github.com/transparency-dev/serverless-log/internal/signer/gcpkms"
 	"golang.org/x/mod/sumdb/note"
 	"k8s.io/klog/v2"
 )
 
+const (
+	// keyEd25519 is an Ed25519 note key, as used to sign a log's checkpoints.
+	keyEd25519 = "ed25519"
+	// keyCosignatureV1 is an Ed25519 key used by a witness to make
+	// cosignature/v1 signatures.
+	keyCosignatureV1 = "cosignature/v1"
+	// keyECDSA is an ECDSA P-256 key, see signer.AlgECDSA.
+	keyECDSA = "ecdsa"
+
+	// formatNote writes keys as note signer and verifier keys.
+	formatNote = "note"
+	// formatPEM writes keys as PEM encoded PKCS#8 private keys and PKIX
+	// public keys.
+	formatPEM = "pem"
+)
+
 var (
 	keyName = flag.String("key_name", "", "Name for the key identity.")
 	outPriv = flag.String("out_priv", "", "Output file for private key.")
 	outPub  = flag.String("out_pub", "", "Output file for public key.")
-	print   = flag.Bool("print", false, "Print private key, then public key, over 2 lines, to stdout.")
+	print   = flag.Bool("print", false, "Print private key, then public key, to stdout.")
+	outEnc  = flag.String("out_encryption_key", "", "If set, instead of a signing key, a new key encryption key for encrypting leaf data at rest is written to this file, see the integrate tool's --encryption_key flag.")
+	keyType = flag.String("key_type", keyEd25519, "Type of signing key to create: ed25519 for a log's note signing key, cosignature/v1 for a witness key, or ecdsa for an ECDSA P-256 key.")
+	kmsKey  = flag.String("gcp_kms_key", "", "If set, instead of generating a key locally, a new signing key of --key_type ed25519 or ecdsa is created in Cloud KMS with this name, e.g. projects/p/locations/l/keyRings/r/cryptoKeys/k, and only its note verifier key is output, with --out_pub or --print. The key ring must already exist.")
+	kmsProt = flag.String("gcp_kms_protection_level", "SOFTWARE", "Protection level of the key created with --gcp_kms_key, either SOFTWARE or HSM.")
+	format  = flag.String("format", formatNote, "Format in which to write the keys: note for note signer and verifier keys, or pem for a PKCS#8 private key and PKIX public key, e.g. to import into a KMS or HSM. ECDSA keys must be written as pem.")
 )
 
 func main() {
@@ -40,32 +74,169 @@ func main() {
 		klog.Exit("--key_name required")
 	}
 
+	if len(*outEnc) > 0 {
+		k, err := encrypt.GenerateLocalKey(*keyName)
+		if err != nil {
+			klog.Exitf("Unable to create key: %q", err)
+		}
+		if err := writeFileIfNotExists(*outEnc, k+"\n"); err != nil {
+			klog.Exit(err)
+		}
+		return
+	}
+
+	if len(*kmsKey) > 0 {
+		createKMSKey()
+		return
+	}
+
 	if !(*print) {
 		if len(*outPriv) == 0 || len(*outPub) == 0 {
 			klog.Exit("--print and/or --out_priv and --out_pub required.")
 		}
 	}
 
-	skey, vkey, err := note.GenerateKey(rand.Reader, *keyName)
+	k, err := generate(*keyType, *keyName)
 	if err != nil {
 		klog.Exitf("Unable to create key: %q", err)
 	}
+	var priv, pub string
+	switch *format {
+	case formatNote:
+		if k.skey == "" {
+			klog.Exitf("%s keys can only be written with --format=%s", *keyType, formatPEM)
+		}
+		priv, pub = k.skey, k.vkey
+	case formatPEM:
+		priv, pub = k.privPEM, k.pubPEM
+		klog.Infof("Note verifier key: %s", k.vkey)
+	default:
+		klog.Exitf("Unknown --format %q", *format)
+	}
 
 	if *print {
-		fmt.Println(skey)
-		fmt.Println(vkey)
+		fmt.Println(strings.TrimSpace(priv))
+		fmt.Println(strings.TrimSpace(pub))
 	}
 
 	if len(*outPriv) > 0 && len(*outPub) > 0 {
-		if err := writeFileIfNotExists(*outPriv, skey); err != nil {
+		if err := writeFileIfNotExists(*outPriv, priv); err != nil {
+			klog.Exit(err)
+		}
+		if err := writeFileIfNotExists(*outPub, pub); err != nil {
 			klog.Exit(err)
 		}
+	}
+}
+
+// createKMSKey creates the --gcp_kms_key key in Cloud KMS, and outputs its
+// note verifier key.
+func createKMSKey() {
+	var alg string
+	switch *keyType {
+	case keyEd25519:
+		alg = "EC_SIGN_ED25519"
+	case keyECDSA:
+		alg = "EC_SIGN_P256_SHA256"
+	default:
+		klog.Exitf("--gcp_kms_key can't be used with --key_type=%s", *keyType)
+	}
+	if !(*print) && len(*outPub) == 0 {
+		klog.Exit("--print and/or --out_pub required.")
+	}
+	v, pk, err := gcpkms.CreateKey(context.Background(), *kmsKey, alg, *kmsProt)
+	if err != nil {
+		klog.Exitf("Unable to create key: %q", err)
+	}
+	klog.Infof("Created Cloud KMS key version %s, pass this to the integrate tool's --gcp_kms_key flag", v)
+	vkey := pk.VerifierKey(*keyName)
+	if *print {
+		fmt.Println(vkey)
+	}
+	if len(*outPub) > 0 {
 		if err := writeFileIfNotExists(*outPub, vkey); err != nil {
 			klog.Exit(err)
 		}
 	}
 }
 
+// key is a newly generated signing key.
+type key struct {
+	// skey is the note signer key, or empty if the key has none.
+	skey string
+	// vkey is the note verifier key.
+	vkey string
+	// privPEM and pubPEM are the PEM encoded PKCS#8 private key and PKIX
+	// public key.
+	privPEM, pubPEM string
+}
+
+// generate creates a new signing key of the given type, see --key_type.
+func generate(keyType, name string) (key, error) {
+	var k key
+	var priv any
+	switch keyType {
+	case keyEd25519, keyCosignatureV1:
+		skey, vkey, err := note.GenerateKey(rand.Reader, name)
+		if err != nil {
+			return key{}, err
+		}
+		seed, err := keyData(skey)
+		if err != nil {
+			return key{}, err
+		}
+		edPriv := ed25519.NewKeyFromSeed(seed)
+		priv = edPriv
+		k.skey, k.vkey = skey, vkey
+		if keyType == keyCosignatureV1 {
+			// Witnesses sign with an ordinary Ed25519 note signer key, but
+			// their verifier keys use a distinct algorithm identifier.
+			pk := signer.PublicKey{Alg: signer.AlgCosignatureV1, Key: edPriv.Public().(ed25519.PublicKey)}
+			k.vkey = pk.VerifierKey(name)
+		}
+	case keyECDSA:
+		ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return key{}, err
+		}
+		der, err := x509.MarshalPKIXPublicKey(&ecPriv.PublicKey)
+		if err != nil {
+			return key{}, err
+		}
+		priv = ecPriv
+		k.vkey = signer.PublicKey{Alg: signer.AlgECDSA, Key: der}.VerifierKey(name)
+	default:
+		return key{}, fmt.Errorf("unknown key type %q", keyType)
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return key{}, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(priv.(interface{ Public() crypto.PublicKey }).Public())
+	if err != nil {
+		return key{}, err
+	}
+	k.privPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}))
+	k.pubPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	return k, nil
+}
+
+// keyData returns the Ed25519 seed held by the note signer key skey, which is
+// of the form PRIVATE+KEY+<name>+<hash>+<keydata>.
+func keyData(skey string) ([]byte, error) {
+	// The key data is base64 encoded, so may itself contain "+".
+	parts := strings.SplitN(skey, "+", 5)
+	if len(parts) != 5 {
+		return nil, errors.New("malformed note signer key")
+	}
+	d, err := base64.StdEncoding.DecodeString(parts[4])
+	if err != nil || len(d) != 1+ed25519.SeedSize || d[0] != signer.AlgEd25519 {
+		return nil, errors.New("malformed note signer key")
+	}
+	return d[1:], nil
+}
+
 // writeFileIfNotExists writes key files. Ensures files do not already exist to avoid accidental overwriting.
 func writeFileIfNotExists(filename string, key string) error {
 	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
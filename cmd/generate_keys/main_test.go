@@ -0,0 +1,70 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestKeyData(t *testing.T) {
+	seed := bytes.Repeat([]byte{0xfb}, 32)
+	data := base64.StdEncoding.EncodeToString(append([]byte{0x01}, seed...))
+	if !strings.Contains(data, "+") {
+		t.Fatalf("key data %q doesn't contain '+'", data)
+	}
+	skey, _, err := note.GenerateKey(nil, "example.com/log")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc    string
+		skey    string
+		want    []byte
+		wantErr bool
+	}{
+		{
+			desc: "generated key",
+			skey: skey,
+		}, {
+			desc: "key data containing '+'",
+			skey: "PRIVATE+KEY+example.com/log+0123abcd+" + data,
+			want: seed,
+		}, {
+			desc:    "wrong algorithm",
+			skey:    "PRIVATE+KEY+example.com/log+0123abcd+" + base64.StdEncoding.EncodeToString(append([]byte{0x04}, seed...)),
+			wantErr: true,
+		}, {
+			desc:    "missing key data",
+			skey:    "PRIVATE+KEY+example.com/log+0123abcd",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := keyData(test.skey)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("keyData: got err %v, want err %t", err, test.wantErr)
+			}
+			if test.want != nil && !bytes.Equal(got, test.want) {
+				t.Errorf("keyData: got %x, want %x", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for restoring a serverless log
+// from a snapshot archive written by the export_snapshot tool.
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/internal/snapshot"
+	"k8s.io/klog/v2"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+var (
+	input      = flag.String("input", "", "Path of the snapshot archive to restore, or - to read it from stdin. The archive is gzip decompressed if the path ends in .gz.")
+	storageDir = flag.String("storage_dir", "", "Root directory to restore the log to, which must not already exist.")
+	stagingDir = flag.String("staging_dir", "", "Directory in which the snapshot is extracted and verified before it's restored. If unset, the default directory for temporary files is used.")
+	pubKeyFile = flag.String("public_key", "", "Location of public key file, which may hold several keys, see client.ParseLogVerifiers. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin     = flag.String("origin", "", "Log origin string to check for in checkpoints.")
+	hashFunc   = flag.String("hash", client.HashSHA256, "Hash function used for the log's Merkle tree, one of sha256 or sha512_256.")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+	ctx := context.Background()
+
+	if len(*input) == 0 {
+		klog.Exit("Please set --input flag.")
+	}
+	if len(*storageDir) == 0 {
+		klog.Exit("Please set --storage_dir flag.")
+	}
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		klog.Exitf("Invalid --hash: %v", err)
+	}
+
+	// Read log public key from file or environment variable
+	var pubKey string
+	if len(*pubKeyFile) > 0 {
+		k, err := os.ReadFile(*pubKeyFile)
+		if err != nil {
+			klog.Exitf("failed to read public_key file: %q", err)
+		}
+		pubKey = string(k)
+	} else {
+		pubKey = os.Getenv("SERVERLESS_LOG_PUBLIC_KEY")
+		if len(pubKey) == 0 {
+			klog.Exit("supply public key file path using --public_key or set SERVERLESS_LOG_PUBLIC_KEY environment variable")
+		}
+	}
+	lv, err := client.ParseLogVerifiers([]byte(pubKey))
+	if err != nil {
+		klog.Exitf("Failed to instantiate Verifiers: %q", err)
+	}
+	open := func(cpRaw []byte) (*fmtlog.Checkpoint, error) {
+		cp, _, _, err := lv.ParseCheckpoint(cpRaw, *origin)
+		return cp, err
+	}
+
+	r, closeInput, err := openInput(*input)
+	if err != nil {
+		klog.Exitf("Failed to open --input: %q", err)
+	}
+	defer closeInput()
+	dst, err := snapshot.NewDirDestination(*storageDir)
+	if err != nil {
+		klog.Exitf("Failed to create --storage_dir: %q", err)
+	}
+	m, err := snapshot.Import(ctx, r, dst, open, h, *stagingDir)
+	if err != nil {
+		if rErr := os.RemoveAll(*storageDir); rErr != nil {
+			klog.Errorf("Failed to remove --storage_dir: %q", rErr)
+		}
+		klog.Exitf("Failed to restore log: %q", err)
+	}
+	fmt.Printf("Restored log %q of size %d with root hash %x: %d files\n", m.Origin, m.Size, m.RootHash, len(m.Files))
+	if m.Compression != "" {
+		fmt.Printf("The log's leaf data and tiles are compressed, pass --compression=%s to the other tools\n", m.Compression)
+	}
+	if m.BundleSize > 1 {
+		fmt.Printf("The log's leaves are stored in bundles of %d\n", m.BundleSize)
+	}
+}
+
+// openInput returns a reader for the snapshot at p, see --input, and a
+// function which closes it.
+func openInput(p string) (io.Reader, func(), error) {
+	if p == "-" {
+		return os.Stdin, func() {}, nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasSuffix(p, ".gz") {
+		return f, func() { _ = f.Close() }, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return zr, func() { _ = zr.Close(); _ = f.Close() }, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// errDryRun is returned by dryRunStorage for writes which cannot be recorded.
+var errDryRun = errors.New("not supported in a dry run")
+
+// dryRunStorage is a log.Storage which reads from the log's storage, but only
+// records the paths of tiles which would be stored, rather than storing them.
+//
+// It doesn't implement log.LeafIndexer, so integrated leaves aren't indexed,
+// and journals are read but never written or deleted.
+type dryRunStorage struct {
+	st dryRunSource
+
+	mu    sync.Mutex
+	tiles []string
+}
+
+// dryRunSource is the part of the log's storage which dryRunStorage reads from.
+type dryRunSource interface {
+	GetTile(ctx context.Context, level, index, logSize uint64) (*api.Tile, error)
+	ScanSequenced(ctx context.Context, begin uint64, f func(seq uint64, entry []byte) error) (uint64, error)
+	ReadJournal(ctx context.Context) ([]byte, error)
+}
+
+var (
+	_ dryRunSource = &fs.Storage{}
+	_ log.Storage  = &dryRunStorage{}
+	_ log.Journal  = &dryRunStorage{}
+)
+
+func (d *dryRunStorage) GetTile(ctx context.Context, level, index, logSize uint64) (*api.Tile, error) {
+	return d.st.GetTile(ctx, level, index, logSize)
+}
+
+func (d *dryRunStorage) StoreTile(_ context.Context, level, index uint64, tile *api.Tile) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tiles = append(d.tiles, path.Join(layout.TilePath("", level, index, uint64(tile.NumLeaves)%256)))
+	return nil
+}
+
+func (d *dryRunStorage) WriteCheckpoint(context.Context, []byte) error {
+	return errDryRun
+}
+
+func (d *dryRunStorage) Sequence(context.Context, []byte, []byte) (uint64, error) {
+	return 0, errDryRun
+}
+
+func (d *dryRunStorage) ScanSequenced(ctx context.Context, begin uint64, f func(seq uint64, entry []byte) error) (uint64, error) {
+	return d.st.ScanSequenced(ctx, begin, f)
+}
+
+func (d *dryRunStorage) ReadJournal(ctx context.Context) ([]byte, error) {
+	return d.st.ReadJournal(ctx)
+}
+
+func (d *dryRunStorage) WriteJournal(context.Context, []byte) error {
+	return nil
+}
+
+func (d *dryRunStorage) DeleteJournal(context.Context) error {
+	return nil
+}
+
+// printDryRun writes a summary of the integration which would have updated the
+// log from oldSize to the new checkpoint cp to w, including the resources
+// which would have been written.
+func printDryRun(w io.Writer, oldSize uint64, cp *fmtlog.Checkpoint, d *dryRunStorage) {
+	if cp == nil {
+		fmt.Fprintf(w, "Dry run: nothing to integrate, log size is %d\n", oldSize)
+		return
+	}
+	cp.Origin = *origin
+	fmt.Fprintf(w, "Dry run: log would grow from size %d to %d, with root hash %x\n", oldSize, cp.Size, cp.Hash)
+	fmt.Fprintf(w, "\nUnsigned checkpoint:\n%s\n", cp.Marshal())
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sort.Strings(d.tiles)
+	fmt.Fprintf(w, "Resources which would be written (%d):\n", len(d.tiles)+2)
+	for _, t := range d.tiles {
+		fmt.Fprintln(w, t)
+	}
+	fmt.Fprintln(w, path.Join(layout.CheckpointArchivePath("", cp.Size)))
+	fmt.Fprintln(w, layout.CheckpointPath)
+}
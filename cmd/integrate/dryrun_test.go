@@ -0,0 +1,116 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"github.com/transparency-dev/serverless-log/testonly"
+)
+
+// sequence adds n new leaves to st, which holds size leaves.
+func sequence(t *testing.T, st *testonly.MemStorage, size uint64, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		l := []byte(fmt.Sprintf("leaf %d", size+uint64(i)))
+		if _, err := st.Sequence(context.Background(), rfc6962.DefaultHasher.HashLeaf(l), l); err != nil {
+			t.Fatalf("Sequence: %v", err)
+		}
+	}
+}
+
+func TestDryRunWritesNothing(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	st := testonly.NewMemStorage()
+
+	sequence(t, st, 0, 3)
+	cp, err := log.Integrate(ctx, 0, st, h)
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	cpRaw := cp.Marshal()
+	if err := st.WriteCheckpoint(ctx, cpRaw); err != nil {
+		t.Fatalf("WriteCheckpoint: %v", err)
+	}
+	if err := st.DeleteJournal(ctx); err != nil {
+		t.Fatalf("DeleteJournal: %v", err)
+	}
+	sequence(t, st, cp.Size, 300)
+
+	ds := &dryRunStorage{st: st}
+	newCp, err := log.Integrate(ctx, cp.Size, ds, h)
+	if err != nil {
+		t.Fatalf("dry run Integrate: %v", err)
+	}
+	if got, want := newCp.Size, uint64(303); got != want {
+		t.Errorf("dry run size = %d, want %d", got, want)
+	}
+
+	f := st.Fetcher()
+	if got, err := f(ctx, layout.CheckpointPath); err != nil || !bytes.Equal(got, cpRaw) {
+		t.Errorf("checkpoint after dry run = %q, %v, want %q", got, err, cpRaw)
+	}
+	if _, err := st.ReadJournal(ctx); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadJournal after dry run = %v, want %v", err, os.ErrNotExist)
+	}
+	for _, tile := range []struct{ level, index uint64 }{{0, 0}, {0, 1}, {1, 0}} {
+		if _, err := st.GetTile(ctx, tile.level, tile.index, newCp.Size); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("GetTile(%d, %d) after dry run = %v, want %v", tile.level, tile.index, err, os.ErrNotExist)
+		}
+	}
+
+	var out bytes.Buffer
+	printDryRun(&out, cp.Size, newCp, ds)
+	for _, want := range []string{
+		"log would grow from size 3 to 303",
+		"Resources which would be written (5):",
+		path.Join(layout.TilePath("", 0, 0, 0)) + "\n",
+		path.Join(layout.TilePath("", 0, 1, 47)) + "\n",
+		path.Join(layout.TilePath("", 1, 0, 1)) + "\n",
+		path.Join(layout.CheckpointArchivePath("", 303)) + "\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("printDryRun output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	// A real integration from the untouched storage arrives at the same tree.
+	realCp, err := log.Integrate(ctx, cp.Size, st, h)
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	if !bytes.Equal(realCp.Hash, newCp.Hash) {
+		t.Errorf("dry run root hash %x, want %x", newCp.Hash, realCp.Hash)
+	}
+}
+
+func TestDryRunNothingToIntegrate(t *testing.T) {
+	var out bytes.Buffer
+	printDryRun(&out, 3, nil, &dryRunStorage{})
+	if got, want := out.String(), "Dry run: nothing to integrate, log size is 3\n"; got != want {
+		t.Errorf("printDryRun = %q, want %q", got, want)
+	}
+}
@@ -18,25 +18,77 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
 
-	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/client/witness"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/encrypt"
+	"github.com/transparency-dev/serverless-log/internal/integrator"
+	"github.com/transparency-dev/serverless-log/internal/signer/pkcs11"
 	"github.com/transparency-dev/serverless-log/internal/storage/fs"
 	"github.com/transparency-dev/serverless-log/pkg/log"
-	"golang.org/x/mod/sumdb/note"
 	"k8s.io/klog/v2"
 
 	fmtlog "github.com/transparency-dev/formats/log"
 )
 
+// aString is a flag Value which holds multiple strings, allowing the flag to
+// be specified multiple times on the command line.
+type aString []string
+
+func (a *aString) String() string {
+	return fmt.Sprintf("%v", *a)
+}
+
+func (a *aString) Set(v string) error {
+	*a = append(*a, v)
+	return nil
+}
+
+func flagStringList(name, usage string) *aString {
+	r := make(aString, 0)
+	flag.Var(&r, name, usage)
+	return &r
+}
+
 var (
-	storageDir  = flag.String("storage_dir", "", "Root directory to store log data.")
-	initialise  = flag.Bool("initialise", false, "Set when creating a new log to initialise the structure.")
-	pubKeyFile  = flag.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
-	privKeyFile = flag.String("private_key", "", "Location of private key file. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
-	origin      = flag.String("origin", "", "Log origin string to use in produced checkpoint.")
+	storageDir      = flag.String("storage_dir", "", "Root directory to store log data.")
+	initialise      = flag.Bool("initialise", false, "Set when creating a new log to initialise the structure.")
+	bundleSize      = flag.Uint64("bundle_size", 1, "Number of leaves stored in each leaf bundle of a log created with --initialise. The bundle size is recorded in the log, so it needn't be given again.")
+	pubKeyFile      = flag.String("public_key", "", "Location of public key file, which may hold several keys, see client.ParseLogVerifiers. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	privKeyFile     = flag.String("private_key", "", "Location of private key file, which may hold several keys, one per line, which will all sign the checkpoint. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+	origin          = flag.String("origin", "", "Log origin string to use in produced checkpoint.")
+	hashFunc        = flag.String("hash", client.HashSHA256, "Hash function to use for the log's Merkle tree, one of sha256 or sha512_256.")
+	compression     = flag.String("compression", "none", "Compression used for stored leaf data and tiles, one of none, gzip, or zstd. This must match the setting used by the sequence tool.")
+	encryptionKey   = flag.String("encryption_key", "", "Key encryption key used to encrypt the log's leaf data at rest: either the path of a file holding local keys, see the generate_keys tool, or gcpkms:// followed by the name of a Cloud KMS key. This must match the setting used by the sequence tool. If unset, leaf data is not encrypted.")
+	concurrency     = flag.Int("concurrency", runtime.GOMAXPROCS(0), "Number of workers used to hash new entries, and to write updated tiles, in parallel.")
+	gcPending       = flag.Bool("gc_pending", false, "Set to remove stale files from the pending leaves directory after integrating, see --pending_ttl.")
+	pendingTTL      = flag.Duration("pending_ttl", 24*time.Hour, "Pending leaf files older than this are removed by --gc_pending, even if their leaf was never sequenced. Set to 0 to only remove files for leaves which have been sequenced.")
+	gcpKMSKey       = flag.String("gcp_kms_key", "", "If set, checkpoints are also signed with this Cloud KMS key version, e.g. projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1, and --private_key is optional. The key must be an Ed25519 or ECDSA P-256 signing key.")
+	p11Module       = flag.String("pkcs11_module", "", "If set, checkpoints are also signed with a key held in a PKCS#11 token, e.g. an HSM, accessed through the PKCS#11 module at this path, and --private_key is optional. The token's user PIN is read from the "+pkcs11.PINEnv+" environment variable.")
+	p11Slot         = flag.Uint("pkcs11_slot", 0, "ID of the slot holding the token used with --pkcs11_module.")
+	p11KeyLabel     = flag.String("pkcs11_key_label", "", "Label of the key pair used with --pkcs11_module. The key must be an Ed25519 or ECDSA P-256 key.")
+	witnessCfg      = flag.String("witness_config", "", "If set, the location of a YAML file listing witnesses to which each new checkpoint is submitted, see witness.ParseFeedConfig. The checkpoint is only published once it has been cosigned by the configured quorum of witnesses, and is published with their cosignatures.")
+	distributorURLs = flagStringList("distributor_url", "URL identifying the root of a distributor to which each new checkpoint is published (can specify this flag repeatedly).")
+	logID           = flag.String("log_id", "", "LogID used by distributors. Will be derived from --origin if unset.")
+	dryRun          = flag.Bool("dry_run", false, "Set to integrate new entries without writing anything to the log, and print the new checkpoint, along with the resources which would have been written. Checkpoints are not signed, so no private key is needed.")
+	signerName      = flag.String("signer_name", "", "Note key name of the signer used with --gcp_kms_key or --pkcs11_module. Defaults to --origin.")
+	maxLeaves       = flag.Uint64("max_leaves_per_run", 0, "If set, at most this many entries are integrated by each run, and any others are left for the next. Zero means all sequenced entries are integrated.")
+	flushSize       = flag.Uint64("max_leaves_per_flush", 0, "If set, entries are integrated in batches of at most this many, whose tiles are written before the next batch is read, bounding the memory used to integrate a large backlog. A single checkpoint is still written at the end of the run. Zero means all entries are integrated in one batch.")
+	interval        = flag.Duration("interval", 0, "If set, the tool runs until interrupted, integrating new entries this often, rather than integrating once and exiting.")
+	listen          = flag.String("listen", "", "If set, the address on which /healthz and /metrics are served while the tool runs, see --max_pending_age.")
+	maxPendingAge   = flag.Duration("max_pending_age", 0, "If set, /healthz reports the tool as unhealthy when entries are waiting to be integrated and there has been no successful integration for this long. It's always unhealthy if the last integration failed.")
 )
 
 func main() {
@@ -47,11 +99,37 @@ func main() {
 	if len(*origin) == 0 {
 		klog.Exitf("Please set --origin flag to log identifier.")
 	}
+	if *dryRun && *initialise {
+		klog.Exit("--dry_run cannot be used with --initialise")
+	}
+	if *interval > 0 && (*dryRun || *initialise || *gcPending) {
+		klog.Exit("--interval cannot be used with --dry_run, --initialise, or --gc_pending")
+	}
 
-	h := rfc6962.DefaultHasher
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		klog.Exitf("Invalid --hash: %v", err)
+	}
+	comp, err := compress.Parse(*compression)
+	if err != nil {
+		klog.Exitf("Invalid --compression: %v", err)
+	}
+	opts := []fs.Option{fs.WithCompression(comp)}
+	if *initialise {
+		if *bundleSize == 0 {
+			klog.Exit("--bundle_size must be > 0")
+		}
+		opts = append(opts, fs.WithBundleSize(*bundleSize))
+	}
+	if len(*encryptionKey) > 0 {
+		w, err := encrypt.NewKeyWrapper(ctx, *encryptionKey)
+		if err != nil {
+			klog.Exitf("Invalid --encryption_key: %q", err)
+		}
+		opts = append(opts, fs.WithEncryption(encrypt.New(w)))
+	}
 	// Read log public key from file or environment variable
 	var pubKey string
-	var err error
 	if len(*pubKeyFile) > 0 {
 		pubKey, err = getKeyFile(*pubKeyFile)
 		if err != nil {
@@ -72,64 +150,188 @@ func main() {
 		}
 	} else {
 		privKey = os.Getenv("SERVERLESS_LOG_PRIVATE_KEY")
-		if len(privKey) == 0 {
+		if len(privKey) == 0 && len(*gcpKMSKey) == 0 && len(*p11Module) == 0 && !*dryRun {
 			klog.Exit("Supply private key file path using --private_key or set SERVERLESS_LOG_PUBLIC_KEY environment variable")
 		}
 	}
 
-	var cpNote note.Note
-	s, err := note.NewSigner(privKey)
+	name := *signerName
+	if name == "" {
+		name = *origin
+	}
+	so := integrator.SignerOpts{PrivateKeys: privKey, GCPKMSKey: *gcpKMSKey, Name: name}
+	if len(*p11Module) > 0 {
+		so.PKCS11 = &pkcs11.Config{
+			Module:   *p11Module,
+			Slot:     *p11Slot,
+			PIN:      os.Getenv(pkcs11.PINEnv),
+			KeyLabel: *p11KeyLabel,
+		}
+	}
+	s, err := integrator.NewSigners(ctx, so)
 	if err != nil {
-		klog.Exitf("Failed to instantiate signer: %q", err)
+		klog.Exitf("Failed to instantiate signers: %q", err)
 	}
 
-	if *initialise {
-		st, err := fs.Create(*storageDir)
+	var feed *witness.FeedConfig
+	if len(*witnessCfg) > 0 {
+		c, err := os.ReadFile(*witnessCfg)
 		if err != nil {
-			klog.Exitf("Failed to create log: %q", err)
+			klog.Exitf("Failed to read witness config: %q", err)
 		}
-		cp := fmtlog.Checkpoint{
-			Hash: h.EmptyRoot(),
+		if feed, err = witness.ParseFeedConfig(c); err != nil {
+			klog.Exitf("Invalid witness config: %q", err)
 		}
-		if err := signAndWrite(ctx, &cp, cpNote, s, st); err != nil {
-			klog.Exitf("Failed to sign: %q", err)
+	}
+
+	var pub *client.Publisher
+	if len(*distributorURLs) > 0 {
+		ds := make([]*url.URL, 0, len(*distributorURLs))
+		for _, d := range *distributorURLs {
+			u, err := url.Parse(d)
+			if err != nil {
+				klog.Exitf("Invalid distributor URL %q: %v", d, err)
+			}
+			ds = append(ds, u)
+		}
+		pub = client.NewPublisher(ds, client.WithPublishMetrics(integrator.PublishLogger{}))
+	}
+
+	// Check signatures
+	lv, err := client.ParseLogVerifiers([]byte(pubKey))
+	if err != nil {
+		klog.Exitf("Failed to instantiate Verifiers: %q", err)
+	}
+	open := func(cpRaw []byte) (*fmtlog.Checkpoint, error) {
+		cp, _, _, err := lv.ParseCheckpoint(cpRaw, *origin)
+		return cp, err
+	}
+	integ := integrator.New(*storageDir, open, h, integrator.Opts{
+		Origin:      *origin,
+		Signers:     s,
+		Witnesses:   feed,
+		Publisher:   pub,
+		LogID:       *logID,
+		Compression: comp,
+		Concurrency: *concurrency,
+		MaxLeaves:   *maxLeaves,
+		FlushSize:   *flushSize,
+	}, opts...)
+
+	if *initialise {
+		if err := integ.Initialise(ctx); err != nil {
+			klog.Exitf("Failed to initialise log: %q", err)
 		}
 		os.Exit(0)
 	}
 
-	// init storage
-	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if *dryRun {
+		dryRunIntegrate(ctx, open, h, opts)
+		return
+	}
+
+	if len(*listen) > 0 {
+		srv := &http.Server{
+			Addr:              *listen,
+			Handler:           integ.Handler(*maxPendingAge),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			klog.Infof("Serving /healthz and /metrics on %s", *listen)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				klog.Exitf("Status server failed: %v", err)
+			}
+		}()
+	}
+
+	if *interval > 0 {
+		ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+		integrator.NewLoop(integ, *interval, 0).Run(ctx)
+		return
+	}
+
+	// Integrate new entries
+	newCp, _, err := integ.Integrate(ctx)
 	if err != nil {
-		klog.Exitf("Failed to read log checkpoint: %q", err)
+		klog.Exitf("Failed to integrate: %q", err)
 	}
 
-	// Check signatures
-	v, err := note.NewVerifier(pubKey)
+	if *gcPending {
+		st, err := fs.Load(*storageDir, 0, opts...)
+		if err != nil {
+			klog.Exitf("Failed to load storage: %q", err)
+		}
+		if err := gc(ctx, st, h); err != nil {
+			klog.Exitf("Failed to remove stale pending leaves: %q", err)
+		}
+	}
+	if newCp == nil {
+		klog.Exit("Nothing to integrate")
+	}
+}
+
+// dryRunIntegrate integrates new entries without writing anything to the log,
+// and prints the new checkpoint, along with the resources which would have
+// been written.
+func dryRunIntegrate(ctx context.Context, open func([]byte) (*fmtlog.Checkpoint, error), h merkle.LogHasher, opts []fs.Option) {
+	// Hold the lock so that the log isn't changed by an integration while
+	// it's read.
+	unlock, err := fs.AcquireLock(*storageDir, fs.IntegrateLock)
 	if err != nil {
-		klog.Exitf("Failed to instantiate Verifier: %q", err)
+		klog.Exitf("Failed to lock log: %q", err)
 	}
-	cp, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	defer func() {
+		if err := unlock(); err != nil {
+			klog.Errorf("Failed to unlock log: %q", err)
+		}
+	}()
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		klog.Exitf("Failed to read log checkpoint: %q", err)
+	}
+	cp, err := open(cpRaw)
 	if err != nil {
 		klog.Exitf("Failed to open Checkpoint: %q", err)
 	}
-	st, err := fs.Load(*storageDir, cp.Size)
+	st, err := fs.Load(*storageDir, cp.Size, opts...)
 	if err != nil {
 		klog.Exitf("Failed to load storage: %q", err)
 	}
-
-	// Integrate new entries
-	newCp, err := log.Integrate(ctx, cp.Size, st, h)
+	ds := &dryRunStorage{st: st}
+	newCp, err := log.Integrate(ctx, cp.Size, ds, h,
+		log.WithConcurrency(*concurrency),
+		log.WithMaxLeaves(*maxLeaves),
+		log.WithFlushSize(*flushSize))
 	if err != nil {
 		klog.Exitf("Failed to integrate: %q", err)
 	}
-	if newCp == nil {
-		klog.Exit("Nothing to integrate")
-	}
+	printDryRun(os.Stdout, cp.Size, newCp, ds)
+}
 
-	err = signAndWrite(ctx, newCp, cpNote, s, st)
+// gc removes stale pending leaf files, holding the sequence lock so that
+// leaves which are being sequenced are left alone. It's skipped if the lock is
+// already held, e.g. by a running server, rather than waiting for it.
+func gc(ctx context.Context, st *fs.Storage, h merkle.LogHasher) error {
+	unlock, err := fs.TryLock(*storageDir, fs.SequenceLock)
+	if errors.Is(err, fs.ErrLocked) {
+		klog.Infof("Not removing stale pending leaves: %v", err)
+		return nil
+	}
 	if err != nil {
-		klog.Exitf("Failed to sign: %q", err)
+		return err
 	}
+	defer func() {
+		if err := unlock(); err != nil {
+			klog.Errorf("Failed to unlock log: %q", err)
+		}
+	}()
+	n, err := st.GCPending(ctx, h, *pendingTTL)
+	if err != nil {
+		return err
+	}
+	klog.Infof("Removed %d stale pending leaves", n)
+	return nil
 }
 
 func getKeyFile(path string) (string, error) {
@@ -139,16 +341,3 @@ func getKeyFile(path string) (string, error) {
 	}
 	return string(k), nil
 }
-
-func signAndWrite(ctx context.Context, cp *fmtlog.Checkpoint, cpNote note.Note, s note.Signer, st *fs.Storage) error {
-	cp.Origin = *origin
-	cpNote.Text = string(cp.Marshal())
-	cpNoteSigned, err := note.Sign(&cpNote, s)
-	if err != nil {
-		return fmt.Errorf("failed to sign Checkpoint: %w", err)
-	}
-	if err := st.WriteCheckpoint(ctx, cpNoteSigned); err != nil {
-		return fmt.Errorf("failed to store new log checkpoint: %w", err)
-	}
-	return nil
-}
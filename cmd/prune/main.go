@@ -0,0 +1,117 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for removing the data of old
+// leaves from a serverless log, while keeping their hashes, so that the log's
+// checkpoints and proofs can still be served.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/encrypt"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+	"k8s.io/klog/v2"
+)
+
+var (
+	storageDir    = flag.String("storage_dir", "", "Root directory of the log to prune.")
+	pubKeyFile    = flag.String("public_key", "", "Location of public key file, which may hold several keys, see client.ParseLogVerifiers. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin        = flag.String("origin", "", "Log origin string to check for in checkpoint.")
+	compression   = flag.String("compression", "none", "Compression used for the log's leaf data, one of none, gzip, or zstd.")
+	encryptionKey = flag.String("encryption_key", "", "Key encryption key used to decrypt the log's leaf data at rest: either the path of a file holding local keys, see the generate_keys tool, or gcpkms:// followed by the name of a Cloud KMS key. Required if the log's leaf data is encrypted.")
+	retention     = flag.Duration("retention", 0, "If set, the data of leaves which were integrated into a checkpoint published longer ago than this is removed.")
+	size          = flag.Uint64("size", 0, "If set, the data of the leaves below this index is removed. Exactly one of --retention and --size must be set.")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+	ctx := context.Background()
+
+	if len(*storageDir) == 0 {
+		klog.Exit("Please set --storage_dir flag.")
+	}
+	if (*retention > 0) == (*size > 0) {
+		klog.Exit("Exactly one of --retention and --size must be set.")
+	}
+	comp, err := compress.Parse(*compression)
+	if err != nil {
+		klog.Exitf("Invalid --compression: %v", err)
+	}
+	opts := []fs.Option{fs.WithCompression(comp)}
+	if len(*encryptionKey) > 0 {
+		w, err := encrypt.NewKeyWrapper(ctx, *encryptionKey)
+		if err != nil {
+			klog.Exitf("Invalid --encryption_key: %q", err)
+		}
+		opts = append(opts, fs.WithEncryption(encrypt.New(w)))
+	}
+
+	// Read log public key from file or environment variable
+	var pubKey string
+	if len(*pubKeyFile) > 0 {
+		k, err := os.ReadFile(*pubKeyFile)
+		if err != nil {
+			klog.Exitf("failed to read public_key file: %q", err)
+		}
+		pubKey = string(k)
+	} else {
+		pubKey = os.Getenv("SERVERLESS_LOG_PUBLIC_KEY")
+		if len(pubKey) == 0 {
+			klog.Exit("supply public key file path using --public_key or set SERVERLESS_LOG_PUBLIC_KEY environment variable")
+		}
+	}
+	lv, err := client.ParseLogVerifiers([]byte(pubKey))
+	if err != nil {
+		klog.Exitf("Failed to instantiate Verifiers: %q", err)
+	}
+
+	// Prevent the log from being integrated while it's pruned.
+	unlock, err := fs.AcquireLock(*storageDir, fs.IntegrateLock)
+	if err != nil {
+		klog.Exitf("Failed to lock log: %q", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			klog.Errorf("Failed to unlock log: %q", err)
+		}
+	}()
+
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		klog.Exitf("Failed to read log checkpoint: %q", err)
+	}
+	cp, _, _, err := lv.ParseCheckpoint(cpRaw, *origin)
+	if err != nil {
+		klog.Exitf("Failed to parse Checkpoint: %q", err)
+	}
+	to := *size
+	if *retention > 0 {
+		if to, err = fs.RetentionSize(*storageDir, time.Now().Add(-*retention)); err != nil {
+			klog.Exitf("Failed to find leaves older than --retention: %q", err)
+		}
+	}
+	to = min(to, cp.Size)
+	pruned, err := fs.Prune(ctx, *storageDir, to, cp.Size, opts...)
+	if err != nil {
+		klog.Exitf("Failed to prune log: %q", err)
+	}
+	klog.Infof("Leaf data below index %d has been pruned from log of size %d", pruned, cp.Size)
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for rewriting a serverless log
+// with a different leaf bundle size.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/encrypt"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+	"k8s.io/klog/v2"
+)
+
+var (
+	storageDir    = flag.String("storage_dir", "", "Root directory of the log to rewrite.")
+	outputDir     = flag.String("output_dir", "", "Directory to write the rewritten log to, which must not already exist.")
+	bundleSize    = flag.Uint64("bundle_size", 1, "Number of leaves to store in each leaf bundle of the rewritten log.")
+	pubKeyFile    = flag.String("public_key", "", "Location of public key file, which may hold several keys, see client.ParseLogVerifiers. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin        = flag.String("origin", "", "Log origin string to check for in checkpoint.")
+	hashFunc      = flag.String("hash", client.HashSHA256, "Hash function used for the log's Merkle tree, one of sha256 or sha512_256.")
+	compression   = flag.String("compression", "none", "Compression used for the log's leaf data, one of none, gzip, or zstd.")
+	encryptionKey = flag.String("encryption_key", "", "Key encryption key used to encrypt the log's leaf data at rest: either the path of a file holding local keys, see the generate_keys tool, or gcpkms:// followed by the name of a Cloud KMS key. Required if the log's leaf data is encrypted, in which case the rebundled leaf data is encrypted with it too.")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+	ctx := context.Background()
+
+	if len(*storageDir) == 0 || len(*outputDir) == 0 {
+		klog.Exit("Please set --storage_dir and --output_dir flags.")
+	}
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		klog.Exitf("Invalid --hash: %v", err)
+	}
+	comp, err := compress.Parse(*compression)
+	if err != nil {
+		klog.Exitf("Invalid --compression: %v", err)
+	}
+	opts := []fs.Option{fs.WithCompression(comp)}
+	if len(*encryptionKey) > 0 {
+		w, err := encrypt.NewKeyWrapper(ctx, *encryptionKey)
+		if err != nil {
+			klog.Exitf("Invalid --encryption_key: %q", err)
+		}
+		opts = append(opts, fs.WithEncryption(encrypt.New(w)))
+	}
+
+	// Read log public key from file or environment variable
+	var pubKey string
+	if len(*pubKeyFile) > 0 {
+		k, err := os.ReadFile(*pubKeyFile)
+		if err != nil {
+			klog.Exitf("failed to read public_key file: %q", err)
+		}
+		pubKey = string(k)
+	} else {
+		pubKey = os.Getenv("SERVERLESS_LOG_PUBLIC_KEY")
+		if len(pubKey) == 0 {
+			klog.Exit("supply public key file path using --public_key or set SERVERLESS_LOG_PUBLIC_KEY environment variable")
+		}
+	}
+	lv, err := client.ParseLogVerifiers([]byte(pubKey))
+	if err != nil {
+		klog.Exitf("Failed to instantiate Verifiers: %q", err)
+	}
+
+	// Prevent the log from being modified while it's rewritten.
+	for _, l := range []fs.Lock{fs.SequenceLock, fs.IntegrateLock} {
+		unlock, err := fs.AcquireLock(*storageDir, l)
+		if err != nil {
+			klog.Exitf("Failed to lock log: %q", err)
+		}
+		defer func() {
+			if err := unlock(); err != nil {
+				klog.Errorf("Failed to unlock log: %q", err)
+			}
+		}()
+	}
+
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		klog.Exitf("Failed to read log checkpoint: %q", err)
+	}
+	cp, _, _, err := lv.ParseCheckpoint(cpRaw, *origin)
+	if err != nil {
+		klog.Exitf("Failed to parse Checkpoint: %q", err)
+	}
+
+	if err := fs.Rebundle(ctx, *storageDir, *outputDir, cp.Size, cp.Hash, *bundleSize, h, opts...); err != nil {
+		klog.Exitf("Failed to rewrite log: %q", err)
+	}
+	klog.Infof("Wrote log of size %d with bundle size %d to %q", cp.Size, *bundleSize, *outputDir)
+}
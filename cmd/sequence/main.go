@@ -21,28 +21,46 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"mime"
 	"os"
 	"path/filepath"
 
+	"github.com/transparency-dev/serverless-log/internal/admission"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/encrypt"
+	"github.com/transparency-dev/serverless-log/internal/ingest"
+	"github.com/transparency-dev/serverless-log/internal/ingest/files"
+	"github.com/transparency-dev/serverless-log/internal/ingest/kafka"
+	"github.com/transparency-dev/serverless-log/internal/ingest/pubsub"
 	"github.com/transparency-dev/serverless-log/internal/storage/fs"
-	"golang.org/x/mod/sumdb/note"
 
-	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/client"
 	"github.com/transparency-dev/serverless-log/pkg/log"
 	"k8s.io/klog/v2"
-
-	fmtlog "github.com/transparency-dev/formats/log"
 )
 
 var (
-	storageDir = flag.String("storage_dir", "", "Root directory to store log data.")
-	entries    = flag.String("entries", "", "File path glob of entries to add to the log.")
-	pubKeyFile = flag.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
-	origin     = flag.String("origin", "", "Log origin string to check for in checkpoint.")
+	storageDir    = flag.String("storage_dir", "", "Root directory to store log data.")
+	entries       = flag.String("entries", "", "File path glob of entries to add to the log.")
+	pubKeyFile    = flag.String("public_key", "", "Location of public key file, which may hold several keys, see client.ParseLogVerifiers. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin        = flag.String("origin", "", "Log origin string to check for in checkpoint.")
+	hashFunc      = flag.String("hash", client.HashSHA256, "Hash function used for the log's Merkle tree, one of sha256 or sha512_256.")
+	compression   = flag.String("compression", "none", "Compression to use for stored leaf data, one of none, gzip, or zstd. This must match the setting used by the integrate tool.")
+	encryptionKey = flag.String("encryption_key", "", "Key encryption key used to encrypt the log's leaf data at rest: either the path of a file holding local keys, see the generate_keys tool, or gcpkms:// followed by the name of a Cloud KMS key. This must match the setting used by the integrate tool. If unset, leaf data is not encrypted.")
+	blobSize      = flag.Int("blob_threshold", 0, "Entries larger than this many bytes are stored in the log's blobs/ area, and a reference to them is sequenced in their place, see api.BlobRef. Zero disables blob storage.")
+	pubsubSub     = flag.String("pubsub_subscription", "", "Name of a Pub/Sub subscription, e.g. projects/p/subscriptions/s, from which to sequence entries published as messages, instead of from --entries. The tool exits once the subscription has been drained.")
+	kafkaProxy    = flag.String("kafka_proxy", "", "URL of a Kafka REST Proxy, e.g. http://localhost:8082, via which to sequence entries from the values of records on --kafka_topic, instead of from --entries. The tool exits once it has caught up with the topic.")
+	kafkaTopic    = flag.String("kafka_topic", "", "Kafka topic from which to sequence entries, see --kafka_proxy.")
+	kafkaGroup    = flag.String("kafka_group", "serverless-log", "Kafka consumer group used to consume --kafka_topic, whose committed offsets record which entries have been sequenced.")
+	fromDir       = flag.String("from_dir", "", "Directory from which to sequence every file, recursively and in lexical order of their paths, instead of from --entries. Files whose names start with a dot are skipped.")
+	fromTar       = flag.String("from_tar", "", "Tar archive from which to sequence every file, in the order in which they appear, instead of from --entries. The archive is gzip decompressed if the path ends in .gz or .tgz.")
+	progressFile  = flag.String("progress_file", "", "File in which to record how many of the entries from --from_dir or --from_tar have been sequenced, so that an interrupted run can be resumed by running the tool again with the same flags.")
+	maxMessages   = flag.Int("max_messages", 0, "Maximum number of entries to sequence from --pubsub_subscription, --kafka_topic, --from_dir, or --from_tar in one run, so that a busy source doesn't hold up integration. Zero means no limit.")
 )
 
 func main() {
 	klog.InitFlags(nil)
+	admission.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
 	// Read log public key from file or environment variable
@@ -60,38 +78,129 @@ func main() {
 		}
 	}
 
-	toAdd, err := filepath.Glob(*entries)
+	var toAdd []string
+	if len(*pubsubSub) > 0 || len(*kafkaProxy) > 0 || len(*fromDir) > 0 || len(*fromTar) > 0 {
+		if len(*entries) > 0 {
+			klog.Exit("--entries can't be used with --pubsub_subscription, --kafka_proxy, --from_dir, or --from_tar")
+		}
+	} else {
+		var err error
+		toAdd, err = filepath.Glob(*entries)
+		if err != nil {
+			klog.Exitf("Failed to glob entries %q: %q", *entries, err)
+		}
+		if len(toAdd) == 0 {
+			klog.Exit("Sequence must be run with at least one valid entry")
+		}
+	}
+
+	h, err := client.NewHasher(*hashFunc)
 	if err != nil {
-		klog.Exitf("Failed to glob entries %q: %q", *entries, err)
+		klog.Exitf("Invalid --hash: %v", err)
 	}
-	if len(toAdd) == 0 {
-		klog.Exit("Sequence must be run with at least one valid entry")
+	comp, err := compress.Parse(*compression)
+	if err != nil {
+		klog.Exitf("Invalid --compression: %v", err)
+	}
+	opts := []fs.Option{fs.WithCompression(comp)}
+	if len(*encryptionKey) > 0 {
+		w, err := encrypt.NewKeyWrapper(context.Background(), *encryptionKey)
+		if err != nil {
+			klog.Exitf("Invalid --encryption_key: %q", err)
+		}
+		opts = append(opts, fs.WithEncryption(encrypt.New(w)))
 	}
-
-	h := rfc6962.DefaultHasher
 	// init storage
 
+	// Wait for any other sequencers to finish, so that duplicate entries
+	// submitted concurrently are reliably detected.
+	unlock, err := fs.AcquireLock(*storageDir, fs.SequenceLock)
+	if err != nil {
+		klog.Exitf("Failed to lock log: %q", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			klog.Errorf("Failed to unlock log: %q", err)
+		}
+	}()
 	cpRaw, err := fs.ReadCheckpoint(*storageDir)
 	if err != nil {
 		klog.Exitf("Failed to read log checkpoint: %q", err)
 	}
 
 	// Check signatures
-	v, err := note.NewVerifier(pubKey)
+	lv, err := client.ParseLogVerifiers([]byte(pubKey))
 	if err != nil {
-		klog.Exitf("Failed to instantiate Verifier: %q", err)
+		klog.Exitf("Failed to instantiate Verifiers: %q", err)
 	}
-	cp, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	cp, _, _, err := lv.ParseCheckpoint(cpRaw, *origin)
 	if err != nil {
 		klog.Exitf("Failed to parse Checkpoint: %q", err)
 	}
 
-	st, err := fs.Load(*storageDir, cp.Size)
+	st, err := fs.Load(*storageDir, cp.Size, opts...)
 	if err != nil {
 		klog.Exitf("Failed to load storage: %q", err)
 	}
 
+	policy, err := admission.PolicyFromFlags(flag.CommandLine)
+	if err != nil {
+		klog.Exitf("Failed to configure admission policy: %v", err)
+	}
+
 	// sequence entries
+	add := func(ctx context.Context, name, contentType string, b []byte) error {
+		if policy != nil {
+			err := policy.Admit(ctx, admission.Entry{Data: b, ContentType: contentType})
+			if errors.Is(err, admission.ErrRejected) {
+				klog.Warningf("Skipping %v: %v", name, err)
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("failed to apply admission policy to %q: %v", name, err)
+			}
+		}
+		if *blobSize > 0 && len(b) > *blobSize {
+			ref, err := st.StoreBlob(ctx, b)
+			if err != nil {
+				return fmt.Errorf("failed to store blob for %q: %v", name, err)
+			}
+			if b, err = ref.MarshalText(); err != nil {
+				return fmt.Errorf("failed to marshal blob reference for %q: %v", name, err)
+			}
+			name += fmt.Sprintf(" (blob %x)", ref.Hash)
+		}
+		// ask storage to sequence
+		r, err := log.Add(ctx, st, h, b)
+		if err != nil {
+			return fmt.Errorf("failed to sequence %q: %v", name, err)
+		}
+		l := fmt.Sprintf("%d: %v", r.Index, name)
+		if r.Duplicate {
+			l += " (dupe)"
+		}
+		klog.Info(l)
+		return nil
+	}
+
+	q, closeQueue, err := newQueue(context.Background())
+	if err != nil {
+		klog.Exitf("Failed to open queue: %q", err)
+	}
+	if q != nil {
+		defer closeQueue()
+		r := ingest.NewReceiver(q, ingest.WithMaxMessages(*maxMessages))
+		err := r.Receive(context.Background(), func(ctx context.Context, m ingest.Message) error {
+			if len(*fromDir) > 0 || len(*fromTar) > 0 {
+				// Messages are files, named by their paths.
+				return add(ctx, m.ID, mime.TypeByExtension(filepath.Ext(m.ID)), m.Data)
+			}
+			return add(ctx, "message "+m.ID, "", m.Data)
+		})
+		if err != nil {
+			klog.Exitf("Failed to sequence entries from queue: %q", err)
+		}
+		return
+	}
 
 	// entryInfo binds the actual bytes to be added as a leaf with a
 	// user-recognisable name for the source of those bytes.
@@ -114,21 +223,65 @@ func main() {
 	}()
 
 	for entry := range entries {
-		// ask storage to sequence
-		lh := h.HashLeaf(entry.b)
-		dupe := false
-		seq, err := st.Sequence(context.Background(), lh, entry.b)
+		if err := add(context.Background(), entry.name, mime.TypeByExtension(filepath.Ext(entry.name)), entry.b); err != nil {
+			klog.Exit(err)
+		}
+	}
+}
+
+// newQueue returns the queue configured by the --pubsub_subscription,
+// --kafka, --from_dir, or --from_tar flags, along with a func to release it, or
+// nil if there is none.
+func newQueue(ctx context.Context) (ingest.Queue, func(), error) {
+	n := 0
+	for _, f := range []string{*pubsubSub, *kafkaProxy, *fromDir, *fromTar} {
+		if len(f) > 0 {
+			n++
+		}
+	}
+	switch {
+	case n > 1:
+		return nil, nil, errors.New("only one of --pubsub_subscription, --kafka_proxy, --from_dir, and --from_tar may be set")
+	case len(*progressFile) > 0 && len(*fromDir) == 0 && len(*fromTar) == 0:
+		return nil, nil, errors.New("--progress_file may only be used with --from_dir or --from_tar")
+	case len(*fromDir) > 0 || len(*fromTar) > 0:
+		var opts []files.Option
+		if len(*progressFile) > 0 {
+			opts = append(opts, files.WithProgressFile(*progressFile))
+		}
+		open := files.OpenDir
+		src := *fromDir
+		if len(*fromTar) > 0 {
+			open, src = files.OpenTar, *fromTar
+		}
+		s, err := open(src, opts...)
 		if err != nil {
-			if errors.Is(err, log.ErrDupeLeaf) {
-				dupe = true
-			} else {
-				klog.Exitf("failed to sequence %q: %q", entry.name, err)
+			return nil, nil, err
+		}
+		return s, func() {
+			if err := s.Close(); err != nil {
+				klog.Warningf("Failed to close %q: %q", src, err)
 			}
+		}, nil
+	case len(*pubsubSub) > 0:
+		s, err := pubsub.NewSubscriber(ctx, *pubsubSub)
+		if err != nil {
+			return nil, nil, err
 		}
-		l := fmt.Sprintf("%d: %v", seq, entry.name)
-		if dupe {
-			l += " (dupe)"
+		return s, func() {}, nil
+	case len(*kafkaProxy) > 0:
+		if len(*kafkaTopic) == 0 {
+			return nil, nil, errors.New("--kafka_topic must be set with --kafka_proxy")
 		}
-		klog.Info(l)
+		c, err := kafka.NewConsumer(ctx, *kafkaProxy, *kafkaGroup, *kafkaTopic)
+		if err != nil {
+			return nil, nil, err
+		}
+		return c, func() {
+			if err := c.Close(ctx); err != nil {
+				klog.Warningf("Failed to close Kafka consumer: %q", err)
+			}
+		}, nil
 	}
+	return nil, nil, nil
 }
@@ -0,0 +1,429 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a long-running server for a serverless log, which
+// accepts new entries via its add endpoint and serves the log's files.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/client/witness"
+	"github.com/transparency-dev/serverless-log/internal/admission"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/encrypt"
+	"github.com/transparency-dev/serverless-log/internal/integrator"
+	"github.com/transparency-dev/serverless-log/internal/server"
+	"github.com/transparency-dev/serverless-log/internal/signer/pkcs11"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+	"k8s.io/klog/v2"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// aString is a flag Value which holds multiple strings, allowing the flag to
+// be specified multiple times on the command line.
+type aString []string
+
+func (a *aString) String() string {
+	return fmt.Sprintf("%v", *a)
+}
+
+func (a *aString) Set(v string) error {
+	*a = append(*a, v)
+	return nil
+}
+
+func flagStringList(name, usage string) *aString {
+	r := make(aString, 0)
+	flag.Var(&r, name, usage)
+	return &r
+}
+
+var (
+	listen             = flag.String("listen", ":8080", "Address on which to listen for HTTP requests.")
+	storageDir         = flag.String("storage_dir", "", "Root directory of the log.")
+	pubKeyFile         = flag.String("public_key", "", "Location of public key file, which may hold several keys, see client.ParseLogVerifiers. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin             = flag.String("origin", "", "Log origin string to check for in checkpoint.")
+	hashFunc           = flag.String("hash", client.HashSHA256, "Hash function used for the log's Merkle tree, one of sha256 or sha512_256.")
+	compression        = flag.String("compression", "none", "Compression to use for stored leaf data, one of none, gzip, or zstd. This must match the setting used by the integrate tool.")
+	encryptionKey      = flag.String("encryption_key", "", "Key encryption key used to encrypt the log's leaf data at rest: either the path of a file holding local keys, see the generate_keys tool, or gcpkms:// followed by the name of a Cloud KMS key. This must match the setting used by the integrate tool. If unset, leaf data is not encrypted.")
+	blobSize           = flag.Int("blob_threshold", 0, "Entries larger than this many bytes are stored in the log's blobs/ area, and a reference to them is sequenced in their place, see api.BlobRef. Zero disables blob storage.")
+	serveFiles         = flag.Bool("serve_files", true, "Set to serve the log's files, e.g. its checkpoint and tiles, alongside the add endpoint. Unset this if the files are served by e.g. a CDN instead.")
+	apiKeysFile        = flag.String("api_keys", "", "Location of a file of API keys which submitters may authenticate with, with one \"<identity> <key>\" pair per line.")
+	oidcIssuer         = flag.String("oidc_issuer", "", "Issuer URL of an OpenID Connect provider whose ID tokens submitters may authenticate with, e.g. https://accounts.google.com.")
+	oidcAudience       = flag.String("oidc_audience", "", "Audience which OpenID Connect ID tokens must be issued for. Required if --oidc_issuer is set.")
+	oidcSubjects       = flag.String("oidc_subjects", "", "Comma separated list of the subjects of OpenID Connect ID tokens which are accepted. If unset, tokens for any subject are accepted.")
+	rateLimit          = flag.Float64("rate_limit", 0, "Sustained number of entries per second which each identity may submit. Zero disables the limit.")
+	rateBurst          = flag.Int("rate_burst", 10, "Number of entries which each identity may submit at once, when --rate_limit is set.")
+	quota              = flag.Uint64("quota", 0, "Number of entries which each identity may submit in each --quota_period. Zero disables the quota.")
+	globalRate         = flag.Float64("global_rate_limit", 0, "Sustained number of entries per second which may be submitted by all identities together. Zero disables the limit.")
+	globalBurst        = flag.Int("global_rate_burst", 100, "Number of entries which may be submitted at once by all identities together, when --global_rate_limit is set.")
+	globalQuota        = flag.Uint64("global_quota", 0, "Number of entries which may be submitted by all identities together in each --quota_period. Zero disables the quota.")
+	quotaPeriod        = flag.Duration("quota_period", 24*time.Hour, "Period over which --quota and --global_quota apply.")
+	integrateInterval  = flag.Duration("integrate_interval", 0, "If set, the server integrates new entries itself, this often, rather than leaving them to the integrate tool. See also --integrate_batch_size.")
+	integrateBatchSize = flag.Uint64("integrate_batch_size", 0, "If set, the server integrates new entries itself as soon as this many are waiting, as well as every --integrate_interval.")
+	privKeyFile        = flag.String("private_key", "", "Location of private key file, which may hold several keys, one per line, which will all sign the checkpoint. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable. Only used if the server integrates new entries.")
+	gcpKMSKey          = flag.String("gcp_kms_key", "", "If set, checkpoints are also signed with this Cloud KMS key version, and --private_key is optional, as for the integrate tool.")
+	p11Module          = flag.String("pkcs11_module", "", "If set, checkpoints are also signed with a key held in a PKCS#11 token, and --private_key is optional, as for the integrate tool. The token's user PIN is read from the "+pkcs11.PINEnv+" environment variable.")
+	p11Slot            = flag.Uint("pkcs11_slot", 0, "ID of the slot holding the token used with --pkcs11_module.")
+	p11KeyLabel        = flag.String("pkcs11_key_label", "", "Label of the key pair used with --pkcs11_module.")
+	signerName         = flag.String("signer_name", "", "Note key name of the signer used with --gcp_kms_key or --pkcs11_module. Defaults to --origin.")
+	witnessCfg         = flag.String("witness_config", "", "If set, the location of a YAML file listing witnesses which must cosign each new checkpoint, as for the integrate tool.")
+	distributorURLs    = flagStringList("distributor_url", "URL identifying the root of a distributor to which each new checkpoint is published (can specify this flag repeatedly).")
+	logID              = flag.String("log_id", "", "LogID used by distributors. Will be derived from --origin if unset.")
+	concurrency        = flag.Int("concurrency", runtime.GOMAXPROCS(0), "Number of workers used to hash new entries, and to write updated tiles, in parallel, when integrating.")
+	adminListen        = flag.String("admin_listen", "", "Address on which to serve the per-identity counts of added entries at /accounts, and, if the server integrates new entries, /healthz and /metrics as for the integrate tool. This should not be reachable by submitters. If unset, none of these are served.")
+	maxLeavesPerRun    = flag.Uint64("max_leaves_per_run", 0, "If set, each integration integrates at most this many entries, and is followed immediately by another while entries remain, as for the integrate tool.")
+	maxLeavesPerFlush  = flag.Uint64("max_leaves_per_flush", 0, "If set, entries are integrated in batches of at most this many, whose tiles are written before the next batch is read, as for the integrate tool.")
+	maxPending         = flag.Uint64("max_pending", 0, "If set, new entries are refused with 503 Service Unavailable while more than this many entries are waiting to be integrated, so that integration can catch up. Zero disables the limit.")
+	backlogRetryAfter  = flag.Duration("backlog_retry_after", 10*time.Second, "Delay given in the Retry-After header of submissions refused because of --max_pending.")
+	maxPendingAge      = flag.Duration("max_pending_age", 0, "If set, /healthz on --admin_listen reports the server as unhealthy when entries are waiting to be integrated and there has been no successful integration for this long, as for the integrate tool.")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	admission.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if len(*storageDir) == 0 {
+		klog.Exit("Please set --storage_dir flag.")
+	}
+
+	// Read log public key from file or environment variable
+	var pubKey string
+	if len(*pubKeyFile) > 0 {
+		k, err := os.ReadFile(*pubKeyFile)
+		if err != nil {
+			klog.Exitf("failed to read public_key file: %q", err)
+		}
+		pubKey = string(k)
+	} else {
+		pubKey = os.Getenv("SERVERLESS_LOG_PUBLIC_KEY")
+		if len(pubKey) == 0 {
+			klog.Exit("supply public key file path using --public_key or set SERVERLESS_LOG_PUBLIC_KEY environment variable")
+		}
+	}
+
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		klog.Exitf("Invalid --hash: %v", err)
+	}
+	comp, err := compress.Parse(*compression)
+	if err != nil {
+		klog.Exitf("Invalid --compression: %v", err)
+	}
+	opts := []fs.Option{fs.WithCompression(comp)}
+	if len(*encryptionKey) > 0 {
+		w, err := encrypt.NewKeyWrapper(ctx, *encryptionKey)
+		if err != nil {
+			klog.Exitf("Invalid --encryption_key: %q", err)
+		}
+		opts = append(opts, fs.WithEncryption(encrypt.New(w)))
+	}
+
+	// The server is the log's sequencer for as long as it runs, so it holds
+	// the sequence lock throughout, and refuses to start rather than waiting
+	// if another sequencer holds it. Entries are integrated separately, e.g.
+	// by running the integrate tool periodically, unless the server
+	// integrates them itself.
+	unlock, err := fs.TryLock(*storageDir, fs.SequenceLock)
+	if err != nil {
+		klog.Exitf("Failed to lock log: %v", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			klog.Errorf("Failed to unlock log: %q", err)
+		}
+	}()
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		klog.Exitf("Failed to read log checkpoint: %q", err)
+	}
+	lv, err := client.ParseLogVerifiers([]byte(pubKey))
+	if err != nil {
+		klog.Exitf("Failed to instantiate Verifiers: %q", err)
+	}
+	cp, _, _, err := lv.ParseCheckpoint(cpRaw, *origin)
+	if err != nil {
+		klog.Exitf("Failed to parse Checkpoint: %q", err)
+	}
+	st, err := fs.Load(*storageDir, cp.Size, opts...)
+	if err != nil {
+		klog.Exitf("Failed to load storage: %q", err)
+	}
+
+	addOpts := []server.AddOption{server.WithBlobs(st, *blobSize)}
+	auth, err := authenticator(ctx)
+	if err != nil {
+		klog.Exitf("Failed to configure authentication: %v", err)
+	}
+	if auth != nil {
+		addOpts = append(addOpts, server.WithAuthenticator(auth))
+	} else {
+		klog.Warning("Neither --api_keys nor --oidc_issuer is set, so anyone may add entries to the log")
+	}
+	policy, err := admission.PolicyFromFlags(flag.CommandLine)
+	if err != nil {
+		klog.Exitf("Failed to configure admission policy: %v", err)
+	}
+	if policy != nil {
+		addOpts = append(addOpts, server.WithPolicy(policy))
+	}
+	acc := server.NewAccounts()
+	addOpts = append(addOpts, server.WithAccounts(acc))
+	if *rateLimit > 0 || *quota > 0 || *globalRate > 0 || *globalQuota > 0 {
+		l, err := server.NewLimiter(server.LimitOpts{
+			PerIdentity: server.Limit{Rate: *rateLimit, Burst: *rateBurst, Quota: *quota, QuotaPeriod: *quotaPeriod},
+			Global:      server.Limit{Rate: *globalRate, Burst: *globalBurst, Quota: *globalQuota, QuotaPeriod: *quotaPeriod},
+		})
+		if err != nil {
+			klog.Exitf("Invalid limits: %v", err)
+		}
+		addOpts = append(addOpts, server.WithLimiter(l))
+	}
+
+	if *maxPending > 0 {
+		addOpts = append(addOpts, server.WithBackpressure(backlogged(lv), *backlogRetryAfter))
+	}
+
+	var integ *integrator.Integrator
+	var loop *integrator.Loop
+	if *integrateInterval > 0 || *integrateBatchSize > 0 {
+		integ, err = newIntegrator(ctx, lv, h, comp, opts)
+		if err != nil {
+			klog.Exitf("Failed to configure integration: %v", err)
+		}
+		loop = integrator.NewLoop(integ, *integrateInterval, *integrateBatchSize)
+		addOpts = append(addOpts, server.WithAddHook(func(r api.AddResponse) {
+			if !r.Duplicate {
+				loop.Added(1)
+			}
+		}))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/add", server.NewAddHandler(st, h, addOpts...))
+	if *serveFiles {
+		mux.Handle("/", server.FileHandler(*storageDir))
+	}
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	servers := []*http.Server{srv}
+	if *adminListen != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/accounts", acc)
+		if integ != nil {
+			ih := integ.Handler(*maxPendingAge)
+			adminMux.Handle("/healthz", ih)
+			adminMux.Handle("/metrics", ih)
+		}
+		admin := &http.Server{
+			Addr:              *adminListen,
+			Handler:           adminMux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		servers = append(servers, admin)
+		go func() {
+			klog.Infof("Serving admin endpoints on %s", *adminListen)
+			if err := admin.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				klog.Exitf("Admin server failed: %v", err)
+			}
+		}()
+	}
+	// closed is closed once in-flight requests have finished, after shutdown.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		<-ctx.Done()
+		klog.Info("Shutting down")
+		sctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		for _, s := range servers {
+			if err := s.Shutdown(sctx); err != nil {
+				klog.Errorf("Failed to shut down cleanly: %v", err)
+			}
+		}
+	}()
+	// The integration loop is stopped only once the server has shut down.
+	loopCtx, stopLoop := context.WithCancel(context.Background())
+	defer stopLoop()
+	loopDone := make(chan struct{})
+	if loop != nil {
+		go func() {
+			defer close(loopDone)
+			loop.Run(loopCtx)
+		}()
+	}
+	klog.Infof("Serving log of size %d on %s", cp.Size, *listen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		klog.Exitf("Server failed: %v", err)
+	}
+	<-closed
+	if loop != nil {
+		// The add endpoint has stopped, so the final integration includes
+		// every entry accepted.
+		stopLoop()
+		<-loopDone
+	}
+}
+
+// authenticator returns an Authenticator accepting the credentials configured
+// by the flags, or nil if none are configured.
+func authenticator(ctx context.Context) (server.Authenticator, error) {
+	var auths []server.Authenticator
+	if *apiKeysFile != "" {
+		b, err := os.ReadFile(*apiKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read --api_keys file: %v", err)
+		}
+		k, err := server.ParseAPIKeys(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --api_keys file: %v", err)
+		}
+		auths = append(auths, k)
+	}
+	if *oidcIssuer != "" {
+		var subjects []string
+		if *oidcSubjects != "" {
+			subjects = strings.Split(*oidcSubjects, ",")
+		} else {
+			klog.Warningf("--oidc_subjects is not set, so any ID token issued by %s for %q is accepted", *oidcIssuer, *oidcAudience)
+		}
+		o, err := server.NewOIDCAuthenticator(ctx, server.OIDCOpts{
+			Issuer:   *oidcIssuer,
+			Audience: *oidcAudience,
+			Subjects: subjects,
+		})
+		if err != nil {
+			return nil, err
+		}
+		auths = append(auths, o)
+	}
+	switch len(auths) {
+	case 0:
+		return nil, nil
+	case 1:
+		return auths[0], nil
+	}
+	return server.AnyOf(auths...), nil
+}
+
+// backlogged returns a function reporting whether more than --max_pending
+// entries are waiting to be integrated, i.e. whether an entry has been
+// sequenced that many entries beyond the log's checkpoint.
+func backlogged(lv client.LogVerifiers) func(context.Context) (bool, error) {
+	return func(context.Context) (bool, error) {
+		cpRaw, err := fs.ReadCheckpoint(*storageDir)
+		if err != nil {
+			return false, fmt.Errorf("failed to read log checkpoint: %v", err)
+		}
+		cp, _, _, err := lv.ParseCheckpoint(cpRaw, *origin)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse checkpoint: %v", err)
+		}
+		return fs.Sequenced(*storageDir, cp.Size+*maxPending)
+	}
+}
+
+// newIntegrator returns an Integrator configured by the flags, for servers
+// which integrate new entries themselves.
+func newIntegrator(ctx context.Context, lv client.LogVerifiers, h merkle.LogHasher, comp compress.Algorithm, opts []fs.Option) (*integrator.Integrator, error) {
+	var privKey string
+	if len(*privKeyFile) > 0 {
+		k, err := os.ReadFile(*privKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private_key file: %v", err)
+		}
+		privKey = string(k)
+	} else {
+		privKey = os.Getenv("SERVERLESS_LOG_PRIVATE_KEY")
+		if len(privKey) == 0 && len(*gcpKMSKey) == 0 && len(*p11Module) == 0 {
+			return nil, errors.New("supply private key file path using --private_key or set SERVERLESS_LOG_PRIVATE_KEY environment variable")
+		}
+	}
+	name := *signerName
+	if name == "" {
+		name = *origin
+	}
+	so := integrator.SignerOpts{PrivateKeys: privKey, GCPKMSKey: *gcpKMSKey, Name: name}
+	if len(*p11Module) > 0 {
+		so.PKCS11 = &pkcs11.Config{
+			Module:   *p11Module,
+			Slot:     *p11Slot,
+			PIN:      os.Getenv(pkcs11.PINEnv),
+			KeyLabel: *p11KeyLabel,
+		}
+	}
+	s, err := integrator.NewSigners(ctx, so)
+	if err != nil {
+		return nil, err
+	}
+	var feed *witness.FeedConfig
+	if len(*witnessCfg) > 0 {
+		c, err := os.ReadFile(*witnessCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read witness config: %v", err)
+		}
+		if feed, err = witness.ParseFeedConfig(c); err != nil {
+			return nil, fmt.Errorf("invalid witness config: %v", err)
+		}
+	}
+	var pub *client.Publisher
+	if len(*distributorURLs) > 0 {
+		ds := make([]*url.URL, 0, len(*distributorURLs))
+		for _, d := range *distributorURLs {
+			u, err := url.Parse(d)
+			if err != nil {
+				return nil, fmt.Errorf("invalid distributor URL %q: %v", d, err)
+			}
+			ds = append(ds, u)
+		}
+		pub = client.NewPublisher(ds, client.WithPublishMetrics(integrator.PublishLogger{}))
+	}
+	open := func(cpRaw []byte) (*fmtlog.Checkpoint, error) {
+		cp, _, _, err := lv.ParseCheckpoint(cpRaw, *origin)
+		return cp, err
+	}
+	return integrator.New(*storageDir, open, h, integrator.Opts{
+		Origin:      *origin,
+		Signers:     s,
+		Witnesses:   feed,
+		Publisher:   pub,
+		LogID:       *logID,
+		Compression: comp,
+		Concurrency: *concurrency,
+		MaxLeaves:   *maxLeavesPerRun,
+		FlushSize:   *maxLeavesPerFlush,
+	}, opts...), nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for checking the integrity of a
+// serverless log's storage.
+//
+// The tool exits with status 0 if no problems are found, 2 if resources are
+// missing or corrupt, 3 if the only problems are orphaned resources, and 1 if
+// the log could not be checked.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/encrypt"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+	"k8s.io/klog/v2"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+const (
+	// exitCorrupt is the exit status used when resources are missing or
+	// corrupt.
+	exitCorrupt = 2
+	// exitOrphaned is the exit status used when the only problems found are
+	// orphaned resources.
+	exitOrphaned = 3
+)
+
+var (
+	storageDir    = flag.String("storage_dir", "", "Root directory of the log to check.")
+	pubKeyFile    = flag.String("public_key", "", "Location of public key file, which may hold several keys, see client.ParseLogVerifiers. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin        = flag.String("origin", "", "Log origin string to check for in checkpoints.")
+	hashFunc      = flag.String("hash", client.HashSHA256, "Hash function used for the log's Merkle tree, one of sha256 or sha512_256.")
+	compression   = flag.String("compression", "none", "Compression used for the log's leaf data and tiles, one of none, gzip, or zstd.")
+	encryptionKey = flag.String("encryption_key", "", "Key encryption key used to decrypt the log's leaf data at rest: either the path of a file holding local keys, see the generate_keys tool, or gcpkms:// followed by the name of a Cloud KMS key. Required if the log's leaf data is encrypted.")
+	lock          = flag.Bool("lock", true, "Set to hold the log's sequence and integrate locks while it's checked, so that files being written aren't reported as orphaned.")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+	ctx := context.Background()
+
+	if len(*storageDir) == 0 {
+		klog.Exit("Please set --storage_dir flag.")
+	}
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		klog.Exitf("Invalid --hash: %v", err)
+	}
+	comp, err := compress.Parse(*compression)
+	if err != nil {
+		klog.Exitf("Invalid --compression: %v", err)
+	}
+	opts := []fs.Option{fs.WithCompression(comp)}
+	if len(*encryptionKey) > 0 {
+		w, err := encrypt.NewKeyWrapper(ctx, *encryptionKey)
+		if err != nil {
+			klog.Exitf("Invalid --encryption_key: %q", err)
+		}
+		opts = append(opts, fs.WithEncryption(encrypt.New(w)))
+	}
+
+	// Read log public key from file or environment variable
+	var pubKey string
+	if len(*pubKeyFile) > 0 {
+		k, err := os.ReadFile(*pubKeyFile)
+		if err != nil {
+			klog.Exitf("failed to read public_key file: %q", err)
+		}
+		pubKey = string(k)
+	} else {
+		pubKey = os.Getenv("SERVERLESS_LOG_PUBLIC_KEY")
+		if len(pubKey) == 0 {
+			klog.Exit("supply public key file path using --public_key or set SERVERLESS_LOG_PUBLIC_KEY environment variable")
+		}
+	}
+	lv, err := client.ParseLogVerifiers([]byte(pubKey))
+	if err != nil {
+		klog.Exitf("Failed to instantiate Verifiers: %q", err)
+	}
+
+	r, err := verify(ctx, lv, h, opts)
+	if err != nil {
+		klog.Exitf("Failed to check log: %q", err)
+	}
+	for _, p := range r.Problems {
+		fmt.Println(p)
+	}
+	if r.Pruned > 0 {
+		fmt.Printf("Leaf data below index %d has been pruned\n", r.Pruned)
+	}
+	fmt.Printf("Checked log of size %d: %d leaf bundles, %d tiles, %d blobs, %d archived checkpoints, %d problems found\n", r.Size, r.Bundles, r.Tiles, r.Blobs, r.Checkpoints, len(r.Problems))
+	switch {
+	case r.Has(fs.Missing) || r.Has(fs.Corrupt):
+		os.Exit(exitCorrupt)
+	case r.Has(fs.Orphaned):
+		os.Exit(exitOrphaned)
+	}
+}
+
+// verify checks the log, holding its locks if --lock is set.
+func verify(ctx context.Context, lv client.LogVerifiers, h merkle.LogHasher, opts []fs.Option) (*fs.VerifyReport, error) {
+	if *lock {
+		for _, l := range []fs.Lock{fs.SequenceLock, fs.IntegrateLock} {
+			unlock, err := fs.AcquireLock(*storageDir, l)
+			if err != nil {
+				return nil, err
+			}
+			defer func() {
+				if err := unlock(); err != nil {
+					klog.Errorf("Failed to unlock log: %q", err)
+				}
+			}()
+		}
+	}
+	open := func(cpRaw []byte) (*fmtlog.Checkpoint, error) {
+		cp, _, _, err := lv.ParseCheckpoint(cpRaw, *origin)
+		return cp, err
+	}
+	return fs.Verify(ctx, *storageDir, open, h, opts...)
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for creating a log's signing key
+// in AWS KMS, so that its private key never leaves KMS.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	awskms "github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/transparency-dev/serverless-log/experimental/aws-log/internal/kms"
+	"k8s.io/klog/v2"
+)
+
+var (
+	keyName     = flag.String("key_name", "", "Note key name of the signer, which must match the integrate tool's --signer_name, or its --origin if that's unset.")
+	alias       = flag.String("alias", "", "If set, an alias for the new key, e.g. alias/my-log.")
+	description = flag.String("description", "", "Description of the new key. Defaults to one naming --key_name.")
+	region      = flag.String("region", "", "AWS region in which to create the key. If unset, the default AWS configuration is used.")
+	outPub      = flag.String("out_pub", "", "Output file for the note verifier key.")
+	print       = flag.Bool("print", false, "Print the note verifier key to stdout.")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+	ctx := context.Background()
+
+	if len(*keyName) == 0 {
+		klog.Exit("--key_name required")
+	}
+	if !(*print) && len(*outPub) == 0 {
+		klog.Exit("--print and/or --out_pub required.")
+	}
+	desc := *description
+	if len(desc) == 0 {
+		desc = fmt.Sprintf("Checkpoint signing key for %s", *keyName)
+	}
+
+	var cfgOpts []func(*config.LoadOptions) error
+	if len(*region) > 0 {
+		cfgOpts = append(cfgOpts, config.WithRegion(*region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, cfgOpts...)
+	if err != nil {
+		klog.Exitf("Failed to load AWS config: %q", err)
+	}
+	arn, pk, err := kms.CreateKey(ctx, awskms.NewFromConfig(cfg), *alias, desc)
+	if err != nil {
+		klog.Exitf("Unable to create key: %q", err)
+	}
+	klog.Infof("Created AWS KMS key %s, pass this or its alias to the integrate tool's --aws_kms_key flag", arn)
+
+	vkey := pk.VerifierKey(*keyName)
+	if *print {
+		fmt.Println(vkey)
+	}
+	if len(*outPub) > 0 {
+		f, err := os.OpenFile(*outPub, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			klog.Exitf("Unable to create verifier key file %q: %v", *outPub, err)
+		}
+		if _, err := f.WriteString(vkey); err != nil {
+			klog.Exitf("Unable to write verifier key file %q: %v", *outPub, err)
+		}
+		if err := f.Close(); err != nil {
+			klog.Exitf("Unable to write verifier key file %q: %v", *outPub, err)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for restoring a serverless log
+// to an S3 bucket from a snapshot archive written by the export_snapshot tool.
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/experimental/aws-log/internal/storage"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/snapshot"
+	"k8s.io/klog/v2"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+var (
+	bucket         = flag.String("bucket", "", "Name of the S3 bucket to restore the log to, which must not already hold a log.")
+	region         = flag.String("region", "", "AWS region of the bucket. If unset, the default AWS configuration is used.")
+	endpoint       = flag.String("endpoint", "", "If set, overrides the S3 endpoint, e.g. to use an S3-compatible service.")
+	pathStyle      = flag.Bool("path_style", false, "Set to address the bucket in the request path rather than the host name.")
+	noCondWrites   = flag.Bool("disable_conditional_writes", false, "Set if the S3 service does not support conditional PUTs. Nothing else may then write to the bucket during the restore.")
+	provider       = flag.String("provider", "aws", "Service hosting the bucket, one of aws, r2, or minio. Conditional PUTs are disabled for r2 and minio unless --enable_conditional_writes is set.")
+	condWrites     = flag.Bool("enable_conditional_writes", false, "Set to use conditional PUTs with r2 or minio, if the service supports them, see the integrate tool's --check_conditional_writes flag.")
+	create         = flag.Bool("create", false, "Set to create the bucket before restoring the log to it.")
+	cpCacheControl = flag.String("checkpoint_cache_control", layout.CheckpointCacheControl, "The Cache-Control header to set on the checkpoint, or empty to set none.")
+	cacheControl   = flag.String("cache_control", layout.ImmutableCacheControl, "The Cache-Control header to set on other objects, which are immutable, or empty to set none.")
+	input          = flag.String("input", "", "Path of the snapshot archive to restore, or - to read it from stdin. The archive is gzip decompressed if the path ends in .gz.")
+	stagingDir     = flag.String("staging_dir", "", "Directory in which the snapshot is extracted and verified before it's restored. If unset, the default directory for temporary files is used.")
+	pubKeyFile     = flag.String("public_key", "", "Location of public key file, which may hold several keys, see client.ParseLogVerifiers. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin         = flag.String("origin", "", "Log origin string to check for in checkpoints.")
+	hashFunc       = flag.String("hash", client.HashSHA256, "Hash function used for the log's Merkle tree, one of sha256 or sha512_256.")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+	ctx := context.Background()
+
+	if len(*input) == 0 {
+		klog.Exit("Please set --input flag.")
+	}
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		klog.Exitf("Invalid --hash: %v", err)
+	}
+
+	// Read log public key from file or environment variable
+	var pubKey string
+	if len(*pubKeyFile) > 0 {
+		k, err := os.ReadFile(*pubKeyFile)
+		if err != nil {
+			klog.Exitf("failed to read public_key file: %q", err)
+		}
+		pubKey = string(k)
+	} else {
+		pubKey = os.Getenv("SERVERLESS_LOG_PUBLIC_KEY")
+		if len(pubKey) == 0 {
+			klog.Exit("supply public key file path using --public_key or set SERVERLESS_LOG_PUBLIC_KEY environment variable")
+		}
+	}
+	lv, err := client.ParseLogVerifiers([]byte(pubKey))
+	if err != nil {
+		klog.Exitf("Failed to instantiate Verifiers: %q", err)
+	}
+	open := func(cpRaw []byte) (*fmtlog.Checkpoint, error) {
+		cp, _, _, err := lv.ParseCheckpoint(cpRaw, *origin)
+		return cp, err
+	}
+
+	r, closeInput, err := openInput(*input)
+	if err != nil {
+		klog.Exitf("Failed to open --input: %q", err)
+	}
+	defer closeInput()
+	s, err := snapshot.Stage(ctx, r, open, h, *stagingDir)
+	if err != nil {
+		klog.Exitf("Failed to verify snapshot: %q", err)
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			klog.Warningf("Failed to remove staging directory: %v", err)
+		}
+	}()
+	m := s.Manifest
+	// Logs on S3 don't support leaf bundles, see api/layout.
+	if m.BundleSize > 1 {
+		klog.Exitf("Snapshot is of a log with leaf bundles of size %d, which can't be restored to S3", m.BundleSize)
+	}
+	comp, err := compress.Parse(m.Compression)
+	if err != nil {
+		klog.Exitf("Invalid compression in manifest: %v", err)
+	}
+
+	st, err := newStorage(ctx, comp)
+	if err != nil {
+		klog.Exitf("Failed to create storage client: %q", err)
+	}
+	if *create {
+		if err := st.Create(ctx, *bucket); err != nil {
+			klog.Exitf("Failed to create bucket: %q", err)
+		}
+	} else if exists, err := st.HasCheckpoint(ctx); err != nil {
+		klog.Exitf("Failed to check for existing log: %q", err)
+	} else if exists {
+		klog.Exitf("Bucket %q already holds a log", *bucket)
+	}
+	if err := s.Restore(ctx, st); err != nil {
+		klog.Exitf("Failed to restore log: %q", err)
+	}
+	fmt.Printf("Restored log %q of size %d with root hash %x: %d objects\n", m.Origin, m.Size, m.RootHash, len(m.Files))
+	if comp != compress.None {
+		fmt.Printf("The log's entries and tiles are compressed, pass --compression=%s to the other tools\n", comp)
+	}
+}
+
+// newStorage returns a storage client configured by the command line flags,
+// which stores sequenced entries and tiles with the given compression.
+func newStorage(ctx context.Context, comp compress.Algorithm) (*storage.Client, error) {
+	p, err := storage.ParseProvider(*provider)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --provider: %v", err)
+	}
+	return storage.NewClient(ctx, storage.ClientOpts{
+		Bucket:                   *bucket,
+		Region:                   *region,
+		Endpoint:                 *endpoint,
+		UsePathStyle:             *pathStyle,
+		DisableConditionalWrites: *noCondWrites,
+		Provider:                 p,
+		EnableConditionalWrites:  *condWrites,
+		CheckpointCacheControl:   *cpCacheControl,
+		OtherCacheControl:        *cacheControl,
+		Compression:              comp,
+	})
+}
+
+// openInput returns a reader for the snapshot at p, see --input, and a
+// function which closes it.
+func openInput(p string) (io.Reader, func(), error) {
+	if p == "-" {
+		return os.Stdin, func() {}, nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasSuffix(p, ".gz") {
+		return f, func() { _ = f.Close() }, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return zr, func() { _ = zr.Close(); _ = f.Close() }, nil
+}
@@ -0,0 +1,327 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for integrating sequenced entries
+// into a serverless log stored on S3.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	awskms "github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/experimental/aws-log/internal/kms"
+	"github.com/transparency-dev/serverless-log/experimental/aws-log/internal/storage"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/encrypt"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"golang.org/x/mod/sumdb/note"
+	"k8s.io/klog/v2"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+var (
+	bucket         = flag.String("bucket", "", "Name of the S3 bucket holding the log.")
+	region         = flag.String("region", "", "AWS region of the bucket. If unset, the default AWS configuration is used.")
+	endpoint       = flag.String("endpoint", "", "If set, overrides the S3 endpoint, e.g. to use an S3-compatible service.")
+	pathStyle      = flag.Bool("path_style", false, "Set to address the bucket in the request path rather than the host name.")
+	noCondWrites   = flag.Bool("disable_conditional_writes", false, "Set if the S3 service does not support conditional PUTs. Only one instance may then write to the log at a time.")
+	provider       = flag.String("provider", "aws", "Service hosting the bucket, one of aws, r2, or minio. Conditional PUTs are disabled for r2 and minio unless --enable_conditional_writes is set.")
+	condWrites     = flag.Bool("enable_conditional_writes", false, "Set to use conditional PUTs with r2 or minio, if the service supports them, see --check_conditional_writes.")
+	checkWrites    = flag.Bool("check_conditional_writes", false, "Set to check whether the service enforces conditional PUTs, by writing and then deleting a probe object in the bucket, and exit.")
+	lockDir        = flag.String("lock_dir", "", "If set, a local directory in which an advisory lock is held while integrating, so that instances on this host do not overlap. Use this when conditional PUTs are disabled and the tool may be run more than once at a time.")
+	ddbTable       = flag.String("dynamodb_table", "", "If set, the DynamoDB table used by the sequence tool to assign sequence numbers, see its --dynamodb_table flag.")
+	ddbEndpoint    = flag.String("dynamodb_endpoint", "", "If set, overrides the DynamoDB endpoint, e.g. to use DynamoDB Local.")
+	cpCacheControl = flag.String("checkpoint_cache_control", layout.CheckpointCacheControl, "The Cache-Control header to set on the checkpoint, or empty to set none.")
+	cacheControl   = flag.String("cache_control", layout.ImmutableCacheControl, "The Cache-Control header to set on tiles, which are immutable, or empty to set none.")
+	compression    = flag.String("compression", "none", "Compression used for stored entries and tiles, one of none, gzip, or zstd. This must match the setting used by the sequence tool.")
+	encryptionKey  = flag.String("encryption_key", "", "Key encryption key used to encrypt entries at rest: awskms:// followed by the ID, ARN, or alias of a symmetric AWS KMS key, the path of a file holding local keys, see the generate_keys tool, or gcpkms:// followed by the name of a Cloud KMS key. This must match the setting used by the sequence tool. If unset, entries are not encrypted.")
+	initialise     = flag.Bool("initialise", false, "Set when creating a new log to create the bucket and initialise the structure.")
+	pubKeyFile     = flag.String("public_key", "", "Location of public key file, which may hold several keys, see client.ParseLogVerifiers. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	privKeyFile    = flag.String("private_key", "", "Location of private key file. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+	awsKMSKey      = flag.String("aws_kms_key", "", "If set, checkpoints are also signed with this AWS KMS key, given as a key ID, key ARN, or alias, and --private_key is optional. The key must be an ECC_NIST_P256 signing key.")
+	awsKMSPubKey   = flag.String("aws_kms_public_key_cache", "", "If set, the public key of --aws_kms_key is read from this PEM file rather than fetched from KMS, and written to it if the file doesn't exist.")
+	signerName     = flag.String("signer_name", "", "Note key name of the signer used with --aws_kms_key. Defaults to --origin.")
+	origin         = flag.String("origin", "", "Log origin string to use in produced checkpoint.")
+	maxRetries     = flag.Int("conflict_retries", 3, "Number of times to retry integration if another integrator updates the checkpoint concurrently.")
+	hashFunc       = flag.String("hash", client.HashSHA256, "Hash function to use for the log's Merkle tree, one of sha256 or sha512_256.")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+	ctx := context.Background()
+
+	if *checkWrites {
+		st, err := newStorage(ctx)
+		if err != nil {
+			klog.Exitf("Failed to create storage client: %q", err)
+		}
+		ok, err := st.ProbeConditionalWrites(ctx)
+		if err != nil {
+			klog.Exitf("Failed to check conditional writes: %q", err)
+		}
+		if ok {
+			fmt.Println("Conditional writes are enforced, so several instances may write to the log at once.")
+		} else {
+			fmt.Println("Conditional writes are NOT enforced, so only one instance may write to the log at a time.")
+		}
+		return
+	}
+	if len(*origin) == 0 {
+		klog.Exitf("Please set --origin flag to log identifier.")
+	}
+
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		klog.Exitf("Invalid --hash: %v", err)
+	}
+	pubKey, err := getKey(*pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		klog.Exitf("Unable to get public key: %q", err)
+	}
+	var s []note.Signer
+	if len(*privKeyFile) > 0 || len(*awsKMSKey) == 0 {
+		privKey, err := getKey(*privKeyFile, "SERVERLESS_LOG_PRIVATE_KEY")
+		if err != nil {
+			klog.Exitf("Unable to get private key: %q", err)
+		}
+		ps, err := note.NewSigner(privKey)
+		if err != nil {
+			klog.Exitf("Failed to instantiate signer: %q", err)
+		}
+		s = append(s, ps)
+	}
+	if len(*awsKMSKey) > 0 {
+		ks, err := newKMSSigner(ctx)
+		if err != nil {
+			klog.Exitf("Failed to instantiate AWS KMS signer: %q", err)
+		}
+		s = append(s, ks)
+	}
+
+	st, err := newStorage(ctx)
+	if err != nil {
+		klog.Exitf("Failed to create storage client: %q", err)
+	}
+	if *lockDir != "" {
+		unlock, err := fs.AcquireLock(*lockDir, fs.IntegrateLock)
+		if err != nil {
+			klog.Exitf("Failed to lock --lock_dir: %q", err)
+		}
+		defer func() {
+			if err := unlock(); err != nil {
+				klog.Errorf("Failed to unlock --lock_dir: %q", err)
+			}
+		}()
+	} else if !st.ConditionalWrites() {
+		klog.Warning("Conditional writes are disabled, so only one instance may integrate at a time, see --lock_dir")
+	}
+
+	if *initialise {
+		if err := st.Create(ctx, *bucket); err != nil {
+			klog.Exitf("Failed to create log: %q", err)
+		}
+		cp := fmtlog.Checkpoint{
+			Hash: h.EmptyRoot(),
+		}
+		if err := signAndWrite(ctx, &cp, s, st); err != nil {
+			klog.Exitf("Failed to sign: %q", err)
+		}
+		os.Exit(0)
+	}
+
+	lv, err := client.ParseLogVerifiers([]byte(pubKey))
+	if err != nil {
+		klog.Exitf("Failed to instantiate Verifiers: %q", err)
+	}
+	// Another integrator may update the checkpoint while we're integrating, in
+	// which case our checkpoint write is refused and we start again from the
+	// new checkpoint.
+	for attempt := 0; ; attempt++ {
+		err := integrate(ctx, st, h, lv, s)
+		if errors.Is(err, log.ErrConflict) && attempt < *maxRetries {
+			klog.Warningf("Retrying integration: %v", err)
+			continue
+		}
+		if err != nil {
+			klog.Exit(err)
+		}
+		return
+	}
+}
+
+// integrate integrates any new entries into the log, and writes the resulting
+// checkpoint.
+func integrate(ctx context.Context, st *storage.Client, h merkle.LogHasher, lv client.LogVerifiers, s []note.Signer) error {
+	cpRaw, err := st.ReadCheckpoint(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read log checkpoint: %w", err)
+	}
+
+	// Check signatures
+	cp, _, _, err := lv.ParseCheckpoint(cpRaw, *origin)
+	if err != nil {
+		return fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+
+	// Integrate new entries
+	newCp, err := log.Integrate(ctx, cp.Size, st, h)
+	if err != nil {
+		return fmt.Errorf("failed to integrate: %w", err)
+	}
+	if newCp == nil {
+		return errors.New("nothing to integrate")
+	}
+
+	return signAndWrite(ctx, newCp, s, st)
+}
+
+// newStorage returns a storage client configured by the command line flags.
+func newStorage(ctx context.Context) (*storage.Client, error) {
+	comp, err := compress.Parse(*compression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --compression: %v", err)
+	}
+	p, err := storage.ParseProvider(*provider)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --provider: %v", err)
+	}
+	coord, err := newCoordinator(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create coordinator: %v", err)
+	}
+	enc, err := newEncrypter(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --encryption_key: %v", err)
+	}
+	return storage.NewClient(ctx, storage.ClientOpts{
+		Bucket:                   *bucket,
+		Region:                   *region,
+		Endpoint:                 *endpoint,
+		UsePathStyle:             *pathStyle,
+		DisableConditionalWrites: *noCondWrites,
+		Provider:                 p,
+		EnableConditionalWrites:  *condWrites,
+		CheckpointCacheControl:   *cpCacheControl,
+		OtherCacheControl:        *cacheControl,
+		Compression:              comp,
+		Coordinator:              coord,
+		Encrypter:                enc,
+	})
+}
+
+// getKey returns the contents of the file at path, or of the named environment
+// variable if path is empty.
+func getKey(path, env string) (string, error) {
+	if len(path) > 0 {
+		k, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read key file: %w", err)
+		}
+		return string(k), nil
+	}
+	k := os.Getenv(env)
+	if len(k) == 0 {
+		return "", fmt.Errorf("supply key file path using flags or set %s environment variable", env)
+	}
+	return k, nil
+}
+
+// newKMSSigner returns a signer for the --aws_kms_key key.
+func newKMSSigner(ctx context.Context) (note.Signer, error) {
+	var cfgOpts []func(*config.LoadOptions) error
+	if len(*region) > 0 {
+		cfgOpts = append(cfgOpts, config.WithRegion(*region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, cfgOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	name := *signerName
+	if len(name) == 0 {
+		name = *origin
+	}
+	var opts []kms.Option
+	if len(*awsKMSPubKey) > 0 {
+		opts = append(opts, kms.WithPublicKeyCache(*awsKMSPubKey))
+	}
+	s, pk, err := kms.NewSigner(ctx, awskms.NewFromConfig(cfg), *awsKMSKey, name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("Signing with AWS KMS key %q, verifier key %s", *awsKMSKey, pk.VerifierKey(name))
+	return s, nil
+}
+
+func signAndWrite(ctx context.Context, cp *fmtlog.Checkpoint, s []note.Signer, st *storage.Client) error {
+	cp.Origin = *origin
+	cpNoteSigned, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, s...)
+	if err != nil {
+		return fmt.Errorf("failed to sign Checkpoint: %w", err)
+	}
+	if err := st.WriteCheckpoint(ctx, cpNoteSigned); err != nil {
+		return fmt.Errorf("failed to store new log checkpoint: %w", err)
+	}
+	return nil
+}
+
+// newCoordinator returns the Coordinator configured by the --dynamodb flags, or
+// nil if there is none.
+func newCoordinator(ctx context.Context) (storage.Coordinator, error) {
+	if *ddbTable == "" {
+		return nil, nil
+	}
+	return storage.NewDynamoDBCoordinator(ctx, storage.DynamoDBOpts{
+		Table:    *ddbTable,
+		Region:   *region,
+		Endpoint: *ddbEndpoint,
+		Prefix:   *bucket,
+	})
+}
+
+// newEncrypter returns the Encrypter configured by --encryption_key, or nil if
+// leaf data is not encrypted.
+func newEncrypter(ctx context.Context) (*encrypt.Encrypter, error) {
+	if *encryptionKey == "" {
+		return nil, nil
+	}
+	keyID, ok := strings.CutPrefix(*encryptionKey, kms.KeyPrefix)
+	if !ok {
+		w, err := encrypt.NewKeyWrapper(ctx, *encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		return encrypt.New(w), nil
+	}
+	var cfgOpts []func(*config.LoadOptions) error
+	if len(*region) > 0 {
+		cfgOpts = append(cfgOpts, config.WithRegion(*region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, cfgOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return encrypt.New(kms.NewKeyWrapper(awskms.NewFromConfig(cfg), keyID)), nil
+}
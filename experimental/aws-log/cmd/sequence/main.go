@@ -0,0 +1,297 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for sequencing entries in a
+// serverless log stored on S3.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	awskms "github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/experimental/aws-log/internal/ingest/sqs"
+	"github.com/transparency-dev/serverless-log/experimental/aws-log/internal/kms"
+	"github.com/transparency-dev/serverless-log/experimental/aws-log/internal/storage"
+	"github.com/transparency-dev/serverless-log/internal/admission"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/encrypt"
+	"github.com/transparency-dev/serverless-log/internal/ingest"
+	"github.com/transparency-dev/serverless-log/internal/ingest/kafka"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"k8s.io/klog/v2"
+)
+
+var (
+	bucket        = flag.String("bucket", "", "Name of the S3 bucket holding the log.")
+	region        = flag.String("region", "", "AWS region of the bucket. If unset, the default AWS configuration is used.")
+	endpoint      = flag.String("endpoint", "", "If set, overrides the S3 endpoint, e.g. to use an S3-compatible service.")
+	pathStyle     = flag.Bool("path_style", false, "Set to address the bucket in the request path rather than the host name.")
+	noCondWrites  = flag.Bool("disable_conditional_writes", false, "Set if the S3 service does not support conditional PUTs. Only one instance may then write to the log at a time.")
+	provider      = flag.String("provider", "aws", "Service hosting the bucket, one of aws, r2, or minio. Conditional PUTs are disabled for r2 and minio unless --enable_conditional_writes is set.")
+	condWrites    = flag.Bool("enable_conditional_writes", false, "Set to use conditional PUTs with r2 or minio, if the service supports them, see the integrate tool's --check_conditional_writes flag.")
+	lockDir       = flag.String("lock_dir", "", "If set, a local directory in which an advisory lock is held while sequencing, so that instances on this host do not overlap. Use this when conditional PUTs are disabled and the tool may be run more than once at a time.")
+	ddbTable      = flag.String("dynamodb_table", "", "If set, sequence numbers are assigned using this DynamoDB table, so that any number of instances may sequence at a time. The integrate tool must be given the same table.")
+	ddbEndpoint   = flag.String("dynamodb_endpoint", "", "If set, overrides the DynamoDB endpoint, e.g. to use DynamoDB Local.")
+	cacheControl  = flag.String("cache_control", layout.ImmutableCacheControl, "The Cache-Control header to set on sequenced entries and leafhash index files, which are immutable, or empty to set none.")
+	compression   = flag.String("compression", "none", "Compression to use for stored entries, one of none, gzip, or zstd. This must match the setting used by the integrate tool.")
+	encryptionKey = flag.String("encryption_key", "", "Key encryption key used to encrypt entries at rest: awskms:// followed by the ID, ARN, or alias of a symmetric AWS KMS key, the path of a file holding local keys, see the generate_keys tool, or gcpkms:// followed by the name of a Cloud KMS key. This must match the setting used by the integrate tool. If unset, entries are not encrypted.")
+	entries       = flag.String("entries", "", "File path glob of entries to add to the log.")
+	pubKeyFile    = flag.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin        = flag.String("origin", "", "Log origin string to check for in checkpoint.")
+	hashFunc      = flag.String("hash", client.HashSHA256, "Hash function used for the log's Merkle tree, one of sha256 or sha512_256.")
+	sqsQueueURL   = flag.String("sqs_queue_url", "", "URL of an SQS queue from which to sequence entries sent as the bodies of messages, instead of from --entries. The tool exits once the queue has been drained.")
+	kafkaProxy    = flag.String("kafka_proxy", "", "URL of a Kafka REST Proxy, e.g. http://localhost:8082, via which to sequence entries from the values of records on --kafka_topic, instead of from --entries. The tool exits once it has caught up with the topic.")
+	kafkaTopic    = flag.String("kafka_topic", "", "Kafka topic from which to sequence entries, see --kafka_proxy.")
+	kafkaGroup    = flag.String("kafka_group", "serverless-log", "Kafka consumer group used to consume --kafka_topic, whose committed offsets record which entries have been sequenced.")
+	maxMessages   = flag.Int("max_messages", 0, "Maximum number of entries to sequence from --sqs_queue_url or --kafka_topic in one run, so that a busy source doesn't hold up integration. Zero means no limit.")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	admission.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	ctx := context.Background()
+
+	// Read log public key from file or environment variable
+	var pubKey string
+	if len(*pubKeyFile) > 0 {
+		k, err := os.ReadFile(*pubKeyFile)
+		if err != nil {
+			klog.Exitf("failed to read public_key file: %q", err)
+		}
+		pubKey = string(k)
+	} else {
+		pubKey = os.Getenv("SERVERLESS_LOG_PUBLIC_KEY")
+		if len(pubKey) == 0 {
+			klog.Exit("supply public key file path using --public_key or set SERVERLESS_LOG_PUBLIC_KEY environment variable")
+		}
+	}
+
+	var toAdd []string
+	if len(*sqsQueueURL) > 0 || len(*kafkaProxy) > 0 {
+		if len(*entries) > 0 {
+			klog.Exit("--entries can't be used with --sqs_queue_url or --kafka_proxy")
+		}
+	} else {
+		var err error
+		toAdd, err = filepath.Glob(*entries)
+		if err != nil {
+			klog.Exitf("Failed to glob entries %q: %q", *entries, err)
+		}
+		if len(toAdd) == 0 {
+			klog.Exit("Sequence must be run with at least one valid entry")
+		}
+	}
+
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		klog.Exitf("Invalid --hash: %v", err)
+	}
+
+	// init storage
+	comp, err := compress.Parse(*compression)
+	if err != nil {
+		klog.Exitf("Invalid --compression: %v", err)
+	}
+	p, err := storage.ParseProvider(*provider)
+	if err != nil {
+		klog.Exitf("Invalid --provider: %v", err)
+	}
+	coord, err := newCoordinator(ctx)
+	if err != nil {
+		klog.Exitf("Failed to create coordinator: %q", err)
+	}
+	enc, err := newEncrypter(ctx)
+	if err != nil {
+		klog.Exitf("Invalid --encryption_key: %q", err)
+	}
+	st, err := storage.NewClient(ctx, storage.ClientOpts{
+		Bucket:                   *bucket,
+		Region:                   *region,
+		Endpoint:                 *endpoint,
+		UsePathStyle:             *pathStyle,
+		DisableConditionalWrites: *noCondWrites,
+		Provider:                 p,
+		EnableConditionalWrites:  *condWrites,
+		OtherCacheControl:        *cacheControl,
+		Compression:              comp,
+		Coordinator:              coord,
+		Encrypter:                enc,
+	})
+	if err != nil {
+		klog.Exitf("Failed to create storage client: %q", err)
+	}
+	if *lockDir != "" {
+		unlock, err := fs.AcquireLock(*lockDir, fs.SequenceLock)
+		if err != nil {
+			klog.Exitf("Failed to lock --lock_dir: %q", err)
+		}
+		defer func() {
+			if err := unlock(); err != nil {
+				klog.Errorf("Failed to unlock --lock_dir: %q", err)
+			}
+		}()
+	} else if !st.ConditionalWrites() && coord == nil {
+		klog.Warning("Conditional writes are disabled, so only one instance may sequence at a time, see --lock_dir")
+	}
+	cpRaw, err := st.ReadCheckpoint(ctx)
+	if err != nil {
+		klog.Exitf("Failed to read log checkpoint: %q", err)
+	}
+
+	// Check signatures
+	lv, err := client.ParseLogVerifiers([]byte(pubKey))
+	if err != nil {
+		klog.Exitf("Failed to instantiate Verifiers: %q", err)
+	}
+	cp, _, _, err := lv.ParseCheckpoint(cpRaw, *origin)
+	if err != nil {
+		klog.Exitf("Failed to parse Checkpoint: %q", err)
+	}
+	st.SetNextSeq(cp.Size)
+
+	policy, err := admission.PolicyFromFlags(flag.CommandLine)
+	if err != nil {
+		klog.Exitf("Failed to configure admission policy: %v", err)
+	}
+
+	// sequence entries
+	add := func(ctx context.Context, name, contentType string, b []byte) error {
+		if policy != nil {
+			err := policy.Admit(ctx, admission.Entry{Data: b, ContentType: contentType})
+			if errors.Is(err, admission.ErrRejected) {
+				klog.Warningf("Skipping %v: %v", name, err)
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("failed to apply admission policy to %q: %v", name, err)
+			}
+		}
+		// ask storage to sequence
+		r, err := log.Add(ctx, st, h, b)
+		if err != nil {
+			return fmt.Errorf("failed to sequence %q: %v", name, err)
+		}
+		l := fmt.Sprintf("%d: %v", r.Index, name)
+		if r.Duplicate {
+			l += " (dupe)"
+		}
+		klog.Info(l)
+		return nil
+	}
+
+	q, closeQueue, err := newQueue(ctx)
+	if err != nil {
+		klog.Exitf("Failed to open queue: %q", err)
+	}
+	if q != nil {
+		defer closeQueue()
+		r := ingest.NewReceiver(q, ingest.WithMaxMessages(*maxMessages))
+		err := r.Receive(ctx, func(ctx context.Context, m ingest.Message) error {
+			return add(ctx, "message "+m.ID, "", m.Data)
+		})
+		if err != nil {
+			klog.Exitf("Failed to sequence entries from queue: %q", err)
+		}
+		return
+	}
+
+	for _, fp := range toAdd {
+		b, err := os.ReadFile(fp)
+		if err != nil {
+			klog.Exitf("Failed to read entry file %q: %q", fp, err)
+		}
+		if err := add(ctx, fp, mime.TypeByExtension(filepath.Ext(fp)), b); err != nil {
+			klog.Exit(err)
+		}
+	}
+}
+
+// newCoordinator returns the Coordinator configured by the --dynamodb flags, or
+// nil if there is none.
+func newCoordinator(ctx context.Context) (storage.Coordinator, error) {
+	if *ddbTable == "" {
+		return nil, nil
+	}
+	return storage.NewDynamoDBCoordinator(ctx, storage.DynamoDBOpts{
+		Table:    *ddbTable,
+		Region:   *region,
+		Endpoint: *ddbEndpoint,
+		Prefix:   *bucket,
+	})
+}
+
+// newEncrypter returns the Encrypter configured by --encryption_key, or nil if
+// leaf data is not encrypted.
+func newEncrypter(ctx context.Context) (*encrypt.Encrypter, error) {
+	if *encryptionKey == "" {
+		return nil, nil
+	}
+	keyID, ok := strings.CutPrefix(*encryptionKey, kms.KeyPrefix)
+	if !ok {
+		w, err := encrypt.NewKeyWrapper(ctx, *encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		return encrypt.New(w), nil
+	}
+	var cfgOpts []func(*config.LoadOptions) error
+	if len(*region) > 0 {
+		cfgOpts = append(cfgOpts, config.WithRegion(*region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, cfgOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return encrypt.New(kms.NewKeyWrapper(awskms.NewFromConfig(cfg), keyID)), nil
+}
+
+// newQueue returns the queue configured by the --sqs_queue_url or --kafka
+// flags, along with a func to release it, or nil if there is none.
+func newQueue(ctx context.Context) (ingest.Queue, func(), error) {
+	switch {
+	case len(*sqsQueueURL) > 0 && len(*kafkaProxy) > 0:
+		return nil, nil, errors.New("only one of --sqs_queue_url and --kafka_proxy may be set")
+	case len(*sqsQueueURL) > 0:
+		q, err := sqs.NewQueue(ctx, sqs.Opts{QueueURL: *sqsQueueURL})
+		if err != nil {
+			return nil, nil, err
+		}
+		return q, func() {}, nil
+	case len(*kafkaProxy) > 0:
+		if len(*kafkaTopic) == 0 {
+			return nil, nil, errors.New("--kafka_topic must be set with --kafka_proxy")
+		}
+		c, err := kafka.NewConsumer(ctx, *kafkaProxy, *kafkaGroup, *kafkaTopic)
+		if err != nil {
+			return nil, nil, err
+		}
+		return c, func() {
+			if err := c.Close(ctx); err != nil {
+				klog.Warningf("Failed to close Kafka consumer: %q", err)
+			}
+		}, nil
+	}
+	return nil, nil, nil
+}
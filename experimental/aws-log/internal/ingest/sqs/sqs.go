@@ -0,0 +1,209 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqs provides an ingest.Queue which consumes entries sent to an Amazon
+// SQS queue, each as the body of a message.
+//
+// The SQS JSON API is called directly, as for the DynamoDB coordinator, to
+// avoid depending on the SQS client library.
+package sqs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/transparency-dev/serverless-log/internal/ingest"
+)
+
+const (
+	// maxBatch is the maximum number of messages which SQS receives or
+	// deletes in a single request.
+	maxBatch = 10
+	// waitTime is how long each receive waits for messages to arrive. Long
+	// polling is used, since short polls may return no messages even though
+	// some are waiting.
+	waitTime = time.Second
+)
+
+// Opts holds configuration options for a Queue.
+type Opts struct {
+	// QueueURL is the URL of the queue, e.g.
+	// https://sqs.us-east-1.amazonaws.com/123456789012/my-log. Requests are
+	// sent to the endpoint at the same host.
+	QueueURL string
+	// Region is the AWS region hosting the queue. If unset, the region is
+	// taken from QueueURL if it's an AWS endpoint, and otherwise from the
+	// default AWS configuration.
+	Region string
+}
+
+// Queue consumes messages from an SQS queue.
+type Queue struct {
+	client   *http.Client
+	endpoint string
+	queueURL string
+	region   string
+	creds    aws.CredentialsProvider
+	signer   *v4.Signer
+}
+
+var _ ingest.Queue = &Queue{}
+
+// NewQueue returns a Queue which consumes messages from the queue described by
+// opts. Credentials are taken from the default AWS configuration.
+func NewQueue(ctx context.Context, opts Opts) (*Queue, error) {
+	u, err := url.Parse(opts.QueueURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid SQS queue URL %q", opts.QueueURL)
+	}
+	region := opts.Region
+	if region == "" {
+		// AWS queue URLs have a host of the form sqs.<region>.amazonaws.com.
+		if parts := strings.Split(u.Hostname(), "."); len(parts) == 4 && parts[0] == "sqs" && parts[2] == "amazonaws" {
+			region = parts[1]
+		}
+	}
+	var cfgOpts []func(*config.LoadOptions) error
+	if region != "" {
+		cfgOpts = append(cfgOpts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, cfgOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("AWS region must be set for SQS")
+	}
+	return &Queue{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		endpoint: u.Scheme + "://" + u.Host + "/",
+		queueURL: opts.QueueURL,
+		region:   cfg.Region,
+		creds:    cfg.Credentials,
+		signer:   v4.NewSigner(),
+	}, nil
+}
+
+// Pull implements ingest.Queue. At most 10 messages are returned at a time.
+// Messages are redelivered unless they're acknowledged with Ack before their
+// visibility timeout, which is configured on the queue, has passed.
+func (q *Queue) Pull(ctx context.Context, max int) ([]ingest.Message, error) {
+	var resp struct {
+		Messages []struct {
+			MessageID     string `json:"MessageId"`
+			ReceiptHandle string
+			Body          string
+		}
+	}
+	req := map[string]any{
+		"QueueUrl":            q.queueURL,
+		"MaxNumberOfMessages": min(max, maxBatch),
+		"WaitTimeSeconds":     int(waitTime.Seconds()),
+	}
+	if err := q.call(ctx, "ReceiveMessage", req, &resp); err != nil {
+		return nil, err
+	}
+	msgs := make([]ingest.Message, 0, len(resp.Messages))
+	for _, m := range resp.Messages {
+		msgs = append(msgs, ingest.Message{ID: m.MessageID, Data: []byte(m.Body), Handle: m.ReceiptHandle})
+	}
+	return msgs, nil
+}
+
+// Ack implements ingest.Queue, by deleting msgs from the queue.
+func (q *Queue) Ack(ctx context.Context, msgs []ingest.Message) error {
+	for len(msgs) > 0 {
+		n := min(len(msgs), maxBatch)
+		entries := make([]map[string]string, 0, n)
+		for i, m := range msgs[:n] {
+			entries = append(entries, map[string]string{"Id": strconv.Itoa(i), "ReceiptHandle": m.Handle})
+		}
+		var resp struct {
+			Failed []struct {
+				ID      string `json:"Id"`
+				Code    string
+				Message string
+			}
+		}
+		if err := q.call(ctx, "DeleteMessageBatch", map[string]any{"QueueUrl": q.queueURL, "Entries": entries}, &resp); err != nil {
+			return err
+		}
+		if len(resp.Failed) > 0 {
+			f := resp.Failed[0]
+			return fmt.Errorf("failed to delete %d messages, e.g. message %s: %s: %s", len(resp.Failed), f.ID, f.Code, f.Message)
+		}
+		msgs = msgs[n:]
+	}
+	return nil
+}
+
+// call makes a request to the SQS API operation op, and unmarshals the
+// response into resp.
+func (q *Queue) call(ctx context.Context, op string, req any, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", op, err)
+	}
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, q.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	hr.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	hr.Header.Set("X-Amz-Target", "AmazonSQS."+op)
+	creds, err := q.creds.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	h := sha256.Sum256(body)
+	if err := q.signer.SignHTTP(ctx, creds, hr, hex.EncodeToString(h[:]), "sqs", q.region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign %s request: %w", op, err)
+	}
+	r, err := q.client.Do(hr)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", op, err)
+	}
+	defer r.Body.Close()
+	rb, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", op, err)
+	}
+	if r.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(rb, &e); err != nil {
+			e.Message = string(rb)
+		}
+		return fmt.Errorf("%s failed with status %d: %s: %s", op, r.StatusCode, e.Type, e.Message)
+	}
+	if err := json.Unmarshal(rb, resp); err != nil {
+		return fmt.Errorf("failed to unmarshal %s response: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kms provides a note signer whose private key is held in AWS KMS, and
+// wrapping of the data keys used to encrypt a log's leaf data with AWS KMS keys.
+package kms
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/transparency-dev/serverless-log/internal/signer"
+	"k8s.io/klog/v2"
+)
+
+// API is the subset of the AWS KMS client used by the signer.
+type API interface {
+	GetPublicKey(ctx context.Context, in *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+	Sign(ctx context.Context, in *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+}
+
+// Option is used to configure optional behaviour of NewSigner.
+type Option func(*opts)
+
+type opts struct {
+	publicKeyCache string
+}
+
+// WithPublicKeyCache causes the key's public key to be read from the PEM file
+// at path if it exists, rather than from KMS, and written there otherwise.
+// This saves a request to KMS each time a signer is created, e.g. on each run
+// of the integrate tool.
+func WithPublicKeyCache(path string) Option {
+	return func(o *opts) {
+		o.publicKeyCache = path
+	}
+}
+
+// NewSigner returns a note signer with the given name, which signs using the
+// AWS KMS key keyID, which may be a key ID, key ARN, alias name, or alias ARN.
+//
+// The key must be an ECC_NIST_P256 signing key. Its signatures are made with
+// the ECDSA_SHA_256 algorithm, over the SHA-256 digest of the note text, see
+// client.NewLogVerifier. The note verifier key for the signer can be found with
+// the returned PublicKey's VerifierKey method.
+//
+// ctx is used for each request made by the signer.
+func NewSigner(ctx context.Context, api API, keyID, name string, options ...Option) (*signer.Signer, signer.PublicKey, error) {
+	o := &opts{}
+	for _, opt := range options {
+		opt(o)
+	}
+	pk, err := publicKey(ctx, api, keyID, o.publicKeyCache)
+	if err != nil {
+		return nil, signer.PublicKey{}, err
+	}
+	if pk.Alg != signer.AlgECDSA {
+		return nil, signer.PublicKey{}, errors.New("AWS KMS keys must be ECDSA P-256 keys")
+	}
+	s, err := signer.New(name, pk, func(msg []byte) ([]byte, error) {
+		d := sha256.Sum256(msg)
+		r, err := api.Sign(ctx, &kms.SignInput{
+			KeyId:            aws.String(keyID),
+			Message:          d[:],
+			MessageType:      types.MessageTypeDigest,
+			SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign with AWS KMS key %q: %w", keyID, err)
+		}
+		return r.Signature, nil
+	})
+	if err != nil {
+		return nil, signer.PublicKey{}, err
+	}
+	return s, pk, nil
+}
+
+// CreateAPI is the subset of the AWS KMS client used by CreateKey.
+type CreateAPI interface {
+	API
+	CreateKey(ctx context.Context, in *kms.CreateKeyInput, optFns ...func(*kms.Options)) (*kms.CreateKeyOutput, error)
+	CreateAlias(ctx context.Context, in *kms.CreateAliasInput, optFns ...func(*kms.Options)) (*kms.CreateAliasOutput, error)
+}
+
+// CreateKey creates a new ECC_NIST_P256 signing key in AWS KMS, so that its
+// private key never leaves KMS, and returns its ARN, for use with NewSigner,
+// along with its public key. If alias is set, e.g. alias/my-log, it's created
+// to refer to the new key.
+func CreateKey(ctx context.Context, api CreateAPI, alias, description string) (string, signer.PublicKey, error) {
+	r, err := api.CreateKey(ctx, &kms.CreateKeyInput{
+		KeySpec:     types.KeySpecEccNistP256,
+		KeyUsage:    types.KeyUsageTypeSignVerify,
+		Description: aws.String(description),
+	})
+	if err != nil {
+		return "", signer.PublicKey{}, fmt.Errorf("failed to create AWS KMS key: %w", err)
+	}
+	arn := aws.ToString(r.KeyMetadata.Arn)
+	if alias != "" {
+		if _, err := api.CreateAlias(ctx, &kms.CreateAliasInput{AliasName: aws.String(alias), TargetKeyId: aws.String(arn)}); err != nil {
+			return "", signer.PublicKey{}, fmt.Errorf("failed to create alias %q for AWS KMS key %q: %w", alias, arn, err)
+		}
+	}
+	pk, err := publicKey(ctx, api, arn, "")
+	if err != nil {
+		return "", signer.PublicKey{}, err
+	}
+	return arn, pk, nil
+}
+
+// publicKey returns the public key of the KMS key keyID, reading it from the
+// PEM file at cache if it's set and the file exists, see WithPublicKeyCache.
+func publicKey(ctx context.Context, api API, keyID, cache string) (signer.PublicKey, error) {
+	if cache != "" {
+		p, err := os.ReadFile(cache)
+		if err == nil {
+			return signer.ParsePublicKeyPEM(p)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return signer.PublicKey{}, fmt.Errorf("failed to read cached public key: %w", err)
+		}
+	}
+
+	r, err := api.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		return signer.PublicKey{}, fmt.Errorf("failed to get public key of AWS KMS key %q: %w", keyID, err)
+	}
+	if r.KeyUsage != types.KeyUsageTypeSignVerify || !slices.Contains(r.SigningAlgorithms, types.SigningAlgorithmSpecEcdsaSha256) {
+		return signer.PublicKey{}, fmt.Errorf("AWS KMS key %q is not an ECDSA_SHA_256 signing key", keyID)
+	}
+	pk, err := signer.ParsePublicKeyDER(r.PublicKey)
+	if err != nil {
+		return signer.PublicKey{}, err
+	}
+
+	if cache != "" {
+		p := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: r.PublicKey})
+		if err := os.WriteFile(cache, p, 0o644); err != nil {
+			// Not fatal, we'll just fetch the key again next time.
+			klog.Warningf("Failed to cache public key in %q: %v", cache, err)
+		}
+	}
+	return pk, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// KeyPrefix is the prefix of key specs which name an AWS KMS key to use for
+// wrapping data keys, e.g. awskms://alias/my-log.
+const KeyPrefix = "awskms://"
+
+// WrapAPI is the subset of the AWS KMS client used by the KeyWrapper.
+type WrapAPI interface {
+	Encrypt(ctx context.Context, in *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error)
+	Decrypt(ctx context.Context, in *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// encryptionContext is bound to every data key wrapped by a KeyWrapper, so
+// that they can't be confused with other data encrypted with the same key.
+var encryptionContext = map[string]string{"purpose": "serverless-log data key"}
+
+// KeyWrapper wraps and unwraps the data keys used to encrypt a log's leaf data
+// at rest with a symmetric AWS KMS key, see encrypt.KeyWrapper.
+type KeyWrapper struct {
+	api   WrapAPI
+	keyID string
+}
+
+// NewKeyWrapper returns a KeyWrapper which uses the AWS KMS key keyID, which
+// may be a key ID, key ARN, alias name, or alias ARN. The key must be a
+// SYMMETRIC_DEFAULT encryption key.
+func NewKeyWrapper(api WrapAPI, keyID string) *KeyWrapper {
+	return &KeyWrapper{api: api, keyID: keyID}
+}
+
+// WrapKey wraps dek, and returns the ARN of the key which wrapped it as its
+// ID, so that it can be unwrapped even if an alias is later moved to another
+// key.
+func (k *KeyWrapper) WrapKey(ctx context.Context, dek []byte) (string, []byte, error) {
+	r, err := k.api.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:             aws.String(k.keyID),
+		Plaintext:         dek,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encrypt with AWS KMS key %q: %w", k.keyID, err)
+	}
+	return aws.ToString(r.KeyId), r.CiphertextBlob, nil
+}
+
+// UnwrapKey unwraps a data key which was wrapped by WrapKey.
+func (k *KeyWrapper) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	r, err := k.api.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:             aws.String(keyID),
+		CiphertextBlob:    wrapped,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt with AWS KMS key %q: %w", keyID, err)
+	}
+	return r.Plaintext, nil
+}
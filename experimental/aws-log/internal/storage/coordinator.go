@@ -0,0 +1,147 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"k8s.io/klog/v2"
+)
+
+// Coordinator assigns sequence numbers to leaves transactionally, on behalf of
+// a Client whose bucket holds the leaf data, see ClientOpts.Coordinator.
+//
+// Object stores can't atomically assign the next sequence number, so without a
+// Coordinator, concurrent sequencers rely on conditional writes to detect
+// collisions, and retry. A Coordinator backed by a database allows any number
+// of sequencers to assign sequence numbers safely and without collisions, and
+// guarantees that duplicate leaves are never assigned more than one.
+type Coordinator interface {
+	// Assign assigns the next sequence number to the leaf with the given
+	// hash, and returns it. If the leaf has already been assigned a sequence
+	// number, that is returned along with log.ErrDupeLeaf.
+	//
+	// If no sequence numbers have been assigned yet, numbering starts at
+	// first, which should be the size of the log.
+	Assign(ctx context.Context, leafhash []byte, first uint64) (uint64, error)
+
+	// Lookup returns the hash of the leaf which was assigned the sequence
+	// number seq, or an error wrapping os.ErrNotExist if it has not been
+	// assigned.
+	Lookup(ctx context.Context, seq uint64) ([]byte, error)
+}
+
+// pendingKey returns the key of the object holding the data of the leaf with
+// the given hash, while it's being sequenced by a Coordinator.
+func pendingKey(leafhash []byte) string {
+	return "leaves/pending/" + hex.EncodeToString(leafhash)
+}
+
+// sequenceCoordinated sequences the leaf using the client's Coordinator.
+//
+// The leaf data is first stored in a pending object named by its hash, then
+// assigned a sequence number, and only then copied to its seq object. If the
+// sequencer is interrupted after the sequence number is assigned, the seq
+// object is written by ScanSequenced instead, see fillSequenced, so assigned
+// sequence numbers never leave gaps in the log.
+func (c *Client) sequenceCoordinated(ctx context.Context, leafhash []byte, leaf []byte) (uint64, error) {
+	d, err := c.encode(ctx, leaf)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode leaf data: %w", err)
+	}
+	pk := pendingKey(leafhash)
+	if err := c.putObject(ctx, pk, d, c.leafEncoding(), nil); err != nil {
+		return 0, fmt.Errorf("failed to write pending object %q: %w", pk, err)
+	}
+	seq, err := c.coordinator.Assign(ctx, leafhash, c.nextSeq)
+	if errors.Is(err, log.ErrDupeLeaf) {
+		return seq, err
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to assign sequence number: %w", err)
+	}
+	if err := c.writeSequenced(ctx, seq, leafhash, d); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// fillSequenced writes the seq object for the sequence number seq, if it has
+// been assigned by the client's Coordinator, from the leaf's pending object.
+// It returns an error wrapping os.ErrNotExist if seq has not been assigned.
+func (c *Client) fillSequenced(ctx context.Context, seq uint64) error {
+	leafhash, err := c.coordinator.Lookup(ctx, seq)
+	if err != nil {
+		return err
+	}
+	pk := pendingKey(leafhash)
+	d, err := c.getObject(ctx, pk)
+	if err != nil {
+		// The pending object is only removed once the seq object exists, so
+		// its absence is never mistaken for the end of the log.
+		return fmt.Errorf("failed to read pending object %q for assigned sequence number %d: %v", pk, seq, err)
+	}
+	klog.V(1).Infof("Writing seq object for assigned sequence number %d from %q", seq, pk)
+	return c.writeSequenced(ctx, seq, leafhash, d)
+}
+
+// writeSequenced writes the leaf data d, which has been assigned the sequence
+// number seq, to its seq object, indexes it, and removes its pending object.
+func (c *Client) writeSequenced(ctx context.Context, seq uint64, leafhash, d []byte) error {
+	seqPath := objectKey(layout.SeqPath("", seq))
+	err := c.createObject(ctx, seqPath, d, c.leafEncoding())
+	if errors.Is(err, os.ErrExist) {
+		// The object may already have been written by ScanSequenced, but it
+		// mustn't hold a different leaf, e.g. one sequenced without the
+		// Coordinator.
+		if err := c.checkSequenced(ctx, seqPath, d); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to write seq object %q: %w", seqPath, err)
+	}
+	if err := c.IndexLeaf(ctx, leafhash, seq); err != nil {
+		return err
+	}
+	if err := c.deleteObject(ctx, pendingKey(leafhash)); err != nil {
+		klog.Warningf("Failed to delete pending object: %v", err)
+	}
+	return nil
+}
+
+// checkSequenced returns an error unless the seq object with the given key
+// holds the same leaf data as the encoded leaf data d, see encode.
+func (c *Client) checkSequenced(ctx context.Context, seqPath string, d []byte) error {
+	existing, err := c.getObject(ctx, seqPath)
+	if err != nil {
+		return fmt.Errorf("failed to read content of %q: %w", seqPath, err)
+	}
+	if existing, err = c.decode(ctx, existing); err != nil {
+		return fmt.Errorf("failed to decode content of %q: %w", seqPath, err)
+	}
+	if d, err = c.decode(ctx, d); err != nil {
+		return fmt.Errorf("failed to decode leaf data: %w", err)
+	}
+	if !bytes.Equal(existing, d) {
+		return fmt.Errorf("seq object %q holds a different leaf to the one assigned its sequence number", seqPath)
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"k8s.io/klog/v2"
+)
+
+// DynamoDBOpts holds configuration options for a DynamoDBCoordinator.
+type DynamoDBOpts struct {
+	// Table is the name of the DynamoDB table to use. It must have a string
+	// partition key named "pk", and no sort key.
+	Table string
+	// Region is the AWS region hosting the table. If unset, the region is
+	// taken from the default AWS configuration.
+	Region string
+	// Endpoint, if set, overrides the DynamoDB endpoint, e.g. to use DynamoDB
+	// Local.
+	Endpoint string
+	// Prefix is prepended to the keys of the items written by the coordinator,
+	// so that more than one log can share a table. It's usually the name of
+	// the log's bucket.
+	Prefix string
+	// MaxAttempts is the number of times Assign tries to assign a sequence
+	// number when it's contending with other sequencers. If zero, 10 is used.
+	MaxAttempts int
+}
+
+// DynamoDBCoordinator is a Coordinator which assigns sequence numbers using
+// DynamoDB transactions.
+//
+// The following items are stored in the table, keyed by pk:
+//
+//	<prefix>/next          n: the next sequence number to be assigned
+//	<prefix>/seq/<seq>     h: the hash of the leaf assigned seq
+//	<prefix>/leaf/<hash>   n: the sequence number assigned to the leaf
+//
+// All three are written in a single transaction, conditional on the next
+// sequence number being unchanged and the leaf not having been assigned one.
+//
+// The items are never removed, so the table grows with the log.
+type DynamoDBCoordinator struct {
+	client      *http.Client
+	endpoint    string
+	region      string
+	table       string
+	prefix      string
+	maxAttempts int
+	creds       aws.CredentialsProvider
+	signer      *v4.Signer
+}
+
+var _ Coordinator = &DynamoDBCoordinator{}
+
+// NewDynamoDBCoordinator returns a DynamoDBCoordinator which uses the table
+// described by opts.
+// Credentials are taken from the default AWS configuration, as for NewClient.
+func NewDynamoDBCoordinator(ctx context.Context, opts DynamoDBOpts) (*DynamoDBCoordinator, error) {
+	if opts.Table == "" {
+		return nil, errors.New("DynamoDB table name must be set")
+	}
+	var cfgOpts []func(*config.LoadOptions) error
+	if opts.Region != "" {
+		cfgOpts = append(cfgOpts, config.WithRegion(opts.Region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, cfgOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("AWS region must be set for DynamoDB")
+	}
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://dynamodb.%s.amazonaws.com", cfg.Region)
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 10
+	}
+	return &DynamoDBCoordinator{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		endpoint:    endpoint,
+		region:      cfg.Region,
+		table:       opts.Table,
+		prefix:      opts.Prefix,
+		maxAttempts: maxAttempts,
+		creds:       cfg.Credentials,
+		signer:      v4.NewSigner(),
+	}, nil
+}
+
+// Assign implements Coordinator.
+func (d *DynamoDBCoordinator) Assign(ctx context.Context, leafhash []byte, first uint64) (uint64, error) {
+	leafKey := d.key("leaf", hex.EncodeToString(leafhash))
+	backoff := 50 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		if seq, ok, err := d.getNumber(ctx, leafKey); err != nil {
+			return 0, err
+		} else if ok {
+			return seq, log.ErrDupeLeaf
+		}
+		cur, ok, err := d.getNumber(ctx, d.key("next"))
+		if err != nil {
+			return 0, err
+		}
+		counter := map[string]any{
+			"TableName":        d.table,
+			"Key":              map[string]any{"pk": stringValue(d.key("next"))},
+			"UpdateExpression": "SET n = :next",
+		}
+		seq := first
+		if ok {
+			seq = cur
+			counter["ConditionExpression"] = "n = :cur"
+			counter["ExpressionAttributeValues"] = map[string]any{":cur": numberValue(cur), ":next": numberValue(cur + 1)}
+		} else {
+			counter["ConditionExpression"] = "attribute_not_exists(pk)"
+			counter["ExpressionAttributeValues"] = map[string]any{":next": numberValue(seq + 1)}
+		}
+		req := map[string]any{
+			"TransactItems": []any{
+				map[string]any{"Update": counter},
+				map[string]any{"Put": d.createItem(map[string]any{"pk": stringValue(d.key("seq", strconv.FormatUint(seq, 10))), "h": binaryValue(leafhash)})},
+				map[string]any{"Put": d.createItem(map[string]any{"pk": stringValue(leafKey), "n": numberValue(seq)})},
+			},
+		}
+		err = d.call(ctx, "TransactWriteItems", req, nil)
+		var ce *dynamoDBError
+		switch {
+		case err == nil:
+			return seq, nil
+		case !errors.As(err, &ce) || !strings.HasSuffix(ce.Type, "TransactionCanceledException"):
+			return 0, err
+		case ce.cancelled(1, "ConditionalCheckFailed") && ce.cancelled(0, "None"):
+			// The counter and the seq items are only ever written together,
+			// so this should never happen.
+			return 0, fmt.Errorf("sequence number %d is assigned, but the counter is %d", seq, cur)
+		case attempt >= d.maxAttempts:
+			return 0, fmt.Errorf("failed to assign sequence number after %d attempts: %w", attempt, err)
+		}
+		// Either another sequencer assigned the next sequence number, or this
+		// leaf, first. Check for the latter, then try again.
+		klog.V(1).Infof("Assign: transaction cancelled, retrying: %v", err)
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, 2*time.Second)
+	}
+}
+
+// Lookup implements Coordinator.
+func (d *DynamoDBCoordinator) Lookup(ctx context.Context, seq uint64) ([]byte, error) {
+	item, err := d.getItem(ctx, d.key("seq", strconv.FormatUint(seq, 10)))
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, fmt.Errorf("sequence number %d: %w", seq, os.ErrNotExist)
+	}
+	if item["h"].B == nil {
+		return nil, fmt.Errorf("item for sequence number %d has no leaf hash", seq)
+	}
+	return item["h"].B, nil
+}
+
+// key returns the partition key of the item with the given path.
+func (d *DynamoDBCoordinator) key(elem ...string) string {
+	return strings.Join(append([]string{d.prefix}, elem...), "/")
+}
+
+// createItem returns a Put request which writes item, only if it doesn't
+// already exist.
+func (d *DynamoDBCoordinator) createItem(item map[string]any) map[string]any {
+	return map[string]any{
+		"TableName":           d.table,
+		"Item":                item,
+		"ConditionExpression": "attribute_not_exists(pk)",
+	}
+}
+
+// getNumber returns the value of the number attribute n of the item with the
+// given key, and whether the item exists.
+func (d *DynamoDBCoordinator) getNumber(ctx context.Context, key string) (uint64, bool, error) {
+	item, err := d.getItem(ctx, key)
+	if err != nil || item == nil {
+		return 0, false, err
+	}
+	n, err := strconv.ParseUint(item["n"].N, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid number in item %q: %w", key, err)
+	}
+	return n, true, nil
+}
+
+// getItem returns the attributes of the item with the given key, or nil if
+// there is no such item. The read is strongly consistent.
+func (d *DynamoDBCoordinator) getItem(ctx context.Context, key string) (map[string]attributeValue, error) {
+	var resp struct {
+		Item map[string]attributeValue
+	}
+	req := map[string]any{
+		"TableName":      d.table,
+		"Key":            map[string]any{"pk": stringValue(key)},
+		"ConsistentRead": true,
+	}
+	if err := d.call(ctx, "GetItem", req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Item, nil
+}
+
+// call makes a request to the DynamoDB API operation op, and unmarshals the
+// response into resp, if it's non-nil.
+func (d *DynamoDBCoordinator) call(ctx context.Context, op string, req any, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", op, err)
+	}
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, d.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	hr.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	hr.Header.Set("X-Amz-Target", "DynamoDB_20120810."+op)
+	creds, err := d.creds.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	h := sha256.Sum256(body)
+	if err := d.signer.SignHTTP(ctx, creds, hr, hex.EncodeToString(h[:]), "dynamodb", d.region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign %s request: %w", op, err)
+	}
+	r, err := d.client.Do(hr)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", op, err)
+	}
+	defer r.Body.Close()
+	rb, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", op, err)
+	}
+	if r.StatusCode != http.StatusOK {
+		e := &dynamoDBError{Op: op, Status: r.StatusCode}
+		if err := json.Unmarshal(rb, e); err != nil {
+			e.Message = string(rb)
+		}
+		return e
+	}
+	if resp == nil {
+		return nil
+	}
+	if err := json.Unmarshal(rb, resp); err != nil {
+		return fmt.Errorf("failed to unmarshal %s response: %w", op, err)
+	}
+	return nil
+}
+
+// attributeValue is a DynamoDB attribute value of one of the types used by the
+// coordinator.
+type attributeValue struct {
+	S string `json:",omitempty"`
+	N string `json:",omitempty"`
+	B []byte `json:",omitempty"`
+}
+
+func stringValue(s string) attributeValue { return attributeValue{S: s} }
+func numberValue(n uint64) attributeValue { return attributeValue{N: strconv.FormatUint(n, 10)} }
+func binaryValue(b []byte) attributeValue { return attributeValue{B: b} }
+
+// dynamoDBError is an error response from the DynamoDB API.
+type dynamoDBError struct {
+	Op      string `json:"-"`
+	Status  int    `json:"-"`
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+	// CancellationReasons holds the reason each item of a cancelled
+	// transaction failed, if any, in the order of the request's items.
+	CancellationReasons []struct {
+		Code string
+	}
+}
+
+func (e *dynamoDBError) Error() string {
+	return fmt.Sprintf("%s failed with status %d: %s: %s", e.Op, e.Status, e.Type, e.Message)
+}
+
+// cancelled returns true if the i'th item of a cancelled transaction failed
+// with the given code.
+func (e *dynamoDBError) cancelled(i int, code string) bool {
+	return i < len(e.CancellationReasons) && e.CancellationReasons[i].Code == code
+}
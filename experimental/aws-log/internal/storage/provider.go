@@ -0,0 +1,130 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"k8s.io/klog/v2"
+)
+
+// Provider identifies the service which hosts the log's bucket, so that
+// NewClient can account for the ways in which S3-compatible services differ
+// from Amazon S3.
+type Provider string
+
+const (
+	// ProviderAWS is Amazon S3, this is the default.
+	ProviderAWS Provider = "aws"
+	// ProviderR2 is Cloudflare R2. Endpoint must be set to the account's S3
+	// API endpoint, https://<account id>.r2.cloudflarestorage.com, and the
+	// region defaults to "auto".
+	ProviderR2 Provider = "r2"
+	// ProviderMinIO is a MinIO server. Endpoint must be set to the server's
+	// URL, and the region defaults to MinIO's default of "us-east-1".
+	ProviderMinIO Provider = "minio"
+)
+
+// ParseProvider returns the Provider with the given name. The empty name
+// selects ProviderAWS.
+func ParseProvider(name string) (Provider, error) {
+	switch p := Provider(name); p {
+	case "":
+		return ProviderAWS, nil
+	case ProviderAWS, ProviderR2, ProviderMinIO:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown storage provider %q, must be one of %s, %s, or %s", name, ProviderAWS, ProviderR2, ProviderMinIO)
+}
+
+// applyProvider returns opts with the defaults for opts.Provider applied.
+//
+// Buckets on R2 and MinIO are always addressed in the request path, and
+// conditional writes are disabled unless EnableConditionalWrites is set, since
+// not all deployed versions of these services support them.
+func applyProvider(opts ClientOpts) (ClientOpts, error) {
+	p, err := ParseProvider(string(opts.Provider))
+	if err != nil {
+		return opts, err
+	}
+	opts.Provider = p
+	switch p {
+	case ProviderAWS:
+		return opts, nil
+	case ProviderR2:
+		if opts.Region == "" {
+			opts.Region = "auto"
+		}
+	case ProviderMinIO:
+		if opts.Region == "" {
+			opts.Region = "us-east-1"
+		}
+	}
+	if opts.Endpoint == "" {
+		return opts, fmt.Errorf("endpoint must be set for storage provider %s", p)
+	}
+	opts.UsePathStyle = true
+	if !opts.EnableConditionalWrites {
+		opts.DisableConditionalWrites = true
+	}
+	return opts, nil
+}
+
+// probeKey is the object written by ProbeConditionalWrites.
+const probeKey = ".conditional-write-probe"
+
+// ProbeConditionalWrites returns true if the storage service enforces the
+// preconditions of the conditional PUTs used by the client, i.e. it's safe for
+// more than one instance to write to the log at a time without
+// DisableConditionalWrites. Services which ignore the preconditions would
+// otherwise allow concurrent writers to silently overwrite each other.
+//
+// The probe writes, and then deletes, a small object at the root of the bucket.
+func (c *Client) ProbeConditionalWrites(ctx context.Context) (bool, error) {
+	put := func(in *s3.PutObjectInput) error {
+		in.Bucket, in.Key, in.Body = aws.String(c.bucket), aws.String(probeKey), bytes.NewReader(nil)
+		_, err := c.s3Client.PutObject(ctx, in)
+		return err
+	}
+	defer func() {
+		if _, err := c.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(c.bucket), Key: aws.String(probeKey)}); err != nil {
+			klog.Warningf("Failed to delete %q: %v", probeKey, err)
+		}
+	}()
+	if err := put(&s3.PutObjectInput{}); err != nil {
+		return false, fmt.Errorf("failed to write probe object: %w", err)
+	}
+	for _, in := range []*s3.PutObjectInput{
+		{IfNoneMatch: aws.String("*")},
+		{IfMatch: aws.String(`"not-the-probe-etag"`)},
+	} {
+		err := put(in)
+		switch {
+		case isPreconditionFailed(err):
+			continue
+		case err == nil, httpStatus(err) == http.StatusNotImplemented:
+			// The precondition was ignored, or isn't supported.
+			return false, nil
+		default:
+			return false, fmt.Errorf("failed to write probe object: %w", err)
+		}
+	}
+	return true, nil
+}
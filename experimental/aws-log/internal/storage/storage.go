@@ -0,0 +1,729 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storage provides a log storage implementation on Amazon S3, or any
+// S3-compatible object store.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/encrypt"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"k8s.io/klog/v2"
+)
+
+// Client is a serverless storage implementation which uses an S3 bucket to
+// store tree state.
+// The naming of the objects in the bucket is:
+//
+//	leaves/aa/bb/cc/ddeeff...
+//	seq/aa/bb/cc/ddeeff...
+//	tile/<level>/aa/bb/ccddee...
+//	checkpoint
+//
+// Objects which must only be written once, i.e. sequenced entries and tiles,
+// are written with conditional PUTs, as is the checkpoint, so that multiple
+// writers cannot silently overwrite one another's changes. Some S3-compatible
+// services do not support conditional PUTs, see ClientOpts.DisableConditionalWrites.
+//
+// The functions on this struct are not thread-safe.
+type Client struct {
+	s3Client *s3.Client
+	// bucket is the name of the bucket where tree data will be stored.
+	bucket   string
+	region   string
+	provider Provider
+	// nextSeq is a hint to the Sequence func as to what the next available
+	// sequence number is to help performance.
+	// Note that nextSeq may be <= than the actual next available number, but
+	// never greater.
+	nextSeq uint64
+	// checkpointETag is the ETag of the checkpoint object that this client last
+	// read, or empty if it has not read one. This is used for read-modify-write
+	// operation of the checkpoint.
+	checkpointETag string
+	conditional    bool
+
+	checkpointCacheControl string
+	otherCacheControl      string
+	compression            compress.Algorithm
+	encrypter              *encrypt.Encrypter
+	metrics                log.StorageMetrics
+	coordinator            Coordinator
+}
+
+var _ log.LeafIndexer = &Client{}
+
+// ClientOpts holds configuration options for the storage client.
+type ClientOpts struct {
+	// Bucket is the name of the bucket to use for storing log state.
+	Bucket string
+	// Region is the AWS region hosting the bucket. If unset, the region is
+	// taken from the default AWS configuration, e.g. the AWS_REGION environment
+	// variable.
+	Region string
+	// Endpoint, if set, overrides the S3 endpoint, e.g. to use an S3-compatible
+	// service rather than AWS.
+	Endpoint string
+	// UsePathStyle causes the bucket name to be passed in the request path
+	// rather than as part of the host name, which many S3-compatible services
+	// require.
+	UsePathStyle bool
+	// DisableConditionalWrites should be set if the storage service does not
+	// support conditional PUTs using the If-None-Match and If-Match headers.
+	// In this case, preconditions are checked before each write instead, which
+	// is only safe if a single instance is writing to the log at a time.
+	DisableConditionalWrites bool
+	// Provider identifies the service hosting the bucket, see Provider for
+	// the defaults applied for each. If unset, ProviderAWS is assumed.
+	Provider Provider
+	// EnableConditionalWrites should be set for R2 and MinIO deployments
+	// which support conditional PUTs, see Client.ProbeConditionalWrites, since
+	// they are disabled for these providers by default.
+	EnableConditionalWrites bool
+	// CheckpointCacheControl, if set, will cause the Cache-Control header associated with the
+	// checkpoint object to be set to this value. If unset, no Cache-Control header is set.
+	// layout.CheckpointCacheControl is recommended for logs which are served via a CDN.
+	CheckpointCacheControl string
+	// OtherCacheControl, if set, will cause the Cache-Control header associated with the
+	// all non-checkpoint objects to be set to this value. If unset, no Cache-Control header
+	// is set. These objects are never modified once written, so
+	// layout.ImmutableCacheControl is recommended for logs which are served via a CDN.
+	OtherCacheControl string
+	// Compression, if set, causes sequenced entries and tiles to be stored
+	// compressed with the given algorithm, with the Content-Encoding header set
+	// accordingly.
+	Compression compress.Algorithm
+	// Encrypter, if set, causes sequenced entries to be stored encrypted,
+	// after any compression, see api.Envelope. The Content-Encoding header is
+	// then not set on them, and clients must use client.DecryptingFetcher to
+	// read them. Tiles and leafhash index objects are not encrypted.
+	Encrypter *encrypt.Encrypter
+	// Metrics, if set, is informed of the objects which are read and written.
+	// Writes of objects which must only be written once, and of the
+	// checkpoint, fail their precondition if another writer got there first.
+	Metrics log.StorageMetrics
+	// Coordinator, if set, is used by Sequence to assign sequence numbers,
+	// allowing any number of sequencers to write to the log at a time. All
+	// sequencers must use the same Coordinator.
+	Coordinator Coordinator
+}
+
+// NewClient returns a Client which allows interaction with the log stored in
+// the specified bucket on S3.
+// Credentials are taken from the default AWS configuration, see
+// https://docs.aws.amazon.com/sdkref/latest/guide/standardized-credentials.html.
+func NewClient(ctx context.Context, opts ClientOpts) (*Client, error) {
+	opts, err := applyProvider(opts)
+	if err != nil {
+		return nil, err
+	}
+	var cfgOpts []func(*config.LoadOptions) error
+	if opts.Region != "" {
+		cfgOpts = append(cfgOpts, config.WithRegion(opts.Region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, cfgOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	c := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+		o.UsePathStyle = opts.UsePathStyle
+	})
+
+	return &Client{
+		s3Client:               c,
+		bucket:                 opts.Bucket,
+		region:                 cfg.Region,
+		provider:               opts.Provider,
+		conditional:            !opts.DisableConditionalWrites,
+		checkpointCacheControl: opts.CheckpointCacheControl,
+		otherCacheControl:      opts.OtherCacheControl,
+		compression:            opts.Compression,
+		encrypter:              opts.Encrypter,
+		metrics:                opts.Metrics,
+		coordinator:            opts.Coordinator,
+	}, nil
+}
+
+// Create creates a new S3 bucket and returns an error on failure.
+//
+// The bucket is not made publicly readable, since many accounts block public
+// access by default; a suitable bucket policy must be applied separately if the
+// log is to be served directly from the bucket.
+func (c *Client) Create(ctx context.Context, bucket string) error {
+	// Check if the bucket already exists.
+	_, err := c.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if err == nil {
+		return fmt.Errorf("expected bucket %q to not be created yet", bucket)
+	} else if !isNotFound(err) {
+		return fmt.Errorf("failed to check for bucket %q: %w", bucket, err)
+	}
+
+	// Create the bucket.
+	in := &s3.CreateBucketInput{Bucket: aws.String(bucket)}
+	// Buckets in us-east-1 must not specify a location constraint, and other
+	// providers don't use AWS's location constraints.
+	if c.provider == ProviderAWS && c.region != "" && c.region != "us-east-1" {
+		in.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(c.region),
+		}
+	}
+	if _, err := c.s3Client.CreateBucket(ctx, in); err != nil {
+		return fmt.Errorf("failed to create bucket %q: %w", bucket, err)
+	}
+
+	c.bucket = bucket
+	c.nextSeq = 0
+	return nil
+}
+
+// ConditionalWrites returns true if the client uses conditional PUTs, i.e. it's
+// safe for more than one instance to write to the log at a time.
+func (c *Client) ConditionalWrites() bool {
+	return c.conditional
+}
+
+// SetNextSeq sets the input as the nextSeq of the client.
+func (c *Client) SetNextSeq(num uint64) {
+	c.nextSeq = num
+}
+
+// WriteCheckpoint stores a raw log checkpoint on S3 if it matches the version
+// that the client thinks the checkpoint is. The client updates its record of
+// the checkpoint's version whenever ReadCheckpoint is called.
+//
+// This method will fail to write if 1) the checkpoint exists and the client
+// has never read it or 2) the checkpoint has been updated since the client
+// called ReadCheckpoint. In either case, the returned error wraps
+// log.ErrConflict.
+func (c *Client) WriteCheckpoint(ctx context.Context, newCPRaw []byte) error {
+	in := &s3.PutObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(layout.CheckpointPath),
+		Body:   bytes.NewReader(newCPRaw),
+	}
+	if c.checkpointCacheControl != "" {
+		in.CacheControl = aws.String(c.checkpointCacheControl)
+	}
+
+	if c.conditional {
+		if c.checkpointETag == "" {
+			in.IfNoneMatch = aws.String("*")
+		} else {
+			in.IfMatch = aws.String(c.checkpointETag)
+		}
+	} else {
+		etag, err := c.etag(ctx, layout.CheckpointPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if etag != c.checkpointETag {
+			c.preconditionFailed(layout.CheckpointPath)
+			return fmt.Errorf("%w: checkpoint has been modified since it was read", log.ErrConflict)
+		}
+	}
+
+	start := time.Now()
+	out, err := c.s3Client.PutObject(ctx, in)
+	c.observeWrite(layout.CheckpointPath, len(newCPRaw), start, err)
+	if err != nil {
+		if isPreconditionFailed(err) {
+			return fmt.Errorf("%w: checkpoint has been modified since it was read: %v", log.ErrConflict, err)
+		}
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	c.checkpointETag = aws.ToString(out.ETag)
+	return nil
+}
+
+// ReadCheckpoint reads from S3 and returns the contents of the log checkpoint.
+func (c *Client) ReadCheckpoint(ctx context.Context) ([]byte, error) {
+	start := time.Now()
+	out, err := c.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(layout.CheckpointPath),
+	})
+	if err != nil {
+		c.observeRead(layout.CheckpointPath, 0, start, err)
+		return nil, fmt.Errorf("GetObject(%q): %w", layout.CheckpointPath, err)
+	}
+	defer out.Body.Close()
+
+	cp, err := io.ReadAll(out.Body)
+	c.observeRead(layout.CheckpointPath, len(cp), start, err)
+	if err != nil {
+		return nil, err
+	}
+	// Only record the ETag once the whole checkpoint has been read, so that it
+	// is always the version of the checkpoint returned.
+	c.checkpointETag = aws.ToString(out.ETag)
+	return cp, nil
+}
+
+// HasCheckpoint returns whether the bucket holds a checkpoint, i.e. whether a
+// log has been created in it.
+func (c *Client) HasCheckpoint(ctx context.Context) (bool, error) {
+	_, err := c.etag(ctx, layout.CheckpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetTile returns the tile at the given tile-level and tile-index.
+// If no complete tile exists at that location, it will attempt to find a
+// partial tile for the given tree size at that location.
+func (c *Client) GetTile(ctx context.Context, level, index, logSize uint64) (*api.Tile, error) {
+	tileSize := layout.PartialTileSize(level, index, logSize)
+
+	// Pass an empty rootDir since we don't need this concept in S3.
+	objName := objectKey(layout.TilePath("", level, index, tileSize))
+	t, err := c.getObject(ctx, objName)
+	if err != nil {
+		if isNotFound(err) {
+			// Return the generic NotExist error so that tileCache.Visit can differentiate
+			// between this and other errors.
+			return nil, os.ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to read tile object %q in bucket %q: %w", objName, c.bucket, err)
+	}
+	if t, err = c.decompress(t); err != nil {
+		return nil, fmt.Errorf("failed to decompress tile object %q: %w", objName, err)
+	}
+
+	var tile api.Tile
+	if err := tile.UnmarshalText(t); err != nil {
+		return nil, fmt.Errorf("failed to parse tile: %w", err)
+	}
+	return &tile, nil
+}
+
+// ScanSequenced calls the provided function once for each contiguous entry
+// in storage starting at begin.
+// The scan will abort if the function returns an error, otherwise it will
+// return the number of sequenced entries scanned.
+func (c *Client) ScanSequenced(ctx context.Context, begin uint64, f func(seq uint64, entry []byte) error) (uint64, error) {
+	end := begin
+	for {
+		// Pass an empty rootDir since we don't need this concept in S3.
+		sp := objectKey(layout.SeqPath("", end))
+		entry, err := c.getObject(ctx, sp)
+		if isNotFound(err) && c.coordinator != nil {
+			// The sequence number may have been assigned by a sequencer which
+			// didn't get as far as writing the seq object.
+			if err = c.fillSequenced(ctx, end); errors.Is(err, os.ErrNotExist) {
+				return end - begin, nil
+			} else if err != nil {
+				return end - begin, err
+			}
+			entry, err = c.getObject(ctx, sp)
+		}
+		if isNotFound(err) {
+			// we're done.
+			return end - begin, nil
+		} else if err != nil {
+			return end - begin, fmt.Errorf("failed to read leafdata at index %d: %w", end, err)
+		}
+		if entry, err = c.decode(ctx, entry); err != nil {
+			return end - begin, fmt.Errorf("failed to decode leafdata at index %d: %w", end, err)
+		}
+		if err := f(end, entry); err != nil {
+			return end - begin, err
+		}
+		end++
+	}
+}
+
+// Sequence assigns the given leaf entry to the next available sequence number.
+// This method will attempt to silently squash duplicate leaves, but it cannot
+// be guaranteed that no duplicate entries will exist.
+// Returns the sequence number assigned to this leaf (if the leaf has already
+// been sequenced it will return the original sequence number and ErrDupeLeaf).
+//
+// If the client has a Coordinator, it assigns the sequence number instead, and
+// duplicate leaves are always squashed.
+func (c *Client) Sequence(ctx context.Context, leafhash []byte, leaf []byte) (uint64, error) {
+	// 1. Check for dupe leafhash
+	// 2. Create seq object
+	// 3. Create leafhash object containing assigned sequence number
+
+	// Check for dupe leaf already present.
+	// If there is one, it should contain the existing leaf's sequence number,
+	// so read that back and return it.
+	if origSeq, err := c.LeafIndex(ctx, leafhash); err == nil {
+		return origSeq, log.ErrDupeLeaf
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	if c.coordinator != nil {
+		return c.sequenceCoordinated(ctx, leafhash, leaf)
+	}
+
+	d, err := c.encode(ctx, leaf)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode leaf data: %w", err)
+	}
+
+	// Now try to sequence it, we may have to scan over some newly sequenced entries
+	// if Sequence has been called since the last time an Integrate/WriteCheckpoint
+	// was called.
+	for {
+		seq := c.nextSeq
+		seqPath := objectKey(layout.SeqPath("", seq))
+		if err := c.createObject(ctx, seqPath, d, c.leafEncoding()); errors.Is(err, os.ErrExist) {
+			// That sequence number is in use, try the next one
+			klog.V(1).Infof("Seq num %d in use, continuing", seq)
+			c.nextSeq++
+			continue
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to write seq object %q: %w", seqPath, err)
+		}
+		klog.V(2).Infof("Wrote leaf data to path %q", seqPath)
+
+		// Create a leafhash object containing the assigned sequence number.
+		// This isn't infallible though, if we crash after writing the sequence
+		// object above but before doing this, a resubmission of the same leafhash
+		// would be permitted until the entry is integrated, see IndexLeaf.
+		if err := c.IndexLeaf(ctx, leafhash, seq); err != nil {
+			return 0, err
+		}
+
+		// All done!
+		return seq, nil
+	}
+}
+
+// LeafIndex returns the sequence number of the entry with the given leaf hash,
+// or an error wrapping os.ErrNotExist if there is no such entry.
+func (c *Client) LeafIndex(ctx context.Context, leafhash []byte) (uint64, error) {
+	leafPath := objectKey(layout.LeafPath("", leafhash))
+	seqString, err := c.getObject(ctx, leafPath)
+	if err != nil {
+		if isNotFound(err) {
+			return 0, fmt.Errorf("%q: %w", leafPath, os.ErrNotExist)
+		}
+		return 0, err
+	}
+	seq, err := strconv.ParseUint(string(seqString), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid leafhash object %q: %w", leafPath, err)
+	}
+	return seq, nil
+}
+
+// IndexLeaf records that the entry with the given leaf hash was sequenced at
+// seq, by creating a leafhash object containing the sequence number. If the
+// object already exists it is left unchanged.
+//
+// This is called by log.Integrate for every entry it integrates, so that the
+// published leafhash objects cover every integrated entry.
+func (c *Client) IndexLeaf(ctx context.Context, leafhash []byte, seq uint64) error {
+	leafPath := objectKey(layout.LeafPath("", leafhash))
+	if err := c.createObject(ctx, leafPath, []byte(strconv.FormatUint(seq, 16)), ""); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("couldn't create leafhash object: %w", err)
+	}
+	return nil
+}
+
+// StoreTile writes a tile out to S3.
+// Fully populated tiles are stored at the path corresponding to the level &
+// index parameters, partially populated (i.e. right-hand edge) tiles are
+// stored with a .xx suffix where xx is the number of "tile leaves" in hex.
+func (c *Client) StoreTile(ctx context.Context, level, index uint64, tile *api.Tile) error {
+	tileSize := uint64(tile.NumLeaves)
+	klog.V(2).Infof("StoreTile: level %d index %x ts: %x", level, index, tileSize)
+	if tileSize == 0 || tileSize > 256 {
+		return fmt.Errorf("tileSize %d must be > 0 and <= 256", tileSize)
+	}
+	t, err := tile.MarshalText()
+	if err != nil {
+		return fmt.Errorf("failed to marshal tile: %w", err)
+	}
+
+	// Pass an empty rootDir since we don't need this concept in S3.
+	tPath := objectKey(layout.TilePath("", level, index, tileSize%256))
+
+	d, err := compress.Compress(c.compression, t)
+	if err != nil {
+		return fmt.Errorf("failed to compress tile: %w", err)
+	}
+
+	// Tiles, partial or full, should only be written once.
+	err = c.createObject(ctx, tPath, d, c.compression.ContentEncoding())
+	if errors.Is(err, os.ErrExist) {
+		// The object already exists, check that it contains the same content
+		// that we want to write.
+		existing, err := c.getObject(ctx, tPath)
+		if err != nil {
+			return fmt.Errorf("failed to read content of %q: %w", tPath, err)
+		}
+		if existing, err = c.decompress(existing); err != nil {
+			return fmt.Errorf("failed to decompress content of %q: %w", tPath, err)
+		}
+		if !bytes.Equal(existing, t) {
+			return fmt.Errorf("assertion that tile content for %q has not changed failed", tPath)
+		}
+		klog.V(2).Infof("StoreTile: identical tile already exists for level %d index %x ts: %x", level, index, tileSize)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to write tile object %q to bucket %q: %w", tPath, c.bucket, err)
+	}
+	return nil
+}
+
+// WriteFile writes a resource restored from a snapshot to the object with the
+// given path, which is relative to the root of the log, see the layout
+// package. The data of sequenced entries and tiles must already be compressed
+// with the client's compression algorithm, and sequenced entries may also be
+// encrypted, see ClientOpts.Encrypter. The object's modification time is
+// set by S3, so modTime is ignored.
+//
+// The checkpoint is written as by WriteCheckpoint, and other objects must not
+// already exist.
+func (c *Client) WriteFile(ctx context.Context, p string, data []byte, _ time.Time) error {
+	if p == layout.CheckpointPath {
+		return c.WriteCheckpoint(ctx, data)
+	}
+	var contentEncoding string
+	if (strings.HasPrefix(p, "seq/") && !api.IsEnvelope(data)) || strings.HasPrefix(p, "tile/") {
+		contentEncoding = c.compression.ContentEncoding()
+	}
+	if err := c.createObject(ctx, p, data, contentEncoding); err != nil {
+		return fmt.Errorf("failed to write object %q to bucket %q: %w", p, c.bucket, err)
+	}
+	return nil
+}
+
+// getObject returns the contents of the object with the given key.
+func (c *Client) getObject(ctx context.Context, key string) ([]byte, error) {
+	start := time.Now()
+	out, err := c.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		c.observeRead(key, 0, start, err)
+		return nil, err
+	}
+	defer out.Body.Close()
+	d, err := io.ReadAll(out.Body)
+	c.observeRead(key, len(d), start, err)
+	return d, err
+}
+
+// putObject writes data to the object with the given key, using the
+// non-checkpoint Cache-Control setting. If contentEncoding is non-empty, it is
+// set as the object's Content-Encoding. If ifNoneMatch is non-nil, it is passed
+// as the If-None-Match precondition.
+func (c *Client) putObject(ctx context.Context, key string, data []byte, contentEncoding string, ifNoneMatch *string) error {
+	in := &s3.PutObjectInput{
+		Bucket:      aws.String(c.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		IfNoneMatch: ifNoneMatch,
+	}
+	if c.otherCacheControl != "" {
+		in.CacheControl = aws.String(c.otherCacheControl)
+	}
+	if contentEncoding != "" {
+		in.ContentEncoding = aws.String(contentEncoding)
+	}
+	start := time.Now()
+	_, err := c.s3Client.PutObject(ctx, in)
+	c.observeWrite(key, len(data), start, err)
+	return err
+}
+
+// createObject writes data to the object with the given key and content
+// encoding, returning an error wrapping os.ErrExist if the object already
+// exists.
+func (c *Client) createObject(ctx context.Context, key string, data []byte, contentEncoding string) error {
+	if !c.conditional {
+		if _, err := c.etag(ctx, key); err == nil {
+			c.preconditionFailed(key)
+			return fmt.Errorf("%q: %w", key, os.ErrExist)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return c.putObject(ctx, key, data, contentEncoding, nil)
+	}
+	// Conditionally write only if the object does not exist yet. It may exist
+	// if there is more than one instance of the sequencer writing to the same
+	// log.
+	if err := c.putObject(ctx, key, data, contentEncoding, aws.String("*")); err != nil {
+		if isPreconditionFailed(err) {
+			return fmt.Errorf("%q: %w", key, os.ErrExist)
+		}
+		return err
+	}
+	return nil
+}
+
+// deleteObject deletes the object with the given key.
+func (c *Client) deleteObject(ctx context.Context, key string) error {
+	_, err := c.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// encode returns leaf data d in the form in which it's stored, i.e. compressed
+// and then encrypted, if the client is configured to do either.
+func (c *Client) encode(ctx context.Context, d []byte) ([]byte, error) {
+	d, err := compress.Compress(c.compression, d)
+	if err != nil || c.encrypter == nil {
+		return d, err
+	}
+	return c.encrypter.Encrypt(ctx, d)
+}
+
+// decode returns the leaf data stored as d, reversing encode. Encrypted leaf
+// data is an error if the client isn't configured with an Encrypter, so that
+// the log's tree is never computed over ciphertext.
+func (c *Client) decode(ctx context.Context, d []byte) ([]byte, error) {
+	if c.encrypter != nil {
+		var err error
+		if d, err = c.encrypter.Decrypt(ctx, d); err != nil {
+			return nil, err
+		}
+	} else if api.IsEnvelope(d) {
+		return nil, errors.New("leaf data is encrypted, but no encryption key was given")
+	}
+	return c.decompress(d)
+}
+
+// leafEncoding returns the Content-Encoding of stored leaf data, which is
+// left unset if it's encrypted, since clients can only decompress it once
+// they've decrypted it.
+func (c *Client) leafEncoding() string {
+	if c.encrypter != nil {
+		return ""
+	}
+	return c.compression.ContentEncoding()
+}
+
+// decompress returns the decompressed contents of d, if the client is
+// configured to compress the log's contents, or d otherwise.
+func (c *Client) decompress(d []byte) ([]byte, error) {
+	if c.compression == compress.None {
+		return d, nil
+	}
+	return compress.Decompress(d)
+}
+
+// etag returns the ETag of the object with the given key, or an error wrapping
+// os.ErrNotExist if there is no such object.
+func (c *Client) etag(ctx context.Context, key string) (string, error) {
+	start := time.Now()
+	out, err := c.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	c.observeRead(key, 0, start, err)
+	if err != nil {
+		if isNotFound(err) {
+			return "", fmt.Errorf("%q: %w", key, os.ErrNotExist)
+		}
+		return "", fmt.Errorf("HeadObject(%q): %w", key, err)
+	}
+	return aws.ToString(out.ETag), nil
+}
+
+// observeRead reports a read of size bytes from the object with the given
+// key, which started at start, to the client's metrics, if any.
+func (c *Client) observeRead(key string, size int, start time.Time, err error) {
+	if c.metrics == nil {
+		return
+	}
+	if isNotFound(err) {
+		err = fmt.Errorf("%q: %w: %v", key, os.ErrNotExist, err)
+	}
+	c.metrics.ObjectRead(key, size, time.Since(start), err)
+}
+
+// observeWrite reports a write of size bytes to the object with the given key,
+// which started at start, to the client's metrics, if any.
+func (c *Client) observeWrite(key string, size int, start time.Time, err error) {
+	if c.metrics == nil {
+		return
+	}
+	if isPreconditionFailed(err) {
+		c.metrics.PreconditionFailed(key)
+	}
+	c.metrics.ObjectWritten(key, size, time.Since(start), err)
+}
+
+// preconditionFailed reports a write to the object with the given key which
+// was not attempted because its precondition did not hold.
+func (c *Client) preconditionFailed(key string) {
+	if c.metrics != nil {
+		c.metrics.PreconditionFailed(key)
+	}
+}
+
+// objectKey returns the object key for the directory and file returned by the
+// layout path functions.
+func objectKey(dir, file string) string {
+	return filepath.ToSlash(filepath.Join(dir, file))
+}
+
+// isNotFound returns true if err indicates that the requested object or bucket
+// does not exist.
+func isNotFound(err error) bool {
+	var nsk *types.NoSuchKey
+	var nf *types.NotFound
+	var nsb *types.NoSuchBucket
+	return errors.As(err, &nsk) || errors.As(err, &nf) || errors.As(err, &nsb) || httpStatus(err) == http.StatusNotFound
+}
+
+// isPreconditionFailed returns true if err indicates that a conditional write
+// failed because its precondition did not hold. Concurrent conditional writes
+// to the same object may also fail with a conflict.
+func isPreconditionFailed(err error) bool {
+	s := httpStatus(err)
+	return s == http.StatusPreconditionFailed || s == http.StatusConflict
+}
+
+// httpStatus returns the HTTP status code of the response which caused err, or
+// 0 if there is none.
+func httpStatus(err error) int {
+	var re *awshttp.ResponseError
+	if errors.As(err, &re) {
+		return re.HTTPStatusCode()
+	}
+	return 0
+}
@@ -194,22 +194,16 @@ func Sequence(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// ask storage to sequence
-		lh := h.HashLeaf(bytes)
-		dupe := false
-		seq, err := client.Sequence(ctx, lh, bytes)
+		res, err := log.Add(ctx, client, h, bytes)
 		if err != nil {
-			if errors.Is(err, log.ErrDupeLeaf) {
-				dupe = true
-			} else {
-				http.Error(w,
-					fmt.Sprintf("Failed to sequence %q: %q", attrs.Name, err),
-					http.StatusInternalServerError)
-				return
-			}
+			http.Error(w,
+				fmt.Sprintf("Failed to sequence %q: %q", attrs.Name, err),
+				http.StatusInternalServerError)
+			return
 		}
 
-		l := fmt.Sprintf("Sequence num %d assigned to %s", seq, attrs.Name)
-		if dupe {
+		l := fmt.Sprintf("Sequence num %d assigned to %s", res.Index, attrs.Name)
+		if res.Duplicate {
 			l += " (dupe)"
 		}
 		fmt.Println(l)
@@ -337,6 +331,14 @@ func Integrate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = signAndWrite(ctx, newCp, cpNote, noteSigner, client, d.Origin)
+	if errors.Is(err, storage.ErrConflict) {
+		// Another integration updated the checkpoint first, the caller may
+		// retry the request to integrate from the new checkpoint.
+		http.Error(w,
+			fmt.Sprintf("Checkpoint was updated concurrently: %q", err),
+			http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w,
 			fmt.Sprintf("Failed to sign: %q", err),
@@ -36,6 +36,11 @@ import (
 	gcs "cloud.google.com/go/storage"
 )
 
+// ErrConflict is returned when a write is refused because another writer, e.g.
+// a concurrent integration, modified the log first. The operation may be
+// retried from the start, after re-reading the log's checkpoint.
+var ErrConflict = errors.New("conflicting concurrent write")
+
 // Client is a serverless storage implementation which uses a GCS bucket to store tree state.
 // The naming of the objects of the GCS object is:
 //
@@ -147,7 +152,7 @@ func (c *Client) SetNextSeq(num uint64) {
 //
 // This method will fail to write if 1) the checkpoint exists and the client
 // has never read it or 2) the checkpoint has been updated since the client
-// called ReadCheckpoint.
+// called ReadCheckpoint. In either case, the returned error wraps ErrConflict.
 func (c *Client) WriteCheckpoint(ctx context.Context, newCPRaw []byte) error {
 	bkt := c.gcsClient.Bucket(c.bucket)
 	obj := bkt.Object(layout.CheckpointPath)
@@ -166,7 +171,15 @@ func (c *Client) WriteCheckpoint(ctx context.Context, newCPRaw []byte) error {
 	if _, err := w.Write(newCPRaw); err != nil {
 		return err
 	}
-	return w.Close()
+	if err := w.Close(); err != nil {
+		var e *googleapi.Error
+		if errors.As(err, &e) && e.Code == http.StatusPreconditionFailed {
+			return fmt.Errorf("%w: checkpoint has been modified since it was read: %v", ErrConflict, err)
+		}
+		return err
+	}
+	c.checkpointGen = w.Attrs().Generation
+	return nil
 }
 
 // ReadCheckpoint reads from GCS and returns the contents of the log checkpoint.
@@ -174,21 +187,21 @@ func (c *Client) ReadCheckpoint(ctx context.Context) ([]byte, error) {
 	bkt := c.gcsClient.Bucket(c.bucket)
 	obj := bkt.Object(layout.CheckpointPath)
 
-	// Get the GCS generation number.
-	attrs, err := obj.Attrs(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("Object(%q).Attrs: %w", obj, err)
-	}
-	c.checkpointGen = attrs.Generation
-
-	// Get the content of the checkpoint.
+	// Get the content of the checkpoint, along with its GCS generation number.
+	// The generation is taken from the reader, rather than looked up
+	// separately, so that it is always that of the checkpoint returned.
 	r, err := obj.NewReader(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer r.Close()
 
-	return io.ReadAll(r)
+	cp, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	c.checkpointGen = r.Attrs.Generation
+	return cp, nil
 }
 
 // GetTile returns the tile at the given tile-level and tile-index.
@@ -375,7 +388,7 @@ func (c *Client) Sequence(ctx context.Context, leafhash []byte, leaf []byte) (ui
 		// would be permitted.
 		wLeaf := bkt.Object(leafPath).NewWriter(ctx)
 		if c.otherCacheControl != "" {
-			w.ObjectAttrs.CacheControl = c.otherCacheControl
+			wLeaf.ObjectAttrs.CacheControl = c.otherCacheControl
 		}
 		if _, err := wLeaf.Write([]byte(strconv.FormatUint(seq, 16))); err != nil {
 			return 0, fmt.Errorf("couldn't create leafhash object: %w", err)
@@ -444,23 +457,18 @@ func (c *Client) StoreTile(ctx context.Context, level, index uint64, tile *api.T
 	}
 
 	if err := w.Close(); err != nil {
-		switch ee := err.(type) {
-		case *googleapi.Error:
-			// If we run into a precondition failure error, check that the object
-			// which exists contains the same content that we want to write.
-			if ee.Code == http.StatusPreconditionFailed {
-				if equal, err := c.assertContent(ctx, tPath, t); err != nil {
-					return fmt.Errorf("failed to read content of %q: %w", tPath, err)
-				} else if !equal {
-					return fmt.Errorf("assertion that tile content for %q has not changed failed", tPath)
-				}
-
-				klog.V(2).Infof("StoreTile: identical tile already exists for level %d index %x ts: %x", level, index, tileSize)
-				return nil
-			}
-		default:
+		// If we run into a precondition failure error, check that the object
+		// which exists contains the same content that we want to write.
+		var ee *googleapi.Error
+		if !errors.As(err, &ee) || ee.Code != http.StatusPreconditionFailed {
 			return err
 		}
+		if equal, err := c.assertContent(ctx, tPath, t); err != nil {
+			return fmt.Errorf("failed to read content of %q: %w", tPath, err)
+		} else if !equal {
+			return fmt.Errorf("assertion that tile content for %q has not changed failed", tPath)
+		}
+		klog.V(2).Infof("StoreTile: identical tile already exists for level %d index %x ts: %x", level, index, tileSize)
 	}
 
 	return nil
@@ -0,0 +1,145 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for integrating sequenced entries
+// into a serverless log stored in a SQLite database.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/experimental/sqlite-log/storage"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"golang.org/x/mod/sumdb/note"
+	"k8s.io/klog/v2"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+var (
+	dbPath      = flag.String("db", "", "Path of the SQLite database holding the log.")
+	initialise  = flag.Bool("initialise", false, "Set when creating a new log to create the database and initialise the structure.")
+	pubKeyFile  = flag.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	privKeyFile = flag.String("private_key", "", "Location of private key file. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+	origin      = flag.String("origin", "", "Log origin string to use in produced checkpoint.")
+	hashFunc    = flag.String("hash", client.HashSHA256, "Hash function to use for the log's Merkle tree, one of sha256 or sha512_256.")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+	ctx := context.Background()
+
+	if len(*origin) == 0 {
+		klog.Exitf("Please set --origin flag to log identifier.")
+	}
+
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		klog.Exitf("Invalid --hash: %v", err)
+	}
+	pubKey, err := getKey(*pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		klog.Exitf("Unable to get public key: %q", err)
+	}
+	privKey, err := getKey(*privKeyFile, "SERVERLESS_LOG_PRIVATE_KEY")
+	if err != nil {
+		klog.Exitf("Unable to get private key: %q", err)
+	}
+	s, err := note.NewSigner(privKey)
+	if err != nil {
+		klog.Exitf("Failed to instantiate signer: %q", err)
+	}
+
+	if *initialise {
+		st, err := storage.Create(*dbPath)
+		if err != nil {
+			klog.Exitf("Failed to create log: %q", err)
+		}
+		defer st.Close()
+		cp := fmtlog.Checkpoint{
+			Hash: h.EmptyRoot(),
+		}
+		if err := signAndWrite(ctx, &cp, s, st); err != nil {
+			klog.Exitf("Failed to sign: %q", err)
+		}
+		return
+	}
+
+	st, err := storage.Load(*dbPath, 0)
+	if err != nil {
+		klog.Exitf("Failed to load storage: %q", err)
+	}
+	defer st.Close()
+	cpRaw, err := st.ReadCheckpoint(ctx)
+	if err != nil {
+		klog.Exitf("Failed to read log checkpoint: %q", err)
+	}
+
+	// Check signatures
+	v, err := note.NewVerifier(pubKey)
+	if err != nil {
+		klog.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+	cp, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		klog.Exitf("Failed to open Checkpoint: %q", err)
+	}
+
+	// Integrate new entries
+	newCp, err := log.Integrate(ctx, cp.Size, st, h)
+	if err != nil {
+		klog.Exitf("Failed to integrate: %q", err)
+	}
+	if newCp == nil {
+		klog.Exit("Nothing to integrate")
+	}
+
+	if err := signAndWrite(ctx, newCp, s, st); err != nil {
+		klog.Exitf("Failed to sign: %q", err)
+	}
+}
+
+// getKey returns the contents of the file at path, or of the named environment
+// variable if path is empty.
+func getKey(path, env string) (string, error) {
+	if len(path) > 0 {
+		k, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read key file: %w", err)
+		}
+		return string(k), nil
+	}
+	k := os.Getenv(env)
+	if len(k) == 0 {
+		return "", fmt.Errorf("supply key file path using flags or set %s environment variable", env)
+	}
+	return k, nil
+}
+
+func signAndWrite(ctx context.Context, cp *fmtlog.Checkpoint, s note.Signer, st *storage.Storage) error {
+	cp.Origin = *origin
+	cpNoteSigned, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, s)
+	if err != nil {
+		return fmt.Errorf("failed to sign Checkpoint: %w", err)
+	}
+	if err := st.WriteCheckpoint(ctx, cpNoteSigned); err != nil {
+		return fmt.Errorf("failed to store new log checkpoint: %w", err)
+	}
+	return nil
+}
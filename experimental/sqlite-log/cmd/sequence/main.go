@@ -0,0 +1,115 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for sequencing entries in a
+// serverless log stored in a SQLite database.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/experimental/sqlite-log/storage"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"golang.org/x/mod/sumdb/note"
+	"k8s.io/klog/v2"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+var (
+	dbPath     = flag.String("db", "", "Path of the SQLite database holding the log.")
+	entries    = flag.String("entries", "", "File path glob of entries to add to the log.")
+	pubKeyFile = flag.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin     = flag.String("origin", "", "Log origin string to check for in checkpoint.")
+	hashFunc   = flag.String("hash", client.HashSHA256, "Hash function used for the log's Merkle tree, one of sha256 or sha512_256.")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+	ctx := context.Background()
+
+	// Read log public key from file or environment variable
+	var pubKey string
+	if len(*pubKeyFile) > 0 {
+		k, err := os.ReadFile(*pubKeyFile)
+		if err != nil {
+			klog.Exitf("failed to read public_key file: %q", err)
+		}
+		pubKey = string(k)
+	} else {
+		pubKey = os.Getenv("SERVERLESS_LOG_PUBLIC_KEY")
+		if len(pubKey) == 0 {
+			klog.Exit("supply public key file path using --public_key or set SERVERLESS_LOG_PUBLIC_KEY environment variable")
+		}
+	}
+
+	toAdd, err := filepath.Glob(*entries)
+	if err != nil {
+		klog.Exitf("Failed to glob entries %q: %q", *entries, err)
+	}
+	if len(toAdd) == 0 {
+		klog.Exit("Sequence must be run with at least one valid entry")
+	}
+
+	h, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		klog.Exitf("Invalid --hash: %v", err)
+	}
+
+	// init storage
+	// The SQLite storage finds the next free sequence number itself, so there
+	// is no need to load it with the checkpoint size.
+	st, err := storage.Load(*dbPath, 0)
+	if err != nil {
+		klog.Exitf("Failed to load storage: %q", err)
+	}
+	defer st.Close()
+	cpRaw, err := st.ReadCheckpoint(ctx)
+	if err != nil {
+		klog.Exitf("Failed to read log checkpoint: %q", err)
+	}
+
+	// Check signatures
+	v, err := note.NewVerifier(pubKey)
+	if err != nil {
+		klog.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+	if _, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v); err != nil {
+		klog.Exitf("Failed to parse Checkpoint: %q", err)
+	}
+
+	// sequence entries
+	for _, fp := range toAdd {
+		b, err := os.ReadFile(fp)
+		if err != nil {
+			klog.Exitf("Failed to read entry file %q: %q", fp, err)
+		}
+		// ask storage to sequence
+		r, err := log.Add(ctx, st, h, b)
+		if err != nil {
+			klog.Exitf("failed to sequence %q: %q", fp, err)
+		}
+		l := fmt.Sprintf("%d: %v", r.Index, fp)
+		if r.Duplicate {
+			l += " (dupe)"
+		}
+		klog.Info(l)
+	}
+}
@@ -0,0 +1,22 @@
+module github.com/transparency-dev/serverless-log/experimental/sqlite-log
+
+go 1.22
+
+replace github.com/transparency-dev/serverless-log => ../../
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/transparency-dev/formats v0.0.0-20230914071414-5732692f1e50
+	github.com/transparency-dev/merkle v0.0.2
+	github.com/transparency-dev/serverless-log v0.0.0-00010101000000-000000000000
+	golang.org/x/mod v0.17.0
+	k8s.io/klog/v2 v2.120.1
+)
+
+require (
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/time v0.5.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,352 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storage provides a log storage implementation which keeps the whole
+// log in a single SQLite database file.
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"k8s.io/klog/v2"
+
+	// Register the sqlite3 database/sql driver.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// schema creates the tables holding the log's state.
+//
+// Tiles are keyed by their level, index, and width, where width is 0 for full
+// tiles, as in the serverless layout's tile paths.
+const schema = `
+CREATE TABLE checkpoint (id INTEGER PRIMARY KEY CHECK (id = 0), data BLOB NOT NULL);
+CREATE TABLE seq (seq INTEGER PRIMARY KEY, data BLOB NOT NULL);
+CREATE TABLE leaves (hash BLOB PRIMARY KEY, seq INTEGER NOT NULL);
+CREATE TABLE tiles (level INTEGER, idx INTEGER, width INTEGER, data BLOB NOT NULL, PRIMARY KEY (level, idx, width));
+`
+
+// Storage is a serverless storage implementation which stores tree state in a
+// SQLite database. This avoids managing the large numbers of small files used
+// by the fs storage, e.g. for embedded deployments, tests, and small private
+// logs.
+//
+// Sequencing a leaf is a single transaction, so unlike the fs storage, leaves
+// are never assigned a sequence number without also being recorded in the
+// leaf hash index.
+//
+// The functions on this struct are not thread-safe.
+type Storage struct {
+	db *sql.DB
+	// nextSeq is a hint to the Sequence func as to what the next available
+	// sequence number is to help performance.
+	// Note that nextSeq may be <= than the actual next available number, but
+	// never greater.
+	nextSeq uint64
+}
+
+var _ log.LeafIndexer = &Storage{}
+
+// Load returns a Storage instance backed by the existing database at path.
+// cpSize should be the Size of the checkpoint produced from the last `log.Integrate` call.
+func Load(path string, cpSize uint64) (*Storage, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to stat %q: %w", path, err)
+	}
+	db, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{
+		db:      db,
+		nextSeq: cpSize,
+	}, nil
+}
+
+// Create creates a new database at path and returns a Storage representation for it.
+func Create(path string) (*Storage, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("%q %w", path, os.ErrExist)
+	}
+	db, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+	return &Storage{db: db}, nil
+}
+
+// open opens the database at path. Write transactions take the database lock
+// up front, so that concurrent sequencers wait for one another rather than
+// failing part way through.
+func open(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_txlock=immediate&_busy_timeout=5000&_journal_mode=WAL", path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	return db, nil
+}
+
+// Close closes the underlying database.
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// Sequence assigns the given leaf entry to the next available sequence number.
+// Returns the sequence number assigned to this leaf (if the leaf has already
+// been sequenced it will return the original sequence number and ErrDupeLeaf).
+func (s *Storage) Sequence(ctx context.Context, leafhash []byte, leaf []byte) (uint64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			klog.Errorf("Rollback: %v", err)
+		}
+	}()
+
+	// Check for dupe leaf already present.
+	origSeq, err := leafIndex(ctx, tx, leafhash)
+	if err == nil {
+		return origSeq, log.ErrDupeLeaf
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	// Now sequence it, skipping over any entries sequenced since nextSeq was
+	// last updated.
+	var maxSeq sql.NullInt64
+	if err := tx.QueryRowContext(ctx, "SELECT MAX(seq) FROM seq WHERE seq >= ?", s.nextSeq).Scan(&maxSeq); err != nil {
+		return 0, fmt.Errorf("failed to find next sequence number: %w", err)
+	}
+	if maxSeq.Valid {
+		s.nextSeq = uint64(maxSeq.Int64) + 1
+	}
+	seq := s.nextSeq
+	if _, err := tx.ExecContext(ctx, "INSERT INTO seq (seq, data) VALUES (?, ?)", seq, leaf); err != nil {
+		return 0, fmt.Errorf("failed to insert leaf: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO leaves (hash, seq) VALUES (?, ?)", leafhash, seq); err != nil {
+		return 0, fmt.Errorf("failed to insert leaf hash: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit: %w", err)
+	}
+	s.nextSeq++
+	return seq, nil
+}
+
+// LeafIndex returns the sequence number of the entry with the given leaf hash,
+// or an error wrapping os.ErrNotExist if there is no such entry.
+func (s *Storage) LeafIndex(ctx context.Context, leafhash []byte) (uint64, error) {
+	return leafIndex(ctx, s.db, leafhash)
+}
+
+// IndexLeaf records that the entry with the given leaf hash was sequenced at
+// seq, unless the leaf hash is already indexed.
+func (s *Storage) IndexLeaf(ctx context.Context, leafhash []byte, seq uint64) error {
+	if _, err := s.db.ExecContext(ctx, "INSERT OR IGNORE INTO leaves (hash, seq) VALUES (?, ?)", leafhash, seq); err != nil {
+		return fmt.Errorf("failed to insert leaf hash: %w", err)
+	}
+	return nil
+}
+
+// leafIndex looks up the sequence number of the entry with the given leaf hash
+// using q, which may be the database or a transaction.
+func leafIndex(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, leafhash []byte) (uint64, error) {
+	var seq uint64
+	err := q.QueryRowContext(ctx, "SELECT seq FROM leaves WHERE hash = ?", leafhash).Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("leaf hash %x: %w", leafhash, os.ErrNotExist)
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to look up leaf hash: %w", err)
+	}
+	return seq, nil
+}
+
+// Assign directly associates the given leaf data with the provided sequence number.
+// It is an error to attempt to assign data to a previously assigned sequence number,
+// even if the data is identical.
+func (s *Storage) Assign(ctx context.Context, seq uint64, leaf []byte) error {
+	res, err := s.db.ExecContext(ctx, "INSERT OR IGNORE INTO seq (seq, data) VALUES (?, ?)", seq, leaf)
+	if err != nil {
+		return fmt.Errorf("failed to insert leaf: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return log.ErrSeqAlreadyAssigned
+	}
+	return nil
+}
+
+// ScanSequenced calls the provided function once for each contiguous entry
+// in storage starting at begin.
+// The scan will abort if the function returns an error, otherwise it will
+// return the number of sequenced entries.
+func (s *Storage) ScanSequenced(ctx context.Context, begin uint64, f func(seq uint64, entry []byte) error) (uint64, error) {
+	// Read all entries up front, so that f is free to write to the database.
+	rows, err := s.db.QueryContext(ctx, "SELECT seq, data FROM seq WHERE seq >= ? ORDER BY seq", begin)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query sequenced entries: %w", err)
+	}
+	var entries [][]byte
+	for end := begin; rows.Next(); end++ {
+		var seq uint64
+		var entry []byte
+		if err := rows.Scan(&seq, &entry); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to read leafdata at index %d: %w", end, err)
+		}
+		if seq != end {
+			// Only scan contiguous entries.
+			break
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read sequenced entries: %w", err)
+	}
+
+	for i, e := range entries {
+		if err := f(begin+uint64(i), e); err != nil {
+			return uint64(i), err
+		}
+	}
+	return uint64(len(entries)), nil
+}
+
+// GetTile returns the tile at the given tile-level and tile-index.
+// If no complete tile exists at that location, it will attempt to find a
+// partial tile for the given tree size at that location.
+func (s *Storage) GetTile(ctx context.Context, level, index, logSize uint64) (*api.Tile, error) {
+	t, err := s.tileData(ctx, level, index, layout.PartialTileSize(level, index, logSize))
+	if err != nil {
+		return nil, err
+	}
+	var tile api.Tile
+	if err := tile.UnmarshalText(t); err != nil {
+		return nil, fmt.Errorf("failed to parse tile: %w", err)
+	}
+	return &tile, nil
+}
+
+// tileData returns the serialised tile at the given level and index with the
+// given width, where 0 means a full tile. If no tile of the requested partial
+// width is stored, the full tile is returned if present, since it holds all of
+// the nodes of the partial tile.
+func (s *Storage) tileData(ctx context.Context, level, index, width uint64) ([]byte, error) {
+	var t []byte
+	err := s.db.QueryRowContext(ctx, "SELECT data FROM tiles WHERE level = ? AND idx = ? AND width IN (?, 0) ORDER BY width DESC LIMIT 1", level, index, width).Scan(&t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read tile %d/%d: %w", level, index, err)
+	}
+	return t, nil
+}
+
+// StoreTile writes a tile to the database.
+// Fully populated tiles are stored with width 0, partially populated (i.e.
+// right-hand edge) tiles with their number of "tile leaves".
+func (s *Storage) StoreTile(ctx context.Context, level, index uint64, tile *api.Tile) error {
+	tileSize := uint64(tile.NumLeaves)
+	klog.V(2).Infof("StoreTile: level %d index %x ts: %x", level, index, tileSize)
+	if tileSize == 0 || tileSize > 256 {
+		return fmt.Errorf("tileSize %d must be > 0 and <= 256", tileSize)
+	}
+	t, err := tile.MarshalText()
+	if err != nil {
+		return fmt.Errorf("failed to marshal tile: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "INSERT OR REPLACE INTO tiles (level, idx, width, data) VALUES (?, ?, ?, ?)", level, index, tileSize%256, t); err != nil {
+		return fmt.Errorf("failed to store tile: %w", err)
+	}
+	return nil
+}
+
+// WriteCheckpoint stores a raw log checkpoint in the database.
+func (s *Storage) WriteCheckpoint(ctx context.Context, newCPRaw []byte) error {
+	if _, err := s.db.ExecContext(ctx, "INSERT OR REPLACE INTO checkpoint (id, data) VALUES (0, ?)", newCPRaw); err != nil {
+		return fmt.Errorf("failed to store checkpoint: %w", err)
+	}
+	return nil
+}
+
+// ReadCheckpoint returns the contents of the log checkpoint.
+func (s *Storage) ReadCheckpoint(ctx context.Context) ([]byte, error) {
+	var cp []byte
+	err := s.db.QueryRowContext(ctx, "SELECT data FROM checkpoint WHERE id = 0").Scan(&cp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+// Fetch returns the resource stored at the given path of the serverless layout,
+// and so can be used as a client.Fetcher, e.g. to serve the log over HTTP or to
+// read it with the client package directly.
+//
+// Returns an error wrapping os.ErrNotExist if there is no such resource.
+func (s *Storage) Fetch(ctx context.Context, path string) ([]byte, error) {
+	r, err := layout.ServerlessScheme{}.ParsePath(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, os.ErrNotExist)
+	}
+	switch r.Kind {
+	case layout.CheckpointResource:
+		return s.ReadCheckpoint(ctx)
+	case layout.TileResource:
+		return s.tileData(ctx, r.Level, r.Index, r.PartialWidth)
+	case layout.EntriesResource:
+		var leaf []byte
+		err := s.db.QueryRowContext(ctx, "SELECT data FROM seq WHERE seq = ?", r.Index).Scan(&leaf)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, os.ErrNotExist
+		}
+		return leaf, err
+	case layout.LeafIndexResource:
+		var seq uint64
+		err := s.db.QueryRowContext(ctx, "SELECT seq FROM leaves WHERE hash = ?", r.LeafHash).Scan(&seq)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, os.ErrNotExist
+		} else if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatUint(seq, 16)), nil
+	}
+	return nil, fmt.Errorf("%q: %w", path, os.ErrNotExist)
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+)
+
+func newStorage(t *testing.T) (*Storage, string) {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "log.db")
+	s, err := Create(p)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, p
+}
+
+func TestCreateExisting(t *testing.T) {
+	_, p := newStorage(t)
+	if _, err := Create(p); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("Create = %v, want already exists error", err)
+	}
+}
+
+func TestLoadNonExistent(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "log.db"), 0); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Load = %v, want not exists error", err)
+	}
+}
+
+func TestWriteReadCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	s, p := newStorage(t)
+	if _, err := s.ReadCheckpoint(ctx); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("ReadCheckpoint = %v, want not exists error", err)
+	}
+	for _, cp := range [][]byte{[]byte("hello"), []byte("goodbye")} {
+		if err := s.WriteCheckpoint(ctx, cp); err != nil {
+			t.Fatalf("WriteCheckpoint = %v", err)
+		}
+	}
+	s.Close()
+
+	s, err := Load(p, 0)
+	if err != nil {
+		t.Fatalf("Load = %v", err)
+	}
+	defer s.Close()
+	got, err := s.ReadCheckpoint(ctx)
+	if err != nil {
+		t.Fatalf("ReadCheckpoint = %v", err)
+	}
+	if want := []byte("goodbye"); !bytes.Equal(got, want) {
+		t.Errorf("ReadCheckpoint = %q, want %q", got, want)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newStorage(t)
+	h := rfc6962.DefaultHasher
+
+	for _, test := range []struct {
+		leaf    string
+		wantSeq uint64
+		wantErr error
+	}{
+		{leaf: "a", wantSeq: 0},
+		{leaf: "b", wantSeq: 1},
+		{leaf: "a", wantSeq: 0, wantErr: log.ErrDupeLeaf},
+		{leaf: "c", wantSeq: 2},
+	} {
+		gotSeq, err := s.Sequence(ctx, h.HashLeaf([]byte(test.leaf)), []byte(test.leaf))
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("Sequence(%q) = %v, want %v", test.leaf, err, test.wantErr)
+		}
+		if gotSeq != test.wantSeq {
+			t.Errorf("Sequence(%q) = %d, want %d", test.leaf, gotSeq, test.wantSeq)
+		}
+	}
+
+	// A stale nextSeq hint must not cause sequence numbers to be reused.
+	s.nextSeq = 0
+	if gotSeq, err := s.Sequence(ctx, h.HashLeaf([]byte("d")), []byte("d")); err != nil || gotSeq != 3 {
+		t.Errorf("Sequence(d) = %d, %v, want 3", gotSeq, err)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newStorage(t)
+	if err := s.Assign(ctx, 1, []byte("one")); err != nil {
+		t.Fatalf("Assign(1) = %v", err)
+	}
+	if err := s.Assign(ctx, 1, []byte("one")); !errors.Is(err, log.ErrSeqAlreadyAssigned) {
+		t.Fatalf("Assign(1) again = %v, want %v", err, log.ErrSeqAlreadyAssigned)
+	}
+	if err := s.Assign(ctx, 0, []byte("zero")); err != nil {
+		t.Fatalf("Assign(0) = %v", err)
+	}
+	var got []string
+	n, err := s.ScanSequenced(ctx, 0, func(seq uint64, entry []byte) error {
+		got = append(got, fmt.Sprintf("%d:%s", seq, entry))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ScanSequenced = %v", err)
+	}
+	if n != 2 || fmt.Sprint(got) != "[0:zero 1:one]" {
+		t.Errorf("ScanSequenced = %d, %q", n, got)
+	}
+}
+
+func TestScanSequencedStopsAtGap(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newStorage(t)
+	for _, seq := range []uint64{3, 4, 6} {
+		if err := s.Assign(ctx, seq, []byte{byte(seq)}); err != nil {
+			t.Fatalf("Assign(%d) = %v", seq, err)
+		}
+	}
+	n, err := s.ScanSequenced(ctx, 3, func(uint64, []byte) error { return nil })
+	if err != nil || n != 2 {
+		t.Errorf("ScanSequenced(3) = %d, %v, want 2", n, err)
+	}
+	n, err = s.ScanSequenced(ctx, 0, func(uint64, []byte) error { return nil })
+	if err != nil || n != 0 {
+		t.Errorf("ScanSequenced(0) = %d, %v, want 0", n, err)
+	}
+}
+
+func TestIntegrateIndexesAssignedLeaves(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newStorage(t)
+	h := rfc6962.DefaultHasher
+	leaf := []byte("assigned")
+	lh := h.HashLeaf(leaf)
+
+	if err := s.Assign(ctx, 0, leaf); err != nil {
+		t.Fatalf("Assign = %v", err)
+	}
+	if _, err := s.LeafIndex(ctx, lh); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("LeafIndex before Integrate = %v, want not exists error", err)
+	}
+	if _, err := log.Integrate(ctx, 0, s, h); err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+	if idx, err := s.LeafIndex(ctx, lh); err != nil || idx != 0 {
+		t.Errorf("LeafIndex after Integrate = %d, %v, want 0", idx, err)
+	}
+	if seq, err := s.Sequence(ctx, lh, leaf); !errors.Is(err, log.ErrDupeLeaf) || seq != 0 {
+		t.Errorf("Sequence = %d, %v, want 0, %v", seq, err, log.ErrDupeLeaf)
+	}
+}
+
+func TestIntegrateAndFetch(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newStorage(t)
+	h := rfc6962.DefaultHasher
+
+	var size uint64
+	for _, n := range []int{3, 300, 1} {
+		for i := 0; i < n; i++ {
+			leaf := []byte(fmt.Sprintf("leaf %d", size+uint64(i)))
+			if _, err := s.Sequence(ctx, h.HashLeaf(leaf), leaf); err != nil {
+				t.Fatalf("Sequence = %v", err)
+			}
+		}
+		cp, err := log.Integrate(ctx, size, s, h)
+		if err != nil {
+			t.Fatalf("Integrate = %v", err)
+		}
+		size = cp.Size
+
+		pb, err := client.NewProofBuilder(ctx, *cp, h.HashChildren, s.Fetch)
+		if err != nil {
+			t.Fatalf("NewProofBuilder = %v", err)
+		}
+		for _, i := range []uint64{0, size / 2, size - 1} {
+			leaf, err := client.GetLeaf(ctx, s.Fetch, i)
+			if err != nil {
+				t.Fatalf("GetLeaf(%d) = %v", i, err)
+			}
+			p, err := pb.InclusionProof(ctx, i)
+			if err != nil {
+				t.Fatalf("InclusionProof(%d) = %v", i, err)
+			}
+			if err := proof.VerifyInclusion(h, i, size, h.HashLeaf(leaf), p, cp.Hash); err != nil {
+				t.Errorf("VerifyInclusion(%d) = %v", i, err)
+			}
+			idx, err := client.LookupIndex(ctx, s.Fetch, h.HashLeaf(leaf))
+			if err != nil || idx != i {
+				t.Errorf("LookupIndex(%d) = %d, %v", i, idx, err)
+			}
+		}
+	}
+
+	if _, err := s.Fetch(ctx, "banana"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Fetch(banana) = %v, want not exists error", err)
+	}
+}
@@ -174,18 +174,13 @@ func sequence() js.Func {
 				logMsg(err.Error())
 				return nil
 			}
-			h := rfc6962.DefaultHasher.HashLeaf(l)
-			isDupe := false
-			seq, err := logStorage.Sequence(context.Background(), h, l)
+			r, err := log.Add(context.Background(), logStorage, rfc6962.DefaultHasher, l)
 			if err != nil {
-				if !errors.Is(err, log.ErrDupeLeaf) {
-					logMsg(err.Error())
-					return nil
-				}
-				isDupe = true
+				logMsg(err.Error())
+				return nil
 			}
-			s := fmt.Sprintf("index %d: %q", seq, l)
-			if isDupe {
+			s := fmt.Sprintf("index %d: %q", r.Index, l)
+			if r.Duplicate {
 				s += " (dupe)"
 			}
 			logMsg(s)
@@ -5,15 +5,21 @@ go 1.21
 require (
 	github.com/gdamore/tcell/v2 v2.7.4
 	github.com/google/go-cmp v0.6.0
+	github.com/klauspost/compress v1.17.8
+	github.com/miekg/pkcs11 v1.1.2
 	github.com/rivo/tview v0.0.0-20240413115534-b0d41c484b95
 	github.com/transparency-dev/formats v0.0.0-20230914071414-5732692f1e50
 	github.com/transparency-dev/merkle v0.0.2
 	golang.org/x/mod v0.17.0
+	golang.org/x/oauth2 v0.21.0
 	golang.org/x/sync v0.7.0
+	golang.org/x/time v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
 	k8s.io/klog/v2 v2.120.1
 )
 
 require (
+	cloud.google.com/go/compute/metadata v0.3.0 // indirect
 	github.com/gdamore/encoding v1.0.0 // indirect
 	github.com/go-logr/logr v1.4.1 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
@@ -15,18 +15,15 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"io"
 	"math/rand"
-	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
-	"strconv"
 
 	"github.com/transparency-dev/serverless-log/api/layout"
 	"github.com/transparency-dev/serverless-log/client"
@@ -36,13 +33,15 @@ import (
 // NewLeafReader creates a LeafReader.
 // The next function provides a strategy for which leaves will be read.
 // Custom implementations can be passed, or use RandomNextLeaf or MonotonicallyIncreasingNextLeaf.
-func NewLeafReader(tracker *client.LogStateTracker, f client.Fetcher, next func(uint64) uint64, bundleSize int, throttle <-chan bool, errchan chan<- error) *LeafReader {
+// If fs is non-nil, it is used in place of f to stream leaf bundles from the log.
+func NewLeafReader(tracker *client.LogStateTracker, f client.Fetcher, fs client.FetcherStream, next func(uint64) uint64, bundleSize int, throttle <-chan bool, errchan chan<- error) *LeafReader {
 	if bundleSize <= 0 {
 		panic("bundleSize must be > 0")
 	}
 	return &LeafReader{
 		tracker:    tracker,
 		f:          f,
+		fs:         fs,
 		next:       next,
 		bundleSize: bundleSize,
 		throttle:   throttle,
@@ -54,6 +53,7 @@ func NewLeafReader(tracker *client.LogStateTracker, f client.Fetcher, next func(
 type LeafReader struct {
 	tracker    *client.LogStateTracker
 	f          client.Fetcher
+	fs         client.FetcherStream
 	next       func(uint64) uint64
 	bundleSize int
 	throttle   <-chan bool
@@ -74,7 +74,7 @@ func (r *LeafReader) Run(ctx context.Context) {
 			return
 		case <-r.throttle:
 		}
-		size := r.tracker.LatestConsistent.Size
+		size := r.tracker.State().Checkpoint.Size
 		if size == 0 {
 			continue
 		}
@@ -99,6 +99,11 @@ func (r *LeafReader) getLeaf(ctx context.Context, i uint64, logSize uint64) ([]b
 		klog.V(2).Infof("Using cached result for index %d", i)
 		return cached, nil
 	}
+	if l := r.tracker.Layout; l != nil {
+		if _, ok := l.(client.ServerlessLayout); !ok {
+			return l.GetLeaf(ctx, r.f, i, logSize)
+		}
+	}
 	bi := i / uint64(r.bundleSize)
 	br := uint64(0)
 	// Check for partial leaf bundle
@@ -109,15 +114,22 @@ func (r *LeafReader) getLeaf(ctx context.Context, i uint64, logSize uint64) ([]b
 	if br > 0 {
 		p += fmt.Sprintf(".%d", br)
 	}
-	bRaw, err := r.f(ctx, p)
+	var bs [][]byte
+	var err error
+	if r.fs != nil {
+		bs, err = r.streamBundle(ctx, p)
+	} else {
+		var bRaw []byte
+		bRaw, err = r.f(ctx, p)
+		bs = bytes.Split(bytes.TrimSuffix(bRaw, []byte("\n")), []byte("\n"))
+	}
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil, fmt.Errorf("leaf index %d not found: %w", i, err)
 		}
 		return nil, fmt.Errorf("failed to fetch leaf index %d: %w", i, err)
 	}
-	bs := bytes.Split(bRaw, []byte("\n"))
-	if l := len(bs); uint64(l) <= br {
+	if l := len(bs); uint64(l) < br {
 		return nil, fmt.Errorf("huh, short leaf bundle with %d entries, want %d", l, br)
 	}
 	r.c = leafBundleCache{
@@ -128,6 +140,33 @@ func (r *LeafReader) getLeaf(ctx context.Context, i uint64, logSize uint64) ([]b
 	return r.c.get(i)
 }
 
+// streamBundle reads the leaf bundle at path p a line at a time, so that large
+// bundles don't need to be buffered in their entirety.
+func (r *LeafReader) streamBundle(ctx context.Context, p string) ([][]byte, error) {
+	rc, err := r.fs(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rc.Close(); err != nil {
+			klog.Errorf("Close(%q): %v", p, err)
+		}
+	}()
+	bs := make([][]byte, 0, r.bundleSize)
+	sc := bufio.NewScanner(rc)
+	sc.Buffer(make([]byte, 0, 64<<10), maxLeafLineSize)
+	for sc.Scan() {
+		bs = append(bs, bytes.Clone(sc.Bytes()))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read leaf bundle %q: %v", p, err)
+	}
+	return bs, nil
+}
+
+// maxLeafLineSize is the longest base64 encoded leaf which streamBundle will read.
+const maxLeafLineSize = 16 << 20
+
 // Kills this leaf reader at the next opportune moment.
 // This function may return before the reader is dead.
 func (r *LeafReader) Kill() {
@@ -175,12 +214,11 @@ func MonotonicallyIncreasingNextLeaf() func(uint64) uint64 {
 }
 
 // NewLogWriter creates a LogWriter.
-// u is the URL of the write endpoint for the log.
+// s is used to submit leaves to the log.
 // gen is a function that generates new leaves to add.
-func NewLogWriter(hc *http.Client, u *url.URL, gen func() []byte, throttle <-chan bool, errchan chan<- error) *LogWriter {
+func NewLogWriter(s *client.Submitter, gen func() []byte, throttle <-chan bool, errchan chan<- error) *LogWriter {
 	return &LogWriter{
-		hc:       hc,
-		u:        u,
+		s:        s,
 		gen:      gen,
 		throttle: throttle,
 		errchan:  errchan,
@@ -189,8 +227,7 @@ func NewLogWriter(hc *http.Client, u *url.URL, gen func() []byte, throttle <-cha
 
 // LogWriter writes new leaves to the log that are generated by `gen`.
 type LogWriter struct {
-	hc       *http.Client
-	u        *url.URL
+	s        *client.Submitter
 	gen      func() []byte
 	throttle <-chan bool
 	errchan  chan<- error
@@ -211,41 +248,13 @@ func (w *LogWriter) Run(ctx context.Context) {
 		}
 		newLeaf := w.gen()
 
-		req, err := http.NewRequest(http.MethodPost, w.u.String(), bytes.NewReader(newLeaf))
-		if err != nil {
-			w.errchan <- fmt.Errorf("failed to create request: %v", err)
-			continue
-		}
-		if len(*bearerToken) > 0 {
-			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", *bearerToken))
-		}
-		resp, err := hc.Do(req.WithContext(ctx))
+		r, err := w.s.Submit(ctx, newLeaf)
 		if err != nil {
 			w.errchan <- fmt.Errorf("failed to write leaf: %v", err)
 			continue
 		}
-		body, err := io.ReadAll(resp.Body)
-		_ = resp.Body.Close()
-		if err != nil {
-			w.errchan <- fmt.Errorf("failed to read body: %v", err)
-			continue
-		}
-		if resp.StatusCode != http.StatusOK {
-			w.errchan <- fmt.Errorf("write leaf was not OK. Status code: %d. Body: %q", resp.StatusCode, body)
-			continue
-		}
-		if resp.Request.Method != http.MethodPost {
-			w.errchan <- fmt.Errorf("write leaf was redirected to %s", resp.Request.URL)
-			continue
-		}
-		parts := bytes.Split(body, []byte("\n"))
-		index, err := strconv.Atoi(string(parts[0]))
-		if err != nil {
-			w.errchan <- fmt.Errorf("write leaf failed to parse response: %v", body)
-			continue
-		}
 
-		klog.V(2).Infof("Wrote leaf at index %d", index)
+		klog.V(2).Infof("Wrote leaf at index %d (duplicate: %t)", r.Index, r.Duplicate)
 	}
 }
 
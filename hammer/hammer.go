@@ -18,6 +18,8 @@ package main
 import (
 	"context"
 	crand "crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
@@ -32,7 +34,6 @@ import (
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
-	"github.com/transparency-dev/merkle/rfc6962"
 	"github.com/transparency-dev/serverless-log/client"
 	"golang.org/x/mod/sumdb/note"
 	"k8s.io/klog/v2"
@@ -48,6 +49,10 @@ var (
 	bearerToken   = flag.String("bearer_token", "", "The bearer token for auth. For GCP this is the result of `gcloud auth print-identity-token`")
 	logPubKeyFile = flag.String("log_public_key", "", "Location of log public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable")
 	origin        = flag.String("origin", "", "Expected first line of checkpoints from log")
+	hashFunc      = flag.String("hash", client.HashSHA256, "Hash function used by the log's Merkle tree, one of sha256 or sha512_256")
+	logLayout     = flag.String("layout", client.LayoutServerless, "Storage layout used by the log, one of serverless, tlog-tiles or static-ct. For static-ct logs, --log_public_key must hold the PEM encoded log key")
+	stateFile     = flag.String("state_file", "", "If set, the latest verified checkpoint is persisted to this file and used as the trusted state on restart")
+	witnessPolicy = flag.String("witness_policy", "", "If set, the location of a YAML witness policy file which checkpoints must satisfy before they are trusted")
 
 	maxReadOpsPerSecond = flag.Int("max_read_ops", 20, "The maximum number of read operations per second")
 	numReadersRandom    = flag.Int("num_readers_random", 4, "The number of readers looking for random leaves")
@@ -56,7 +61,7 @@ var (
 	maxWriteOpsPerSecond = flag.Int("max_write_ops", 0, "The maximum number of write operations per second")
 	numWriters           = flag.Int("num_writers", 0, "The number of independent write tasks to run")
 
-	leafBundleSize = flag.Int("leaf_bundle_size", 1, "The log-configured number of leaves in each leaf bundle")
+	leafBundleSize = flag.Int("leaf_bundle_size", 0, "The log-configured number of leaves in each leaf bundle. If unset, the bundle size recorded by the log is used")
 	leafMinSize    = flag.Int("leaf_min_size", 0, "Minimum size in bytes of individual leaves")
 
 	showUI = flag.Bool("show_ui", true, "Set to false to disable the text-based UI")
@@ -75,23 +80,29 @@ type roundRobinFetcher struct {
 	sync.Mutex
 	idx int
 	f   []client.Fetcher
+	fs  []client.FetcherStream
 }
 
-func (rr *roundRobinFetcher) next() client.Fetcher {
+func (rr *roundRobinFetcher) next() int {
 	rr.Lock()
 	defer rr.Unlock()
 
-	f := rr.f[rr.idx]
+	i := rr.idx
 	rr.idx = (rr.idx + 1) % len(rr.f)
 
-	return f
+	return i
 }
 
 func (rr *roundRobinFetcher) Fetch(ctx context.Context, path string) ([]byte, error) {
-	f := rr.next()
+	f := rr.f[rr.next()]
 	return f(ctx, path)
 }
 
+func (rr *roundRobinFetcher) FetchStream(ctx context.Context, path string) (io.ReadCloser, error) {
+	fs := rr.fs[rr.next()]
+	return fs(ctx, path)
+}
+
 func main() {
 	klog.InitFlags(nil)
 	flag.Parse()
@@ -109,6 +120,7 @@ func main() {
 
 	var rootURL *url.URL
 	fetchers := []client.Fetcher{}
+	streamFetchers := []client.FetcherStream{}
 	for _, s := range logURL {
 		// url must reference a directory, by definition
 		if !strings.HasSuffix(s, "/") {
@@ -120,14 +132,52 @@ func main() {
 			klog.Exitf("Invalid log URL: %v", err)
 		}
 		fetchers = append(fetchers, newFetcher(rootURL))
+		streamFetchers = append(streamFetchers, newStreamFetcher(rootURL))
 
 	}
-	f := roundRobinFetcher{f: fetchers}
+	f := roundRobinFetcher{f: fetchers, fs: streamFetchers}
+	// The readers tend to want the same resources at the same time, so merge
+	// their concurrent requests.
+	fetch := client.CoalescingFetcher(f.Fetch)
 
-	var cpRaw []byte
-	cons := client.UnilateralConsensus(f.Fetch)
-	hasher := rfc6962.DefaultHasher
-	tracker, err := client.NewLogStateTracker(ctx, f.Fetch, hasher, cpRaw, logSigV, *origin, cons)
+	cons := client.UnilateralConsensus(fetch)
+	if *witnessPolicy != "" {
+		b, err := os.ReadFile(*witnessPolicy)
+		if err != nil {
+			klog.Exitf("Failed to read witness policy: %v", err)
+		}
+		wc, err := client.ParseWitnessConfig(b)
+		if err != nil {
+			klog.Exitf("Invalid witness policy: %v", err)
+		}
+		if cons, err = wc.Consensus(fetch); err != nil {
+			klog.Exitf("Failed to create consensus func: %v", err)
+		}
+	}
+	hasher, err := client.NewHasher(*hashFunc)
+	if err != nil {
+		klog.Exitf("Invalid --hash: %v", err)
+	}
+	layout, err := client.NewLayout(*logLayout)
+	if err != nil {
+		klog.Exitf("Invalid --layout: %v", err)
+	}
+	if *leafBundleSize == 0 {
+		n, err := client.DiscoverBundleSize(ctx, fetch)
+		if err != nil {
+			klog.Exitf("Failed to discover leaf bundle size: %v", err)
+		}
+		*leafBundleSize = int(n)
+	}
+	var tracker client.LogStateTracker
+	if *stateFile != "" {
+		if _, ok := layout.(client.ServerlessLayout); !ok {
+			klog.Exitf("--state_file is only supported for serverless logs")
+		}
+		tracker, err = client.NewPersistentLogStateTracker(ctx, fetch, hasher, client.FileCheckpointStore{Path: *stateFile}, logSigV, *origin, cons)
+	} else {
+		tracker, err = client.NewLogStateTrackerWithLayout(ctx, fetch, hasher, nil, logSigV, *origin, cons, layout)
+	}
 	if err != nil {
 		klog.Exitf("Failed to create LogStateTracker: %v", err)
 	}
@@ -141,7 +191,11 @@ func main() {
 	if err != nil {
 		klog.Exitf("Failed to create add URL: %v", err)
 	}
-	hammer := NewHammer(&tracker, f.Fetch, addURL)
+	submitOpts := []client.SubmitterOption{client.WithHTTPClient(hc)}
+	if len(*bearerToken) > 0 {
+		submitOpts = append(submitOpts, client.WithBearerToken(*bearerToken))
+	}
+	hammer := NewHammer(&tracker, fetch, f.FetchStream, client.NewSubmitter(addURL, submitOpts...))
 	hammer.Run(ctx)
 
 	if *showUI {
@@ -151,7 +205,7 @@ func main() {
 	}
 }
 
-func NewHammer(tracker *client.LogStateTracker, f client.Fetcher, addURL *url.URL) *Hammer {
+func NewHammer(tracker *client.LogStateTracker, f client.Fetcher, fs client.FetcherStream, s *client.Submitter) *Hammer {
 	readThrottle := NewThrottle(*maxReadOpsPerSecond)
 	writeThrottle := NewThrottle(*maxWriteOpsPerSecond)
 	errChan := make(chan error, 20)
@@ -160,14 +214,14 @@ func NewHammer(tracker *client.LogStateTracker, f client.Fetcher, addURL *url.UR
 	fullReaders := make([]*LeafReader, *numReadersFull)
 	writers := make([]*LogWriter, *numWriters)
 	for i := 0; i < *numReadersRandom; i++ {
-		randomReaders[i] = NewLeafReader(tracker, f, RandomNextLeaf(), *leafBundleSize, readThrottle.tokenChan, errChan)
+		randomReaders[i] = NewLeafReader(tracker, f, nil, RandomNextLeaf(), *leafBundleSize, readThrottle.tokenChan, errChan)
 	}
 	for i := 0; i < *numReadersFull; i++ {
-		fullReaders[i] = NewLeafReader(tracker, f, MonotonicallyIncreasingNextLeaf(), *leafBundleSize, readThrottle.tokenChan, errChan)
+		fullReaders[i] = NewLeafReader(tracker, f, fs, MonotonicallyIncreasingNextLeaf(), *leafBundleSize, readThrottle.tokenChan, errChan)
 	}
-	gen := newLeafGenerator(tracker.LatestConsistent.Size, *leafMinSize)
+	gen := newLeafGenerator(tracker.State().Checkpoint.Size, *leafMinSize)
 	for i := 0; i < *numWriters; i++ {
-		writers[i] = NewLogWriter(hc, addURL, gen, writeThrottle.tokenChan, errChan)
+		writers[i] = NewLogWriter(s, gen, writeThrottle.tokenChan, errChan)
 	}
 	return &Hammer{
 		randomReaders: randomReaders,
@@ -225,7 +279,7 @@ func (h *Hammer) Run(ctx context.Context) {
 			case <-ctx.Done():
 				return
 			case <-tick.C:
-				size := h.tracker.LatestConsistent.Size
+				size := h.tracker.State().Checkpoint.Size
 				_, _, _, err := h.tracker.Update(ctx)
 				if err != nil {
 					klog.Warning(err)
@@ -233,8 +287,11 @@ func (h *Hammer) Run(ctx context.Context) {
 					if errors.As(err, &inconsistentErr) {
 						klog.Fatalf("Last Good Checkpoint:\n%s\n\nFirst Bad Checkpoint:\n%s\n\n%v", string(inconsistentErr.SmallerRaw), string(inconsistentErr.LargerRaw), inconsistentErr)
 					}
+					if errors.Is(err, client.ErrBadSignature) || errors.Is(err, client.ErrMalformedCheckpoint) {
+						klog.Fatalf("Log served an invalid checkpoint: %v", err)
+					}
 				}
-				newSize := h.tracker.LatestConsistent.Size
+				newSize := h.tracker.State().Checkpoint.Size
 				if newSize > size {
 					klog.V(1).Infof("Updated checkpoint from %d to %d", size, newSize)
 				}
@@ -251,22 +308,41 @@ func genLeaf(n uint64, minLeafSize int) []byte {
 	return []byte(fmt.Sprintf("%x %d", filler, n))
 }
 
+// newLeafGenerator returns a function which generates leaves to add to the
+// log, some of which are duplicates of previously generated leaves in order to
+// exercise the log's deduplication. Most duplicates are of the leaf generated
+// immediately before, but some are of much older leaves, to test that the log
+// deduplicates across its full history and not only recent submissions.
 func newLeafGenerator(n uint64, minLeafSize int) func() []byte {
-	const dupChance = 0.1
+	const (
+		dupChance    = 0.1
+		oldDupChance = 0.02
+		maxOldLeaves = 1000
+	)
 	nextLeaf := genLeaf(n, minLeafSize)
+	var oldLeaves [][]byte
 	return func() []byte {
-		if rand.Float64() <= dupChance {
+		r := rand.Float64()
+		if r <= oldDupChance && len(oldLeaves) > 0 {
+			return oldLeaves[rand.Intn(len(oldLeaves))]
+		}
+		if r <= dupChance {
 			// This one will actually be unique, but the next iteration will
-			// duplicate it. In future, this duplication could be randomly
-			// selected to include really old leaves too, to test long-term
-			// deduplication in the log (if it supports  that).
+			// duplicate it.
 			return nextLeaf
 		}
 
 		n++
-		r := nextLeaf
+		leaf := nextLeaf
 		nextLeaf = genLeaf(n, minLeafSize)
-		return r
+		// Remember a sample of the generated leaves to resubmit later, replacing
+		// random entries once the sample is full.
+		if len(oldLeaves) < maxOldLeaves {
+			oldLeaves = append(oldLeaves, leaf)
+		} else {
+			oldLeaves[rand.Intn(maxOldLeaves)] = leaf
+		}
+		return leaf
 	}
 }
 
@@ -412,6 +488,23 @@ func logSigVerifier(f string) (note.Verifier, []byte, error) {
 		}
 	}
 
+	if *logLayout == client.LayoutStaticCT {
+		// static-ct-api logs publish their key as a PEM encoded public key.
+		b, _ := pem.Decode(pubKey)
+		if b == nil {
+			return nil, nil, errors.New("failed to decode PEM public key for static-ct log")
+		}
+		k, err := x509.ParsePKIXPublicKey(b.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse public key: %v", err)
+		}
+		v, err := client.NewStaticCTVerifier(*origin, k)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create verifier: %v", err)
+		}
+		return v, pubKey, nil
+	}
+
 	v, err := note.NewVerifier(string(pubKey))
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create verifier: %v", err)
@@ -444,6 +537,59 @@ var getByScheme = map[string]func(context.Context, *url.URL) ([]byte, error){
 	},
 }
 
+// newStreamFetcher creates a FetcherStream for the log at the given root location.
+func newStreamFetcher(root *url.URL) client.FetcherStream {
+	get := streamByScheme[root.Scheme]
+	if get == nil {
+		panic(fmt.Errorf("unsupported URL scheme %s", root.Scheme))
+	}
+
+	return func(ctx context.Context, p string) (io.ReadCloser, error) {
+		u, err := root.Parse(p)
+		if err != nil {
+			return nil, err
+		}
+		return get(ctx, u)
+	}
+}
+
+var streamByScheme = map[string]func(context.Context, *url.URL) (io.ReadCloser, error){
+	"http":  streamHTTP,
+	"https": streamHTTP,
+	"file": func(_ context.Context, u *url.URL) (io.ReadCloser, error) {
+		return os.Open(u.Path)
+	},
+}
+
+// streamHTTP is the streaming equivalent of readHTTP, the caller must close the
+// returned reader.
+func streamHTTP(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(*bearerToken) > 0 {
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", *bearerToken))
+	}
+	resp, err := hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case 200:
+		return resp.Body, nil
+	case 404:
+		klog.Infof("Not found: %q", u.String())
+		err = os.ErrNotExist
+	default:
+		err = client.HTTPStatusError{StatusCode: resp.StatusCode}
+	}
+	if err := resp.Body.Close(); err != nil {
+		klog.Errorf("resp.Body.Close(): %v", err)
+	}
+	return nil, err
+}
+
 func readHTTP(ctx context.Context, u *url.URL) ([]byte, error) {
 	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
@@ -473,7 +619,7 @@ func readHTTP(ctx context.Context, u *url.URL) ([]byte, error) {
 	case 200:
 		break
 	default:
-		return nil, fmt.Errorf("unexpected http status %q", resp.Status)
+		return nil, client.HTTPStatusError{StatusCode: resp.StatusCode}
 	}
 	return body, nil
 }
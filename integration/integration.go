@@ -22,7 +22,6 @@ import (
 
 	"github.com/transparency-dev/merkle"
 	"github.com/transparency-dev/merkle/proof"
-	"github.com/transparency-dev/merkle/rfc6962"
 	"github.com/transparency-dev/serverless-log/client"
 	"github.com/transparency-dev/serverless-log/pkg/log"
 	"golang.org/x/mod/sumdb/note"
@@ -37,7 +36,7 @@ const (
 	integrationOrigin = "Serverless Integration Test Log"
 )
 
-func RunIntegration(t *testing.T, s log.Storage, f client.Fetcher, lh *rfc6962.Hasher) {
+func RunIntegration(t *testing.T, s log.Storage, f client.Fetcher, lh merkle.LogHasher) {
 	ctx := context.Background()
 
 	// Do a few iterations around the sequence/integrate loop;
@@ -60,7 +59,7 @@ func RunIntegration(t *testing.T, s log.Storage, f client.Fetcher, lh *rfc6962.H
 
 	for i := 0; i < loops; i++ {
 		klog.Infof("----------------%d--------------", i)
-		checkpoint := lst.LatestConsistent
+		checkpoint := lst.State().Checkpoint
 
 		// Sequence some leaves:
 		leaves := sequenceNLeaves(ctx, t, s, lh, i*leavesPerLoop, leavesPerLoop)
@@ -96,9 +95,9 @@ func RunIntegration(t *testing.T, s log.Storage, f client.Fetcher, lh *rfc6962.H
 		}
 		if latestCpNote.Text != updateNote.Text {
 			t.Fatalf("LogStateTracker.Update() did not return correct note information. Got %v want %v",
-				lst.CheckpointNote.Text, updateNote.Text)
+				lst.State().Note.Text, updateNote.Text)
 		}
-		newCheckpoint := lst.LatestConsistent
+		newCheckpoint := lst.State().Checkpoint
 		if got, want := newCheckpoint.Size-checkpoint.Size, uint64(leavesPerLoop); got != want {
 			t.Errorf("Integrate missed some entries, got %d want %d", got, want)
 		}
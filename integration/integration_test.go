@@ -63,6 +63,24 @@ func TestServerlessViaFile(t *testing.T) {
 	RunIntegration(t, st, f, h)
 }
 
+func TestServerlessAlternateHasher(t *testing.T) {
+	t.Parallel()
+
+	h, err := client.NewHasher(client.HashSHA512_256)
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+
+	root := filepath.Join(t.TempDir(), "log")
+	s := mustGetSigner(t, privKey)
+	st := mustCreateAndInitialiseStorage(context.Background(), t, root, s)
+	f := func(_ context.Context, p string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(root, p))
+	}
+
+	RunIntegration(t, st, f, h)
+}
+
 func TestServerlessViaHTTP(t *testing.T) {
 	t.Parallel()
 
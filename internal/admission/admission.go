@@ -0,0 +1,200 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package admission provides policies deciding which entries may be added to
+// a log, so that invalid entries are rejected before they're sequenced, and
+// become a permanent part of the log.
+package admission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+var (
+	// ErrRejected is wrapped by the errors returned by Policies for entries
+	// which may not be added to the log.
+	ErrRejected = errors.New("entry rejected")
+	// ErrTooLarge is wrapped by the errors returned by MaxSize.
+	ErrTooLarge = fmt.Errorf("%w: too large", ErrRejected)
+)
+
+// Entry is an entry submitted to the log.
+type Entry struct {
+	// Data is the entry's contents.
+	Data []byte
+	// ContentType is the media type of Data, if known, e.g. from the
+	// Content-Type header of a request to the add endpoint.
+	ContentType string
+}
+
+// Policy decides whether entries may be added to a log.
+type Policy interface {
+	// Admit returns nil if e may be added to the log, or an error wrapping
+	// ErrRejected explaining why not. Other errors mean that the policy
+	// could not be applied.
+	Admit(ctx context.Context, e Entry) error
+}
+
+// PolicyFunc adapts a function to the Policy interface.
+type PolicyFunc func(ctx context.Context, e Entry) error
+
+// Admit implements Policy.
+func (f PolicyFunc) Admit(ctx context.Context, e Entry) error {
+	return f(ctx, e)
+}
+
+// All returns a Policy which admits entries admitted by every one of ps,
+// applying them in turn.
+func All(ps ...Policy) Policy {
+	return PolicyFunc(func(ctx context.Context, e Entry) error {
+		for _, p := range ps {
+			if err := p.Admit(ctx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MaxSize returns a Policy which admits entries of at most n bytes.
+func MaxSize(n int) Policy {
+	return PolicyFunc(func(_ context.Context, e Entry) error {
+		if len(e.Data) > n {
+			return fmt.Errorf("%w: %d bytes, want at most %d", ErrTooLarge, len(e.Data), n)
+		}
+		return nil
+	})
+}
+
+// ContentTypes returns a Policy which admits entries whose media type is one
+// of types. Types may end in a wildcard, e.g. "text/*". The media type of
+// entries submitted without one is detected from their contents, as with
+// http.DetectContentType.
+func ContentTypes(types ...string) Policy {
+	return PolicyFunc(func(_ context.Context, e Entry) error {
+		ct := e.ContentType
+		if ct == "" {
+			ct = http.DetectContentType(e.Data)
+		}
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return fmt.Errorf("%w: invalid content type %q", ErrRejected, ct)
+		}
+		for _, t := range types {
+			if ok, _ := path.Match(t, mt); ok {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: content type %q is not allowed", ErrRejected, mt)
+	})
+}
+
+// SignedNote returns a Policy which admits entries which are notes, see
+// golang.org/x/mod/sumdb/note, signed by at least one of the keys known to
+// verifiers. This allows a log to accept entries only from known submitters,
+// however they're submitted.
+func SignedNote(verifiers note.Verifiers) Policy {
+	return PolicyFunc(func(_ context.Context, e Entry) error {
+		n, err := note.Open(e.Data, verifiers)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrRejected, err)
+		}
+		if len(n.Sigs) == 0 {
+			return fmt.Errorf("%w: no signature by a known key", ErrRejected)
+		}
+		return nil
+	})
+}
+
+// Config describes a Policy, e.g. from the flags of a command.
+type Config struct {
+	// MaxSize is the largest entry admitted, in bytes. Zero means no limit.
+	MaxSize int
+	// ContentTypes lists the media types of entries admitted, see
+	// ContentTypes. If empty, entries of any type are admitted.
+	ContentTypes []string
+	// SchemaFile is the path of a JSON Schema which entries must be valid
+	// against, see Schema. If empty, entries needn't be JSON.
+	SchemaFile string
+	// SignerKeysFile is the path of a file holding note verifier keys, one
+	// per line, see SignedNote. If empty, entries needn't be signed.
+	SignerKeysFile string
+}
+
+// Policy returns the Policy described by c, or nil if it admits all entries.
+func (c Config) Policy() (Policy, error) {
+	var ps []Policy
+	if c.MaxSize > 0 {
+		ps = append(ps, MaxSize(c.MaxSize))
+	}
+	if len(c.ContentTypes) > 0 {
+		ps = append(ps, ContentTypes(c.ContentTypes...))
+	}
+	if c.SchemaFile != "" {
+		b, err := os.ReadFile(c.SchemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema: %v", err)
+		}
+		p, err := Schema(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema %q: %v", c.SchemaFile, err)
+		}
+		ps = append(ps, p)
+	}
+	if c.SignerKeysFile != "" {
+		b, err := os.ReadFile(c.SignerKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signer keys: %v", err)
+		}
+		vs, err := parseVerifiers(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signer keys %q: %v", c.SignerKeysFile, err)
+		}
+		ps = append(ps, SignedNote(vs))
+	}
+	if len(ps) == 0 {
+		return nil, nil
+	}
+	return All(ps...), nil
+}
+
+// parseVerifiers parses note verifier keys, one per line. Blank lines, and
+// lines starting with #, are ignored.
+func parseVerifiers(text []byte) (note.Verifiers, error) {
+	var vs []note.Verifier
+	for i, l := range strings.Split(string(text), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		v, err := note.NewVerifier(l)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		vs = append(vs, v)
+	}
+	if len(vs) == 0 {
+		return nil, errors.New("no keys found")
+	}
+	return note.VerifierList(vs...), nil
+}
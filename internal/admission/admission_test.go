@@ -0,0 +1,194 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestPolicies(t *testing.T) {
+	skey, vkey, err := note.GenerateKey(rand.Reader, "submitter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := note.Sign(&note.Note{Text: "an entry\n"}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := note.GenerateKey(rand.Reader, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := note.NewSigner(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedByOther, err := note.Sign(&note.Note{Text: "an entry\n"}, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		desc    string
+		p       Policy
+		e       Entry
+		wantErr error
+	}{
+		{
+			desc: "max size",
+			p:    MaxSize(5),
+			e:    Entry{Data: []byte("12345")},
+		}, {
+			desc:    "too large",
+			p:       MaxSize(5),
+			e:       Entry{Data: []byte("123456")},
+			wantErr: ErrTooLarge,
+		}, {
+			desc: "content type",
+			p:    ContentTypes("application/json"),
+			e:    Entry{Data: []byte("{}"), ContentType: "application/json; charset=utf-8"},
+		}, {
+			desc: "content type wildcard",
+			p:    ContentTypes("application/json", "text/*"),
+			e:    Entry{Data: []byte("hello"), ContentType: "text/markdown"},
+		}, {
+			desc: "detected content type",
+			p:    ContentTypes("text/plain"),
+			e:    Entry{Data: []byte("hello")},
+		}, {
+			desc:    "wrong content type",
+			p:       ContentTypes("application/json"),
+			e:       Entry{Data: []byte("hello"), ContentType: "text/plain"},
+			wantErr: ErrRejected,
+		}, {
+			desc:    "invalid content type",
+			p:       ContentTypes("application/json"),
+			e:       Entry{Data: []byte("{}"), ContentType: "/"},
+			wantErr: ErrRejected,
+		}, {
+			desc: "signed",
+			p:    SignedNote(note.VerifierList(v)),
+			e:    Entry{Data: signed},
+		}, {
+			desc:    "signed by unknown key",
+			p:       SignedNote(note.VerifierList(v)),
+			e:       Entry{Data: signedByOther},
+			wantErr: ErrRejected,
+		}, {
+			desc:    "unsigned",
+			p:       SignedNote(note.VerifierList(v)),
+			e:       Entry{Data: []byte("an entry\n")},
+			wantErr: ErrRejected,
+		}, {
+			desc: "all",
+			p:    All(MaxSize(1000), SignedNote(note.VerifierList(v))),
+			e:    Entry{Data: signed},
+		}, {
+			desc:    "all, one rejects",
+			p:       All(MaxSize(10), SignedNote(note.VerifierList(v))),
+			e:       Entry{Data: signed},
+			wantErr: ErrTooLarge,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			err := test.p.Admit(context.Background(), test.e)
+			if test.wantErr == nil && err != nil {
+				t.Fatalf("Admit: %v", err)
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Fatalf("Admit: got err %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	_, vkey, err := note.GenerateKey(rand.Reader, "submitter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"schema.json": `{"type": "object"}`,
+		"bad.json":    `{"if": true}`,
+		"keys":        "# Submitters\n" + vkey + "\n",
+		"bad-keys":    "not a key\n",
+		"no-keys":     "# Submitters\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, test := range []struct {
+		desc       string
+		c          Config
+		wantPolicy bool
+		wantErr    bool
+	}{
+		{
+			desc: "empty",
+		}, {
+			desc: "everything",
+			c: Config{
+				MaxSize:        100,
+				ContentTypes:   []string{"application/json"},
+				SchemaFile:     filepath.Join(dir, "schema.json"),
+				SignerKeysFile: filepath.Join(dir, "keys"),
+			},
+			wantPolicy: true,
+		}, {
+			desc:    "missing schema",
+			c:       Config{SchemaFile: filepath.Join(dir, "missing.json")},
+			wantErr: true,
+		}, {
+			desc:    "unsupported schema",
+			c:       Config{SchemaFile: filepath.Join(dir, "bad.json")},
+			wantErr: true,
+		}, {
+			desc:    "bad keys",
+			c:       Config{SignerKeysFile: filepath.Join(dir, "bad-keys")},
+			wantErr: true,
+		}, {
+			desc:    "no keys",
+			c:       Config{SignerKeysFile: filepath.Join(dir, "no-keys")},
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			p, err := test.c.Policy()
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Policy: got err %v, want err %t", err, test.wantErr)
+			}
+			if gotPolicy := p != nil; gotPolicy != test.wantPolicy {
+				t.Errorf("Policy: got policy %t, want %t", gotPolicy, test.wantPolicy)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Names of the flags defined by RegisterFlags.
+const (
+	maxSizeFlag      = "max_entry_size"
+	contentTypesFlag = "content_types"
+	schemaFlag       = "entry_schema"
+	signerKeysFlag   = "submitter_keys"
+)
+
+// RegisterFlags defines the flags which configure a Policy on fs, so that
+// every command which admits entries is configured in the same way. See
+// PolicyFromFlags.
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.Int(maxSizeFlag, 0, "If set, entries larger than this many bytes are rejected.")
+	fs.String(contentTypesFlag, "", "Comma separated list of the media types of entries which are accepted, e.g. application/json,text/*. If unset, entries of any type are accepted.")
+	fs.String(schemaFlag, "", "Location of a JSON Schema which entries must be valid against, see admission.Schema for the keywords supported. If unset, entries needn't be JSON.")
+	fs.String(signerKeysFlag, "", "Location of a file of note verifier keys, one per line. If set, entries must be notes signed by at least one of these keys.")
+}
+
+// PolicyFromFlags returns the Policy configured by the flags which
+// RegisterFlags defined on fs, once fs has been parsed, or nil if it admits
+// all entries.
+func PolicyFromFlags(fs *flag.FlagSet) (Policy, error) {
+	vals := make(map[string]string)
+	for _, n := range []string{maxSizeFlag, contentTypesFlag, schemaFlag, signerKeysFlag} {
+		f := fs.Lookup(n)
+		if f == nil {
+			return nil, fmt.Errorf("flag --%s is not defined, see RegisterFlags", n)
+		}
+		vals[n] = f.Value.String()
+	}
+	maxSize, err := strconv.Atoi(vals[maxSizeFlag])
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %v", maxSizeFlag, err)
+	}
+	c := Config{
+		MaxSize:        maxSize,
+		SchemaFile:     vals[schemaFlag],
+		SignerKeysFile: vals[signerKeysFlag],
+	}
+	if ct := vals[contentTypesFlag]; ct != "" {
+		c.ContentTypes = strings.Split(ct, ",")
+	}
+	return c.Policy()
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyFromFlags(t *testing.T) {
+	ctx := context.Background()
+	schema := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(schema, []byte(`{"type": "object"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		desc       string
+		args       []string
+		register   bool
+		wantPolicy bool
+		wantErr    bool
+		// admit and reject are entries which the policy must admit and reject.
+		admit, reject []Entry
+	}{
+		{
+			desc:     "unset",
+			register: true,
+		}, {
+			desc:       "max size",
+			args:       []string{"--max_entry_size=4"},
+			register:   true,
+			wantPolicy: true,
+			admit:      []Entry{{Data: []byte("1234")}},
+			reject:     []Entry{{Data: []byte("12345")}},
+		}, {
+			desc:       "content types",
+			args:       []string{"--content_types=text/plain,application/json"},
+			register:   true,
+			wantPolicy: true,
+			admit:      []Entry{{Data: []byte("{}"), ContentType: "application/json"}},
+			reject:     []Entry{{Data: []byte("{}"), ContentType: "image/png"}},
+		}, {
+			desc:       "schema",
+			args:       []string{"--entry_schema=" + schema},
+			register:   true,
+			wantPolicy: true,
+			admit:      []Entry{{Data: []byte(`{"a": 1}`)}},
+			reject:     []Entry{{Data: []byte(`[1]`)}},
+		}, {
+			desc:     "missing schema",
+			args:     []string{"--entry_schema=" + schema + ".missing"},
+			register: true,
+			wantErr:  true,
+		}, {
+			desc:    "not registered",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			if test.register {
+				RegisterFlags(fs)
+			}
+			if err := fs.Parse(test.args); err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			p, err := PolicyFromFlags(fs)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("PolicyFromFlags: got err %v, want err %t", err, test.wantErr)
+			}
+			if gotPolicy := p != nil; gotPolicy != test.wantPolicy {
+				t.Fatalf("PolicyFromFlags: got policy %t, want %t", gotPolicy, test.wantPolicy)
+			}
+			for _, e := range test.admit {
+				if err := p.Admit(ctx, e); err != nil {
+					t.Errorf("Admit(%q): %v", e.Data, err)
+				}
+			}
+			for _, e := range test.reject {
+				if err := p.Admit(ctx, e); !errors.Is(err, ErrRejected) {
+					t.Errorf("Admit(%q): got %v, want %v", e.Data, err, ErrRejected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"unicode/utf8"
+)
+
+// annotations are JSON Schema keywords which don't affect validation.
+var annotations = map[string]bool{
+	"$schema":     true,
+	"$id":         true,
+	"$comment":    true,
+	"title":       true,
+	"description": true,
+	"examples":    true,
+	"default":     true,
+}
+
+// schema is a compiled JSON Schema.
+type schema struct {
+	types                []string
+	properties           map[string]*schema
+	required             []string
+	additionalProperties *schema
+	noAdditional         bool
+	items                *schema
+	enum                 []any
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	minimum, maximum     *float64
+	minItems, maxItems   *int
+}
+
+// Schema returns a Policy which admits entries which are JSON documents valid
+// against the given JSON Schema.
+//
+// Only a subset of JSON Schema is supported: the type, enum, const,
+// properties, required, additionalProperties, items, minLength, maxLength,
+// pattern, minimum, maximum, minItems, and maxItems keywords, and annotations
+// such as title and description. Schemas using other keywords are rejected,
+// rather than being applied partially.
+func Schema(text []byte) (Policy, error) {
+	var raw any
+	if err := json.Unmarshal(text, &raw); err != nil {
+		return nil, err
+	}
+	s, err := compileSchema(raw, "#")
+	if err != nil {
+		return nil, err
+	}
+	return PolicyFunc(func(_ context.Context, e Entry) error {
+		d := json.NewDecoder(bytes.NewReader(e.Data))
+		var v any
+		if err := d.Decode(&v); err != nil {
+			return fmt.Errorf("%w: not valid JSON: %v", ErrRejected, err)
+		}
+		if d.More() {
+			return fmt.Errorf("%w: not valid JSON: trailing data", ErrRejected)
+		}
+		if err := s.validate(v, "$"); err != nil {
+			return fmt.Errorf("%w: %v", ErrRejected, err)
+		}
+		return nil
+	}), nil
+}
+
+func compileSchema(raw any, loc string) (*schema, error) {
+	if b, ok := raw.(bool); ok {
+		if b {
+			return &schema{}, nil
+		}
+		// The false schema admits nothing.
+		return &schema{enum: []any{}}, nil
+	}
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or boolean", loc)
+	}
+	s := &schema{}
+	for k, v := range m {
+		kloc := loc + "/" + k
+		var err error
+		switch k {
+		case "type":
+			switch t := v.(type) {
+			case string:
+				s.types = []string{t}
+			case []any:
+				for _, e := range t {
+					es, ok := e.(string)
+					if !ok {
+						return nil, fmt.Errorf("%s: must be a string or list of strings", kloc)
+					}
+					s.types = append(s.types, es)
+				}
+			default:
+				return nil, fmt.Errorf("%s: must be a string or list of strings", kloc)
+			}
+			for _, t := range s.types {
+				if !slices.Contains([]string{"null", "boolean", "object", "array", "number", "integer", "string"}, t) {
+					return nil, fmt.Errorf("%s: unknown type %q", kloc, t)
+				}
+			}
+		case "properties":
+			pm, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be an object", kloc)
+			}
+			s.properties = make(map[string]*schema)
+			for p, ps := range pm {
+				if s.properties[p], err = compileSchema(ps, kloc+"/"+p); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			l, ok := v.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be a list of strings", kloc)
+			}
+			for _, e := range l {
+				es, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: must be a list of strings", kloc)
+				}
+				s.required = append(s.required, es)
+			}
+		case "additionalProperties":
+			if b, ok := v.(bool); ok && !b {
+				s.noAdditional = true
+			} else if s.additionalProperties, err = compileSchema(v, kloc); err != nil {
+				return nil, err
+			}
+		case "items":
+			if s.items, err = compileSchema(v, kloc); err != nil {
+				return nil, err
+			}
+		case "enum":
+			l, ok := v.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be a list", kloc)
+			}
+			s.enum = l
+		case "const":
+			s.enum = []any{v}
+		case "minLength":
+			s.minLength, err = count(v, kloc)
+		case "maxLength":
+			s.maxLength, err = count(v, kloc)
+		case "minItems":
+			s.minItems, err = count(v, kloc)
+		case "maxItems":
+			s.maxItems, err = count(v, kloc)
+		case "minimum", "maximum":
+			f, ok := v.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be a number", kloc)
+			}
+			if k == "minimum" {
+				s.minimum = &f
+			} else {
+				s.maximum = &f
+			}
+		case "pattern":
+			p, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be a string", kloc)
+			}
+			if s.pattern, err = regexp.Compile(p); err != nil {
+				return nil, fmt.Errorf("%s: %v", kloc, err)
+			}
+		default:
+			if !annotations[k] {
+				return nil, fmt.Errorf("%s: unsupported keyword", kloc)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// count parses the value of a keyword which must be a non-negative integer.
+func count(v any, loc string) (*int, error) {
+	f, ok := v.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("%s: must be a non-negative integer", loc)
+	}
+	n := int(f)
+	return &n, nil
+}
+
+// validate checks that v, found at loc in the entry, is valid against s.
+func (s *schema) validate(v any, loc string) error {
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(t string) bool { return hasType(v, t) }) {
+		return fmt.Errorf("%s: want type %v", loc, s.types)
+	}
+	if s.enum != nil && !slices.ContainsFunc(s.enum, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+		return fmt.Errorf("%s: not an allowed value", loc)
+	}
+	switch t := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(t)
+		if s.minLength != nil && n < *s.minLength {
+			return fmt.Errorf("%s: shorter than %d characters", loc, *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			return fmt.Errorf("%s: longer than %d characters", loc, *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(t) {
+			return fmt.Errorf("%s: doesn't match pattern %q", loc, s.pattern)
+		}
+	case float64:
+		if s.minimum != nil && t < *s.minimum {
+			return fmt.Errorf("%s: less than %v", loc, *s.minimum)
+		}
+		if s.maximum != nil && t > *s.maximum {
+			return fmt.Errorf("%s: greater than %v", loc, *s.maximum)
+		}
+	case []any:
+		if s.minItems != nil && len(t) < *s.minItems {
+			return fmt.Errorf("%s: fewer than %d items", loc, *s.minItems)
+		}
+		if s.maxItems != nil && len(t) > *s.maxItems {
+			return fmt.Errorf("%s: more than %d items", loc, *s.maxItems)
+		}
+		if s.items != nil {
+			for i, e := range t {
+				if err := s.items.validate(e, fmt.Sprintf("%s[%d]", loc, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]any:
+		for _, r := range s.required {
+			if _, ok := t[r]; !ok {
+				return fmt.Errorf("%s: missing required property %q", loc, r)
+			}
+		}
+		for k, e := range t {
+			ploc := loc + "." + k
+			if ps, ok := s.properties[k]; ok {
+				if err := ps.validate(e, ploc); err != nil {
+					return err
+				}
+				continue
+			}
+			if s.noAdditional {
+				return fmt.Errorf("%s: unexpected property", ploc)
+			}
+			if s.additionalProperties != nil {
+				if err := s.additionalProperties.validate(e, ploc); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasType reports whether v has the JSON Schema type t.
+func hasType(v any, t string) bool {
+	switch v := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case float64:
+		return t == "number" || (t == "integer" && v == math.Trunc(v))
+	case []any:
+		return t == "array"
+	case map[string]any:
+		return t == "object"
+	}
+	return false
+}
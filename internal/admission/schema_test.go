@@ -0,0 +1,155 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	const attestation = `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title": "Release attestation",
+		"type": "object",
+		"required": ["name", "version", "digests"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "maxLength": 20},
+			"version": {"type": "string", "pattern": "^v[0-9]+\\.[0-9]+\\.[0-9]+$"},
+			"stage": {"enum": ["alpha", "beta", "stable"]},
+			"build": {"type": "integer", "minimum": 1, "maximum": 1000},
+			"digests": {
+				"type": "array",
+				"minItems": 1,
+				"maxItems": 2,
+				"items": {"type": "string", "pattern": "^[0-9a-f]{64}$"}
+			},
+			"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+			"note": {"type": ["string", "null"]}
+		}
+	}`
+	const digest = `"6f1ed002ab5595859014ebf0951522d9d0e7c4d6a1f4f3d9c1d1a2b3c4d5e6f7"`
+	p, err := Schema([]byte(attestation))
+	if err != nil {
+		t.Fatalf("Schema: %v", err)
+	}
+	for _, test := range []struct {
+		desc    string
+		entry   string
+		wantErr bool
+	}{
+		{
+			desc:  "minimal",
+			entry: `{"name": "tool", "version": "v1.2.3", "digests": [` + digest + `]}`,
+		}, {
+			desc:  "everything",
+			entry: `{"name": "tool", "version": "v1.2.3", "stage": "beta", "build": 7, "digests": [` + digest + `], "labels": {"os": "linux"}, "note": null}`,
+		}, {
+			desc:    "not JSON",
+			entry:   `name: tool`,
+			wantErr: true,
+		}, {
+			desc:    "trailing data",
+			entry:   `{"name": "tool", "version": "v1.2.3", "digests": [` + digest + `]} {}`,
+			wantErr: true,
+		}, {
+			desc:    "wrong type",
+			entry:   `["tool"]`,
+			wantErr: true,
+		}, {
+			desc:    "missing property",
+			entry:   `{"name": "tool", "digests": [` + digest + `]}`,
+			wantErr: true,
+		}, {
+			desc:    "additional property",
+			entry:   `{"name": "tool", "version": "v1.2.3", "digests": [` + digest + `], "extra": 1}`,
+			wantErr: true,
+		}, {
+			desc:    "empty name",
+			entry:   `{"name": "", "version": "v1.2.3", "digests": [` + digest + `]}`,
+			wantErr: true,
+		}, {
+			desc:    "long name",
+			entry:   `{"name": "a very long name for a tool", "version": "v1.2.3", "digests": [` + digest + `]}`,
+			wantErr: true,
+		}, {
+			desc:    "bad version",
+			entry:   `{"name": "tool", "version": "1.2", "digests": [` + digest + `]}`,
+			wantErr: true,
+		}, {
+			desc:    "unknown stage",
+			entry:   `{"name": "tool", "version": "v1.2.3", "stage": "gamma", "digests": [` + digest + `]}`,
+			wantErr: true,
+		}, {
+			desc:    "fractional build",
+			entry:   `{"name": "tool", "version": "v1.2.3", "build": 1.5, "digests": [` + digest + `]}`,
+			wantErr: true,
+		}, {
+			desc:    "build too large",
+			entry:   `{"name": "tool", "version": "v1.2.3", "build": 1001, "digests": [` + digest + `]}`,
+			wantErr: true,
+		}, {
+			desc:    "no digests",
+			entry:   `{"name": "tool", "version": "v1.2.3", "digests": []}`,
+			wantErr: true,
+		}, {
+			desc:    "too many digests",
+			entry:   `{"name": "tool", "version": "v1.2.3", "digests": [` + digest + `,` + digest + `,` + digest + `]}`,
+			wantErr: true,
+		}, {
+			desc:    "bad digest",
+			entry:   `{"name": "tool", "version": "v1.2.3", "digests": ["abc"]}`,
+			wantErr: true,
+		}, {
+			desc:    "bad label",
+			entry:   `{"name": "tool", "version": "v1.2.3", "digests": [` + digest + `], "labels": {"os": 1}}`,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			err := p.Admit(context.Background(), Entry{Data: []byte(test.entry)})
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Admit: got err %v, want err %t", err, test.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrRejected) {
+				t.Errorf("Admit: got err %v, want ErrRejected", err)
+			}
+		})
+	}
+}
+
+func TestSchemaErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc   string
+		schema string
+	}{
+		{desc: "not JSON", schema: `{`},
+		{desc: "not an object", schema: `"object"`},
+		{desc: "unknown type", schema: `{"type": "float"}`},
+		{desc: "unsupported keyword", schema: `{"oneOf": [{"type": "string"}]}`},
+		{desc: "nested unsupported keyword", schema: `{"properties": {"a": {"$ref": "#"}}}`},
+		{desc: "bad pattern", schema: `{"pattern": "("}`},
+		{desc: "negative length", schema: `{"minLength": -1}`},
+		{desc: "bad required", schema: `{"required": "a"}`},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if _, err := Schema([]byte(test.schema)); err == nil {
+				t.Error("Schema: got nil err, want err")
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package compress provides helpers for storage implementations which store
+// tiles and leaf data compressed at rest.
+//
+// Compressed resources are self-describing, i.e. they're recognised by the
+// magic header bytes of their compression format, so logs may be served
+// directly to clients which use client.DecompressingFetcher.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algorithm identifies a compression algorithm.
+type Algorithm string
+
+const (
+	// None stores resources uncompressed.
+	None Algorithm = ""
+	// Gzip compresses resources with gzip.
+	Gzip Algorithm = "gzip"
+	// Zstd compresses resources with zstd.
+	Zstd Algorithm = "zstd"
+)
+
+var (
+	// gzipMagic is the header which starts every gzip stream.
+	gzipMagic = []byte{0x1f, 0x8b}
+	// zstdMagic is the header which starts every zstd frame.
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	// zstdEncoder and zstdDecoder are shared, their EncodeAll and DecodeAll
+	// methods are safe for concurrent use.
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil)
+	})
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+)
+
+// Parse returns the Algorithm with the given name, one of "none", "gzip", or
+// "zstd". The empty string is equivalent to "none".
+func Parse(name string) (Algorithm, error) {
+	switch name {
+	case "", "none":
+		return None, nil
+	case string(Gzip), string(Zstd):
+		return Algorithm(name), nil
+	}
+	return None, fmt.Errorf("unknown compression algorithm %q", name)
+}
+
+// ContentEncoding returns the value of the HTTP Content-Encoding header which
+// describes resources compressed with a, or the empty string for None.
+func (a Algorithm) ContentEncoding() string {
+	return string(a)
+}
+
+// Compress returns d compressed with a, or d itself if a is None.
+func Compress(a Algorithm, d []byte) ([]byte, error) {
+	switch a {
+	case None:
+		return d, nil
+	case Gzip:
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		if _, err := zw.Write(d); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	case Zstd:
+		ze, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return ze.EncodeAll(d, nil), nil
+	}
+	return nil, fmt.Errorf("unknown compression algorithm %q", a)
+}
+
+// Decompress returns the decompressed contents of d if it's gzip or zstd
+// compressed, or d otherwise.
+//
+// Since raw leaf data may happen to begin with the header of one of these
+// formats, this should only be used to read resources from logs which are
+// configured to compress their contents.
+func Decompress(d []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(d, gzipMagic):
+		zr, err := gzip.NewReader(bytes.NewReader(d))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case bytes.HasPrefix(d, zstdMagic):
+		zd, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return zd.DecodeAll(d, nil)
+	}
+	return d, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compress
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	d := bytes.Repeat([]byte("compressible leaf data "), 100)
+	for _, a := range []Algorithm{None, Gzip, Zstd} {
+		t.Run(string(a), func(t *testing.T) {
+			c, err := Compress(a, d)
+			if err != nil {
+				t.Fatalf("Compress: %v", err)
+			}
+			if a != None && len(c) >= len(d) {
+				t.Errorf("Compress: got %d bytes, want fewer than %d", len(c), len(d))
+			}
+			got, err := Decompress(c)
+			if err != nil {
+				t.Fatalf("Decompress: %v", err)
+			}
+			if !bytes.Equal(got, d) {
+				t.Errorf("Decompress: got %q, want %q", got, d)
+			}
+		})
+	}
+}
+
+func TestDecompressInvalid(t *testing.T) {
+	for _, d := range [][]byte{
+		append(append([]byte{}, gzipMagic...), "not gzip"...),
+		append(append([]byte{}, zstdMagic...), "not zstd"...),
+	} {
+		if _, err := Decompress(d); err == nil {
+			t.Errorf("Decompress(%x): got no error", d)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		want    Algorithm
+		wantErr bool
+	}{
+		{name: "", want: None},
+		{name: "none", want: None},
+		{name: "gzip", want: Gzip},
+		{name: "zstd", want: Zstd},
+		{name: "brotli", wantErr: true},
+	} {
+		got, err := Parse(test.name)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("Parse(%q): %v, want error %t", test.name, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Errorf("Parse(%q): got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package encrypt provides envelope encryption of a log's leaf data at rest,
+// for private logs, see api.Envelope.
+//
+// Each Encrypter generates a single random data key, which it wraps with a key
+// encryption key held by a KeyWrapper, e.g. a local key, see LocalKeys, or a
+// key in Cloud KMS, see the gcpkms package. The wrapped data key is stored
+// alongside each resource it encrypts.
+package encrypt
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/internal/encrypt/gcpkms"
+)
+
+// GCPKMSPrefix is the prefix of key specs which name a Cloud KMS key, see
+// NewKeyWrapper.
+const GCPKMSPrefix = "gcpkms://"
+
+// KeyWrapper wraps data keys with a key encryption key, and unwraps them again.
+type KeyWrapper interface {
+	client.KeyUnwrapper
+	// WrapKey returns the data key dek wrapped by the key encryption key, along
+	// with the ID of the key encryption key.
+	WrapKey(ctx context.Context, dek []byte) (keyID string, wrapped []byte, err error)
+}
+
+// NewKeyWrapper returns the KeyWrapper described by spec, which is either the
+// path of a file holding LocalKeys, or GCPKMSPrefix followed by the name of a
+// Cloud KMS key, e.g.
+// gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k.
+func NewKeyWrapper(ctx context.Context, spec string) (KeyWrapper, error) {
+	if name, ok := strings.CutPrefix(spec, GCPKMSPrefix); ok {
+		return gcpkms.NewKeyWrapper(ctx, name)
+	}
+	text, err := os.ReadFile(spec)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLocalKeys(string(text))
+}
+
+// Encrypter encrypts resources with a single data key, and decrypts resources
+// encrypted with any data key which its KeyWrapper can unwrap.
+//
+// It is safe for concurrent use.
+type Encrypter struct {
+	*client.Decrypter
+	w KeyWrapper
+
+	mu      sync.Mutex
+	dek     []byte
+	keyID   string
+	wrapped []byte
+}
+
+// New returns an Encrypter which wraps and unwraps data keys with w.
+func New(w KeyWrapper) *Encrypter {
+	return &Encrypter{Decrypter: client.NewDecrypter(w), w: w}
+}
+
+// Encrypt returns plaintext encrypted as a marshalled api.Envelope. The data
+// key is generated, and wrapped, the first time Encrypt is called.
+func (e *Encrypter) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	e.mu.Lock()
+	if e.dek == nil {
+		dek := make([]byte, api.DataKeySize)
+		if _, err := rand.Read(dek); err != nil {
+			e.mu.Unlock()
+			return nil, err
+		}
+		keyID, wrapped, err := e.w.WrapKey(ctx, dek)
+		if err != nil {
+			e.mu.Unlock()
+			return nil, fmt.Errorf("failed to wrap data key: %v", err)
+		}
+		e.dek, e.keyID, e.wrapped = dek, keyID, wrapped
+	}
+	dek, keyID, wrapped := e.dek, e.keyID, e.wrapped
+	e.mu.Unlock()
+
+	env, err := api.SealEnvelope(keyID, wrapped, dek, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return env.MarshalBinary()
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/transparency-dev/serverless-log/api"
+)
+
+// countingWrapper counts the number of data keys wrapped by a KeyWrapper.
+type countingWrapper struct {
+	KeyWrapper
+	wraps int
+}
+
+func (w *countingWrapper) WrapKey(ctx context.Context, dek []byte) (string, []byte, error) {
+	w.wraps++
+	return w.KeyWrapper.WrapKey(ctx, dek)
+}
+
+func mustGenerate(t *testing.T, name string) string {
+	t.Helper()
+	k, err := GenerateLocalKey(name)
+	if err != nil {
+		t.Fatalf("GenerateLocalKey(%q): %v", name, err)
+	}
+	return k
+}
+
+func mustParse(t *testing.T, text string) *LocalKeys {
+	t.Helper()
+	ks, err := ParseLocalKeys(text)
+	if err != nil {
+		t.Fatalf("ParseLocalKeys: %v", err)
+	}
+	return ks
+}
+
+func TestEncrypter(t *testing.T) {
+	ctx := context.Background()
+	w := &countingWrapper{KeyWrapper: mustParse(t, mustGenerate(t, "kek-1"))}
+	e := New(w)
+	for _, leaf := range []string{"one", "two", ""} {
+		raw, err := e.Encrypt(ctx, []byte(leaf))
+		if err != nil {
+			t.Fatalf("Encrypt(%q): %v", leaf, err)
+		}
+		if !api.IsEnvelope(raw) {
+			t.Fatalf("Encrypt(%q) = %q, not an envelope", leaf, raw)
+		}
+		got, err := e.Decrypt(ctx, raw)
+		if err != nil {
+			t.Fatalf("Decrypt(%q): %v", leaf, err)
+		}
+		if string(got) != leaf {
+			t.Errorf("Decrypt() = %q, want %q", got, leaf)
+		}
+	}
+	if w.wraps != 1 {
+		t.Errorf("wrapped %d data keys, want 1", w.wraps)
+	}
+
+	// Unencrypted resources are returned unmodified.
+	got, err := e.Decrypt(ctx, []byte("plaintext"))
+	if err != nil || string(got) != "plaintext" {
+		t.Errorf("Decrypt(plaintext) = %q, %v", got, err)
+	}
+}
+
+func TestLocalKeys(t *testing.T) {
+	ctx := context.Background()
+	k1, k2 := mustGenerate(t, "kek-1"), mustGenerate(t, "kek-2")
+	old := New(mustParse(t, k1))
+	raw, err := old.Encrypt(ctx, []byte("leaf"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc    string
+		keys    string
+		wantErr bool
+	}{
+		{
+			desc: "same key",
+			keys: k1,
+		}, {
+			desc: "rotated",
+			keys: k2 + "\n" + k1 + "\n",
+		}, {
+			desc:    "different key",
+			keys:    k2,
+			wantErr: true,
+		}, {
+			desc:    "different key with same name",
+			keys:    mustGenerate(t, "kek-1"),
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := New(mustParse(t, test.keys)).Decrypt(ctx, raw)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Decrypt() = %v, want err %t", err, test.wantErr)
+			}
+		})
+	}
+
+	// New data keys are wrapped with the first key.
+	rotated := mustParse(t, k2+"\n"+k1)
+	keyID, _, err := rotated.WrapKey(ctx, bytes.Repeat([]byte{1}, api.DataKeySize))
+	if err != nil || keyID != "kek-2" {
+		t.Errorf("WrapKey() = %q, %v, want kek-2", keyID, err)
+	}
+}
+
+func TestParseLocalKeys(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		text    string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			text: "ENCRYPTION+KEY+kek+AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n",
+		}, {
+			desc:    "empty",
+			text:    "\n",
+			wantErr: true,
+		}, {
+			desc:    "signing key",
+			text:    "PRIVATE+KEY+log+0d1a2b3c+AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",
+			wantErr: true,
+		}, {
+			desc:    "short key",
+			text:    "ENCRYPTION+KEY+kek+AAAA",
+			wantErr: true,
+		}, {
+			desc:    "missing name",
+			text:    "ENCRYPTION+KEY++AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := ParseLocalKeys(test.text)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseLocalKeys() = %v, want err %t", err, test.wantErr)
+			}
+		})
+	}
+}
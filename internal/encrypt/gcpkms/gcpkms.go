@@ -0,0 +1,149 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gcpkms provides wrapping of data keys with a symmetric key encryption
+// key held in Google Cloud KMS, for envelope encryption of a log's leaf data.
+//
+// The KMS REST API is used directly, authenticating with Application Default
+// Credentials, to avoid depending on the Cloud client libraries.
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	// DefaultEndpoint is the Cloud KMS REST API endpoint.
+	DefaultEndpoint = "https://cloudkms.googleapis.com/v1/"
+
+	scope = "https://www.googleapis.com/auth/cloudkms"
+)
+
+// Option is used to configure optional behaviour of NewKeyWrapper.
+type Option func(*opts)
+
+type opts struct {
+	client   *http.Client
+	endpoint string
+}
+
+// WithHTTPClient causes requests to Cloud KMS to be made with c, which must
+// add any required credentials, rather than with Application Default
+// Credentials.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *opts) {
+		o.client = c
+	}
+}
+
+// WithEndpoint causes requests to be sent to the given Cloud KMS REST API
+// endpoint, rather than DefaultEndpoint.
+func WithEndpoint(e string) Option {
+	return func(o *opts) {
+		o.endpoint = e
+	}
+}
+
+// KeyWrapper wraps and unwraps data keys with a Cloud KMS key.
+type KeyWrapper struct {
+	client *http.Client
+	url    string
+	name   string
+}
+
+// NewKeyWrapper returns a KeyWrapper which uses the Cloud KMS key name, e.g.
+// projects/p/locations/l/keyRings/r/cryptoKeys/k, which must be a symmetric
+// encryption key (GOOGLE_SYMMETRIC_ENCRYPTION). Data keys are wrapped with the
+// key's primary version, and the key's name is used as its ID.
+func NewKeyWrapper(ctx context.Context, name string, options ...Option) (*KeyWrapper, error) {
+	o := &opts{endpoint: DefaultEndpoint}
+	for _, opt := range options {
+		opt(o)
+	}
+	if o.client == nil {
+		c, err := google.DefaultClient(ctx, scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create authenticated HTTP client: %v", err)
+		}
+		o.client = c
+	}
+	return &KeyWrapper{
+		client: o.client,
+		url:    strings.TrimSuffix(o.endpoint, "/") + "/" + name,
+		name:   name,
+	}, nil
+}
+
+// WrapKey wraps dek using the key's primary version.
+func (k *KeyWrapper) WrapKey(ctx context.Context, dek []byte) (string, []byte, error) {
+	var resp struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	if err := k.call(ctx, ":encrypt", map[string]any{"plaintext": dek}, &resp); err != nil {
+		return "", nil, fmt.Errorf("failed to encrypt: %v", err)
+	}
+	return k.name, resp.Ciphertext, nil
+}
+
+// UnwrapKey unwraps a data key which was wrapped by WrapKey. KMS finds the key
+// version which wrapped it, so data keys remain readable after the key is
+// rotated.
+func (k *KeyWrapper) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	if keyID != k.name {
+		return nil, fmt.Errorf("data key was wrapped with %q, not %q", keyID, k.name)
+	}
+	var resp struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	if err := k.call(ctx, ":decrypt", map[string]any{"ciphertext": wrapped}, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %v", err)
+	}
+	return resp.Plaintext, nil
+}
+
+// call makes a POST request to the key's URL with the given suffix, sending
+// req and decoding the response into resp. []byte fields are base64 encoded
+// by encoding/json, as required by the API.
+func (k *KeyWrapper) call(ctx context.Context, suffix string, req, resp any) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, k.url+suffix, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	rsp, err := k.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	b, err = io.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("POST %s: %s: %s", k.url+suffix, rsp.Status, bytes.TrimSpace(b))
+	}
+	return json.Unmarshal(b, resp)
+}
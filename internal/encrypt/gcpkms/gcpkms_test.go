@@ -0,0 +1,115 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const keyName = "projects/p/locations/l/keyRings/r/cryptoKeys/k"
+
+// fakeKMS returns a server implementing the Cloud KMS encrypt and decrypt
+// methods for a single key, which "encrypts" by prefixing the plaintext.
+func fakeKMS(t *testing.T) *httptest.Server {
+	t.Helper()
+	prefix := []byte("wrapped:")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+keyName+":encrypt", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Plaintext []byte `json:"plaintext"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"name":       keyName + "/cryptoKeyVersions/1",
+			"ciphertext": append(prefix, req.Plaintext...),
+		})
+	})
+	mux.HandleFunc("/"+keyName+":decrypt", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Ciphertext []byte `json:"ciphertext"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p, ok := bytes.CutPrefix(req.Ciphertext, prefix)
+		if !ok {
+			http.Error(w, "Decryption failed", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]byte{"plaintext": p})
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestKeyWrapper(t *testing.T) {
+	ctx := context.Background()
+	s := fakeKMS(t)
+	k, err := NewKeyWrapper(ctx, keyName, WithHTTPClient(s.Client()), WithEndpoint(s.URL))
+	if err != nil {
+		t.Fatalf("NewKeyWrapper: %v", err)
+	}
+	dek := []byte("data key")
+	keyID, wrapped, err := k.WrapKey(ctx, dek)
+	if err != nil {
+		t.Fatalf("WrapKey: %v", err)
+	}
+	if keyID != keyName {
+		t.Errorf("WrapKey() key ID = %q, want %q", keyID, keyName)
+	}
+
+	for _, test := range []struct {
+		desc    string
+		keyID   string
+		wrapped []byte
+		wantErr bool
+	}{
+		{
+			desc:    "valid",
+			keyID:   keyID,
+			wrapped: wrapped,
+		}, {
+			desc:    "other key",
+			keyID:   "projects/p/locations/l/keyRings/r/cryptoKeys/other",
+			wrapped: wrapped,
+			wantErr: true,
+		}, {
+			desc:    "corrupt",
+			keyID:   keyID,
+			wrapped: []byte("garbage"),
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := k.UnwrapKey(ctx, test.keyID, test.wrapped)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("UnwrapKey() = %v, want err %t", err, test.wantErr)
+			}
+			if err == nil && !bytes.Equal(got, dek) {
+				t.Errorf("UnwrapKey() = %q, want %q", got, dek)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/transparency-dev/serverless-log/api"
+)
+
+// localKeyPrefix starts the text form of every local key encryption key.
+const localKeyPrefix = "ENCRYPTION+KEY+"
+
+// LocalKeys is a set of AES-256 key encryption keys held locally, e.g. in a
+// file, rather than in a KMS. Data keys are wrapped with the first key, and
+// may be unwrapped with any of them, so keys can be rotated by adding a new key
+// to the start of the set.
+type LocalKeys struct {
+	keys []localKey
+}
+
+type localKey struct {
+	name string
+	aead cipher.AEAD
+}
+
+// GenerateLocalKey returns the text form of a new random key encryption key
+// with the given name, see ParseLocalKeys.
+func GenerateLocalKey(name string) (string, error) {
+	if err := checkKeyName(name); err != nil {
+		return "", err
+	}
+	k := make([]byte, api.DataKeySize)
+	if _, err := rand.Read(k); err != nil {
+		return "", err
+	}
+	return localKeyPrefix + name + "+" + base64.StdEncoding.EncodeToString(k), nil
+}
+
+// ParseLocalKeys parses a set of local key encryption keys, one per line, each
+// in the form returned by GenerateLocalKey. Blank lines are ignored.
+func ParseLocalKeys(text string) (*LocalKeys, error) {
+	var ks LocalKeys
+	for _, l := range strings.Split(text, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		rest, ok := strings.CutPrefix(l, localKeyPrefix)
+		name, b64, ok2 := strings.Cut(rest, "+")
+		if !ok || !ok2 || checkKeyName(name) != nil {
+			return nil, errors.New("invalid encryption key")
+		}
+		k, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil || len(k) != api.DataKeySize {
+			return nil, fmt.Errorf("invalid encryption key %q", name)
+		}
+		b, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(b)
+		if err != nil {
+			return nil, err
+		}
+		ks.keys = append(ks.keys, localKey{name: name, aead: aead})
+	}
+	if len(ks.keys) == 0 {
+		return nil, errors.New("no encryption keys found")
+	}
+	return &ks, nil
+}
+
+// WrapKey implements KeyWrapper, wrapping dek with the first key in the set.
+// The key's name is used as its ID.
+func (ks *LocalKeys) WrapKey(_ context.Context, dek []byte) (string, []byte, error) {
+	k := ks.keys[0]
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return k.name, k.aead.Seal(nonce, nonce, dek, []byte(k.name)), nil
+}
+
+// UnwrapKey implements client.KeyUnwrapper.
+func (ks *LocalKeys) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	for _, k := range ks.keys {
+		if k.name != keyID {
+			continue
+		}
+		n := k.aead.NonceSize()
+		if len(wrapped) < n {
+			return nil, errors.New("wrapped key too short")
+		}
+		return k.aead.Open(nil, wrapped[:n], wrapped[n:], []byte(k.name))
+	}
+	return nil, fmt.Errorf("unknown encryption key %q", keyID)
+}
+
+// checkKeyName returns an error if name can't be used as the name of a local
+// key.
+func checkKeyName(name string) error {
+	if name == "" || strings.ContainsAny(name, "+ \t\n") {
+		return fmt.Errorf("invalid key name %q", name)
+	}
+	return nil
+}
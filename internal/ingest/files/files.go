@@ -0,0 +1,293 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package files provides ingest.Queues which read entries from the files in a
+// directory or a tar archive, e.g. to populate a new log, or to migrate the
+// entries of an existing one.
+//
+// Entries are read in a fixed order, and the number which have been
+// acknowledged can be recorded in a progress file, so that an interrupted
+// run resumes where it left off.
+package files
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/transparency-dev/serverless-log/internal/ingest"
+	"k8s.io/klog/v2"
+)
+
+// reportInterval is how often progress is logged.
+const reportInterval = 10 * time.Second
+
+// Option is used to configure optional behaviour of a Source.
+type Option func(*Source)
+
+// WithProgressFile causes the Source to record the number of entries which
+// have been acknowledged in the file at path, and to skip that many entries
+// when it's opened. The file is created if it doesn't exist.
+func WithProgressFile(path string) Option {
+	return func(s *Source) {
+		s.progressFile = path
+	}
+}
+
+// Source is an ingest.Queue which delivers the files in a directory or tar
+// archive as messages, with each message's ID being the path of its file.
+//
+// Messages are delivered once, in order, so the number of entries read is a
+// complete record of the progress made.
+type Source struct {
+	// next returns the name and contents of the next entry, or io.EOF if
+	// there are no more.
+	next  func() (string, []byte, error)
+	close func() error
+	// total is the number of entries, or -1 if it's not known in advance.
+	total int
+
+	progressFile string
+	// pulled and acked are the numbers of entries which have been pulled and
+	// acknowledged.
+	pulled, acked int
+	// resumed is the number of entries skipped when the Source was opened.
+	resumed  int
+	start    time.Time
+	reported time.Time
+}
+
+// OpenDir returns a Source which delivers the regular files under the
+// directory root, recursively, in lexical order of their paths. Files and
+// directories whose names start with a dot are skipped.
+func OpenDir(root string, opts ...Option) (*Source, error) {
+	var paths []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %q: %v", root, err)
+	}
+	i := 0
+	next := func() (string, []byte, error) {
+		if i >= len(paths) {
+			return "", nil, io.EOF
+		}
+		p := paths[i]
+		i++
+		b, err := os.ReadFile(p)
+		return p, b, err
+	}
+	return newSource(next, func() error { return nil }, len(paths), opts)
+}
+
+// OpenTar returns a Source which delivers the regular files in the tar
+// archive at path, in the order in which they appear. The archive is gzip
+// decompressed if path ends in .gz or .tgz.
+func OpenTar(p string, opts ...Option) (*Source, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = f
+	if ext := path.Ext(p); ext == ".gz" || ext == ".tgz" {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to decompress %q: %v", p, err)
+		}
+		r = zr
+	}
+	tr := tar.NewReader(r)
+	next := func() (string, []byte, error) {
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				return "", nil, err
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to read %q: %v", hdr.Name, err)
+			}
+			return hdr.Name, b, nil
+		}
+	}
+	s, err := newSource(next, f.Close, -1, opts)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func newSource(next func() (string, []byte, error), close func() error, total int, opts []Option) (*Source, error) {
+	s := &Source{next: next, close: close, total: total}
+	for _, o := range opts {
+		o(s)
+	}
+	if err := s.resume(); err != nil {
+		return nil, err
+	}
+	s.start, s.reported = time.Now(), time.Now()
+	return s, nil
+}
+
+// resume skips the entries recorded in the progress file, if any, checking
+// that the last one skipped is the last one which was acknowledged.
+func (s *Source) resume() error {
+	if s.progressFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(s.progressFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read progress file: %v", err)
+	}
+	n, last, err := parseProgress(b)
+	if err != nil {
+		return fmt.Errorf("invalid progress file %q: %v", s.progressFile, err)
+	}
+	var name string
+	for s.pulled < n {
+		if name, _, err = s.next(); err != nil {
+			return fmt.Errorf("failed to skip %d entries recorded in progress file: %v", n, err)
+		}
+		s.pulled++
+	}
+	if name != last {
+		return fmt.Errorf("entry %d is %q, but progress file records %q; have the entries changed?", n, name, last)
+	}
+	s.acked, s.resumed = n, n
+	if n > 0 {
+		klog.Infof("Resuming after %d entries, the last of which was %q", n, last)
+	}
+	return nil
+}
+
+// Pull implements ingest.Queue.
+func (s *Source) Pull(ctx context.Context, max int) ([]ingest.Message, error) {
+	var msgs []ingest.Message
+	for len(msgs) < max {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		name, b, err := s.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, ingest.Message{ID: name, Data: b, Handle: strconv.Itoa(s.pulled)})
+		s.pulled++
+	}
+	return msgs, nil
+}
+
+// Ack implements ingest.Queue, recording the progress made in the progress
+// file, if any.
+func (s *Source) Ack(_ context.Context, msgs []ingest.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	last := msgs[len(msgs)-1]
+	i, err := strconv.Atoi(last.Handle)
+	if err != nil {
+		return fmt.Errorf("invalid handle %q: %v", last.Handle, err)
+	}
+	s.acked = i + 1
+	if s.progressFile != "" {
+		if err := writeProgress(s.progressFile, s.acked, last.ID); err != nil {
+			return fmt.Errorf("failed to record progress: %v", err)
+		}
+	}
+	if time.Since(s.reported) >= reportInterval {
+		s.report()
+	}
+	return nil
+}
+
+// Close releases the Source's resources, and logs the progress made.
+func (s *Source) Close() error {
+	s.report()
+	return s.close()
+}
+
+// report logs the progress made.
+func (s *Source) report() {
+	s.reported = time.Now()
+	n := s.acked - s.resumed
+	rate := float64(n) / time.Since(s.start).Seconds()
+	if s.total < 0 {
+		klog.Infof("Sequenced %d entries (%.0f/s)", s.acked, rate)
+		return
+	}
+	pct := 100.0
+	if s.total > 0 {
+		pct = 100 * float64(s.acked) / float64(s.total)
+	}
+	eta := ""
+	if rate > 0 && s.acked < s.total {
+		eta = fmt.Sprintf(", %v remaining", (time.Duration(float64(s.total-s.acked)/rate) * time.Second).Round(time.Second))
+	}
+	klog.Infof("Sequenced %d of %d entries (%.1f%%, %.0f/s%s)", s.acked, s.total, pct, rate, eta)
+}
+
+// parseProgress parses the contents of a progress file, which holds the number
+// of entries acknowledged, and the name of the last of them, on one line.
+func parseProgress(b []byte) (int, string, error) {
+	c, name, ok := strings.Cut(strings.TrimSuffix(string(b), "\n"), " ")
+	if !ok {
+		return 0, "", errors.New("want \"<count> <name>\"")
+	}
+	n, err := strconv.Atoi(c)
+	if err != nil || n < 0 {
+		return 0, "", fmt.Errorf("invalid count %q", c)
+	}
+	return n, name, nil
+}
+
+// writeProgress atomically replaces the progress file at p.
+func writeProgress(p string, n int, name string) error {
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %s\n", n, name)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
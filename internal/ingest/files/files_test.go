@@ -0,0 +1,220 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package files
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/serverless-log/internal/ingest"
+)
+
+// receive drains s, failing on the entry named failOn, and returns the names
+// of the entries handled.
+func receive(t *testing.T, s *Source, failOn string) ([]string, error) {
+	t.Helper()
+	var got []string
+	err := ingest.NewReceiver(s).Receive(context.Background(), func(_ context.Context, m ingest.Message) error {
+		if m.ID == failOn {
+			return errors.New("failed")
+		}
+		got = append(got, m.ID)
+		return nil
+	})
+	return got, err
+}
+
+func TestOpenDir(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "entries")
+	for _, p := range []string{"b", "a/2", "a/1", "c/d/e", ".hidden", ".git/config"} {
+		p = filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(p), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	progress := filepath.Join(dir, "progress")
+	all := []string{"a/1", "a/2", "b", "c/d/e"}
+	for i := range all {
+		all[i] = filepath.Join(root, all[i])
+	}
+
+	// The first run fails part way through.
+	s, err := OpenDir(root, WithProgressFile(progress))
+	if err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	got, err := receive(t, s, all[2])
+	if err == nil {
+		t.Fatal("Receive: got nil err, want err")
+	}
+	if diff := cmp.Diff(all[:2], got); diff != "" {
+		t.Errorf("First run diff (-want +got):\n%s", diff)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// The second run resumes from the failed entry.
+	s, err = OpenDir(root, WithProgressFile(progress))
+	if err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	got, err = receive(t, s, "")
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if diff := cmp.Diff(all[2:], got); diff != "" {
+		t.Errorf("Second run diff (-want +got):\n%s", diff)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// A third run finds nothing more to do.
+	s, err = OpenDir(root, WithProgressFile(progress))
+	if err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	if got, err = receive(t, s, ""); err != nil || len(got) != 0 {
+		t.Errorf("Receive: got %v, %v, want no entries", got, err)
+	}
+
+	// If the entries change, the progress file no longer applies.
+	if err := os.Remove(all[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenDir(root, WithProgressFile(progress)); err == nil {
+		t.Error("OpenDir with changed entries: got nil err, want err")
+	}
+}
+
+func TestOpenTar(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"z", "a", "m/1"}
+	for _, test := range []struct {
+		desc string
+		name string
+		gz   bool
+	}{
+		{desc: "tar", name: "entries.tar"},
+		{desc: "gzipped", name: "entries.tar.gz", gz: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			p := filepath.Join(dir, test.name)
+			writeTar(t, p, test.gz, names)
+			progress := p + ".progress"
+			s, err := OpenTar(p, WithProgressFile(progress))
+			if err != nil {
+				t.Fatalf("OpenTar: %v", err)
+			}
+			got, err := receive(t, s, "m/1")
+			if err == nil {
+				t.Fatal("Receive: got nil err, want err")
+			}
+			if diff := cmp.Diff(names[:2], got); diff != "" {
+				t.Errorf("First run diff (-want +got):\n%s", diff)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			s, err = OpenTar(p, WithProgressFile(progress))
+			if err != nil {
+				t.Fatalf("OpenTar: %v", err)
+			}
+			defer s.Close()
+			got, err = receive(t, s, "")
+			if err != nil {
+				t.Fatalf("Receive: %v", err)
+			}
+			if diff := cmp.Diff(names[2:], got); diff != "" {
+				t.Errorf("Second run diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// writeTar writes a tar archive at p holding a file for each name, along with
+// a directory entry which should be skipped.
+func writeTar(t *testing.T, p string, gz bool, names []string) {
+	t.Helper()
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	var zw *gzip.Writer
+	if gz {
+		zw = gzip.NewWriter(f)
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "m/", Mode: 0o755}); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range names {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: n, Mode: 0o644, Size: int64(len(n))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseProgress(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		text     string
+		wantN    int
+		wantName string
+		wantErr  bool
+	}{
+		{desc: "valid", text: "12 a/b c\n", wantN: 12, wantName: "a/b c"},
+		{desc: "no name", text: "12\n", wantErr: true},
+		{desc: "bad count", text: "x a\n", wantErr: true},
+		{desc: "negative count", text: "-1 a\n", wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			n, name, err := parseProgress([]byte(test.text))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("parseProgress: got err %v, want err %t", err, test.wantErr)
+			}
+			if n != test.wantN || name != test.wantName {
+				t.Errorf("parseProgress: got %d, %q, want %d, %q", n, name, test.wantN, test.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ingest provides support for sequencing entries consumed from message
+// queues and streams, such as Pub/Sub, SQS, or Kafka, rather than submitted via
+// a synchronous add endpoint.
+//
+// Each source of entries implements Queue, and a Receiver drains a Queue,
+// handing each entry to the sequencer and acknowledging it once it has been
+// sequenced.
+package ingest
+
+import (
+	"context"
+
+	"k8s.io/klog/v2"
+)
+
+// defaultDedupSize is the default number of message IDs remembered by a
+// Receiver, see WithDedupSize.
+const defaultDedupSize = 10000
+
+// pullSize is the maximum number of messages requested by each pull. Queues
+// may return fewer.
+const pullSize = 100
+
+// Message is an entry received from a Queue.
+type Message struct {
+	// ID identifies the message within its queue, and is the same each time
+	// the message is delivered.
+	ID string
+	// Data is the entry to be sequenced.
+	Data []byte
+	// Handle is used by the Queue to acknowledge the message. It may differ
+	// each time the message is delivered.
+	Handle string
+}
+
+// Queue is a source of entries to be sequenced, which delivers each of its
+// messages at least once.
+type Queue interface {
+	// Pull returns up to max messages which are waiting, or none if there are
+	// none waiting. Messages which have been pulled but are not acknowledged
+	// will be delivered again.
+	Pull(ctx context.Context, max int) ([]Message, error)
+
+	// Ack acknowledges messages returned by Pull once they've been handled,
+	// so that they're not delivered again. Messages are acknowledged in the
+	// order in which they were pulled.
+	Ack(ctx context.Context, msgs []Message) error
+}
+
+// Option is used to configure optional behaviour of a Receiver.
+type Option func(*Receiver)
+
+// WithMaxMessages causes Receive to return once it has handled n messages,
+// even if more are waiting, so that a sequencer which is kept busy by a steady
+// stream of submissions still lets the log be integrated. Zero, the default,
+// means there is no limit.
+func WithMaxMessages(n int) Option {
+	return func(r *Receiver) {
+		r.maxMessages = n
+	}
+}
+
+// WithDedupSize sets the number of recently handled message IDs remembered by
+// the Receiver, see Receive. The default is 10000.
+func WithDedupSize(n int) Option {
+	return func(r *Receiver) {
+		r.seen = newIDSet(n)
+	}
+}
+
+// Receiver drains a Queue.
+type Receiver struct {
+	q           Queue
+	maxMessages int
+	seen        *idSet
+}
+
+// NewReceiver returns a Receiver which drains q.
+func NewReceiver(q Queue, opts ...Option) *Receiver {
+	r := &Receiver{q: q}
+	for _, o := range opts {
+		o(r)
+	}
+	if r.seen == nil {
+		r.seen = newIDSet(defaultDedupSize)
+	}
+	return r
+}
+
+// Receive drains the queue, calling f with each message, and returns once no
+// more messages are waiting, or once the limit set by WithMaxMessages is
+// reached.
+//
+// Messages are acknowledged once f has returned successfully for them. If f
+// returns an error, Receive acknowledges the messages which were handled
+// before it, and returns the error; the failed message will be redelivered.
+//
+// Queues deliver messages at least once, so a message may be redelivered, e.g.
+// if its acknowledgement was lost. Messages whose ID has recently been handled
+// by the Receiver are acknowledged without calling f again.
+func (r *Receiver) Receive(ctx context.Context, f func(ctx context.Context, m Message) error) error {
+	handled := 0
+	for r.maxMessages == 0 || handled < r.maxMessages {
+		n := pullSize
+		if r.maxMessages > 0 && r.maxMessages-handled < n {
+			n = r.maxMessages - handled
+		}
+		msgs, err := r.q.Pull(ctx, n)
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+		// Some queues may return more messages than were asked for, those
+		// beyond the limit are left to be redelivered.
+		if len(msgs) > n {
+			msgs = msgs[:n]
+		}
+		for i, m := range msgs {
+			if r.seen.contains(m.ID) {
+				klog.V(1).Infof("Skipping redelivered message %s", m.ID)
+				continue
+			}
+			if err := f(ctx, m); err != nil {
+				if ackErr := r.q.Ack(ctx, msgs[:i]); ackErr != nil {
+					klog.Warningf("Failed to acknowledge handled messages: %v", ackErr)
+				}
+				return err
+			}
+			r.seen.add(m.ID)
+			handled++
+		}
+		if err := r.q.Ack(ctx, msgs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// idSet is a set of strings which remembers only the most recently added
+// entries.
+type idSet struct {
+	ids   map[string]bool
+	order []string
+	next  int
+}
+
+func newIDSet(size int) *idSet {
+	return &idSet{ids: make(map[string]bool), order: make([]string, size)}
+}
+
+func (s *idSet) contains(id string) bool {
+	return s.ids[id]
+}
+
+// add adds id to the set, evicting the oldest entry if the set is full.
+func (s *idSet) add(id string) {
+	if len(s.order) == 0 || s.ids[id] {
+		return
+	}
+	delete(s.ids, s.order[s.next])
+	s.order[s.next] = id
+	s.ids[id] = true
+	s.next = (s.next + 1) % len(s.order)
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeQueue delivers the queued messages, in batches of at most batchSize (or
+// the requested size, if batchSize is zero), until they're acknowledged.
+type fakeQueue struct {
+	queue      []Message
+	pending    map[string]Message
+	acked      []string
+	batchSize  int
+	nextHandle int
+}
+
+func newFakeQueue(batchSize int, msgs ...Message) *fakeQueue {
+	return &fakeQueue{queue: msgs, pending: make(map[string]Message), batchSize: batchSize}
+}
+
+func (q *fakeQueue) Pull(_ context.Context, max int) ([]Message, error) {
+	if q.batchSize > 0 {
+		max = q.batchSize
+	}
+	var msgs []Message
+	for len(q.queue) > 0 && len(msgs) < max {
+		m := q.queue[0]
+		q.queue = q.queue[1:]
+		m.Handle = fmt.Sprintf("handle-%d", q.nextHandle)
+		q.nextHandle++
+		q.pending[m.Handle] = m
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+func (q *fakeQueue) Ack(_ context.Context, msgs []Message) error {
+	for _, m := range msgs {
+		if _, ok := q.pending[m.Handle]; !ok {
+			return fmt.Errorf("unknown handle %q", m.Handle)
+		}
+		delete(q.pending, m.Handle)
+		q.acked = append(q.acked, m.ID)
+	}
+	return nil
+}
+
+func TestReceive(t *testing.T) {
+	errBoom := errors.New("boom")
+	msgs := []Message{{ID: "1", Data: []byte("one")}, {ID: "2", Data: []byte("two")}, {ID: "1", Data: []byte("one")}, {ID: "3", Data: []byte("three")}}
+	for _, test := range []struct {
+		desc        string
+		opts        []Option
+		batchSize   int
+		failOn      string
+		wantData    []string
+		wantAcked   []string
+		wantErr     error
+		wantPending int
+	}{
+		{
+			desc:      "drains and deduplicates",
+			wantData:  []string{"one", "two", "three"},
+			wantAcked: []string{"1", "2", "1", "3"},
+		}, {
+			desc:      "small batches",
+			batchSize: 1,
+			wantData:  []string{"one", "two", "three"},
+			wantAcked: []string{"1", "2", "1", "3"},
+		}, {
+			desc:        "max messages",
+			opts:        []Option{WithMaxMessages(2)},
+			wantData:    []string{"one", "two"},
+			wantAcked:   []string{"1", "2"},
+			wantPending: 2,
+		}, {
+			desc:        "max messages with oversized batches",
+			opts:        []Option{WithMaxMessages(2)},
+			batchSize:   4,
+			wantData:    []string{"one", "two"},
+			wantAcked:   []string{"1", "2"},
+			wantPending: 2,
+		}, {
+			desc:        "handler fails",
+			failOn:      "two",
+			wantData:    []string{"one"},
+			wantAcked:   []string{"1"},
+			wantErr:     errBoom,
+			wantPending: 3,
+		}, {
+			desc:      "no dedup",
+			opts:      []Option{WithDedupSize(0)},
+			wantData:  []string{"one", "two", "one", "three"},
+			wantAcked: []string{"1", "2", "1", "3"},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			q := newFakeQueue(test.batchSize, msgs...)
+			var got []string
+			err := NewReceiver(q, test.opts...).Receive(context.Background(), func(_ context.Context, m Message) error {
+				if string(m.Data) == test.failOn {
+					return errBoom
+				}
+				got = append(got, string(m.Data))
+				return nil
+			})
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Receive: got err %v, want %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.wantData, got); diff != "" {
+				t.Errorf("Receive: handled data diff (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantAcked, q.acked); diff != "" {
+				t.Errorf("Receive: acked diff (-want +got):\n%s", diff)
+			}
+			if got := len(q.pending) + len(q.queue); got != test.wantPending {
+				t.Errorf("Receive: %d messages left unacknowledged, want %d", got, test.wantPending)
+			}
+		})
+	}
+}
+
+func TestIDSet(t *testing.T) {
+	s := newIDSet(2)
+	for _, id := range []string{"a", "b", "b", "c"} {
+		s.add(id)
+	}
+	for id, want := range map[string]bool{"a": false, "b": true, "c": true} {
+		if got := s.contains(id); got != want {
+			t.Errorf("contains(%q) = %t, want %t", id, got, want)
+		}
+	}
+}
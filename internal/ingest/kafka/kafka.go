@@ -0,0 +1,261 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kafka provides an ingest.Queue which consumes entries from a Kafka
+// topic, each as the value of a record.
+//
+// Records are consumed via the v2 API of the Kafka REST Proxy, or a compatible
+// HTTP proxy such as Redpanda's, to avoid depending on a Kafka client library.
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/transparency-dev/serverless-log/internal/ingest"
+)
+
+const (
+	// contentType is the media type of requests to the proxy's v2 API.
+	contentType = "application/vnd.kafka.v2+json"
+	// binaryType is the media type of binary records fetched from the proxy.
+	binaryType = "application/vnd.kafka.binary.v2+json"
+
+	// fetchTimeout is how long the proxy waits for records to arrive on each
+	// fetch.
+	fetchTimeout = time.Second
+	// defaultJoinTimeout is the default value of WithJoinTimeout.
+	defaultJoinTimeout = 10 * time.Second
+)
+
+// Option is used to configure optional behaviour of NewConsumer.
+type Option func(*Consumer)
+
+// WithHTTPClient causes requests to the proxy to be made with c rather than
+// http.DefaultClient, e.g. to add credentials.
+func WithHTTPClient(c *http.Client) Option {
+	return func(k *Consumer) {
+		k.client = c
+	}
+}
+
+// WithJoinTimeout sets how long Pull waits for the consumer to be assigned
+// partitions of the topic, and so to receive its first records, before
+// reporting that no records are waiting. The default is 10 seconds.
+func WithJoinTimeout(d time.Duration) Option {
+	return func(k *Consumer) {
+		k.joinTimeout = d
+	}
+}
+
+// Consumer is a member of a Kafka consumer group, which consumes records from
+// a topic via a REST proxy.
+//
+// Offsets are committed when records are acknowledged, so that each run of the
+// sequencer resumes where the last one left off.
+type Consumer struct {
+	client      *http.Client
+	baseURI     string
+	joinTimeout time.Duration
+	// joinBy is the time until which Pull waits for the first records.
+	joinBy time.Time
+	// joined is set once records have been received.
+	joined bool
+}
+
+var _ ingest.Queue = &Consumer{}
+
+// NewConsumer creates a consumer in the named consumer group of the proxy at
+// proxyURL, e.g. http://localhost:8082, and subscribes it to topic.
+//
+// The consumer starts from the group's committed offsets, or from the earliest
+// records if the group has none. It should be removed with Close when it's no
+// longer needed.
+func NewConsumer(ctx context.Context, proxyURL, group, topic string, opts ...Option) (*Consumer, error) {
+	k := &Consumer{client: http.DefaultClient, joinTimeout: defaultJoinTimeout}
+	for _, o := range opts {
+		o(k)
+	}
+	var resp struct {
+		InstanceID string `json:"instance_id"`
+		BaseURI    string `json:"base_uri"`
+	}
+	u := strings.TrimSuffix(proxyURL, "/") + "/consumers/" + url.PathEscape(group)
+	if err := k.call(ctx, http.MethodPost, u, map[string]string{
+		"format":             "binary",
+		"auto.offset.reset":  "earliest",
+		"auto.commit.enable": "false",
+	}, &resp); err != nil {
+		return nil, fmt.Errorf("failed to create consumer: %v", err)
+	}
+	k.baseURI = resp.BaseURI
+	if err := k.call(ctx, http.MethodPost, k.baseURI+"/subscription", map[string][]string{"topics": {topic}}, nil); err != nil {
+		_ = k.Close(ctx)
+		return nil, fmt.Errorf("failed to subscribe to %q: %v", topic, err)
+	}
+	k.joinBy = time.Now().Add(k.joinTimeout)
+	return k, nil
+}
+
+// Pull implements ingest.Queue. The proxy doesn't limit the number of records
+// returned, so more than max records may be returned.
+//
+// Until the consumer first receives records, Pull keeps fetching until the
+// timeout set by WithJoinTimeout has passed, since the proxy returns no records
+// while the consumer group is being rebalanced.
+func (k *Consumer) Pull(ctx context.Context, _ int) ([]ingest.Message, error) {
+	for {
+		var resp []struct {
+			Topic     string `json:"topic"`
+			Value     []byte `json:"value"`
+			Partition int32  `json:"partition"`
+			Offset    int64  `json:"offset"`
+		}
+		u := fmt.Sprintf("%s/records?timeout=%d", k.baseURI, fetchTimeout.Milliseconds())
+		if err := k.call(ctx, http.MethodGet, u, nil, &resp); err != nil {
+			return nil, fmt.Errorf("failed to fetch records: %v", err)
+		}
+		if len(resp) == 0 && !k.joined && time.Now().Before(k.joinBy) {
+			continue
+		}
+		msgs := make([]ingest.Message, 0, len(resp))
+		for _, r := range resp {
+			id := fmt.Sprintf("%s/%d/%d", r.Topic, r.Partition, r.Offset)
+			msgs = append(msgs, ingest.Message{ID: id, Data: r.Value, Handle: id})
+		}
+		k.joined = k.joined || len(msgs) > 0
+		return msgs, nil
+	}
+}
+
+// Ack implements ingest.Queue, by committing the offset of the last of msgs in
+// each partition. Records are acknowledged in order, so this also acknowledges
+// any earlier records in the partition.
+func (k *Consumer) Ack(ctx context.Context, msgs []ingest.Message) error {
+	type offset struct {
+		Topic     string `json:"topic"`
+		Partition int32  `json:"partition"`
+		Offset    int64  `json:"offset"`
+	}
+	last := make(map[string]int)
+	var offsets []offset
+	for _, m := range msgs {
+		o, err := parseHandle(m.Handle)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%s/%d", o.topic, o.partition)
+		if i, ok := last[key]; ok {
+			offsets[i].Offset = o.offset
+			continue
+		}
+		last[key] = len(offsets)
+		offsets = append(offsets, offset{Topic: o.topic, Partition: o.partition, Offset: o.offset})
+	}
+	if len(offsets) == 0 {
+		return nil
+	}
+	// The v2 API commits the position after each of the given offsets.
+	if err := k.call(ctx, http.MethodPost, k.baseURI+"/offsets", map[string][]offset{"offsets": offsets}, nil); err != nil {
+		return fmt.Errorf("failed to commit offsets: %v", err)
+	}
+	return nil
+}
+
+// Close removes the consumer from the proxy. Consumers which aren't closed are
+// removed by the proxy once they've been idle for a while, but their
+// partitions aren't reassigned until then.
+func (k *Consumer) Close(ctx context.Context) error {
+	if err := k.call(ctx, http.MethodDelete, k.baseURI, nil, nil); err != nil {
+		return fmt.Errorf("failed to remove consumer: %v", err)
+	}
+	return nil
+}
+
+// recordOffset identifies a record.
+type recordOffset struct {
+	topic     string
+	partition int32
+	offset    int64
+}
+
+// parseHandle parses the handle of a message returned by Pull, which is of the
+// form <topic>/<partition>/<offset>.
+func parseHandle(h string) (recordOffset, error) {
+	i := strings.LastIndex(h, "/")
+	j := strings.LastIndex(h[:max(i, 0)], "/")
+	if i < 0 || j < 0 {
+		return recordOffset{}, fmt.Errorf("invalid record handle %q", h)
+	}
+	p, err := strconv.ParseInt(h[j+1:i], 10, 32)
+	if err != nil {
+		return recordOffset{}, fmt.Errorf("invalid partition in record handle %q: %v", h, err)
+	}
+	o, err := strconv.ParseInt(h[i+1:], 10, 64)
+	if err != nil {
+		return recordOffset{}, fmt.Errorf("invalid offset in record handle %q: %v", h, err)
+	}
+	return recordOffset{topic: h[:j], partition: int32(p), offset: o}, nil
+}
+
+// call makes a request to the proxy, sending req, if it's non-nil, and
+// decoding the response into resp, if it's non-nil.
+func (k *Consumer) call(ctx context.Context, method, u string, req, resp any) error {
+	var body io.Reader
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	r, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if req != nil {
+		r.Header.Set("Content-Type", contentType)
+	}
+	// Records are the only resource which is fetched, and they must be
+	// requested in the consumer's format.
+	if method == http.MethodGet {
+		r.Header.Set("Accept", binaryType)
+	} else {
+		r.Header.Set("Accept", contentType)
+	}
+	rsp, err := k.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	if rsp.StatusCode != http.StatusOK && rsp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("%s %s: %s: %s", method, u, rsp.Status, bytes.TrimSpace(b))
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.Unmarshal(b, resp)
+}
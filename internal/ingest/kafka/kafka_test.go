@@ -0,0 +1,201 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/serverless-log/internal/ingest"
+)
+
+type record struct {
+	Topic     string `json:"topic"`
+	Value     []byte `json:"value"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+type offset struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// fakeProxy is a REST proxy with a single consumer, which returns each batch
+// of records in turn, after returning emptyFetches empty responses.
+type fakeProxy struct {
+	mu           sync.Mutex
+	batches      [][]record
+	emptyFetches int
+	topics       []string
+	committed    []offset
+	deleted      bool
+}
+
+func newFakeProxy(t *testing.T, f *fakeProxy) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	const base = "/consumers/group/instances/c1"
+	mux.HandleFunc("/consumers/group", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != contentType {
+			http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"instance_id": "c1", "base_uri": srv.URL + base})
+	})
+	mux.HandleFunc(base+"/subscription", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Topics []string `json:"topics"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.topics = req.Topics
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc(base+"/records", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != binaryType {
+			http.Error(w, "bad accept", http.StatusNotAcceptable)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		recs := []record{}
+		if f.emptyFetches > 0 {
+			f.emptyFetches--
+		} else if len(f.batches) > 0 {
+			recs = f.batches[0]
+			f.batches = f.batches[1:]
+		}
+		_ = json.NewEncoder(w).Encode(recs)
+	})
+	mux.HandleFunc(base+"/offsets", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Offsets []offset `json:"offsets"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.committed = append(f.committed, req.Offsets...)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc(base, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.deleted = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestConsumer(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeProxy{
+		emptyFetches: 2,
+		batches: [][]record{
+			{{"t", []byte("one"), 0, 5}, {"t", []byte("two"), 1, 3}, {"t", []byte("three"), 0, 6}},
+			{{"t", []byte("four"), 1, 4}},
+		},
+	}
+	srv := newFakeProxy(t, f)
+	k, err := NewConsumer(ctx, srv.URL, "group", "t", WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatalf("NewConsumer: %v", err)
+	}
+	if diff := cmp.Diff([]string{"t"}, f.topics); diff != "" {
+		t.Errorf("NewConsumer: subscribed topics diff (-want +got):\n%s", diff)
+	}
+
+	var got []string
+	if err := ingest.NewReceiver(k).Receive(ctx, func(_ context.Context, m ingest.Message) error {
+		got = append(got, string(m.Data))
+		return nil
+	}); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if diff := cmp.Diff([]string{"one", "two", "three", "four"}, got); diff != "" {
+		t.Errorf("Receive: handled data diff (-want +got):\n%s", diff)
+	}
+	wantCommitted := []offset{{"t", 0, 6}, {"t", 1, 3}, {"t", 1, 4}}
+	if diff := cmp.Diff(wantCommitted, f.committed); diff != "" {
+		t.Errorf("Receive: committed offsets diff (-want +got):\n%s", diff)
+	}
+
+	if err := k.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !f.deleted {
+		t.Error("Close: consumer was not removed")
+	}
+}
+
+func TestPullJoinTimeout(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeProxy{emptyFetches: 1000}
+	srv := newFakeProxy(t, f)
+	k, err := NewConsumer(ctx, srv.URL, "group", "t", WithHTTPClient(srv.Client()), WithJoinTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewConsumer: %v", err)
+	}
+	msgs, err := k.Pull(ctx, 10)
+	if err != nil {
+		t.Fatalf("Pull: %v", err)
+	}
+	if len(msgs) != 0 {
+		t.Errorf("Pull: got %d messages, want none", len(msgs))
+	}
+}
+
+func TestParseHandle(t *testing.T) {
+	for _, test := range []struct {
+		handle  string
+		want    recordOffset
+		wantErr bool
+	}{
+		{handle: "t/1/42", want: recordOffset{"t", 1, 42}},
+		{handle: "a/b/0/7", want: recordOffset{"a/b", 0, 7}},
+		{handle: "t/42", wantErr: true},
+		{handle: "t/x/42", wantErr: true},
+		{handle: "t/1/x", wantErr: true},
+	} {
+		got, err := parseHandle(test.handle)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("parseHandle(%q) = %v, wantErr %t", test.handle, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Errorf("parseHandle(%q) = %+v, want %+v", test.handle, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pubsub provides an ingest.Queue which consumes entries published to a
+// Google Cloud Pub/Sub topic, each as the data of a message.
+//
+// The Pub/Sub REST API is used directly, authenticating with Application
+// Default Credentials, to avoid depending on the Cloud client libraries.
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/transparency-dev/serverless-log/internal/ingest"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	// DefaultEndpoint is the Pub/Sub REST API endpoint.
+	DefaultEndpoint = "https://pubsub.googleapis.com/v1/"
+
+	// emulatorEnv is the environment variable which, by the same convention
+	// as the Cloud client libraries, points clients at the Pub/Sub emulator.
+	emulatorEnv = "PUBSUB_EMULATOR_HOST"
+
+	scope = "https://www.googleapis.com/auth/pubsub"
+)
+
+// Option is used to configure optional behaviour of NewSubscriber.
+type Option func(*Subscriber)
+
+// WithHTTPClient causes requests to Pub/Sub to be made with c, which must add
+// any required credentials, rather than with Application Default Credentials.
+func WithHTTPClient(c *http.Client) Option {
+	return func(s *Subscriber) {
+		s.client = c
+	}
+}
+
+// WithEndpoint causes requests to be sent to the given Pub/Sub REST API
+// endpoint, rather than DefaultEndpoint.
+func WithEndpoint(e string) Option {
+	return func(s *Subscriber) {
+		s.endpoint = e
+	}
+}
+
+// Subscriber receives messages from a Pub/Sub subscription.
+type Subscriber struct {
+	client   *http.Client
+	endpoint string
+	url      string
+}
+
+var _ ingest.Queue = &Subscriber{}
+
+// NewSubscriber returns a Subscriber for the named subscription, e.g.
+// projects/p/subscriptions/s.
+//
+// If the PUBSUB_EMULATOR_HOST environment variable is set, requests are sent
+// to the emulator at that address without credentials, unless WithEndpoint or
+// WithHTTPClient are given.
+func NewSubscriber(ctx context.Context, name string, opts ...Option) (*Subscriber, error) {
+	s := &Subscriber{endpoint: DefaultEndpoint}
+	if host := os.Getenv(emulatorEnv); host != "" {
+		s.endpoint = "http://" + host + "/v1/"
+		s.client = http.DefaultClient
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.client == nil {
+		c, err := google.DefaultClient(ctx, scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create authenticated HTTP client: %v", err)
+		}
+		s.client = c
+	}
+	s.url = strings.TrimSuffix(s.endpoint, "/") + "/" + name
+	return s, nil
+}
+
+// Pull implements ingest.Queue. Messages are redelivered unless they're
+// acknowledged with Ack before their acknowledgement deadline, which is
+// configured on the subscription.
+func (s *Subscriber) Pull(ctx context.Context, max int) ([]ingest.Message, error) {
+	var resp struct {
+		ReceivedMessages []struct {
+			AckID   string `json:"ackId"`
+			Message struct {
+				Data      []byte `json:"data"`
+				MessageID string `json:"messageId"`
+			} `json:"message"`
+		} `json:"receivedMessages"`
+	}
+	if err := s.call(ctx, ":pull", map[string]any{"maxMessages": max}, &resp); err != nil {
+		return nil, fmt.Errorf("failed to pull: %v", err)
+	}
+	msgs := make([]ingest.Message, 0, len(resp.ReceivedMessages))
+	for _, m := range resp.ReceivedMessages {
+		msgs = append(msgs, ingest.Message{ID: m.Message.MessageID, Data: m.Message.Data, Handle: m.AckID})
+	}
+	return msgs, nil
+}
+
+// Ack implements ingest.Queue.
+func (s *Subscriber) Ack(ctx context.Context, msgs []ingest.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		ids = append(ids, m.Handle)
+	}
+	if err := s.call(ctx, ":acknowledge", map[string]any{"ackIds": ids}, &struct{}{}); err != nil {
+		return fmt.Errorf("failed to acknowledge: %v", err)
+	}
+	return nil
+}
+
+// call makes a POST request to the subscription's URL with the given suffix,
+// sending req and decoding the response into resp. []byte fields are base64
+// encoded by encoding/json, as required by the API.
+func (s *Subscriber) call(ctx context.Context, suffix string, req, resp any) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+suffix, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	rsp, err := s.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	b, err = io.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("POST %s: %s: %s", s.url+suffix, rsp.Status, bytes.TrimSpace(b))
+	}
+	return json.Unmarshal(b, resp)
+}
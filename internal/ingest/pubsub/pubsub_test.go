@@ -0,0 +1,146 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/serverless-log/internal/ingest"
+)
+
+const subName = "projects/p/subscriptions/s"
+
+type fakeMessage struct {
+	id   string
+	data string
+}
+
+// fakePubSub is a subscription which delivers the queued messages, in
+// batches of at most the requested size, until they're acknowledged.
+type fakePubSub struct {
+	mu      sync.Mutex
+	queue   []fakeMessage
+	pending map[string]fakeMessage
+	acked   []string
+	nextAck int
+}
+
+func newFakePubSub(t *testing.T, msgs ...fakeMessage) (*fakePubSub, *httptest.Server) {
+	t.Helper()
+	f := &fakePubSub{queue: msgs, pending: make(map[string]fakeMessage)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+subName+":pull", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			MaxMessages int `json:"maxMessages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		type msg struct {
+			Data      []byte `json:"data"`
+			MessageID string `json:"messageId"`
+		}
+		type received struct {
+			AckID   string `json:"ackId"`
+			Message msg    `json:"message"`
+		}
+		resp := struct {
+			ReceivedMessages []received `json:"receivedMessages,omitempty"`
+		}{}
+		for len(f.queue) > 0 && len(resp.ReceivedMessages) < req.MaxMessages {
+			m := f.queue[0]
+			f.queue = f.queue[1:]
+			ackID := fmt.Sprintf("ack-%d", f.nextAck)
+			f.nextAck++
+			f.pending[ackID] = m
+			resp.ReceivedMessages = append(resp.ReceivedMessages, received{AckID: ackID, Message: msg{Data: []byte(m.data), MessageID: m.id}})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/"+subName+":acknowledge", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			AckIDs []string `json:"ackIds"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, id := range req.AckIDs {
+			m, ok := f.pending[id]
+			if !ok {
+				http.Error(w, "unknown ack ID", http.StatusBadRequest)
+				return
+			}
+			delete(f.pending, id)
+			f.acked = append(f.acked, m.id)
+		}
+		_, _ = w.Write([]byte("{}"))
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return f, s
+}
+
+func TestSubscriber(t *testing.T) {
+	ctx := context.Background()
+	f, srv := newFakePubSub(t, fakeMessage{"1", "one"}, fakeMessage{"2", "two"}, fakeMessage{"3", "three"})
+	s, err := NewSubscriber(ctx, subName, WithHTTPClient(srv.Client()), WithEndpoint(srv.URL))
+	if err != nil {
+		t.Fatalf("NewSubscriber: %v", err)
+	}
+	msgs, err := s.Pull(ctx, 2)
+	if err != nil {
+		t.Fatalf("Pull: %v", err)
+	}
+	want := []ingest.Message{
+		{ID: "1", Data: []byte("one"), Handle: "ack-0"},
+		{ID: "2", Data: []byte("two"), Handle: "ack-1"},
+	}
+	if diff := cmp.Diff(want, msgs); diff != "" {
+		t.Errorf("Pull: diff (-want +got):\n%s", diff)
+	}
+	if err := s.Ack(ctx, msgs[:1]); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if diff := cmp.Diff([]string{"1"}, f.acked); diff != "" {
+		t.Errorf("Ack: acked diff (-want +got):\n%s", diff)
+	}
+	if err := s.Ack(ctx, []ingest.Message{{ID: "4", Handle: "bogus"}}); err == nil {
+		t.Error("Ack: got no error for unknown ack ID")
+	}
+
+	var got []string
+	if err := ingest.NewReceiver(s).Receive(ctx, func(_ context.Context, m ingest.Message) error {
+		got = append(got, string(m.Data))
+		return nil
+	}); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if diff := cmp.Diff([]string{"three"}, got); diff != "" {
+		t.Errorf("Receive: handled data diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package integrator integrates sequenced entries into a log stored on the
+// local filesystem, and signs, witnesses, writes, and publishes its new
+// checkpoints. It's used by the integrate tool for one-off integrations, and
+// by long-running servers which integrate entries as they arrive.
+package integrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/client/witness"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/signer/gcpkms"
+	"github.com/transparency-dev/serverless-log/internal/signer/pkcs11"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"golang.org/x/mod/sumdb/note"
+	"k8s.io/klog/v2"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// Opts holds the configuration of an Integrator.
+type Opts struct {
+	// Origin is the log's origin, used in its checkpoints.
+	Origin string
+	// Signers sign each new checkpoint.
+	Signers []note.Signer
+	// Witnesses, if set, lists the witnesses which must cosign each new
+	// checkpoint before it's written.
+	Witnesses *witness.FeedConfig
+	// Publisher, if set, publishes each new checkpoint to distributors.
+	Publisher *client.Publisher
+	// LogID identifies the log to distributors. If unset, it's derived from
+	// Origin.
+	LogID string
+	// Compression is the compression used for the log's tiles.
+	Compression compress.Algorithm
+	// Concurrency is the number of workers used to hash new entries, and to
+	// write updated tiles. Zero means one.
+	Concurrency int
+	// MaxLeaves, if set, limits the number of entries integrated by each
+	// integration, see log.WithMaxLeaves.
+	MaxLeaves uint64
+	// FlushSize, if set, limits the number of entries whose tiles are
+	// computed before they're written, see log.WithFlushSize.
+	FlushSize uint64
+}
+
+// Integrator integrates the sequenced entries of a log.
+type Integrator struct {
+	rootDir string
+	open    func(cpRaw []byte) (*fmtlog.Checkpoint, error)
+	h       merkle.LogHasher
+	opts    Opts
+	fsOpts  []fs.Option
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New returns an Integrator for the log stored in rootDir, whose current
+// checkpoint is verified with open, and whose leaf hashes are computed with
+// h. The log's storage is opened with fsOpts.
+func New(rootDir string, open func(cpRaw []byte) (*fmtlog.Checkpoint, error), h merkle.LogHasher, opts Opts, fsOpts ...fs.Option) *Integrator {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	return &Integrator{rootDir: rootDir, open: open, h: h, opts: opts, fsOpts: fsOpts, status: Status{Started: time.Now()}}
+}
+
+// Initialise creates a new, empty, log, and writes its first checkpoint.
+func (i *Integrator) Initialise(ctx context.Context) error {
+	st, err := fs.Create(i.rootDir, i.fsOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to create log: %w", err)
+	}
+	cpRaw, err := i.signAndWrite(ctx, &fmtlog.Checkpoint{Hash: i.h.EmptyRoot()}, 0, st)
+	if err != nil {
+		return err
+	}
+	i.publish(ctx, cpRaw)
+	return nil
+}
+
+// Integrate integrates the entries which have been sequenced since the log's
+// current checkpoint, and writes a new checkpoint committing to them. It
+// returns the new checkpoint, or nil if there were no new entries, along with
+// the size of the log's previous checkpoint.
+//
+// The log's integrate lock is held throughout, so that overlapping
+// integrations, e.g. by the integrate tool, wait for each other. The outcome
+// is recorded in the Integrator's Status.
+func (i *Integrator) Integrate(ctx context.Context) (*fmtlog.Checkpoint, uint64, error) {
+	start := time.Now()
+	cp, oldSize, err := i.integrate(ctx)
+	i.record(start, cp, oldSize, err)
+	return cp, oldSize, err
+}
+
+// integrate implements Integrate.
+func (i *Integrator) integrate(ctx context.Context) (*fmtlog.Checkpoint, uint64, error) {
+	unlock, err := fs.AcquireLock(i.rootDir, fs.IntegrateLock)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to lock log: %w", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			klog.Errorf("Failed to unlock log: %q", err)
+		}
+	}()
+	cpRaw, err := fs.ReadCheckpoint(i.rootDir)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read log checkpoint: %w", err)
+	}
+	cp, err := i.open(cpRaw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	st, err := fs.Load(i.rootDir, cp.Size, i.fsOpts...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load storage: %w", err)
+	}
+	newCp, err := log.Integrate(ctx, cp.Size, st, i.h,
+		log.WithConcurrency(i.opts.Concurrency),
+		log.WithMaxLeaves(i.opts.MaxLeaves),
+		log.WithFlushSize(i.opts.FlushSize))
+	if err != nil {
+		return nil, cp.Size, fmt.Errorf("failed to integrate: %w", err)
+	}
+	if newCp == nil {
+		return nil, cp.Size, nil
+	}
+	if err := st.WriteBundles(ctx, cp.Size, newCp.Size); err != nil {
+		return nil, cp.Size, fmt.Errorf("failed to write leaf bundles: %w", err)
+	}
+	newCpRaw, err := i.signAndWrite(ctx, newCp, cp.Size, st)
+	if err != nil {
+		return nil, cp.Size, err
+	}
+	// The integration is complete, so its journal is no longer needed.
+	// A journal left behind would be discarded by the next integration.
+	if err := st.DeleteJournal(ctx); err != nil {
+		klog.Warningf("Failed to delete journal: %q", err)
+	}
+	if err := st.RemoveStaged(ctx, cp.Size, newCp.Size); err != nil {
+		klog.Warningf("Failed to remove staged entries: %q", err)
+	}
+	i.publish(ctx, newCpRaw)
+	return newCp, cp.Size, nil
+}
+
+// signAndWrite signs the new checkpoint cp, has it cosigned by the witnesses,
+// if any, and writes it. oldSize is the size of the log's previous checkpoint.
+// The checkpoint is returned as written.
+func (i *Integrator) signAndWrite(ctx context.Context, cp *fmtlog.Checkpoint, oldSize uint64, st *fs.Storage) ([]byte, error) {
+	cp.Origin = i.opts.Origin
+	cpNoteSigned, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, i.opts.Signers...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign Checkpoint: %w", err)
+	}
+	if i.opts.Witnesses != nil {
+		var f client.Fetcher = func(_ context.Context, p string) ([]byte, error) {
+			return os.ReadFile(filepath.Join(i.rootDir, p))
+		}
+		if i.opts.Compression != compress.None {
+			f = client.DecompressingFetcher(f)
+		}
+		proof := func(ctx context.Context, from, to uint64) ([][]byte, error) {
+			pb, err := client.NewProofBuilder(ctx, *cp, i.h.HashChildren, f)
+			if err != nil {
+				return nil, err
+			}
+			return pb.ConsistencyProof(ctx, from, to)
+		}
+		if cpNoteSigned, err = i.opts.Witnesses.Feed(ctx, nil, cpNoteSigned, oldSize, cp.Size, proof); err != nil {
+			return nil, fmt.Errorf("failed to collect witness cosignatures: %w", err)
+		}
+	}
+	if err := st.ArchiveCheckpoint(ctx, cp.Size, cpNoteSigned); err != nil {
+		return nil, fmt.Errorf("failed to archive new log checkpoint: %w", err)
+	}
+	if err := st.WriteCheckpoint(ctx, cpNoteSigned); err != nil {
+		return nil, fmt.Errorf("failed to store new log checkpoint: %w", err)
+	}
+	return cpNoteSigned, nil
+}
+
+// publish pushes the checkpoint to the distributors, if any. Failures are
+// logged, but aren't fatal since the checkpoint has already been written.
+func (i *Integrator) publish(ctx context.Context, cpRaw []byte) {
+	if i.opts.Publisher == nil {
+		return
+	}
+	id := i.opts.LogID
+	if id == "" {
+		id = fmtlog.ID(i.opts.Origin)
+	}
+	if err := i.opts.Publisher.Publish(ctx, id, cpRaw); err != nil {
+		klog.Errorf("Failed to publish checkpoint: %v", err)
+	}
+}
+
+// PublishLogger is a client.PublishMetrics which logs the outcome of each
+// publication.
+type PublishLogger struct{}
+
+// CheckpointPublished implements client.PublishMetrics.
+func (PublishLogger) CheckpointPublished(d string, attempts int, dur time.Duration, err error) {
+	if err != nil {
+		klog.Warningf("Publishing checkpoint to %q failed after %d attempts in %v", d, attempts, dur)
+		return
+	}
+	klog.Infof("Published checkpoint to %q after %d attempts in %v", d, attempts, dur)
+}
+
+// SignerOpts describes the keys with which checkpoints are signed.
+type SignerOpts struct {
+	// PrivateKeys holds note private keys, one per line. Blank lines and
+	// lines starting with "#" are ignored.
+	PrivateKeys string
+	// GCPKMSKey, if set, is a Cloud KMS key version which also signs.
+	GCPKMSKey string
+	// PKCS11, if set, describes a key held in a PKCS#11 token which also
+	// signs. The key is used until the process exits.
+	PKCS11 *pkcs11.Config
+	// Name is the note key name of the Cloud KMS or PKCS#11 signer.
+	Name string
+}
+
+// NewSigners returns the signers described by opts. The verifier keys of
+// signers whose private keys are held elsewhere are logged, so that they can be
+// added to the log's public key file.
+func NewSigners(ctx context.Context, opts SignerOpts) ([]note.Signer, error) {
+	var s []note.Signer
+	if len(opts.PrivateKeys) > 0 {
+		ks, err := ParsePrivateKeys(opts.PrivateKeys)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, ks...)
+	}
+	if len(opts.GCPKMSKey) > 0 {
+		ks, pk, err := gcpkms.NewSigner(ctx, opts.GCPKMSKey, opts.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to instantiate Cloud KMS signer: %w", err)
+		}
+		klog.Infof("Signing with Cloud KMS key %q, verifier key %s", opts.GCPKMSKey, pk.VerifierKey(opts.Name))
+		s = append(s, ks)
+	}
+	if opts.PKCS11 != nil {
+		k, err := pkcs11.Open(*opts.PKCS11)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open PKCS#11 key: %w", err)
+		}
+		ks, err := k.Signer(opts.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to instantiate PKCS#11 signer: %w", err)
+		}
+		klog.Infof("Signing with PKCS#11 key %q, verifier key %s", opts.PKCS11.KeyLabel, k.PublicKey().VerifierKey(opts.Name))
+		s = append(s, ks)
+	}
+	return s, nil
+}
+
+// ParsePrivateKeys returns signers for the note private keys in keys, one per
+// line. Blank lines and lines starting with "#" are ignored.
+func ParsePrivateKeys(keys string) ([]note.Signer, error) {
+	var ret []note.Signer
+	for _, l := range strings.Split(keys, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		s, err := note.NewSigner(l)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s)
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("no private keys found")
+	}
+	return ret, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integrator
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"golang.org/x/mod/sumdb/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// newTestIntegrator returns an Integrator for a new log in a temporary
+// directory, along with the directory. The log's storage is opened with fsOpts.
+func newTestIntegrator(t *testing.T, fsOpts ...fs.Option) (*Integrator, string) {
+	t.Helper()
+	skey, vkey, err := note.GenerateKey(rand.Reader, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ParsePrivateKeys("# Log key\n" + skey + "\n")
+	if err != nil {
+		t.Fatalf("ParsePrivateKeys: %v", err)
+	}
+	lv, err := client.ParseLogVerifiers([]byte(vkey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := func(cpRaw []byte) (*fmtlog.Checkpoint, error) {
+		cp, _, _, err := lv.ParseCheckpoint(cpRaw, "example.com/log")
+		return cp, err
+	}
+	dir := t.TempDir() + "/log"
+	i := New(dir, open, rfc6962.DefaultHasher, Opts{Origin: "example.com/log", Signers: s}, fsOpts...)
+	if err := i.Initialise(context.Background()); err != nil {
+		t.Fatalf("Initialise: %v", err)
+	}
+	return i, dir
+}
+
+// sequence sequences n new entries in the log in dir, starting from start.
+func sequence(t *testing.T, dir string, start, n int) {
+	t.Helper()
+	st, err := fs.Load(dir, 0)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for j := start; j < start+n; j++ {
+		if _, err := log.Add(context.Background(), st, rfc6962.DefaultHasher, []byte(fmt.Sprintf("entry %d", j))); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+}
+
+func TestIntegrate(t *testing.T) {
+	for _, bundleSize := range []uint64{1, 4} {
+		t.Run(fmt.Sprintf("bundle size %d", bundleSize), func(t *testing.T) {
+			testIntegrate(t, bundleSize)
+		})
+	}
+}
+
+func testIntegrate(t *testing.T, bundleSize uint64) {
+	ctx := context.Background()
+	i, dir := newTestIntegrator(t, fs.WithBundleSize(bundleSize))
+	f := func(_ context.Context, p string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(dir, p))
+	}
+	for _, test := range []struct {
+		desc        string
+		add         int
+		wantOldSize uint64
+		wantSize    uint64
+	}{
+		{desc: "nothing to integrate"},
+		{desc: "first batch", add: 3, wantSize: 3},
+		{desc: "second batch", add: 20, wantOldSize: 3, wantSize: 23},
+		{desc: "nothing more", wantOldSize: 23},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			sequence(t, dir, int(test.wantOldSize), test.add)
+			cp, oldSize, err := i.Integrate(ctx)
+			if err != nil {
+				t.Fatalf("Integrate: %v", err)
+			}
+			if oldSize != test.wantOldSize {
+				t.Errorf("Integrate: got old size %d, want %d", oldSize, test.wantOldSize)
+			}
+			if test.add == 0 {
+				if cp != nil {
+					t.Errorf("Integrate: got checkpoint of size %d, want nil", cp.Size)
+				}
+				return
+			}
+			if cp == nil || cp.Size != test.wantSize {
+				t.Fatalf("Integrate: got checkpoint %v, want size %d", cp, test.wantSize)
+			}
+			// The checkpoint written must be the one returned, and signed.
+			cpRaw, err := fs.ReadCheckpoint(dir)
+			if err != nil {
+				t.Fatalf("ReadCheckpoint: %v", err)
+			}
+			got, err := i.open(cpRaw)
+			if err != nil {
+				t.Fatalf("Failed to open written checkpoint: %v", err)
+			}
+			if got.Size != cp.Size || string(got.Hash) != string(cp.Hash) {
+				t.Errorf("Wrote checkpoint %+v, want %+v", got, cp)
+			}
+			// Every entry committed to by the checkpoint must be readable.
+			leaves, err := client.GetLeaves(ctx, f, client.ServerlessLayout{BundleSize: bundleSize}, 0, cp.Size, cp.Size, 1)
+			if err != nil {
+				t.Fatalf("GetLeaves: %v", err)
+			}
+			for j, l := range leaves {
+				if want := fmt.Sprintf("entry %d", j); string(l) != want {
+					t.Errorf("Leaf %d: got %q, want %q", j, l, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePrivateKeys(t *testing.T) {
+	skey, _, err := note.GenerateKey(rand.Reader, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		desc    string
+		keys    string
+		want    int
+		wantErr bool
+	}{
+		{desc: "one", keys: skey, want: 1},
+		{desc: "comments and blank lines", keys: "# Current key\n\n" + skey + "\n# Old key\n" + skey + "\n", want: 2},
+		{desc: "none", keys: "# No keys\n", wantErr: true},
+		{desc: "invalid", keys: "PRIVATE+KEY+nonsense\n", wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := ParsePrivateKeys(test.keys)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParsePrivateKeys: got err %v, want err %t", err, test.wantErr)
+			}
+			if len(got) != test.want {
+				t.Errorf("ParsePrivateKeys: got %d signers, want %d", len(got), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integrator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// Loop integrates new entries continuously, for servers which sequence
+// entries as they arrive. Entries are integrated periodically, and as soon as
+// a batch of them is waiting, whichever comes first.
+type Loop struct {
+	integrate func(ctx context.Context) (*fmtlog.Checkpoint, uint64, error)
+	interval  time.Duration
+	batchSize uint64
+	// maxLeaves is the most entries an integration integrates, or zero if
+	// there's no limit.
+	maxLeaves uint64
+	// kick is signalled when a batch of entries is waiting.
+	kick chan struct{}
+
+	mu sync.Mutex
+	// added is the number of entries sequenced since the last integration
+	// started.
+	added uint64
+}
+
+// NewLoop returns a Loop which integrates with i every interval, and whenever
+// batchSize new entries have been sequenced, see Added. Either may be zero, to
+// disable that trigger, but not both. If i's integrations are limited by
+// Opts.MaxLeaves, integrations which reach the limit are followed immediately
+// by another, until the backlog is cleared.
+func NewLoop(i *Integrator, interval time.Duration, batchSize uint64) *Loop {
+	return &Loop{
+		integrate: i.Integrate,
+		interval:  interval,
+		batchSize: batchSize,
+		maxLeaves: i.opts.MaxLeaves,
+		kick:      make(chan struct{}, 1),
+	}
+}
+
+// Added records that n new entries have been sequenced, and triggers an
+// integration if a batch of entries is now waiting.
+func (l *Loop) Added(n uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.added += n
+	if l.batchSize > 0 && l.added >= l.batchSize {
+		l.trigger()
+	}
+}
+
+// trigger causes an integration to start as soon as possible.
+func (l *Loop) trigger() {
+	select {
+	case l.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Run integrates new entries until ctx is done, and then integrates once more
+// so that every entry sequenced beforehand is integrated. Failed integrations
+// are logged, and retried when next triggered.
+func (l *Loop) Run(ctx context.Context) {
+	var tick <-chan time.Time
+	if l.interval > 0 {
+		t := time.NewTicker(l.interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			// The final integration isn't cut short by ctx, since it's
+			// done precisely because ctx is done.
+			l.run(context.WithoutCancel(ctx))
+			return
+		case <-tick:
+		case <-l.kick:
+		}
+		l.run(ctx)
+	}
+}
+
+// run integrates once, logging the outcome.
+func (l *Loop) run(ctx context.Context) {
+	l.mu.Lock()
+	l.added = 0
+	l.mu.Unlock()
+	start := time.Now()
+	cp, oldSize, err := l.integrate(ctx)
+	switch {
+	case err != nil:
+		klog.Errorf("Failed to integrate: %v", err)
+	case cp == nil:
+		klog.V(1).Info("Nothing to integrate")
+	default:
+		klog.Infof("Integrated %d entries in %v, log size is now %d", cp.Size-oldSize, time.Since(start), cp.Size)
+		if l.maxLeaves > 0 && cp.Size-oldSize >= l.maxLeaves {
+			// There may be more entries waiting.
+			l.trigger()
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integrator
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+func TestLoop(t *testing.T) {
+	for _, test := range []struct {
+		desc      string
+		interval  time.Duration
+		batchSize uint64
+		added     uint64
+		// wantBefore is the minimum number of integrations wanted before
+		// the loop is stopped.
+		wantBefore int64
+	}{
+		{
+			desc:       "interval",
+			interval:   time.Millisecond,
+			wantBefore: 2,
+		}, {
+			desc:       "batch",
+			batchSize:  10,
+			added:      10,
+			wantBefore: 1,
+		}, {
+			desc:      "batch not yet full",
+			batchSize: 10,
+			added:     9,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var runs atomic.Int64
+			l := &Loop{
+				integrate: func(context.Context) (*fmtlog.Checkpoint, uint64, error) {
+					runs.Add(1)
+					return nil, 0, nil
+				},
+				interval:  test.interval,
+				batchSize: test.batchSize,
+				kick:      make(chan struct{}, 1),
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				l.Run(ctx)
+				close(done)
+			}()
+			for i := uint64(0); i < test.added; i++ {
+				l.Added(1)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for runs.Load() < test.wantBefore && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if test.wantBefore == 0 {
+				// Give an unwanted integration a chance to happen.
+				time.Sleep(50 * time.Millisecond)
+			}
+			before := runs.Load()
+			if test.wantBefore == 0 && before != 0 {
+				t.Errorf("Got %d integrations before stopping, want none", before)
+			} else if before < test.wantBefore {
+				t.Errorf("Got %d integrations before stopping, want at least %d", before, test.wantBefore)
+			}
+			cancel()
+			<-done
+			// The loop always integrates once more when it's stopped.
+			if got := runs.Load(); got <= before {
+				t.Errorf("Got %d integrations after stopping, want more than %d", got, before)
+			}
+		})
+	}
+}
+
+func TestLoopMaxLeaves(t *testing.T) {
+	// Each integration integrates up to 10 entries, of a backlog of 35.
+	var runs atomic.Int64
+	var size uint64
+	l := &Loop{
+		integrate: func(context.Context) (*fmtlog.Checkpoint, uint64, error) {
+			runs.Add(1)
+			old := size
+			size = min(size+10, 35)
+			if size == old {
+				return nil, old, nil
+			}
+			return &fmtlog.Checkpoint{Size: size}, old, nil
+		},
+		batchSize: 1,
+		maxLeaves: 10,
+		kick:      make(chan struct{}, 1),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Run(ctx)
+		close(done)
+	}()
+	// A single trigger should integrate the whole backlog.
+	l.Added(1)
+	deadline := time.Now().Add(5 * time.Second)
+	for runs.Load() < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// Give an unwanted integration a chance to happen.
+	time.Sleep(50 * time.Millisecond)
+	if got := runs.Load(); got != 4 {
+		t.Errorf("Got %d integrations, want 4", got)
+	}
+	cancel()
+	<-done
+}
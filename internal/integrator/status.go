@@ -0,0 +1,165 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integrator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+	"k8s.io/klog/v2"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// Status describes the integrations an Integrator has done, so that stalled
+// integration can be detected.
+type Status struct {
+	// Started is when the Integrator was created.
+	Started time.Time
+	// Runs is the number of integrations attempted, and Failures the number
+	// of those which failed.
+	Runs, Failures uint64
+	// LastSuccess is when the last successful integration finished, or zero
+	// if there hasn't been one.
+	LastSuccess time.Time
+	// LastDuration is how long the last successful integration took.
+	LastDuration time.Duration
+	// Size is the size of the log's checkpoint as of the last successful
+	// integration.
+	Size uint64
+	// LastError is the error returned by the last integration, or empty if
+	// it succeeded.
+	LastError string
+}
+
+// Status returns the Integrator's current status.
+func (i *Integrator) Status() Status {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.status
+}
+
+// record updates the Integrator's status with the outcome of an integration
+// which started at start.
+func (i *Integrator) record(start time.Time, cp *fmtlog.Checkpoint, oldSize uint64, err error) {
+	now := time.Now()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.status.Runs++
+	if err != nil {
+		i.status.Failures++
+		i.status.LastError = err.Error()
+		return
+	}
+	i.status.LastSuccess = now
+	i.status.LastDuration = now.Sub(start)
+	i.status.LastError = ""
+	i.status.Size = oldSize
+	if cp != nil {
+		i.status.Size = cp.Size
+	}
+}
+
+// Pending returns the number of entries which have been sequenced, but not yet
+// integrated.
+func (i *Integrator) Pending(_ context.Context) (uint64, error) {
+	cpRaw, err := fs.ReadCheckpoint(i.rootDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read log checkpoint: %w", err)
+	}
+	cp, err := i.open(cpRaw)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	return fs.CountSequenced(i.rootDir, cp.Size)
+}
+
+// Handler returns an http.Handler which serves the Integrator's status to
+// schedulers and monitoring systems:
+//
+//   - /healthz responds with 200 OK if integration is keeping up, and with 503
+//     Service Unavailable if the last integration failed, or if entries are
+//     waiting and there hasn't been a successful integration for longer than
+//     maxAge. If maxAge is zero, waiting entries are ignored.
+//   - /metrics serves the Integrator's Status, and the number of entries
+//     waiting to be integrated, in the Prometheus text format.
+func (i *Integrator) Handler(maxAge time.Duration) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := i.healthy(r.Context(), maxAge, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		i.writeMetrics(r.Context(), w)
+	})
+	return mux
+}
+
+// healthy returns an error describing why integration isn't keeping up, if
+// it isn't.
+func (i *Integrator) healthy(ctx context.Context, maxAge time.Duration, now time.Time) error {
+	s := i.Status()
+	if s.LastError != "" {
+		return fmt.Errorf("last integration failed: %s", s.LastError)
+	}
+	if maxAge == 0 {
+		return nil
+	}
+	pending, err := i.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	last := s.LastSuccess
+	if last.IsZero() {
+		last = s.Started
+	}
+	if pending > 0 && now.Sub(last) > maxAge {
+		return fmt.Errorf("%d entries are waiting, and there has been no successful integration for %v", pending, now.Sub(last).Round(time.Second))
+	}
+	return nil
+}
+
+// writeMetrics writes the Integrator's metrics to w in the Prometheus text
+// format.
+func (i *Integrator) writeMetrics(ctx context.Context, w io.Writer) {
+	s := i.Status()
+	metric := func(name, kind, help string, v any) {
+		fmt.Fprintf(w, "# HELP serverless_log_integrate_%s %s\n", name, help)
+		fmt.Fprintf(w, "# TYPE serverless_log_integrate_%s %s\n", name, kind)
+		fmt.Fprintf(w, "serverless_log_integrate_%s %v\n", name, v)
+	}
+	if pending, err := i.Pending(ctx); err != nil {
+		klog.Warningf("Failed to count pending entries: %v", err)
+	} else {
+		metric("pending_entries", "gauge", "Number of entries sequenced but not yet integrated.", pending)
+	}
+	metric("checkpoint_size", "gauge", "Size of the log's checkpoint as of the last successful integration.", s.Size)
+	var last int64
+	if !s.LastSuccess.IsZero() {
+		last = s.LastSuccess.Unix()
+	}
+	metric("last_success_timestamp_seconds", "gauge", "Time at which the last successful integration finished, or 0 if there hasn't been one.", last)
+	metric("last_duration_seconds", "gauge", "Duration of the last successful integration.", s.LastDuration.Seconds())
+	metric("runs_total", "counter", "Number of integrations attempted.", s.Runs)
+	metric("failures_total", "counter", "Number of integrations which failed.", s.Failures)
+}
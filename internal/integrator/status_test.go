@@ -0,0 +1,121 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integrator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+	i, dir := newTestIntegrator(t)
+	sequence(t, dir, 0, 3)
+	if got, err := i.Pending(ctx); err != nil || got != 3 {
+		t.Fatalf("Pending = %d, %v, want 3", got, err)
+	}
+	if _, _, err := i.Integrate(ctx); err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	sequence(t, dir, 3, 2)
+	if got, err := i.Pending(ctx); err != nil || got != 2 {
+		t.Fatalf("Pending = %d, %v, want 2", got, err)
+	}
+	s := i.Status()
+	if s.Runs != 1 || s.Failures != 0 || s.Size != 3 || s.LastError != "" {
+		t.Errorf("Status = %+v, want 1 run, no failures, size 3", s)
+	}
+	if s.LastSuccess.Before(s.Started) {
+		t.Errorf("Status: got LastSuccess %v before Started %v", s.LastSuccess, s.Started)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		desc string
+		// add is the number of entries sequenced after integrating.
+		add    int
+		maxAge time.Duration
+		fail   bool
+		// later is how long after the integration /healthz is checked.
+		later    time.Duration
+		wantCode int
+	}{
+		{desc: "nothing waiting", maxAge: time.Minute, later: time.Hour, wantCode: http.StatusOK},
+		{desc: "waiting", add: 2, maxAge: time.Minute, wantCode: http.StatusOK},
+		{desc: "waiting too long", add: 2, maxAge: time.Minute, later: time.Hour, wantCode: http.StatusServiceUnavailable},
+		{desc: "no max age", add: 2, later: time.Hour, wantCode: http.StatusOK},
+		{desc: "failed", fail: true, wantCode: http.StatusServiceUnavailable},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			i, dir := newTestIntegrator(t)
+			sequence(t, dir, 0, 3)
+			if _, _, err := i.Integrate(ctx); err != nil {
+				t.Fatalf("Integrate: %v", err)
+			}
+			sequence(t, dir, 3, test.add)
+			if test.fail {
+				i.record(time.Now(), nil, 0, errors.New("boom"))
+			}
+
+			err := i.healthy(ctx, test.maxAge, time.Now().Add(test.later))
+			if gotErr := err != nil; gotErr != (test.wantCode != http.StatusOK) {
+				t.Errorf("healthy = %v, want code %d", err, test.wantCode)
+			}
+			if test.later > 0 {
+				return
+			}
+			rec := httptest.NewRecorder()
+			i.Handler(test.maxAge).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if rec.Code != test.wantCode {
+				t.Errorf("GET /healthz = %d (%s), want %d", rec.Code, rec.Body, test.wantCode)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	i, dir := newTestIntegrator(t)
+	sequence(t, dir, 0, 3)
+	if _, _, err := i.Integrate(ctx); err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	sequence(t, dir, 3, 2)
+	i.record(time.Now(), nil, 0, errors.New("boom"))
+
+	rec := httptest.NewRecorder()
+	i.Handler(0).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d, want %d", rec.Code, http.StatusOK)
+	}
+	for _, want := range []string{
+		"# TYPE serverless_log_integrate_pending_entries gauge\n",
+		"\nserverless_log_integrate_pending_entries 2\n",
+		"\nserverless_log_integrate_checkpoint_size 3\n",
+		"\nserverless_log_integrate_runs_total 2\n",
+		"\nserverless_log_integrate_failures_total 1\n",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("GET /metrics = %q, want it to contain %q", rec.Body, want)
+		}
+	}
+}
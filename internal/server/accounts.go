@@ -0,0 +1,119 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Usage holds the number of entries added to the log by a submitter.
+type Usage struct {
+	// Entries is the number of new entries added.
+	Entries uint64 `json:"entries"`
+	// Duplicates is the number of entries submitted which were already in
+	// the log.
+	Duplicates uint64 `json:"duplicates"`
+	// Bytes is the total size of the new entries added.
+	Bytes uint64 `json:"bytes"`
+	// Throttled is the number of submissions rejected for exceeding the
+	// submitter's rate limits or quotas, see WithLimiter.
+	Throttled uint64 `json:"throttled"`
+	// Rejected is the number of entries submitted which were refused by the
+	// log's admission policy, see WithPolicy.
+	Rejected uint64 `json:"rejected"`
+	// Last is when the submitter last added an entry.
+	Last time.Time `json:"last"`
+}
+
+// Accounts keeps per-identity counts of the entries added to the log, see
+// WithAccounts. The counts are held in memory, and start again from zero
+// when the server restarts.
+//
+// Accounts is an http.Handler serving the counts as a JSON object keyed by
+// identity, so it should only be exposed to the log's operators.
+type Accounts struct {
+	mu    sync.Mutex
+	usage map[string]*Usage
+}
+
+// NewAccounts returns an empty set of Accounts.
+func NewAccounts() *Accounts {
+	return &Accounts{usage: make(map[string]*Usage)}
+}
+
+// record counts an entry of size bytes added by id.
+func (a *Accounts) record(id string, size int, dupe bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u := a.get(id)
+	if dupe {
+		u.Duplicates++
+	} else {
+		u.Entries++
+		u.Bytes += uint64(size)
+	}
+	u.Last = time.Now()
+}
+
+// recordThrottled counts a submission by id which was rejected by a Limiter.
+func (a *Accounts) recordThrottled(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.get(id).Throttled++
+}
+
+// recordRejected counts an entry submitted by id which was refused by the
+// admission policy.
+func (a *Accounts) recordRejected(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.get(id).Rejected++
+}
+
+// get returns the usage of id, which must be called with mu held.
+func (a *Accounts) get(id string) *Usage {
+	u, ok := a.usage[id]
+	if !ok {
+		u = &Usage{}
+		a.usage[id] = u
+	}
+	return u
+}
+
+// Snapshot returns the current counts, keyed by identity. Entries added by
+// anonymous submitters are counted under the empty identity.
+func (a *Accounts) Snapshot() map[string]Usage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r := make(map[string]Usage, len(a.usage))
+	for id, u := range a.usage {
+		r[id] = *u
+	}
+	return r
+}
+
+// ServeHTTP implements http.Handler.
+func (a *Accounts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(a.Snapshot())
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrUnauthenticated is returned by Authenticators when a request doesn't
+// carry valid credentials.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Authenticator identifies the submitter of a request to the add endpoint.
+type Authenticator interface {
+	// Authenticate returns the identity of the submitter of r, or an error
+	// wrapping ErrUnauthenticated if r doesn't carry valid credentials.
+	Authenticate(r *http.Request) (string, error)
+}
+
+// identityKey is the context key under which the submitter's identity is
+// stored.
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx which carries the identity of the
+// submitter of an entry.
+func WithIdentity(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the identity of the submitter carried by ctx,
+// or the empty string if the submitter is anonymous.
+func IdentityFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(identityKey{}).(string)
+	return id
+}
+
+// bearerToken returns the token carried by r's Authorization header, if any.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// APIKeys is an Authenticator which identifies submitters by a secret API
+// key, sent either as a bearer token or in the X-API-Key header.
+type APIKeys struct {
+	// ids maps the SHA-256 hash of each key to the identity it belongs to,
+	// so that lookups don't leak the keys via timing.
+	ids map[[sha256.Size]byte]string
+}
+
+// ParseAPIKeys parses a list of API keys, with one key per line in the form
+// "<identity> <key>". Blank lines, and lines starting with #, are ignored. An
+// identity may have more than one key, e.g. while its key is being rotated.
+func ParseAPIKeys(text []byte) (*APIKeys, error) {
+	k := &APIKeys{ids: make(map[[sha256.Size]byte]string)}
+	for i, l := range strings.Split(string(text), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		f := strings.Fields(l)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("line %d: want \"<identity> <key>\"", i+1)
+		}
+		h := sha256.Sum256([]byte(f[1]))
+		if _, ok := k.ids[h]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key", i+1)
+		}
+		k.ids[h] = f[0]
+	}
+	if len(k.ids) == 0 {
+		return nil, errors.New("no API keys found")
+	}
+	return k, nil
+}
+
+// Authenticate implements Authenticator.
+func (k *APIKeys) Authenticate(r *http.Request) (string, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		var ok bool
+		if key, ok = bearerToken(r); !ok {
+			return "", fmt.Errorf("%w: no API key", ErrUnauthenticated)
+		}
+	}
+	id, ok := k.ids[sha256.Sum256([]byte(key))]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown API key", ErrUnauthenticated)
+	}
+	return id, nil
+}
+
+// AnyOf returns an Authenticator which accepts requests which are accepted by
+// any of auths, trying each in turn.
+func AnyOf(auths ...Authenticator) Authenticator {
+	return anyOf(auths)
+}
+
+type anyOf []Authenticator
+
+func (a anyOf) Authenticate(r *http.Request) (string, error) {
+	errs := make([]error, 0, len(a))
+	for _, auth := range a {
+		id, err := auth.Authenticate(r)
+		if err == nil {
+			return id, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return "", ErrUnauthenticated
+	}
+	return "", errors.Join(errs...)
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		text    string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			text: "# Submitters\nalice secret-a\n\nbob secret-b\nbob secret-b2\n",
+		}, {
+			desc:    "empty",
+			text:    "# No keys\n",
+			wantErr: true,
+		}, {
+			desc:    "missing key",
+			text:    "alice\n",
+			wantErr: true,
+		}, {
+			desc:    "duplicate key",
+			text:    "alice secret\nbob secret\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := ParseAPIKeys([]byte(test.text))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseAPIKeys: got err %v, want err %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	keys, err := ParseAPIKeys([]byte("alice secret-a\nbob secret-b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	others, err := ParseAPIKeys([]byte("carol secret-c\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		desc    string
+		auth    Authenticator
+		header  http.Header
+		want    string
+		wantErr bool
+	}{
+		{
+			desc:   "bearer token",
+			auth:   keys,
+			header: http.Header{"Authorization": {"Bearer secret-a"}},
+			want:   "alice",
+		}, {
+			desc:   "API key header",
+			auth:   keys,
+			header: http.Header{"X-Api-Key": {"secret-b"}},
+			want:   "bob",
+		}, {
+			desc:    "basic auth",
+			auth:    keys,
+			header:  http.Header{"Authorization": {"Basic c2VjcmV0LWE="}},
+			wantErr: true,
+		}, {
+			desc:    "unknown key",
+			auth:    keys,
+			header:  http.Header{"Authorization": {"Bearer secret-c"}},
+			wantErr: true,
+		}, {
+			desc:    "no credentials",
+			auth:    keys,
+			wantErr: true,
+		}, {
+			desc:   "any of, first",
+			auth:   AnyOf(keys, others),
+			header: http.Header{"Authorization": {"Bearer secret-a"}},
+			want:   "alice",
+		}, {
+			desc:   "any of, second",
+			auth:   AnyOf(keys, others),
+			header: http.Header{"Authorization": {"Bearer secret-c"}},
+			want:   "carol",
+		}, {
+			desc:    "any of, none",
+			auth:    AnyOf(keys, others),
+			header:  http.Header{"Authorization": {"Bearer secret-d"}},
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodPost, "http://example.com/add", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header = test.header
+			if r.Header == nil {
+				r.Header = http.Header{}
+			}
+			got, err := test.auth.Authenticate(r)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Authenticate: got err %v, want err %t", err, test.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUnauthenticated) {
+				t.Errorf("Authenticate: got err %v, want ErrUnauthenticated", err)
+			}
+			if got != test.want {
+				t.Errorf("Authenticate: got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
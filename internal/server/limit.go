@@ -0,0 +1,160 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limit describes the submissions which a submitter, or all submitters
+// together, may make to the add endpoint. The zero Limit allows any number of
+// submissions.
+type Limit struct {
+	// Rate is the sustained number of submissions per second allowed. Zero
+	// means submissions are not rate limited.
+	Rate float64
+	// Burst is the number of submissions which may be made at once. It must
+	// be at least one if Rate is set.
+	Burst int
+	// Quota is the number of submissions allowed in each QuotaPeriod. Zero
+	// means submissions are not subject to a quota.
+	Quota uint64
+	// QuotaPeriod is the length of the period over which Quota applies. It
+	// must be set if Quota is set.
+	QuotaPeriod time.Duration
+}
+
+func (l Limit) validate() error {
+	switch {
+	case l.Rate < 0:
+		return errors.New("rate must not be negative")
+	case l.Rate > 0 && l.Burst < 1:
+		return errors.New("burst must be at least 1")
+	case l.Quota > 0 && l.QuotaPeriod <= 0:
+		return errors.New("quota period must be set")
+	}
+	return nil
+}
+
+// LimitOpts holds the limits applied by a Limiter.
+type LimitOpts struct {
+	// PerIdentity limits the submissions of each identity. Anonymous
+	// submitters share a single identity.
+	PerIdentity Limit
+	// Global limits the submissions of all submitters together.
+	Global Limit
+}
+
+// Limiter applies rate limits and quotas to submissions to the add endpoint,
+// see WithLimiter, so that no single submitter can monopolise the sequencer.
+//
+// Quotas are counted in fixed periods, starting when a submitter first makes a
+// submission. Like Accounts, a Limiter holds its state in memory, so it's
+// reset when the server restarts.
+type Limiter struct {
+	opts LimitOpts
+
+	mu       sync.Mutex
+	global   *limitState
+	identity map[string]*limitState
+}
+
+// limitState tracks the submissions made under a Limit.
+type limitState struct {
+	l *rate.Limiter
+	// used is the number of submissions made since start.
+	used  uint64
+	start time.Time
+}
+
+// NewLimiter returns a Limiter which applies opts.
+func NewLimiter(opts LimitOpts) (*Limiter, error) {
+	if err := opts.PerIdentity.validate(); err != nil {
+		return nil, fmt.Errorf("invalid per-identity limit: %v", err)
+	}
+	if err := opts.Global.validate(); err != nil {
+		return nil, fmt.Errorf("invalid global limit: %v", err)
+	}
+	return &Limiter{
+		opts:     opts,
+		global:   newLimitState(opts.Global),
+		identity: make(map[string]*limitState),
+	}, nil
+}
+
+func newLimitState(l Limit) *limitState {
+	s := &limitState{}
+	if l.Rate > 0 {
+		s.l = rate.NewLimiter(rate.Limit(l.Rate), l.Burst)
+	}
+	return s
+}
+
+// Allow reports whether id may make a submission at time now, counting it
+// against id's limits if so. Otherwise, it returns how long id should wait
+// before trying again.
+func (l *Limiter) Allow(id string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.identity[id]
+	if !ok {
+		s = newLimitState(l.opts.PerIdentity)
+		l.identity[id] = s
+	}
+	// Check both quotas before taking a token from either rate limiter, so
+	// that a rejected submission isn't counted against the other limit.
+	wait := max(s.quotaWait(l.opts.PerIdentity, now), l.global.quotaWait(l.opts.Global, now))
+	if wait > 0 {
+		return false, wait
+	}
+	var rs []*rate.Reservation
+	for _, ls := range []*limitState{s, l.global} {
+		if ls.l == nil {
+			continue
+		}
+		r := ls.l.ReserveN(now, 1)
+		rs = append(rs, r)
+		wait = max(wait, r.DelayFrom(now))
+	}
+	if wait > 0 {
+		for _, r := range rs {
+			r.CancelAt(now)
+		}
+		return false, wait
+	}
+	s.used++
+	l.global.used++
+	return true, 0
+}
+
+// quotaWait returns how long from now it is until a submission would be
+// within the quota of lim, or zero if one would be now.
+func (s *limitState) quotaWait(lim Limit, now time.Time) time.Duration {
+	if lim.Quota == 0 {
+		return 0
+	}
+	if s.start.IsZero() || now.Sub(s.start) >= lim.QuotaPeriod {
+		s.start, s.used = now, 0
+	}
+	if s.used < lim.Quota {
+		return 0
+	}
+	return s.start.Add(lim.QuotaPeriod).Sub(now)
+}
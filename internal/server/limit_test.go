@@ -0,0 +1,140 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	type call struct {
+		id       string
+		at       time.Duration
+		wantOK   bool
+		wantWait time.Duration
+	}
+	for _, test := range []struct {
+		desc  string
+		opts  LimitOpts
+		calls []call
+	}{
+		{
+			desc: "unlimited",
+			calls: []call{
+				{id: "a", wantOK: true},
+				{id: "a", wantOK: true},
+				{id: "b", wantOK: true},
+			},
+		}, {
+			desc: "per-identity rate",
+			opts: LimitOpts{PerIdentity: Limit{Rate: 1, Burst: 2}},
+			calls: []call{
+				{id: "a", wantOK: true},
+				{id: "a", wantOK: true},
+				{id: "a", wantWait: time.Second},
+				{id: "b", wantOK: true},
+				{id: "a", at: 500 * time.Millisecond, wantWait: 500 * time.Millisecond},
+				{id: "a", at: time.Second, wantOK: true},
+			},
+		}, {
+			desc: "global rate",
+			opts: LimitOpts{Global: Limit{Rate: 2, Burst: 1}},
+			calls: []call{
+				{id: "a", wantOK: true},
+				{id: "b", wantWait: 500 * time.Millisecond},
+				{id: "b", at: 500 * time.Millisecond, wantOK: true},
+			},
+		}, {
+			desc: "rejected by global rate doesn't use per-identity rate",
+			opts: LimitOpts{
+				PerIdentity: Limit{Rate: 1, Burst: 1},
+				Global:      Limit{Rate: 1, Burst: 1},
+			},
+			calls: []call{
+				{id: "a", wantOK: true},
+				{id: "b", wantWait: time.Second},
+				{id: "b", at: time.Second, wantOK: true},
+			},
+		}, {
+			desc: "per-identity quota",
+			opts: LimitOpts{PerIdentity: Limit{Quota: 2, QuotaPeriod: time.Hour}},
+			calls: []call{
+				{id: "a", wantOK: true},
+				{id: "a", at: time.Minute, wantOK: true},
+				{id: "a", at: 10 * time.Minute, wantWait: 50 * time.Minute},
+				{id: "b", at: 10 * time.Minute, wantOK: true},
+				{id: "a", at: time.Hour, wantOK: true},
+			},
+		}, {
+			desc: "global quota",
+			opts: LimitOpts{Global: Limit{Quota: 2, QuotaPeriod: time.Hour}},
+			calls: []call{
+				{id: "a", wantOK: true},
+				{id: "b", wantOK: true},
+				{id: "c", at: 30 * time.Minute, wantWait: 30 * time.Minute},
+			},
+		}, {
+			desc: "rejected by quota doesn't use rate",
+			opts: LimitOpts{
+				PerIdentity: Limit{Rate: 1, Burst: 1},
+				Global:      Limit{Quota: 1, QuotaPeriod: time.Hour},
+			},
+			calls: []call{
+				{id: "a", wantOK: true},
+				{id: "b", wantWait: time.Hour},
+				{id: "b", at: time.Hour, wantOK: true},
+			},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			l, err := NewLimiter(test.opts)
+			if err != nil {
+				t.Fatalf("NewLimiter: %v", err)
+			}
+			for i, c := range test.calls {
+				ok, wait := l.Allow(c.id, start.Add(c.at))
+				if ok != c.wantOK || wait != c.wantWait {
+					t.Errorf("%d: Allow(%q) = %t, %v, want %t, %v", i, c.id, ok, wait, c.wantOK, c.wantWait)
+				}
+			}
+		})
+	}
+}
+
+func TestNewLimiterErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		opts LimitOpts
+	}{
+		{
+			desc: "negative rate",
+			opts: LimitOpts{Global: Limit{Rate: -1, Burst: 1}},
+		}, {
+			desc: "no burst",
+			opts: LimitOpts{PerIdentity: Limit{Rate: 1}},
+		}, {
+			desc: "no quota period",
+			opts: LimitOpts{PerIdentity: Limit{Quota: 10}},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if _, err := NewLimiter(test.opts); err == nil {
+				t.Error("NewLimiter: got nil err, want err")
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// clockSkew is the leeway allowed when checking the validity period of
+	// tokens.
+	clockSkew = time.Minute
+	// jwksRefreshInterval is how often the issuer's signing keys are fetched
+	// again, so that rotated keys are picked up.
+	jwksRefreshInterval = time.Hour
+	// jwksMinRefreshInterval limits how often the keys are fetched again,
+	// whether because a token is signed by an unknown key or because an
+	// earlier fetch failed.
+	jwksMinRefreshInterval = time.Minute
+	// jwksFetchTimeout bounds each fetch of the issuer's keys.
+	jwksFetchTimeout = 10 * time.Second
+)
+
+// OIDCOpts holds configuration options for an OIDCAuthenticator.
+type OIDCOpts struct {
+	// Issuer is the issuer URL of the OpenID Connect provider, e.g.
+	// https://accounts.google.com. Its signing keys are found via its
+	// discovery document.
+	Issuer string
+	// Audience must be one of the audiences of accepted tokens.
+	Audience string
+	// Subjects, if set, lists the subjects of accepted tokens. Otherwise any
+	// subject is accepted.
+	Subjects []string
+	// HTTPClient is used to fetch the issuer's discovery document and keys.
+	// If unset, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// OIDCAuthenticator is an Authenticator which identifies submitters by an
+// OpenID Connect ID token, sent as a bearer token, e.g. as issued to a
+// workload by its cloud provider. The identity of the submitter is the token's
+// subject.
+//
+// Tokens must be signed with RS256 or ES256.
+type OIDCAuthenticator struct {
+	opts    OIDCOpts
+	jwksURI string
+
+	// refresh ensures that concurrent requests share a single fetch of the
+	// issuer's keys.
+	refresh singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetched   time.Time
+	attempted time.Time
+}
+
+// NewOIDCAuthenticator returns an OIDCAuthenticator which accepts the tokens
+// described by opts. The issuer's discovery document and keys are fetched
+// immediately, so that misconfiguration is detected early.
+func NewOIDCAuthenticator(ctx context.Context, opts OIDCOpts) (*OIDCAuthenticator, error) {
+	if opts.Issuer == "" || opts.Audience == "" {
+		return nil, errors.New("OIDC issuer and audience must be set")
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	o := &OIDCAuthenticator{opts: opts}
+	var disc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := o.getJSON(ctx, strings.TrimSuffix(opts.Issuer, "/")+"/.well-known/openid-configuration", &disc); err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC discovery document: %v", err)
+	}
+	if disc.Issuer != opts.Issuer {
+		return nil, fmt.Errorf("OIDC discovery document is for issuer %q, want %q", disc.Issuer, opts.Issuer)
+	}
+	if disc.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document has no jwks_uri")
+	}
+	o.jwksURI = disc.JWKSURI
+	o.attempted = time.Now()
+	if err := o.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Authenticate implements Authenticator.
+func (o *OIDCAuthenticator) Authenticate(r *http.Request) (string, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return "", fmt.Errorf("%w: no bearer token", ErrUnauthenticated)
+	}
+	sub, err := o.verify(r.Context(), token, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	return sub, nil
+}
+
+// verify checks that token is a valid ID token at time now, and returns its
+// subject.
+func (o *OIDCAuthenticator) verify(ctx context.Context, token string, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("malformed token")
+	}
+	var hdr struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return "", fmt.Errorf("malformed token header: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("malformed token signature: %v", err)
+	}
+	key, err := o.key(ctx, hdr.Kid)
+	if err != nil {
+		return "", err
+	}
+	if err := verifySignature(hdr.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return "", err
+	}
+
+	var claims struct {
+		Issuer    string   `json:"iss"`
+		Subject   string   `json:"sub"`
+		Audience  audience `json:"aud"`
+		Expiry    int64    `json:"exp"`
+		NotBefore int64    `json:"nbf"`
+		IssuedAt  int64    `json:"iat"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("malformed token claims: %v", err)
+	}
+	switch {
+	case claims.Issuer != o.opts.Issuer:
+		return "", fmt.Errorf("token issued by %q, want %q", claims.Issuer, o.opts.Issuer)
+	case !slices.Contains(claims.Audience, o.opts.Audience):
+		return "", fmt.Errorf("token audience %q doesn't include %q", claims.Audience, o.opts.Audience)
+	case claims.Expiry == 0 || now.After(time.Unix(claims.Expiry, 0).Add(clockSkew)):
+		return "", errors.New("token has expired")
+	case now.Add(clockSkew).Before(time.Unix(max(claims.NotBefore, claims.IssuedAt), 0)):
+		return "", errors.New("token is not yet valid")
+	case claims.Subject == "":
+		return "", errors.New("token has no subject")
+	case len(o.opts.Subjects) > 0 && !slices.Contains(o.opts.Subjects, claims.Subject):
+		return "", fmt.Errorf("subject %q is not allowed", claims.Subject)
+	}
+	return claims.Subject, nil
+}
+
+// key returns the issuer's key with the given ID, fetching the issuer's keys
+// again if they're stale or the key is not known. The keys are fetched at most
+// once every jwksMinRefreshInterval, however many requests need them.
+func (o *OIDCAuthenticator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	k, ok := o.keys[kid]
+	stale := time.Since(o.fetched) > jwksRefreshInterval
+	o.mu.Unlock()
+	if ok && !stale {
+		return k, nil
+	}
+	if err := o.maybeRefreshKeys(ctx); err != nil {
+		if ok {
+			klog.Warningf("Using stale OIDC keys: %v", err)
+			return k, nil
+		}
+		return nil, err
+	}
+	o.mu.Lock()
+	k, ok = o.keys[kid]
+	o.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("token signed by unknown key %q", kid)
+	}
+	return k, nil
+}
+
+// maybeRefreshKeys fetches the issuer's keys, unless they were last fetched,
+// or a fetch was attempted, within jwksMinRefreshInterval. Concurrent callers
+// share the same fetch, which isn't cancelled if the caller which started it
+// goes away.
+func (o *OIDCAuthenticator) maybeRefreshKeys(ctx context.Context) error {
+	_, err, _ := o.refresh.Do("", func() (any, error) {
+		o.mu.Lock()
+		if time.Since(o.attempted) < jwksMinRefreshInterval {
+			o.mu.Unlock()
+			return nil, nil
+		}
+		o.attempted = time.Now()
+		o.mu.Unlock()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jwksFetchTimeout)
+		defer cancel()
+		return nil, o.refreshKeys(ctx)
+	})
+	return err
+}
+
+// refreshKeys fetches the issuer's signing keys.
+func (o *OIDCAuthenticator) refreshKeys(ctx context.Context) error {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := o.getJSON(ctx, o.jwksURI, &jwks); err != nil {
+		return fmt.Errorf("failed to fetch OIDC keys: %v", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.Kty == "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				klog.Warningf("Ignoring malformed OIDC key %q", k.Kid)
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case k.Kty == "EC" && k.Crv == "P-256":
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				klog.Warningf("Ignoring malformed OIDC key %q", k.Kid)
+				continue
+			}
+			pk := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if !pk.Curve.IsOnCurve(pk.X, pk.Y) {
+				klog.Warningf("Ignoring invalid OIDC key %q", k.Kid)
+				continue
+			}
+			keys[k.Kid] = pk
+		}
+	}
+	if len(keys) == 0 {
+		return errors.New("issuer has no supported signing keys")
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.keys, o.fetched = keys, time.Now()
+	return nil
+}
+
+// getJSON fetches u and decodes the JSON response into v.
+func (o *OIDCAuthenticator) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.Unmarshal(b, v)
+}
+
+// verifySignature checks a JWS signature made with the algorithm alg.
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	h := sha256.Sum256(signed)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig); err != nil {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			break
+		}
+		if len(sig) != 64 {
+			return errors.New("invalid token signature")
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, h[:], r, s) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported token algorithm %q for key", alg)
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token into v.
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// audience is the aud claim of a token, which may be a string or a list of
+// strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var l []string
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	*a = l
+	return nil
+}
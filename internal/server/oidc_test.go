@@ -0,0 +1,376 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testIssuer is an OpenID Connect provider which issues tokens signed with an
+// RSA and an ECDSA key.
+type testIssuer struct {
+	srv    *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ti := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+	b64 := base64.RawURLEncoding.EncodeToString
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   ti.srv.URL,
+			"jwks_uri": ti.srv.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{
+				{
+					"kty": "RSA",
+					"kid": "rsa",
+					"use": "sig",
+					"n":   b64(rsaKey.N.Bytes()),
+					"e":   b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+				}, {
+					"kty": "EC",
+					"kid": "ec",
+					"crv": "P-256",
+					"x":   b64(ecKey.X.FillBytes(make([]byte, 32))),
+					"y":   b64(ecKey.Y.FillBytes(make([]byte, 32))),
+				},
+			},
+		})
+	})
+	ti.srv = httptest.NewServer(mux)
+	t.Cleanup(ti.srv.Close)
+	return ti
+}
+
+// token returns a token with the given claims, signed with the issuer's key
+// with ID kid.
+func (ti *testIssuer) token(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+	alg := map[string]string{"rsa": "RS256", "ec": "ES256"}[kid]
+	hdr, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(body)
+	h := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch kid {
+	case "rsa":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, ti.rsaKey, crypto.SHA256, h[:])
+	case "ec":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, ti.ecKey, h[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	ti := newTestIssuer(t)
+	now := time.Now()
+	claims := func(mod func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"iss": ti.srv.URL,
+			"aud": "https://log.example.com",
+			"sub": "builder@example.com",
+			"iat": now.Unix(),
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+	for _, test := range []struct {
+		desc     string
+		subjects []string
+		kid      string
+		claims   map[string]any
+		mangle   func(string) string
+		want     string
+		wantErr  bool
+	}{
+		{
+			desc:   "RSA",
+			kid:    "rsa",
+			claims: claims(nil),
+			want:   "builder@example.com",
+		}, {
+			desc:   "ECDSA",
+			kid:    "ec",
+			claims: claims(nil),
+			want:   "builder@example.com",
+		}, {
+			desc:     "allowed subject",
+			subjects: []string{"other@example.com", "builder@example.com"},
+			kid:      "rsa",
+			claims:   claims(nil),
+			want:     "builder@example.com",
+		}, {
+			desc: "audience list",
+			kid:  "rsa",
+			claims: claims(func(c map[string]any) {
+				c["aud"] = []string{"other", "https://log.example.com"}
+			}),
+			want: "builder@example.com",
+		}, {
+			desc:     "disallowed subject",
+			subjects: []string{"other@example.com"},
+			kid:      "rsa",
+			claims:   claims(nil),
+			wantErr:  true,
+		}, {
+			desc: "wrong audience",
+			kid:  "rsa",
+			claims: claims(func(c map[string]any) {
+				c["aud"] = "https://other.example.com"
+			}),
+			wantErr: true,
+		}, {
+			desc: "wrong issuer",
+			kid:  "rsa",
+			claims: claims(func(c map[string]any) {
+				c["iss"] = "https://accounts.example.com"
+			}),
+			wantErr: true,
+		}, {
+			desc: "expired",
+			kid:  "rsa",
+			claims: claims(func(c map[string]any) {
+				c["exp"] = now.Add(-time.Hour).Unix()
+			}),
+			wantErr: true,
+		}, {
+			desc: "not yet valid",
+			kid:  "ec",
+			claims: claims(func(c map[string]any) {
+				c["nbf"] = now.Add(time.Hour).Unix()
+			}),
+			wantErr: true,
+		}, {
+			desc: "no subject",
+			kid:  "ec",
+			claims: claims(func(c map[string]any) {
+				delete(c, "sub")
+			}),
+			wantErr: true,
+		}, {
+			desc:   "bad signature",
+			kid:    "rsa",
+			claims: claims(nil),
+			mangle: func(tok string) string {
+				return tok[:len(tok)-4] + "AAAA"
+			},
+			wantErr: true,
+		}, {
+			desc:   "malformed",
+			kid:    "rsa",
+			claims: claims(nil),
+			mangle: func(string) string {
+				return "not-a-token"
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			o, err := NewOIDCAuthenticator(ctx, OIDCOpts{
+				Issuer:     ti.srv.URL,
+				Audience:   "https://log.example.com",
+				Subjects:   test.subjects,
+				HTTPClient: ti.srv.Client(),
+			})
+			if err != nil {
+				t.Fatalf("NewOIDCAuthenticator: %v", err)
+			}
+			tok := ti.token(t, test.kid, test.claims)
+			if test.mangle != nil {
+				tok = test.mangle(tok)
+			}
+			r, err := http.NewRequest(http.MethodPost, "http://example.com/add", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Authorization", "Bearer "+tok)
+			got, err := o.Authenticate(r)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Authenticate: got err %v, want err %t", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("Authenticate: got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// countingTransport counts the requests made for an issuer's keys, and
+// blocks them until unblock is closed, if set.
+type countingTransport struct {
+	base    http.RoundTripper
+	unblock chan struct{}
+
+	mu      sync.Mutex
+	fetches int
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Path == "/keys" {
+		c.mu.Lock()
+		c.fetches++
+		c.mu.Unlock()
+		if c.unblock != nil {
+			<-c.unblock
+		}
+	}
+	return c.base.RoundTrip(r)
+}
+
+func (c *countingTransport) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fetches
+}
+
+func TestOIDCKeyRefresh(t *testing.T) {
+	ctx := context.Background()
+	ti := newTestIssuer(t)
+	newAuth := func(t *testing.T) (*OIDCAuthenticator, *countingTransport) {
+		t.Helper()
+		tr := &countingTransport{base: ti.srv.Client().Transport}
+		o, err := NewOIDCAuthenticator(ctx, OIDCOpts{
+			Issuer:     ti.srv.URL,
+			Audience:   "https://log.example.com",
+			HTTPClient: &http.Client{Transport: tr},
+		})
+		if err != nil {
+			t.Fatalf("NewOIDCAuthenticator: %v", err)
+		}
+		return o, tr
+	}
+	// age makes the last fetch of o's keys, and the last attempt, d ago.
+	age := func(o *OIDCAuthenticator, d time.Duration) {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.fetched, o.attempted = o.fetched.Add(-d), o.attempted.Add(-d)
+	}
+
+	t.Run("stale keys are fetched once", func(t *testing.T) {
+		o, tr := newAuth(t)
+		age(o, 2*jwksRefreshInterval)
+		tr.unblock = make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := o.key(ctx, "rsa"); err != nil {
+					t.Errorf("key: %v", err)
+				}
+			}()
+		}
+		for tr.count() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(tr.unblock)
+		wg.Wait()
+		if got, want := tr.count(), 2; got != want {
+			t.Errorf("got %d key fetches, want %d", got, want)
+		}
+	})
+
+	t.Run("unknown keys are rate limited", func(t *testing.T) {
+		o, tr := newAuth(t)
+		age(o, 2*jwksMinRefreshInterval)
+		for i := 0; i < 10; i++ {
+			if _, err := o.key(ctx, "unknown"); err == nil {
+				t.Fatal("key: got no error for unknown key")
+			}
+		}
+		if got, want := tr.count(), 2; got != want {
+			t.Errorf("got %d key fetches, want %d", got, want)
+		}
+		// Known keys are still returned without fetching.
+		if _, err := o.key(ctx, "ec"); err != nil {
+			t.Errorf("key: %v", err)
+		}
+		if got, want := tr.count(), 2; got != want {
+			t.Errorf("got %d key fetches, want %d", got, want)
+		}
+	})
+}
+
+func TestNewOIDCAuthenticatorErrors(t *testing.T) {
+	ctx := context.Background()
+	ti := newTestIssuer(t)
+	for _, test := range []struct {
+		desc string
+		opts OIDCOpts
+	}{
+		{
+			desc: "no audience",
+			opts: OIDCOpts{Issuer: ti.srv.URL},
+		}, {
+			desc: "issuer mismatch",
+			opts: OIDCOpts{Issuer: ti.srv.URL + "/", Audience: "log"},
+		}, {
+			desc: "no discovery document",
+			opts: OIDCOpts{Issuer: ti.srv.URL + "/missing", Audience: "log"},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			test.opts.HTTPClient = ti.srv.Client()
+			if _, err := NewOIDCAuthenticator(ctx, test.opts); err == nil {
+				t.Error("NewOIDCAuthenticator: got nil err, want err")
+			}
+		})
+	}
+}
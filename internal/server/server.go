@@ -0,0 +1,290 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server provides HTTP handlers for running a serverless log as a
+// long-running server, which accepts new entries via its add endpoint.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/internal/admission"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"k8s.io/klog/v2"
+)
+
+// MaxLeafSize is the largest entry accepted by the add endpoint. Larger
+// entries should be stored as blobs, see WithBlobs.
+const MaxLeafSize = 16 << 20
+
+// BlobStorer is implemented by storage which can store large entries in the
+// log's blobs/ area, see api.BlobRef.
+type BlobStorer interface {
+	StoreBlob(ctx context.Context, blob []byte) (api.BlobRef, error)
+}
+
+// AddOption is used to configure optional behaviour of an AddHandler.
+type AddOption func(*AddHandler)
+
+// WithBlobs causes entries larger than threshold bytes to be stored in the
+// log's blobs/ area by bs, and a reference to them sequenced in their place.
+func WithBlobs(bs BlobStorer, threshold int) AddOption {
+	return func(a *AddHandler) {
+		a.blobs = bs
+		a.blobThreshold = threshold
+	}
+}
+
+// WithAuthenticator requires submitters to authenticate with auth. Requests
+// which fail to authenticate are rejected with 401 Unauthorized, and the
+// identity of the submitter is otherwise available to later stages via
+// IdentityFromContext.
+func WithAuthenticator(auth Authenticator) AddOption {
+	return func(a *AddHandler) {
+		a.auth = auth
+	}
+}
+
+// WithAccounts causes the entries added by each submitter to be counted in
+// acc.
+func WithAccounts(acc *Accounts) AddOption {
+	return func(a *AddHandler) {
+		a.accounts = acc
+	}
+}
+
+// WithLimiter causes submissions to be subject to the rate limits and quotas
+// applied by l, with each submitter identified as by WithAuthenticator.
+// Submissions over the limits are rejected with 429 Too Many Requests, and a
+// Retry-After header saying when the submitter may try again.
+func WithLimiter(l *Limiter) AddOption {
+	return func(a *AddHandler) {
+		a.limiter = l
+	}
+}
+
+// WithPolicy causes entries to be checked against p before they're sequenced.
+// Entries which p rejects are refused with 400 Bad Request, or 413 Request
+// Entity Too Large if they're too large, along with the reason for their
+// rejection.
+func WithPolicy(p admission.Policy) AddOption {
+	return func(a *AddHandler) {
+		a.policy = p
+	}
+}
+
+// WithBackpressure causes new entries to be refused with 503 Service
+// Unavailable, and a Retry-After header of retryAfter, while busy reports that
+// too many entries are waiting to be integrated, so that a backlog can't grow
+// without bound while integration catches up.
+func WithBackpressure(busy func(ctx context.Context) (bool, error), retryAfter time.Duration) AddOption {
+	return func(a *AddHandler) {
+		a.busy = busy
+		a.retryAfter = retryAfter
+	}
+}
+
+// WithAddHook causes f to be called with the response to each entry which
+// is sequenced, e.g. so that new entries can be integrated promptly.
+func WithAddHook(f func(api.AddResponse)) AddOption {
+	return func(a *AddHandler) {
+		a.hook = f
+	}
+}
+
+// AddHandler is an http.Handler implementing a log's add endpoint.
+//
+// Entries are submitted as the body of a POST request, and are sequenced
+// immediately. The response is a marshalled api.AddResponse, holding the index
+// assigned to the entry, or that of the original entry if it's a duplicate.
+// Entries are integrated into the log's tree separately, e.g. by the integrate
+// tool.
+type AddHandler struct {
+	// mu serialises calls to the storage, which doesn't support concurrent
+	// sequencing.
+	mu            sync.Mutex
+	s             log.Sequencer
+	h             merkle.LogHasher
+	blobs         BlobStorer
+	blobThreshold int
+	auth          Authenticator
+	accounts      *Accounts
+	limiter       *Limiter
+	policy        admission.Policy
+	busy          func(ctx context.Context) (bool, error)
+	retryAfter    time.Duration
+	hook          func(api.AddResponse)
+}
+
+// NewAddHandler returns an AddHandler which sequences entries with s, whose
+// leaf hashes are computed with h.
+func NewAddHandler(s log.Sequencer, h merkle.LogHasher, opts ...AddOption) *AddHandler {
+	a := &AddHandler{s: s, h: h}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// ServeHTTP implements http.Handler.
+func (a *AddHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	if a.auth != nil {
+		id, err := a.auth.Authenticate(r)
+		if err != nil {
+			klog.V(1).Infof("Rejected submission from %s: %v", r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		ctx = WithIdentity(ctx, id)
+	}
+	if a.limiter != nil {
+		id := IdentityFromContext(ctx)
+		if ok, wait := a.limiter.Allow(id, time.Now()); !ok {
+			klog.V(1).Infof("Throttled submission from %q for %v", id, wait)
+			if a.accounts != nil {
+				a.accounts.recordThrottled(id)
+			}
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(wait.Seconds())), 10))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+	}
+	if a.busy != nil {
+		busy, err := a.busy(ctx)
+		if err != nil {
+			klog.Errorf("Failed to check backlog: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if busy {
+			id := IdentityFromContext(ctx)
+			klog.V(1).Infof("Refused submission from %q while integration catches up", id)
+			if a.accounts != nil {
+				a.accounts.recordThrottled(id)
+			}
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(a.retryAfter.Seconds())), 10))
+			http.Error(w, "Too many entries are waiting to be integrated", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	leaf, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxLeafSize))
+	if err != nil {
+		var mbErr *http.MaxBytesError
+		if errors.As(err, &mbErr) {
+			http.Error(w, fmt.Sprintf("Entry is larger than %d bytes", MaxLeafSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to read entry: %v", err), http.StatusBadRequest)
+		return
+	}
+	if a.policy != nil {
+		err := a.policy.Admit(ctx, admission.Entry{Data: leaf, ContentType: r.Header.Get("Content-Type")})
+		switch {
+		case errors.Is(err, admission.ErrRejected):
+			id := IdentityFromContext(ctx)
+			klog.V(1).Infof("Rejected entry from %q: %v", id, err)
+			if a.accounts != nil {
+				a.accounts.recordRejected(id)
+			}
+			status := http.StatusBadRequest
+			if errors.Is(err, admission.ErrTooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), status)
+			return
+		case err != nil:
+			klog.Errorf("Failed to apply admission policy: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	resp, err := a.Add(ctx, leaf)
+	if err != nil {
+		klog.Errorf("Failed to add entry: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	b, err := resp.MarshalText()
+	if err != nil {
+		klog.Errorf("Failed to marshal add response: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(b)
+}
+
+// Add sequences leaf, storing it as a blob if it's large enough, see WithBlobs.
+// The entry is accounted to the identity carried by ctx, if any.
+func (a *AddHandler) Add(ctx context.Context, leaf []byte) (api.AddResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.blobs != nil && a.blobThreshold > 0 && len(leaf) > a.blobThreshold {
+		ref, err := a.blobs.StoreBlob(ctx, leaf)
+		if err != nil {
+			return api.AddResponse{}, fmt.Errorf("failed to store blob: %v", err)
+		}
+		if leaf, err = ref.MarshalText(); err != nil {
+			return api.AddResponse{}, fmt.Errorf("failed to marshal blob reference: %v", err)
+		}
+	}
+	resp, err := log.Add(ctx, a.s, a.h, leaf)
+	if err != nil {
+		return api.AddResponse{}, fmt.Errorf("failed to sequence entry: %v", err)
+	}
+	id := IdentityFromContext(ctx)
+	klog.V(1).Infof("Entry from %q sequenced at index %d (duplicate: %t)", id, resp.Index, resp.Duplicate)
+	if a.accounts != nil {
+		a.accounts.record(id, len(leaf), resp.Duplicate)
+	}
+	if a.hook != nil {
+		a.hook(resp)
+	}
+	return resp, nil
+}
+
+// FileHandler returns an http.Handler which serves the files of a log stored
+// in rootDir, e.g. its checkpoint and tiles, so that clients can read the log
+// from the same server which accepts its entries. Hidden files, such as the
+// log's lock files, are not served.
+func FileHandler(rootDir string) http.Handler {
+	fs := http.FileServer(http.Dir(rootDir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, e := range strings.Split(r.URL.Path, "/") {
+			if strings.HasPrefix(e, ".") {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		fs.ServeHTTP(w, r)
+	})
+}
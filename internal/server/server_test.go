@@ -0,0 +1,344 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/internal/admission"
+	"github.com/transparency-dev/serverless-log/testonly"
+)
+
+type fakeBlobs map[string][]byte
+
+func (f fakeBlobs) StoreBlob(_ context.Context, blob []byte) (api.BlobRef, error) {
+	ref := api.NewBlobRef(blob)
+	f[string(ref.Hash)] = blob
+	return ref, nil
+}
+
+func TestAddHandler(t *testing.T) {
+	ctx := context.Background()
+	st := testonly.NewMemStorage()
+	blobs := fakeBlobs{}
+	var added []api.AddResponse
+	srv := httptest.NewServer(NewAddHandler(st, rfc6962.DefaultHasher, WithBlobs(blobs, 10), WithAddHook(func(r api.AddResponse) {
+		added = append(added, r)
+	})))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := client.NewSubmitter(u, client.WithHTTPClient(srv.Client()))
+
+	for _, test := range []struct {
+		desc string
+		leaf string
+		want client.SubmitResult
+	}{
+		{
+			desc: "first",
+			leaf: "one",
+			want: client.SubmitResult{Index: 0},
+		}, {
+			desc: "second",
+			leaf: "two",
+			want: client.SubmitResult{Index: 1},
+		}, {
+			desc: "duplicate",
+			leaf: "one",
+			want: client.SubmitResult{Index: 0, Duplicate: true},
+		}, {
+			desc: "blob",
+			leaf: "a rather large entry",
+			want: client.SubmitResult{Index: 2},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := s.Submit(ctx, []byte(test.leaf))
+			if err != nil {
+				t.Fatalf("Submit: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Submit(%q) = %+v, want %+v", test.leaf, got, test.want)
+			}
+		})
+	}
+	if len(blobs) != 1 {
+		t.Errorf("Got %d blobs, want 1", len(blobs))
+	}
+	if len(added) != 4 || !added[2].Duplicate {
+		t.Errorf("Add hook got %+v, want 4 responses with the third a duplicate", added)
+	}
+	if _, err := st.ScanSequenced(ctx, 2, func(_ uint64, e []byte) error {
+		if !api.IsBlobRef(e) {
+			t.Errorf("Entry 2 is %q, want a blob reference", e)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("ScanSequenced: %v", err)
+	}
+}
+
+func TestAddHandlerErrors(t *testing.T) {
+	srv := httptest.NewServer(NewAddHandler(testonly.NewMemStorage(), rfc6962.DefaultHasher))
+	defer srv.Close()
+	for _, test := range []struct {
+		desc       string
+		method     string
+		body       []byte
+		wantStatus int
+	}{
+		{
+			desc:       "GET",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+		}, {
+			desc:       "too large",
+			method:     http.MethodPost,
+			body:       bytes.Repeat([]byte("x"), MaxLeafSize+1),
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, srv.URL, bytes.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.wantStatus {
+				t.Errorf("Got status %d, want %d", resp.StatusCode, test.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAddHandlerAuth(t *testing.T) {
+	keys, err := ParseAPIKeys([]byte("alice secret-a\nbob secret-b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc := NewAccounts()
+	srv := httptest.NewServer(NewAddHandler(testonly.NewMemStorage(), rfc6962.DefaultHasher, WithAuthenticator(keys), WithAccounts(acc)))
+	defer srv.Close()
+	for _, test := range []struct {
+		desc       string
+		key        string
+		leaf       string
+		wantStatus int
+	}{
+		{desc: "no key", leaf: "one", wantStatus: http.StatusUnauthorized},
+		{desc: "wrong key", key: "secret-c", leaf: "one", wantStatus: http.StatusUnauthorized},
+		{desc: "alice", key: "secret-a", leaf: "one", wantStatus: http.StatusOK},
+		{desc: "alice again", key: "secret-a", leaf: "two", wantStatus: http.StatusOK},
+		{desc: "bob duplicate", key: "secret-b", leaf: "one", wantStatus: http.StatusOK},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader([]byte(test.leaf)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.key != "" {
+				req.Header.Set("Authorization", "Bearer "+test.key)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.wantStatus {
+				t.Errorf("Got status %d, want %d", resp.StatusCode, test.wantStatus)
+			}
+			if got := resp.Header.Get("WWW-Authenticate"); (got != "") != (test.wantStatus == http.StatusUnauthorized) {
+				t.Errorf("Got WWW-Authenticate %q with status %d", got, resp.StatusCode)
+			}
+		})
+	}
+
+	got := acc.Snapshot()
+	for id, u := range got {
+		if u.Last.IsZero() || time.Since(u.Last) > time.Minute {
+			t.Errorf("%s: got last add at %v", id, u.Last)
+		}
+	}
+	want := map[string]Usage{
+		"alice": {Entries: 2, Bytes: 6},
+		"bob":   {Duplicates: 1},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(Usage{}, "Last")); diff != "" {
+		t.Errorf("Accounts diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestAddHandlerLimits(t *testing.T) {
+	l, err := NewLimiter(LimitOpts{PerIdentity: Limit{Quota: 1, QuotaPeriod: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc := NewAccounts()
+	srv := httptest.NewServer(NewAddHandler(testonly.NewMemStorage(), rfc6962.DefaultHasher, WithLimiter(l), WithAccounts(acc)))
+	defer srv.Close()
+	for _, test := range []struct {
+		desc           string
+		leaf           string
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{desc: "within quota", leaf: "one", wantStatus: http.StatusOK},
+		{desc: "over quota", leaf: "two", wantStatus: http.StatusTooManyRequests, wantRetryAfter: "3600"},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			resp, err := srv.Client().Post(srv.URL, "application/octet-stream", bytes.NewReader([]byte(test.leaf)))
+			if err != nil {
+				t.Fatalf("Post: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.wantStatus {
+				t.Errorf("Got status %d, want %d", resp.StatusCode, test.wantStatus)
+			}
+			if got := resp.Header.Get("Retry-After"); got != test.wantRetryAfter {
+				t.Errorf("Got Retry-After %q, want %q", got, test.wantRetryAfter)
+			}
+		})
+	}
+	if got, want := acc.Snapshot()[""].Throttled, uint64(1); got != want {
+		t.Errorf("Got %d throttled submissions, want %d", got, want)
+	}
+}
+
+func TestAddHandlerBackpressure(t *testing.T) {
+	var busy bool
+	var busyErr error
+	check := func(context.Context) (bool, error) { return busy, busyErr }
+	srv := httptest.NewServer(NewAddHandler(testonly.NewMemStorage(), rfc6962.DefaultHasher, WithBackpressure(check, 1500*time.Millisecond)))
+	defer srv.Close()
+	for _, test := range []struct {
+		desc           string
+		busy           bool
+		busyErr        error
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{desc: "keeping up", wantStatus: http.StatusOK},
+		{desc: "backlogged", busy: true, wantStatus: http.StatusServiceUnavailable, wantRetryAfter: "2"},
+		{desc: "check failed", busyErr: errors.New("boom"), wantStatus: http.StatusInternalServerError},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			busy, busyErr = test.busy, test.busyErr
+			resp, err := srv.Client().Post(srv.URL, "application/octet-stream", bytes.NewReader([]byte(test.desc)))
+			if err != nil {
+				t.Fatalf("Post: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.wantStatus {
+				t.Errorf("Got status %d, want %d", resp.StatusCode, test.wantStatus)
+			}
+			if got := resp.Header.Get("Retry-After"); got != test.wantRetryAfter {
+				t.Errorf("Got Retry-After %q, want %q", got, test.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestAddHandlerPolicy(t *testing.T) {
+	acc := NewAccounts()
+	p := admission.All(admission.MaxSize(10), admission.ContentTypes("text/plain"))
+	srv := httptest.NewServer(NewAddHandler(testonly.NewMemStorage(), rfc6962.DefaultHasher, WithPolicy(p), WithAccounts(acc)))
+	defer srv.Close()
+	for _, test := range []struct {
+		desc        string
+		contentType string
+		leaf        string
+		wantStatus  int
+	}{
+		{desc: "admitted", contentType: "text/plain", leaf: "one", wantStatus: http.StatusOK},
+		{desc: "wrong type", contentType: "application/json", leaf: "{}", wantStatus: http.StatusBadRequest},
+		{desc: "too large", contentType: "text/plain", leaf: "a rather large entry", wantStatus: http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			resp, err := srv.Client().Post(srv.URL, test.contentType, bytes.NewReader([]byte(test.leaf)))
+			if err != nil {
+				t.Fatalf("Post: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.wantStatus {
+				t.Errorf("Got status %d, want %d", resp.StatusCode, test.wantStatus)
+			}
+		})
+	}
+	if got, want := acc.Snapshot()[""], (Usage{Entries: 1, Bytes: 3, Rejected: 2}); got.Entries != want.Entries || got.Bytes != want.Bytes || got.Rejected != want.Rejected {
+		t.Errorf("Got usage %+v, want %+v", got, want)
+	}
+}
+
+func TestFileHandler(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"checkpoint":     "a checkpoint",
+		".sequence.lock": "",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(FileHandler(dir))
+	defer srv.Close()
+	for _, test := range []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{path: "/checkpoint", wantStatus: http.StatusOK, wantBody: "a checkpoint"},
+		{path: "/.sequence.lock", wantStatus: http.StatusNotFound},
+		{path: "/missing", wantStatus: http.StatusNotFound},
+	} {
+		resp, err := srv.Client().Get(srv.URL + test.path)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", test.path, err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Get(%q): failed to read body: %v", test.path, err)
+		}
+		if resp.StatusCode != test.wantStatus {
+			t.Errorf("Get(%q): got status %d, want %d", test.path, resp.StatusCode, test.wantStatus)
+		}
+		if test.wantBody != "" && string(b) != test.wantBody {
+			t.Errorf("Get(%q): got body %q, want %q", test.path, string(b), test.wantBody)
+		}
+	}
+}
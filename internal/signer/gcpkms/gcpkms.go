@@ -0,0 +1,272 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gcpkms provides a note signer whose private key is held in Google
+// Cloud KMS.
+//
+// The KMS REST API is used directly, authenticating with Application Default
+// Credentials, to avoid depending on the Cloud client libraries.
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/transparency-dev/serverless-log/internal/signer"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	// DefaultEndpoint is the Cloud KMS REST API endpoint.
+	DefaultEndpoint = "https://cloudkms.googleapis.com/v1/"
+
+	scope = "https://www.googleapis.com/auth/cloudkms"
+)
+
+// Option is used to configure optional behaviour of NewSigner.
+type Option func(*opts)
+
+type opts struct {
+	client   *http.Client
+	endpoint string
+}
+
+// WithHTTPClient causes requests to Cloud KMS to be made with c, which must
+// add any required credentials, rather than with Application Default
+// Credentials.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *opts) {
+		o.client = c
+	}
+}
+
+// WithEndpoint causes requests to be sent to the given Cloud KMS REST API
+// endpoint, rather than DefaultEndpoint.
+func WithEndpoint(e string) Option {
+	return func(o *opts) {
+		o.endpoint = e
+	}
+}
+
+// NewSigner returns a note signer with the given name, which signs using the
+// Cloud KMS key version keyVersion, e.g.
+// projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1.
+//
+// The key must be an Ed25519 (EC_SIGN_ED25519) or ECDSA P-256
+// (EC_SIGN_P256_SHA256) signing key. The note verifier key for the signer can
+// be found with the returned PublicKey's VerifierKey method.
+//
+// ctx is used for each request made by the signer.
+func NewSigner(ctx context.Context, keyVersion, name string, options ...Option) (*signer.Signer, signer.PublicKey, error) {
+	o, err := newOpts(ctx, options)
+	if err != nil {
+		return nil, signer.PublicKey{}, err
+	}
+	k := &kmsKey{
+		ctx:    ctx,
+		client: o.client,
+		url:    o.url(keyVersion),
+	}
+	pk, digest, err := publicKey(ctx, o, keyVersion)
+	if err != nil {
+		return nil, signer.PublicKey{}, err
+	}
+	k.digest = digest
+	s, err := signer.New(name, pk, k.sign)
+	if err != nil {
+		return nil, signer.PublicKey{}, err
+	}
+	return s, pk, nil
+}
+
+// CreateKey creates a new signing key in Cloud KMS, so that its private key
+// never leaves KMS, and returns the name of its first key version, for use
+// with NewSigner, along with its public key.
+//
+// cryptoKey is the name of the key to create, e.g.
+// projects/p/locations/l/keyRings/r/cryptoKeys/k, whose key ring must already
+// exist. algorithm is either EC_SIGN_ED25519 or EC_SIGN_P256_SHA256, and
+// protectionLevel is either SOFTWARE or HSM.
+//
+// Key versions are generated asynchronously, so CreateKey waits until the
+// first version is enabled, or ctx is done.
+func CreateKey(ctx context.Context, cryptoKey, algorithm, protectionLevel string, options ...Option) (string, signer.PublicKey, error) {
+	keyRing, id, ok := strings.Cut(cryptoKey, "/cryptoKeys/")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", signer.PublicKey{}, fmt.Errorf("invalid key name %q", cryptoKey)
+	}
+	o, err := newOpts(ctx, options)
+	if err != nil {
+		return "", signer.PublicKey{}, err
+	}
+	req := map[string]any{
+		"purpose": "ASYMMETRIC_SIGN",
+		"versionTemplate": map[string]string{
+			"algorithm":       algorithm,
+			"protectionLevel": protectionLevel,
+		},
+	}
+	var key struct {
+		Name string `json:"name"`
+	}
+	if err := call(ctx, o.client, http.MethodPost, o.url(keyRing)+"/cryptoKeys?cryptoKeyId="+url.QueryEscape(id), req, &key); err != nil {
+		return "", signer.PublicKey{}, fmt.Errorf("failed to create key: %v", err)
+	}
+	keyVersion := key.Name + "/cryptoKeyVersions/1"
+	for {
+		var v struct {
+			State string `json:"state"`
+		}
+		if err := call(ctx, o.client, http.MethodGet, o.url(keyVersion), nil, &v); err != nil {
+			return "", signer.PublicKey{}, fmt.Errorf("failed to get key version: %v", err)
+		}
+		if v.State == "ENABLED" {
+			break
+		}
+		if v.State != "PENDING_GENERATION" {
+			return "", signer.PublicKey{}, fmt.Errorf("key version %q is in state %s", keyVersion, v.State)
+		}
+		select {
+		case <-ctx.Done():
+			return "", signer.PublicKey{}, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+	pk, _, err := publicKey(ctx, o, keyVersion)
+	if err != nil {
+		return "", signer.PublicKey{}, err
+	}
+	return keyVersion, pk, nil
+}
+
+// pollInterval is how often CreateKey checks whether a new key version has
+// been generated.
+var pollInterval = time.Second
+
+// newOpts returns the options set by options, with an HTTP client using
+// Application Default Credentials unless one was given.
+func newOpts(ctx context.Context, options []Option) (*opts, error) {
+	o := &opts{endpoint: DefaultEndpoint}
+	for _, opt := range options {
+		opt(o)
+	}
+	if o.client == nil {
+		c, err := google.DefaultClient(ctx, scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create authenticated HTTP client: %v", err)
+		}
+		o.client = c
+	}
+	return o, nil
+}
+
+// url returns the URL of the named resource.
+func (o *opts) url(name string) string {
+	return strings.TrimSuffix(o.endpoint, "/") + "/" + name
+}
+
+// publicKey returns the public key of keyVersion, and whether KMS must be
+// given the SHA-256 digest of messages to be signed, rather than the messages
+// themselves.
+func publicKey(ctx context.Context, o *opts, keyVersion string) (signer.PublicKey, bool, error) {
+	var pub struct {
+		PEM       string `json:"pem"`
+		Algorithm string `json:"algorithm"`
+	}
+	if err := call(ctx, o.client, http.MethodGet, o.url(keyVersion)+"/publicKey", nil, &pub); err != nil {
+		return signer.PublicKey{}, false, fmt.Errorf("failed to get public key: %v", err)
+	}
+	pk, err := signer.ParsePublicKeyPEM([]byte(pub.PEM))
+	if err != nil {
+		return signer.PublicKey{}, false, err
+	}
+	switch {
+	case pk.Alg == signer.AlgEd25519 && pub.Algorithm == "EC_SIGN_ED25519":
+		return pk, false, nil
+	case pk.Alg == signer.AlgECDSA && pub.Algorithm == "EC_SIGN_P256_SHA256":
+		return pk, true, nil
+	default:
+		return signer.PublicKey{}, false, fmt.Errorf("unsupported key algorithm %q", pub.Algorithm)
+	}
+}
+
+// kmsKey signs with a single Cloud KMS key version.
+type kmsKey struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	// digest is true if KMS must be given the SHA-256 digest of the message,
+	// rather than the message itself.
+	digest bool
+}
+
+func (k *kmsKey) sign(msg []byte) ([]byte, error) {
+	req := map[string]any{"data": msg}
+	if k.digest {
+		d := sha256.Sum256(msg)
+		req = map[string]any{"digest": map[string]any{"sha256": d[:]}}
+	}
+	var resp struct {
+		Signature []byte `json:"signature"`
+	}
+	if err := k.call(http.MethodPost, ":asymmetricSign", req, &resp); err != nil {
+		return nil, fmt.Errorf("failed to sign: %v", err)
+	}
+	return resp.Signature, nil
+}
+
+// call makes a request to the key's URL with the given suffix, see call.
+func (k *kmsKey) call(method, suffix string, req, resp any) error {
+	return call(k.ctx, k.client, method, k.url+suffix, req, resp)
+}
+
+// call makes a request to url, sending req and decoding the response into
+// resp. []byte fields are base64 encoded by encoding/json, as required by the
+// API.
+func call(ctx context.Context, client *http.Client, method, url string, req, resp any) error {
+	var body io.Reader
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	r, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	rsp, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s: %s", method, url, rsp.Status, bytes.TrimSpace(b))
+	}
+	return json.Unmarshal(b, resp)
+}
@@ -0,0 +1,235 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpkms
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/serverless-log/client"
+	"golang.org/x/mod/sumdb/note"
+)
+
+const keyVersion = "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+
+// fakeKMS returns a server implementing the Cloud KMS publicKey and
+// asymmetricSign methods for a single key version.
+func fakeKMS(t *testing.T, alg string, pub any, sign func(data, digest []byte) ([]byte, error)) *httptest.Server {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+keyVersion+"/publicKey", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"pem":       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+			"algorithm": alg,
+		})
+	})
+	mux.HandleFunc("/"+keyVersion+":asymmetricSign", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Data   []byte `json:"data"`
+			Digest struct {
+				SHA256 []byte `json:"sha256"`
+			} `json:"digest"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sig, err := sign(req.Data, req.Digest.SHA256)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]byte{"signature": sig})
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestNewSigner(t *testing.T) {
+	ctx := context.Background()
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc    string
+		alg     string
+		pub     any
+		sign    func(data, digest []byte) ([]byte, error)
+		wantErr bool
+	}{
+		{
+			desc: "ed25519",
+			alg:  "EC_SIGN_ED25519",
+			pub:  edPub,
+			sign: func(data, _ []byte) ([]byte, error) {
+				return ed25519.Sign(edPriv, data), nil
+			},
+		}, {
+			desc: "ecdsa",
+			alg:  "EC_SIGN_P256_SHA256",
+			pub:  &ecPriv.PublicKey,
+			sign: func(_, digest []byte) ([]byte, error) {
+				return ecdsa.SignASN1(rand.Reader, ecPriv, digest)
+			},
+		}, {
+			desc:    "mismatched algorithm",
+			alg:     "EC_SIGN_P256_SHA256",
+			pub:     edPub,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			srv := fakeKMS(t, test.alg, test.pub, test.sign)
+			s, pk, err := NewSigner(ctx, keyVersion, "log", WithHTTPClient(srv.Client()), WithEndpoint(srv.URL))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("NewSigner: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			v, err := client.NewLogVerifier(pk.VerifierKey("log"))
+			if err != nil {
+				t.Fatalf("NewLogVerifier: %v", err)
+			}
+			n, err := note.Sign(&note.Note{Text: "hello\n"}, s)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if _, err := note.Open(n, note.VerifierList(v)); err != nil {
+				t.Errorf("Open: %v", err)
+			}
+		})
+	}
+}
+
+func TestSignError(t *testing.T) {
+	ctx := context.Background()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	srv := fakeKMS(t, "EC_SIGN_ED25519", pub, func(_, _ []byte) ([]byte, error) {
+		return nil, errors.New("permission denied")
+	})
+	s, _, err := NewSigner(ctx, keyVersion, "log", WithHTTPClient(srv.Client()), WithEndpoint(srv.URL))
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	if _, err := note.Sign(&note.Note{Text: "hello\n"}, s); err == nil {
+		t.Error("Sign: got no error")
+	}
+}
+
+func TestCreateKey(t *testing.T) {
+	ctx := context.Background()
+	pollInterval = time.Millisecond
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	const (
+		keyRing   = "projects/p/locations/l/keyRings/r"
+		cryptoKey = keyRing + "/cryptoKeys/k"
+	)
+	for _, test := range []struct {
+		desc        string
+		cryptoKey   string
+		finalState  string
+		wantVersion string
+		wantErr     bool
+	}{
+		{desc: "created", cryptoKey: cryptoKey, finalState: "ENABLED", wantVersion: keyVersion},
+		{desc: "generation failed", cryptoKey: cryptoKey, finalState: "GENERATION_FAILED", wantErr: true},
+		{desc: "invalid name", cryptoKey: keyRing, wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var polls int
+			mux := http.NewServeMux()
+			mux.HandleFunc("/"+keyRing+"/cryptoKeys", func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					Purpose         string `json:"purpose"`
+					VersionTemplate struct {
+						Algorithm       string `json:"algorithm"`
+						ProtectionLevel string `json:"protectionLevel"`
+					} `json:"versionTemplate"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if req.Purpose != "ASYMMETRIC_SIGN" || req.VersionTemplate.Algorithm != "EC_SIGN_ED25519" || req.VersionTemplate.ProtectionLevel != "HSM" {
+					http.Error(w, "unexpected request", http.StatusBadRequest)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]string{"name": keyRing + "/cryptoKeys/" + r.URL.Query().Get("cryptoKeyId")})
+			})
+			mux.HandleFunc("/"+keyVersion, func(w http.ResponseWriter, _ *http.Request) {
+				state := "PENDING_GENERATION"
+				if polls++; polls > 2 {
+					state = test.finalState
+				}
+				_ = json.NewEncoder(w).Encode(map[string]string{"state": state})
+			})
+			mux.HandleFunc("/"+keyVersion+"/publicKey", func(w http.ResponseWriter, _ *http.Request) {
+				_ = json.NewEncoder(w).Encode(map[string]string{
+					"pem":       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+					"algorithm": "EC_SIGN_ED25519",
+				})
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			v, pk, err := CreateKey(ctx, test.cryptoKey, "EC_SIGN_ED25519", "HSM", WithHTTPClient(srv.Client()), WithEndpoint(srv.URL))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("CreateKey: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if v != test.wantVersion {
+				t.Errorf("CreateKey: got key version %q, want %q", v, test.wantVersion)
+			}
+			if _, err := client.NewLogVerifier(pk.VerifierKey("log")); err != nil {
+				t.Errorf("NewLogVerifier: %v", err)
+			}
+		})
+	}
+}
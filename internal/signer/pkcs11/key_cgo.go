@@ -0,0 +1,190 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+
+package pkcs11
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	p11 "github.com/miekg/pkcs11"
+	"github.com/transparency-dev/serverless-log/internal/signer"
+)
+
+// Key is a key pair held in a PKCS#11 token.
+type Key struct {
+	ctx  *p11.Ctx
+	priv p11.ObjectHandle
+	pub  signer.PublicKey
+
+	// mu guards session, which must not be used concurrently.
+	mu      sync.Mutex
+	session p11.SessionHandle
+}
+
+// Open loads the PKCS#11 module given in c, logs in to the token, and finds
+// the key pair with the configured label. The key pair must be either an
+// Ed25519 (CKK_EC_EDWARDS) or an ECDSA P-256 (CKK_EC) key.
+//
+// Close must be called when the key is no longer needed.
+func Open(c Config) (*Key, error) {
+	ctx := p11.New(c.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %q", c.Module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("failed to initialise PKCS#11 module: %v", err)
+	}
+	k := &Key{ctx: ctx}
+	session, err := ctx.OpenSession(c.Slot, p11.CKF_SERIAL_SESSION)
+	if err != nil {
+		k.finalize()
+		return nil, fmt.Errorf("failed to open session on slot %d: %v", c.Slot, err)
+	}
+	k.session = session
+	if err := ctx.Login(session, p11.CKU_USER, c.PIN); err != nil && err != p11.Error(p11.CKR_USER_ALREADY_LOGGED_IN) {
+		_ = k.Close()
+		return nil, fmt.Errorf("failed to log in to token: %v", err)
+	}
+	if err := k.load(c.KeyLabel); err != nil {
+		_ = k.Close()
+		return nil, err
+	}
+	return k, nil
+}
+
+// load finds the key pair with the given label.
+func (k *Key) load(label string) error {
+	priv, err := k.find(p11.CKO_PRIVATE_KEY, label)
+	if err != nil {
+		return err
+	}
+	pub, err := k.find(p11.CKO_PUBLIC_KEY, label)
+	if err != nil {
+		return err
+	}
+	attrs, err := k.ctx.GetAttributeValue(k.session, pub, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_KEY_TYPE, nil),
+		p11.NewAttribute(p11.CKA_EC_PARAMS, nil),
+		p11.NewAttribute(p11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read public key %q: %v", label, err)
+	}
+	keyType, err := bytesToUint(attrs[0].Value)
+	if err != nil {
+		return fmt.Errorf("invalid key type: %v", err)
+	}
+	pk, err := publicKey(keyType, attrs[1].Value, attrs[2].Value)
+	if err != nil {
+		return fmt.Errorf("public key %q: %v", label, err)
+	}
+	k.priv, k.pub = priv, pk
+	return nil
+}
+
+// find returns the single object of the given class with the given label.
+func (k *Key) find(class uint, label string) (p11.ObjectHandle, error) {
+	if err := k.ctx.FindObjectsInit(k.session, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_CLASS, class),
+		p11.NewAttribute(p11.CKA_LABEL, label),
+	}); err != nil {
+		return 0, fmt.Errorf("failed to search for key %q: %v", label, err)
+	}
+	objs, _, err := k.ctx.FindObjects(k.session, 2)
+	if fErr := k.ctx.FindObjectsFinal(k.session); err == nil {
+		err = fErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to search for key %q: %v", label, err)
+	}
+	switch len(objs) {
+	case 0:
+		return 0, fmt.Errorf("no key %q found", label)
+	case 1:
+		return objs[0], nil
+	default:
+		return 0, fmt.Errorf("more than one key %q found", label)
+	}
+}
+
+// PublicKey returns the public half of the key pair.
+func (k *Key) PublicKey() signer.PublicKey {
+	return k.pub
+}
+
+// Signer returns a note signer with the given name, which signs using the key.
+// The note verifier key for the signer can be found with the VerifierKey
+// method of the key's PublicKey.
+func (k *Key) Signer(name string) (*signer.Signer, error) {
+	return signer.New(name, k.pub, k.sign)
+}
+
+func (k *Key) sign(msg []byte) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	mech, data := uint(ckmEdDSA), msg
+	if k.pub.Alg == signer.AlgECDSA {
+		d := sha256.Sum256(msg)
+		mech, data = ckmECDSA, d[:]
+	}
+	if err := k.ctx.SignInit(k.session, []*p11.Mechanism{p11.NewMechanism(mech, nil)}, k.priv); err != nil {
+		return nil, fmt.Errorf("failed to sign: %v", err)
+	}
+	sig, err := k.ctx.Sign(k.session, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %v", err)
+	}
+	if k.pub.Alg == signer.AlgECDSA {
+		return ecdsaSignature(sig)
+	}
+	return sig, nil
+}
+
+// Close logs out of the token and unloads the PKCS#11 module.
+func (k *Key) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// Logging out fails if the token was already logged in when we opened it,
+	// which is fine.
+	_ = k.ctx.Logout(k.session)
+	err := k.ctx.CloseSession(k.session)
+	k.finalize()
+	return err
+}
+
+func (k *Key) finalize() {
+	_ = k.ctx.Finalize()
+	k.ctx.Destroy()
+}
+
+// bytesToUint decodes a CK_ULONG attribute value, which is in native byte
+// order and of native size.
+func bytesToUint(b []byte) (uint, error) {
+	switch len(b) {
+	case 4:
+		return uint(binary.NativeEndian.Uint32(b)), nil
+	case 8:
+		return uint(binary.NativeEndian.Uint64(b)), nil
+	default:
+		return 0, fmt.Errorf("invalid CK_ULONG length %d", len(b))
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !cgo
+
+package pkcs11
+
+import (
+	"errors"
+
+	"github.com/transparency-dev/serverless-log/internal/signer"
+)
+
+// Key is a key pair held in a PKCS#11 token.
+type Key struct{}
+
+// Open always fails, as PKCS#11 modules can't be loaded without cgo.
+func Open(c Config) (*Key, error) {
+	return nil, errors.New("PKCS#11 support requires a binary built with cgo")
+}
+
+// PublicKey returns the public half of the key pair.
+func (k *Key) PublicKey() signer.PublicKey {
+	return signer.PublicKey{}
+}
+
+// Signer returns a note signer with the given name, which signs using the key.
+func (k *Key) Signer(name string) (*signer.Signer, error) {
+	return nil, errors.New("PKCS#11 support requires a binary built with cgo")
+}
+
+// Close does nothing.
+func (k *Key) Close() error {
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pkcs11 provides a note signer whose private key is held in a
+// hardware security module, or other token, accessed through a PKCS#11 module.
+//
+// Loading PKCS#11 modules requires cgo, Open always fails in binaries built
+// without it.
+package pkcs11
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/transparency-dev/serverless-log/internal/signer"
+)
+
+// PINEnv is the environment variable conventionally used to pass the token's
+// user PIN to tools, so that it doesn't appear in command lines.
+const PINEnv = "SERVERLESS_LOG_PKCS11_PIN"
+
+// Config identifies a key pair held in a PKCS#11 token.
+type Config struct {
+	// Module is the path of the PKCS#11 module (shared library) for the token.
+	Module string
+	// Slot is the ID of the slot holding the token.
+	Slot uint
+	// PIN is the token's user PIN.
+	PIN string
+	// KeyLabel is the CKA_LABEL shared by the private and public key objects.
+	KeyLabel string
+}
+
+// Key types and mechanisms from PKCS#11 v3.0, which aren't defined by the
+// PKCS#11 package.
+const (
+	ckkEC        = 0x00000003
+	ckkECEdwards = 0x00000040
+	ckmECDSA     = 0x00001041
+	ckmEdDSA     = 0x00001057
+)
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+)
+
+// publicKey returns the public key with the given CKA_KEY_TYPE, CKA_EC_PARAMS
+// and CKA_EC_POINT attributes, which must be an Ed25519 or ECDSA P-256 key.
+func publicKey(keyType uint, params, point []byte) (signer.PublicKey, error) {
+	// CKA_EC_POINT should be a DER encoded OCTET STRING, but some modules
+	// return the bare point.
+	var p []byte
+	if rest, err := asn1.Unmarshal(point, &p); err != nil || len(rest) > 0 {
+		p = point
+	}
+	switch keyType {
+	case ckkECEdwards:
+		if len(p) != 32 {
+			return signer.PublicKey{}, fmt.Errorf("invalid Ed25519 public key length %d", len(p))
+		}
+		return signer.PublicKey{Alg: signer.AlgEd25519, Key: p}, nil
+	case ckkEC:
+		var curve asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(params, &curve); err != nil || !curve.Equal(oidNamedCurveP256) {
+			return signer.PublicKey{}, errors.New("unsupported EC key, only P-256 keys are supported")
+		}
+		curveDER, err := asn1.Marshal(curve)
+		if err != nil {
+			return signer.PublicKey{}, err
+		}
+		der, err := asn1.Marshal(struct {
+			Algorithm pkix.AlgorithmIdentifier
+			PublicKey asn1.BitString
+		}{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: curveDER}},
+			PublicKey: asn1.BitString{Bytes: p, BitLength: 8 * len(p)},
+		})
+		if err != nil {
+			return signer.PublicKey{}, err
+		}
+		return signer.ParsePublicKeyDER(der)
+	default:
+		return signer.PublicKey{}, fmt.Errorf("unsupported key type 0x%x", keyType)
+	}
+}
+
+// ecdsaSignature converts the r||s signature produced by CKM_ECDSA into the
+// ASN.1 form used by note signatures.
+func ecdsaSignature(raw []byte) ([]byte, error) {
+	if len(raw) != 64 {
+		return nil, fmt.Errorf("invalid ECDSA P-256 signature length %d", len(raw))
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(raw[:32]),
+		S: new(big.Int).SetBytes(raw[32:]),
+	})
+}
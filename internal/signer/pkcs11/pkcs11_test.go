@@ -0,0 +1,161 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkcs11
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/internal/signer"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatalf("asn1.Marshal: %v", err)
+	}
+	return b
+}
+
+func TestPublicKey(t *testing.T) {
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	ecPriv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	ecPoint := ecPriv.PublicKey().Bytes()
+	p256 := mustMarshal(t, oidNamedCurveP256)
+
+	for _, test := range []struct {
+		desc    string
+		keyType uint
+		params  []byte
+		point   []byte
+		wantAlg byte
+		wantErr bool
+	}{
+		{
+			desc:    "ed25519",
+			keyType: ckkECEdwards,
+			params:  mustMarshal(t, "edwards25519"),
+			point:   mustMarshal(t, []byte(edPub)),
+			wantAlg: signer.AlgEd25519,
+		}, {
+			desc:    "ed25519 bare point",
+			keyType: ckkECEdwards,
+			point:   edPub,
+			wantAlg: signer.AlgEd25519,
+		}, {
+			desc:    "ecdsa",
+			keyType: ckkEC,
+			params:  p256,
+			point:   mustMarshal(t, ecPoint),
+			wantAlg: signer.AlgECDSA,
+		}, {
+			desc:    "ecdsa bare point",
+			keyType: ckkEC,
+			params:  p256,
+			point:   ecPoint,
+			wantAlg: signer.AlgECDSA,
+		}, {
+			desc:    "ecdsa P-384",
+			keyType: ckkEC,
+			params:  mustMarshal(t, asn1.ObjectIdentifier{1, 3, 132, 0, 34}),
+			point:   mustMarshal(t, ecPoint),
+			wantErr: true,
+		}, {
+			desc:    "ecdsa invalid point",
+			keyType: ckkEC,
+			params:  p256,
+			point:   mustMarshal(t, ecPoint[:40]),
+			wantErr: true,
+		}, {
+			desc:    "rsa",
+			keyType: 0,
+			point:   mustMarshal(t, ecPoint),
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			pk, err := publicKey(test.keyType, test.params, test.point)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("publicKey: got err %v, wantErr %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if pk.Alg != test.wantAlg {
+				t.Errorf("got alg %d, want %d", pk.Alg, test.wantAlg)
+			}
+		})
+	}
+}
+
+func TestECDSASignature(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	pub, err := priv.PublicKey.ECDH()
+	if err != nil {
+		t.Fatalf("ECDH: %v", err)
+	}
+	pk, err := publicKey(ckkEC, mustMarshal(t, oidNamedCurveP256), pub.Bytes())
+	if err != nil {
+		t.Fatalf("publicKey: %v", err)
+	}
+	s, err := signer.New("log", pk, func(msg []byte) ([]byte, error) {
+		// Produce the r||s form returned by CKM_ECDSA.
+		d := sha256.Sum256(msg)
+		r, s, err := ecdsa.Sign(rand.Reader, priv, d[:])
+		if err != nil {
+			return nil, err
+		}
+		raw := make([]byte, 64)
+		r.FillBytes(raw[:32])
+		s.FillBytes(raw[32:])
+		return ecdsaSignature(raw)
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	v, err := client.NewLogVerifier(pk.VerifierKey("log"))
+	if err != nil {
+		t.Fatalf("NewLogVerifier: %v", err)
+	}
+	n, err := note.Sign(&note.Note{Text: "hello\n"}, s)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if _, err := note.Open(n, note.VerifierList(v)); err != nil {
+		t.Errorf("Open: %v", err)
+	}
+
+	if _, err := ecdsaSignature(make([]byte, 63)); err == nil {
+		t.Error("ecdsaSignature(63 bytes): got no error")
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package signer provides support for note signers whose private keys are
+// held elsewhere, e.g. in a cloud KMS or a hardware security module.
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+const (
+	// AlgEd25519 is the note key algorithm identifier for Ed25519 keys.
+	AlgEd25519 = 0x01
+	// AlgECDSA is the note key algorithm identifier for ECDSA P-256 keys, whose
+	// signatures are ASN.1 encoded and made over the SHA-256 digest of the note.
+	AlgECDSA = 0x02
+	// AlgCosignatureV1 is the note key algorithm identifier for Ed25519 keys
+	// used by witnesses to make cosignature/v1 signatures, see
+	// client.NewCosignatureV1Verifier.
+	AlgCosignatureV1 = 0x04
+)
+
+// PublicKey is a public key in the form used to identify note signers.
+type PublicKey struct {
+	// Alg is the note key algorithm identifier, one of AlgEd25519, AlgECDSA,
+	// or AlgCosignatureV1.
+	Alg byte
+	// Key is the raw Ed25519 public key, or the PKIX, ASN.1 DER encoded ECDSA
+	// public key.
+	Key []byte
+}
+
+// ParsePublicKeyPEM parses a PEM encoded PKIX public key, as returned by cloud
+// KMS services, which must be either an Ed25519 or an ECDSA P-256 key.
+func ParsePublicKeyPEM(p []byte) (PublicKey, error) {
+	b, _ := pem.Decode(p)
+	if b == nil {
+		return PublicKey{}, errors.New("failed to decode PEM public key")
+	}
+	return ParsePublicKeyDER(b.Bytes)
+}
+
+// ParsePublicKeyDER parses a PKIX, ASN.1 DER encoded public key, which must be
+// either an Ed25519 or an ECDSA P-256 key.
+func ParsePublicKeyDER(der []byte) (PublicKey, error) {
+	k, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return PublicKey{}, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	switch k := k.(type) {
+	case ed25519.PublicKey:
+		return PublicKey{Alg: AlgEd25519, Key: k}, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return PublicKey{}, fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+		}
+		return PublicKey{Alg: AlgECDSA, Key: der}, nil
+	default:
+		return PublicKey{}, fmt.Errorf("unsupported public key type %T", k)
+	}
+}
+
+// KeyHash returns the note key hash of the key with the given name.
+func (k PublicKey) KeyHash(name string) uint32 {
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte{'\n', k.Alg})
+	h.Write(k.Key)
+	return binary.BigEndian.Uint32(h.Sum(nil))
+}
+
+// VerifierKey returns the note verifier key for the key with the given name,
+// which can be used in the log's public key files.
+func (k PublicKey) VerifierKey(name string) string {
+	return fmt.Sprintf("%s+%08x+%s", name, k.KeyHash(name), base64.StdEncoding.EncodeToString(append([]byte{k.Alg}, k.Key...)))
+}
+
+// SignFunc signs msg, returning the signature in the format required by the
+// key's algorithm, see AlgEd25519 and AlgECDSA.
+type SignFunc func(msg []byte) ([]byte, error)
+
+// Signer is a note.Signer which delegates signing to a SignFunc.
+type Signer struct {
+	name string
+	hash uint32
+	sign SignFunc
+}
+
+var _ note.Signer = &Signer{}
+
+// New returns a note.Signer with the given name, which signs with the private
+// key corresponding to k using sign.
+func New(name string, k PublicKey, sign SignFunc) (*Signer, error) {
+	if name == "" || strings.ContainsAny(name, "+ \t\n") {
+		return nil, fmt.Errorf("invalid key name %q", name)
+	}
+	return &Signer{
+		name: name,
+		hash: k.KeyHash(name),
+		sign: sign,
+	}, nil
+}
+
+// Name returns the name of the signer.
+func (s *Signer) Name() string {
+	return s.name
+}
+
+// KeyHash returns the key hash of the signer.
+func (s *Signer) KeyHash() uint32 {
+	return s.hash
+}
+
+// Sign returns a signature for the given message.
+func (s *Signer) Sign(msg []byte) ([]byte, error) {
+	return s.sign(msg)
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/transparency-dev/serverless-log/client"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestSignerVerifies(t *testing.T) {
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc    string
+		pub     any
+		sign    SignFunc
+		wantAlg byte
+	}{
+		{
+			desc: "ed25519",
+			pub:  edPub,
+			sign: func(msg []byte) ([]byte, error) {
+				return ed25519.Sign(edPriv, msg), nil
+			},
+			wantAlg: AlgEd25519,
+		}, {
+			desc: "ecdsa",
+			pub:  &ecPriv.PublicKey,
+			sign: func(msg []byte) ([]byte, error) {
+				d := sha256.Sum256(msg)
+				return ecdsa.SignASN1(rand.Reader, ecPriv, d[:])
+			},
+			wantAlg: AlgECDSA,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			der, err := x509.MarshalPKIXPublicKey(test.pub)
+			if err != nil {
+				t.Fatalf("MarshalPKIXPublicKey: %v", err)
+			}
+			pk, err := ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+			if err != nil {
+				t.Fatalf("ParsePublicKeyPEM: %v", err)
+			}
+			if pk.Alg != test.wantAlg {
+				t.Errorf("got alg %d, want %d", pk.Alg, test.wantAlg)
+			}
+			s, err := New("log", pk, test.sign)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			v, err := client.NewLogVerifier(pk.VerifierKey("log"))
+			if err != nil {
+				t.Fatalf("NewLogVerifier(%q): %v", pk.VerifierKey("log"), err)
+			}
+			if v.KeyHash() != s.KeyHash() {
+				t.Errorf("verifier key hash %08x, signer key hash %08x", v.KeyHash(), s.KeyHash())
+			}
+			n, err := note.Sign(&note.Note{Text: "hello\n"}, s)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if _, err := note.Open(n, note.VerifierList(v)); err != nil {
+				t.Errorf("Open: %v", err)
+			}
+		})
+	}
+}
+
+func TestParsePublicKeyUnsupported(t *testing.T) {
+	k, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&k.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	if _, err := ParsePublicKeyDER(der); err == nil {
+		t.Error("ParsePublicKeyDER(P-384 key): got no error")
+	}
+}
+
+func TestCosignatureV1VerifierKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	pk := PublicKey{Alg: AlgCosignatureV1, Key: pub}
+	v, err := client.NewCosignatureV1Verifier(pk.VerifierKey("witness"))
+	if err != nil {
+		t.Fatalf("NewCosignatureV1Verifier(%q): %v", pk.VerifierKey("witness"), err)
+	}
+	if v.Name() != "witness" || v.KeyHash() != pk.KeyHash("witness") {
+		t.Errorf("got verifier %q %08x, want %q %08x", v.Name(), v.KeyHash(), "witness", pk.KeyHash("witness"))
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// Export writes a snapshot of the log stored at rootDir to w, and returns its
+// manifest.
+//
+// The log is first checked with fs.Verify, using open to verify its
+// checkpoints, and no snapshot is written if any of its resources are missing
+// or corrupt. comp must be the compression used to write the log.
+//
+// Only the resources committed to by the log's checkpoint are exported, so
+// entries which have been sequenced but not integrated, and any orphaned
+// files, are left out. The log should not be modified while it's exported,
+// see fs.AcquireLock.
+func Export(ctx context.Context, rootDir string, w io.Writer, open func(cpRaw []byte) (*fmtlog.Checkpoint, error), h merkle.LogHasher, comp compress.Algorithm) (*Manifest, error) {
+	r, err := fs.Verify(ctx, rootDir, open, h, fs.WithCompression(comp))
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify log: %w", err)
+	}
+	orphaned := make(map[string]bool)
+	for _, p := range r.Problems {
+		if p.Kind != fs.Orphaned {
+			return nil, fmt.Errorf("log failed verification: %v", p)
+		}
+		orphaned[filepath.ToSlash(p.Path)] = true
+	}
+	cpRaw, err := fs.ReadCheckpoint(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	cp, err := open(cpRaw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	bundleSize, err := fs.ReadBundleSize(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{
+		Version:     manifestVersion,
+		Created:     time.Now().UTC(),
+		Origin:      cp.Origin,
+		Size:        cp.Size,
+		RootHash:    cp.Hash,
+		BundleSize:  bundleSize,
+		Pruned:      r.Pruned,
+		Compression: string(comp),
+	}
+	e := exporter{rootDir: rootDir, size: cp.Size, bundleSize: bundleSize, orphaned: orphaned}
+	if m.Files, err = e.files(); err != nil {
+		return nil, err
+	}
+
+	tw := tar.NewWriter(w)
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := writeEntry(tw, ManifestPath, raw, m.Created); err != nil {
+		return nil, err
+	}
+	for _, f := range m.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		p := filepath.Join(rootDir, filepath.FromSlash(f.Path))
+		d, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q: %w", f.Path, err)
+		}
+		if h := sha256.Sum256(d); !bytes.Equal(h[:], f.SHA256) {
+			return nil, fmt.Errorf("%q was modified during export", f.Path)
+		}
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeEntry(tw, f.Path, d, fi.ModTime()); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return m, nil
+}
+
+// writeEntry writes a file with the given name, contents and modification
+// time to the archive.
+func writeEntry(tw *tar.Writer, name string, d []byte, mtime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(d)),
+		Mode:     0o644,
+		ModTime:  mtime,
+	}); err != nil {
+		return fmt.Errorf("failed to write header for %q: %w", name, err)
+	}
+	if _, err := tw.Write(d); err != nil {
+		return fmt.Errorf("failed to write %q: %w", name, err)
+	}
+	return nil
+}
+
+// exporter selects the resources of a log which are exported.
+type exporter struct {
+	rootDir    string
+	size       uint64
+	bundleSize uint64
+	// orphaned holds the paths of the files which fs.Verify found not to be
+	// part of the log.
+	orphaned map[string]bool
+}
+
+// files returns the resources to be exported, in the order in which they're
+// written to the archive.
+func (e exporter) files() ([]File, error) {
+	var ret []File
+	add := func(rel string) error {
+		d, err := os.ReadFile(filepath.Join(e.rootDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+		h := sha256.Sum256(d)
+		ret = append(ret, File{Path: rel, Size: int64(len(d)), SHA256: h[:]})
+		return nil
+	}
+	for _, p := range []string{layout.CheckpointPath, layout.BundleSizePath, layout.PrunedPath} {
+		if err := add(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read %q: %w", p, err)
+		}
+	}
+	for _, dir := range []string{"checkpoints", "tile", "seq", "leaves", "blobs"} {
+		err := filepath.WalkDir(filepath.Join(e.rootDir, dir), func(p string, d iofs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(e.rootDir, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if d.IsDir() {
+				if rel == "leaves/pending" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if ok, err := e.include(rel); err != nil || !ok {
+				return err
+			}
+			return add(rel)
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+		}
+	}
+	return ret, nil
+}
+
+// include returns true if the file at rel, relative to the log's root
+// directory, is part of the log committed to by its checkpoint.
+func (e exporter) include(rel string) (bool, error) {
+	if e.orphaned[rel] || strings.HasSuffix(rel, ".tmp") {
+		return false, nil
+	}
+	switch {
+	case strings.HasPrefix(rel, "seq/"):
+		// Strip the suffix of partial bundles.
+		p, _, _ := strings.Cut(rel, ".")
+		index, err := layout.SeqFromPath("", filepath.FromSlash(p))
+		if err != nil {
+			return false, fmt.Errorf("unexpected file %q: %v", rel, err)
+		}
+		return index*e.bundleSize < e.size, nil
+	case strings.HasPrefix(rel, "leaves/"):
+		// Leafhash files are written when entries are sequenced.
+		d, err := os.ReadFile(filepath.Join(e.rootDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return false, err
+		}
+		seq, err := strconv.ParseUint(string(d), 16, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid leafhash file %q: %v", rel, err)
+		}
+		return seq < e.size, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+func openCheckpoint(raw []byte) (*fmtlog.Checkpoint, error) {
+	cp := &fmtlog.Checkpoint{}
+	_, err := cp.Unmarshal(raw)
+	return cp, err
+}
+
+// newTestLog creates a log at dir with the given sizes of integrated leaves,
+// archiving a checkpoint for each, and then sequences a further unintegrated
+// leaves.
+func newTestLog(t *testing.T, dir string, comp compress.Algorithm, sizes []uint64, unintegrated uint64) {
+	t.Helper()
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	s, err := fs.Create(dir, fs.WithCompression(comp))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	sequence := func(from, to uint64) {
+		for i := from; i < to; i++ {
+			leaf := []byte(fmt.Sprintf("leaf %d", i))
+			if _, err := s.Sequence(ctx, h.HashLeaf(leaf), leaf); err != nil {
+				t.Fatalf("Sequence = %v", err)
+			}
+		}
+	}
+	size := uint64(0)
+	for _, next := range sizes {
+		sequence(size, next)
+		cp, err := log.Integrate(ctx, size, s, h)
+		if err != nil {
+			t.Fatalf("Integrate = %v", err)
+		}
+		cp.Origin = "test"
+		if err := s.ArchiveCheckpoint(ctx, cp.Size, cp.Marshal()); err != nil {
+			t.Fatalf("ArchiveCheckpoint = %v", err)
+		}
+		if err := s.WriteCheckpoint(ctx, cp.Marshal()); err != nil {
+			t.Fatalf("WriteCheckpoint = %v", err)
+		}
+		size = next
+	}
+	sequence(size, size+unintegrated)
+}
+
+// readArchive returns the names and contents of the entries in a snapshot.
+func readArchive(t *testing.T, r io.Reader) ([]string, map[string][]byte) {
+	t.Helper()
+	var names []string
+	contents := make(map[string][]byte)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names, contents
+		} else if err != nil {
+			t.Fatalf("Next = %v", err)
+		}
+		d, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("ReadAll = %v", err)
+		}
+		names = append(names, hdr.Name)
+		contents[hdr.Name] = d
+	}
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	for _, comp := range []compress.Algorithm{compress.None, compress.Zstd} {
+		t.Run(string(comp), func(t *testing.T) {
+			d := filepath.Join(t.TempDir(), "log")
+			newTestLog(t, d, comp, []uint64{10, 300}, 5)
+			// Orphaned files aren't exported.
+			if err := os.WriteFile(filepath.Join(d, "tile", "temp.tmp"), []byte("temp"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			m, err := Export(ctx, d, &buf, openCheckpoint, rfc6962.DefaultHasher, comp)
+			if err != nil {
+				t.Fatalf("Export = %v", err)
+			}
+			if m.Size != 300 || m.Origin != "test" || m.BundleSize != 1 || m.Compression != string(comp) {
+				t.Errorf("Export returned manifest %+v", m)
+			}
+			names, contents := readArchive(t, &buf)
+			if len(names) == 0 || names[0] != ManifestPath {
+				t.Fatalf("first entry is not the manifest: %q", names)
+			}
+			am, err := ParseManifest(contents[ManifestPath])
+			if err != nil {
+				t.Fatalf("ParseManifest = %v", err)
+			}
+			if len(am.Files) != len(names)-1 {
+				t.Fatalf("manifest lists %d files, archive holds %d", len(am.Files), len(names)-1)
+			}
+			for i, f := range am.Files {
+				if names[i+1] != f.Path || int64(len(contents[f.Path])) != f.Size {
+					t.Errorf("entry %d is %q with size %d, manifest has %q with size %d", i+1, names[i+1], len(contents[f.Path]), f.Path, f.Size)
+				}
+			}
+
+			for _, p := range []string{"seq/00/00/00/01/2b", "checkpoints/10", "checkpoints/300"} {
+				if _, ok := contents[p]; !ok {
+					t.Errorf("%q not exported", p)
+				}
+			}
+			// Sequenced but unintegrated entries and orphaned files are left out.
+			for _, p := range []string{"seq/00/00/00/01/2c", "tile/temp.tmp"} {
+				if _, ok := contents[p]; ok {
+					t.Errorf("%q exported", p)
+				}
+			}
+			leafhashes := 0
+			for _, n := range names {
+				if strings.HasPrefix(n, "leaves/") {
+					leafhashes++
+				}
+			}
+			if leafhashes != 300 {
+				t.Errorf("exported %d leafhash files, want 300", leafhashes)
+			}
+		})
+	}
+}
+
+func TestExportCorrupt(t *testing.T) {
+	d := filepath.Join(t.TempDir(), "log")
+	newTestLog(t, d, compress.None, []uint64{10}, 0)
+	if err := os.WriteFile(filepath.Join(layout.SeqPath(d, 3)), []byte("bad"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Export(context.Background(), d, io.Discard, openCheckpoint, rfc6962.DefaultHasher, compress.None); err == nil {
+		t.Error("Export of corrupt log: got no error")
+	}
+}
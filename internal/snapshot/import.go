@@ -0,0 +1,292 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+
+	"k8s.io/klog/v2"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// Destination is a storage backend into which a snapshot is restored.
+type Destination interface {
+	// WriteFile stores the resource at path p, relative to the log's root
+	// directory and with slash separators, with the given contents.
+	// Backends which record modification times should set that of the
+	// resource to modTime, since e.g. fs.RetentionSize relies on them.
+	WriteFile(ctx context.Context, p string, data []byte, modTime time.Time) error
+}
+
+// Import restores the log in the snapshot read from r into dst, and returns
+// the snapshot's manifest. It's equivalent to calling Stage followed by
+// Restore.
+func Import(ctx context.Context, r io.Reader, dst Destination, open func(cpRaw []byte) (*fmtlog.Checkpoint, error), h merkle.LogHasher, stagingDir string) (*Manifest, error) {
+	s, err := Stage(ctx, r, open, h, stagingDir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			klog.Warningf("Failed to remove staging directory: %v", err)
+		}
+	}()
+	if err := s.Restore(ctx, dst); err != nil {
+		return nil, err
+	}
+	return s.Manifest, nil
+}
+
+// Staged is a snapshot which has been extracted and verified, ready to be
+// restored.
+type Staged struct {
+	// Manifest is the snapshot's manifest.
+	Manifest *Manifest
+
+	dir    string
+	mtimes map[string]time.Time
+}
+
+// Stage extracts the snapshot read from r to a temporary directory under
+// stagingDir, or the default directory for temporary files if it's empty,
+// checking each file against the manifest. The extracted log is then checked
+// with fs.Verify, using open to verify its checkpoints, and an error is
+// returned unless every resource is verified against the checkpoint.
+//
+// The caller must call Close on the returned Staged to remove the temporary
+// directory.
+func Stage(ctx context.Context, r io.Reader, open func(cpRaw []byte) (*fmtlog.Checkpoint, error), h merkle.LogHasher, stagingDir string) (*Staged, error) {
+	dir, err := os.MkdirTemp(stagingDir, "snapshot-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	s := &Staged{dir: dir}
+	s.Manifest, s.mtimes, err = extract(ctx, r, dir)
+	if err == nil {
+		err = verifyStaged(ctx, dir, s.Manifest, open, h)
+	}
+	if err != nil {
+		if err := s.Close(); err != nil {
+			klog.Warningf("Failed to remove staging directory: %v", err)
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// Restore writes every resource in the staged snapshot to dst. The log's
+// checkpoint is written last, so that the restored log doesn't commit to
+// resources which haven't been written yet.
+func (s *Staged) Restore(ctx context.Context, dst Destination) error {
+	write := func(p string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		d, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+		if err := dst.WriteFile(ctx, p, d, s.mtimes[p]); err != nil {
+			return fmt.Errorf("failed to write %q: %w", p, err)
+		}
+		return nil
+	}
+	for _, f := range s.Manifest.Files {
+		if f.Path == layout.CheckpointPath {
+			continue
+		}
+		if err := write(f.Path); err != nil {
+			return err
+		}
+	}
+	return write(layout.CheckpointPath)
+}
+
+// Close removes the staged snapshot's temporary directory.
+func (s *Staged) Close() error {
+	return os.RemoveAll(s.dir)
+}
+
+// extract reads the snapshot from r into the directory dir, checking that its
+// files are exactly those listed by its manifest, and returns the manifest
+// along with the modification time of each file.
+func extract(ctx context.Context, r io.Reader, dir string) (*Manifest, map[string]time.Time, error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if hdr.Name != ManifestPath {
+		return nil, nil, fmt.Errorf("first entry is %q, want %q", hdr.Name, ManifestPath)
+	}
+	raw, err := io.ReadAll(tr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	m, err := ParseManifest(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mtimes := make(map[string]time.Time, len(m.Files))
+	for i, f := range m.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		if err := checkPath(f.Path); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := mtimes[f.Path]; ok {
+			return nil, nil, fmt.Errorf("manifest lists %q more than once", f.Path)
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil, fmt.Errorf("snapshot is truncated, %d files are missing", len(m.Files)-i)
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("failed to read entry %d: %w", i+1, err)
+		}
+		if hdr.Name != f.Path || hdr.Typeflag != tar.TypeReg || hdr.Size != f.Size {
+			return nil, nil, fmt.Errorf("entry %d is %q with size %d, but the manifest lists %q with size %d", i+1, hdr.Name, hdr.Size, f.Path, f.Size)
+		}
+		d, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %q: %w", f.Path, err)
+		}
+		if h := sha256.Sum256(d); !bytes.Equal(h[:], f.SHA256) {
+			return nil, nil, fmt.Errorf("%q has SHA-256 hash %x, but the manifest lists %x", f.Path, h, f.SHA256)
+		}
+		p := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return nil, nil, err
+		}
+		if err := os.WriteFile(p, d, 0o644); err != nil {
+			return nil, nil, err
+		}
+		mtimes[f.Path] = hdr.ModTime
+	}
+	if hdr, err := tr.Next(); err != io.EOF {
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read end of snapshot: %w", err)
+		}
+		return nil, nil, fmt.Errorf("unexpected entry %q not listed in the manifest", hdr.Name)
+	}
+	return m, mtimes, nil
+}
+
+// checkPath returns an error unless p is the path of a log resource, relative
+// to the log's root directory, see Export.
+func checkPath(p string) error {
+	if p != path.Clean(p) || path.IsAbs(p) || strings.Contains(p, `\`) {
+		return fmt.Errorf("invalid path %q", p)
+	}
+	switch first, _, _ := strings.Cut(p, "/"); first {
+	case layout.CheckpointPath, layout.BundleSizePath, layout.PrunedPath:
+		if first == p {
+			return nil
+		}
+	case "checkpoints", "tile", "seq", "leaves", "blobs":
+		if first != p {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected path %q", p)
+}
+
+// verifyStaged checks the log extracted to dir, and that it matches the
+// manifest m.
+func verifyStaged(ctx context.Context, dir string, m *Manifest, open func(cpRaw []byte) (*fmtlog.Checkpoint, error), h merkle.LogHasher) error {
+	comp, err := compress.Parse(m.Compression)
+	if err != nil {
+		return fmt.Errorf("invalid manifest: %v", err)
+	}
+	r, err := fs.Verify(ctx, dir, open, h, fs.WithCompression(comp))
+	if err != nil {
+		return fmt.Errorf("failed to verify snapshot: %w", err)
+	}
+	if len(r.Problems) > 0 {
+		errs := make([]error, 0, len(r.Problems))
+		for _, p := range r.Problems {
+			errs = append(errs, errors.New(p.String()))
+		}
+		return fmt.Errorf("snapshot failed verification: %w", errors.Join(errs...))
+	}
+	cpRaw, err := fs.ReadCheckpoint(dir)
+	if err != nil {
+		return err
+	}
+	cp, err := open(cpRaw)
+	if err != nil {
+		return err
+	}
+	bundleSize, err := fs.ReadBundleSize(dir)
+	if err != nil {
+		return err
+	}
+	switch {
+	case cp.Size != m.Size || !bytes.Equal(cp.Hash, m.RootHash):
+		return fmt.Errorf("checkpoint has size %d and root hash %x, but the manifest has size %d and root hash %x", cp.Size, cp.Hash, m.Size, m.RootHash)
+	case bundleSize != m.BundleSize:
+		return fmt.Errorf("log has bundle size %d, but the manifest has %d", bundleSize, m.BundleSize)
+	case r.Pruned != m.Pruned:
+		return fmt.Errorf("log has pruned size %d, but the manifest has %d", r.Pruned, m.Pruned)
+	}
+	return nil
+}
+
+// dirDestination restores a log to a directory on the local filesystem.
+type dirDestination struct {
+	rootDir string
+}
+
+// NewDirDestination returns a Destination which restores a log to rootDir on
+// the local filesystem, which must not already exist, with the same layout as
+// logs created by fs.Create.
+func NewDirDestination(rootDir string) (Destination, error) {
+	if _, err := fs.Create(rootDir); err != nil {
+		return nil, err
+	}
+	return dirDestination{rootDir: rootDir}, nil
+}
+
+func (d dirDestination) WriteFile(_ context.Context, p string, data []byte, modTime time.Time) error {
+	fp := filepath.Join(d.rootDir, filepath.FromSlash(p))
+	if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(fp, data, 0o644); err != nil {
+		return err
+	}
+	if modTime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(fp, modTime, modTime)
+}
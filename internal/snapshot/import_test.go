@@ -0,0 +1,208 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/storage/fs"
+)
+
+// memDestination records the files written to it, in order.
+type memDestination struct {
+	paths []string
+	files map[string][]byte
+}
+
+func (m *memDestination) WriteFile(_ context.Context, p string, data []byte, _ time.Time) error {
+	if m.files == nil {
+		m.files = make(map[string][]byte)
+	}
+	m.paths = append(m.paths, p)
+	m.files[p] = data
+	return nil
+}
+
+// writeArchive writes a snapshot holding the manifest m and the given files,
+// in order.
+func writeArchive(t *testing.T, m *Manifest, names []string, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	raw, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeEntry(tw, ManifestPath, raw, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range names {
+		if err := writeEntry(tw, n, files[n], time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	src := filepath.Join(t.TempDir(), "src")
+	newTestLog(t, src, compress.Gzip, []uint64{10, 300}, 5)
+	old := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(layout.CheckpointArchivePath(src, 10)), old, old); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	want, err := Export(ctx, src, &buf, openCheckpoint, rfc6962.DefaultHasher, compress.Gzip)
+	if err != nil {
+		t.Fatalf("Export = %v", err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	d, err := NewDirDestination(dst)
+	if err != nil {
+		t.Fatalf("NewDirDestination = %v", err)
+	}
+	m, err := Import(ctx, bytes.NewReader(buf.Bytes()), d, openCheckpoint, rfc6962.DefaultHasher, t.TempDir())
+	if err != nil {
+		t.Fatalf("Import = %v", err)
+	}
+	if m.Size != want.Size || len(m.Files) != len(want.Files) {
+		t.Errorf("Import returned manifest for size %d with %d files, want %d with %d", m.Size, len(m.Files), want.Size, len(want.Files))
+	}
+	r, err := fs.Verify(ctx, dst, openCheckpoint, rfc6962.DefaultHasher, fs.WithCompression(compress.Gzip))
+	if err != nil || r.Size != 300 || len(r.Problems) > 0 {
+		t.Fatalf("Verify of restored log = %+v, %v", r, err)
+	}
+	if got, err := fs.RetentionSize(dst, old.Add(time.Hour)); err != nil || got != 10 {
+		t.Errorf("RetentionSize of restored log = %d, %v, want 10", got, err)
+	}
+	if _, err := NewDirDestination(dst); err == nil {
+		t.Error("NewDirDestination of existing directory: got no error")
+	}
+
+	// The checkpoint is written last.
+	var md memDestination
+	if _, err := Import(ctx, bytes.NewReader(buf.Bytes()), &md, openCheckpoint, rfc6962.DefaultHasher, t.TempDir()); err != nil {
+		t.Fatalf("Import = %v", err)
+	}
+	if got := md.paths[len(md.paths)-1]; got != layout.CheckpointPath {
+		t.Errorf("last file written was %q, want %q", got, layout.CheckpointPath)
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	ctx := context.Background()
+	src := filepath.Join(t.TempDir(), "src")
+	newTestLog(t, src, compress.None, []uint64{300}, 0)
+	var buf bytes.Buffer
+	if _, err := Export(ctx, src, &buf, openCheckpoint, rfc6962.DefaultHasher, compress.None); err != nil {
+		t.Fatalf("Export = %v", err)
+	}
+	names, files := readArchive(t, &buf)
+	m, err := ParseManifest(files[ManifestPath])
+	if err != nil {
+		t.Fatalf("ParseManifest = %v", err)
+	}
+	names = names[1:]
+	tile := "tile/00/0000/00/00/00"
+	if _, ok := files[tile]; !ok {
+		t.Fatalf("snapshot has no %q", tile)
+	}
+
+	for _, test := range []struct {
+		desc   string
+		modify func(m *Manifest, names []string, files map[string][]byte) []string
+	}{
+		{
+			desc: "truncated",
+			modify: func(_ *Manifest, names []string, _ map[string][]byte) []string {
+				return names[:len(names)-1]
+			},
+		}, {
+			desc: "extra file",
+			modify: func(_ *Manifest, names []string, files map[string][]byte) []string {
+				files["tile/extra"] = []byte("extra")
+				return append(names, "tile/extra")
+			},
+		}, {
+			desc: "modified file",
+			modify: func(_ *Manifest, names []string, files map[string][]byte) []string {
+				files[tile] = append([]byte{}, files[tile]...)
+				files[tile][0] ^= 1
+				return names
+			},
+		}, {
+			desc: "modified file and manifest",
+			modify: func(m *Manifest, names []string, files map[string][]byte) []string {
+				d := append([]byte{}, files[tile]...)
+				d[len(d)-2] ^= 1
+				files[tile] = d
+				for i, f := range m.Files {
+					if f.Path == tile {
+						h := sha256.Sum256(d)
+						m.Files[i].SHA256 = h[:]
+					}
+				}
+				return names
+			},
+		}, {
+			desc: "manifest size mismatch",
+			modify: func(m *Manifest, names []string, _ map[string][]byte) []string {
+				m.Size = 299
+				return names
+			},
+		}, {
+			desc: "path outside log",
+			modify: func(m *Manifest, names []string, files map[string][]byte) []string {
+				files["../escape"] = []byte("escape")
+				h := sha256.Sum256(files["../escape"])
+				m.Files = append(m.Files, File{Path: "../escape", Size: 6, SHA256: h[:]})
+				return append(names, "../escape")
+			},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			tm := *m
+			tm.Files = append([]File{}, m.Files...)
+			tf := make(map[string][]byte)
+			for k, v := range files {
+				tf[k] = v
+			}
+			tn := test.modify(&tm, append([]string{}, names...), tf)
+			var md memDestination
+			if _, err := Import(ctx, bytes.NewReader(writeArchive(t, &tm, tn, tf)), &md, openCheckpoint, rfc6962.DefaultHasher, t.TempDir()); err == nil {
+				t.Error("Import: got no error")
+			}
+			if len(md.paths) > 0 {
+				t.Errorf("Import wrote %d files", len(md.paths))
+			}
+		})
+	}
+}
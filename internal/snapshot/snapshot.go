@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package snapshot provides support for exporting a verified snapshot of a
+// serverless log's storage to a single archive, e.g. for cold backups or for
+// distribution to air-gapped environments, and for restoring logs from such
+// archives.
+//
+// A snapshot is a tar archive whose first entry is the manifest, see
+// ManifestPath, followed by each of the log's resources, named by their paths
+// relative to the log's root directory, see the layout package.
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// ManifestPath is the name of the archive entry holding the snapshot's
+	// manifest.
+	ManifestPath = "MANIFEST.json"
+
+	// manifestVersion is the version of the manifest format written by
+	// Export.
+	manifestVersion = 1
+)
+
+// Manifest describes the contents of a snapshot.
+type Manifest struct {
+	// Version is the version of the manifest format.
+	Version int `json:"version"`
+	// Created is the time at which the snapshot was exported.
+	Created time.Time `json:"created"`
+	// Origin, Size and RootHash are taken from the log's checkpoint, which
+	// commits to every resource in the snapshot.
+	Origin   string `json:"origin"`
+	Size     uint64 `json:"size"`
+	RootHash []byte `json:"root_hash"`
+	// BundleSize is the number of leaves in each of the log's leaf bundles.
+	BundleSize uint64 `json:"bundle_size"`
+	// Pruned is the size of the log's pruned prefix, whose leaf data is not
+	// in the snapshot.
+	Pruned uint64 `json:"pruned,omitempty"`
+	// Compression is the compression used for the log's leaf data and tiles,
+	// see compress.Parse.
+	Compression string `json:"compression,omitempty"`
+	// Files lists the resources in the snapshot, in the order they appear in
+	// the archive.
+	Files []File `json:"files"`
+}
+
+// File describes a resource in a snapshot.
+type File struct {
+	// Path is the resource's path relative to the log's root directory, with
+	// slash separators.
+	Path string `json:"path"`
+	// Size is the length of the resource in bytes.
+	Size int64 `json:"size"`
+	// SHA256 is the SHA-256 hash of the resource.
+	SHA256 []byte `json:"sha256"`
+}
+
+// ParseManifest parses and checks the version of a snapshot's manifest.
+func ParseManifest(raw []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	return &m, nil
+}
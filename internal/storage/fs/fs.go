@@ -20,12 +20,17 @@ import (
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/transparency-dev/serverless-log/api"
 	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/encrypt"
 	"github.com/transparency-dev/serverless-log/pkg/log"
 	"k8s.io/klog/v2"
 )
@@ -41,9 +46,20 @@ const (
 //
 //	<rootDir>/leaves/aa/bb/cc/ddeeff...
 //	<rootDir>/leaves/pending/aabbccddeeff...
+//	<rootDir>/blobs/aa/bb/ccddeeff...
 //	<rootDir>/seq/aa/bb/cc/ddeeff...
+//	<rootDir>/staged/seq/aa/bb/cc/ddeeff...
 //	<rootDir>/tile/<level>/aa/bb/ccddee...
 //	<rootDir>/checkpoint
+//	<rootDir>/checkpoints/<size>
+//	<rootDir>/.integrate.journal
+//
+// Files are written to uniquely named temporary files which are then linked or
+// renamed into place, so concurrent writers and crashes never leave partially
+// written files in the log. In logs with a bundle size greater than 1, entries
+// are staged individually when they're sequenced, and written to leaf bundles
+// when they're integrated, see WriteBundles. See AcquireLock for serialising the sequence and
+// integrate operations of separate processes.
 //
 // The functions on this struct are not thread-safe.
 type Storage struct {
@@ -54,13 +70,90 @@ type Storage struct {
 	// Note that nextSeq may be <= than the actual next available number, but
 	// never greater.
 	nextSeq uint64
+	// compression is the algorithm used to compress leaf data and tiles.
+	compression compress.Algorithm
+	// encrypter, if set, is used to encrypt leaf data.
+	encrypter *encrypt.Encrypter
+	// metrics, if set, is informed of the files which are read and written.
+	metrics log.StorageMetrics
+	// bundleSize is the number of leaves stored in each file under seq/, see
+	// ReadBundleSize.
+	bundleSize uint64
+}
+
+// Option configures a Storage.
+type Option func(*Storage)
+
+// WithCompression causes leaf data and tiles to be stored compressed with the
+// given algorithm. Clients must then use client.DecompressingFetcher to read
+// the log.
+//
+// Existing uncompressed files continue to be readable, so compression may be
+// enabled for an existing log, unless any of its leaves happen to begin with
+// the magic header of a compression format. Once enabled, it should not be
+// disabled again.
+func WithCompression(a compress.Algorithm) Option {
+	return func(fs *Storage) {
+		fs.compression = a
+	}
+}
+
+// WithEncryption causes leaf data, i.e. leaf bundles and blobs, to be stored
+// encrypted with e, after any compression, see api.Envelope. Tiles, leafhash
+// index files and checkpoints are not encrypted. Clients must then use
+// client.DecryptingFetcher to read the log's leaves.
+//
+// Existing unencrypted leaf data continues to be readable, so encryption may be
+// enabled for an existing log.
+func WithEncryption(e *encrypt.Encrypter) Option {
+	return func(fs *Storage) {
+		fs.encrypter = e
+	}
 }
 
-const leavesPendingPathFmt = "leaves/pending/%0x"
+// WithMetrics causes the files which are read and written by the Storage to be
+// reported to m. Files are reported by their path relative to the log's root
+// directory. Writes of files which must only be written once, i.e. sequenced
+// entries, leafhash files and archived checkpoints, fail their precondition if
+// the file already exists. Files accessed by the package's functions, e.g.
+// ReadCheckpoint, rather than by the Storage's methods, are not reported.
+func WithMetrics(m log.StorageMetrics) Option {
+	return func(fs *Storage) {
+		fs.metrics = m
+	}
+}
+
+// WithBundleSize causes a log created with Create to store its leaves in
+// bundles of n leaves, see api/layout/README.md. The bundle size is recorded in
+// the log, so it needn't be given to Load, but if it is it must match.
+func WithBundleSize(n uint64) Option {
+	return func(fs *Storage) {
+		fs.bundleSize = n
+	}
+}
+
+var (
+	_ log.LeafIndexer = &Storage{}
+	_ log.Journal     = &Storage{}
+)
+
+// journalFile is the file holding the journal of an in-progress integration,
+// see log.Journal.
+const journalFile = ".integrate.journal"
+
+// leavesPendingDir is the directory holding temporary copies of leaves which
+// are being sequenced.
+const leavesPendingDir = "leaves/pending"
+
+// stagedDir is the directory holding the entries which have been sequenced,
+// but not yet written to leaf bundles, in logs whose bundle size is greater
+// than 1. Entries are stored under it as they would be under seq/ in a log
+// with bundle size 1.
+const stagedDir = "staged"
 
 // Load returns a Storage instance initialised from the filesystem at the provided location.
 // cpSize should be the Size of the checkpoint produced from the last `log.Integrate` call.
-func Load(rootDir string, cpSize uint64) (*Storage, error) {
+func Load(rootDir string, cpSize uint64, opts ...Option) (*Storage, error) {
 	fi, err := os.Stat(rootDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat %q: %w", rootDir, err)
@@ -69,15 +162,27 @@ func Load(rootDir string, cpSize uint64) (*Storage, error) {
 	if !fi.IsDir() {
 		return nil, fmt.Errorf("%q is not a directory", rootDir)
 	}
+	n, err := ReadBundleSize(rootDir)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Storage{
+	fs := &Storage{
 		rootDir: rootDir,
 		nextSeq: cpSize,
-	}, nil
+	}
+	for _, o := range opts {
+		o(fs)
+	}
+	if fs.bundleSize != 0 && fs.bundleSize != n {
+		return nil, fmt.Errorf("log has bundle size %d, not %d", n, fs.bundleSize)
+	}
+	fs.bundleSize = n
+	return fs, nil
 }
 
 // Create creates a new filesystem hierarchy and returns a Storage representation for it.
-func Create(rootDir string) (*Storage, error) {
+func Create(rootDir string, opts ...Option) (*Storage, error) {
 	_, err := os.Stat(rootDir)
 	if err == nil {
 		return nil, fmt.Errorf("%q %w", rootDir, os.ErrExist)
@@ -87,7 +192,7 @@ func Create(rootDir string) (*Storage, error) {
 		return nil, fmt.Errorf("failed to create directory %q: %w", rootDir, err)
 	}
 
-	for _, sfx := range []string{"leaves/pending", "seq", "tile"} {
+	for _, sfx := range []string{"checkpoints", "leaves/pending", "seq", "tile"} {
 		path := filepath.Join(rootDir, sfx)
 		if err := os.MkdirAll(path, dirPerm); err != nil {
 			return nil, fmt.Errorf("failed to create directory %q: %w", path, err)
@@ -98,6 +203,17 @@ func Create(rootDir string) (*Storage, error) {
 		rootDir: rootDir,
 		nextSeq: 0,
 	}
+	for _, o := range opts {
+		o(fs)
+	}
+	if fs.bundleSize == 0 {
+		fs.bundleSize = 1
+	}
+	if fs.bundleSize > 1 {
+		if err := os.WriteFile(filepath.Join(rootDir, layout.BundleSizePath), []byte(strconv.FormatUint(fs.bundleSize, 10)), filePerm); err != nil {
+			return nil, fmt.Errorf("failed to write bundle size: %w", err)
+		}
+	}
 
 	return fs, nil
 }
@@ -113,21 +229,13 @@ func (fs *Storage) Sequence(ctx context.Context, leafhash []byte, leaf []byte) (
 	// 3. Hard link temp -> seq file
 	// 4. Create leafhash file containing assigned sequence number
 
-	// Ensure the leafhash directory structure is present
-	leafDir, leafFile := layout.LeafPath(fs.rootDir, leafhash)
-	if err := os.MkdirAll(leafDir, dirPerm); err != nil {
-		return 0, fmt.Errorf("failed to make leaf directory structure: %w", err)
-	}
 	// Check for dupe leaf already present.
-	// If there is one, it should contain the existing leaf's sequence number,
-	// so read that back and return it.
-	leafFQ := filepath.Join(leafDir, leafFile)
-	if seqString, err := os.ReadFile(leafFQ); !os.IsNotExist(err) {
-		origSeq, err := strconv.ParseUint(string(seqString), 16, 64)
-		if err != nil {
-			return 0, err
-		}
+	// If there is one, it contains the existing leaf's sequence number, so
+	// return that.
+	if origSeq, err := fs.LeafIndex(ctx, leafhash); err == nil {
 		return origSeq, log.ErrDupeLeaf
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
 	}
 
 	// Now try to sequence it, we may have to scan over some newly sequenced entries
@@ -146,22 +254,10 @@ func (fs *Storage) Sequence(ctx context.Context, leafhash []byte, leaf []byte) (
 		// Create a leafhash file containing the assigned sequence number.
 		// This isn't infallible though, if we crash after hardlinking the
 		// sequence file above, but before doing this a resubmission of the
-		// same leafhash would be permitted.
-		//
-		// First create a temp file
-		leafTmp := fmt.Sprintf("%s.tmp", leafFQ)
-		if err := createExclusive(leafTmp, []byte(strconv.FormatUint(seq, 16))); err != nil {
-			return 0, fmt.Errorf("couldn't create temporary leafhash file: %w", err)
-		}
-		defer func() {
-			if err := os.Remove(leafTmp); err != nil {
-				klog.Errorf("os.Remove(): %v", err)
-			}
-		}()
-		// Link the temporary file in place, if it already exists we likely crashed after
-		//creating the tmp file above.
-		if err := os.Link(leafTmp, leafFQ); err != nil && !errors.Is(err, os.ErrExist) {
-			return 0, fmt.Errorf("couldn't link temporary leafhash file in place: %w", err)
+		// same leafhash would be permitted until the entry is integrated,
+		// see IndexLeaf.
+		if err := fs.IndexLeaf(ctx, leafhash, seq); err != nil {
+			return 0, err
 		}
 
 		// All done!
@@ -169,19 +265,91 @@ func (fs *Storage) Sequence(ctx context.Context, leafhash []byte, leaf []byte) (
 	}
 }
 
+// LeafIndex returns the sequence number of the entry with the given leaf hash,
+// or an error wrapping os.ErrNotExist if there is no such entry.
+func (fs *Storage) LeafIndex(_ context.Context, leafhash []byte) (uint64, error) {
+	leafDir, leafFile := layout.LeafPath(fs.rootDir, leafhash)
+	seqString, err := fs.readFile(filepath.Join(leafDir, leafFile))
+	if err != nil {
+		return 0, err
+	}
+	seq, err := strconv.ParseUint(string(seqString), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid leafhash file for %x: %w", leafhash, err)
+	}
+	return seq, nil
+}
+
+// IndexLeaf records that the entry with the given leaf hash was sequenced at
+// seq, by creating a leafhash file containing the sequence number. If the file
+// already exists it is left unchanged.
+//
+// This is called by log.Integrate for every entry it integrates, so that
+// entries whose leafhash file was not written by Sequence, e.g. because of a
+// crash or because they were added with Assign, are still deduplicated.
+func (fs *Storage) IndexLeaf(_ context.Context, leafhash []byte, seq uint64) error {
+	leafDir, leafFile := layout.LeafPath(fs.rootDir, leafhash)
+	leafFQ := filepath.Join(leafDir, leafFile)
+	if _, err := os.Stat(leafFQ); err == nil {
+		return nil
+	}
+	// Ensure the leafhash directory structure is present
+	if err := os.MkdirAll(leafDir, dirPerm); err != nil {
+		return fmt.Errorf("failed to make leaf directory structure: %w", err)
+	}
+
+	// First create a temp file
+	start := time.Now()
+	d := []byte(strconv.FormatUint(seq, 16))
+	leafTmp, err := writeTemp(leafDir, leafFile+".*.tmp", d)
+	if err != nil {
+		fs.observeWrite(leafFQ, len(d), start, err)
+		return fmt.Errorf("couldn't create temporary leafhash file: %w", err)
+	}
+	defer func() {
+		if err := os.Remove(leafTmp); err != nil {
+			klog.Errorf("os.Remove(): %v", err)
+		}
+	}()
+	// Link the temporary file in place, if it already exists then another
+	// sequencer has recorded the same leaf concurrently, see SequenceLock.
+	err = os.Link(leafTmp, leafFQ)
+	fs.observeWrite(leafFQ, len(d), start, err)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("couldn't link temporary leafhash file in place: %w", err)
+	}
+	return nil
+}
+
 // Assign directly associates the given leaf data with the provided sequence number.
 // It is an error to attempt to assign data to a previously assigned sequence number,
 // even if the data is identical.
-func (fs *Storage) Assign(_ context.Context, seq uint64, leaf []byte) error {
+func (fs *Storage) Assign(ctx context.Context, seq uint64, leaf []byte) error {
 	// Ensure the sequencing directory structure is present:
-	seqDir, seqFile := layout.SeqPath(fs.rootDir, seq)
+	seqDir, seqFile := sequencedPath(fs.rootDir, fs.bundleSize, seq)
 	if err := os.MkdirAll(seqDir, dirPerm); err != nil {
 		return fmt.Errorf("failed to make seq directory structure: %w", err)
 	}
+	if fs.bundleSize > 1 {
+		// The staged copy of an integrated entry may have been removed.
+		if ok, err := inBundle(fs.rootDir, fs.bundleSize, seq); err != nil {
+			return err
+		} else if ok {
+			return log.ErrSeqAlreadyAssigned
+		}
+	}
+
+	d, err := fs.encode(ctx, leaf)
+	if err != nil {
+		return fmt.Errorf("failed to encode leaf data: %w", err)
+	}
 
 	// Write a temp file with the leaf data
-	tmp := filepath.Join(fs.rootDir, fmt.Sprintf(leavesPendingPathFmt, sha256.Sum256(leaf)))
-	if err := createExclusive(tmp, leaf); err != nil {
+	seqPath := filepath.Join(seqDir, seqFile)
+	start := time.Now()
+	tmp, err := writeTemp(filepath.Join(fs.rootDir, leavesPendingDir), fmt.Sprintf("%0x.*", sha256.Sum256(leaf)), d)
+	if err != nil {
+		fs.observeWrite(seqPath, len(d), start, err)
 		return fmt.Errorf("unable to write temporary file: %w", err)
 	}
 	defer func() {
@@ -191,8 +359,9 @@ func (fs *Storage) Assign(_ context.Context, seq uint64, leaf []byte) error {
 	}()
 
 	// Hardlink the sequence file to the temporary file
-	seqPath := filepath.Join(seqDir, seqFile)
-	if err := os.Link(tmp, seqPath); errors.Is(err, os.ErrExist) {
+	err = os.Link(tmp, seqPath)
+	fs.observeWrite(seqPath, len(d), start, err)
+	if errors.Is(err, os.ErrExist) {
 		return log.ErrSeqAlreadyAssigned
 	} else if err != nil {
 		return fmt.Errorf("failed to link seq file: %w", err)
@@ -200,42 +369,181 @@ func (fs *Storage) Assign(_ context.Context, seq uint64, leaf []byte) error {
 	return nil
 }
 
-// createExclusive creates the named file before writing the data in d to it.
-// It will error if the file already exists, or it's unable to fully write the
-// data & close the file.
-func createExclusive(f string, d []byte) error {
-	tmpFile, err := os.OpenFile(f, os.O_RDWR|os.O_CREATE|os.O_EXCL, filePerm)
+// StoreBlob stores a large leaf payload in the log's content-addressed blob
+// area, and returns a reference to it which may be sequenced in its place, see
+// api.BlobRef. Blobs are compressed and encrypted in the same way as leaf data.
+// Storing a blob which is already stored is not an error.
+func (fs *Storage) StoreBlob(ctx context.Context, blob []byte) (api.BlobRef, error) {
+	ref := api.NewBlobRef(blob)
+	dir, file := layout.BlobPath(fs.rootDir, ref.Hash)
+	p := filepath.Join(dir, file)
+	if _, err := os.Stat(p); err == nil {
+		return ref, nil
+	}
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return api.BlobRef{}, fmt.Errorf("failed to create directory %q: %w", dir, err)
+	}
+	d, err := fs.encode(ctx, blob)
 	if err != nil {
-		return fmt.Errorf("unable to create temporary file: %w", err)
+		return api.BlobRef{}, fmt.Errorf("failed to encode blob: %w", err)
 	}
-	n, err := tmpFile.Write(d)
+	start := time.Now()
+	tmp, err := writeTemp(dir, file+".*.tmp", d)
 	if err != nil {
-		return fmt.Errorf("unable to write leafdata to temporary file: %w", err)
+		fs.observeWrite(p, len(d), start, err)
+		return api.BlobRef{}, fmt.Errorf("failed to write temporary blob file: %w", err)
 	}
-	if got, want := n, len(d); got != want {
-		return fmt.Errorf("short write on leaf, wrote %d expected %d", got, want)
+	defer func() {
+		if err := os.Remove(tmp); err != nil {
+			klog.Errorf("os.Remove(): %v", err)
+		}
+	}()
+	// If the blob already exists, it was stored concurrently with the same
+	// contents.
+	err = os.Link(tmp, p)
+	fs.observeWrite(p, len(d), start, err)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return api.BlobRef{}, fmt.Errorf("failed to link blob in place: %w", err)
 	}
-	if err := tmpFile.Close(); err != nil {
-		return err
+	return ref, nil
+}
+
+// ReadBlob returns the contents of the stored blob referenced by ref, having
+// checked that they match the reference.
+func (fs *Storage) ReadBlob(ctx context.Context, ref api.BlobRef) ([]byte, error) {
+	dir, file := layout.BlobPath(fs.rootDir, ref.Hash)
+	d, err := fs.readFile(filepath.Join(dir, file))
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	blob, err := fs.decode(ctx, d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode blob: %w", err)
+	}
+	if err := ref.Verify(blob); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// decompress returns the decompressed contents of d, if the log is configured
+// to compress its contents, or d otherwise.
+func (fs *Storage) decompress(d []byte) ([]byte, error) {
+	if fs.compression == compress.None {
+		return d, nil
+	}
+	return compress.Decompress(d)
+}
+
+// encode returns leaf data d in the form in which it's stored, i.e. compressed
+// and then encrypted, if the log is configured to do either.
+func (fs *Storage) encode(ctx context.Context, d []byte) ([]byte, error) {
+	d, err := compress.Compress(fs.compression, d)
+	if err != nil || fs.encrypter == nil {
+		return d, err
+	}
+	return fs.encrypter.Encrypt(ctx, d)
+}
+
+// decode returns the leaf data stored as d, reversing encode. Leaf data which
+// was stored before encryption was enabled is returned as is, but encrypted
+// leaf data is an error if the log isn't configured with an Encrypter, so that
+// the log's tree is never computed over ciphertext.
+func (fs *Storage) decode(ctx context.Context, d []byte) ([]byte, error) {
+	if fs.encrypter != nil {
+		var err error
+		if d, err = fs.encrypter.Decrypt(ctx, d); err != nil {
+			return nil, err
+		}
+	} else if api.IsEnvelope(d) {
+		return nil, errors.New("leaf data is encrypted, but no encryption key was given")
+	}
+	return fs.decompress(d)
+}
+
+// readFile reads the file at path p, reporting the read to the storage's
+// metrics, if any.
+func (fs *Storage) readFile(p string) ([]byte, error) {
+	start := time.Now()
+	d, err := os.ReadFile(p)
+	if fs.metrics != nil {
+		fs.metrics.ObjectRead(fs.key(p), len(d), time.Since(start), err)
+	}
+	return d, err
+}
+
+// observeWrite reports a write of size bytes to the file at path p, which
+// started at start, to the storage's metrics, if any. Writes which failed
+// because the file already exists are reported as precondition failures.
+func (fs *Storage) observeWrite(p string, size int, start time.Time, err error) {
+	if fs.metrics == nil {
+		return
+	}
+	k := fs.key(p)
+	if errors.Is(err, os.ErrExist) {
+		fs.metrics.PreconditionFailed(k)
+	}
+	fs.metrics.ObjectWritten(k, size, time.Since(start), err)
+}
+
+// key returns the path p relative to the log's root directory, using forward
+// slashes, as reported to the storage's metrics.
+func (fs *Storage) key(p string) string {
+	if r, err := filepath.Rel(fs.rootDir, p); err == nil {
+		p = r
+	}
+	return filepath.ToSlash(p)
+}
+
+// writeTemp writes the data in d to a new, uniquely named, file in dir, whose
+// name is generated from pattern as by os.CreateTemp, and returns its path.
+// The data is synced to disk before returning, so that the file may be safely
+// linked or renamed into place.
+func writeTemp(dir, pattern string, d []byte) (string, error) {
+	tmpFile, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	name := tmpFile.Name()
+	err = func() error {
+		if err := tmpFile.Chmod(filePerm); err != nil {
+			return err
+		}
+		if _, err := tmpFile.Write(d); err != nil {
+			return fmt.Errorf("unable to write data to temporary file: %w", err)
+		}
+		return tmpFile.Sync()
+	}()
+	if cErr := tmpFile.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		if rErr := os.Remove(name); rErr != nil {
+			klog.Errorf("os.Remove(): %v", rErr)
+		}
+		return "", err
+	}
+	return name, nil
 }
 
 // ScanSequenced calls the provided function once for each contiguous entry
 // in storage starting at begin.
 // The scan will abort if the function returns an error, otherwise it will
 // return the number of sequenced entries.
-func (fs *Storage) ScanSequenced(_ context.Context, begin uint64, f func(seq uint64, entry []byte) error) (uint64, error) {
+func (fs *Storage) ScanSequenced(ctx context.Context, begin uint64, f func(seq uint64, entry []byte) error) (uint64, error) {
 	end := begin
 	for {
-		sp := filepath.Join(layout.SeqPath(fs.rootDir, end))
-		entry, err := os.ReadFile(sp)
+		sp := filepath.Join(sequencedPath(fs.rootDir, fs.bundleSize, end))
+		entry, err := fs.readFile(sp)
 		if errors.Is(err, os.ErrNotExist) {
 			// we're done.
 			return end - begin, nil
 		} else if err != nil {
 			return end - begin, fmt.Errorf("failed to read leafdata at index %d: %w", begin, err)
 		}
+		if entry, err = fs.decode(ctx, entry); err != nil {
+			return end - begin, fmt.Errorf("failed to decode leafdata at index %d: %w", end, err)
+		}
 		if err := f(end, entry); err != nil {
 			return end - begin, err
 		}
@@ -243,19 +551,169 @@ func (fs *Storage) ScanSequenced(_ context.Context, begin uint64, f func(seq uin
 	}
 }
 
+// CountSequenced returns the number of contiguous entries in the log stored
+// in rootDir which have been sequenced starting at begin, e.g. the number of
+// entries waiting to be integrated if begin is the size of the log's
+// checkpoint. Unlike ScanSequenced, the entries aren't read.
+func CountSequenced(rootDir string, begin uint64) (uint64, error) {
+	bundleSize, err := ReadBundleSize(rootDir)
+	if err != nil {
+		return 0, err
+	}
+	end := begin
+	for {
+		ok, err := sequenced(rootDir, bundleSize, end)
+		if err != nil || !ok {
+			return end - begin, err
+		}
+		end++
+	}
+}
+
+// Sequenced reports whether an entry has been sequenced at seq in the log
+// stored in rootDir. Since entries are sequenced contiguously, this is a cheap
+// way of checking whether more than a given number of entries are waiting to
+// be integrated.
+func Sequenced(rootDir string, seq uint64) (bool, error) {
+	bundleSize, err := ReadBundleSize(rootDir)
+	if err != nil {
+		return false, err
+	}
+	return sequenced(rootDir, bundleSize, seq)
+}
+
+// sequenced implements Sequenced for a log with the given bundle size.
+func sequenced(rootDir string, bundleSize, seq uint64) (bool, error) {
+	_, err := os.Stat(filepath.Join(sequencedPath(rootDir, bundleSize, seq)))
+	if errors.Is(err, os.ErrNotExist) {
+		if bundleSize > 1 {
+			return inBundle(rootDir, bundleSize, seq)
+		}
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to stat leafdata at index %d: %w", seq, err)
+	}
+	return true, nil
+}
+
+// inBundle reports whether the entry at seq has been written to a leaf bundle
+// of the log at rootDir, whose bundle size must be greater than 1, i.e.
+// whether it has been integrated.
+func inBundle(rootDir string, bundleSize, seq uint64) (bool, error) {
+	p := filepath.Join(layout.BundlePath(rootDir, seq/bundleSize, 0))
+	if _, err := os.Stat(p); err == nil {
+		return true, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("failed to stat leaf bundle %d: %w", seq/bundleSize, err)
+	}
+	partials, err := filepath.Glob(p + ".*")
+	if err != nil {
+		return false, fmt.Errorf("failed to list partial leaf bundles: %w", err)
+	}
+	for _, pp := range partials {
+		// Skip temporary files, see writeBundle.
+		n, err := strconv.ParseUint(strings.TrimPrefix(pp, p+"."), 10, 64)
+		if err == nil && n > seq%bundleSize {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sequencedPath returns the directory path and filename of the entry sequenced
+// at seq, before it's integrated, in the log at rootDir with the given bundle
+// size. In logs with bundle size 1 this is where the entry stays once it's
+// integrated, see stagedDir.
+func sequencedPath(rootDir string, bundleSize, seq uint64) (string, string) {
+	if bundleSize > 1 {
+		rootDir = filepath.Join(rootDir, stagedDir)
+	}
+	return layout.SeqPath(rootDir, seq)
+}
+
+// WriteBundles writes the leaf bundles holding the entries which were
+// integrated when the log grew from size fromSize to toSize, from the staged
+// copies of the entries, see stagedDir. The partial bundle at the right-hand
+// edge of the log of size fromSize, if any, is extended. Bundles are written
+// atomically, and are only determined by the log's entries, so WriteBundles may
+// be called again if it's interrupted.
+//
+// It must be called after the entries have been integrated, and before the
+// checkpoint for size toSize is written, so that checkpoints never commit to
+// leaves which can't be read. It does nothing in logs with bundle size 1, whose
+// entries are stored in place when they're sequenced.
+func (fs *Storage) WriteBundles(ctx context.Context, fromSize, toSize uint64) error {
+	bs := fs.bundleSize
+	if bs <= 1 || toSize <= fromSize {
+		return nil
+	}
+	var bundle [][]byte
+	if fromSize%bs > 0 {
+		entries, err := fs.readBundle(ctx, fromSize/bs, bs, fromSize)
+		if err != nil {
+			return err
+		}
+		bundle = entries
+	}
+	for seq := fromSize; seq < toSize; seq++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		raw, err := fs.readFile(filepath.Join(sequencedPath(fs.rootDir, bs, seq)))
+		if err != nil {
+			return fmt.Errorf("failed to read staged entry %d: %w", seq, err)
+		}
+		entry, err := fs.decode(ctx, raw)
+		if err != nil {
+			return fmt.Errorf("failed to decode staged entry %d: %w", seq, err)
+		}
+		bundle = append(bundle, entry)
+		if uint64(len(bundle)) == bs || seq == toSize-1 {
+			if err := fs.writeBundle(ctx, seq/bs, bs, bundle); err != nil {
+				return err
+			}
+			bundle = bundle[:0]
+		}
+	}
+	return nil
+}
+
+// RemoveStaged removes the staged copies of the entries in [fromSize, toSize),
+// which are no longer needed once a checkpoint committing to their leaf
+// bundles has been written, see WriteBundles. It does nothing in logs with
+// bundle size 1.
+func (fs *Storage) RemoveStaged(ctx context.Context, fromSize, toSize uint64) error {
+	if fs.bundleSize <= 1 {
+		return nil
+	}
+	for seq := fromSize; seq < toSize; seq++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p := filepath.Join(sequencedPath(fs.rootDir, fs.bundleSize, seq))
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove staged entry %d: %w", seq, err)
+		}
+	}
+	return nil
+}
+
 // GetTile returns the tile at the given tile-level and tile-index.
 // If no complete tile exists at that location, it will attempt to find a
 // partial tile for the given tree size at that location.
 func (fs *Storage) GetTile(_ context.Context, level, index, logSize uint64) (*api.Tile, error) {
 	tileSize := layout.PartialTileSize(level, index, logSize)
 	p := filepath.Join(layout.TilePath(fs.rootDir, level, index, tileSize))
-	t, err := os.ReadFile(p)
+	t, err := fs.readFile(p)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
 			return nil, fmt.Errorf("failed to read tile at %q: %w", p, err)
 		}
 		return nil, err
 	}
+	if t, err = fs.decompress(t); err != nil {
+		return nil, fmt.Errorf("failed to decompress tile at %q: %w", p, err)
+	}
 
 	var tile api.Tile
 	if err := tile.UnmarshalText(t); err != nil {
@@ -278,6 +736,9 @@ func (fs *Storage) StoreTile(_ context.Context, level, index uint64, tile *api.T
 	if err != nil {
 		return fmt.Errorf("failed to marshal tile: %w", err)
 	}
+	if t, err = compress.Compress(fs.compression, t); err != nil {
+		return fmt.Errorf("failed to compress tile: %w", err)
+	}
 
 	tDir, tFile := layout.TilePath(fs.rootDir, level, index, tileSize%256)
 	tPath := filepath.Join(tDir, tFile)
@@ -286,17 +747,22 @@ func (fs *Storage) StoreTile(_ context.Context, level, index uint64, tile *api.T
 		return fmt.Errorf("failed to create directory %q: %w", tDir, err)
 	}
 
-	// TODO(al): use unlinked temp file
-	temp := fmt.Sprintf("%s.temp", tPath)
-	if err := os.WriteFile(temp, t, filePerm); err != nil {
+	start := time.Now()
+	temp, err := writeTemp(tDir, tFile+".*.temp", t)
+	if err != nil {
+		fs.observeWrite(tPath, len(t), start, err)
 		return fmt.Errorf("failed to write temporary tile file: %w", err)
 	}
-	if err := os.Rename(temp, tPath); err != nil {
+	err = os.Rename(temp, tPath)
+	fs.observeWrite(tPath, len(t), start, err)
+	if err != nil {
 		return fmt.Errorf("failed to rename temporary tile file: %w", err)
 	}
 
 	if tileSize == 256 {
-		partials, err := filepath.Glob(fmt.Sprintf("%s.*", tPath))
+		// Only match partial tiles, and not temporary files being written by
+		// other processes.
+		partials, err := filepath.Glob(fmt.Sprintf("%s.[0-9a-f][0-9a-f]", tPath))
 		if err != nil {
 			return fmt.Errorf("failed to list partial tiles for clean up; %w", err)
 		}
@@ -306,7 +772,7 @@ func (fs *Storage) StoreTile(_ context.Context, level, index uint64, tile *api.T
 			// We have to do a little dance here to get POSIX atomicity:
 			// 1. Create a new temporary symlink to the full tile
 			// 2. Rename the temporary symlink over the top of the old partial tile
-			tmp := fmt.Sprintf("%s.link", tPath)
+			tmp := fmt.Sprintf("%s.%d.%x.link", tPath, os.Getpid(), rand.Uint64())
 			if err := os.Symlink(tPath, tmp); err != nil {
 				return fmt.Errorf("failed to create temp link to full tile: %w", err)
 			}
@@ -322,11 +788,44 @@ func (fs *Storage) StoreTile(_ context.Context, level, index uint64, tile *api.T
 // WriteCheckpoint stores a raw log checkpoint on disk.
 func (fs Storage) WriteCheckpoint(_ context.Context, newCPRaw []byte) error {
 	oPath := filepath.Join(fs.rootDir, layout.CheckpointPath)
-	tmp := fmt.Sprintf("%s.tmp", oPath)
-	if err := createExclusive(tmp, newCPRaw); err != nil {
+	start := time.Now()
+	tmp, err := writeTemp(fs.rootDir, layout.CheckpointPath+".*.tmp", newCPRaw)
+	if err != nil {
+		fs.observeWrite(oPath, len(newCPRaw), start, err)
 		return fmt.Errorf("failed to create temporary checkpoint file: %w", err)
 	}
-	return os.Rename(tmp, oPath)
+	err = os.Rename(tmp, oPath)
+	fs.observeWrite(oPath, len(newCPRaw), start, err)
+	return err
+}
+
+// WriteJournal durably stores the journal of an in-progress integration,
+// replacing any existing journal.
+func (fs *Storage) WriteJournal(_ context.Context, raw []byte) error {
+	p := filepath.Join(fs.rootDir, journalFile)
+	start := time.Now()
+	tmp, err := writeTemp(fs.rootDir, journalFile+".*.tmp", raw)
+	if err != nil {
+		fs.observeWrite(p, len(raw), start, err)
+		return fmt.Errorf("failed to create temporary journal file: %w", err)
+	}
+	err = os.Rename(tmp, p)
+	fs.observeWrite(p, len(raw), start, err)
+	return err
+}
+
+// ReadJournal returns the journal of an in-progress integration, or an error
+// wrapping os.ErrNotExist if there is none.
+func (fs *Storage) ReadJournal(_ context.Context) ([]byte, error) {
+	return fs.readFile(filepath.Join(fs.rootDir, journalFile))
+}
+
+// DeleteJournal removes the journal of an in-progress integration, if any.
+func (fs *Storage) DeleteJournal(_ context.Context) error {
+	if err := os.Remove(filepath.Join(fs.rootDir, journalFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete journal: %w", err)
+	}
+	return nil
 }
 
 // ReadCheckpoint reads and returns the contents of the log checkpoint file.
@@ -334,3 +833,61 @@ func ReadCheckpoint(rootDir string) ([]byte, error) {
 	s := filepath.Join(rootDir, layout.CheckpointPath)
 	return os.ReadFile(s)
 }
+
+// ArchiveCheckpoint stores a copy of a raw log checkpoint for a tree of the
+// given size in the log's checkpoint archive, see api/layout/README.md.
+// Archived checkpoints are never replaced, so if the archive already holds a
+// checkpoint for this size it is left unchanged.
+//
+// Callers should archive each checkpoint before writing it with
+// WriteCheckpoint, so that every checkpoint published by the log is archived.
+func (fs *Storage) ArchiveCheckpoint(_ context.Context, size uint64, cpRaw []byte) error {
+	dir, file := layout.CheckpointArchivePath(fs.rootDir, size)
+	p := filepath.Join(dir, file)
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return fmt.Errorf("failed to create directory %q: %w", dir, err)
+	}
+	start := time.Now()
+	tmp, err := writeTemp(dir, file+".*.tmp", cpRaw)
+	if err != nil {
+		fs.observeWrite(p, len(cpRaw), start, err)
+		return fmt.Errorf("failed to create temporary checkpoint file: %w", err)
+	}
+	defer func() {
+		if err := os.Remove(tmp); err != nil {
+			klog.Errorf("os.Remove(): %v", err)
+		}
+	}()
+	err = os.Link(tmp, p)
+	fs.observeWrite(p, len(cpRaw), start, err)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("failed to link archived checkpoint in place: %w", err)
+	}
+	return nil
+}
+
+// ReadArchivedCheckpoint reads and returns the archived log checkpoint for a
+// tree of the given size, see ArchiveCheckpoint.
+func ReadArchivedCheckpoint(rootDir string, size uint64) ([]byte, error) {
+	return os.ReadFile(filepath.Join(layout.CheckpointArchivePath(rootDir, size)))
+}
+
+// ReadBundleSize returns the bundle size recorded by the log at rootDir, i.e.
+// the number of leaves stored in each file under seq/, or 1 if the log has not
+// recorded a bundle size, see WithBundleSize.
+func ReadBundleSize(rootDir string) (uint64, error) {
+	raw, err := os.ReadFile(filepath.Join(rootDir, layout.BundleSizePath))
+	if errors.Is(err, os.ErrNotExist) {
+		return 1, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read bundle size: %w", err)
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid bundle size %q", raw)
+	}
+	return n, nil
+}
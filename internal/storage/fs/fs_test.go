@@ -15,15 +15,28 @@
 package fs
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"github.com/transparency-dev/serverless-log/client"
+	"github.com/transparency-dev/serverless-log/internal/compress"
+	"github.com/transparency-dev/serverless-log/internal/encrypt"
 	"github.com/transparency-dev/serverless-log/pkg/log"
+
+	fmtlog "github.com/transparency-dev/formats/log"
 )
 
 func TestCreate(t *testing.T) {
@@ -133,6 +146,45 @@ func TestSequence(t *testing.T) {
 	}
 }
 
+func TestCountSequenced(t *testing.T) {
+	ctx := context.Background()
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		leaf := []byte{byte(i)}
+		h := sha256.Sum256(leaf)
+		if _, err := s.Sequence(ctx, h[:], leaf); err != nil {
+			t.Fatalf("Sequence = %v", err)
+		}
+	}
+	for _, test := range []struct {
+		desc  string
+		begin uint64
+		want  uint64
+	}{
+		{desc: "all", want: 5},
+		{desc: "some", begin: 3, want: 2},
+		{desc: "none", begin: 5},
+		{desc: "beyond end", begin: 10},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := CountSequenced(d, test.begin)
+			if err != nil {
+				t.Fatalf("CountSequenced = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("CountSequenced = %d, want %d", got, test.want)
+			}
+			if got, err := Sequenced(d, test.begin); err != nil || got != (test.want > 0) {
+				t.Errorf("Sequenced = %t, %v, want %t", got, err, test.want > 0)
+			}
+		})
+	}
+}
+
 func TestAssign(t *testing.T) {
 	ctx := context.Background()
 
@@ -209,3 +261,1124 @@ func TestAssign(t *testing.T) {
 	}
 
 }
+
+func TestLeafIndex(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+
+	sequenced, assigned := []byte("sequenced"), []byte("assigned")
+	if _, err := s.Sequence(ctx, h.HashLeaf(sequenced), sequenced); err != nil {
+		t.Fatalf("Sequence = %v", err)
+	}
+	// Assigning a leaf directly bypasses the index, as would a crash during
+	// Sequence, until it's integrated.
+	if err := s.Assign(ctx, 1, assigned); err != nil {
+		t.Fatalf("Assign = %v", err)
+	}
+	if idx, err := s.LeafIndex(ctx, h.HashLeaf(sequenced)); err != nil || idx != 0 {
+		t.Errorf("LeafIndex(sequenced) = %d, %v, want 0", idx, err)
+	}
+	if _, err := s.LeafIndex(ctx, h.HashLeaf(assigned)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LeafIndex(assigned) before Integrate = %v, want not exists error", err)
+	}
+
+	if _, err := log.Integrate(ctx, 0, s, h); err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+	if idx, err := s.LeafIndex(ctx, h.HashLeaf(assigned)); err != nil || idx != 1 {
+		t.Errorf("LeafIndex(assigned) after Integrate = %d, %v, want 1", idx, err)
+	}
+	if seq, err := s.Sequence(ctx, h.HashLeaf(assigned), assigned); !errors.Is(err, log.ErrDupeLeaf) || seq != 1 {
+		t.Errorf("Sequence(assigned) = %d, %v, want 1, %v", seq, err, log.ErrDupeLeaf)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+
+	for _, a := range []compress.Algorithm{compress.Gzip, compress.Zstd} {
+		t.Run(string(a), func(t *testing.T) {
+			d := filepath.Join(t.TempDir(), "storage")
+			s, err := Create(d, WithCompression(a))
+			if err != nil {
+				t.Fatalf("Create = %v", err)
+			}
+			var size uint64
+			for _, n := range []uint64{3, 5} {
+				for i := size; i < size+n; i++ {
+					leaf := []byte(fmt.Sprintf("leaf %d", i))
+					if _, err := s.Sequence(ctx, h.HashLeaf(leaf), leaf); err != nil {
+						t.Fatalf("Sequence = %v", err)
+					}
+				}
+				// Integrating the second batch reads back the compressed
+				// partial tile stored by the first.
+				cp, err := log.Integrate(ctx, size, s, h)
+				if err != nil {
+					t.Fatalf("Integrate = %v", err)
+				}
+				size = cp.Size
+			}
+
+			raw, err := os.ReadFile(filepath.Join(layout.SeqPath(d, 4)))
+			if err != nil {
+				t.Fatalf("ReadFile = %v", err)
+			}
+			if bytes.Equal(raw, []byte("leaf 4")) {
+				t.Fatal("Leaf data was stored uncompressed")
+			}
+			if got, err := compress.Decompress(raw); err != nil || string(got) != "leaf 4" {
+				t.Errorf("Decompress(leaf 4) = %q, %v", got, err)
+			}
+			tile, err := s.GetTile(ctx, 0, 0, size)
+			if err != nil {
+				t.Fatalf("GetTile = %v", err)
+			}
+			if got, want := tile.Nodes[api.TileNodeKey(0, 4)], h.HashLeaf([]byte("leaf 4")); !bytes.Equal(got, want) {
+				t.Errorf("Got leaf hash %x from tile, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	newEncrypter := func(t *testing.T) *encrypt.Encrypter {
+		t.Helper()
+		k, err := encrypt.GenerateLocalKey("kek")
+		if err != nil {
+			t.Fatalf("GenerateLocalKey = %v", err)
+		}
+		ks, err := encrypt.ParseLocalKeys(k)
+		if err != nil {
+			t.Fatalf("ParseLocalKeys = %v", err)
+		}
+		return encrypt.New(ks)
+	}
+	e := newEncrypter(t)
+
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d, WithCompression(compress.Gzip), WithEncryption(e))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		leaf := []byte(fmt.Sprintf("leaf %d", i))
+		if _, err := s.Sequence(ctx, h.HashLeaf(leaf), leaf); err != nil {
+			t.Fatalf("Sequence = %v", err)
+		}
+	}
+	ref, err := s.StoreBlob(ctx, []byte("private blob"))
+	if err != nil {
+		t.Fatalf("StoreBlob = %v", err)
+	}
+	cp, err := log.Integrate(ctx, 0, s, h)
+	if err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+	tile, err := s.GetTile(ctx, 0, 0, cp.Size)
+	if err != nil {
+		t.Fatalf("GetTile = %v", err)
+	}
+	if got, want := tile.Nodes[api.TileNodeKey(0, 2)], h.HashLeaf([]byte("leaf 2")); !bytes.Equal(got, want) {
+		t.Errorf("Got leaf hash %x from tile, want hash of plaintext leaf %x", got, want)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(layout.SeqPath(d, 2)))
+	if err != nil {
+		t.Fatalf("ReadFile = %v", err)
+	}
+	if !api.IsEnvelope(raw) {
+		t.Fatalf("Leaf data was stored unencrypted: %q", raw)
+	}
+	if got, err := s.ReadBlob(ctx, ref); err != nil || string(got) != "private blob" {
+		t.Errorf("ReadBlob = %q, %v", got, err)
+	}
+
+	for _, test := range []struct {
+		desc    string
+		opts    []Option
+		wantErr bool
+	}{
+		{
+			desc: "same key",
+			opts: []Option{WithCompression(compress.Gzip), WithEncryption(e)},
+		}, {
+			desc:    "different key",
+			opts:    []Option{WithCompression(compress.Gzip), WithEncryption(newEncrypter(t))},
+			wantErr: true,
+		}, {
+			desc:    "no key",
+			opts:    []Option{WithCompression(compress.Gzip)},
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			s, err := Load(d, 0, test.opts...)
+			if err != nil {
+				t.Fatalf("Load = %v", err)
+			}
+			var leaves []string
+			_, err = s.ScanSequenced(ctx, 0, func(_ uint64, entry []byte) error {
+				leaves = append(leaves, string(entry))
+				return nil
+			})
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ScanSequenced = %v, want err %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff([]string{"leaf 0", "leaf 1", "leaf 2"}, leaves); diff != "" {
+				t.Errorf("ScanSequenced diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestRebundle(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	s, err := Create(src, WithCompression(compress.Gzip))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	const size = 10
+	leaves := make([][]byte, size)
+	for i := range leaves {
+		leaves[i] = []byte(fmt.Sprintf("leaf %d", i))
+		if _, err := s.Sequence(ctx, h.HashLeaf(leaves[i]), leaves[i]); err != nil {
+			t.Fatalf("Sequence = %v", err)
+		}
+	}
+	cp, err := log.Integrate(ctx, 0, s, h)
+	if err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+	if err := s.ArchiveCheckpoint(ctx, cp.Size, []byte("checkpoint")); err != nil {
+		t.Fatalf("ArchiveCheckpoint = %v", err)
+	}
+	if err := s.WriteCheckpoint(ctx, []byte("checkpoint")); err != nil {
+		t.Fatalf("WriteCheckpoint = %v", err)
+	}
+	fetcher := func(dir string) client.Fetcher {
+		return client.DecompressingFetcher(func(_ context.Context, p string) ([]byte, error) {
+			return os.ReadFile(filepath.Join(dir, p))
+		})
+	}
+
+	if err := Rebundle(ctx, src, filepath.Join(root, "bad"), cp.Size, []byte("wrong"), 4, h, WithCompression(compress.Gzip)); err == nil {
+		t.Error("Rebundle with wrong root hash: got no error")
+	}
+
+	// Migrate to a larger bundle size, and back again.
+	dir := src
+	for _, bundleSize := range []uint64{4, 3, 1} {
+		dst := filepath.Join(root, fmt.Sprintf("bundle-%d", bundleSize))
+		if err := Rebundle(ctx, dir, dst, cp.Size, cp.Hash, bundleSize, h, WithCompression(compress.Gzip)); err != nil {
+			t.Fatalf("Rebundle(%d) = %v", bundleSize, err)
+		}
+		dir = dst
+		f := fetcher(dir)
+		gotSize, err := client.DiscoverBundleSize(ctx, f)
+		if err != nil || gotSize != bundleSize {
+			t.Fatalf("DiscoverBundleSize = %d, %v, want %d", gotSize, err, bundleSize)
+		}
+		pb, err := client.NewProofBuilder(ctx, *cp, h.HashChildren, f)
+		if err != nil {
+			t.Fatalf("NewProofBuilder = %v", err)
+		}
+		for i, want := range leaves {
+			got, err := client.ServerlessLayout{BundleSize: bundleSize}.GetLeaf(ctx, f, uint64(i), cp.Size)
+			if err != nil || !bytes.Equal(got, want) {
+				t.Fatalf("GetLeaf(%d) = %q, %v, want %q", i, got, err, want)
+			}
+			if _, err := pb.InclusionProof(ctx, uint64(i)); err != nil {
+				t.Errorf("InclusionProof(%d) = %v", i, err)
+			}
+		}
+		if idx, err := client.LookupIndex(ctx, f, h.HashLeaf(leaves[7])); err != nil || idx != 7 {
+			t.Errorf("LookupIndex = %d, %v, want 7", idx, err)
+		}
+		if got, err := ReadArchivedCheckpoint(dir, cp.Size); err != nil || string(got) != "checkpoint" {
+			t.Errorf("ReadArchivedCheckpoint = %q, %v", got, err)
+		}
+		if _, err := Load(dir, cp.Size, WithBundleSize(bundleSize)); err != nil {
+			t.Errorf("Load with bundle size %d = %v", bundleSize, err)
+		}
+		if _, err := Load(dir, cp.Size, WithBundleSize(bundleSize+1)); err == nil {
+			t.Errorf("Load with bundle size %d: got no error", bundleSize+1)
+		}
+	}
+
+	// The rebundled log can be extended again.
+	s, err = Load(dir, cp.Size, WithCompression(compress.Gzip))
+	if err != nil {
+		t.Fatalf("Load = %v", err)
+	}
+	if seq, err := s.Sequence(ctx, h.HashLeaf([]byte("new")), []byte("new")); err != nil || seq != size {
+		t.Fatalf("Sequence = %d, %v, want %d", seq, err, size)
+	}
+	if _, err := log.Integrate(ctx, cp.Size, s, h); err != nil {
+		t.Errorf("Integrate = %v", err)
+	}
+}
+
+func TestBundledLog(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	open := func(raw []byte) (*fmtlog.Checkpoint, error) {
+		cp := &fmtlog.Checkpoint{}
+		_, err := cp.Unmarshal(raw)
+		return cp, err
+	}
+	const bundleSize = 4
+	d := filepath.Join(t.TempDir(), "storage")
+	if _, err := Create(d, WithBundleSize(bundleSize), WithCompression(compress.Gzip)); err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	f := client.DecompressingFetcher(func(_ context.Context, p string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(d, p))
+	})
+	if got, err := client.DiscoverBundleSize(ctx, f); err != nil || got != bundleSize {
+		t.Fatalf("DiscoverBundleSize = %d, %v, want %d", got, err, bundleSize)
+	}
+
+	// Grow the log from full and partial bundles, checking that every leaf
+	// can be read back after each integration.
+	var leaves [][]byte
+	size := uint64(0)
+	for _, n := range []uint64{10, 3, 1, 6} {
+		s, err := Load(d, size, WithCompression(compress.Gzip))
+		if err != nil {
+			t.Fatalf("Load = %v", err)
+		}
+		for i := size; i < size+n; i++ {
+			leaf := []byte(fmt.Sprintf("leaf %d", i))
+			if seq, err := s.Sequence(ctx, h.HashLeaf(leaf), leaf); err != nil || seq != i {
+				t.Fatalf("Sequence = %d, %v, want %d", seq, err, i)
+			}
+			leaves = append(leaves, leaf)
+		}
+		if got, err := CountSequenced(d, size); err != nil || got != n {
+			t.Fatalf("CountSequenced = %d, %v, want %d", got, err, n)
+		}
+		cp, err := log.Integrate(ctx, size, s, h)
+		if err != nil {
+			t.Fatalf("Integrate = %v", err)
+		}
+		if err := s.WriteBundles(ctx, size, cp.Size); err != nil {
+			t.Fatalf("WriteBundles = %v", err)
+		}
+		cp.Origin = "test"
+		if err := s.ArchiveCheckpoint(ctx, cp.Size, cp.Marshal()); err != nil {
+			t.Fatalf("ArchiveCheckpoint = %v", err)
+		}
+		if err := s.WriteCheckpoint(ctx, cp.Marshal()); err != nil {
+			t.Fatalf("WriteCheckpoint = %v", err)
+		}
+		if err := s.RemoveStaged(ctx, size, cp.Size); err != nil {
+			t.Fatalf("RemoveStaged = %v", err)
+		}
+		size = cp.Size
+
+		got, err := client.GetLeaves(ctx, f, client.ServerlessLayout{BundleSize: bundleSize}, 0, size, size, 1)
+		if err != nil {
+			t.Fatalf("GetLeaves = %v", err)
+		}
+		if diff := cmp.Diff(leaves, got); diff != "" {
+			t.Errorf("GetLeaves diff at size %d: %s", size, diff)
+		}
+		r, err := Verify(ctx, d, open, h, WithCompression(compress.Gzip))
+		if err != nil {
+			t.Fatalf("Verify = %v", err)
+		}
+		if len(r.Problems) > 0 || r.Size != size {
+			t.Errorf("Verify = %+v, want size %d and no problems", r, size)
+		}
+		if _, err := os.Stat(filepath.Join(sequencedPath(d, bundleSize, size-1))); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Stat of staged entry %d = %v, want removed", size-1, err)
+		}
+		if ok, err := Sequenced(d, size-1); err != nil || !ok {
+			t.Errorf("Sequenced(%d) = %t, %v, want true", size-1, ok, err)
+		}
+	}
+
+	// Integrated entries can't be sequenced again, even though their staged
+	// copies have been removed.
+	s, err := Load(d, 0)
+	if err != nil {
+		t.Fatalf("Load = %v", err)
+	}
+	if err := s.Assign(ctx, size-3, []byte("dupe")); !errors.Is(err, log.ErrSeqAlreadyAssigned) {
+		t.Errorf("Assign of integrated entry = %v, want %v", err, log.ErrSeqAlreadyAssigned)
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+	d := filepath.Join(t.TempDir(), "storage")
+	if _, err := Create(d); err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	unlock, err := AcquireLock(d, IntegrateLock)
+	if err != nil {
+		t.Fatalf("AcquireLock = %v", err)
+	}
+
+	// A different lock can be held at the same time.
+	unlockSeq, err := AcquireLock(d, SequenceLock)
+	if err != nil {
+		t.Fatalf("AcquireLock(SequenceLock) = %v", err)
+	}
+	if err := unlockSeq(); err != nil {
+		t.Fatalf("unlock = %v", err)
+	}
+
+	acquired := make(chan func() error)
+	go func() {
+		u, err := AcquireLock(d, IntegrateLock)
+		if err != nil {
+			t.Errorf("AcquireLock = %v", err)
+		}
+		acquired <- u
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("AcquireLock returned while lock was held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock = %v", err)
+	}
+	if u := <-acquired; u != nil {
+		if err := u(); err != nil {
+			t.Fatalf("unlock = %v", err)
+		}
+	}
+}
+
+func TestTryLock(t *testing.T) {
+	d := filepath.Join(t.TempDir(), "storage")
+	if _, err := Create(d); err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	unlock, err := TryLock(d, SequenceLock)
+	if err != nil {
+		t.Fatalf("TryLock = %v", err)
+	}
+	if _, err := TryLock(d, SequenceLock); !errors.Is(err, ErrLocked) {
+		t.Fatalf("TryLock while held = %v, want %v", err, ErrLocked)
+	}
+	// A different lock can be held at the same time.
+	unlockInt, err := TryLock(d, IntegrateLock)
+	if err != nil {
+		t.Fatalf("TryLock(IntegrateLock) = %v", err)
+	}
+	if err := unlockInt(); err != nil {
+		t.Fatalf("unlock = %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock = %v", err)
+	}
+	unlock, err = TryLock(d, SequenceLock)
+	if err != nil {
+		t.Fatalf("TryLock after unlock = %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock = %v", err)
+	}
+}
+
+func TestStaleTemporaryFiles(t *testing.T) {
+	ctx := context.Background()
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	// Simulate files left behind by a crashed process.
+	leaf := []byte("leaf")
+	for _, p := range []string{
+		filepath.Join(d, fmt.Sprintf("leaves/pending/%0x", sha256.Sum256(leaf))),
+		filepath.Join(d, "checkpoint.tmp"),
+	} {
+		if err := os.WriteFile(p, []byte("stale"), 0644); err != nil {
+			t.Fatalf("WriteFile = %v", err)
+		}
+	}
+
+	h := sha256.Sum256(leaf)
+	if _, err := s.Sequence(ctx, h[:], leaf); err != nil {
+		t.Errorf("Sequence = %v", err)
+	}
+	if err := s.WriteCheckpoint(ctx, []byte("cp")); err != nil {
+		t.Errorf("WriteCheckpoint = %v", err)
+	}
+	if got, err := ReadCheckpoint(d); err != nil || string(got) != "cp" {
+		t.Errorf("ReadCheckpoint = %q, %v", got, err)
+	}
+}
+
+func TestGCPending(t *testing.T) {
+	ctx := context.Background()
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	h := rfc6962.DefaultHasher
+	pending := func(leaf string) string {
+		return filepath.Join(d, fmt.Sprintf("leaves/pending/%0x.stale", sha256.Sum256([]byte(leaf))))
+	}
+	// Sequence a leaf, then simulate files left behind by crashed or failed
+	// sequencing runs.
+	seq := []byte("sequenced")
+	if _, err := s.Sequence(ctx, h.HashLeaf(seq), seq); err != nil {
+		t.Fatalf("Sequence = %v", err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	for _, leaf := range []string{"sequenced", "old", "new"} {
+		p := pending(leaf)
+		if err := os.WriteFile(p, []byte(leaf), 0644); err != nil {
+			t.Fatalf("WriteFile = %v", err)
+		}
+		if leaf == "old" {
+			if err := os.Chtimes(p, old, old); err != nil {
+				t.Fatalf("Chtimes = %v", err)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		desc      string
+		ttl       time.Duration
+		want      int
+		wantExist []string
+	}{
+		{
+			desc:      "no ttl",
+			want:      1,
+			wantExist: []string{"old", "new"},
+		}, {
+			desc:      "ttl",
+			ttl:       time.Hour,
+			want:      1,
+			wantExist: []string{"new"},
+		}, {
+			desc:      "nothing to remove",
+			ttl:       time.Hour,
+			wantExist: []string{"new"},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			n, err := s.GCPending(ctx, h, test.ttl)
+			if err != nil {
+				t.Fatalf("GCPending = %v", err)
+			}
+			if n != test.want {
+				t.Errorf("GCPending removed %d files, want %d", n, test.want)
+			}
+			entries, err := os.ReadDir(filepath.Join(d, leavesPendingDir))
+			if err != nil {
+				t.Fatalf("ReadDir = %v", err)
+			}
+			if got, want := len(entries), len(test.wantExist); got != want {
+				t.Errorf("Got %d pending files, want %d", got, want)
+			}
+			for _, l := range test.wantExist {
+				if _, err := os.Stat(pending(l)); err != nil {
+					t.Errorf("Stat(%q) = %v", l, err)
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	for _, test := range []struct {
+		desc string
+		size uint64
+		cp   string
+		want string
+	}{
+		{
+			desc: "empty tree",
+			size: 0,
+			cp:   "cp0",
+			want: "cp0",
+		}, {
+			desc: "new size",
+			size: 10,
+			cp:   "cp10",
+			want: "cp10",
+		}, {
+			desc: "existing size is not replaced",
+			size: 10,
+			cp:   "other cp10",
+			want: "cp10",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if err := s.ArchiveCheckpoint(ctx, test.size, []byte(test.cp)); err != nil {
+				t.Fatalf("ArchiveCheckpoint = %v", err)
+			}
+			got, err := ReadArchivedCheckpoint(d, test.size)
+			if err != nil {
+				t.Fatalf("ReadArchivedCheckpoint = %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("ReadArchivedCheckpoint = %q, want %q", got, test.want)
+			}
+		})
+	}
+	if _, err := ReadArchivedCheckpoint(d, 5); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadArchivedCheckpoint(5) = %v, want %v", err, os.ErrNotExist)
+	}
+	entries, err := os.ReadDir(filepath.Join(d, "checkpoints"))
+	if err != nil {
+		t.Fatalf("ReadDir = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Got %d files in archive, want 2", len(entries))
+	}
+}
+
+func TestJournal(t *testing.T) {
+	ctx := context.Background()
+	s, err := Create(filepath.Join(t.TempDir(), "storage"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	if _, err := s.ReadJournal(ctx); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("ReadJournal = %v, want %v", err, os.ErrNotExist)
+	}
+	for _, j := range []string{"one", "two"} {
+		if err := s.WriteJournal(ctx, []byte(j)); err != nil {
+			t.Fatalf("WriteJournal = %v", err)
+		}
+		got, err := s.ReadJournal(ctx)
+		if err != nil {
+			t.Fatalf("ReadJournal = %v", err)
+		}
+		if string(got) != j {
+			t.Errorf("ReadJournal = %q, want %q", got, j)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.DeleteJournal(ctx); err != nil {
+			t.Fatalf("DeleteJournal = %v", err)
+		}
+	}
+	if _, err := s.ReadJournal(ctx); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("ReadJournal after DeleteJournal = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestStoreBlob(t *testing.T) {
+	ctx := context.Background()
+	for _, a := range []compress.Algorithm{compress.None, compress.Zstd} {
+		t.Run(fmt.Sprintf("compression %q", a), func(t *testing.T) {
+			d := filepath.Join(t.TempDir(), "storage")
+			s, err := Create(d, WithCompression(a))
+			if err != nil {
+				t.Fatalf("Create = %v", err)
+			}
+			blob := bytes.Repeat([]byte("blob"), 1<<16)
+			// Storing the same blob twice returns the same reference.
+			for i := 0; i < 2; i++ {
+				ref, err := s.StoreBlob(ctx, blob)
+				if err != nil {
+					t.Fatalf("StoreBlob = %v", err)
+				}
+				if want := api.NewBlobRef(blob); !bytes.Equal(ref.Hash, want.Hash) || ref.Size != want.Size {
+					t.Fatalf("StoreBlob = %+v, want %+v", ref, want)
+				}
+			}
+			f := func(_ context.Context, p string) ([]byte, error) {
+				return os.ReadFile(filepath.Join(d, p))
+			}
+			got, err := client.FetchBlob(ctx, client.DecompressingFetcher(f), api.NewBlobRef(blob))
+			if err != nil {
+				t.Fatalf("FetchBlob = %v", err)
+			}
+			if !bytes.Equal(got, blob) {
+				t.Error("FetchBlob returned different contents")
+			}
+			if got, err := s.ReadBlob(ctx, api.NewBlobRef(blob)); err != nil || !bytes.Equal(got, blob) {
+				t.Errorf("ReadBlob = %d bytes, %v, want %d bytes", len(got), err, len(blob))
+			}
+			if _, err := s.ReadBlob(ctx, api.NewBlobRef([]byte("not stored"))); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("ReadBlob(not stored) = %v, want %v", err, os.ErrNotExist)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	const size = 10
+	blob := []byte("a large leaf")
+	for i := 0; i < size; i++ {
+		leaf := []byte(fmt.Sprintf("leaf %d", i))
+		if i == 2 {
+			ref, err := s.StoreBlob(ctx, blob)
+			if err != nil {
+				t.Fatalf("StoreBlob = %v", err)
+			}
+			if leaf, err = ref.MarshalText(); err != nil {
+				t.Fatalf("MarshalText = %v", err)
+			}
+		}
+		if _, err := s.Sequence(ctx, h.HashLeaf(leaf), leaf); err != nil {
+			t.Fatalf("Sequence = %v", err)
+		}
+	}
+	cp, err := log.Integrate(ctx, 0, s, h)
+	if err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+	cp.Origin = "test"
+	if err := s.WriteCheckpoint(ctx, cp.Marshal()); err != nil {
+		t.Fatalf("WriteCheckpoint = %v", err)
+	}
+
+	if _, err := Prune(ctx, d, size+1, size); err == nil {
+		t.Error("Prune beyond log size: got no error")
+	}
+	for _, test := range []struct {
+		size, want uint64
+	}{
+		{size: 5, want: 5},
+		// The pruned prefix never shrinks.
+		{size: 3, want: 5},
+	} {
+		got, err := Prune(ctx, d, test.size, size)
+		if err != nil || got != test.want {
+			t.Fatalf("Prune(%d) = %d, %v, want %d", test.size, got, err, test.want)
+		}
+		if got, err := ReadPrunedSize(d); err != nil || got != test.want {
+			t.Fatalf("ReadPrunedSize = %d, %v, want %d", got, err, test.want)
+		}
+	}
+	if _, err := s.ReadBlob(ctx, api.NewBlobRef(blob)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadBlob of pruned blob = %v, want %v", err, os.ErrNotExist)
+	}
+
+	f := func(_ context.Context, p string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(d, p))
+	}
+	for i := uint64(0); i < size; i++ {
+		_, err := client.GetLeaf(ctx, f, i)
+		if got, want := errors.Is(err, client.ErrLeafPruned), i < 5; got != want {
+			t.Errorf("GetLeaf(%d) = %v, want pruned %t", i, err, want)
+		}
+	}
+	pb, err := client.NewProofBuilder(ctx, *cp, h.HashChildren, f)
+	if err != nil {
+		t.Fatalf("NewProofBuilder = %v", err)
+	}
+	if _, err := pb.InclusionProof(ctx, 0); err != nil {
+		t.Errorf("InclusionProof(0) = %v", err)
+	}
+
+	open := func(raw []byte) (*fmtlog.Checkpoint, error) {
+		cp := &fmtlog.Checkpoint{}
+		_, err := cp.Unmarshal(raw)
+		return cp, err
+	}
+	r, err := Verify(ctx, d, open, h)
+	if err != nil {
+		t.Fatalf("Verify = %v", err)
+	}
+	if len(r.Problems) > 0 || r.Pruned != 5 || r.Bundles != 5 {
+		t.Errorf("Verify = %+v, want %d bundles checked and no problems", r, 5)
+	}
+	if err := Rebundle(ctx, d, filepath.Join(t.TempDir(), "rebundled"), cp.Size, cp.Hash, 4, h); err == nil {
+		t.Error("Rebundle of pruned log: got no error")
+	}
+}
+
+func TestPruneBundles(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	s, err := Create(src)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	const size = 10
+	for i := 0; i < size; i++ {
+		leaf := []byte(fmt.Sprintf("leaf %d", i))
+		if _, err := s.Sequence(ctx, h.HashLeaf(leaf), leaf); err != nil {
+			t.Fatalf("Sequence = %v", err)
+		}
+	}
+	cp, err := log.Integrate(ctx, 0, s, h)
+	if err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+	if err := s.WriteCheckpoint(ctx, []byte("checkpoint")); err != nil {
+		t.Fatalf("WriteCheckpoint = %v", err)
+	}
+	d := filepath.Join(root, "bundled")
+	if err := Rebundle(ctx, src, d, cp.Size, cp.Hash, 4, h); err != nil {
+		t.Fatalf("Rebundle = %v", err)
+	}
+
+	// Only whole bundles are pruned.
+	if got, err := Prune(ctx, d, 7, size); err != nil || got != 4 {
+		t.Fatalf("Prune(7) = %d, %v, want 4", got, err)
+	}
+	f := func(_ context.Context, p string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(d, p))
+	}
+	l := client.ServerlessLayout{BundleSize: 4}
+	for i := uint64(0); i < size; i++ {
+		_, err := l.GetLeaf(ctx, f, i, size)
+		if got, want := errors.Is(err, client.ErrLeafPruned), i < 4; got != want {
+			t.Errorf("GetLeaf(%d) = %v, want pruned %t", i, err, want)
+		}
+	}
+}
+
+func TestRetentionSize(t *testing.T) {
+	ctx := context.Background()
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	now := time.Now()
+	for _, a := range []struct {
+		size uint64
+		age  time.Duration
+	}{
+		{size: 3, age: 48 * time.Hour},
+		{size: 7, age: 25 * time.Hour},
+		{size: 12, age: time.Hour},
+	} {
+		if err := s.ArchiveCheckpoint(ctx, a.size, []byte("checkpoint")); err != nil {
+			t.Fatalf("ArchiveCheckpoint = %v", err)
+		}
+		mtime := now.Add(-a.age)
+		if err := os.Chtimes(filepath.Join(layout.CheckpointArchivePath(d, a.size)), mtime, mtime); err != nil {
+			t.Fatalf("Chtimes = %v", err)
+		}
+	}
+	for _, test := range []struct {
+		retention time.Duration
+		want      uint64
+	}{
+		{retention: 72 * time.Hour, want: 0},
+		{retention: 30 * time.Hour, want: 3},
+		{retention: 24 * time.Hour, want: 7},
+		{retention: 0, want: 12},
+	} {
+		if got, err := RetentionSize(d, now.Add(-test.retention)); err != nil || got != test.want {
+			t.Errorf("RetentionSize(%v) = %d, %v, want %d", test.retention, got, err, test.want)
+		}
+	}
+}
+
+func TestAddShard(t *testing.T) {
+	d := filepath.Join(t.TempDir(), "sharded")
+	if idx, err := ReadShardIndex(d); err != nil || len(idx.Shards) != 0 {
+		t.Fatalf("ReadShardIndex() = %v, %v, want empty index", idx, err)
+	}
+	q2 := api.ShardQuarterly.Shard("example.com/log", time.Date(2025, time.May, 1, 0, 0, 0, 0, time.UTC))
+	q1 := api.ShardQuarterly.Shard("example.com/log", time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC))
+	for _, s := range []api.Shard{q2, q1} {
+		dir, err := AddShard(d, s)
+		if err != nil {
+			t.Fatalf("AddShard(%s) = %v", s.Name, err)
+		}
+		if want := filepath.Join(d, s.Name); dir != want {
+			t.Errorf("AddShard(%s) = %q, want %q", s.Name, dir, want)
+		}
+		if _, err := Create(dir); err != nil {
+			t.Fatalf("Create(%q) = %v", dir, err)
+		}
+	}
+	if _, err := AddShard(d, q1); err == nil {
+		t.Error("AddShard() of existing shard: got no error")
+	}
+	idx, err := ReadShardIndex(d)
+	if err != nil {
+		t.Fatalf("ReadShardIndex() = %v", err)
+	}
+	if diff := cmp.Diff([]api.Shard{q1, q2}, idx.Shards); diff != "" {
+		t.Errorf("ReadShardIndex() diff: %s", diff)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	open := func(raw []byte) (*fmtlog.Checkpoint, error) {
+		cp := &fmtlog.Checkpoint{}
+		_, err := cp.Unmarshal(raw)
+		return cp, err
+	}
+	writeCheckpoint := func(t *testing.T, s *Storage, cp fmtlog.Checkpoint) {
+		t.Helper()
+		cp.Origin = "test"
+		if err := s.ArchiveCheckpoint(ctx, cp.Size, cp.Marshal()); err != nil {
+			t.Fatalf("ArchiveCheckpoint = %v", err)
+		}
+		if err := s.WriteCheckpoint(ctx, cp.Marshal()); err != nil {
+			t.Fatalf("WriteCheckpoint = %v", err)
+		}
+	}
+	// integrate sequences and integrates n new leaves, returning the new
+	// checkpoint.
+	integrate := func(t *testing.T, s *Storage, size, n uint64) fmtlog.Checkpoint {
+		t.Helper()
+		for i := size; i < size+n; i++ {
+			leaf := []byte(fmt.Sprintf("leaf %d", i))
+			if _, err := s.Sequence(ctx, h.HashLeaf(leaf), leaf); err != nil {
+				t.Fatalf("Sequence = %v", err)
+			}
+		}
+		cp, err := log.Integrate(ctx, size, s, h)
+		if err != nil {
+			t.Fatalf("Integrate = %v", err)
+		}
+		return *cp
+	}
+
+	for _, test := range []struct {
+		desc   string
+		modify func(t *testing.T, d string, s *Storage)
+		want   []string
+	}{
+		{
+			desc: "valid log",
+		}, {
+			desc: "missing leaf",
+			modify: func(t *testing.T, d string, _ *Storage) {
+				if err := os.Remove(filepath.Join(layout.SeqPath(d, 5))); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"missing seq/00/00/00/00/05"},
+		}, {
+			desc: "corrupt leaf",
+			modify: func(t *testing.T, d string, _ *Storage) {
+				if err := os.WriteFile(filepath.Join(layout.SeqPath(d, 299)), []byte("bad"), filePerm); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"corrupt tile/00/0000/00/00/01.2c", "corrupt checkpoint", "corrupt checkpoints/300"},
+		}, {
+			desc: "missing leaf and tile",
+			modify: func(t *testing.T, d string, _ *Storage) {
+				for _, p := range []string{filepath.Join(layout.SeqPath(d, 5)), filepath.Join(layout.TilePath(d, 0, 0, 0))} {
+					if err := os.Remove(p); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			want: []string{"missing seq/00/00/00/00/05", "missing seq/00/00/00/00/05"},
+		}, {
+			desc: "missing tile",
+			modify: func(t *testing.T, d string, _ *Storage) {
+				if err := os.Remove(filepath.Join(layout.TilePath(d, 0, 1, 44))); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"missing tile/00/0000/00/00/01.2c"},
+		}, {
+			desc: "corrupt tile",
+			modify: func(t *testing.T, d string, s *Storage) {
+				tile, err := s.GetTile(ctx, 0, 0, 300)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tile.Nodes[10] = h.HashLeaf([]byte("bad"))
+				if err := s.StoreTile(ctx, 0, 0, tile); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"corrupt tile/00/0000/00/00/00"},
+		}, {
+			desc: "corrupt archived checkpoint",
+			modify: func(t *testing.T, d string, _ *Storage) {
+				cp := fmtlog.Checkpoint{Origin: "test", Size: 200, Hash: h.EmptyRoot()}
+				if err := os.WriteFile(filepath.Join(layout.CheckpointArchivePath(d, 200)), cp.Marshal(), filePerm); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"corrupt checkpoints/200"},
+		}, {
+			desc: "orphaned resources",
+			modify: func(t *testing.T, d string, s *Storage) {
+				// Integrate without writing the checkpoint.
+				cp := integrate(t, s, 300, 10)
+				if err := s.ArchiveCheckpoint(ctx, cp.Size, []byte("unpublished")); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := writeTemp(filepath.Join(d, "tile"), "temp.*.temp", []byte("temp")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"orphaned checkpoints/310", "orphaned tile/00/0000/00/00/01.36", "orphaned tile/temp"},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			d := filepath.Join(t.TempDir(), "storage")
+			s, err := Create(d)
+			if err != nil {
+				t.Fatalf("Create = %v", err)
+			}
+			writeCheckpoint(t, s, fmtlog.Checkpoint{Hash: h.EmptyRoot()})
+			for _, n := range []uint64{200, 100} {
+				var size uint64
+				if cpRaw, err := ReadCheckpoint(d); err != nil {
+					t.Fatalf("ReadCheckpoint = %v", err)
+				} else if cp, err := open(cpRaw); err != nil {
+					t.Fatalf("open = %v", err)
+				} else {
+					size = cp.Size
+				}
+				writeCheckpoint(t, s, integrate(t, s, size, n))
+			}
+			if test.modify != nil {
+				test.modify(t, d, s)
+			}
+
+			r, err := Verify(ctx, d, open, h)
+			if err != nil {
+				t.Fatalf("Verify = %v", err)
+			}
+			if r.Size != 300 || r.Checkpoints != 3 {
+				t.Errorf("Verify checked size %d, %d checkpoints, want 300, 3", r.Size, r.Checkpoints)
+			}
+			var got []string
+			for _, p := range r.Problems {
+				got = append(got, p.Kind.String()+" "+filepath.ToSlash(p.Path))
+			}
+			// Temporary file names are random.
+			for i, p := range got {
+				if strings.HasPrefix(p, "orphaned tile/temp.") {
+					got[i] = "orphaned tile/temp"
+				}
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Verify problems diff (-want +got):\n%s\nproblems: %v", diff, r.Problems)
+			}
+		})
+	}
+}
+
+// metricsRecorder is a log.StorageMetrics which counts the operations reported
+// for each kind of file, i.e. the first element of its key.
+type metricsRecorder struct {
+	mu            sync.Mutex
+	reads, writes map[string]int
+	notFound      map[string]int
+	preconditions map[string]int
+}
+
+func newMetricsRecorder() *metricsRecorder {
+	return &metricsRecorder{
+		reads:         make(map[string]int),
+		writes:        make(map[string]int),
+		notFound:      make(map[string]int),
+		preconditions: make(map[string]int),
+	}
+}
+
+func kind(key string) string {
+	k, _, _ := strings.Cut(key, "/")
+	return k
+}
+
+func (m *metricsRecorder) ObjectRead(key string, size int, _ time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if errors.Is(err, os.ErrNotExist) {
+		m.notFound[kind(key)]++
+		return
+	}
+	m.reads[kind(key)] += size
+}
+
+func (m *metricsRecorder) ObjectWritten(key string, size int, _ time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		m.writes[kind(key)]++
+	}
+}
+
+func (m *metricsRecorder) PreconditionFailed(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.preconditions[kind(key)]++
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	m := newMetricsRecorder()
+	s, err := Create(filepath.Join(t.TempDir(), "storage"), WithMetrics(m))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		leaf := []byte(fmt.Sprintf("leaf %d", i))
+		if _, err := s.Sequence(ctx, h.HashLeaf(leaf), leaf); err != nil {
+			t.Fatalf("Sequence = %v", err)
+		}
+	}
+	if err := s.Assign(ctx, 1, []byte("leaf 1")); err != log.ErrSeqAlreadyAssigned {
+		t.Fatalf("Assign = %v, want %v", err, log.ErrSeqAlreadyAssigned)
+	}
+	cp, err := log.Integrate(ctx, 0, s, h)
+	if err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+	if err := s.WriteCheckpoint(ctx, cp.Marshal()); err != nil {
+		t.Fatalf("WriteCheckpoint = %v", err)
+	}
+
+	if diff := cmp.Diff(map[string]int{"seq": 3, "leaves": 3, "tile": 1, "checkpoint": 1, ".integrate.journal": 1}, m.writes); diff != "" {
+		t.Errorf("Writes diff (-want +got):\n%s", diff)
+	}
+	// Sequence only moves on to the next sequence number once it finds the
+	// current one is taken, so the second and third leaves both fail once,
+	// as does the Assign.
+	if diff := cmp.Diff(map[string]int{"seq": 3}, m.preconditions); diff != "" {
+		t.Errorf("Precondition failures diff (-want +got):\n%s", diff)
+	}
+	// Each leaf is read back when it's integrated, and the dupe check and scan
+	// look for files which don't exist yet.
+	if got, want := m.reads["seq"], len("leaf 0")*3; got != want {
+		t.Errorf("Read %d bytes of leaf data, want %d", got, want)
+	}
+	if m.notFound["leaves"] != 3 || m.notFound["seq"] != 1 {
+		t.Errorf("Got %d leafhash and %d seq misses, want 3 and 1", m.notFound["leaves"], m.notFound["seq"])
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/transparency-dev/merkle"
+	"k8s.io/klog/v2"
+)
+
+// GCPending removes stale files from the pending leaves directory, which may be
+// left behind if sequencing fails part way through, e.g. because the sequencer
+// crashed. It returns the number of files removed.
+//
+// A file is removed if its leaf has already been sequenced and recorded in the
+// leafhash index, i.e. it's a leftover copy of a sequenced leaf, or if ttl is
+// non-zero and the file is older than ttl. h must be the log's hasher.
+//
+// Callers must hold the SequenceLock, so that the files of leaves which are
+// being sequenced are not removed.
+func (fs *Storage) GCPending(ctx context.Context, h merkle.LogHasher, ttl time.Duration) (int, error) {
+	dir := filepath.Join(fs.rootDir, leavesPendingDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pending leaves: %w", err)
+	}
+	n := 0
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		if !e.Type().IsRegular() {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+		stale, err := fs.isStalePending(ctx, p, h, ttl)
+		if errors.Is(err, os.ErrNotExist) {
+			// Removed by another process.
+			continue
+		} else if err != nil {
+			return n, err
+		}
+		if !stale {
+			continue
+		}
+		klog.V(1).Infof("Removing stale pending leaf %q", p)
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return n, fmt.Errorf("failed to remove %q: %w", p, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// isStalePending returns true if the pending leaf file at p should be removed,
+// see GCPending.
+func (fs *Storage) isStalePending(ctx context.Context, p string, h merkle.LogHasher, ttl time.Duration) (bool, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return false, err
+	}
+	if ttl > 0 && time.Since(fi.ModTime()) > ttl {
+		return true, nil
+	}
+	d, err := fs.readFile(p)
+	if err != nil {
+		return false, err
+	}
+	leaf, err := fs.decode(ctx, d)
+	if err != nil {
+		// Probably a partially written file, which will be removed once it's
+		// older than ttl.
+		klog.Warningf("Failed to decode pending leaf %q: %v", p, err)
+		return false, nil
+	}
+	if _, err := fs.LeafIndex(ctx, h.HashLeaf(leaf)); err == nil {
+		return true, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	return false, nil
+}
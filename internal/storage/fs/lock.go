@@ -0,0 +1,80 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Lock identifies one of the advisory locks which may be held on a log's
+// storage directory.
+type Lock string
+
+const (
+	// SequenceLock is held while entries are being sequenced, so that
+	// concurrent sequencers cannot assign duplicate entries different
+	// sequence numbers.
+	SequenceLock Lock = ".sequence.lock"
+	// IntegrateLock is held while sequenced entries are being integrated, from
+	// reading the current checkpoint until the new checkpoint is written, so
+	// that concurrent integrations cannot overwrite a checkpoint with an older
+	// one.
+	IntegrateLock Lock = ".integrate.lock"
+)
+
+// ErrLocked is returned by TryLock if the lock is held by another caller.
+var ErrLocked = errors.New("log is locked by another process")
+
+// AcquireLock blocks until the lock l on the log stored in rootDir is held,
+// and returns a function which releases it.
+//
+// Locks are advisory, and only exclude other callers of AcquireLock, e.g.
+// overlapping runs of the sequence and integrate tools. Sequencing and
+// integration use different locks, so entries may be sequenced while an
+// integration is in progress.
+//
+// Locks are taken with flock(2) on platforms which support it, and are released
+// by the operating system if the process exits. On other platforms,
+// AcquireLock does not lock, and callers must ensure that they do not overlap.
+func AcquireLock(rootDir string, l Lock) (func() error, error) {
+	return acquireLock(rootDir, l, true)
+}
+
+// TryLock is like AcquireLock, but returns an error wrapping ErrLocked rather
+// than blocking if the lock is already held. It should be used by long-running
+// holders of a lock, e.g. the serve tool, and by optional work which may be
+// skipped.
+func TryLock(rootDir string, l Lock) (func() error, error) {
+	return acquireLock(rootDir, l, false)
+}
+
+func acquireLock(rootDir string, l Lock, wait bool) (func() error, error) {
+	p := filepath.Join(rootDir, string(l))
+	f, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, filePerm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := flock(f, wait); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %q: %w", p, err)
+	}
+	return func() error {
+		// Closing the file releases the lock.
+		return f.Close()
+	}, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+	"k8s.io/klog/v2"
+)
+
+// Prune removes the data of the leaves at the start of the log at rootDir, up
+// to the given size, while leaving their hashes in the log's tiles and leafhash
+// index, so that checkpoints and proofs can still be served. Blobs referenced
+// by the pruned leaves are removed too. It returns the new size of the log's
+// pruned prefix, see ReadPrunedSize.
+//
+// Leaf bundles are removed whole, so size is rounded down to a multiple of the
+// log's bundle size. logSize must be the size of the log's current
+// checkpoint, only integrated leaves may be pruned. Leaves which have already
+// been pruned are skipped, and pruning never shrinks the pruned prefix.
+//
+// The size of the pruned prefix is only recorded once the leaves have been
+// removed, so if Prune is interrupted it should be called again with the same
+// size. Options, e.g. WithCompression, must match those used to write the log.
+// Callers must hold the IntegrateLock.
+func Prune(ctx context.Context, rootDir string, size, logSize uint64, opts ...Option) (uint64, error) {
+	fs := &Storage{rootDir: rootDir}
+	for _, o := range opts {
+		o(fs)
+	}
+	if size > logSize {
+		return 0, fmt.Errorf("cannot prune to size %d beyond log size %d", size, logSize)
+	}
+	bundleSize, err := ReadBundleSize(fs.rootDir)
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := ReadPrunedSize(fs.rootDir)
+	if err != nil {
+		return 0, err
+	}
+	size -= size % bundleSize
+	if size <= pruned {
+		return pruned, nil
+	}
+	for i := pruned / bundleSize; i < size/bundleSize; i++ {
+		if err := ctx.Err(); err != nil {
+			return pruned, err
+		}
+		if err := fs.pruneBundle(ctx, i, bundleSize, logSize); err != nil {
+			return pruned, err
+		}
+	}
+	if err := fs.writePrunedSize(size); err != nil {
+		return pruned, err
+	}
+	return size, nil
+}
+
+// pruneBundle removes the leaf bundle with the given index, along with the
+// blobs referenced by its leaves.
+func (fs *Storage) pruneBundle(ctx context.Context, index, bundleSize, logSize uint64) error {
+	entries, err := fs.readBundle(ctx, index, bundleSize, logSize)
+	if errors.Is(err, os.ErrNotExist) {
+		// Removed by an earlier call which was interrupted.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !api.IsBlobRef(e) {
+			continue
+		}
+		var ref api.BlobRef
+		if err := ref.UnmarshalText(e); err != nil {
+			return err
+		}
+		dir, file := layout.BlobPath(fs.rootDir, ref.Hash)
+		if err := os.Remove(filepath.Join(dir, file)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove blob: %w", err)
+		}
+	}
+	p := filepath.Join(layout.SeqPath(fs.rootDir, index))
+	if bundleSize > 1 {
+		p = filepath.Join(layout.BundlePath(fs.rootDir, index, 0))
+	}
+	klog.V(1).Infof("Pruning %q", p)
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove %q: %w", p, err)
+	}
+	return nil
+}
+
+// writePrunedSize atomically records the size of the log's pruned prefix.
+func (fs *Storage) writePrunedSize(size uint64) error {
+	p := filepath.Join(fs.rootDir, layout.PrunedPath)
+	tmp, err := writeTemp(fs.rootDir, layout.PrunedPath+".*.tmp", []byte(strconv.FormatUint(size, 10)))
+	if err != nil {
+		return fmt.Errorf("failed to write pruned size: %w", err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return fmt.Errorf("failed to rename pruned size file: %w", err)
+	}
+	return nil
+}
+
+// ReadPrunedSize returns the size of the pruned prefix of the log at rootDir,
+// i.e. the number of leaves at the start of the log whose data has been
+// removed by Prune, or 0 if the log has not been pruned.
+func ReadPrunedSize(rootDir string) (uint64, error) {
+	raw, err := os.ReadFile(filepath.Join(rootDir, layout.PrunedPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read pruned size: %w", err)
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pruned size %q", raw)
+	}
+	return n, nil
+}
+
+// RetentionSize returns the size of the largest tree whose checkpoint was
+// archived by the log at rootDir before the given time, see
+// ArchiveCheckpoint, or 0 if there is none. The leaves of that tree have been
+// published for at least as long as the time since then, so this is the size
+// to prune the log to in order to enforce a retention period.
+//
+// The time at which a checkpoint was archived is taken from its file's
+// modification time.
+func RetentionSize(rootDir string, before time.Time) (uint64, error) {
+	dir, _ := layout.CheckpointArchivePath(rootDir, 0)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to list archived checkpoints: %w", err)
+	}
+	var size uint64
+	for _, e := range entries {
+		s, err := strconv.ParseUint(e.Name(), 10, 64)
+		if err != nil || !e.Type().IsRegular() || s <= size {
+			continue
+		}
+		fi, err := e.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to stat archived checkpoint: %w", err)
+		}
+		if fi.ModTime().Before(before) {
+			size = s
+		}
+	}
+	return size, nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+)
+
+// Rebundle writes a copy of the log at srcDir to the new directory dstDir, with
+// its leaves stored in bundles of bundleSize leaves, see api/layout/README.md.
+// This allows a log's bundle size to be changed, e.g. to reduce the number of
+// files needed to store and serve it.
+//
+// The first logSize leaves are copied, and their root hash must match rootHash,
+// which should be taken from the log's verified checkpoint. Tiles, leafhash
+// files and archived checkpoints are copied unchanged. The checkpoint is copied last, so dstDir only
+// contains a complete log if Rebundle succeeds. Options, e.g. WithCompression,
+// apply to the leaf data of both the source and the copy.
+//
+// The source log must not be modified while it's being copied, see
+// AcquireLock.
+func Rebundle(ctx context.Context, srcDir, dstDir string, logSize uint64, rootHash []byte, bundleSize uint64, h merkle.LogHasher, opts ...Option) error {
+	if bundleSize == 0 {
+		return errors.New("bundle size must be > 0")
+	}
+	srcBundleSize, err := ReadBundleSize(srcDir)
+	if err != nil {
+		return err
+	}
+	if ok, err := sequenced(srcDir, srcBundleSize, logSize); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("log has entries beyond size %d which have not been integrated", logSize)
+	}
+	if pruned, err := ReadPrunedSize(srcDir); err != nil {
+		return err
+	} else if pruned > 0 {
+		return fmt.Errorf("log has been pruned to size %d, so its leaves cannot be rebundled", pruned)
+	}
+	src := &Storage{rootDir: srcDir}
+	for _, o := range opts {
+		o(src)
+	}
+	dst, err := Create(dstDir, opts...)
+	if err != nil {
+		return err
+	}
+
+	// Copy the leaves, checking that they hash to the expected root as we go.
+	rf := compact.RangeFactory{Hash: h.HashChildren}
+	r := rf.NewEmptyRange(0)
+	bundle := make([][]byte, 0, bundleSize)
+	for i := uint64(0); i*srcBundleSize < logSize; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entries, err := src.readBundle(ctx, i, srcBundleSize, logSize)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := r.Append(h.HashLeaf(e), nil); err != nil {
+				return fmt.Errorf("failed to append leaf %d to range: %w", r.End(), err)
+			}
+			bundle = append(bundle, e)
+			if uint64(len(bundle)) == bundleSize {
+				if err := dst.writeBundle(ctx, (r.End()-1)/bundleSize, bundleSize, bundle); err != nil {
+					return err
+				}
+				bundle = bundle[:0]
+			}
+		}
+	}
+	if len(bundle) > 0 {
+		if err := dst.writeBundle(ctx, logSize/bundleSize, bundleSize, bundle); err != nil {
+			return err
+		}
+	}
+	root := h.EmptyRoot()
+	if logSize > 0 {
+		if root, err = r.GetRootHash(nil); err != nil {
+			return fmt.Errorf("failed to calculate root hash: %w", err)
+		}
+	}
+	if !bytes.Equal(root, rootHash) {
+		return fmt.Errorf("leaves have root hash %x, want %x", root, rootHash)
+	}
+
+	for _, d := range []string{"tile", "leaves", "checkpoints"} {
+		if err := copyTree(filepath.Join(srcDir, d), filepath.Join(dstDir, d)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if bundleSize > 1 {
+		if err := os.WriteFile(filepath.Join(dstDir, layout.BundleSizePath), []byte(strconv.FormatUint(bundleSize, 10)), filePerm); err != nil {
+			return fmt.Errorf("failed to write bundle size: %w", err)
+		}
+	}
+	cpRaw, err := ReadCheckpoint(srcDir)
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	return dst.WriteCheckpoint(ctx, cpRaw)
+}
+
+// readBundle returns the leaves stored in the file under seq/ with the given
+// index, in a log with the given bundle size and log size.
+func (fs *Storage) readBundle(ctx context.Context, index, bundleSize, logSize uint64) ([][]byte, error) {
+	p := filepath.Join(layout.SeqPath(fs.rootDir, index))
+	want := uint64(1)
+	if bundleSize > 1 {
+		partial := uint64(0)
+		if index == logSize/bundleSize {
+			partial = logSize % bundleSize
+		}
+		p = filepath.Join(layout.BundlePath(fs.rootDir, index, partial))
+		want = bundleSize
+		if partial > 0 {
+			want = partial
+		}
+	}
+	raw, err := fs.readFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read leaf data: %w", err)
+	}
+	if raw, err = fs.decode(ctx, raw); err != nil {
+		return nil, fmt.Errorf("failed to decode %q: %w", p, err)
+	}
+	if bundleSize == 1 {
+		return [][]byte{raw}, nil
+	}
+	var b api.LeafBundle
+	if err := b.UnmarshalText(raw); err != nil {
+		return nil, fmt.Errorf("failed to parse leaf bundle %q: %w", p, err)
+	}
+	if got := uint64(len(b.Entries)); got != want {
+		return nil, fmt.Errorf("leaf bundle %q has %d entries, want %d", p, got, want)
+	}
+	return b.Entries, nil
+}
+
+// writeBundle writes the leaves in entries to the file under seq/ with the
+// given index, in a log with the given bundle size. If there are fewer than
+// bundleSize entries the bundle is written as a partial bundle. The bundle is
+// written to a temporary file which is then renamed into place, so an existing
+// bundle is atomically replaced.
+func (fs *Storage) writeBundle(ctx context.Context, index, bundleSize uint64, entries [][]byte) error {
+	var dir, file string
+	var d []byte
+	if bundleSize == 1 {
+		dir, file = layout.SeqPath(fs.rootDir, index)
+		d = entries[0]
+	} else {
+		dir, file = layout.BundlePath(fs.rootDir, index, uint64(len(entries))%bundleSize)
+		var err error
+		if d, err = (api.LeafBundle{Entries: entries}).MarshalText(); err != nil {
+			return fmt.Errorf("failed to marshal leaf bundle %d: %w", index, err)
+		}
+	}
+	d, err := fs.encode(ctx, d)
+	if err != nil {
+		return fmt.Errorf("failed to encode leaf bundle %d: %w", index, err)
+	}
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return fmt.Errorf("failed to create directory %q: %w", dir, err)
+	}
+	p := filepath.Join(dir, file)
+	start := time.Now()
+	tmp, err := writeTemp(dir, file+".*.tmp", d)
+	if err != nil {
+		fs.observeWrite(p, len(d), start, err)
+		return fmt.Errorf("failed to write temporary leaf bundle file: %w", err)
+	}
+	err = os.Rename(tmp, p)
+	fs.observeWrite(p, len(d), start, err)
+	if err != nil {
+		return fmt.Errorf("failed to rename temporary leaf bundle file: %w", err)
+	}
+	return nil
+}
+
+// copyTree copies the regular files in the directory hierarchy at src to dst,
+// skipping any temporary files. Symlinks, i.e. partial tiles which have been
+// replaced by full tiles, are copied as regular files.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && rel == "pending" {
+			// Temporary copies of leaves being sequenced.
+			return iofs.SkipDir
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), dirPerm)
+		}
+		if n := d.Name(); strings.HasSuffix(n, ".tmp") || strings.HasSuffix(n, ".temp") || strings.HasSuffix(n, ".link") {
+			return nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %w", p, err)
+		}
+		return os.WriteFile(filepath.Join(dst, rel), b, filePerm)
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+)
+
+// ReadShardIndex returns the shard index of the temporally sharded log at
+// rootDir, or an empty index if no shards have been added.
+func ReadShardIndex(rootDir string) (api.ShardIndex, error) {
+	var idx api.ShardIndex
+	raw, err := os.ReadFile(filepath.Join(rootDir, layout.ShardIndexPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	} else if err != nil {
+		return idx, fmt.Errorf("failed to read shard index: %w", err)
+	}
+	if err := idx.UnmarshalText(raw); err != nil {
+		return idx, fmt.Errorf("invalid shard index: %w", err)
+	}
+	return idx, nil
+}
+
+// AddShard adds the shard s to the index of the temporally sharded log at
+// rootDir, creating the index if necessary, and returns the directory in
+// which the shard's log should be created, e.g. with Create.
+//
+// The index is replaced atomically, but AddShard must not be called
+// concurrently for the same sharded log.
+func AddShard(rootDir string, s api.Shard) (string, error) {
+	idx, err := ReadShardIndex(rootDir)
+	if err != nil {
+		return "", err
+	}
+	if idx, err = idx.Add(s); err != nil {
+		return "", err
+	}
+	raw, err := idx.MarshalText()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(rootDir, dirPerm); err != nil {
+		return "", fmt.Errorf("failed to create directory %q: %w", rootDir, err)
+	}
+	tmp, err := writeTemp(rootDir, layout.ShardIndexPath+".*.tmp", raw)
+	if err != nil {
+		return "", fmt.Errorf("failed to write shard index: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(rootDir, layout.ShardIndexPath)); err != nil {
+		return "", fmt.Errorf("failed to rename shard index: %w", err)
+	}
+	return filepath.Join(rootDir, s.Name), nil
+}
@@ -0,0 +1,578 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/api/layout"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// ProblemKind classifies the problems found by Verify.
+type ProblemKind int
+
+const (
+	// Missing resources are needed by the log, but are not stored.
+	Missing ProblemKind = iota
+	// Corrupt resources are stored, but cannot be read, or hold the wrong
+	// contents.
+	Corrupt
+	// Orphaned resources are stored, but are not part of the log committed to
+	// by its checkpoint, e.g. temporary files left behind by a crash, or tiles
+	// written by an integration which never wrote its checkpoint.
+	Orphaned
+)
+
+func (k ProblemKind) String() string {
+	switch k {
+	case Missing:
+		return "missing"
+	case Corrupt:
+		return "corrupt"
+	case Orphaned:
+		return "orphaned"
+	}
+	return fmt.Sprintf("ProblemKind(%d)", int(k))
+}
+
+// Problem describes a problem with one of the resources of a log.
+type Problem struct {
+	Kind ProblemKind
+	// Path is the location of the resource, relative to the log's root
+	// directory.
+	Path string
+	// Err describes the problem.
+	Err error
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s %s: %v", p.Kind, p.Path, p.Err)
+}
+
+// VerifyReport is the result of verifying a log with Verify.
+type VerifyReport struct {
+	// Size is the size of the tree committed to by the log's checkpoint.
+	Size uint64
+	// Bundles, Tiles and Checkpoints are the number of leaf bundles, tiles
+	// and archived checkpoints which were checked.
+	Bundles, Tiles, Checkpoints int
+	// Blobs is the number of blobs referenced by leaves which were checked.
+	Blobs int
+	// Pruned is the size of the log's pruned prefix, see Storage.Prune. The
+	// leaf hashes of pruned leaves are taken from the log's tiles.
+	Pruned uint64
+	// Problems lists the problems which were found, in the order that they
+	// were found.
+	Problems []Problem
+}
+
+// Has returns true if the report holds any problems of the given kind.
+func (r *VerifyReport) Has(k ProblemKind) bool {
+	for _, p := range r.Problems {
+		if p.Kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *VerifyReport) add(k ProblemKind, path string, err error) {
+	r.Problems = append(r.Problems, Problem{Kind: k, Path: path, Err: err})
+}
+
+// Verify checks the integrity of the log stored at rootDir.
+//
+// The log's checkpoint is opened with open, which should verify its signature
+// and origin. Every leaf bundle committed to by the checkpoint is read, and the
+// tree is recomputed from the leaves, bottom-up. Each tile is checked against
+// the recomputed tree, as is the checkpoint's root hash, and the root hash of
+// each archived checkpoint. Blobs referenced by leaves, see api.BlobRef, are
+// checked against their references. The data of leaves which have been pruned
+// is not expected to be present, and their hashes are read from the level 0
+// tiles instead. Finally, the tile, seq and checkpoints directories
+// are walked to find orphaned files. Options, e.g. WithCompression, must match
+// those used to write the log.
+//
+// Problems with the log are returned in the report. An error is only returned
+// if the log could not be checked.
+//
+// The log should not be modified while it's being verified, see AcquireLock,
+// otherwise files which are being written may be reported as orphaned.
+func Verify(ctx context.Context, rootDir string, open func(cpRaw []byte) (*fmtlog.Checkpoint, error), h merkle.LogHasher, opts ...Option) (*VerifyReport, error) {
+	fs := &Storage{rootDir: rootDir}
+	for _, o := range opts {
+		o(fs)
+	}
+	bundleSize, err := ReadBundleSize(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	r := &VerifyReport{}
+
+	cpRaw, err := ReadCheckpoint(rootDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			r.add(Missing, layout.CheckpointPath, err)
+			return r, nil
+		}
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	cp, err := open(cpRaw)
+	if err != nil {
+		r.add(Corrupt, layout.CheckpointPath, err)
+		return r, nil
+	}
+	r.Size = cp.Size
+	if r.Pruned, err = ReadPrunedSize(rootDir); err != nil {
+		r.add(Corrupt, layout.PrunedPath, err)
+	} else if r.Pruned > cp.Size {
+		r.add(Corrupt, layout.PrunedPath, fmt.Errorf("pruned size %d is larger than checkpoint size %d", r.Pruned, cp.Size))
+	}
+
+	archived, err := archivedSizes(rootDir, cp.Size, r)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &treeVerifier{
+		fs:      fs,
+		r:       r,
+		size:    cp.Size,
+		tiles:   make(map[[2]uint64]*api.Tile),
+		roots:   make(map[uint64][]byte),
+		archive: archived,
+	}
+	root, err := v.verifyTree(ctx, h, bundleSize)
+	if err != nil {
+		return nil, err
+	}
+	if root != nil && !bytes.Equal(root, cp.Hash) {
+		r.add(Corrupt, layout.CheckpointPath, fmt.Errorf("checkpoint has root hash %x, but leaves have root hash %x", cp.Hash, root))
+	}
+
+	for _, s := range archived {
+		dir, file := layout.CheckpointArchivePath("", s)
+		p := filepath.Join(dir, file)
+		r.Checkpoints++
+		raw, err := ReadArchivedCheckpoint(rootDir, s)
+		if err != nil {
+			r.add(Corrupt, p, err)
+			continue
+		}
+		acp, err := open(raw)
+		if err != nil {
+			r.add(Corrupt, p, err)
+			continue
+		}
+		if acp.Size != s {
+			r.add(Corrupt, p, fmt.Errorf("archived checkpoint has size %d", acp.Size))
+			continue
+		}
+		if want, ok := v.roots[s]; ok && !bytes.Equal(acp.Hash, want) {
+			r.add(Corrupt, p, fmt.Errorf("archived checkpoint has root hash %x, but leaves have root hash %x", acp.Hash, want))
+		}
+	}
+
+	if err := v.findOrphanedTiles(); err != nil {
+		return nil, err
+	}
+	if err := findTemporaryFiles(rootDir, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// archivedSizes returns the sorted sizes of the archived checkpoints for trees
+// no larger than size. Archived checkpoints for larger trees are reported as
+// orphaned.
+func archivedSizes(rootDir string, size uint64, r *VerifyReport) ([]uint64, error) {
+	dir, _ := layout.CheckpointArchivePath(rootDir, 0)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list archived checkpoints: %w", err)
+	}
+	var sizes []uint64
+	for _, e := range entries {
+		s, err := strconv.ParseUint(e.Name(), 10, 64)
+		if err != nil || e.IsDir() {
+			// Temporary files are reported by findTemporaryFiles.
+			if !isTemporary(e.Name()) {
+				r.add(Orphaned, filepath.Join(filepath.Base(dir), e.Name()), errors.New("unexpected file in checkpoint archive"))
+			}
+			continue
+		}
+		if s > size {
+			r.add(Orphaned, filepath.Join(filepath.Base(dir), e.Name()), fmt.Errorf("archived checkpoint is larger than checkpoint size %d", size))
+			continue
+		}
+		sizes = append(sizes, s)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	return sizes, nil
+}
+
+// treeVerifier recomputes a log's tree from its leaves, checking its tiles as
+// they're completed.
+type treeVerifier struct {
+	fs   *Storage
+	r    *VerifyReport
+	size uint64
+
+	// tiles holds the recomputed tiles which are not yet complete, keyed by
+	// level and index.
+	tiles map[[2]uint64]*api.Tile
+	// leafTile is the most recently read level 0 tile, see leafHashes.
+	leafTile      *api.Tile
+	leafTileIndex uint64
+
+	// roots holds the recomputed root hashes for the archived tree sizes.
+	roots   map[uint64][]byte
+	archive []uint64
+}
+
+// verifyTree reads every leaf bundle, and recomputes the tree, checking the
+// stored tiles along the way. It returns the recomputed root hash, or nil if
+// the tree could not be recomputed because leaves are unavailable.
+func (v *treeVerifier) verifyTree(ctx context.Context, h merkle.LogHasher, bundleSize uint64) ([]byte, error) {
+	rf := compact.RangeFactory{Hash: h.HashChildren}
+	rng := rf.NewEmptyRange(0)
+	root := func() ([]byte, error) {
+		if rng.End() == 0 {
+			return h.EmptyRoot(), nil
+		}
+		return rng.GetRootHash(nil)
+	}
+	recordRoot := func() error {
+		for len(v.archive) > 0 && v.archive[0] <= rng.End() {
+			if v.archive[0] == rng.End() {
+				r, err := root()
+				if err != nil {
+					return err
+				}
+				v.roots[rng.End()] = r
+			}
+			v.archive = v.archive[1:]
+		}
+		return nil
+	}
+	if err := recordRoot(); err != nil {
+		return nil, err
+	}
+	appendLeaves := func(lhs [][]byte) error {
+		for _, lh := range lhs {
+			if err := rng.Append(lh, v.visit); err != nil {
+				return fmt.Errorf("failed to append leaf %d to range: %w", rng.End(), err)
+			}
+			v.completed(rng.End())
+			if err := recordRoot(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := uint64(0); i*bundleSize < v.size; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if i*bundleSize < v.r.Pruned {
+			lhs, err := v.leafHashes(i*bundleSize, min(bundleSize, v.size-i*bundleSize))
+			if err != nil {
+				v.r.add(Missing, v.bundlePath(i, bundleSize), fmt.Errorf("unable to recompute tree beyond pruned leaf %d from tiles: %v", i*bundleSize, err))
+				return nil, nil
+			}
+			if err := appendLeaves(lhs); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		v.r.Bundles++
+		var lhs [][]byte
+		entries, err := v.fs.readBundle(ctx, i, bundleSize, v.size)
+		if err != nil {
+			v.r.add(problemKind(err), v.bundlePath(i, bundleSize), err)
+			// Carry on with the leaf hashes from the tiles, if possible, so
+			// that the rest of the log can be checked.
+			if lhs, err = v.leafHashes(i*bundleSize, min(bundleSize, v.size-i*bundleSize)); err != nil {
+				v.r.add(Missing, v.bundlePath(i, bundleSize), fmt.Errorf("unable to recompute tree beyond leaf %d from tiles: %v", i*bundleSize, err))
+				return nil, nil
+			}
+		}
+		for j, e := range entries {
+			lhs = append(lhs, h.HashLeaf(e))
+			if api.IsBlobRef(e) {
+				v.checkBlob(ctx, i*bundleSize+uint64(j), e)
+			}
+		}
+		if err := appendLeaves(lhs); err != nil {
+			return nil, err
+		}
+	}
+
+	// The remaining tiles are the partial tiles along the right-hand edge of
+	// the tree.
+	keys := make([][2]uint64, 0, len(v.tiles))
+	for k := range v.tiles {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		v.checkTile(k[0], k[1])
+	}
+	r, err := root()
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate root hash: %w", err)
+	}
+	return r, nil
+}
+
+// checkBlob checks the blob referenced by the leaf at index seq.
+func (v *treeVerifier) checkBlob(ctx context.Context, seq uint64, leaf []byte) {
+	var ref api.BlobRef
+	if err := ref.UnmarshalText(leaf); err != nil {
+		return
+	}
+	v.r.Blobs++
+	if _, err := v.fs.ReadBlob(ctx, ref); err != nil {
+		dir, file := layout.BlobPath("", ref.Hash)
+		v.r.add(problemKind(err), filepath.Join(dir, file), fmt.Errorf("blob referenced by leaf %d: %v", seq, err))
+	}
+}
+
+// visit records a node of the recomputed tree in its tile.
+func (v *treeVerifier) visit(id compact.NodeID, hash []byte) {
+	tileLevel, tileIndex, nodeLevel, nodeIndex := layout.NodeCoordsToTileAddress(uint64(id.Level), uint64(id.Index))
+	k := [2]uint64{tileLevel, tileIndex}
+	t := v.tiles[k]
+	if t == nil {
+		t = &api.Tile{Nodes: make([][]byte, 0, 256*2)}
+		v.tiles[k] = t
+	}
+	idx := api.TileNodeKey(nodeLevel, nodeIndex)
+	if l := uint(len(t.Nodes)); idx >= l {
+		t.Nodes = append(t.Nodes, make([][]byte, idx-l+1)...)
+	}
+	t.Nodes[idx] = hash
+	if nodeLevel == 0 && nodeIndex >= uint64(t.NumLeaves) {
+		t.NumLeaves = uint(nodeIndex + 1)
+	}
+}
+
+// completed checks, and forgets, the tiles which are completed by a tree of
+// the given size.
+func (v *treeVerifier) completed(size uint64) {
+	// Each level's tiles span 256 times as many leaves as the level below.
+	span := uint64(256)
+	for level := uint64(0); size%span == 0; level++ {
+		v.checkTile(level, size/span-1)
+		if span > (1<<64-1)/256 {
+			break
+		}
+		span *= 256
+	}
+}
+
+// checkTile compares the recomputed tile at the given level and index with the
+// stored one.
+func (v *treeVerifier) checkTile(level, index uint64) {
+	k := [2]uint64{level, index}
+	want := v.tiles[k]
+	delete(v.tiles, k)
+	if want == nil {
+		return
+	}
+	v.r.Tiles++
+	dir, file := layout.TilePath("", level, index, layout.PartialTileSize(level, index, v.size))
+	p := filepath.Join(dir, file)
+	got, err := v.fs.GetTile(context.Background(), level, index, v.size)
+	if err != nil {
+		v.r.add(problemKind(err), p, err)
+		return
+	}
+	if got.NumLeaves != want.NumLeaves || len(got.Nodes) != len(want.Nodes) {
+		v.r.add(Corrupt, p, fmt.Errorf("tile has %d leaves and %d nodes, want %d leaves and %d nodes", got.NumLeaves, len(got.Nodes), want.NumLeaves, len(want.Nodes)))
+		return
+	}
+	for i := range want.Nodes {
+		if !bytes.Equal(got.Nodes[i], want.Nodes[i]) {
+			v.r.add(Corrupt, p, fmt.Errorf("tile node %d has hash %x, want %x", i, got.Nodes[i], want.Nodes[i]))
+			return
+		}
+	}
+}
+
+// leafHashes returns the hashes of the n leaves starting at from, as stored in
+// the level 0 tiles.
+func (v *treeVerifier) leafHashes(from, n uint64) ([][]byte, error) {
+	ret := make([][]byte, 0, n)
+	for seq := from; seq < from+n; seq++ {
+		if v.leafTile == nil || v.leafTileIndex != seq/256 {
+			t, err := v.fs.GetTile(context.Background(), 0, seq/256, v.size)
+			if err != nil {
+				return nil, err
+			}
+			v.leafTile, v.leafTileIndex = t, seq/256
+		}
+		idx := api.TileNodeKey(0, seq%256)
+		if idx >= uint(len(v.leafTile.Nodes)) || len(v.leafTile.Nodes[idx]) == 0 {
+			return nil, fmt.Errorf("level 0 tile %d has no hash for leaf %d", seq/256, seq)
+		}
+		ret = append(ret, v.leafTile.Nodes[idx])
+	}
+	return ret, nil
+}
+
+// bundlePath returns the path to the leaf bundle with the given index,
+// relative to the log's root directory.
+func (v *treeVerifier) bundlePath(index, bundleSize uint64) string {
+	if bundleSize == 1 {
+		return filepath.Join(layout.SeqPath("", index))
+	}
+	partial := uint64(0)
+	if index == v.size/bundleSize {
+		partial = v.size % bundleSize
+	}
+	return filepath.Join(layout.BundlePath("", index, partial))
+}
+
+// findOrphanedTiles reports the tiles which are not part of the tree, i.e.
+// those beyond its right-hand edge.
+//
+// Partial tiles for smaller trees are still part of the log, as they're used
+// by clients which hold older checkpoints.
+func (v *treeVerifier) findOrphanedTiles() error {
+	root := filepath.Join(v.fs.rootDir, "tile")
+	err := filepath.WalkDir(root, func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || isTemporary(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(v.fs.rootDir, p)
+		if err != nil {
+			return err
+		}
+		level, index, partial, err := parseTilePath(rel)
+		if err != nil {
+			v.r.add(Orphaned, rel, err)
+			return nil
+		}
+		if index*256 >= v.size>>(8*level) {
+			v.r.add(Orphaned, rel, fmt.Errorf("tile is beyond the checkpoint size %d", v.size))
+			return nil
+		}
+		want := layout.PartialTileSize(level, index, v.size)
+		if want != 0 && (partial == 0 || partial > want) {
+			v.r.add(Orphaned, rel, fmt.Errorf("tile is beyond the checkpoint size %d", v.size))
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// parseTilePath returns the level, index and partial size of the tile with
+// the given path, relative to the log's root directory, see layout.TilePath.
+func parseTilePath(p string) (uint64, uint64, uint64, error) {
+	f := strings.Split(filepath.ToSlash(p), "/")
+	if len(f) != 6 || f[0] != "tile" {
+		return 0, 0, 0, errors.New("unexpected file in tile directory")
+	}
+	last, suffix, _ := strings.Cut(f[5], ".")
+	level, err := strconv.ParseUint(f[1], 16, 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid tile level: %v", err)
+	}
+	index, err := strconv.ParseUint(f[2]+f[3]+f[4]+last, 16, 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid tile index: %v", err)
+	}
+	var partial uint64
+	if suffix != "" {
+		if partial, err = strconv.ParseUint(suffix, 16, 64); err != nil || partial == 0 || partial > 255 {
+			return 0, 0, 0, fmt.Errorf("invalid partial tile size %q", suffix)
+		}
+	}
+	return level, index, partial, nil
+}
+
+// findTemporaryFiles reports the temporary files in the log's tile, seq,
+// staged, checkpoints and blobs directories, and its root directory, which may
+// be left behind by writers which crashed.
+func findTemporaryFiles(rootDir string, r *VerifyReport) error {
+	for _, d := range []string{"tile", "seq", stagedDir, "checkpoints", "blobs"} {
+		err := filepath.WalkDir(filepath.Join(rootDir, d), func(p string, d iofs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && isTemporary(d.Name()) {
+				rel, err := filepath.Rel(rootDir, p)
+				if err != nil {
+					return err
+				}
+				r.add(Orphaned, rel, errors.New("temporary file"))
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	entries, err := os.ReadDir(rootDir)
+	if err != nil {
+		return fmt.Errorf("failed to list %q: %w", rootDir, err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() && isTemporary(e.Name()) {
+			r.add(Orphaned, e.Name(), errors.New("temporary file"))
+		}
+	}
+	return nil
+}
+
+// isTemporary returns true if name is that of a temporary file, see writeTemp
+// and StoreTile.
+func isTemporary(name string) bool {
+	return strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".temp") || strings.HasSuffix(name, ".link")
+}
+
+// problemKind classifies an error reading a resource.
+func problemKind(err error) ProblemKind {
+	if errors.Is(err, os.ErrNotExist) {
+		return Missing
+	}
+	return Corrupt
+}
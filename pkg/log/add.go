@@ -0,0 +1,47 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/serverless-log/api"
+)
+
+// Sequencer is the subset of Storage needed to add entries to a log.
+type Sequencer interface {
+	// Sequence assigns sequence numbers to the passed in entry, see
+	// Storage.Sequence.
+	Sequence(ctx context.Context, leafhash []byte, leaf []byte) (uint64, error)
+}
+
+// Add sequences leaf, whose leaf hash is computed with h, and returns the
+// response to be sent to its submitter.
+//
+// If an identical leaf has already been sequenced, it is not sequenced again:
+// the response instead holds the index of the original entry, and is marked as
+// a duplicate.
+func Add(ctx context.Context, s Sequencer, h merkle.LogHasher, leaf []byte) (api.AddResponse, error) {
+	seq, err := s.Sequence(ctx, h.HashLeaf(leaf), leaf)
+	if err != nil {
+		if !errors.Is(err, ErrDupeLeaf) {
+			return api.AddResponse{}, err
+		}
+		return api.AddResponse{Index: seq, Duplicate: true}, nil
+	}
+	return api.AddResponse{Index: seq}, nil
+}
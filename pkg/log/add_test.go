@@ -0,0 +1,70 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"github.com/transparency-dev/serverless-log/testonly"
+)
+
+func TestAdd(t *testing.T) {
+	ctx := context.Background()
+	st := testonly.NewMemStorage()
+	for _, test := range []struct {
+		desc string
+		leaf string
+		want api.AddResponse
+	}{
+		{
+			desc: "first",
+			leaf: "one",
+			want: api.AddResponse{Index: 0},
+		}, {
+			desc: "second",
+			leaf: "two",
+			want: api.AddResponse{Index: 1},
+		}, {
+			desc: "duplicate of first",
+			leaf: "one",
+			want: api.AddResponse{Index: 0, Duplicate: true},
+		}, {
+			desc: "third",
+			leaf: "three",
+			want: api.AddResponse{Index: 2},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := log.Add(ctx, st, rfc6962.DefaultHasher, []byte(test.leaf))
+			if err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Add(%q) = %+v, want %+v", test.leaf, got, test.want)
+			}
+		})
+	}
+	n, err := st.ScanSequenced(ctx, 0, func(uint64, []byte) error { return nil })
+	if err != nil {
+		t.Fatalf("ScanSequenced: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("ScanSequenced: got %d entries, want 3", n)
+	}
+}
@@ -17,10 +17,12 @@
 package log
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"os"
+	"runtime"
 
 	"github.com/transparency-dev/formats/log"
 	"github.com/transparency-dev/merkle"
@@ -28,9 +30,14 @@ import (
 	"github.com/transparency-dev/serverless-log/api"
 	"github.com/transparency-dev/serverless-log/api/layout"
 	"github.com/transparency-dev/serverless-log/client"
+	"golang.org/x/sync/errgroup"
 	"k8s.io/klog/v2"
 )
 
+// chunkSize is the number of leaves whose subtree is hashed by each worker
+// during integration, chunks are aligned with the leaves of level 0 tiles.
+const chunkSize = 256
+
 // Storage represents the set of functions needed by the log tooling.
 type Storage interface {
 	// GetTile returns the tile at the given level & index.
@@ -40,6 +47,10 @@ type Storage interface {
 	StoreTile(ctx context.Context, level, index uint64, tile *api.Tile) error
 
 	// WriteCheckpoint stores a newly updated log checkpoint.
+	//
+	// Storage implementations which can detect that the checkpoint was updated
+	// by another writer since it was read should refuse the write with an error
+	// wrapping ErrConflict.
 	WriteCheckpoint(ctx context.Context, newCPRaw []byte) error
 
 	// Sequence assigns sequence numbers to the passed in entry.
@@ -55,6 +66,26 @@ type Storage interface {
 	ScanSequenced(ctx context.Context, begin uint64, f func(seq uint64, entry []byte) error) (uint64, error)
 }
 
+// LeafIndexer is implemented by Storage implementations which maintain a
+// persistent index of the leaf hashes of sequenced entries, used to deduplicate
+// submissions across the full history of the log.
+//
+// Implementations should record leaf hashes as they're sequenced, but since a
+// crash may leave an entry sequenced without its hash having been indexed,
+// Integrate also indexes every entry it integrates.
+type LeafIndexer interface {
+	// LeafIndex returns the sequence number of the entry with the given leaf
+	// hash, or an error wrapping os.ErrNotExist if there is no such entry.
+	//
+	// This allows the add path to report the index of a resubmitted leaf
+	// without sequencing it again.
+	LeafIndex(ctx context.Context, leafhash []byte) (uint64, error)
+
+	// IndexLeaf records that the entry with the given leaf hash was sequenced
+	// at seq. If the leaf hash is already indexed, the existing entry is kept.
+	IndexLeaf(ctx context.Context, leafhash []byte, seq uint64) error
+}
+
 var (
 	// ErrDupeLeaf is returned by the Sequence method of storage implementations to
 	// indicate that a leaf has already been sequenced.
@@ -63,11 +94,128 @@ var (
 	// ErrSeqAlreadyAssigned is returned by the Assign method of storage implementations
 	// to indicate that the provided sequence number is already in use.
 	ErrSeqAlreadyAssigned = errors.New("sequence number already assigned")
+
+	// ErrConflict is returned by storage implementations to indicate that a
+	// write was refused because another writer, e.g. a concurrent integration,
+	// modified the log first. The operation may be retried from the start,
+	// after re-reading the log's checkpoint.
+	ErrConflict = errors.New("conflicting concurrent write")
 )
 
-// Integrate adds all sequenced entries greater than fromSize into the tree.
-// Returns an updated Checkpoint, or an error.
-func Integrate(ctx context.Context, fromSize uint64, st Storage, h merkle.LogHasher) (*log.Checkpoint, error) {
+// IntegrateOption is used to configure optional behaviour of Integrate.
+type IntegrateOption func(*integrateOpts)
+
+type integrateOpts struct {
+	concurrency int
+	maxLeaves   uint64
+	flushSize   uint64
+}
+
+// WithConcurrency sets the number of workers used to hash new entries, and to
+// store updated tiles, in parallel. It defaults to GOMAXPROCS.
+func WithConcurrency(n int) IntegrateOption {
+	return func(o *integrateOpts) {
+		o.concurrency = n
+	}
+}
+
+// WithMaxLeaves limits the number of new entries integrated by each call to
+// Integrate to n, so that a large backlog is integrated over several calls,
+// each of which returns a checkpoint. Zero, the default, means no limit.
+func WithMaxLeaves(n uint64) IntegrateOption {
+	return func(o *integrateOpts) {
+		o.maxLeaves = n
+	}
+}
+
+// WithFlushSize causes new entries to be integrated in batches of at most n,
+// the updated tiles for each of which are stored before the next batch is
+// read, so that the memory used to integrate a large backlog is bounded.
+// Only the checkpoint committing to all of the batches is returned. Zero, the
+// default, means all new entries are integrated in a single batch.
+func WithFlushSize(n uint64) IntegrateOption {
+	return func(o *integrateOpts) {
+		o.flushSize = n
+	}
+}
+
+// Integrate adds all sequenced entries greater than fromSize into the tree,
+// up to the limit set by WithMaxLeaves. Returns an updated Checkpoint, or
+// nil if there was nothing to integrate, or an error.
+//
+// If st implements Journal, the tiles and checkpoint which result from the
+// integration are journaled before any tiles are stored. If that journal shows
+// that a previous integration from fromSize was interrupted, that integration
+// is completed, and its checkpoint returned, instead of integrating any new
+// entries.
+//
+// New entries are hashed in chunks, with the subtree over each chunk being
+// calculated concurrently, and the updated tiles are stored concurrently, so
+// st's StoreTile method must be safe for concurrent use.
+func Integrate(ctx context.Context, fromSize uint64, st Storage, h merkle.LogHasher, opts ...IntegrateOption) (*log.Checkpoint, error) {
+	o := integrateOpts{concurrency: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.concurrency < 1 {
+		o.concurrency = 1
+	}
+	j, _ := st.(Journal)
+	if j != nil {
+		cp, err := rollForward(ctx, fromSize, st, j, o.concurrency)
+		if err != nil || cp != nil {
+			return cp, err
+		}
+	}
+
+	var cp *log.Checkpoint
+	size := fromSize
+	for {
+		n := o.flushSize
+		if o.maxLeaves > 0 {
+			left := o.maxLeaves - (size - fromSize)
+			if left == 0 {
+				break
+			}
+			if n == 0 || left < n {
+				n = left
+			}
+		}
+		bcp, err := integrateBatch(ctx, fromSize, size, n, st, h, j, o.concurrency)
+		if err != nil {
+			return nil, err
+		}
+		if bcp == nil {
+			break
+		}
+		cp = bcp
+		// Stop once the backlog is exhausted, or if entries aren't being
+		// integrated in batches.
+		if o.flushSize == 0 || bcp.Size-size < n {
+			break
+		}
+		size = bcp.Size
+	}
+	if cp == nil {
+		klog.Infof("Nothing to do.")
+		// Nothing to do, nothing done.
+		return nil, nil
+	}
+	return cp, nil
+}
+
+// errBatchFull is used to stop scanning sequenced entries once a batch is
+// full.
+var errBatchFull = errors.New("batch full")
+
+// integrateBatch integrates up to n new entries, or all of them if n is zero,
+// into the tree of size fromSize, and stores the updated tiles. Returns an
+// updated Checkpoint, or nil if there was nothing to integrate.
+//
+// runFrom is the size of the tree when Integrate was called. The tiles for
+// any earlier batches since then have already been stored, so the journal
+// records the integration from runFrom, but only this batch's tiles.
+func integrateBatch(ctx context.Context, runFrom, fromSize, n uint64, st Storage, h merkle.LogHasher, j Journal, concurrency int) (*log.Checkpoint, error) {
 	getTile := func(l, i uint64) (*api.Tile, error) {
 		return st.GetTile(ctx, l, i, fromSize)
 	}
@@ -93,28 +241,76 @@ func Integrate(ctx context.Context, fromSize uint64, st Storage, h merkle.LogHas
 
 	klog.Infof("Loaded state with roothash %x", r)
 
-	// Create a new compact range which represents the update to the tree
-	newRange := rf.NewEmptyRange(fromSize)
-	tc := tileCache{m: make(map[tileKey]*api.Tile), getTile: getTile}
-	n, err := st.ScanSequenced(ctx,
+	// Hash the new entries in chunks, each of which is handled by a worker
+	// which calculates the subtree over the chunk's leaves, recording the
+	// nodes it creates.
+	var chunks []*chunk
+	var cur *chunk
+	var scanned uint64
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	_, err = st.ScanSequenced(ctx,
 		fromSize,
 		func(seq uint64, entry []byte) error {
-			lh := h.HashLeaf(entry)
-			// Update range and set nodes
-			if err := newRange.Append(lh, tc.Visit); err != nil {
-				return fmt.Errorf("newRange.Append(): %v", err)
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			if n > 0 && scanned == n {
+				return errBatchFull
+			}
+			scanned++
+			if cur == nil {
+				cur = &chunk{start: seq}
+				chunks = append(chunks, cur)
+			}
+			// Storage implementations may reuse the entry buffer.
+			cur.leaves = append(cur.leaves, bytes.Clone(entry))
+			if (seq+1)%chunkSize == 0 {
+				c := cur
+				g.Go(func() error { return c.hash(&rf, h) })
+				cur = nil
 			}
 			return nil
 		})
+	if cur != nil {
+		c := cur
+		g.Go(func() error { return c.hash(&rf, h) })
+	}
+	if errors.Is(err, errBatchFull) {
+		err = nil
+	}
+	// A failed worker stops the scan, so report its error in preference.
+	if gErr := g.Wait(); gErr != nil {
+		err = gErr
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error while integrating: %w", err)
 	}
-	if n == 0 {
-		klog.Infof("Nothing to do.")
-		// Nothing to do, nothing done.
+	if scanned == 0 {
 		return nil, nil
 	}
 
+	// Create a new compact range which represents the update to the tree, by
+	// merging the chunks in order.
+	newRange := rf.NewEmptyRange(fromSize)
+	tc := tileCache{m: make(map[tileKey]*api.Tile), getTile: getTile}
+	li, _ := st.(LeafIndexer)
+	for _, c := range chunks {
+		if li != nil {
+			for i, lh := range c.hashes {
+				if err := li.IndexLeaf(ctx, lh, c.start+uint64(i)); err != nil {
+					return nil, fmt.Errorf("failed to index leaf %d: %w", c.start+uint64(i), err)
+				}
+			}
+		}
+		for _, nd := range c.nodes {
+			tc.Visit(nd.id, nd.hash)
+		}
+		if err := newRange.AppendRange(c.rng, tc.Visit); err != nil {
+			return nil, fmt.Errorf("failed to merge range at %d: %w", c.start, err)
+		}
+	}
+
 	// Merge the update range into the old tree
 	if err := baseRange.AppendRange(newRange, tc.Visit); err != nil {
 		return nil, fmt.Errorf("failed to merge new range onto existing log: %w", err)
@@ -131,11 +327,20 @@ func Integrate(ctx context.Context, fromSize uint64, st Storage, h merkle.LogHas
 	// tiles and updated log state.
 	klog.Infof("New log state: size 0x%x hash: %x", baseRange.End(), newRoot)
 
-	for k, t := range tc.m {
-		if err := st.StoreTile(ctx, k.level, k.index, t); err != nil {
-			return nil, fmt.Errorf("failed to store tile at level %d index %d: %w", k.level, k.index, err)
+	// Record the writes which are about to be made, so that they can be
+	// completed if they're interrupted.
+	if j != nil {
+		raw, err := journalEntry{fromSize: runFrom, size: baseRange.End(), hash: newRoot, tiles: tc.m}.MarshalText()
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal journal: %w", err)
+		}
+		if err := j.WriteJournal(ctx, raw); err != nil {
+			return nil, fmt.Errorf("failed to write journal: %w", err)
 		}
 	}
+	if err := storeTiles(ctx, st, tc.m, concurrency); err != nil {
+		return nil, err
+	}
 
 	// Finally, return a new checkpoint struct to the caller, so they can sign &
 	// persist it.
@@ -152,6 +357,94 @@ func Integrate(ctx context.Context, fromSize uint64, st Storage, h merkle.LogHas
 	return &newCP, nil
 }
 
+// rollForward completes the integration recorded in the journal j, if it
+// started from fromSize, and returns the resulting checkpoint. Journals for
+// integrations which started from any other size are stale, since the log's
+// checkpoint has moved on, and are discarded.
+//
+// Returns a nil checkpoint if there is no integration to complete.
+func rollForward(ctx context.Context, fromSize uint64, st Storage, j Journal, concurrency int) (*log.Checkpoint, error) {
+	raw, err := j.ReadJournal(ctx)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	var e journalEntry
+	if err := e.UnmarshalText(raw); err != nil {
+		return nil, fmt.Errorf("failed to parse journal: %w", err)
+	}
+	if e.fromSize != fromSize {
+		klog.Infof("Discarding stale journal for integration of [%d, %d)", e.fromSize, e.size)
+		if err := j.DeleteJournal(ctx); err != nil {
+			return nil, fmt.Errorf("failed to delete stale journal: %w", err)
+		}
+		return nil, nil
+	}
+
+	klog.Infof("Rolling forward interrupted integration of [%d, %d) with roothash %x", e.fromSize, e.size, e.hash)
+	if err := storeTiles(ctx, st, e.tiles, concurrency); err != nil {
+		return nil, err
+	}
+	return &log.Checkpoint{
+		Hash: e.hash,
+		Size: e.size,
+	}, nil
+}
+
+// storeTiles stores the tiles in parallel, using up to concurrency workers.
+func storeTiles(ctx context.Context, st Storage, tiles map[tileKey]*api.Tile, concurrency int) error {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for k, t := range tiles {
+		k, t := k, t
+		g.Go(func() error {
+			if err := st.StoreTile(gctx, k.level, k.index, t); err != nil {
+				return fmt.Errorf("failed to store tile at level %d index %d: %w", k.level, k.index, err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// chunk is a contiguous run of new entries, whose subtree is hashed
+// independently of the others.
+type chunk struct {
+	start  uint64
+	leaves [][]byte
+
+	// Set by hash.
+	hashes [][]byte
+	rng    *compact.Range
+	nodes  []node
+}
+
+// node is a tree node created while hashing a chunk.
+type node struct {
+	id   compact.NodeID
+	hash []byte
+}
+
+// hash calculates the leaf hashes of the chunk's entries, and the compact range
+// covering them, recording each of the nodes which are created.
+func (c *chunk) hash(rf *compact.RangeFactory, h merkle.LogHasher) error {
+	c.rng = rf.NewEmptyRange(c.start)
+	c.hashes = make([][]byte, 0, len(c.leaves))
+	visit := func(id compact.NodeID, hash []byte) {
+		c.nodes = append(c.nodes, node{id: id, hash: hash})
+	}
+	for i, l := range c.leaves {
+		lh := h.HashLeaf(l)
+		c.hashes = append(c.hashes, lh)
+		if err := c.rng.Append(lh, visit); err != nil {
+			return fmt.Errorf("failed to append leaf %d: %v", c.start+uint64(i), err)
+		}
+	}
+	c.leaves = nil
+	return nil
+}
+
 // tileKey is a level/index key for the tile cache below.
 type tileKey struct {
 	level uint64
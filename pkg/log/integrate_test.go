@@ -0,0 +1,272 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/serverless-log/api"
+	"github.com/transparency-dev/serverless-log/pkg/log"
+	"github.com/transparency-dev/serverless-log/testonly"
+)
+
+// sequence adds n new leaves to st, which holds size leaves.
+func sequence(t testing.TB, st *testonly.MemStorage, size uint64, n int) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		l := []byte(fmt.Sprintf("leaf %d", size+uint64(i)))
+		if _, err := st.Sequence(ctx, rfc6962.DefaultHasher.HashLeaf(l), l); err != nil {
+			t.Fatalf("Sequence: %v", err)
+		}
+	}
+}
+
+func TestIntegrateConcurrency(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	// Batches which start and end both on and off chunk boundaries.
+	batches := []int{1, 255, 256, 300, 1024, 1, 700}
+
+	for _, concurrency := range []int{1, 2, 8} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			st := testonly.NewMemStorage()
+			rf := compact.RangeFactory{Hash: h.HashChildren}
+			want := rf.NewEmptyRange(0)
+			var size uint64
+			for _, n := range batches {
+				sequence(t, st, size, n)
+				if _, err := st.ScanSequenced(ctx, size, func(_ uint64, e []byte) error {
+					return want.Append(h.HashLeaf(e), nil)
+				}); err != nil {
+					t.Fatalf("ScanSequenced: %v", err)
+				}
+
+				cp, err := log.Integrate(ctx, size, st, h, log.WithConcurrency(concurrency))
+				if err != nil {
+					t.Fatalf("Integrate: %v", err)
+				}
+				wantRoot, err := want.GetRootHash(nil)
+				if err != nil {
+					t.Fatalf("GetRootHash: %v", err)
+				}
+				if cp.Size != want.End() || !bytes.Equal(cp.Hash, wantRoot) {
+					t.Fatalf("Integrate: got size %d root %x, want size %d root %x", cp.Size, cp.Hash, want.End(), wantRoot)
+				}
+				size = cp.Size
+			}
+		})
+	}
+}
+
+// rootHash returns the root hash of the first size entries sequenced in st.
+func rootHash(t *testing.T, st *testonly.MemStorage, size uint64) []byte {
+	t.Helper()
+	h := rfc6962.DefaultHasher
+	r := (&compact.RangeFactory{Hash: h.HashChildren}).NewEmptyRange(0)
+	if _, err := st.ScanSequenced(context.Background(), 0, func(seq uint64, e []byte) error {
+		if seq < size {
+			return r.Append(h.HashLeaf(e), nil)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("ScanSequenced: %v", err)
+	}
+	root, err := r.GetRootHash(nil)
+	if err != nil {
+		t.Fatalf("GetRootHash: %v", err)
+	}
+	return root
+}
+
+// interruptedStorage is a MemStorage whose StoreTile fails once tiles have
+// been stored.
+type interruptedStorage struct {
+	*testonly.MemStorage
+	tiles atomic.Int32
+	limit int32
+}
+
+func (s *interruptedStorage) StoreTile(ctx context.Context, level, index uint64, tile *api.Tile) error {
+	if s.tiles.Add(1) > s.limit {
+		return errors.New("interrupted")
+	}
+	return s.MemStorage.StoreTile(ctx, level, index, tile)
+}
+
+func TestIntegrateJournal(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	st := testonly.NewMemStorage()
+	sequence(t, st, 0, 300)
+	cp, err := log.Integrate(ctx, 0, st, h)
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+
+	// Interrupt an integration after it has stored some of its tiles.
+	sequence(t, st, 300, 700)
+	if _, err := log.Integrate(ctx, cp.Size, &interruptedStorage{MemStorage: st, limit: 2}, h, log.WithConcurrency(1)); err == nil {
+		t.Fatal("Integrate: got no error from interrupted integration")
+	}
+	if _, err := st.ReadJournal(ctx); err != nil {
+		t.Fatalf("ReadJournal after interrupted integration: %v", err)
+	}
+
+	// The interrupted integration should be rolled forward, ignoring entries
+	// which have been sequenced since.
+	sequence(t, st, 1000, 24)
+	got, err := log.Integrate(ctx, cp.Size, st, h)
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	if want := rootHash(t, st, 1000); got.Size != 1000 || !bytes.Equal(got.Hash, want) {
+		t.Fatalf("Rolled forward integration: got size %d root %x, want size 1000 root %x", got.Size, got.Hash, want)
+	}
+
+	// Once the checkpoint has moved on, the journal is stale and the new
+	// entries are integrated.
+	got, err = log.Integrate(ctx, got.Size, st, h)
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	if want := rootHash(t, st, 1024); got.Size != 1024 || !bytes.Equal(got.Hash, want) {
+		t.Fatalf("Integrate: got size %d root %x, want size 1024 root %x", got.Size, got.Hash, want)
+	}
+	raw, err := st.ReadJournal(ctx)
+	if err != nil {
+		t.Fatalf("ReadJournal: %v", err)
+	}
+	if err := st.DeleteJournal(ctx); err != nil {
+		t.Fatalf("DeleteJournal: %v", err)
+	}
+
+	// Integrating from the stored tiles should give the same tree.
+	sequence(t, st, 1024, 1)
+	got, err = log.Integrate(ctx, 1024, st, h)
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	if want := rootHash(t, st, 1025); !bytes.Equal(got.Hash, want) {
+		t.Fatalf("Integrate: got root %x, want %x", got.Hash, want)
+	}
+
+	// A corrupt journal must not be ignored.
+	if err := st.WriteJournal(ctx, raw[:len(raw)-10]); err != nil {
+		t.Fatalf("WriteJournal: %v", err)
+	}
+	if _, err := log.Integrate(ctx, 1025, st, h); err == nil {
+		t.Error("Integrate: got no error with corrupt journal")
+	}
+	if _, err := st.ReadJournal(ctx); errors.Is(err, os.ErrNotExist) {
+		t.Error("Corrupt journal was removed")
+	}
+}
+
+func TestIntegrateLimits(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	for _, test := range []struct {
+		desc      string
+		maxLeaves uint64
+		flushSize uint64
+		// wantSizes are the sizes of the checkpoints returned by successive
+		// integrations.
+		wantSizes []uint64
+	}{
+		{desc: "no limits", wantSizes: []uint64{1000}},
+		{desc: "max leaves", maxLeaves: 300, wantSizes: []uint64{300, 600, 900, 1000}},
+		{desc: "flush size", flushSize: 256, wantSizes: []uint64{1000}},
+		{desc: "flush size larger than backlog", flushSize: 4096, wantSizes: []uint64{1000}},
+		{desc: "both", maxLeaves: 600, flushSize: 256, wantSizes: []uint64{600, 1000}},
+		{desc: "max leaves smaller than flush size", maxLeaves: 100, flushSize: 256, wantSizes: []uint64{100, 200, 300, 400, 500, 600, 700, 800, 900, 1000}},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			st := testonly.NewMemStorage()
+			sequence(t, st, 0, 1000)
+			var size uint64
+			for _, want := range test.wantSizes {
+				cp, err := log.Integrate(ctx, size, st, h, log.WithMaxLeaves(test.maxLeaves), log.WithFlushSize(test.flushSize))
+				if err != nil {
+					t.Fatalf("Integrate: %v", err)
+				}
+				if cp == nil || cp.Size != want {
+					t.Fatalf("Integrate(%d): got checkpoint %v, want size %d", size, cp, want)
+				}
+				if wantRoot := rootHash(t, st, want); !bytes.Equal(cp.Hash, wantRoot) {
+					t.Fatalf("Integrate(%d): got root %x, want %x", size, cp.Hash, wantRoot)
+				}
+				size = cp.Size
+			}
+			if cp, err := log.Integrate(ctx, size, st, h, log.WithMaxLeaves(test.maxLeaves), log.WithFlushSize(test.flushSize)); err != nil || cp != nil {
+				t.Errorf("Integrate(%d) = %v, %v, want nothing to integrate", size, cp, err)
+			}
+		})
+	}
+}
+
+func TestIntegrateFlushJournal(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	st := testonly.NewMemStorage()
+	sequence(t, st, 0, 1000)
+
+	// Interrupt the second batch, once the first batch's tiles have been
+	// stored.
+	if _, err := log.Integrate(ctx, 0, &interruptedStorage{MemStorage: st, limit: 3}, h, log.WithConcurrency(1), log.WithFlushSize(256)); err == nil {
+		t.Fatal("Integrate: got no error from interrupted integration")
+	}
+
+	// The interrupted batch should be rolled forward.
+	got, err := log.Integrate(ctx, 0, st, h, log.WithFlushSize(256))
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	if want := rootHash(t, st, 512); got.Size != 512 || !bytes.Equal(got.Hash, want) {
+		t.Fatalf("Rolled forward integration: got size %d root %x, want size 512 root %x", got.Size, got.Hash, want)
+	}
+	got, err = log.Integrate(ctx, got.Size, st, h, log.WithFlushSize(256))
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	if want := rootHash(t, st, 1000); got.Size != 1000 || !bytes.Equal(got.Hash, want) {
+		t.Fatalf("Integrate: got size %d root %x, want size 1000 root %x", got.Size, got.Hash, want)
+	}
+}
+
+func BenchmarkIntegrate(b *testing.B) {
+	ctx := context.Background()
+	for _, concurrency := range []int{1, 4} {
+		b.Run(fmt.Sprintf("concurrency %d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				st := testonly.NewMemStorage()
+				sequence(b, st, 0, 1<<14)
+				b.StartTimer()
+				if _, err := log.Integrate(ctx, 0, st, rfc6962.DefaultHasher, log.WithConcurrency(concurrency)); err != nil {
+					b.Fatalf("Integrate: %v", err)
+				}
+			}
+		})
+	}
+}
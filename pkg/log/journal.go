@@ -0,0 +1,151 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/transparency-dev/serverless-log/api"
+)
+
+// Journal is implemented by Storage implementations which can durably record
+// the writes which an integration intends to make, before making them.
+//
+// If an integration is interrupted after some of its tiles have been stored,
+// e.g. because the process was killed by a Cloud Run or Lambda timeout, the
+// next call to Integrate finds the journal and rolls the interrupted
+// integration forward, storing the same tiles and returning the same
+// checkpoint, rather than integrating from scratch.
+//
+// Journals are discarded by Integrate once the log's checkpoint has moved past
+// them. Callers may also call DeleteJournal once they've written the new
+// checkpoint.
+type Journal interface {
+	// WriteJournal durably stores the journal, replacing any existing one.
+	// The journal must either be written completely, or not at all.
+	WriteJournal(ctx context.Context, raw []byte) error
+
+	// ReadJournal returns the stored journal, or an error wrapping
+	// os.ErrNotExist if there is none.
+	ReadJournal(ctx context.Context) ([]byte, error)
+
+	// DeleteJournal removes the stored journal, if any.
+	DeleteJournal(ctx context.Context) error
+}
+
+// journalHeader is the first line of a serialised journalEntry.
+const journalHeader = "serverless-log integration journal"
+
+// journalEntry records the result of integrating the entries in
+// [fromSize, size) into the tree: the tiles which are to be stored, and the
+// new root hash.
+type journalEntry struct {
+	fromSize uint64
+	size     uint64
+	hash     []byte
+	tiles    map[tileKey]*api.Tile
+}
+
+// MarshalText writes out a journalEntry in the following format:
+//
+// serverless-log integration journal\n
+// <from size in decimal>\n
+// <size in decimal>\n
+// <root hash base64 encoded>\n
+// <tile level in decimal> <tile index in decimal> <tile, see api.Tile.MarshalText, base64 encoded>\n
+// ...
+//
+// Tiles are written in level then index order.
+func (e journalEntry) MarshalText() ([]byte, error) {
+	keys := make([]tileKey, 0, len(e.tiles))
+	for k := range e.tiles {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].level != keys[j].level {
+			return keys[i].level < keys[j].level
+		}
+		return keys[i].index < keys[j].index
+	})
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n%d\n%d\n%s\n", journalHeader, e.fromSize, e.size, base64.StdEncoding.EncodeToString(e.hash))
+	for _, k := range keys {
+		t, err := e.tiles[k].MarshalText()
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tile at level %d index %d: %w", k.level, k.index, err)
+		}
+		fmt.Fprintf(b, "%d %d %s\n", k.level, k.index, base64.StdEncoding.EncodeToString(t))
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalText reads journal entries which were written by the MarshalText
+// method above.
+func (e *journalEntry) UnmarshalText(raw []byte) error {
+	if len(raw) == 0 || raw[len(raw)-1] != '\n' {
+		return fmt.Errorf("journal is truncated")
+	}
+	lines := strings.Split(string(raw[:len(raw)-1]), "\n")
+	if len(lines) < 4 || lines[0] != journalHeader {
+		return fmt.Errorf("invalid journal header")
+	}
+	fromSize, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid from size %q: %w", lines[1], err)
+	}
+	size, err := strconv.ParseUint(lines[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size %q: %w", lines[2], err)
+	}
+	if size <= fromSize {
+		return fmt.Errorf("size %d must be greater than from size %d", size, fromSize)
+	}
+	hash, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil {
+		return fmt.Errorf("invalid root hash: %w", err)
+	}
+	tiles := make(map[tileKey]*api.Tile, len(lines)-4)
+	for _, l := range lines[4:] {
+		f := strings.Fields(l)
+		if len(f) != 3 {
+			return fmt.Errorf("invalid tile line %q", l)
+		}
+		var k tileKey
+		if k.level, err = strconv.ParseUint(f[0], 10, 64); err != nil {
+			return fmt.Errorf("invalid tile level %q: %w", f[0], err)
+		}
+		if k.index, err = strconv.ParseUint(f[1], 10, 64); err != nil {
+			return fmt.Errorf("invalid tile index %q: %w", f[1], err)
+		}
+		t, err := base64.StdEncoding.DecodeString(f[2])
+		if err != nil {
+			return fmt.Errorf("invalid tile at level %d index %d: %w", k.level, k.index, err)
+		}
+		tile := &api.Tile{}
+		if err := tile.UnmarshalText(t); err != nil {
+			return fmt.Errorf("invalid tile at level %d index %d: %w", k.level, k.index, err)
+		}
+		tiles[k] = tile
+	}
+	e.fromSize, e.size, e.hash, e.tiles = fromSize, size, hash, tiles
+	return nil
+}
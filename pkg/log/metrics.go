@@ -0,0 +1,47 @@
+// Copyright 2024 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import "time"
+
+// StorageMetrics is an optional hook which may be provided to Storage
+// implementations in order to observe the operations they make on their
+// underlying store, e.g. so that the sequence and integrate tools can export
+// them to a monitoring system.
+//
+// Objects are identified by their key, i.e. their path relative to the root of
+// the log, see api/layout. Since there are very many objects, implementations
+// which export metrics will usually want to aggregate them by the first
+// element of the key, e.g. "tile" or "seq".
+//
+// Implementations must be safe for concurrent use.
+type StorageMetrics interface {
+	// ObjectRead is called once an object has been read, or reading it has
+	// failed. size is the number of bytes read, and err is the error, if any.
+	// Reads of objects which don't exist fail with an error wrapping
+	// os.ErrNotExist.
+	ObjectRead(key string, size int, d time.Duration, err error)
+
+	// ObjectWritten is called once an object has been written, or writing it
+	// has failed. size is the number of bytes written, and err is the error,
+	// if any.
+	ObjectWritten(key string, size int, d time.Duration, err error)
+
+	// PreconditionFailed is called when a conditional write to an object is
+	// refused because its precondition did not hold, e.g. because another
+	// writer created or modified the object first. If the write was attempted,
+	// ObjectWritten is also called with its error.
+	PreconditionFailed(key string)
+}
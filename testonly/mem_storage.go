@@ -36,7 +36,14 @@ type MemStorage struct {
 	nextSeq uint64
 }
 
-var _ log.Storage = &MemStorage{}
+var (
+	_ log.Storage     = &MemStorage{}
+	_ log.LeafIndexer = &MemStorage{}
+	_ log.Journal     = &MemStorage{}
+)
+
+// journalKey is the key under which the integration journal is stored.
+const journalKey = ".integrate.journal"
 
 func NewMemStorage() *MemStorage {
 	return &MemStorage{
@@ -87,6 +94,33 @@ func (ms *MemStorage) WriteCheckpoint(_ context.Context, newCPRaw []byte) error
 	return nil
 }
 
+// WriteJournal stores the integration journal.
+func (ms *MemStorage) WriteJournal(_ context.Context, raw []byte) error {
+	ms.Lock()
+	defer ms.Unlock()
+	ms.fs[journalKey] = raw
+	return nil
+}
+
+// ReadJournal returns the integration journal.
+func (ms *MemStorage) ReadJournal(_ context.Context) ([]byte, error) {
+	ms.Lock()
+	defer ms.Unlock()
+	j, ok := ms.fs[journalKey]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return j, nil
+}
+
+// DeleteJournal removes the integration journal.
+func (ms *MemStorage) DeleteJournal(_ context.Context) error {
+	ms.Lock()
+	defer ms.Unlock()
+	delete(ms.fs, journalKey)
+	return nil
+}
+
 // Sequence assigns sequence numbers to the passed in entry.
 // Returns the assigned sequence number for the leafhash.
 //
@@ -97,15 +131,48 @@ func (ms *MemStorage) Sequence(_ context.Context, leafhash []byte, leaf []byte)
 	ms.Lock()
 	defer ms.Unlock()
 
+	if origSeq, err := ms.leafIndex(leafhash); err == nil {
+		return origSeq, log.ErrDupeLeaf
+	}
+
 	seq := ms.nextSeq
 	ms.nextSeq++
 
 	ds, ks := layout.SeqPath("", seq)
 	ms.fs[filepath.Join(ds, ks)] = leaf
-	dl, kl := layout.LeafPath("", leafhash)
-	ms.fs[filepath.Join(dl, kl)] = []byte(strconv.FormatUint(seq, 16))
+	ms.indexLeaf(leafhash, seq)
 	return seq, nil
+}
+
+// LeafIndex returns the sequence number of the entry with the given leaf hash.
+func (ms *MemStorage) LeafIndex(_ context.Context, leafhash []byte) (uint64, error) {
+	ms.Lock()
+	defer ms.Unlock()
+	return ms.leafIndex(leafhash)
+}
 
+// IndexLeaf records that the entry with the given leaf hash was sequenced at seq.
+func (ms *MemStorage) IndexLeaf(_ context.Context, leafhash []byte, seq uint64) error {
+	ms.Lock()
+	defer ms.Unlock()
+	ms.indexLeaf(leafhash, seq)
+	return nil
+}
+
+func (ms *MemStorage) leafIndex(leafhash []byte) (uint64, error) {
+	dl, kl := layout.LeafPath("", leafhash)
+	s, ok := ms.fs[filepath.Join(dl, kl)]
+	if !ok {
+		return 0, os.ErrNotExist
+	}
+	return strconv.ParseUint(string(s), 16, 64)
+}
+
+func (ms *MemStorage) indexLeaf(leafhash []byte, seq uint64) {
+	dl, kl := layout.LeafPath("", leafhash)
+	if _, ok := ms.fs[filepath.Join(dl, kl)]; !ok {
+		ms.fs[filepath.Join(dl, kl)] = []byte(strconv.FormatUint(seq, 16))
+	}
 }
 
 // ScanSequenced calls f for each contiguous sequenced log entry >= begin.